@@ -0,0 +1,1080 @@
+package cgen
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/damischa1/iec-st-tools/st"
+)
+
+// ── Functions ─────────────────────────────────────────────────────────────────
+
+// fn collects the C code of one function.
+type fn struct {
+	g        *generator
+	pou      *st.POU // POU whose code is translated; nil for initial values
+	fb       *st.POU // function block or program self points to, nil for functions
+	scope    *st.Scope
+	file     string
+	locals   map[string]string // C expression of locals and parameters by upper-case name
+	decls    []string          // local declarations
+	body     strings.Builder
+	depth    int
+	ntmp     int
+	ret      string  // C statement of RETURN
+	at       st.Node // statement being translated, for errors without a node
+	usesSelf bool
+}
+
+func (g *generator) newFn(d, fb *st.POU, s *st.Scope) *fn {
+	f := &fn{g: g, pou: d, fb: fb, scope: s, locals: map[string]string{}, ret: "return;"}
+	switch {
+	case d != nil:
+		f.file = g.fileName(d)
+	case fb != nil:
+		f.file = g.fileName(fb)
+	}
+	return f
+}
+
+func (f *fn) errorf(n st.Node, format string, args ...any) {
+	if n == nil {
+		n = f.at
+	}
+	f.g.errorf(f.file, n, format, args...)
+}
+
+func (f *fn) line(format string, args ...any) {
+	f.body.WriteString(strings.Repeat("    ", f.depth+1))
+	fmt.Fprintf(&f.body, format, args...)
+	f.body.WriteByte('\n')
+}
+
+// temp declares a temporary; decl is its declaration with %s for the name.
+func (f *fn) temp(decl string) string {
+	f.ntmp++
+	name := "tmp__" + strconv.Itoa(f.ntmp)
+	f.decls = append(f.decls, fmt.Sprintf(decl, name))
+	return name
+}
+
+// finish returns the function definition with the given prototype.
+func (f *fn) finish(proto string) string {
+	var sb strings.Builder
+	sb.WriteString(proto)
+	sb.WriteString("\n{\n")
+	for _, d := range f.decls {
+		sb.WriteString("    " + d + ";\n")
+	}
+	if f.fb != nil && !f.usesSelf {
+		sb.WriteString("    (void)self;\n")
+	}
+	if len(f.decls) > 0 && f.body.Len() > 0 {
+		sb.WriteString("\n")
+	}
+	sb.WriteString(f.body.String())
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+// inGlobalScope translates initial values of types in the global scope.
+func (f *fn) inGlobalScope(fn func()) {
+	scope, locals, fb, file := f.scope, f.locals, f.fb, f.file
+	f.scope, f.locals, f.fb = f.g.p.GlobalScope(), map[string]string{}, nil
+	fn()
+	f.scope, f.locals, f.fb, f.file = scope, locals, fb, file
+}
+
+func (g *generator) stepName(d *st.POU) string {
+	if d.Kind == st.Program {
+		return cname(d.Name.Name) + "__step"
+	}
+	return g.pouName(d) + "__step"
+}
+
+func (g *generator) initName(d *st.POU) string {
+	if d.Kind == st.Program {
+		return cname(d.Name.Name) + "__init"
+	}
+	return g.pouName(d) + "__init"
+}
+
+// routine translates a FUNCTION, or a METHOD of fb.
+func (g *generator) routine(d, fb *st.POU) string {
+	f := g.newFn(d, fb, g.scope(d))
+	name := g.pouName(d)
+
+	// VAR_STAT keep their values between calls: file-level statics,
+	// initialised on the first call after plc_init
+	first := true
+	for _, b := range d.VarBlocks {
+		if b.Kind != "VAR_STAT" {
+			continue
+		}
+		for _, v := range b.Vars {
+			t := f.scope.ResolveType(v.Type)
+			if msg := g.checkType(t); msg != "" {
+				f.errorf(v, "%s: %s", v.Names[0].Name, msg)
+				continue
+			}
+			if first {
+				flag := name + "__static"
+				g.staticDef = append(g.staticDef, "static bool "+flag+";")
+				g.staticReset = append(g.staticReset, flag)
+				f.line("if (!%s) {", flag)
+				f.depth++
+				f.line("%s = true;", flag)
+				first = false
+			}
+			for _, id := range v.Names {
+				sname := name + "__" + id.Name
+				g.staticDef = append(g.staticDef, "static "+g.decl(t, sname)+";")
+				f.locals[strings.ToUpper(id.Name)] = sname
+				f.reset(sname, t, v.Init)
+			}
+		}
+	}
+	if !first {
+		f.depth--
+		f.line("}")
+	}
+
+	for _, b := range d.VarBlocks {
+		for _, v := range b.Vars {
+			t := f.scope.ResolveType(v.Type)
+			if g.checkType(t) != "" {
+				continue // reported with the signature or the statics
+			}
+			for _, id := range v.Names {
+				c, key := cname(id.Name), strings.ToUpper(id.Name)
+				switch b.Kind {
+				case "VAR_INPUT":
+					f.locals[key] = c
+					switch t.Class {
+					case st.StringClass:
+						f.decls = append(f.decls, fmt.Sprintf("char %s[%d]", c, t.Len+1))
+						f.line("iec_strset(%s, %d, %s__in);", c, t.Len, c)
+					case st.ArrayClass:
+						f.decls = append(f.decls, g.decl(t, c))
+						f.line("memcpy(%s, %s__in, sizeof %s);", c, c, c)
+					}
+				case "VAR_IN_OUT":
+					f.locals[key] = "(*" + c + ")"
+				case "VAR_OUTPUT":
+					lv := "(*" + c + ")"
+					f.locals[key] = lv
+					f.reset(lv, t, v.Init)
+				case "VAR", "VAR_TEMP":
+					f.decls = append(f.decls, g.decl(t, c)+" = "+zeroInit(t))
+					f.locals[key] = c
+					f.defaults(c, t)
+					if v.Init != nil {
+						f.initValue(c, t, v.Init)
+					}
+				case "VAR_STAT", "VAR_EXTERNAL":
+				default:
+					f.errorf(b, "%s in %s is not supported", b.Kind, d.Name.Name)
+				}
+			}
+		}
+	}
+	if rt := g.resultType(d); rt != nil {
+		key := strings.ToUpper(d.Name.Name)
+		if _, shadowed := f.locals[key]; !shadowed {
+			f.locals[key] = "ret__"
+		}
+		if rt.Class == st.StringClass {
+			f.line("ret__[0] = 0;")
+		} else if g.checkType(rt) == "" {
+			f.decls = append(f.decls, g.decl(rt, "ret__")+" = "+zeroInit(rt))
+			f.defaults("ret__", rt)
+		}
+		f.ret = "return ret__;"
+	}
+	f.stmts(d.Body)
+	if f.ret != "return;" {
+		f.line("%s", f.ret)
+	}
+	return f.finish(g.signature(d, name))
+}
+
+// fbInit writes the init function of a function block or program, which
+// sets all variables of an instance to their initial values.
+func (g *generator) fbInit(d *st.POU) string {
+	f := g.newFn(d, d, g.scope(d))
+	f.usesSelf = true
+	f.line("memset(self, 0, sizeof *self);")
+	if b := g.base(d); b != nil {
+		f.line("%s(&self->base);", g.initName(b))
+	}
+	for _, b := range d.VarBlocks {
+		switch b.Kind {
+		case "VAR_TEMP", "VAR_EXTERNAL", "VAR_IN_OUT":
+			continue
+		}
+		for _, v := range b.Vars {
+			t := f.scope.ResolveType(v.Type)
+			if g.checkType(t) != "" || t.Class == st.PointerClass && t.Ref {
+				continue
+			}
+			for _, id := range v.Names {
+				lv := "self->" + cname(id.Name)
+				f.defaults(lv, t)
+				if v.Init != nil {
+					f.initValue(lv, t, v.Init)
+				}
+			}
+		}
+	}
+	if n := g.class[d]; n != 0 {
+		f.line("self->%sclass__ = %d; /* %s */", g.basePath(d, g.root(d)), n, d.Name.Name)
+	}
+	name := g.pouName(d)
+	return f.finish("void " + g.initName(d) + "(" + name + " *self)")
+}
+
+// fbStep writes the body of a function block or program. VAR_TEMP are
+// locals of the step function, initialised on every call.
+func (g *generator) fbStep(d *st.POU) string {
+	f := g.newFn(d, d, g.scope(d))
+	var chain []*st.POU
+	for x := d; x != nil && len(chain) < 16; x = g.base(x) {
+		chain = append([]*st.POU{x}, chain...)
+	}
+	for _, x := range chain {
+		for _, b := range x.VarBlocks {
+			if b.Kind != "VAR_TEMP" {
+				continue
+			}
+			for _, v := range b.Vars {
+				t := g.scope(x).ResolveType(v.Type)
+				if msg := g.checkType(t); msg != "" {
+					g.errorf(g.fileName(x), v, "%s: %s", v.Names[0].Name, msg)
+					continue
+				}
+				for _, id := range v.Names {
+					c := cname(id.Name)
+					f.decls = append(f.decls, g.decl(t, c)+" = "+zeroInit(t))
+					f.locals[strings.ToUpper(id.Name)] = c
+					f.defaults(c, t)
+					if v.Init != nil {
+						f.initValue(c, t, v.Init)
+					}
+				}
+			}
+		}
+	}
+	f.stmts(d.Body)
+	return f.finish("void " + g.stepName(d) + "(" + g.pouName(d) + " *self)")
+}
+
+// structInit writes the init function of a structure type.
+func (g *generator) structInit(td *st.TypeDecl, t *st.Type) string {
+	f := g.newFn(nil, nil, g.p.GlobalScope())
+	f.file = g.fileName(td)
+	name := cname(td.Name.Name)
+	f.line("memset(self, 0, sizeof *self);")
+	if t.Base != nil {
+		f.line("%s__init(&self->base);", g.typeName(t.Base))
+	}
+	for _, fld := range t.Fields {
+		if g.checkType(fld.Type) != "" {
+			continue
+		}
+		lv := "self->" + cname(fld.Name)
+		f.defaults(lv, fld.Type)
+		if fld.Decl != nil && fld.Decl.Init != nil {
+			f.initValue(lv, fld.Type, fld.Decl.Init)
+		}
+	}
+	if td.Init != nil {
+		f.initValue("(*self)", t, td.Init)
+	}
+	return f.finish("void " + name + "__init(" + name + " *self)")
+}
+
+// ── Initial values ────────────────────────────────────────────────────────────
+
+// zeroInit is the initialiser of a local declaration.
+func zeroInit(t *st.Type) string {
+	switch t.Class {
+	case st.ArrayClass, st.StructClass, st.InstanceClass, st.StringClass:
+		return "{0}"
+	case st.PointerClass:
+		return "NULL"
+	case st.BoolClass:
+		return "false"
+	}
+	return "0"
+}
+
+// zero clears the variable lv.
+func (f *fn) zero(lv string, t *st.Type) {
+	switch t.Class {
+	case st.ArrayClass, st.StructClass, st.InstanceClass, st.StringClass:
+		f.line("memset(%s, 0, sizeof %s);", addr(lv), paren(lv))
+	default:
+		f.line("%s = %s;", lv, zeroInit(t))
+	}
+}
+
+// reset sets the variable lv to the initial value init, or that of its
+// type if init is nil.
+func (f *fn) reset(lv string, t *st.Type, init st.Expr) {
+	switch init.(type) {
+	case nil, *st.ArrayInit, *st.StructInit:
+		f.zero(lv, t)
+		f.defaults(lv, t)
+	default:
+		if isComposite(t) || t.Class == st.StringClass {
+			f.zero(lv, t)
+			f.defaults(lv, t)
+		}
+	}
+	if init != nil {
+		f.initValue(lv, t, init)
+	}
+}
+
+// defaults gives the zeroed variable lv the initial value of its type:
+// the initial values of structure members and function block variables,
+// the first value of an enumeration and the initial value of a named type.
+func (f *fn) defaults(lv string, t *st.Type) {
+	switch t.Class {
+	case st.InstanceClass:
+		if !st.IsStandard(t.POU) {
+			f.line("%s(%s);", f.g.initName(t.POU), addr(lv))
+		}
+		return
+	case st.StructClass:
+		f.line("%s__init(%s);", f.g.typeName(t), addr(lv))
+		return
+	case st.ArrayClass:
+		if f.g.needsInit(t.Elem) {
+			el := paren(lv)
+			for _, d := range t.Dims {
+				i := f.temp("size_t %s")
+				f.line("for (%s = 0; %s < %d; %s++) {", i, i, d.Len(), i)
+				f.depth++
+				el += "[" + i + "]"
+			}
+			f.defaults(el, t.Elem)
+			for range t.Dims {
+				f.depth--
+				f.line("}")
+			}
+		}
+	case st.EnumClass:
+		if len(t.Members) > 0 && t.Members[0].Value != 0 && t.Decl != nil {
+			f.line("%s = %s__%s;", lv, cname(t.Decl.Name.Name), t.Members[0].Name)
+		}
+	}
+	if t.Decl != nil && t.Decl.Init != nil {
+		f.inGlobalScope(func() { f.initValue(lv, t, t.Decl.Init) })
+	}
+}
+
+// initValue assigns an initial value: an expression, [1, 2, 3(0)] for
+// arrays or (a := 1, b := 2) for structures and instances.
+func (f *fn) initValue(lv string, t *st.Type, e st.Expr) {
+	switch e := e.(type) {
+	case *st.ArrayInit:
+		if t.Class != st.ArrayClass {
+			f.errorf(e, "array initial value for %s", t.Name)
+			return
+		}
+		total := int64(1)
+		for _, d := range t.Dims {
+			total *= d.Len()
+		}
+		elem := func(i string) string {
+			if len(t.Dims) == 1 {
+				return paren(lv) + "[" + i + "]"
+			}
+			return "((" + f.g.decl(t.Elem, "*") + ")" + lv + ")[" + i + "]"
+		}
+		i := int64(0)
+		for _, el := range e.Elems {
+			n := int64(1)
+			if el.Count != nil {
+				k, ok := f.scope.ConstInt(el.Count)
+				if !ok {
+					f.errorf(el.Count, "repeat count %s is not a constant", st.ExprString(el.Count))
+					return
+				}
+				n = k
+			}
+			n = min(n, total-i)
+			if n <= 0 {
+				continue
+			}
+			if n > 3 {
+				j := f.temp("size_t %s")
+				f.line("for (%s = %d; %s < %d; %s++) {", j, i, j, i+n, j)
+				f.depth++
+				f.initValue(elem(j), t.Elem, el.Value)
+				f.depth--
+				f.line("}")
+			} else {
+				for j := i; j < i+n; j++ {
+					f.initValue(elem(strconv.FormatInt(j, 10)), t.Elem, el.Value)
+				}
+			}
+			i += n
+		}
+	case *st.StructInit:
+		if t.Class != st.StructClass && t.Class != st.InstanceClass {
+			f.errorf(e, "structure initial value for %s", t.Name)
+			return
+		}
+		for _, fi := range e.Fields {
+			if fld := t.Field(fi.Name.Name); fld != nil && fld.Block == "VAR_IN_OUT" {
+				f.errorf(fi.Name, "VAR_IN_OUT %s cannot have an initial value", fi.Name.Name)
+				continue
+			}
+			x := f.field(val{c: lv, t: t, lv: true}, fi.Name)
+			if x.t != st.TypeBad {
+				f.initValue(x.c, x.t, fi.Value)
+			}
+		}
+	default:
+		f.store(val{c: lv, t: t, lv: true}, f.expr(e))
+	}
+}
+
+// ── Statements ────────────────────────────────────────────────────────────────
+
+func (f *fn) stmts(list []st.Stmt) {
+	for _, s := range list {
+		f.stmt(s)
+	}
+}
+
+func (f *fn) block(list []st.Stmt) {
+	f.depth++
+	f.stmts(list)
+	f.depth--
+}
+
+// cond writes a condition without redundant parentheses.
+func (f *fn) cond(e st.Expr) string {
+	c := f.truth(f.expr(e))
+	if strings.HasPrefix(c, "(") && enclosed(c) {
+		return c[1 : len(c)-1]
+	}
+	return c
+}
+
+func (f *fn) stmt(s st.Stmt) {
+	f.at = s
+	switch s := s.(type) {
+	case *st.AssignStmt:
+		f.assign(s.Target, f.expr(s.Value))
+	case *st.CallStmt:
+		v, post := f.call(s.Call, true)
+		if v.c != "" {
+			f.line("%s;", v.c)
+		}
+		for _, p := range post {
+			p()
+		}
+	case *st.IfStmt:
+		f.line("if (%s) {", f.cond(s.Cond))
+		f.block(s.Then)
+		for _, ei := range s.Elsifs {
+			f.at = ei.Cond
+			f.line("} else if (%s) {", f.cond(ei.Cond))
+			f.block(ei.Body)
+		}
+		if len(s.Else) > 0 {
+			f.line("} else {")
+			f.block(s.Else)
+		}
+		f.line("}")
+	case *st.CaseStmt:
+		f.caseStmt(s)
+	case *st.ForStmt:
+		f.forStmt(s)
+	case *st.WhileStmt:
+		f.line("while (%s) {", f.cond(s.Cond))
+		f.block(s.Body)
+		f.line("}")
+	case *st.RepeatStmt:
+		f.line("do {")
+		f.block(s.Body)
+		f.line("} while (!%s);", paren(f.truth(f.expr(s.Cond))))
+	case *st.ExitStmt:
+		f.line("break;")
+	case *st.ContinueStmt:
+		f.line("continue;")
+	case *st.ReturnStmt:
+		f.line("%s", f.ret)
+	case *st.EmptyStmt:
+	default:
+		f.errorf(s, "statement not supported")
+	}
+}
+
+// assign stores v in the variable target, which may be a bit (x.3).
+func (f *fn) assign(target st.Expr, v val) {
+	if me, ok := target.(*st.MemberExpr); ok && isBitNumber(me.Name.Name) {
+		x := f.expr(me.X)
+		n, _ := strconv.Atoi(me.Name.Name)
+		bits, _ := intInfo(x.t)
+		if !x.lv || !x.t.IsInteger() || n >= bits {
+			f.errorf(me.Name, "bit %d of %s is not a variable", n, st.ExprString(me.X))
+			return
+		}
+		f.line("%s = %s(iec_setbit(%s, %d, %s));", x.c, wrapFunc(x.t), f.u64(x), n, f.truth(v))
+		return
+	}
+	lv := f.expr(target)
+	if !lv.lv {
+		if lv.t != st.TypeBad {
+			f.errorf(target, "cannot assign to %s", st.ExprString(target))
+		}
+		return
+	}
+	f.store(lv, v)
+}
+
+// store copies v into the variable lv, converting it to lv's type.
+func (f *fn) store(lv, v val) {
+	switch lv.t.Class {
+	case st.StringClass:
+		f.line("iec_strset(%s, %d, %s);", lv.c, lv.t.Len, f.str(v))
+	case st.ArrayClass:
+		if !st.Identical(lv.t, v.t) {
+			f.errorf(nil, "cannot assign %s to %s", v.t.Name, lv.t.Name)
+			return
+		}
+		f.line("memcpy(%s, %s, sizeof %s);", lv.c, v.c, paren(lv.c))
+	default:
+		if v.t == st.TypeBad {
+			return
+		}
+		f.line("%s = %s;", lv.c, f.conv(v, lv.t))
+	}
+}
+
+// containsExit reports whether list has an EXIT outside nested loops.
+func containsExit(list []st.Stmt) bool {
+	found := false
+	for _, s := range list {
+		st.Inspect(s, func(n st.Node) bool {
+			switch n.(type) {
+			case *st.ExitStmt:
+				found = true
+			case *st.ForStmt, *st.WhileStmt, *st.RepeatStmt:
+				return false
+			}
+			return !found
+		})
+	}
+	return found
+}
+
+// caseStmt writes a CASE as a switch when its labels are distinct
+// constants, else as an if chain.
+func (f *fn) caseStmt(s *st.CaseStmt) {
+	x := f.expr(s.Selector)
+	sel := f.toInt(x)
+	useSwitch := !containsExit(s.Else)
+	seen := map[int64]bool{}
+	for _, cl := range s.Cases {
+		if containsExit(cl.Body) {
+			useSwitch = false
+		}
+		for _, l := range cl.Labels {
+			k, ok := f.scope.ConstInt(l)
+			if _, isRange := l.(*st.RangeExpr); isRange || !ok || seen[k] {
+				useSwitch = false
+			}
+			seen[k] = true
+		}
+	}
+	if useSwitch {
+		f.line("switch (%s) {", sel)
+		for _, cl := range s.Cases {
+			for _, l := range cl.Labels {
+				v := f.expr(l)
+				if v.t.Class == st.EnumClass {
+					f.line("case %s:", v.c)
+				} else {
+					f.line("case %s:", f.toInt(v))
+				}
+			}
+			f.block(cl.Body)
+			f.depth++
+			f.line("break;")
+			f.depth--
+		}
+		if len(s.Else) > 0 {
+			f.line("default:")
+			f.block(s.Else)
+			f.depth++
+			f.line("break;")
+			f.depth--
+		}
+		f.line("}")
+		return
+	}
+	if !simpleRe.MatchString(sel) {
+		tmp := f.temp("int64_t %s")
+		f.line("%s = %s;", tmp, sel)
+		sel = tmp
+	}
+	for i, cl := range s.Cases {
+		var conds []string
+		for _, l := range cl.Labels {
+			r, isRange := l.(*st.RangeExpr)
+			if !isRange {
+				if v := f.expr(l); v.konst {
+					conds = append(conds, compareConst(sel, x.t, "==", f.constInt(v)))
+				} else {
+					conds = append(conds, sel+" == "+f.toInt(v))
+				}
+				continue
+			}
+			lo, hi := f.expr(r.Lo), f.expr(r.Hi)
+			if !lo.konst || !hi.konst {
+				conds = append(conds, fmt.Sprintf("(%s >= %s && %s <= %s)", sel, f.toInt(lo), sel, f.toInt(hi)))
+				continue
+			}
+			a, b := compareConst(sel, x.t, ">=", f.constInt(lo)), compareConst(sel, x.t, "<=", f.constInt(hi))
+			switch {
+			case a == "false" || b == "false":
+				conds = append(conds, "false")
+			case a == "true":
+				conds = append(conds, b)
+			case b == "true":
+				conds = append(conds, a)
+			default:
+				conds = append(conds, "("+a+" && "+b+")")
+			}
+		}
+		kw := "if"
+		if i > 0 {
+			kw = "} else if"
+		}
+		f.line("%s (%s) {", kw, strings.Join(conds, " || "))
+		f.block(cl.Body)
+	}
+	if len(s.Else) > 0 {
+		if len(s.Cases) == 0 {
+			f.line("{")
+		} else {
+			f.line("} else {")
+		}
+		f.block(s.Else)
+	}
+	if len(s.Cases) > 0 || len(s.Else) > 0 {
+		f.line("}")
+	}
+}
+
+// forStmt writes a FOR loop. The bounds and step are evaluated once; the
+// counter wraps like any other variable.
+func (f *fn) forStmt(s *st.ForStmt) {
+	v := f.expr(s.Var)
+	if !v.lv || !isInt(v.t) {
+		f.errorf(s.Var, "FOR variable %s must be an integer variable", s.Var.Name)
+		return
+	}
+	from := f.conv(f.expr(s.From), v.t)
+	bound := func(e st.Expr) (string, int64, bool) {
+		x := f.expr(e)
+		if x.konst {
+			return f.toInt(x), f.constInt(x), true
+		}
+		tmp := f.temp("int64_t %s")
+		f.line("%s = %s;", tmp, f.toInt(x))
+		return tmp, 0, false
+	}
+	to, toK, toKnown := bound(s.To)
+	by, step, known := "1", int64(1), true
+	if s.By != nil {
+		by, step, known = bound(s.By)
+		if known && step == 0 {
+			f.errorf(s.By, "FOR step is zero")
+			return
+		}
+		if !known {
+			f.line("if (%s == 0)", by)
+			f.line("    iec_trap(\"FOR step is zero\");")
+		}
+	}
+	i := v.c
+	if unsigned64(v.t) {
+		i = "(int64_t)" + v.c
+	}
+	reached := func(op string) string {
+		if toKnown {
+			return compareConst(i, v.t, op, toK)
+		}
+		return i + " " + op + " " + to
+	}
+	var cond string
+	switch {
+	case !known:
+		cond = fmt.Sprintf("%s > 0 ? %s : %s", by, reached("<="), reached(">="))
+	case step > 0:
+		cond = reached("<=")
+	default:
+		cond = reached(">=")
+	}
+	next := fmt.Sprintf("%s = %s((uint64_t)%s + (uint64_t)%s)", v.c, wrapFunc(v.t), v.c, by)
+	f.line("for (%s = %s; %s; %s) {", v.c, from, cond, next)
+	f.block(s.Body)
+	f.line("}")
+}
+
+// ── Calls ─────────────────────────────────────────────────────────────────────
+
+// isSuper reports whether e is SUPER^.
+func isSuper(e st.Expr) bool {
+	d, ok := e.(*st.DerefExpr)
+	if !ok {
+		return false
+	}
+	id, ok := d.X.(*st.Ident)
+	return ok && strings.EqualFold(id.Name, "SUPER")
+}
+
+// call translates a call of a function, method, function block instance
+// or program. post stores the outputs given with => that cannot be passed
+// by pointer; stmt is false in expressions, which allow no statements.
+func (f *fn) call(e *st.CallExpr, stmt bool) (v val, post []func()) {
+	switch fn := e.Func.(type) {
+	case *st.Ident:
+		sym := f.scope.Lookup(fn.Name)
+		if sym == nil {
+			return f.stdCall(e, fn.Name), nil
+		}
+		switch sym.Kind {
+		case st.POUSymbol:
+			d := sym.POU
+			switch d.Kind {
+			case st.Function:
+				return f.invoke(e, d, f.g.pouName(d), "")
+			case st.Method:
+				if f.fb == nil {
+					f.errorf(fn, "method %s called outside its function block", fn.Name)
+					return bad, nil
+				}
+				f.usesSelf = true
+				return f.method(e, val{c: "(*self)", t: f.g.p.InstanceType(f.fb), lv: true}, fn.Name, true)
+			case st.Program:
+				return f.instanceCall(e, val{c: cname(d.Name.Name), t: f.g.p.InstanceType(d), lv: true}, stmt)
+			}
+			f.errorf(fn, "%s is a function block type; call an instance of it", fn.Name)
+			return bad, nil
+		case st.TypeSymbol:
+			f.errorf(fn, "%s is a type, not a function", fn.Name)
+			return bad, nil
+		}
+	case *st.MemberExpr:
+		if sym := f.scope.Resolve(fn); sym != nil && sym.Kind == st.POUSymbol && sym.POU.Kind == st.Method {
+			return f.method(e, f.expr(fn.X), fn.Name.Name, !isSuper(fn.X))
+		}
+	case *st.DerefExpr:
+		if isSuper(fn) {
+			if f.fb == nil || f.g.base(f.fb) == nil {
+				f.errorf(fn, "SUPER^() outside a derived function block")
+				return bad, nil
+			}
+			f.usesSelf = true
+			b := f.g.base(f.fb)
+			return f.instanceCall(e, val{c: "self->base", t: f.g.p.InstanceType(b), lv: true}, stmt)
+		}
+	}
+	recv := f.expr(e.Func)
+	if recv.t.Class != st.InstanceClass {
+		if recv.t != st.TypeBad {
+			f.errorf(e.Func, "%s is not a function block instance", st.ExprString(e.Func))
+		}
+		return bad, nil
+	}
+	return f.instanceCall(e, recv, stmt)
+}
+
+// descendants returns the function blocks deriving from d, directly or
+// not.
+func (g *generator) descendants(d *st.POU) []*st.POU {
+	var out []*st.POU
+	for _, x := range g.derived[d] {
+		out = append(out, x)
+		out = append(out, g.descendants(x)...)
+	}
+	return out
+}
+
+// overridden reports whether a function block deriving from d overrides
+// its method name.
+func (g *generator) overridden(d *st.POU, name string) bool {
+	m := g.p.InstanceType(d).Method(name)
+	for _, x := range g.descendants(d) {
+		if mx := g.p.InstanceType(x).Method(name); mx != nil && mx != m {
+			return true
+		}
+	}
+	return false
+}
+
+// method translates a method call on recv; dynamic calls of overridden
+// methods go through a dispatch function.
+func (f *fn) method(e *st.CallExpr, recv val, name string, dynamic bool) (val, []func()) {
+	if recv.t.Class != st.InstanceClass {
+		if recv.t != st.TypeBad {
+			f.errorf(e.Func, "%s is not a function block instance", st.ExprString(e.Func))
+		}
+		return bad, nil
+	}
+	d := recv.t.POU
+	m := recv.t.Method(name)
+	if m == nil {
+		f.errorf(e.Func, "%s has no method %s", recv.t.Name, name)
+		return bad, nil
+	}
+	if dynamic && f.g.overridden(d, name) {
+		vname := f.g.pouName(d) + "__" + m.Name.Name + "__virtual"
+		f.g.virtuals[vname] = virtual{fb: d, method: name}
+		return f.invoke(e, m, vname, addr(recv.c))
+	}
+	self := addr(recv.c)
+	if owner := f.g.p.Owner(m); owner != d {
+		self = addr(f.memberOf(recv.c, strings.TrimSuffix(f.g.basePath(d, owner), ".")))
+	}
+	return f.invoke(e, m, f.g.pouName(m), self)
+}
+
+// invoke translates a call of a function or method d named name, with
+// self the receiver of methods.
+func (f *fn) invoke(e *st.CallExpr, d *st.POU, name, self string) (val, []func()) {
+	params := f.g.params(d)
+	var inputs []int
+	for i, p := range params {
+		if p.block != "VAR_OUTPUT" {
+			inputs = append(inputs, i)
+		}
+	}
+	bound := map[int]*st.Arg{}
+	positional := 0
+	for _, a := range e.Args {
+		i := -1
+		if a.Name == nil {
+			if positional >= len(inputs) {
+				f.errorf(a.Value, "too many arguments in call of %s", d.Name.Name)
+				return bad, nil
+			}
+			i = inputs[positional]
+			positional++
+		} else {
+			for j, p := range params {
+				if strings.EqualFold(p.name, a.Name.Name) {
+					i = j
+				}
+			}
+			if i < 0 {
+				f.errorf(a.Name, "%s has no parameter %s", d.Name.Name, a.Name.Name)
+				return bad, nil
+			}
+		}
+		if a.Output != (params[i].block == "VAR_OUTPUT") {
+			f.errorf(e, "%s is not an %s of %s", params[i].name, map[bool]string{true: "output", false: "input"}[a.Output], d.Name.Name)
+			return bad, nil
+		}
+		bound[i] = a
+	}
+
+	var args []string
+	var post []func()
+	rt := f.g.resultType(d)
+	if rt != nil && rt.Class == st.StringClass {
+		args = append(args, f.temp(fmt.Sprintf("char %%s[%d]", rt.Len+1)))
+	}
+	if self != "" {
+		args = append(args, self)
+	}
+	for i, p := range params {
+		a := bound[i]
+		switch p.block {
+		case "VAR_INPUT":
+			if a == nil {
+				args = append(args, f.defaultArg(e, d, p))
+				continue
+			}
+			args = append(args, f.inputArg(p, f.expr(a.Value)))
+		case "VAR_IN_OUT":
+			if a == nil {
+				f.errorf(e, "VAR_IN_OUT %s of %s is not bound", p.name, d.Name.Name)
+				args = append(args, "NULL")
+				continue
+			}
+			args = append(args, f.inOutArg(a.Value, p.t))
+		case "VAR_OUTPUT":
+			if a == nil || a.Value == nil {
+				args = append(args, "&("+f.g.decl(p.t, "")+"){0}")
+				continue
+			}
+			me, isBit := a.Value.(*st.MemberExpr)
+			isBit = isBit && isBitNumber(me.Name.Name)
+			if !isBit && !a.Not {
+				if target := f.expr(a.Value); target.lv && st.Identical(target.t, p.t) {
+					args = append(args, addr(target.c))
+					continue
+				} else if target.t == st.TypeBad {
+					continue
+				}
+			}
+			tmp := f.temp(f.g.decl(p.t, "%s"))
+			args = append(args, "&"+tmp)
+			out, target, not := val{c: tmp, t: p.t}, a.Value, a.Not
+			post = append(post, func() {
+				if not {
+					out = val{c: "!" + paren(f.truth(out)), t: st.TypeBool}
+				}
+				f.assign(target, out)
+			})
+		}
+	}
+	t := rt
+	if t == nil {
+		t = st.TypeVoid
+	}
+	return val{c: name + "(" + strings.Join(args, ", ") + ")", t: t}, post
+}
+
+// inputArg converts an argument for the VAR_INPUT p.
+func (f *fn) inputArg(p param, v val) string {
+	switch p.t.Class {
+	case st.StringClass:
+		return f.str(v)
+	case st.ArrayClass:
+		if !st.Identical(p.t, v.t) {
+			f.errorf(nil, "cannot pass %s as %s", v.t.Name, p.t.Name)
+		}
+		return v.c
+	}
+	return f.conv(v, p.t)
+}
+
+// inOutArg passes the variable x to a VAR_IN_OUT of type t.
+func (f *fn) inOutArg(x st.Expr, t *st.Type) string {
+	v := f.expr(x)
+	switch {
+	case v.t == st.TypeBad:
+		return "NULL"
+	case !v.lv:
+		f.errorf(x, "%s is not a variable", st.ExprString(x))
+		return "NULL"
+	case st.Identical(v.t, t):
+		return addr(v.c)
+	case v.t.Class == t.Class && (t.Class == st.InstanceClass || t.Class == st.StructClass):
+		if c := f.conv(v, t); c != v.c {
+			return addr(c)
+		}
+	}
+	f.errorf(x, "VAR_IN_OUT of type %s needs a variable of that type, not %s", t.Name, v.t.Name)
+	return "NULL"
+}
+
+// defaultArg is the value of an input without an argument: its initial
+// value, translated in the callee's scope, or that of its type.
+func (f *fn) defaultArg(e *st.CallExpr, d *st.POU, p param) string {
+	if p.decl.Init != nil {
+		switch p.decl.Init.(type) {
+		case *st.ArrayInit, *st.StructInit:
+			f.errorf(e, "pass %s to %s; structured default values of inputs are not supported", p.name, d.Name.Name)
+			return "0"
+		}
+		scope, locals, fb := f.scope, f.locals, f.fb
+		f.scope, f.locals, f.fb = f.g.scope(d), map[string]string{}, nil
+		v := f.expr(p.decl.Init)
+		f.scope, f.locals, f.fb = scope, locals, fb
+		return f.inputArg(p, v)
+	}
+	t := p.t
+	switch {
+	case t.Decl != nil && t.Decl.Init != nil:
+		f.errorf(e, "pass %s to %s; default values of type %s are not supported", p.name, d.Name.Name, t.Name)
+	case t.Class == st.StringClass:
+		return `""`
+	case t.Class == st.EnumClass && len(t.Members) > 0 && t.Decl != nil:
+		return cname(t.Decl.Name.Name) + "__" + t.Members[0].Name
+	case isComposite(t):
+		if f.g.needsInit(t) {
+			f.errorf(e, "pass %s to %s; default values of %s are not supported", p.name, d.Name.Name, t.Name)
+		}
+		return "(" + f.g.decl(t, "") + "){0}"
+	}
+	return zeroInit(t)
+}
+
+// instanceCall translates a call of a function block instance or program:
+// the inputs are stored in the instance, the body runs and the outputs
+// given with => are copied out.
+func (f *fn) instanceCall(e *st.CallExpr, recv val, stmt bool) (val, []func()) {
+	d := recv.t.POU
+	if !stmt {
+		f.errorf(e, "call of %s has no result", st.ExprString(e.Func))
+		return bad, nil
+	}
+	var inputs []*st.Field
+	var chain []*st.Type
+	for t := recv.t; t != nil && len(chain) < 16; t = t.Base {
+		chain = append([]*st.Type{t}, chain...)
+	}
+	for _, t := range chain {
+		for _, fld := range t.Fields {
+			if fld.Block == "VAR_INPUT" || fld.Block == "VAR_IN_OUT" {
+				inputs = append(inputs, fld)
+			}
+		}
+	}
+	var post []func()
+	positional := 0
+	for _, a := range e.Args {
+		var fld *st.Field
+		if a.Name == nil {
+			if positional >= len(inputs) {
+				f.errorf(a.Value, "too many arguments in call of %s", d.Name.Name)
+				return bad, nil
+			}
+			fld = inputs[positional]
+			positional++
+		} else if fld = recv.t.Field(a.Name.Name); fld == nil {
+			f.errorf(a.Name, "%s has no parameter %s", d.Name.Name, a.Name.Name)
+			return bad, nil
+		}
+		id := &st.Ident{Name: fld.Name, NamePos: e.Pos()}
+		if a.Name != nil {
+			id.NamePos = a.Name.NamePos
+		}
+		switch {
+		case a.Output:
+			if a.Value == nil {
+				continue
+			}
+			out, target, not := f.field(recv, id), a.Value, a.Not
+			post = append(post, func() {
+				if not {
+					out = val{c: "!" + paren(f.truth(out)), t: st.TypeBool}
+				}
+				f.assign(target, out)
+			})
+		case fld.Block == "VAR_IN_OUT":
+			// bind the pointer, not the variable it points to
+			ptr := f.field(recv, id)
+			f.line("%s = %s;", strings.TrimSuffix(strings.TrimPrefix(ptr.c, "IEC_DEREF("), ")"), f.inOutArg(a.Value, fld.Type))
+		default:
+			if a.Value == nil {
+				f.errorf(a.Name, "%s has no value", a.Name.Name)
+				continue
+			}
+			f.store(f.field(recv, id), f.expr(a.Value))
+		}
+	}
+	return val{c: f.g.stepName(d) + "(" + addr(recv.c) + ")", t: st.TypeVoid}, post
+}
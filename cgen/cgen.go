@@ -0,0 +1,953 @@
+// Package cgen translates a Structured Text project into portable C99, so
+// PLC logic can be compiled with gcc or clang, fuzzed with libFuzzer and
+// linked into a desktop simulation.
+//
+// The generated code keeps the semantics of the PLC, as the interpreter in
+// package interp implements them: every integer operation wraps to its
+// result type (INT 32767 + 1 is -32768), REAL arithmetic rounds to single
+// precision, REAL_TO_INT rounds half away from zero and saturates, TIME
+// keeps millisecond resolution and STRINGs truncate to their length.
+// Run-time errors — division by zero, an array index out of range, a null
+// pointer — call iec_trap.
+//
+// For a project named plc, Generate returns three files:
+//
+//	iec_rt.h  runtime: elementary types, helpers, standard function blocks
+//	plc.h     types, prototypes, global variables and program instances
+//	plc.c     the translated POUs and plc_init
+//
+// The POUs map to C as follows:
+//
+//	FUNCTION F : T              T F(inputs, in_outs *, outputs *)
+//	FUNCTION_BLOCK FB           struct FB; FB__init(FB *), FB__step(FB *)
+//	METHOD M of FB : T          T FB__M(FB *self, inputs, in_outs *, outputs *)
+//	PROGRAM P                   struct P__type; global instance P, P__step(&P)
+//	STRUCT, enumeration, alias  typedef
+//	VAR_GLOBAL                  global variable
+//
+// plc_init() sets every global variable and program instance to its initial
+// value; call it once before the first cycle, and again to reset. The host
+// advances iec_now, the clock of the timers, and calls the program steps or
+// the generated plc_cycle and task functions.
+package cgen
+
+import (
+	_ "embed"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/damischa1/iec-st-tools/st"
+)
+
+//go:embed iec_rt.h
+var runtimeHeader []byte
+
+// RuntimeHeader is the file name of the runtime header.
+const RuntimeHeader = "iec_rt.h"
+
+// Options configure Generate.
+type Options struct {
+	// Name is the base name of the generated files and the prefix of the
+	// init and cycle functions: plc.h, plc.c, plc_init(). Default "plc".
+	Name string
+}
+
+// File is a generated file.
+type File struct {
+	Name string
+	Data []byte
+}
+
+// Error is a construct the C backend does not translate.
+type Error struct {
+	File string
+	Pos  st.Pos
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	if !e.Pos.IsValid() {
+		return e.Msg
+	}
+	return fmt.Sprintf("%s:%d:%d: %s", e.File, e.Pos.Line, e.Pos.Col, e.Msg)
+}
+
+// ErrorList is the list of errors Generate returns, one per line.
+type ErrorList []*Error
+
+func (el ErrorList) Error() string {
+	msgs := make([]string, len(el))
+	for i, e := range el {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+var identRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Generate translates p to C. Test files (see st.Project.IsTestFile) are
+// left out. The project should be free of type errors (see
+// st.Project.Check); when it uses constructs the backend does not support,
+// Generate returns an ErrorList and no files.
+func Generate(p *st.Project, opts Options) ([]File, error) {
+	if opts.Name == "" {
+		opts.Name = "plc"
+	}
+	if !identRe.MatchString(opts.Name) {
+		return nil, fmt.Errorf("name %q is not a C identifier", opts.Name)
+	}
+	g := &generator{
+		p:         p,
+		name:      opts.Name,
+		scopes:    map[*st.POU]*st.Scope{},
+		derived:   map[*st.POU][]*st.POU{},
+		class:     map[*st.POU]int{},
+		virtuals:  map[string]virtual{},
+		statics:   map[*st.Ident]string{},
+		globalFor: map[string]string{},
+	}
+	g.collect()
+	src := g.source()
+	hdr := g.header()
+	if len(g.errs) > 0 {
+		sort.SliceStable(g.errs, func(i, j int) bool {
+			a, b := g.errs[i], g.errs[j]
+			if a.File != b.File {
+				return a.File < b.File
+			}
+			return a.Pos.Offset < b.Pos.Offset
+		})
+		// a type or initial value translated in several places reports
+		// its error each time
+		var errs ErrorList
+		seen := map[string]bool{}
+		for _, e := range g.errs {
+			if !seen[e.Error()] {
+				seen[e.Error()] = true
+				errs = append(errs, e)
+			}
+		}
+		return nil, errs
+	}
+	return []File{
+		{RuntimeHeader, runtimeHeader},
+		{opts.Name + ".h", []byte(hdr)},
+		{opts.Name + ".c", []byte(src)},
+	}, nil
+}
+
+// ── Generator ─────────────────────────────────────────────────────────────────
+
+type generator struct {
+	p    *st.Project
+	name string
+	errs ErrorList
+
+	pous     []*st.POU      // functions, function blocks and programs, by name
+	types    []*st.TypeDecl // data types, by name
+	globals  []*st.Symbol   // global variables, in declaration order
+	programs []progInst     // program instances
+	tasks    []task         // configured tasks
+
+	scopes      map[*st.POU]*st.Scope
+	derived     map[*st.POU][]*st.POU // function blocks extending a function block
+	class       map[*st.POU]int       // class number of function blocks in a hierarchy
+	virtuals    map[string]virtual    // dispatch functions in use, by C name
+	statics     map[*st.Ident]string  // C names of VAR_STAT variables
+	staticDef   []string              // their definitions
+	staticReset []string              // flags plc_init clears so statics start over
+	globalFor   map[string]string     // C name of each global by upper-case name
+}
+
+// progInst is an instance of a PROGRAM: the one named after its type, or
+// further instances of a CONFIGURATION.
+type progInst struct {
+	name   string
+	pou    *st.POU
+	config string // instance name in the CONFIGURATION
+}
+
+// task is a TASK of a RESOURCE with the program instances it runs.
+type task struct {
+	name     string
+	params   string // INTERVAL and PRIORITY as written
+	programs []progInst
+}
+
+// virtual is a dispatch function for a method that derived function blocks
+// override.
+type virtual struct {
+	fb     *st.POU // static type of the receiver
+	method string
+}
+
+func (g *generator) errorf(file string, n st.Node, format string, args ...any) {
+	var pos st.Pos
+	if n != nil {
+		pos = n.Pos()
+	}
+	g.errs = append(g.errs, &Error{File: file, Pos: pos, Msg: fmt.Sprintf(format, args...)})
+}
+
+func (g *generator) fileName(n st.Node) string {
+	if f := g.p.FileOf(n); f != nil {
+		return f.Name
+	}
+	return ""
+}
+
+func (g *generator) isTest(n st.Node) bool {
+	f := g.p.FileOf(n)
+	return f != nil && g.p.IsTestFile(f)
+}
+
+func (g *generator) scope(d *st.POU) *st.Scope {
+	s := g.scopes[d]
+	if s == nil {
+		s = g.p.Scope(d)
+		g.scopes[d] = s
+	}
+	return s
+}
+
+// collect gathers what to translate and numbers the function blocks of
+// inheritance hierarchies.
+func (g *generator) collect() {
+	for _, d := range g.p.POUs() {
+		if g.isTest(d) {
+			continue
+		}
+		switch d.Kind {
+		case st.Function, st.FunctionBlock, st.Program:
+			g.pous = append(g.pous, d)
+		}
+	}
+	for _, td := range g.p.TypeDecls() {
+		if !g.isTest(td) {
+			g.types = append(g.types, td)
+		}
+	}
+	for _, sym := range g.p.Globals() {
+		if sym.File != nil && g.p.IsTestFile(sym.File) {
+			continue
+		}
+		if sym.Type == nil {
+			// types of globals are resolved on first lookup
+			if r := g.p.GlobalScope().Lookup(sym.Name); r != sym || sym.Type == nil {
+				sym.Type = st.TypeBad
+			}
+		}
+		g.globals = append(g.globals, sym)
+		g.globalFor[strings.ToUpper(sym.Name)] = cname(sym.Name)
+	}
+	for _, sym := range g.p.Duplicates() {
+		if sym.Kind == st.GlobalSymbol {
+			g.errorf(fileOf(sym), sym.Ident, "global variable %s is declared twice; C has one namespace for globals", sym.Name)
+		}
+	}
+
+	for _, d := range g.pous {
+		if d.Kind != st.FunctionBlock || d.Extends == nil {
+			continue
+		}
+		base := g.p.POU(d.Extends.Name)
+		switch {
+		case base == nil || base.Kind != st.FunctionBlock:
+			g.errorf(g.fileName(d), d.Extends, "%s extends %s, which is not a function block", d.Name.Name, d.Extends.Name)
+		case st.IsStandard(base):
+			g.errorf(g.fileName(d), d.Extends, "extending the standard function block %s is not supported", base.Name.Name)
+		default:
+			g.derived[base] = append(g.derived[base], d)
+		}
+	}
+	n := 0
+	for _, d := range g.pous {
+		if d.Kind == st.FunctionBlock && (len(g.derived[d]) > 0 || g.base(d) != nil) {
+			n++
+			g.class[d] = n
+		}
+	}
+	g.collectPrograms()
+}
+
+// collectPrograms finds the program instances and tasks: those of the
+// CONFIGURATIONs, else one instance of every PROGRAM no other POU calls.
+// Instances without a task run in plc_cycle.
+func (g *generator) collectPrograms() {
+	seen := map[*st.POU]bool{}
+	for _, d := range g.pous {
+		if d.Kind == st.Program {
+			g.programs = append(g.programs, progInst{name: cname(d.Name.Name), pou: d})
+		}
+	}
+	var cycle []progInst
+	configured := false
+	for _, f := range g.p.Files {
+		if g.p.IsTestFile(f) {
+			continue
+		}
+		for _, decl := range f.Decls {
+			c, ok := decl.(*st.Configuration)
+			if !ok {
+				continue
+			}
+			for _, r := range c.Resources {
+				byName := map[string]int{}
+				for _, td := range r.Tasks {
+					var params []string
+					for _, a := range td.Params {
+						if a.Name != nil && a.Value != nil {
+							params = append(params, a.Name.Name+" := "+st.ExprString(a.Value))
+						}
+					}
+					byName[strings.ToUpper(td.Name.Name)] = len(g.tasks)
+					g.tasks = append(g.tasks, task{name: cname(td.Name.Name), params: strings.Join(params, ", ")})
+				}
+				for _, pc := range r.Programs {
+					configured = true
+					d := g.p.POU(pc.Type.Name)
+					if d == nil || d.Kind != st.Program {
+						g.errorf(f.Name, pc, "no PROGRAM %s", pc.Type.Name)
+						continue
+					}
+					// the first instance of a program type is the one other
+					// code sees under the type's name
+					name := cname(d.Name.Name)
+					if seen[d] {
+						name = cname(pc.Name.Name)
+						g.programs = append(g.programs, progInst{name: name, pou: d, config: pc.Name.Name})
+					} else {
+						for i := range g.programs {
+							if g.programs[i].pou == d {
+								g.programs[i].config = pc.Name.Name
+							}
+						}
+					}
+					seen[d] = true
+					pi := progInst{name: name, pou: d}
+					if pc.Task == nil {
+						cycle = append(cycle, pi)
+						continue
+					}
+					i, ok := byName[strings.ToUpper(pc.Task.Name)]
+					if !ok {
+						g.errorf(f.Name, pc.Task, "no TASK %s", pc.Task.Name)
+						continue
+					}
+					g.tasks[i].programs = append(g.tasks[i].programs, pi)
+				}
+			}
+		}
+	}
+	if !configured {
+		called := map[*st.POU]bool{}
+		for _, r := range g.p.References() {
+			if r.Call && r.Symbol != nil && r.Symbol.Kind == st.POUSymbol {
+				called[r.Symbol.POU] = true
+			}
+		}
+		for _, pi := range g.programs {
+			if !called[pi.pou] {
+				cycle = append(cycle, pi)
+			}
+		}
+	}
+	if len(cycle) > 0 {
+		g.tasks = append(g.tasks, task{programs: cycle})
+	}
+}
+
+// base returns the function block d extends, or nil.
+func (g *generator) base(d *st.POU) *st.POU {
+	if d.Extends == nil {
+		return nil
+	}
+	if b := g.p.POU(d.Extends.Name); b != nil && b != d && b.Kind == st.FunctionBlock && !st.IsStandard(b) {
+		return b
+	}
+	return nil
+}
+
+// basePath returns the member path from an instance of d to its part of
+// type a, a base of d: "base.base.".
+func (g *generator) basePath(d, a *st.POU) string {
+	var sb strings.Builder
+	for x := d; x != nil && x != a; x = g.base(x) {
+		sb.WriteString("base.")
+	}
+	return sb.String()
+}
+
+// root returns the first function block of d's hierarchy, which holds the
+// class number.
+func (g *generator) root(d *st.POU) *st.POU {
+	for g.base(d) != nil {
+		d = g.base(d)
+	}
+	return d
+}
+
+// ── Names ─────────────────────────────────────────────────────────────────────
+
+// reserved are C keywords and names of the C library and the runtime that
+// an ST identifier must not take over. cname appends an underscore to them.
+var reserved = map[string]bool{}
+
+func init() {
+	for _, w := range strings.Fields(`
+		auto break case char const continue default do double else enum extern
+		float for goto if inline int long register restrict return short signed
+		sizeof static struct switch typedef union unsigned void volatile while
+		_Bool _Complex _Imaginary bool true false NULL EOF
+		self base main errno assert abort exit abs labs div malloc calloc realloc free
+		atoi atol atof strtod strtof strtol strtoul rand srand qsort bsearch getenv system
+		memcpy memmove memset memcmp memchr strcpy strncpy strcat strncat strcmp strncmp
+		strlen strchr strrchr strstr strtok strerror index
+		sin cos tan asin acos atan atan2 sinh cosh tanh exp log log10 pow sqrt ceil floor
+		fabs fmod round trunc isnan isinf nan y0 y1 yn j0 j1 jn gamma signbit
+		printf fprintf sprintf snprintf puts putchar getchar fopen fclose stdin stdout stderr
+		remove rename time clock signal raise va_list va_start va_arg va_end
+		NAN HUGE_VAL INFINITY INT64_MIN INT64_MAX INT64_C UINT64_C UINT64_MAX
+		int8_t int16_t int32_t int64_t uint8_t uint16_t uint32_t uint64_t size_t
+		TON TOF TP R_TRIG F_TRIG CTU CTD CTUD SR RS`) {
+		reserved[w] = true
+	}
+}
+
+// cname returns the C spelling of an ST identifier. ST identifiers cannot
+// contain "__", which keeps the names the generator composes with "__"
+// apart from them.
+func cname(s string) string {
+	if reserved[s] || strings.HasPrefix(strings.ToLower(s), "iec_") {
+		return s + "_"
+	}
+	return s
+}
+
+// pouName returns the C name of a function, function block or the type of
+// a program.
+func (g *generator) pouName(d *st.POU) string {
+	switch {
+	case st.IsStandard(d):
+		return strings.ToUpper(d.Name.Name)
+	case d.Kind == st.Program:
+		return cname(d.Name.Name) + "__type"
+	case d.Kind == st.Method:
+		return g.pouName(g.p.Owner(d)) + "__" + d.Name.Name
+	}
+	return cname(d.Name.Name)
+}
+
+// ── Types ─────────────────────────────────────────────────────────────────────
+
+// cTypes maps the elementary types to their C typedefs in iec_rt.h.
+// Untyped literals compute in the widest type.
+var cTypes = map[string]string{
+	"BOOL": "IEC_BOOL", "BYTE": "IEC_BYTE", "WORD": "IEC_WORD", "DWORD": "IEC_DWORD", "LWORD": "IEC_LWORD",
+	"SINT": "IEC_SINT", "INT": "IEC_INT", "DINT": "IEC_DINT", "LINT": "IEC_LINT",
+	"USINT": "IEC_USINT", "UINT": "IEC_UINT", "UDINT": "IEC_UDINT", "ULINT": "IEC_ULINT",
+	"REAL": "IEC_REAL", "LREAL": "IEC_LREAL",
+	"TIME": "IEC_TIME", "LTIME": "IEC_LTIME",
+	"DATE": "IEC_DATE", "TOD": "IEC_TOD", "DT": "IEC_DT",
+	"LDATE": "IEC_LDATE", "LTOD": "IEC_LTOD", "LDT": "IEC_LDT",
+	"CHAR":    "IEC_CHAR",
+	"ANY_INT": "IEC_LINT", "ANY_REAL": "IEC_LREAL",
+}
+
+// typeName returns the C name of a named or elementary type.
+func (g *generator) typeName(t *st.Type) string {
+	switch {
+	case t.Class == st.InstanceClass:
+		return g.pouName(t.POU)
+	case t.Decl != nil:
+		return cname(t.Decl.Name.Name)
+	}
+	return cTypes[t.Name]
+}
+
+// decl returns the C declaration of inner with type t, in C's inside-out
+// declarator syntax: decl(ARRAY[1..3] OF INT, "*p") is "IEC_INT (*p)[3]".
+// An empty inner gives the type name for casts and compound literals.
+func (g *generator) decl(t *st.Type, inner string) string {
+	wrap := func(suffix string) string {
+		if strings.HasPrefix(inner, "*") {
+			return "(" + inner + ")" + suffix
+		}
+		return inner + suffix
+	}
+	if t.Decl == nil || t.Class == st.InstanceClass {
+		switch t.Class {
+		case st.ArrayClass:
+			var dims strings.Builder
+			for _, d := range t.Dims {
+				fmt.Fprintf(&dims, "[%d]", d.Len())
+			}
+			return g.decl(t.Elem, wrap(dims.String()))
+		case st.StringClass:
+			return "char " + wrap(fmt.Sprintf("[%d]", t.Len+1))
+		case st.PointerClass:
+			return g.decl(t.Elem, "*"+inner)
+		}
+	}
+	if inner == "" {
+		return g.typeName(t)
+	}
+	if strings.HasPrefix(inner, "*") {
+		return g.typeName(t) + " " + inner
+	}
+	return g.typeName(t) + " " + inner
+}
+
+// checkType returns why t cannot be translated, or "".
+func (g *generator) checkType(t *st.Type) string {
+	return g.checkTypeDepth(t, 0)
+}
+
+func (g *generator) checkTypeDepth(t *st.Type, depth int) string {
+	if depth > 16 {
+		return ""
+	}
+	switch t.Class {
+	case st.StringClass:
+		if t.Wide {
+			return "WSTRING is not supported"
+		}
+	case st.CharClass:
+		if t.Wide {
+			return "WCHAR is not supported"
+		}
+	case st.StructClass, st.EnumClass:
+		if t.Decl == nil {
+			return "anonymous " + map[st.Class]string{st.StructClass: "STRUCT", st.EnumClass: "enumeration"}[t.Class] +
+				" types are not supported; declare a named type"
+		}
+	case st.ArrayClass:
+		for _, d := range t.Dims {
+			if !d.Known || d.Len() <= 0 {
+				return "array bounds of " + t.Name + " must be constant"
+			}
+		}
+		return g.checkTypeDepth(t.Elem, depth+1)
+	case st.PointerClass:
+		return g.checkTypeDepth(t.Elem, depth+1)
+	case st.InstanceClass:
+		if t.POU.Kind == st.Program && depth > 0 {
+			return "pointers to programs are not supported"
+		}
+	case st.AnyClass:
+		return "generic parameters (" + t.Name + ") are not supported"
+	case st.InvalidClass, st.VoidClass:
+		return "type " + t.Name + " is not supported"
+	}
+	if t.Decl == nil && t.Class != st.InstanceClass && g.typeName(t) == "" {
+		switch t.Class {
+		case st.ArrayClass, st.StringClass, st.PointerClass:
+		default:
+			return "type " + t.Name + " is not supported"
+		}
+	}
+	return ""
+}
+
+// needsInit reports whether a variable of type t needs more than zero
+// bytes to hold its initial value.
+func (g *generator) needsInit(t *st.Type) bool {
+	switch t.Class {
+	case st.InstanceClass:
+		return !st.IsStandard(t.POU)
+	case st.StructClass:
+		return true
+	case st.ArrayClass:
+		return g.needsInit(t.Elem)
+	case st.EnumClass:
+		if len(t.Members) > 0 && t.Members[0].Value != 0 {
+			return true
+		}
+	}
+	return t.Decl != nil && t.Decl.Init != nil
+}
+
+// ── Header ────────────────────────────────────────────────────────────────────
+
+func (g *generator) header() string {
+	var w strings.Builder
+	guard := strings.ToUpper(g.name) + "_H"
+	fmt.Fprintf(&w, "/* %s.h — generated by iecst transpile from Structured Text. Do not edit. */\n", g.name)
+	fmt.Fprintf(&w, "#ifndef %s\n#define %s\n\n#include \"%s\"\n\n#ifdef __cplusplus\nextern \"C\" {\n#endif\n", guard, guard, RuntimeHeader)
+
+	g.writeTypes(&w)
+
+	// section writes the declarations that body writes under a heading,
+	// or nothing when there are none.
+	section := func(title string, body func(w *strings.Builder)) {
+		var b strings.Builder
+		body(&b)
+		if b.Len() == 0 {
+			return
+		}
+		fmt.Fprintf(&w, "\n/* ── %s %s */\n\n", title, strings.Repeat("─", max(3, 72-len([]rune(title)))))
+		w.WriteString(b.String())
+	}
+	section("Data types", func(w *strings.Builder) {
+		for _, td := range g.types {
+			if _, ok := td.Type.(*st.StructType); ok {
+				name := cname(td.Name.Name)
+				fmt.Fprintf(w, "void %s__init(%s *self);\n", name, name)
+			}
+		}
+	})
+	section("Function blocks", func(w *strings.Builder) {
+		for _, d := range g.pous {
+			if d.Kind == st.FunctionBlock {
+				g.writePrototypes(w, d)
+			}
+		}
+	})
+	section("Functions", func(w *strings.Builder) {
+		for _, d := range g.pous {
+			if d.Kind == st.Function {
+				fmt.Fprintf(w, "%s;\n", g.signature(d, g.pouName(d)))
+			}
+		}
+	})
+	section("Global variables", func(w *strings.Builder) {
+		for _, sym := range g.globals {
+			if g.checkType(sym.Type) == "" {
+				fmt.Fprintf(w, "extern %s;\n", g.decl(sym.Type, g.globalFor[strings.ToUpper(sym.Name)]))
+			}
+		}
+	})
+	section("Programs", func(w *strings.Builder) {
+		for _, d := range g.pous {
+			if d.Kind == st.Program {
+				g.writePrototypes(w, d)
+			}
+		}
+		for _, pi := range g.programs {
+			if pi.config != "" && pi.config != pi.name {
+				fmt.Fprintf(w, "extern %s %s; /* PROGRAM %s */\n", g.pouName(pi.pou), pi.name, pi.config)
+				continue
+			}
+			fmt.Fprintf(w, "extern %s %s;\n", g.pouName(pi.pou), pi.name)
+		}
+	})
+	fmt.Fprintf(&w, "\n/* %s_init sets all global variables and program instances to their\n * initial values. */\nvoid %s_init(void);\n", g.name, g.name)
+	for _, t := range g.tasks {
+		var names []string
+		for _, pi := range t.programs {
+			names = append(names, pi.name)
+		}
+		if t.name == "" {
+			fmt.Fprintf(&w, "\n/* %s_cycle runs %s once. */\nvoid %s_cycle(void);\n", g.name, strings.Join(names, ", "), g.name)
+			continue
+		}
+		fmt.Fprintf(&w, "\n/* TASK %s (%s) runs %s. */\nvoid %s(void);\n", t.name, t.params, strings.Join(names, ", "), g.taskFunc(t))
+	}
+	fmt.Fprintf(&w, "\n#ifdef __cplusplus\n}\n#endif\n\n#endif /* %s */\n", guard)
+	return w.String()
+}
+
+// writePrototypes writes the init, step and method prototypes of a
+// function block or program.
+func (g *generator) writePrototypes(w *strings.Builder, d *st.POU) {
+	name := g.pouName(d)
+	fmt.Fprintf(w, "void %s(%s *self);\nvoid %s(%s *self);\n", g.initName(d), name, g.stepName(d), name)
+	for _, m := range d.Methods {
+		fmt.Fprintf(w, "%s;\n", g.signature(m, g.pouName(m)))
+	}
+}
+
+// taskFunc returns the name of the function that runs a task.
+func (g *generator) taskFunc(t task) string {
+	if t.name == "" {
+		return g.name + "_cycle"
+	}
+	return g.name + "_task_" + t.name
+}
+
+// writeTypes writes the typedefs of the data types, function blocks and
+// programs, each after the types it contains by value.
+func (g *generator) writeTypes(w *strings.Builder) {
+	fmt.Fprintf(w, "\n/* ── Types %s */\n\n", strings.Repeat("─", 66))
+	var named []*st.Type
+	var aliases []*st.TypeDecl
+	for _, td := range g.types {
+		t := g.p.TypeOfDecl(td)
+		if msg := g.checkType(t); msg != "" {
+			g.errorf(g.fileName(td), td, "%s: %s", td.Name.Name, msg)
+			continue
+		}
+		if t.Decl != td {
+			// an alias of a named type: the C code uses that type's name
+			aliases = append(aliases, td)
+			continue
+		}
+		if t.Class == st.StructClass {
+			name := cname(td.Name.Name)
+			fmt.Fprintf(w, "typedef struct %s %s;\n", name, name)
+		}
+		named = append(named, t)
+	}
+	for _, d := range g.pous {
+		if d.Kind == st.FunctionBlock || d.Kind == st.Program {
+			name := g.pouName(d)
+			fmt.Fprintf(w, "typedef struct %s %s;\n", name, name)
+			named = append(named, g.p.InstanceType(d))
+		}
+	}
+
+	done := map[*st.Type]int{} // 1 in progress, 2 written
+	var visit func(t *st.Type)
+	var deps func(t *st.Type, ptr bool)
+	deps = func(t *st.Type, ptr bool) {
+		switch {
+		case t.Class == st.InstanceClass && !st.IsStandard(t.POU) || t.Decl != nil:
+			if !ptr || t.Class != st.StructClass && t.Class != st.InstanceClass {
+				visit(t)
+			}
+		case t.Class == st.ArrayClass:
+			deps(t.Elem, ptr)
+		case t.Class == st.PointerClass:
+			deps(t.Elem, true)
+		}
+	}
+	visit = func(t *st.Type) {
+		if done[t] != 0 {
+			if done[t] == 1 {
+				g.errorf("", nil, "type %s contains itself", t.Name)
+			}
+			return
+		}
+		done[t] = 1
+		switch {
+		case t.Class == st.InstanceClass:
+			if t.Base != nil {
+				deps(t.Base, false)
+			}
+			for _, f := range t.Fields {
+				if f.Block != "VAR_TEMP" && f.Block != "VAR_EXTERNAL" {
+					deps(f.Type, f.Block == "VAR_IN_OUT")
+				}
+			}
+		case t.Class == st.StructClass:
+			if t.Base != nil {
+				deps(t.Base, false)
+			}
+			for _, f := range t.Fields {
+				deps(f.Type, false)
+			}
+		case t.Class == st.EnumClass:
+		default:
+			deps(g.p.GlobalScope().ResolveType(t.Decl.Type), false)
+		}
+		w.WriteString("\n")
+		g.writeType(w, t)
+		done[t] = 2
+	}
+	for _, t := range named {
+		visit(t)
+	}
+	if len(aliases) > 0 {
+		w.WriteString("\n")
+	}
+	for _, td := range aliases {
+		fmt.Fprintf(w, "typedef %s %s;\n", g.typeName(g.p.TypeOfDecl(td)), cname(td.Name.Name))
+	}
+}
+
+// writeType writes the definition of a named type.
+func (g *generator) writeType(w *strings.Builder, t *st.Type) {
+	switch t.Class {
+	case st.EnumClass:
+		name := cname(t.Decl.Name.Name)
+		base := "IEC_INT"
+		if t.Base != nil {
+			base = g.decl(t.Base, "")
+		}
+		fmt.Fprintf(w, "typedef %s %s;\nenum {\n", base, name)
+		for _, m := range t.Members {
+			if m.Value < -1<<31 || m.Value >= 1<<31 {
+				g.errorf(g.fileName(t.Decl), m.Ident, "enumeration value %s does not fit a C int", m.Name)
+			}
+			fmt.Fprintf(w, "    %s__%s = %d,\n", name, m.Name, m.Value)
+		}
+		w.WriteString("};\n")
+	case st.StructClass:
+		name := cname(t.Decl.Name.Name)
+		fmt.Fprintf(w, "struct %s {\n", name)
+		if t.Base != nil {
+			fmt.Fprintf(w, "    %s base;\n", g.typeName(t.Base))
+		}
+		for _, f := range t.Fields {
+			if msg := g.checkType(f.Type); msg != "" {
+				g.errorf(g.fileName(t.Decl), f.Ident, "%s: %s", f.Name, msg)
+				continue
+			}
+			fmt.Fprintf(w, "    %s;\n", g.decl(f.Type, cname(f.Name)))
+		}
+		if t.Base == nil && len(t.Fields) == 0 {
+			w.WriteString("    char unused__;\n")
+		}
+		w.WriteString("};\n")
+	case st.InstanceClass:
+		d := t.POU
+		file := g.fileName(d)
+		fmt.Fprintf(w, "struct %s {\n", g.pouName(d))
+		if g.class[d] != 0 && g.base(d) == nil {
+			w.WriteString("    IEC_UDINT class__; /* function block type, for method dispatch */\n")
+		}
+		if b := g.base(d); b != nil {
+			fmt.Fprintf(w, "    %s base;\n", g.pouName(b))
+		}
+		n := 0
+		for _, b := range d.VarBlocks {
+			switch b.Kind {
+			case "VAR_TEMP", "VAR_EXTERNAL":
+				continue
+			case "VAR_INST", "VAR_CONFIG", "VAR_ACCESS", "VAR_GLOBAL":
+				g.errorf(file, b, "%s in %s is not supported", b.Kind, d.Name.Name)
+				continue
+			}
+			fmt.Fprintf(w, "    /* %s */\n", b.Kind)
+			for _, v := range b.Vars {
+				ft := g.scope(d).ResolveType(v.Type)
+				if msg := g.checkType(ft); msg != "" {
+					g.errorf(file, v, "%s: %s", v.Names[0].Name, msg)
+					continue
+				}
+				for _, id := range v.Names {
+					inner := cname(id.Name)
+					if b.Kind == "VAR_IN_OUT" || ft.Class == st.PointerClass && ft.Ref {
+						// bound to the caller's variable
+						if ft.Class == st.PointerClass {
+							ft = ft.Elem
+						}
+						inner = "*" + inner
+					}
+					n++
+					if v.At != nil {
+						fmt.Fprintf(w, "    %s; /* AT %s */\n", g.decl(ft, inner), v.At.Text)
+						continue
+					}
+					fmt.Fprintf(w, "    %s;\n", g.decl(ft, inner))
+				}
+			}
+		}
+		if n == 0 && g.base(d) == nil && g.class[d] == 0 {
+			w.WriteString("    char unused__;\n")
+		}
+		w.WriteString("};\n")
+	default:
+		u := g.p.GlobalScope().ResolveType(t.Decl.Type)
+		fmt.Fprintf(w, "typedef %s;\n", g.decl(u, cname(t.Decl.Name.Name)))
+	}
+}
+
+// ── Signatures ────────────────────────────────────────────────────────────────
+
+// param is a parameter of a function or method.
+type param struct {
+	name  string // ST name
+	block string // VAR_INPUT, VAR_IN_OUT or VAR_OUTPUT
+	t     *st.Type
+	decl  *st.VarDecl
+}
+
+// params returns the parameters of a function or method in declaration
+// order.
+func (g *generator) params(d *st.POU) []param {
+	var out []param
+	s := g.scope(d)
+	for _, b := range d.VarBlocks {
+		switch b.Kind {
+		case "VAR_INPUT", "VAR_IN_OUT", "VAR_OUTPUT":
+		default:
+			continue
+		}
+		for _, v := range b.Vars {
+			t := s.ResolveType(v.Type)
+			for _, id := range v.Names {
+				out = append(out, param{name: id.Name, block: b.Kind, t: t, decl: v})
+			}
+		}
+	}
+	return out
+}
+
+// resultType returns the result type of a function or method, nil if it
+// has none.
+func (g *generator) resultType(d *st.POU) *st.Type {
+	if d.ReturnType == nil {
+		return nil
+	}
+	return g.scope(d).ResolveType(d.ReturnType)
+}
+
+// signature returns the C prototype of a function or method. Inputs are
+// passed by value, STRING inputs as const char * and arrays as pointers
+// that the callee copies; in-outs and outputs by pointer. A STRING result
+// is written to a buffer the caller passes first.
+func (g *generator) signature(d *st.POU, name string) string {
+	self := ""
+	if d.Kind == st.Method {
+		self = g.pouName(g.p.Owner(d))
+	}
+	return g.signatureSelf(d, name, self)
+}
+
+// signatureSelf returns the prototype of d with a receiver of type self,
+// for methods and their dispatch functions.
+func (g *generator) signatureSelf(d *st.POU, name, self string) string {
+	var ps []string
+	ret := "void"
+	if rt := g.resultType(d); rt != nil {
+		switch rt.Class {
+		case st.StringClass:
+			ret = "char *"
+			ps = append(ps, "char *ret__")
+		case st.ArrayClass:
+			g.errorf(g.fileName(d), d.ReturnType, "functions returning arrays are not supported")
+		default:
+			if msg := g.checkType(rt); msg != "" {
+				g.errorf(g.fileName(d), d.ReturnType, "result of %s: %s", d.Name.Name, msg)
+			} else {
+				ret = g.decl(rt, "")
+			}
+		}
+	}
+	if self != "" {
+		ps = append(ps, self+" *self")
+	}
+	for _, p := range g.params(d) {
+		if msg := g.checkType(p.t); msg != "" {
+			g.errorf(g.fileName(d), p.decl, "%s: %s", p.name, msg)
+			continue
+		}
+		switch {
+		case p.block != "VAR_INPUT":
+			ps = append(ps, g.decl(p.t, "*"+cname(p.name)))
+		case p.t.Class == st.StringClass:
+			ps = append(ps, "const char *"+cname(p.name)+"__in")
+		case p.t.Class == st.ArrayClass:
+			ps = append(ps, g.decl(p.t, cname(p.name)+"__in"))
+		default:
+			ps = append(ps, g.decl(p.t, cname(p.name)))
+		}
+	}
+	if len(ps) == 0 {
+		ps = []string{"void"}
+	}
+	if strings.HasSuffix(ret, "*") {
+		return ret + name + "(" + strings.Join(ps, ", ") + ")"
+	}
+	return ret + " " + name + "(" + strings.Join(ps, ", ") + ")"
+}
+
+func fileOf(sym *st.Symbol) string {
+	if sym.File != nil {
+		return sym.File.Name
+	}
+	return ""
+}
@@ -0,0 +1,82 @@
+package cgen
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/damischa1/iec-st-tools/st"
+)
+
+// generate translates the single-file project file.
+func generate(t *testing.T, file string) []File {
+	t.Helper()
+	p, err := st.LoadProject(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for f, list := range p.SyntaxErrors {
+		t.Fatalf("%s: %v", f.Name, list)
+	}
+	for f, list := range p.Check() {
+		t.Fatalf("%s: %v", f.Name, list)
+	}
+	files, err := Generate(p, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+// TestCompile translates testdata/cgen and testdata/interp and compiles
+// the result as README promises: gcc -std=c99 -Wall -Wextra -pedantic,
+// with warnings as errors. It is skipped when there is no C compiler.
+func TestCompile(t *testing.T) {
+	cc, err := exec.LookPath("cc")
+	if err != nil {
+		t.Skip("no C compiler")
+	}
+	var cases []string
+	for _, dir := range []string{"../testdata/cgen", "../testdata/interp"} {
+		files, _ := filepath.Glob(filepath.Join(dir, "*.st"))
+		cases = append(cases, files...)
+	}
+	if len(cases) == 0 {
+		t.Fatal("no test cases")
+	}
+	for _, file := range cases {
+		t.Run(strings.TrimSuffix(filepath.Base(file), ".st"), func(t *testing.T) {
+			dir := t.TempDir()
+			for _, f := range generate(t, file) {
+				if err := os.WriteFile(filepath.Join(dir, f.Name), f.Data, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			cmd := exec.Command(cc, "-std=c99", "-Wall", "-Wextra", "-pedantic", "-Werror", "-c", "plc.c", "-o", os.DevNull)
+			cmd.Dir = dir
+			if out, err := cmd.CombinedOutput(); err != nil {
+				t.Fatalf("%v\n%s", err, out)
+			}
+		})
+	}
+}
+
+// TestEmptySections checks that the header leaves out the headings of
+// sections without declarations.
+func TestEmptySections(t *testing.T) {
+	for _, f := range generate(t, "../testdata/cgen/limits.st") {
+		if f.Name != "plc.h" && f.Name != "plc.c" {
+			continue
+		}
+		for _, title := range []string{"Data types", "Function blocks", "Functions"} {
+			if strings.Contains(string(f.Data), "── "+title+" ") {
+				t.Errorf("%s: empty section %q", f.Name, title)
+			}
+		}
+		if !strings.Contains(string(f.Data), "── Programs ") {
+			t.Errorf("%s: no Programs section", f.Name)
+		}
+	}
+}
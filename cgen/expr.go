@@ -0,0 +1,1246 @@
+package cgen
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/damischa1/iec-st-tools/st"
+)
+
+// ── Values ────────────────────────────────────────────────────────────────────
+
+// val is a translated expression: its C code and the ST type of its value.
+// TIME and the date types are int64_t nanoseconds, as in the interpreter.
+type val struct {
+	c     string
+	t     *st.Type
+	konst bool  // an integer, BOOL, enumeration or TIME constant with value k
+	k     int64 // nanoseconds for TIME and dates
+	lv    bool  // c designates a variable
+}
+
+var bad = val{c: "0", t: st.TypeBad}
+
+// intInfo returns the width and signedness of an integer-like type, as
+// interp does.
+func intInfo(t *st.Type) (bits int, signed bool) {
+	switch t.Class {
+	case st.BoolClass:
+		return 1, false
+	case st.IntClass:
+		return t.Bits, t.Signed || t.Untyped
+	case st.EnumClass:
+		if t.Base != nil {
+			return intInfo(t.Base)
+		}
+		return 16, true
+	case st.BitsClass, st.CharClass:
+		return t.Bits, false
+	}
+	return 64, true
+}
+
+// wrap reduces n to the range of t.
+func wrap(n int64, t *st.Type) int64 {
+	if t.Class == st.BoolClass {
+		if n != 0 {
+			return 1
+		}
+		return 0
+	}
+	bits, signed := intInfo(t)
+	if bits >= 64 || bits <= 0 {
+		return n
+	}
+	n &= 1<<bits - 1
+	if signed && n&(1<<(bits-1)) != 0 {
+		n -= 1 << bits
+	}
+	return n
+}
+
+// limits returns the range of an integer type narrower than 64 bits.
+func limits(t *st.Type) (lo, hi int64, ok bool) {
+	switch t.Class {
+	case st.IntClass, st.BitsClass, st.CharClass:
+	default:
+		return 0, 0, false
+	}
+	bits, signed := intInfo(t)
+	if t.Untyped || bits >= 64 || bits <= 0 {
+		return 0, 0, false
+	}
+	if signed {
+		return -1 << (bits - 1), 1<<(bits-1) - 1, true
+	}
+	return 0, 1<<bits - 1, true
+}
+
+// fixedCompare reports the result of v op k, for a v of type t, when the
+// range of t alone decides it. gcc -Wextra warns about such comparisons
+// (-Wtype-limits), so they are written as constants.
+func fixedCompare(t *st.Type, op string, k int64) (result, ok bool) {
+	lo, hi, ok := limits(t)
+	if !ok {
+		return false, false
+	}
+	switch op {
+	case "==", "!=":
+		if k < lo || k > hi {
+			return op == "!=", true
+		}
+	case "<":
+		if hi < k || lo >= k {
+			return hi < k, true
+		}
+	case "<=":
+		if hi <= k || lo > k {
+			return hi <= k, true
+		}
+	case ">":
+		if lo > k || hi <= k {
+			return lo > k, true
+		}
+	case ">=":
+		if lo >= k || hi < k {
+			return lo >= k, true
+		}
+	}
+	return false, false
+}
+
+// compareConst writes c op k, where c has the type t, or true or false
+// when fixedCompare decides it.
+func compareConst(c string, t *st.Type, op string, k int64) string {
+	if r, ok := fixedCompare(t, op, k); ok {
+		return strconv.FormatBool(r)
+	}
+	return c + " " + op + " " + intLit(k, st.TypeLInt)
+}
+
+// wrapFunc returns the runtime function that narrows a uint64_t to t.
+func wrapFunc(t *st.Type) string {
+	bits, signed := intInfo(t)
+	switch {
+	case bits <= 8:
+		bits = 8
+	case bits <= 16:
+		bits = 16
+	case bits <= 32:
+		bits = 32
+	default:
+		bits = 64
+	}
+	if signed {
+		return fmt.Sprintf("iec_s%d", bits)
+	}
+	return fmt.Sprintf("iec_u%d", bits)
+}
+
+func isInt(t *st.Type) bool {
+	switch t.Class {
+	case st.IntClass, st.BitsClass, st.BoolClass, st.EnumClass, st.CharClass:
+		return true
+	}
+	return false
+}
+
+func isTime(t *st.Type) bool { return t.Class == st.TimeClass || t.Class == st.DateClass }
+
+func unsigned64(t *st.Type) bool {
+	bits, signed := intInfo(t)
+	return bits >= 64 && !signed
+}
+
+// intLit writes an integer constant of type t.
+func intLit(k int64, t *st.Type) string {
+	switch {
+	case t.Class == st.BoolClass:
+		if k != 0 {
+			return "true"
+		}
+		return "false"
+	case unsigned64(t) && k < 0:
+		return fmt.Sprintf("UINT64_C(%d)", uint64(k))
+	case k > math.MinInt32 && k <= math.MaxInt32:
+		return strconv.FormatInt(k, 10)
+	case k == math.MinInt64:
+		return "INT64_MIN"
+	}
+	return fmt.Sprintf("INT64_C(%d)", k)
+}
+
+// realLit writes a floating-point constant; REAL constants are rounded to
+// single precision as the PLC stores them.
+func realLit(x float64, t *st.Type) string {
+	var s string
+	switch {
+	case math.IsNaN(x):
+		s = "NAN"
+	case math.IsInf(x, 1):
+		s = "HUGE_VAL"
+	case math.IsInf(x, -1):
+		s = "-HUGE_VAL"
+	default:
+		s = strconv.FormatFloat(x, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".e") {
+			s += ".0"
+		}
+	}
+	if t.Class == st.RealClass && t.Bits == 32 {
+		return "(IEC_REAL)" + s
+	}
+	return s
+}
+
+// cString writes a C string literal.
+func cString(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\\':
+			sb.WriteByte('\\')
+			sb.WriteByte(c)
+		case c == '?' && i > 0 && s[i-1] == '?':
+			sb.WriteString(`\?`) // no trigraphs
+		case c < 0x20 || c >= 0x7f:
+			fmt.Fprintf(&sb, "\\%03o", c)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+var simpleRe = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*((\.|->)[A-Za-z_][A-Za-z0-9_]*|\[[0-9]+\])*|[0-9][0-9.eE+x]*)$`)
+
+// paren parenthesises c unless it is a single operand.
+func paren(c string) string {
+	if simpleRe.MatchString(c) || enclosed(c) {
+		return c
+	}
+	return "(" + c + ")"
+}
+
+// enclosed reports whether c is wrapped in one pair of parentheses, or is
+// a call f(…).
+func enclosed(c string) bool {
+	i := strings.IndexByte(c, '(')
+	if i < 0 || !strings.HasSuffix(c, ")") || i > 0 && !identRe.MatchString(c[:i]) {
+		return false
+	}
+	depth := 0
+	inStr := false
+	for j := i; j < len(c); j++ {
+		switch {
+		case inStr:
+			if c[j] == '\\' {
+				j++
+			} else if c[j] == '"' {
+				inStr = false
+			}
+		case c[j] == '"':
+			inStr = true
+		case c[j] == '(':
+			depth++
+		case c[j] == ')':
+			depth--
+			if depth == 0 && j < len(c)-1 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// ── Expressions ───────────────────────────────────────────────────────────────
+
+func (f *fn) expr(e st.Expr) val {
+	switch e := e.(type) {
+	case *st.Literal:
+		return f.literal(e)
+	case *st.Ident:
+		return f.ident(e)
+	case *st.EnumLiteral:
+		sym := f.scope.Resolve(e)
+		if sym == nil || sym.Member == nil {
+			f.errorf(e, "%s has no value %s", e.Type.Name, e.Value.Name)
+			return bad
+		}
+		return f.enumValue(sym)
+	case *st.MemberExpr:
+		return f.member(e)
+	case *st.IndexExpr:
+		return f.index(e)
+	case *st.DerefExpr:
+		x := f.expr(e.X)
+		if x.t.Class != st.PointerClass {
+			f.errorf(e, "%s is not a pointer", st.ExprString(e.X))
+			return bad
+		}
+		return val{c: deref(x.c), t: x.t.Elem, lv: true}
+	case *st.ParenExpr:
+		v := f.expr(e.X)
+		v.lv = false
+		return v
+	case *st.UnaryExpr:
+		return f.unary(e)
+	case *st.BinaryExpr:
+		return f.binary(e)
+	case *st.CallExpr:
+		v, post := f.call(e, false)
+		if v.t.Class == st.VoidClass {
+			f.errorf(e, "%s has no result", st.ExprString(e.Func))
+			return bad
+		}
+		if len(post) > 0 {
+			f.errorf(e, "outputs of %s need a conversion; call it as a statement", st.ExprString(e.Func))
+		}
+		return v
+	case *st.AddressExpr:
+		f.errorf(e, "direct addresses (%s) in expressions are not supported; declare a variable AT %s", e.Text, e.Text)
+		return bad
+	}
+	f.errorf(e, "%s is not supported here", st.ExprString(e))
+	return bad
+}
+
+func (f *fn) literal(e *st.Literal) val {
+	t := f.scope.TypeOf(e)
+	switch e.Kind {
+	case st.KEYWORD:
+		b, _ := e.Bool()
+		return f.boolConst(b)
+	case st.INT:
+		if b, isBool := e.Bool(); isBool {
+			return f.boolConst(b)
+		}
+		n, ok := e.Int()
+		if !ok {
+			break
+		}
+		if t.Class == st.RealClass {
+			return val{c: realLit(float64(n), t), t: t}
+		}
+		n = wrap(n, t)
+		return val{c: intLit(n, t), t: t, konst: true, k: n}
+	case st.REAL:
+		x, ok := e.Real()
+		if !ok {
+			break
+		}
+		if t.Class != st.RealClass {
+			n := wrap(int64(x), t)
+			return val{c: intLit(n, t), t: t, konst: true, k: n}
+		}
+		return val{c: realLit(x, t), t: t}
+	case st.STRING:
+		s, _ := e.Str()
+		return val{c: cString(s), t: t}
+	case st.WSTRING:
+		f.errorf(e, "WSTRING is not supported")
+		return bad
+	case st.TIME:
+		var n int64
+		ok := false
+		if t.Class == st.TimeClass {
+			var d time.Duration
+			d, ok = e.Duration()
+			n = int64(d)
+		} else {
+			n, ok = dateLiteral(e)
+		}
+		if ok {
+			return val{c: intLit(n, st.TypeLInt), t: t, konst: true, k: n}
+		}
+	}
+	f.errorf(e, "invalid literal %s", e.Text)
+	return bad
+}
+
+func (f *fn) boolConst(b bool) val {
+	if b {
+		return val{c: "true", t: st.TypeBool, konst: true, k: 1}
+	}
+	return val{c: "false", t: st.TypeBool, konst: true}
+}
+
+// dateLiteral returns D#, TOD# and DT# literals in nanoseconds since 1970
+// or, for times of day, since midnight.
+func dateLiteral(e *st.Literal) (int64, bool) {
+	text := e.Text[strings.IndexByte(e.Text, '#')+1:]
+	var layouts []string
+	switch e.TypePrefix() {
+	case "D", "DATE", "LD", "LDATE":
+		layouts = []string{"2006-01-02"}
+	case "TOD", "TIME_OF_DAY", "LTOD":
+		layouts = []string{"15:04:05", "15:04"}
+	case "DT", "DATE_AND_TIME", "LDT":
+		layouts = []string{"2006-01-02-15:04:05", "2006-01-02-15:04"}
+	}
+	for _, l := range layouts {
+		if t, err := time.ParseInLocation(l, text, time.UTC); err == nil {
+			if l[0] == '1' {
+				return int64(t.Sub(time.Date(0, 1, 1, 0, 0, 0, 0, time.UTC))), true
+			}
+			return t.UnixNano(), true
+		}
+	}
+	return 0, false
+}
+
+func (f *fn) ident(e *st.Ident) val {
+	sym := f.scope.Lookup(e.Name)
+	if sym == nil {
+		f.errorf(e, "undeclared identifier %s", e.Name)
+		return bad
+	}
+	switch sym.Kind {
+	case st.VarSymbol:
+		return f.variable(e, sym)
+	case st.GlobalSymbol:
+		return f.global(sym)
+	case st.EnumValueSymbol:
+		return f.enumValue(sym)
+	case st.POUSymbol:
+		if sym.POU.Kind == st.Program {
+			return val{c: cname(sym.POU.Name.Name), t: f.g.p.InstanceType(sym.POU), lv: true}
+		}
+	}
+	f.errorf(e, "%s is not a variable", e.Name)
+	return bad
+}
+
+// variable translates a local variable, parameter, function result or
+// variable of the function block whose code is translated.
+func (f *fn) variable(e *st.Ident, sym *st.Symbol) val {
+	key := strings.ToUpper(e.Name)
+	if sym.Ident == nil && (key == "THIS" || key == "SUPER") {
+		if f.fb == nil {
+			f.errorf(e, "%s outside a function block", e.Name)
+			return bad
+		}
+		f.usesSelf = true
+		if key == "SUPER" {
+			return val{c: "(&self->base)", t: sym.Type}
+		}
+		return val{c: "self", t: sym.Type}
+	}
+	if sym.BlockKind() == "VAR_EXTERNAL" {
+		if g := f.g.p.Global(sym.Name); g != nil {
+			return f.global(g)
+		}
+		f.errorf(e, "no global variable %s for VAR_EXTERNAL", sym.Name)
+		return bad
+	}
+	t := sym.Type
+	ref := t.Class == st.PointerClass && t.Ref
+	if ref {
+		t = t.Elem
+	}
+	if c, ok := f.locals[key]; ok {
+		if ref {
+			c = deref(c)
+		}
+		return val{c: c, t: t, lv: true}
+	}
+	if f.fb == nil || sym.BlockKind() == "VAR_TEMP" {
+		f.errorf(e, "%s cannot be used here", e.Name)
+		return bad
+	}
+	f.usesSelf = true
+	c := f.memberOf("(*self)", f.g.basePath(f.fb, sym.POU)+cname(sym.Name))
+	if ref || sym.BlockKind() == "VAR_IN_OUT" {
+		c = deref(c)
+	}
+	return val{c: c, t: t, lv: true}
+}
+
+func (f *fn) global(sym *st.Symbol) val {
+	c := f.g.globalFor[strings.ToUpper(sym.Name)]
+	if c == "" {
+		f.errorf(nil, "global variable %s is declared in a test file", sym.Name)
+		c = cname(sym.Name)
+	}
+	t := sym.Type
+	if t.Class == st.PointerClass && t.Ref {
+		return val{c: deref(c), t: t.Elem, lv: true}
+	}
+	return val{c: c, t: t, lv: true}
+}
+
+func (f *fn) enumValue(sym *st.Symbol) val {
+	c := strconv.FormatInt(sym.Member.Value, 10)
+	if sym.Type.Decl != nil {
+		c = cname(sym.Type.Decl.Name.Name) + "__" + sym.Member.Name
+	}
+	return val{c: c, t: sym.Type, konst: true, k: sym.Member.Value}
+}
+
+// memberOf writes a member access: memberOf("(*self)", "x") is self->x.
+func (f *fn) memberOf(x, path string) string {
+	if strings.HasPrefix(x, "(*") && strings.HasSuffix(x, ")") && identRe.MatchString(x[2:len(x)-1]) {
+		return x[2:len(x)-1] + "->" + path
+	}
+	return paren(x) + "." + path
+}
+
+// deref writes *p, checking for null pointers unless p is self or an
+// address.
+func deref(p string) string {
+	switch {
+	case p == "self":
+		return "(*self)"
+	case strings.HasPrefix(p, "(&") && enclosed(p):
+		return p[2 : len(p)-1]
+	}
+	return "IEC_DEREF(" + p + ")"
+}
+
+// addr writes &x.
+func addr(x string) string {
+	switch {
+	case strings.HasPrefix(x, "(*") && enclosed(x):
+		return x[2 : len(x)-1]
+	case strings.HasPrefix(x, "IEC_DEREF(") && enclosed(x):
+		return "&" + x
+	}
+	return "&" + paren(x)
+}
+
+func (f *fn) member(e *st.MemberExpr) val {
+	if isBitNumber(e.Name.Name) {
+		x := f.expr(e.X)
+		n, _ := strconv.Atoi(e.Name.Name)
+		bits, _ := intInfo(x.t)
+		if !x.t.IsInteger() || n >= bits {
+			f.errorf(e.Name, "bit %d out of range for %s", n, x.t.Name)
+			return bad
+		}
+		return val{c: fmt.Sprintf("iec_bit(%s, %d)", f.u64(x), n), t: st.TypeBool}
+	}
+	if sym := f.scope.Resolve(e); sym != nil {
+		switch sym.Kind {
+		case st.GlobalSymbol:
+			return f.global(sym)
+		case st.EnumValueSymbol:
+			return f.enumValue(sym)
+		case st.POUSymbol:
+			f.errorf(e, "method %s is not a value; call it", e.Name.Name)
+			return bad
+		}
+	}
+	return f.field(f.expr(e.X), e.Name)
+}
+
+// field translates x.name for a structure or instance x.
+func (f *fn) field(x val, name *st.Ident) val {
+	if x.t.Class != st.StructClass && x.t.Class != st.InstanceClass {
+		f.errorf(name, "%s has no member %s", x.t.Name, name.Name)
+		return bad
+	}
+	var path strings.Builder
+	var fld *st.Field
+	for t := x.t; t != nil && fld == nil; t = t.Base {
+		for _, ff := range t.Fields {
+			if strings.EqualFold(ff.Name, name.Name) {
+				fld = ff
+				break
+			}
+		}
+		if fld == nil {
+			path.WriteString("base.")
+		}
+	}
+	if fld == nil {
+		f.errorf(name, "%s has no member %s", x.t.Name, name.Name)
+		return bad
+	}
+	switch fld.Block {
+	case "VAR_TEMP":
+		f.errorf(name, "%s is a VAR_TEMP of %s", fld.Name, x.t.Name)
+		return bad
+	case "VAR_EXTERNAL":
+		if g := f.g.p.Global(fld.Name); g != nil {
+			return f.global(g)
+		}
+	}
+	c := f.memberOf(x.c, path.String()+cname(fld.Name))
+	t := fld.Type
+	if t.Class == st.PointerClass && t.Ref {
+		t = t.Elem
+		c = deref(c)
+	} else if fld.Block == "VAR_IN_OUT" {
+		c = deref(c)
+	}
+	return val{c: c, t: t, lv: true}
+}
+
+func (f *fn) index(e *st.IndexExpr) val {
+	x := f.expr(e.X)
+	switch x.t.Class {
+	case st.ArrayClass:
+	case st.StringClass:
+		f.errorf(e, "indexing a STRING is not supported")
+		return bad
+	default:
+		f.errorf(e, "%s is not an array", st.ExprString(e.X))
+		return bad
+	}
+	if len(e.Indices) != len(x.t.Dims) {
+		f.errorf(e, "%s has %d dimensions, not %d", x.t.Name, len(x.t.Dims), len(e.Indices))
+		return bad
+	}
+	c := paren(x.c)
+	for k, ie := range e.Indices {
+		d := x.t.Dims[k]
+		i := f.expr(ie)
+		if i.konst && i.k >= d.Lo && i.k <= d.Hi {
+			c += fmt.Sprintf("[%d]", i.k-d.Lo)
+			continue
+		}
+		c += fmt.Sprintf("[iec_idx(%s, %d, %d)]", f.toInt(i), d.Lo, d.Hi)
+	}
+	return val{c: c, t: x.t.Elem, lv: true}
+}
+
+func isBitNumber(s string) bool {
+	_, err := strconv.Atoi(s)
+	return err == nil
+}
+
+// ── Operators ─────────────────────────────────────────────────────────────────
+
+func (f *fn) unary(e *st.UnaryExpr) val {
+	t := f.scope.TypeOf(e)
+	if t.Untyped && t.Class == st.IntClass {
+		if k, ok := f.scope.ConstInt(e); ok {
+			return val{c: intLit(k, t), t: t, konst: true, k: k}
+		}
+	}
+	x := f.expr(e.X)
+	switch e.Op {
+	case "NOT":
+		if t.Class == st.BoolClass {
+			return val{c: "!" + paren(f.truth(x)), t: t}
+		}
+		if !isInt(t) {
+			break
+		}
+		return val{c: wrapFunc(t) + "(~" + f.u64(x) + ")", t: t}
+	case "-":
+		switch {
+		case t.Class == st.RealClass:
+			if x.t.Class == st.RealClass {
+				return val{c: "(-" + paren(x.c) + ")", t: t}
+			}
+			return val{c: f.conv(val{c: "(-" + f.toFloat(x) + ")", t: st.TypeLReal}, t), t: t}
+		case t.Class == st.TimeClass:
+			return val{c: "(-" + paren(x.c) + ")", t: t}
+		case isInt(t):
+			return val{c: wrapFunc(t) + "(-" + f.u64(x) + ")", t: t}
+		}
+	case "+":
+		return x
+	}
+	f.errorf(e, "operator %s not defined on %s", e.Op, x.t.Name)
+	return bad
+}
+
+var cOps = map[string]string{"=": "==", "<>": "!=", "<": "<", ">": ">", "<=": "<=", ">=": ">="}
+
+// mirror maps a C comparison to the one with the operands swapped.
+var mirror = map[string]string{"==": "==", "!=": "!=", "<": ">", ">": "<", "<=": ">=", ">=": "<="}
+
+func (f *fn) binary(e *st.BinaryExpr) val {
+	t := f.scope.TypeOf(e)
+	if t.Untyped && t.Class == st.IntClass {
+		if k, ok := f.scope.ConstInt(e); ok {
+			return val{c: intLit(k, t), t: t, konst: true, k: k}
+		}
+	}
+	switch e.Op {
+	case "AND_THEN", "OR_ELSE":
+		x, y := f.expr(e.X), f.expr(e.Y)
+		op := map[string]string{"AND_THEN": " && ", "OR_ELSE": " || "}[e.Op]
+		return val{c: "(" + f.truth(x) + op + f.truth(y) + ")", t: st.TypeBool}
+	}
+	x, y := f.expr(e.X), f.expr(e.Y)
+	if op, ok := cOps[e.Op]; ok {
+		return val{c: f.compare(e, op, x, y), t: st.TypeBool}
+	}
+	return f.arith(e, e.Op, x, y, t)
+}
+
+// arith applies an arithmetic or bitwise operator, giving a value of type
+// t. Integer operations are done in uint64_t and narrowed to t.
+func (f *fn) arith(n st.Node, op string, x, y val, t *st.Type) val {
+	switch {
+	case t.Class == st.BoolClass:
+		a, b := f.truth(x), f.truth(y)
+		switch op {
+		case "AND":
+			return val{c: "(" + a + " & " + b + ")", t: t}
+		case "OR":
+			return val{c: "(" + a + " | " + b + ")", t: t}
+		case "XOR":
+			return val{c: "(" + a + " != " + b + ")", t: t}
+		}
+	case t.Class == st.RealClass:
+		if op == "**" {
+			return val{c: f.conv(val{c: "pow(" + f.toFloat(x) + ", " + f.toFloat(y) + ")", t: st.TypeLReal}, t), t: t}
+		}
+		if !strings.Contains("+-*/", op) {
+			break
+		}
+		if t.Bits == 32 && x.t.Class == st.RealClass && x.t.Bits == 32 && y.t.Class == st.RealClass && y.t.Bits == 32 {
+			// float arithmetic rounds as double arithmetic narrowed to float
+			return val{c: "(" + x.c + " " + op + " " + y.c + ")", t: t}
+		}
+		r := val{c: "(" + f.toFloat(x) + " " + op + " " + f.toFloat(y) + ")", t: st.TypeLReal}
+		return val{c: f.conv(r, t), t: t}
+	case isInt(t):
+		w := wrapFunc(t)
+		_, signed := intInfo(t)
+		switch op {
+		case "+", "-", "*":
+			return val{c: w + "(" + f.u64(x) + " " + op + " " + f.u64(y) + ")", t: t}
+		case "AND", "OR", "XOR":
+			cop := map[string]string{"AND": "&", "OR": "|", "XOR": "^"}[op]
+			return val{c: w + "(" + f.u64(x) + " " + cop + " " + f.u64(y) + ")", t: t}
+		case "/", "MOD":
+			name := map[string]string{"/": "div", "MOD": "mod"}[op]
+			if signed {
+				return val{c: w + "((uint64_t)iec_" + name + "(" + f.toInt(x) + ", " + f.toInt(y) + "))", t: t}
+			}
+			return val{c: w + "(iec_u" + name + "(" + f.u64(x) + ", " + f.u64(y) + "))", t: t}
+		}
+	case isTime(t):
+		return f.timeArith(n, op, x, y, t)
+	}
+	f.errorf(n, "operator %s not defined on %s and %s", op, x.t.Name, y.t.Name)
+	return bad
+}
+
+// timeArith computes TIME ± TIME, TIME * n, TIME / n and the date
+// differences. Plain numbers added to a TIME count milliseconds.
+func (f *fn) timeArith(n st.Node, op string, x, y val, t *st.Type) val {
+	ns := func(v val) string {
+		if isTime(v.t) {
+			return v.c
+		}
+		if v.konst {
+			return intLit(f.constInt(v)*int64(time.Millisecond), st.TypeLInt)
+		}
+		return "(" + f.toInt(v) + " * IEC_MS)"
+	}
+	if x.konst && y.konst && op != "/" {
+		nsK := func(v val) int64 {
+			if isTime(v.t) {
+				return v.k
+			}
+			return f.constInt(v) * int64(time.Millisecond)
+		}
+		var k int64
+		switch op {
+		case "+":
+			k = nsK(x) + nsK(y)
+		case "-":
+			k = nsK(x) - nsK(y)
+		case "*":
+			if isTime(x.t) {
+				k = x.k * f.constInt(y)
+			} else {
+				k = f.constInt(x) * y.k
+			}
+		}
+		if t.Class == st.TimeClass && t.Bits < 64 {
+			k -= k % int64(time.Millisecond)
+		}
+		return val{c: intLit(k, st.TypeLInt), t: t, konst: true, k: k}
+	}
+	var r string
+	aligned := f.msAligned(x) && f.msAligned(y)
+	switch op {
+	case "+", "-":
+		r = "(" + ns(x) + " " + op + " " + ns(y) + ")"
+	case "*", "/":
+		d, k := x, y
+		if !isTime(d.t) {
+			d, k = y, x
+		}
+		switch {
+		case k.t.Class == st.RealClass && op == "*":
+			r = "iec_trunc((double)" + d.c + " * " + f.toFloat(k) + ")"
+			aligned = false
+		case k.t.Class == st.RealClass:
+			r = "iec_trunc((double)" + d.c + " * iec_recip(" + f.toFloat(k) + "))"
+			aligned = false
+		case op == "*":
+			r = "(" + d.c + " * " + f.toInt(k) + ")"
+			aligned = f.msAligned(d)
+		default:
+			divisor := f.toInt(k)
+			if isTime(k.t) {
+				divisor = k.c
+			}
+			r = "iec_div(" + d.c + ", " + divisor + ")"
+			aligned = false
+		}
+	default:
+		f.errorf(n, "operator %s not defined on %s", op, t.Name)
+		return bad
+	}
+	if t.Class == st.TimeClass && t.Bits < 64 && !aligned {
+		r = "iec_ms(" + r + ")"
+	}
+	return val{c: r, t: t}
+}
+
+// msAligned reports whether v is known to be whole milliseconds: TIME
+// variables always are, as every store cuts them.
+func (f *fn) msAligned(v val) bool {
+	switch {
+	case v.konst && isTime(v.t):
+		return v.k%int64(time.Millisecond) == 0
+	case v.konst:
+		return true
+	case isTime(v.t):
+		return v.t.Bits < 64
+	}
+	return isInt(v.t)
+}
+
+// compare writes a comparison with the C operator op, ordering like the
+// interpreter: strings by bytes, reals as LREAL, TIME against plain
+// numbers in milliseconds, the other values by their integer value.
+func (f *fn) compare(n st.Node, op string, x, y val) string {
+	switch {
+	case x.t.Class == st.PointerClass || y.t.Class == st.PointerClass:
+		ptr := func(v val) string {
+			if v.konst && v.k == 0 {
+				return "NULL"
+			}
+			return "(const void *)" + v.c
+		}
+		if op != "==" && op != "!=" {
+			break
+		}
+		return "(" + ptr(x) + " " + op + " " + ptr(y) + ")"
+	case x.t.Class == st.StringClass && y.t.Class == st.StringClass:
+		return "(strcmp(" + x.c + ", " + y.c + ") " + op + " 0)"
+	case x.t.Class == st.RealClass && y.t.Class == st.RealClass:
+		return "(" + x.c + " " + op + " " + y.c + ")"
+	case x.t.Class == st.RealClass || y.t.Class == st.RealClass:
+		if x.t.Class == st.StringClass || y.t.Class == st.StringClass {
+			break
+		}
+		return "(" + f.toFloat(x) + " " + op + " " + f.toFloat(y) + ")"
+	case isTime(x.t) || isTime(y.t):
+		ord := func(v, other val) string {
+			switch {
+			case isTime(v.t):
+				return v.c
+			case v.konst && isTime(other.t):
+				return intLit(f.constInt(v)*int64(time.Millisecond), st.TypeLInt)
+			}
+			return "(" + f.toInt(v) + " * IEC_MS)"
+		}
+		if !isTime(x.t) && !isInt(x.t) || !isTime(y.t) && !isInt(y.t) {
+			break
+		}
+		return "(" + ord(x, y) + " " + op + " " + ord(y, x) + ")"
+	case isInt(x.t) && isInt(y.t):
+		if x.konst != y.konst {
+			v, k, vop := x, y, op
+			if x.konst {
+				v, k, vop = y, x, mirror[op]
+			}
+			if r, ok := fixedCompare(v.t, vop, f.constInt(k)); ok {
+				if simpleRe.MatchString(v.c) {
+					return strconv.FormatBool(r)
+				}
+				return fmt.Sprintf("((void)%s, %t)", paren(v.c), r)
+			}
+		}
+		ux, uy := unsigned64(x.t), unsigned64(y.t)
+		bx, sx := intInfo(x.t)
+		by, sy := intInfo(y.t)
+		switch {
+		case ux && uy:
+		case ux || uy:
+			return "(" + f.toInt(x) + " " + op + " " + f.toInt(y) + ")"
+		case sx != sy && (bx >= 32 || by >= 32) && !(x.konst && x.k >= 0) && !(y.konst && y.k >= 0):
+			// C would compare in unsigned int
+			return "(" + f.i64(x) + " " + op + " " + f.i64(y) + ")"
+		}
+		return "(" + x.c + " " + op + " " + y.c + ")"
+	}
+	f.errorf(n, "cannot compare %s with %s", x.t.Name, y.t.Name)
+	return "false"
+}
+
+// ── Conversions ───────────────────────────────────────────────────────────────
+
+// constInt returns the value of a constant as toInt reads it.
+func (f *fn) constInt(v val) int64 {
+	switch {
+	case v.t.Class == st.TimeClass && v.t.Bits < 64:
+		return v.k / int64(time.Millisecond)
+	case v.t.Class == st.DateClass && v.t.Bits < 64:
+		if v.t == st.TypeTOD {
+			return v.k / int64(time.Millisecond)
+		}
+		return v.k / int64(time.Second)
+	}
+	return v.k
+}
+
+// toInt writes v as an int64_t, as REAL_TO_LINT and TIME_TO_LINT convert.
+func (f *fn) toInt(v val) string {
+	if v.konst {
+		return intLit(f.constInt(v), st.TypeLInt)
+	}
+	switch v.t.Class {
+	case st.RealClass:
+		return "iec_round(" + v.c + ")"
+	case st.TimeClass:
+		if v.t.Bits == 64 {
+			return v.c
+		}
+		return "(" + v.c + " / IEC_MS)"
+	case st.DateClass:
+		switch {
+		case v.t.Bits == 64:
+			return v.c
+		case v.t == st.TypeTOD:
+			return "(" + v.c + " / IEC_MS)"
+		}
+		return "(" + v.c + " / IEC_S)"
+	case st.StringClass:
+		return "iec_parse_int(" + v.c + ")"
+	case st.PointerClass:
+		f.errorf(nil, "pointer arithmetic is not supported")
+		return "0"
+	}
+	if !isInt(v.t) {
+		f.errorf(nil, "%s is not a number", v.t.Name)
+		return "0"
+	}
+	if unsigned64(v.t) {
+		return "(int64_t)" + v.c
+	}
+	return v.c
+}
+
+// i64 writes an integer-like v as int64_t for comparisons.
+func (f *fn) i64(v val) string {
+	if v.konst {
+		return intLit(v.k, st.TypeLInt)
+	}
+	return "(int64_t)" + v.c
+}
+
+// u64 writes v as a uint64_t, the type integer arithmetic is done in.
+func (f *fn) u64(v val) string {
+	if v.konst {
+		return "(uint64_t)" + intLit(f.constInt(v), st.TypeLInt)
+	}
+	if isInt(v.t) {
+		return "(uint64_t)" + v.c
+	}
+	return "(uint64_t)" + f.toInt(v)
+}
+
+// toFloat writes v as a double.
+func (f *fn) toFloat(v val) string {
+	switch {
+	case v.konst && unsigned64(v.t):
+		return realLit(float64(uint64(v.k)), st.TypeLReal)
+	case v.konst:
+		return realLit(float64(f.constInt(v)), st.TypeLReal)
+	case v.t.Class == st.RealClass:
+		if v.t.Bits == 32 {
+			return "(double)" + v.c
+		}
+		return v.c
+	case v.t.Class == st.StringClass:
+		return "iec_parse_real(" + v.c + ")"
+	case unsigned64(v.t) && isInt(v.t):
+		return "(double)" + v.c
+	}
+	return "(double)" + f.toInt(v)
+}
+
+// truth writes a BOOL condition.
+func (f *fn) truth(v val) string {
+	switch {
+	case v.t.Class == st.BoolClass:
+		return v.c
+	case v.konst:
+		return intLit(v.k, st.TypeBool)
+	case v.t.Class == st.StringClass || v.t.Class == st.PointerClass || isComposite(v.t):
+		f.errorf(nil, "%s is not a BOOL", v.t.Name)
+		return "false"
+	}
+	return "(" + v.c + " != 0)"
+}
+
+func isComposite(t *st.Type) bool {
+	return t.Class == st.ArrayClass || t.Class == st.StructClass || t.Class == st.InstanceClass
+}
+
+// fits reports whether every value of the integer type from is a value of
+// the integer type to, so C's implicit conversion suffices.
+func fits(from, to *st.Type) bool {
+	if from.Class == st.BoolClass {
+		return true
+	}
+	fb, fs := intInfo(from)
+	tb, ts := intInfo(to)
+	if fs == ts {
+		return fb <= tb
+	}
+	return !fs && ts && fb < tb
+}
+
+// conv writes v converted to type t, as the interpreter's convert does:
+// integers wrap, reals round, TIME counts milliseconds and STRINGs are
+// produced as const char *.
+func (f *fn) conv(v val, t *st.Type) string {
+	if v.konst {
+		if c, ok := f.constConv(v, t); ok {
+			return c
+		}
+	}
+	if v.t == t || st.Identical(v.t, t) && t.Class != st.StringClass {
+		return v.c
+	}
+	switch t.Class {
+	case st.BoolClass:
+		return f.truth(v)
+	case st.IntClass, st.BitsClass, st.EnumClass, st.CharClass:
+		if isInt(v.t) && fits(v.t, t) {
+			return v.c
+		}
+		return wrapFunc(t) + "(" + f.u64(v) + ")"
+	case st.RealClass:
+		if v.t.Class == st.RealClass && (v.t.Bits == t.Bits || t.Bits == 64) {
+			return v.c
+		}
+		if t.Bits == 32 {
+			return "(IEC_REAL)" + paren(f.toFloat(v))
+		}
+		return f.toFloat(v)
+	case st.StringClass:
+		return f.str(v)
+	case st.TimeClass:
+		var ns string
+		aligned := false
+		switch {
+		case isTime(v.t):
+			ns = v.c
+			aligned = v.t.Bits < 64
+		case v.t.Class == st.RealClass && t.Bits == 64:
+			ns = "iec_trunc(" + f.toFloat(v) + ")"
+		case v.t.Class == st.RealClass:
+			ns = "iec_trunc(" + f.toFloat(v) + " * 1e6)"
+		case t.Bits == 64:
+			ns = f.toInt(v)
+		default:
+			ns = "(" + f.toInt(v) + " * IEC_MS)"
+			aligned = true
+		}
+		if t.Bits < 64 && !aligned {
+			return "iec_ms(" + ns + ")"
+		}
+		return ns
+	case st.DateClass:
+		if isTime(v.t) {
+			return v.c
+		}
+		switch {
+		case t.Bits == 64:
+			return f.toInt(v)
+		case t == st.TypeTOD:
+			return "(" + f.toInt(v) + " * IEC_MS)"
+		}
+		return "(" + f.toInt(v) + " * IEC_S)"
+	case st.PointerClass:
+		if v.t.Class == st.PointerClass {
+			if st.Identical(v.t.Elem, t.Elem) {
+				return v.c
+			}
+			return "(" + f.g.decl(t.Elem, "*") + ")" + v.c
+		}
+		f.errorf(nil, "cannot convert %s to a pointer", v.t.Name)
+		return "NULL"
+	case st.StructClass, st.InstanceClass:
+		if v.t.Class == t.Class && v.t != t {
+			var path strings.Builder
+			for x := v.t.Base; x != nil; x = x.Base {
+				path.WriteString("base.")
+				if x == t {
+					return f.memberOf(v.c, strings.TrimSuffix(path.String(), "."))
+				}
+			}
+		}
+	}
+	return v.c
+}
+
+// constConv converts a constant at translation time.
+func (f *fn) constConv(v val, t *st.Type) (string, bool) {
+	n := f.constInt(v)
+	switch t.Class {
+	case st.BoolClass:
+		return intLit(n, t), true
+	case st.IntClass, st.BitsClass, st.CharClass:
+		return intLit(wrap(n, t), t), true
+	case st.EnumClass:
+		n = wrap(n, t)
+		if t.Decl != nil {
+			for _, m := range t.Members {
+				if m.Value == n {
+					return cname(t.Decl.Name.Name) + "__" + m.Name, true
+				}
+			}
+		}
+		return intLit(n, t), true
+	case st.RealClass:
+		x := float64(n)
+		if unsigned64(v.t) {
+			x = float64(uint64(n))
+		}
+		if t.Bits == 32 {
+			x = float64(float32(x))
+		}
+		return realLit(x, t), true
+	case st.TimeClass:
+		ns := n * int64(time.Millisecond)
+		switch {
+		case isTime(v.t):
+			ns = v.k
+		case t.Bits == 64:
+			ns = n
+		}
+		if t.Bits < 64 {
+			ns -= ns % int64(time.Millisecond)
+		}
+		return intLit(ns, st.TypeLInt), true
+	case st.DateClass:
+		switch {
+		case isTime(v.t):
+			return intLit(v.k, st.TypeLInt), true
+		case t.Bits == 64:
+			return intLit(n, st.TypeLInt), true
+		case t == st.TypeTOD:
+			return intLit(n*int64(time.Millisecond), st.TypeLInt), true
+		}
+		return intLit(n*int64(time.Second), st.TypeLInt), true
+	case st.PointerClass:
+		if n == 0 {
+			return "NULL", true
+		}
+	case st.StringClass:
+		if !isTime(v.t) && v.t.Class != st.EnumClass {
+			s := strconv.FormatInt(n, 10)
+			switch {
+			case v.t.Class == st.BoolClass:
+				s = map[bool]string{true: "TRUE", false: "FALSE"}[n != 0]
+			case unsigned64(v.t):
+				s = strconv.FormatUint(uint64(n), 10)
+			case v.t.Class == st.CharClass:
+				s = string(rune(n))
+			}
+			return cString(s), true
+		}
+	}
+	return "", false
+}
+
+// str writes v as a const char *, converting like the X_TO_STRING
+// functions into a buffer declared for it.
+func (f *fn) str(v val) string {
+	if v.t.Class == st.StringClass {
+		return v.c
+	}
+	if v.konst {
+		if c, ok := f.constConv(v, st.StringOf(st.DefaultStringLen, false)); ok {
+			return c
+		}
+	}
+	buf := func() string { return f.temp("char %s[IEC_STRLEN + 1]") }
+	switch {
+	case v.t.Class == st.BoolClass:
+		return "(" + v.c + " ? \"TRUE\" : \"FALSE\")"
+	case v.t.Class == st.RealClass:
+		single := 0
+		if v.t.Bits == 32 {
+			single = 1
+		}
+		return fmt.Sprintf("iec_str_real(%s, %s, %d)", buf(), v.c, single)
+	case v.t.Class == st.CharClass:
+		return fmt.Sprintf("iec_str_char(%s, %s)", buf(), v.c)
+	case v.t.Class == st.TimeClass:
+		wide := 0
+		if v.t.Bits == 64 {
+			wide = 1
+		}
+		return fmt.Sprintf("iec_str_time(%s, %s, %d)", buf(), v.c, wide)
+	case v.t.Class == st.DateClass:
+		switch v.t {
+		case st.TypeTOD, st.TypeLTOD:
+			return fmt.Sprintf("iec_str_tod(%s, %s)", buf(), v.c)
+		case st.TypeDate, st.TypeLDate:
+			return fmt.Sprintf("iec_str_date(%s, %s)", buf(), v.c)
+		}
+		return fmt.Sprintf("iec_str_dt(%s, %s)", buf(), v.c)
+	case unsigned64(v.t) && isInt(v.t):
+		return fmt.Sprintf("iec_str_uint(%s, %s)", buf(), v.c)
+	case isInt(v.t):
+		return fmt.Sprintf("iec_str_int(%s, %s)", buf(), v.c)
+	}
+	f.errorf(nil, "cannot convert %s to STRING", v.t.Name)
+	return `""`
+}
+
+// sizeOf returns the storage size of a type in bytes, without padding, as
+// SIZEOF on the PLC and in the interpreter reports it.
+func sizeOf(t *st.Type) int64 {
+	switch t.Class {
+	case st.BoolClass:
+		return 1
+	case st.StringClass:
+		if t.Wide {
+			return 2 * int64(t.Len+1)
+		}
+		return int64(t.Len + 1)
+	case st.ArrayClass:
+		n := int64(1)
+		for _, d := range t.Dims {
+			n *= d.Len()
+		}
+		return n * sizeOf(t.Elem)
+	case st.StructClass, st.InstanceClass:
+		var n int64
+		for x := t; x != nil; x = x.Base {
+			for _, fld := range x.Fields {
+				n += sizeOf(fld.Type)
+			}
+		}
+		return n
+	case st.EnumClass:
+		bits, _ := intInfo(t)
+		return int64(bits / 8)
+	case st.PointerClass:
+		return 8
+	}
+	return int64(t.Bits / 8)
+}
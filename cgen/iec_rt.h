@@ -0,0 +1,684 @@
+/*
+ * iec_rt.h — runtime of C code generated by iecst transpile.
+ *
+ * Elementary IEC 61131-3 types, the wrap-around and conversion rules of the
+ * PLC, string handling and the standard function blocks. Everything is
+ * static inline, so the header needs no library of its own; the generated
+ * .c file defines iec_now and, unless IEC_NO_DEFAULT_TRAP is defined,
+ * iec_trap.
+ *
+ * Integer arithmetic is done in uint64_t, where overflow is defined, and
+ * narrowed to the result type, so INT 32767 + 1 is -32768 as on the PLC.
+ * Narrowing to a signed type assumes two's complement, as every supported
+ * compiler implements it.
+ */
+#ifndef IEC_RT_H
+#define IEC_RT_H
+
+#include <math.h>
+#include <stdarg.h>
+#include <stdbool.h>
+#include <stddef.h>
+#include <stdint.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+
+/* ── Elementary types ─────────────────────────────────────────────────────── */
+
+typedef bool IEC_BOOL;
+typedef uint8_t IEC_BYTE;
+typedef uint16_t IEC_WORD;
+typedef uint32_t IEC_DWORD;
+typedef uint64_t IEC_LWORD;
+typedef int8_t IEC_SINT;
+typedef int16_t IEC_INT;
+typedef int32_t IEC_DINT;
+typedef int64_t IEC_LINT;
+typedef uint8_t IEC_USINT;
+typedef uint16_t IEC_UINT;
+typedef uint32_t IEC_UDINT;
+typedef uint64_t IEC_ULINT;
+typedef float IEC_REAL;
+typedef double IEC_LREAL;
+typedef uint8_t IEC_CHAR;
+
+/* TIME and the date types count nanoseconds: TIME, LTIME and the times of
+ * day since midnight, DATE and DT since 1970-01-01. */
+typedef int64_t IEC_TIME;
+typedef int64_t IEC_LTIME;
+typedef int64_t IEC_DATE;
+typedef int64_t IEC_TOD;
+typedef int64_t IEC_DT;
+typedef int64_t IEC_LDATE;
+typedef int64_t IEC_LTOD;
+typedef int64_t IEC_LDT;
+
+/* STRING without a length holds 80 characters plus the terminating NUL. */
+#define IEC_STRLEN 80
+
+#define IEC_MS INT64_C(1000000)
+#define IEC_S INT64_C(1000000000)
+
+/* iec_now is the clock the timers read, in nanoseconds. The host advances
+ * it between cycles. */
+extern IEC_TIME iec_now;
+
+/* iec_trap reports a run-time error — division by zero, an array index out
+ * of range, a null pointer — and must not return. The default prints the
+ * message and aborts, which libFuzzer reports as a crash; define
+ * IEC_NO_DEFAULT_TRAP and provide your own to handle errors differently. */
+void iec_trap(const char *msg);
+
+/* ── Integer wrap-around ──────────────────────────────────────────────────── */
+
+static inline int8_t iec_s8(uint64_t x) { return (int8_t)(uint8_t)x; }
+static inline int16_t iec_s16(uint64_t x) { return (int16_t)(uint16_t)x; }
+static inline int32_t iec_s32(uint64_t x) { return (int32_t)(uint32_t)x; }
+static inline int64_t iec_s64(uint64_t x) { return (int64_t)x; }
+static inline uint8_t iec_u8(uint64_t x) { return (uint8_t)x; }
+static inline uint16_t iec_u16(uint64_t x) { return (uint16_t)x; }
+static inline uint32_t iec_u32(uint64_t x) { return (uint32_t)x; }
+static inline uint64_t iec_u64(uint64_t x) { return x; }
+
+static inline int64_t iec_div(int64_t a, int64_t b)
+{
+    if (b == 0)
+        iec_trap("integer division by zero");
+    if (b == -1)
+        return iec_s64(-(uint64_t)a);
+    return a / b;
+}
+
+static inline int64_t iec_mod(int64_t a, int64_t b)
+{
+    if (b == 0)
+        iec_trap("integer division by zero");
+    if (b == -1)
+        return 0;
+    return a % b;
+}
+
+static inline uint64_t iec_udiv(uint64_t a, uint64_t b)
+{
+    if (b == 0)
+        iec_trap("integer division by zero");
+    return a / b;
+}
+
+static inline uint64_t iec_umod(uint64_t a, uint64_t b)
+{
+    if (b == 0)
+        iec_trap("integer division by zero");
+    return a % b;
+}
+
+/* iec_recip returns 1 / f for TIME / REAL, which multiplies by it. */
+static inline double iec_recip(double f)
+{
+    if (f == 0)
+        iec_trap("division by zero");
+    return 1 / f;
+}
+
+static inline int64_t iec_abs(int64_t n) { return n < 0 ? iec_s64(-(uint64_t)n) : n; }
+
+/* ── Conversions ──────────────────────────────────────────────────────────── */
+
+/* iec_round converts a real to an integer as REAL_TO_INT does: to the
+ * nearest, halves away from zero, saturating; NaN gives 0. */
+static inline int64_t iec_round(double f)
+{
+    if (isnan(f))
+        return 0;
+    f = round(f);
+    if (f >= 9223372036854775807.0)
+        return INT64_MAX;
+    if (f <= -9223372036854775808.0)
+        return INT64_MIN;
+    return (int64_t)f;
+}
+
+/* iec_trunc converts a real to an integer towards zero, saturating. */
+static inline int64_t iec_trunc(double f)
+{
+    if (isnan(f))
+        return 0;
+    f = trunc(f);
+    if (f >= 9223372036854775807.0)
+        return INT64_MAX;
+    if (f <= -9223372036854775808.0)
+        return INT64_MIN;
+    return (int64_t)f;
+}
+
+/* iec_ms cuts a duration to whole milliseconds, the resolution of TIME. */
+static inline int64_t iec_ms(int64_t ns) { return ns - ns % IEC_MS; }
+
+static inline int64_t iec_to_bcd(int64_t n)
+{
+    int64_t r = 0;
+    int shift = 0;
+    for (; n > 0; n /= 10, shift += 4)
+        r |= (n % 10) << shift;
+    return r;
+}
+
+static inline int64_t iec_from_bcd(int64_t n)
+{
+    int64_t r = 0, mul = 1;
+    for (; n > 0; n >>= 4, mul *= 10)
+        r += (n & 0xF) * mul;
+    return r;
+}
+
+/* ── Bits and shifts ──────────────────────────────────────────────────────── */
+
+static inline bool iec_bit(uint64_t x, int n) { return (x >> n & 1) != 0; }
+
+static inline uint64_t iec_setbit(uint64_t x, int n, bool b)
+{
+    return b ? x | UINT64_C(1) << n : x & ~(UINT64_C(1) << n);
+}
+
+static inline uint64_t iec_mask(int bits) { return bits >= 64 ? UINT64_MAX : (UINT64_C(1) << bits) - 1; }
+
+static inline uint64_t iec_shl(uint64_t n, int64_t k, int bits)
+{
+    if (k < 0 || k >= bits)
+        return 0;
+    return n << k & iec_mask(bits);
+}
+
+static inline uint64_t iec_shr(uint64_t n, int64_t k, int bits)
+{
+    if (k < 0 || k >= bits)
+        return 0;
+    return (n & iec_mask(bits)) >> k;
+}
+
+static inline uint64_t iec_rol(uint64_t n, int64_t k, int bits)
+{
+    uint64_t u = n & iec_mask(bits);
+    k %= bits;
+    if (k < 0)
+        k += bits;
+    if (k == 0)
+        return u;
+    return (u << k | u >> (bits - k)) & iec_mask(bits);
+}
+
+static inline uint64_t iec_ror(uint64_t n, int64_t k, int bits)
+{
+    k %= bits;
+    if (k < 0)
+        k += bits;
+    return iec_rol(n, (bits - k) % bits, bits);
+}
+
+/* ── Arrays and pointers ──────────────────────────────────────────────────── */
+
+/* iec_idx checks an array index against the bounds lo..hi and returns the
+ * C index. */
+static inline size_t iec_idx(int64_t i, int64_t lo, int64_t hi)
+{
+    if (i < lo || i > hi)
+        iec_trap("array index out of range");
+    return (size_t)(i - lo);
+}
+
+/* IEC_DEREF dereferences a pointer, trapping on NULL. */
+#define IEC_DEREF(p) (*((p) ? (p) : (iec_trap("null pointer dereference"), (p))))
+
+/* ── Strings ──────────────────────────────────────────────────────────────── */
+
+/* Strings are NUL-terminated char arrays of their declared length plus one.
+ * The string functions write into a buffer of IEC_STRLEN + 1 characters,
+ * supplied by the generated code, and return it. */
+
+static inline char *iec_strset(char *dst, size_t n, const char *src)
+{
+    size_t len = strlen(src);
+    if (len > n)
+        len = n;
+    memmove(dst, src, len);
+    dst[len] = 0;
+    return dst;
+}
+
+static inline int64_t iec_clip(int64_t i, int64_t len) { return i < 0 ? 0 : i > len ? len : i; }
+
+static inline char *iec_cat(char *dst, const char *s, int64_t n)
+{
+    size_t len = strlen(dst);
+    if (n < 0)
+        n = 0;
+    if ((int64_t)len + n > IEC_STRLEN)
+        n = IEC_STRLEN - (int64_t)len;
+    memcpy(dst + len, s, (size_t)n);
+    dst[len + (size_t)n] = 0;
+    return dst;
+}
+
+static inline char *iec_left(char *dst, const char *s, int64_t l)
+{
+    dst[0] = 0;
+    return iec_cat(dst, s, iec_clip(l, (int64_t)strlen(s)));
+}
+
+static inline char *iec_right(char *dst, const char *s, int64_t l)
+{
+    int64_t len = (int64_t)strlen(s), n = iec_clip(l, len);
+    dst[0] = 0;
+    return iec_cat(dst, s + len - n, n);
+}
+
+static inline char *iec_mid(char *dst, const char *s, int64_t l, int64_t p)
+{
+    int64_t len = (int64_t)strlen(s), from = iec_clip(p - 1, len);
+    dst[0] = 0;
+    return iec_cat(dst, s + from, iec_clip(from + (l < 0 ? 0 : l), len) - from);
+}
+
+static inline char *iec_concat(char *dst, int n, ...)
+{
+    va_list ap;
+    dst[0] = 0;
+    va_start(ap, n);
+    while (n-- > 0) {
+        const char *s = va_arg(ap, const char *);
+        iec_cat(dst, s, (int64_t)strlen(s));
+    }
+    va_end(ap);
+    return dst;
+}
+
+static inline char *iec_insert(char *dst, const char *s, const char *ins, int64_t p)
+{
+    int64_t at = iec_clip(p, (int64_t)strlen(s));
+    dst[0] = 0;
+    iec_cat(dst, s, at);
+    iec_cat(dst, ins, (int64_t)strlen(ins));
+    return iec_cat(dst, s + at, (int64_t)strlen(s + at));
+}
+
+static inline char *iec_delete(char *dst, const char *s, int64_t l, int64_t p)
+{
+    int64_t len = (int64_t)strlen(s), from = iec_clip(p - 1, len);
+    int64_t to = iec_clip(from + (l < 0 ? 0 : l), len);
+    dst[0] = 0;
+    iec_cat(dst, s, from);
+    return iec_cat(dst, s + to, len - to);
+}
+
+static inline char *iec_replace(char *dst, const char *s, const char *rep, int64_t l, int64_t p)
+{
+    int64_t len = (int64_t)strlen(s), from = iec_clip(p - 1, len);
+    int64_t to = iec_clip(from + (l < 0 ? 0 : l), len);
+    dst[0] = 0;
+    iec_cat(dst, s, from);
+    iec_cat(dst, rep, (int64_t)strlen(rep));
+    return iec_cat(dst, s + to, len - to);
+}
+
+static inline int64_t iec_find(const char *s, const char *sub)
+{
+    const char *p = strstr(s, sub);
+    return p ? (int64_t)(p - s) + 1 : 0;
+}
+
+/* ── Conversions to and from text ─────────────────────────────────────────── */
+
+static inline char *iec_str_int(char *dst, int64_t n)
+{
+    snprintf(dst, IEC_STRLEN + 1, "%lld", (long long)n);
+    return dst;
+}
+
+static inline char *iec_str_uint(char *dst, uint64_t n)
+{
+    snprintf(dst, IEC_STRLEN + 1, "%llu", (unsigned long long)n);
+    return dst;
+}
+
+static inline char *iec_str_char(char *dst, unsigned c)
+{
+    dst[0] = (char)c;
+    dst[1] = 0;
+    return dst;
+}
+
+/* iec_str_real writes the shortest text that reads back as the same REAL
+ * (single) or LREAL, in exponent form outside 1e-4 .. 1e6: 0.1, 1.5e+07. */
+static inline char *iec_str_real(char *dst, double f, int single)
+{
+    char buf[40];
+    int prec, exp;
+    if (isnan(f))
+        return strcpy(dst, "NaN");
+    if (isinf(f))
+        return strcpy(dst, f > 0 ? "+Inf" : "-Inf");
+    for (prec = 1; prec < 17; prec++) {
+        snprintf(buf, sizeof buf, "%.*e", prec - 1, f);
+        if (single ? strtof(buf, NULL) == (float)f : strtod(buf, NULL) == f)
+            break;
+    }
+    snprintf(buf, sizeof buf, "%.*e", prec - 1, f);
+    exp = atoi(strchr(buf, 'e') + 1);
+    if (exp < -4 || exp >= 6)
+        snprintf(dst, IEC_STRLEN + 1, "%s", buf);
+    else
+        snprintf(dst, IEC_STRLEN + 1, "%.*f", prec - 1 - exp > 0 ? prec - 1 - exp : 0, f);
+    return dst;
+}
+
+/* iec_str_time writes a duration like a TIME literal: T#1h2m3s4ms. */
+static inline char *iec_str_time(char *dst, int64_t ns, int wide)
+{
+    static const struct {
+        const char *name;
+        int64_t ns;
+    } units[] = {{"d", 86400 * IEC_S}, {"h", 3600 * IEC_S}, {"m", 60 * IEC_S}, {"s", IEC_S},
+                 {"ms", IEC_MS}, {"us", 1000}, {"ns", 1}};
+    uint64_t d = ns < 0 ? -(uint64_t)ns : (uint64_t)ns;
+    size_t i;
+    strcpy(dst, wide ? "LTIME#" : "T#");
+    if (ns == 0)
+        return strcat(dst, "0ms");
+    if (ns < 0)
+        strcat(dst, "-");
+    for (i = 0; i < sizeof units / sizeof units[0]; i++) {
+        uint64_t n = d / (uint64_t)units[i].ns;
+        if (n > 0) {
+            size_t len = strlen(dst);
+            snprintf(dst + len, IEC_STRLEN + 1 - len, "%llu%s", (unsigned long long)n, units[i].name);
+            d -= n * (uint64_t)units[i].ns;
+        }
+    }
+    return dst;
+}
+
+/* iec_civil splits days since 1970-01-01 into year, month and day. */
+static inline void iec_civil(int64_t days, int64_t *y, int *m, int *d)
+{
+    int64_t z = days + 719468, era = (z >= 0 ? z : z - 146096) / 146097;
+    int64_t doe = z - era * 146097;
+    int64_t yoe = (doe - doe / 1460 + doe / 36524 - doe / 146096) / 365;
+    int64_t doy = doe - (365 * yoe + yoe / 4 - yoe / 100);
+    int64_t mp = (5 * doy + 2) / 153;
+    *d = (int)(doy - (153 * mp + 2) / 5 + 1);
+    *m = (int)(mp < 10 ? mp + 3 : mp - 9);
+    *y = yoe + era * 400 + (*m <= 2);
+}
+
+static inline int64_t iec_floordiv(int64_t a, int64_t b) { return a / b - (a % b != 0 && (a < 0) != (b < 0)); }
+
+static inline char *iec_str_date(char *dst, int64_t ns)
+{
+    int64_t y;
+    int m, d;
+    iec_civil(iec_floordiv(ns, 86400 * IEC_S), &y, &m, &d);
+    snprintf(dst, IEC_STRLEN + 1, "D#%04lld-%02d-%02d", (long long)y, m, d);
+    return dst;
+}
+
+static inline char *iec_str_dt(char *dst, int64_t ns)
+{
+    int64_t y, days = iec_floordiv(ns, 86400 * IEC_S), secs = iec_floordiv(ns, IEC_S) - days * 86400;
+    int m, d;
+    iec_civil(days, &y, &m, &d);
+    snprintf(dst, IEC_STRLEN + 1, "DT#%04lld-%02d-%02d-%02d:%02d:%02d", (long long)y, m, d,
+             (int)(secs / 3600), (int)(secs / 60 % 60), (int)(secs % 60));
+    return dst;
+}
+
+static inline char *iec_str_tod(char *dst, int64_t ns)
+{
+    int64_t day = 86400 * IEC_S, t = ns % day, secs, ms;
+    size_t len;
+    if (t < 0)
+        t += day;
+    secs = t / IEC_S;
+    ms = t % IEC_S / IEC_MS;
+    snprintf(dst, IEC_STRLEN + 1, "TOD#%02d:%02d:%02d.%03d", (int)(secs / 3600), (int)(secs / 60 % 60),
+             (int)(secs % 60), (int)ms);
+    len = strlen(dst);
+    while (dst[len - 1] == '0')
+        dst[--len] = 0;
+    if (dst[len - 1] == '.')
+        dst[--len] = 0;
+    return dst;
+}
+
+/* iec_parse_real reads a number from text, 0 if the text is not one. */
+static inline double iec_parse_real(const char *s)
+{
+    char *end;
+    double f;
+    while (*s == ' ' || *s == '\t' || *s == '\r' || *s == '\n')
+        s++;
+    f = strtod(s, &end);
+    if (end == s)
+        return 0;
+    while (*end == ' ' || *end == '\t' || *end == '\r' || *end == '\n')
+        end++;
+    return *end ? 0 : f;
+}
+
+/* iec_parse_int reads an integer from text as STRING_TO_INT does: decimal
+ * or 2#, 8#, 16# with optional underscores, else a rounded real, else 0. */
+static inline int64_t iec_parse_int(const char *s)
+{
+    char buf[IEC_STRLEN + 1];
+    size_t n = 0;
+    const char *p = s;
+    int neg = 0, base = 10, digits = 0;
+    uint64_t u = 0;
+    while (*p == ' ' || *p == '\t' || *p == '\r' || *p == '\n')
+        p++;
+    for (; *p && n < IEC_STRLEN; p++)
+        if (*p != '_')
+            buf[n++] = *p;
+    while (n > 0 && (buf[n - 1] == ' ' || buf[n - 1] == '\t' || buf[n - 1] == '\r' || buf[n - 1] == '\n'))
+        n--;
+    buf[n] = 0;
+    p = buf;
+    if (*p == '-' || *p == '+')
+        neg = *p++ == '-';
+    if ((p[0] == '2' || p[0] == '8') && p[1] == '#')
+        base = p[0] - '0', p += 2;
+    else if (p[0] == '1' && p[1] == '6' && p[2] == '#')
+        base = 16, p += 3;
+    for (; *p; p++, digits++) {
+        int d = *p >= '0' && *p <= '9' ? *p - '0' : *p >= 'a' && *p <= 'f' ? *p - 'a' + 10
+              : *p >= 'A' && *p <= 'F' ? *p - 'A' + 10 : 99;
+        if (d >= base || u > (UINT64_MAX - (uint64_t)d) / (uint64_t)base)
+            break;
+        u = u * (uint64_t)base + (uint64_t)d;
+    }
+    if (*p == 0 && digits > 0 && (!neg || u <= (UINT64_C(1) << 63)))
+        return neg ? iec_s64(-u) : iec_s64(u);
+    return iec_round(iec_parse_real(s));
+}
+
+/* ── Standard function blocks ─────────────────────────────────────────────── */
+
+typedef struct TON {
+    IEC_BOOL IN;
+    IEC_TIME PT;
+    IEC_BOOL Q;
+    IEC_TIME ET;
+    IEC_TIME start__;
+    IEC_BOOL running__, prev__;
+} TON;
+
+typedef TON TOF;
+typedef TON TP;
+
+static inline void TON__step(TON *self)
+{
+    IEC_TIME et;
+    if (!self->IN) {
+        self->running__ = false;
+        self->Q = false;
+        self->ET = 0;
+    } else {
+        if (!self->running__) {
+            self->running__ = true;
+            self->start__ = iec_now;
+        }
+        et = iec_now - self->start__ < self->PT ? iec_now - self->start__ : self->PT;
+        self->ET = iec_ms(et);
+        self->Q = et >= self->PT;
+    }
+    self->prev__ = self->IN;
+}
+
+static inline void TOF__step(TOF *self)
+{
+    IEC_TIME et;
+    if (self->IN) {
+        self->running__ = false;
+        self->Q = true;
+        self->ET = 0;
+    } else {
+        if (self->prev__) {
+            self->running__ = true;
+            self->start__ = iec_now;
+        }
+        if (self->running__) {
+            et = iec_now - self->start__ < self->PT ? iec_now - self->start__ : self->PT;
+            self->ET = iec_ms(et);
+            if (et >= self->PT) {
+                self->running__ = false;
+                self->Q = false;
+            }
+        }
+    }
+    self->prev__ = self->IN;
+}
+
+static inline void TP__step(TP *self)
+{
+    IEC_TIME et;
+    if (self->IN && !self->prev__ && !self->running__) {
+        self->running__ = true;
+        self->start__ = iec_now;
+    }
+    if (self->running__) {
+        et = iec_now - self->start__ < self->PT ? iec_now - self->start__ : self->PT;
+        self->ET = iec_ms(et);
+        self->Q = et < self->PT;
+        if (et >= self->PT)
+            self->running__ = false;
+    } else if (!self->IN) {
+        self->ET = 0;
+    }
+    self->prev__ = self->IN;
+}
+
+typedef struct R_TRIG {
+    IEC_BOOL CLK;
+    IEC_BOOL Q;
+    IEC_BOOL M;
+} R_TRIG;
+
+typedef R_TRIG F_TRIG;
+
+static inline void R_TRIG__step(R_TRIG *self)
+{
+    self->Q = self->CLK && !self->M;
+    self->M = self->CLK;
+}
+
+static inline void F_TRIG__step(F_TRIG *self)
+{
+    self->Q = !self->CLK && self->M;
+    self->M = self->CLK;
+}
+
+typedef struct CTU {
+    IEC_BOOL CU;
+    IEC_BOOL RESET;
+    IEC_WORD PV;
+    IEC_BOOL Q;
+    IEC_WORD CV;
+    IEC_BOOL prev__;
+} CTU;
+
+static inline void CTU__step(CTU *self)
+{
+    if (self->RESET)
+        self->CV = 0;
+    else if (self->CU && !self->prev__ && self->CV < 0xFFFF)
+        self->CV++;
+    self->Q = self->CV >= self->PV;
+    self->prev__ = self->CU;
+}
+
+typedef struct CTD {
+    IEC_BOOL CD;
+    IEC_BOOL LOAD;
+    IEC_WORD PV;
+    IEC_BOOL Q;
+    IEC_WORD CV;
+    IEC_BOOL prev__;
+} CTD;
+
+static inline void CTD__step(CTD *self)
+{
+    if (self->LOAD)
+        self->CV = self->PV;
+    else if (self->CD && !self->prev__ && self->CV > 0)
+        self->CV--;
+    self->Q = self->CV <= 0;
+    self->prev__ = self->CD;
+}
+
+typedef struct CTUD {
+    IEC_BOOL CU;
+    IEC_BOOL CD;
+    IEC_BOOL RESET;
+    IEC_BOOL LOAD;
+    IEC_WORD PV;
+    IEC_BOOL QU;
+    IEC_BOOL QD;
+    IEC_WORD CV;
+    IEC_BOOL prev__, prev2__;
+} CTUD;
+
+static inline void CTUD__step(CTUD *self)
+{
+    if (self->RESET) {
+        self->CV = 0;
+    } else if (self->LOAD) {
+        self->CV = self->PV;
+    } else {
+        if (self->CU && !self->prev__ && self->CV < 0xFFFF)
+            self->CV++;
+        if (self->CD && !self->prev2__ && self->CV > 0)
+            self->CV--;
+    }
+    self->QU = self->CV >= self->PV;
+    self->QD = self->CV <= 0;
+    self->prev2__ = self->CD;
+    self->prev__ = self->CU;
+}
+
+typedef struct SR {
+    IEC_BOOL SET1;
+    IEC_BOOL RESET;
+    IEC_BOOL Q1;
+} SR;
+
+static inline void SR__step(SR *self) { self->Q1 = self->SET1 || (!self->RESET && self->Q1); }
+
+typedef struct RS {
+    IEC_BOOL SET;
+    IEC_BOOL RESET1;
+    IEC_BOOL Q1;
+} RS;
+
+static inline void RS__step(RS *self) { self->Q1 = !self->RESET1 && (self->SET || self->Q1); }
+
+#endif /* IEC_RT_H */
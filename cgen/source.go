@@ -0,0 +1,232 @@
+package cgen
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/damischa1/iec-st-tools/st"
+)
+
+// ── Source file ───────────────────────────────────────────────────────────────
+
+// source returns the .c file. The POUs are translated first, since their
+// code decides which statics and dispatch functions the file needs.
+func (g *generator) source() string {
+	var code strings.Builder
+	// section writes what body writes under a heading, or nothing when
+	// body writes nothing.
+	section := func(title string, body func(code *strings.Builder)) {
+		var b strings.Builder
+		body(&b)
+		if b.Len() == 0 {
+			return
+		}
+		fmt.Fprintf(&code, "\n/* ── %s %s */\n", title, strings.Repeat("─", max(3, 72-len([]rune(title)))))
+		code.WriteString(b.String())
+	}
+	section("Data types", func(code *strings.Builder) {
+		for _, td := range g.types {
+			if _, ok := td.Type.(*st.StructType); ok {
+				code.WriteString("\n" + g.structInit(td, g.p.TypeOfDecl(td)))
+			}
+		}
+	})
+	section("Function blocks", func(code *strings.Builder) {
+		for _, d := range g.pous {
+			if d.Kind == st.FunctionBlock {
+				g.writeInstanceCode(code, d)
+			}
+		}
+	})
+	section("Functions", func(code *strings.Builder) {
+		for _, d := range g.pous {
+			if d.Kind == st.Function {
+				code.WriteString("\n" + g.routine(d, nil))
+			}
+		}
+	})
+	section("Programs", func(code *strings.Builder) {
+		for _, d := range g.pous {
+			if d.Kind == st.Program {
+				g.writeInstanceCode(code, d)
+			}
+		}
+	})
+	code.WriteString("\n" + g.plcInit())
+	for _, t := range g.tasks {
+		fmt.Fprintf(&code, "\nvoid %s(void)\n{\n", g.taskFunc(t))
+		for _, pi := range t.programs {
+			fmt.Fprintf(&code, "    %s(&%s);\n", g.stepName(pi.pou), pi.name)
+		}
+		code.WriteString("}\n")
+	}
+	var vnames []string
+	for name := range g.virtuals {
+		vnames = append(vnames, name)
+	}
+	sort.Strings(vnames)
+	section("Method dispatch", func(code *strings.Builder) {
+		for _, name := range vnames {
+			code.WriteString("\n" + g.dispatcher(name, g.virtuals[name]))
+		}
+	})
+
+	var w strings.Builder
+	fmt.Fprintf(&w, "/* %s.c — generated by iecst transpile from Structured Text. Do not edit. */\n", g.name)
+	fmt.Fprintf(&w, "#include \"%s.h\"\n\nIEC_TIME iec_now;\n", g.name)
+	w.WriteString(`
+#ifndef IEC_NO_DEFAULT_TRAP
+void iec_trap(const char *msg)
+{
+    fprintf(stderr, "iec_trap: %s\n", msg);
+    abort();
+}
+#endif
+`)
+	fmt.Fprintf(&w, "\n/* ── Global variables %s */\n\n", strings.Repeat("─", 55))
+	for _, sym := range g.globals {
+		if msg := g.checkType(sym.Type); msg != "" {
+			g.errorf(fileOf(sym), sym.Ident, "%s: %s", sym.Name, msg)
+			continue
+		}
+		c := g.decl(sym.Type, g.globalFor[strings.ToUpper(sym.Name)])
+		if sym.Decl != nil && sym.Decl.At != nil {
+			fmt.Fprintf(&w, "%s; /* AT %s */\n", c, sym.Decl.At.Text)
+			continue
+		}
+		fmt.Fprintf(&w, "%s;\n", c)
+	}
+	for _, pi := range g.programs {
+		fmt.Fprintf(&w, "%s %s;\n", g.pouName(pi.pou), pi.name)
+	}
+	if len(g.staticDef) > 0 {
+		w.WriteString("\n/* VAR_STAT */\n")
+		for _, s := range g.staticDef {
+			w.WriteString(s + "\n")
+		}
+	}
+	if len(vnames) > 0 {
+		w.WriteString("\n")
+		for _, name := range vnames {
+			v := g.virtuals[name]
+			m := g.p.InstanceType(v.fb).Method(v.method)
+			fmt.Fprintf(&w, "static %s;\n", g.signatureSelf(m, name, g.pouName(v.fb)))
+		}
+	}
+	w.WriteString(code.String())
+	return w.String()
+}
+
+// writeInstanceCode writes the init and step functions and the methods of
+// a function block or program.
+func (g *generator) writeInstanceCode(w *strings.Builder, d *st.POU) {
+	w.WriteString("\n" + g.fbInit(d))
+	w.WriteString("\n" + g.fbStep(d))
+	for _, m := range d.Methods {
+		w.WriteString("\n" + g.routine(m, d))
+	}
+}
+
+// plcInit writes <name>_init: the global variables in the order their
+// initial values need them, then the program instances; VAR_STAT start
+// over on the next call.
+func (g *generator) plcInit() string {
+	f := g.newFn(nil, nil, g.p.GlobalScope())
+	byName := map[string]*st.Symbol{}
+	for _, sym := range g.globals {
+		byName[strings.ToUpper(sym.Name)] = sym
+	}
+	state := map[*st.Symbol]int{} // 1 in progress, 2 done
+	var visit func(sym *st.Symbol)
+	visit = func(sym *st.Symbol) {
+		if state[sym] != 0 {
+			if state[sym] == 1 {
+				g.errorf(fileOf(sym), sym.Ident, "initial value of %s depends on itself", sym.Name)
+			}
+			return
+		}
+		state[sym] = 1
+		if sym.Decl != nil && sym.Decl.Init != nil {
+			st.Inspect(sym.Decl.Init, func(n st.Node) bool {
+				if id, ok := n.(*st.Ident); ok {
+					if dep := byName[strings.ToUpper(id.Name)]; dep != nil {
+						visit(dep)
+					}
+				}
+				return true
+			})
+		}
+		state[sym] = 2
+		if g.checkType(sym.Type) != "" {
+			return
+		}
+		f.file = fileOf(sym)
+		t := sym.Type
+		lv := g.globalFor[strings.ToUpper(sym.Name)]
+		if t.Class == st.PointerClass && t.Ref || sym.Decl == nil {
+			f.zero(lv, t)
+			return
+		}
+		f.reset(lv, t, sym.Decl.Init)
+	}
+	for _, sym := range g.globals {
+		visit(sym)
+	}
+	for _, pi := range g.programs {
+		f.line("%s(&%s);", g.initName(pi.pou), pi.name)
+	}
+	for _, flag := range g.staticReset {
+		f.line("%s = false;", flag)
+	}
+	return f.finish("void " + g.name + "_init(void)")
+}
+
+// dispatcher writes the function that calls the method of the function
+// block an instance actually is, found by its class number.
+func (g *generator) dispatcher(name string, v virtual) string {
+	d := v.fb
+	m := g.p.InstanceType(d).Method(v.method)
+	rt := g.resultType(m)
+	var args []string
+	if rt != nil && rt.Class == st.StringClass {
+		args = append(args, "ret__")
+	}
+	args = append(args, "") // self
+	for _, p := range g.params(m) {
+		c := cname(p.name)
+		if p.block == "VAR_INPUT" && (p.t.Class == st.StringClass || p.t.Class == st.ArrayClass) {
+			c += "__in"
+		}
+		args = append(args, c)
+	}
+	selfAt := len(args) - len(g.params(m)) - 1
+	call := func(mx *st.POU) string {
+		owner := g.p.Owner(mx)
+		a := append([]string(nil), args...)
+		a[selfAt] = "self"
+		if owner != d {
+			a[selfAt] = "(" + g.pouName(owner) + " *)self"
+		}
+		c := g.pouName(mx) + "(" + strings.Join(a, ", ") + ")"
+		if rt == nil {
+			return c + ";\n        return;"
+		}
+		return "return " + c + ";"
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "static %s\n{\n", g.signatureSelf(m, name, g.pouName(d)))
+	fmt.Fprintf(&sb, "    switch (self->%sclass__) {\n", g.basePath(d, g.root(d)))
+	xs := g.descendants(d)
+	sort.Slice(xs, func(i, j int) bool { return g.class[xs[i]] < g.class[xs[j]] })
+	for _, x := range xs {
+		mx := g.p.InstanceType(x).Method(v.method)
+		if mx == nil || mx == m {
+			continue
+		}
+		fmt.Fprintf(&sb, "    case %d: /* %s */\n        %s\n", g.class[x], x.Name.Name, call(mx))
+	}
+	fmt.Fprintf(&sb, "    default:\n        %s\n    }\n}\n", call(m))
+	return sb.String()
+}
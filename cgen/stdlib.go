@@ -0,0 +1,323 @@
+package cgen
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/damischa1/iec-st-tools/st"
+)
+
+// ── Standard functions ────────────────────────────────────────────────────────
+
+// stdParams names the parameters of standard functions that have more than
+// IN or IN1, IN2, …, for calls with named arguments (as in package interp).
+var stdParams = map[string][]string{
+	"SEL": {"G", "IN0", "IN1"}, "LIMIT": {"MN", "IN", "MX"}, "MUX": {"K"},
+	"SHL": {"IN", "N"}, "SHR": {"IN", "N"}, "ROL": {"IN", "N"}, "ROR": {"IN", "N"},
+	"LEFT": {"IN", "L"}, "RIGHT": {"IN", "L"}, "MID": {"IN", "L", "P"},
+	"INSERT": {"IN1", "IN2", "P"}, "DELETE": {"IN", "L", "P"}, "REPLACE": {"IN1", "IN2", "L", "P"},
+	"FIND": {"IN1", "IN2"},
+}
+
+// mathFuncs are the C library functions of the numeric standard functions.
+var mathFuncs = map[string]string{
+	"SQRT": "sqrt", "LN": "log", "LOG": "log10", "EXP": "exp",
+	"SIN": "sin", "COS": "cos", "TAN": "tan", "ASIN": "asin", "ACOS": "acos", "ATAN": "atan",
+}
+
+// stdArgs returns the argument expressions of a standard function call in
+// parameter order, nil if they are wrong.
+func (f *fn) stdArgs(e *st.CallExpr, u string) []st.Expr {
+	var out []st.Expr
+	put := func(i int, x st.Expr) {
+		for len(out) <= i {
+			out = append(out, nil)
+		}
+		out[i] = x
+	}
+	for k, a := range e.Args {
+		if a.Output {
+			f.errorf(a.Name, "%s has no outputs", u)
+			return nil
+		}
+		if a.Name == nil {
+			put(k, a.Value)
+			continue
+		}
+		name := strings.ToUpper(a.Name.Name)
+		i := -1
+		for j, p := range stdParams[u] {
+			if p == name {
+				i = j
+			}
+		}
+		if n, err := strconv.Atoi(strings.TrimPrefix(name, "IN")); i < 0 && err == nil && strings.HasPrefix(name, "IN") {
+			i = n - 1
+			if u == "MUX" {
+				i = n + 1
+			}
+		} else if i < 0 && name == "IN" {
+			i = 0
+		}
+		if i < 0 {
+			f.errorf(a.Name, "%s has no parameter %s", u, a.Name.Name)
+			return nil
+		}
+		put(i, a.Value)
+	}
+	for i, x := range out {
+		if x == nil {
+			f.errorf(e, "argument %d of %s is missing", i+1, u)
+			return nil
+		}
+	}
+	return out
+}
+
+// seq builds a C comma expression that evaluates the arguments of a
+// standard function once, in order, into temporaries.
+type seq struct {
+	f     *fn
+	parts []string
+}
+
+// hold returns c, or a temporary of type t holding it when c is not a
+// single operand.
+func (s *seq) hold(c string, t *st.Type) string {
+	if isConstant(c) {
+		return c
+	}
+	decl := s.f.g.decl(t, "%s")
+	if t.Class == st.StringClass {
+		decl = "const char *%s"
+	}
+	tmp := s.f.temp(decl)
+	s.parts = append(s.parts, tmp+" = "+c)
+	return tmp
+}
+
+func (s *seq) then(c string) {
+	s.parts = append(s.parts, c)
+}
+
+func (s *seq) result(c string) string {
+	if len(s.parts) == 0 {
+		return paren(c)
+	}
+	return "(" + strings.Join(s.parts, ", ") + ", " + c + ")"
+}
+
+// stdCall translates a call of a standard function or type conversion,
+// as the interpreter evaluates it.
+func (f *fn) stdCall(e *st.CallExpr, name string) val {
+	u := strings.ToUpper(name)
+	sf, ok := st.LookupStdFunc(u)
+	if !ok {
+		f.errorf(e.Func, "undeclared function %s", name)
+		return bad
+	}
+	exprs := f.stdArgs(e, u)
+	if exprs == nil && len(e.Args) > 0 {
+		return bad
+	}
+	if len(exprs) < sf.MinArgs || sf.MaxArgs >= 0 && len(exprs) > sf.MaxArgs {
+		f.errorf(e, "wrong number of arguments in call of %s", u)
+		return bad
+	}
+	rt := f.scope.TypeOf(e)
+	switch u {
+	case "ADR":
+		x := f.expr(exprs[0])
+		if !x.lv {
+			if x.t != st.TypeBad {
+				f.errorf(exprs[0], "ADR of %s, which is not a variable", st.ExprString(exprs[0]))
+			}
+			return bad
+		}
+		return val{c: "(" + addr(x.c) + ")", t: rt}
+	case "SIZEOF":
+		t := f.scope.TypeOf(exprs[0])
+		if id, ok := exprs[0].(*st.Ident); ok {
+			if sym := f.scope.Lookup(id.Name); sym != nil && sym.Kind == st.TypeSymbol {
+				t = sym.Type
+			}
+		}
+		n := sizeOf(t)
+		return val{c: intLit(n, rt), t: rt, konst: true, k: n}
+	}
+	if rt.Class == st.StringClass && rt.Wide {
+		f.errorf(e, "WSTRING is not supported")
+		return bad
+	}
+	args := make([]val, len(exprs))
+	for i, x := range exprs {
+		args[i] = f.expr(x)
+		if args[i].t == st.TypeBad {
+			return bad
+		}
+	}
+
+	if strings.HasPrefix(u, "TO_") || strings.Contains(u, "_TO_") || strings.HasPrefix(u, "TRUNC_") {
+		x := args[0]
+		var c string
+		switch {
+		case strings.HasPrefix(u, "BCD_TO_"):
+			c = f.conv(val{c: "iec_from_bcd(" + f.toInt(x) + ")", t: st.TypeLInt}, rt)
+		case strings.HasSuffix(u, "_TO_BCD"):
+			c = wrapFunc(rt) + "((uint64_t)iec_to_bcd(" + f.toInt(x) + "))"
+		case strings.HasPrefix(u, "TRUNC_"), x.t.Class == st.RealClass && strings.HasPrefix(u, "TRUNC"):
+			c = f.conv(val{c: "iec_trunc(" + f.toFloat(x) + ")", t: st.TypeLInt}, rt)
+		default:
+			if x.konst && isInt(rt) && rt.Class != st.EnumClass {
+				k := wrap(f.constInt(x), rt)
+				return val{c: intLit(k, rt), t: rt, konst: true, k: k}
+			}
+			c = f.conv(x, rt)
+		}
+		return val{c: c, t: rt}
+	}
+
+	num := func(c string) val {
+		return val{c: f.conv(val{c: c, t: st.TypeLReal}, rt), t: rt}
+	}
+	switch u {
+	case "ABS":
+		if rt.Class == st.RealClass {
+			return num("fabs(" + f.toFloat(args[0]) + ")")
+		}
+		return val{c: wrapFunc(rt) + "((uint64_t)iec_abs(" + f.toInt(args[0]) + "))", t: rt}
+	case "SQRT", "LN", "LOG", "EXP", "SIN", "COS", "TAN", "ASIN", "ACOS", "ATAN":
+		return num(mathFuncs[u] + "(" + f.toFloat(args[0]) + ")")
+	case "EXPT":
+		return num("pow(" + f.toFloat(args[0]) + ", " + f.toFloat(args[1]) + ")")
+	case "ADD", "MUL", "SUB", "DIV", "MOD":
+		op := map[string]string{"ADD": "+", "MUL": "*", "SUB": "-", "DIV": "/", "MOD": "MOD"}[u]
+		r := args[0]
+		for _, a := range args[1:] {
+			r = f.arith(e, op, r, a, rt)
+		}
+		return val{c: f.conv(r, rt), t: rt}
+	case "MOVE":
+		return f.passed(args[0], rt)
+	case "SEL":
+		if isComposite(rt) {
+			break
+		}
+		in0, in1 := f.passed(args[1], rt), f.passed(args[2], rt)
+		if args[0].konst {
+			if args[0].k != 0 {
+				return in1
+			}
+			return in0
+		}
+		return val{c: "(" + f.truth(args[0]) + " ? " + in1.c + " : " + in0.c + ")", t: rt}
+	case "MUX":
+		if isComposite(rt) {
+			break
+		}
+		if k := args[0]; k.konst && f.constInt(k) >= 0 && f.constInt(k) < int64(len(args)-1) {
+			return f.passed(args[f.constInt(k)+1], rt)
+		}
+		s := &seq{f: f}
+		k := f.toInt(args[0])
+		if !simpleRe.MatchString(k) {
+			tmp := f.temp("int64_t %s")
+			s.then(tmp + " = " + k)
+			k = tmp
+		}
+		first := f.passed(args[1], rt).c
+		c := fmt.Sprintf("(iec_trap(\"MUX selector out of range\"), %s)", first)
+		for i := len(args) - 1; i >= 1; i-- {
+			in := first
+			if i > 1 {
+				in = f.passed(args[i], rt).c
+			}
+			c = fmt.Sprintf("%s == %d ? %s : %s", k, i-1, in, c)
+		}
+		return val{c: s.result(c), t: rt}
+	case "MAX", "MIN", "LIMIT":
+		if isComposite(rt) || rt.Class == st.PointerClass {
+			break
+		}
+		s := &seq{f: f}
+		held := make([]val, len(args))
+		for i, a := range args {
+			held[i] = val{c: s.hold(f.conv(a, rt), rt), t: rt}
+			if a.konst && isInt(a.t) && isInt(rt) {
+				held[i].konst, held[i].k = true, wrap(f.constInt(a), rt)
+			}
+		}
+		decl := f.g.decl(rt, "%s")
+		if rt.Class == st.StringClass {
+			decl = "const char *%s"
+		}
+		r := val{c: f.temp(decl), t: rt}
+		pick := func(x val, op string) {
+			s.then(fmt.Sprintf("%s = %s ? %s : %s", r.c, f.compare(e, op, x, r), x.c, r.c))
+		}
+		if u == "LIMIT" {
+			s.then(r.c + " = " + held[1].c)
+			pick(held[0], ">") // r = MN if r < MN
+			pick(held[2], "<") // r = MX if r > MX
+			return val{c: s.result(r.c), t: rt}
+		}
+		s.then(r.c + " = " + held[0].c)
+		op := map[string]string{"MAX": ">", "MIN": "<"}[u]
+		for _, x := range held[1:] {
+			pick(x, op)
+		}
+		return val{c: s.result(r.c), t: rt}
+	case "SHL", "SHR", "ROL", "ROR":
+		if !isInt(rt) {
+			break
+		}
+		bits, _ := intInfo(rt)
+		return val{c: fmt.Sprintf("%s(iec_%s(%s, %s, %d))", wrapFunc(rt), strings.ToLower(u), f.u64(args[0]), f.toInt(args[1]), bits), t: rt}
+	case "TRUNC":
+		return val{c: f.conv(val{c: "iec_trunc(" + f.toFloat(args[0]) + ")", t: st.TypeLInt}, rt), t: rt}
+	case "LEN":
+		return val{c: f.conv(val{c: "(int64_t)strlen(" + f.str(args[0]) + ")", t: st.TypeLInt}, rt), t: rt}
+	case "FIND":
+		return val{c: f.conv(val{c: "iec_find(" + f.str(args[0]) + ", " + f.str(args[1]) + ")", t: st.TypeLInt}, rt), t: rt}
+	case "LEFT", "RIGHT", "MID", "CONCAT", "INSERT", "DELETE", "REPLACE":
+		buf := f.temp("char %s[IEC_STRLEN + 1]")
+		var cargs []string
+		switch u {
+		case "CONCAT":
+			cargs = append(cargs, strconv.Itoa(len(args)))
+			for _, a := range args {
+				cargs = append(cargs, f.str(a))
+			}
+		case "INSERT":
+			cargs = []string{f.str(args[0]), f.str(args[1]), f.toInt(args[2])}
+		case "REPLACE":
+			cargs = []string{f.str(args[0]), f.str(args[1]), f.toInt(args[2]), f.toInt(args[3])}
+		default:
+			cargs = []string{f.str(args[0])}
+			for _, a := range args[1:] {
+				cargs = append(cargs, f.toInt(a))
+			}
+		}
+		return val{c: "iec_" + strings.ToLower(u) + "(" + buf + ", " + strings.Join(cargs, ", ") + ")", t: rt}
+	}
+	f.errorf(e, "%s of %s is not supported", u, rt.Name)
+	return bad
+}
+
+// isConstant reports whether the C expression c is a variable, a number
+// or a string literal, which need no temporary to be used twice.
+func isConstant(c string) bool {
+	c = strings.TrimPrefix(strings.TrimPrefix(c, "(IEC_REAL)"), "-")
+	return simpleRe.MatchString(c) || strings.HasPrefix(c, `"`) && len(c) > 1 && !strings.Contains(c[1:len(c)-1], `"`)
+}
+
+// passed converts the value a selection function passes through;
+// structures pass unchanged.
+func (f *fn) passed(v val, rt *st.Type) val {
+	if isComposite(v.t) || rt.Class == st.AnyClass {
+		v.lv = false
+		return v
+	}
+	return val{c: f.conv(v, rt), t: rt}
+}
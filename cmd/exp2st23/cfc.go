@@ -0,0 +1,403 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ── CFC body conversion ──────────────────────────────────────────────────────
+//
+// CoDeSys 2.3 serialises a CFC implementation as a flat, textual element list
+// following the _CFC_BODY marker. Every element starts with a tag line and is
+// followed by "_KEY : value" attribute lines:
+//
+//	_CFC_BODY
+//	_INPUT                       input element (variable or literal)
+//	_ID : 1
+//	_TEXT : 'xStart'
+//	_NEGATED : 0
+//	_BOX                         operator, function or function block call
+//	_ID : 3
+//	_TYPE : 'TON'
+//	_INSTANCE : 'tmrStart'       empty for operators and functions
+//	_ORDER : 1                   CFC execution order
+//	_INPUTS : 2
+//	_PIN : 'IN', 1, 0, 0         name, source element, source pin, negated
+//	_PIN : 'PT', 2, 0, 0
+//	_OUTPUTS : 2
+//	_PIN : 'Q', 0                name, negated
+//	_PIN : 'ET', 0
+//	_OUTPUT                      output element (assignment target)
+//	_ID : 4
+//	_TEXT : 'xRun'
+//	_ORDER : 2
+//	_CONNECTION : 3, 0           source element, source pin
+//
+// _RETURN elements carry a _CONNECTION and an _ORDER like outputs; _COMMENT
+// elements carry only a _TEXT. Source element -1 marks an unconnected pin.
+//
+// Operator and function boxes are pure and are inlined into the expression of
+// whatever consumes them. Function block calls, assignments to outputs and
+// conditional returns become statements, emitted in CFC execution order.
+
+type cfcPin struct {
+	name    string
+	srcID   int
+	srcPin  int
+	negated bool
+}
+
+type cfcElement struct {
+	tag      string // BOX, INPUT, OUTPUT, RETURN, COMMENT, JUMP, LABEL
+	id       int
+	text     string
+	typeName string
+	instance string
+	order    int
+	negated  bool
+	conn     cfcPin // _CONNECTION of OUTPUT / RETURN elements
+	inputs   []cfcPin
+	outputs  []cfcPin
+}
+
+// isCFCBody reports whether the implementation is a serialised CFC network.
+func isCFCBody(body string) bool {
+	return strings.HasPrefix(strings.TrimSpace(body), "_CFC_BODY")
+}
+
+// parseCFC reads the textual element list of a _CFC_BODY.
+func parseCFC(body string) ([]*cfcElement, error) {
+	var elems []*cfcElement
+	var cur *cfcElement
+	pinTarget := ""
+
+	for n, line := range strings.Split(body, "\n") {
+		t := strings.TrimSpace(line)
+		if t == "" || t == "_CFC_BODY" || t == "_END_CFC_BODY" {
+			continue
+		}
+		if strings.HasPrefix(strings.ToUpper(t), "END_") {
+			// END_FUNCTION / END_FUNCTION_BLOCK / END_PROGRAM closes the body.
+			break
+		}
+		if !strings.HasPrefix(t, "_") {
+			return nil, fmt.Errorf("line %d: unexpected %q", n+1, t)
+		}
+
+		key, val, hasVal := strings.Cut(t, ":")
+		key = strings.TrimSpace(key)
+		val = strings.TrimSpace(val)
+
+		if !hasVal {
+			switch key {
+			case "_BOX", "_INPUT", "_OUTPUT", "_RETURN", "_COMMENT", "_JUMP", "_LABEL":
+				cur = &cfcElement{tag: key[1:], id: -1}
+				elems = append(elems, cur)
+				pinTarget = ""
+				continue
+			}
+			return nil, fmt.Errorf("line %d: unknown element %q", n+1, key)
+		}
+		if cur == nil {
+			// Header attributes such as _COUNT before the first element.
+			continue
+		}
+
+		switch key {
+		case "_ID":
+			id, err := strconv.Atoi(val)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: bad _ID %q", n+1, val)
+			}
+			cur.id = id
+		case "_TEXT":
+			cur.text = unquoteCFC(val)
+		case "_TYPE":
+			cur.typeName = unquoteCFC(val)
+		case "_INSTANCE":
+			cur.instance = unquoteCFC(val)
+		case "_ORDER":
+			cur.order, _ = strconv.Atoi(val)
+		case "_NEGATED":
+			cur.negated = val == "1"
+		case "_CONNECTION":
+			f := splitCFCFields(val)
+			cur.conn = cfcPin{srcID: -1}
+			if len(f) >= 1 {
+				cur.conn.srcID, _ = strconv.Atoi(f[0])
+			}
+			if len(f) >= 2 {
+				cur.conn.srcPin, _ = strconv.Atoi(f[1])
+			}
+		case "_INPUTS":
+			pinTarget = "in"
+		case "_OUTPUTS":
+			pinTarget = "out"
+		case "_PIN":
+			f := splitCFCFields(val)
+			p := cfcPin{srcID: -1}
+			if len(f) >= 1 {
+				p.name = unquoteCFC(f[0])
+			}
+			switch pinTarget {
+			case "in":
+				if len(f) >= 2 {
+					p.srcID, _ = strconv.Atoi(f[1])
+				}
+				if len(f) >= 3 {
+					p.srcPin, _ = strconv.Atoi(f[2])
+				}
+				if len(f) >= 4 {
+					p.negated = f[3] == "1"
+				}
+				cur.inputs = append(cur.inputs, p)
+			case "out":
+				if len(f) >= 2 {
+					p.negated = f[1] == "1"
+				}
+				cur.outputs = append(cur.outputs, p)
+			default:
+				return nil, fmt.Errorf("line %d: _PIN outside _INPUTS/_OUTPUTS", n+1)
+			}
+		}
+	}
+	return elems, nil
+}
+
+func splitCFCFields(val string) []string {
+	var out []string
+	inQuote := false
+	start := 0
+	for i := 0; i < len(val); i++ {
+		switch val[i] {
+		case '\'':
+			inQuote = !inQuote
+		case ',':
+			if !inQuote {
+				out = append(out, strings.TrimSpace(val[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	return append(out, strings.TrimSpace(val[start:]))
+}
+
+func unquoteCFC(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'' {
+		s = s[1 : len(s)-1]
+	}
+	return s
+}
+
+// ── ST generation from the block graph ──────────────────────────────────────
+
+// cfcInfixOps maps CFC operator boxes to their ST infix operator.
+var cfcInfixOps = map[string]string{
+	"AND": "AND", "OR": "OR", "XOR": "XOR",
+	"ADD": "+", "SUB": "-", "MUL": "*", "DIV": "/", "MOD": "MOD",
+}
+
+// cfcCompareOps maps CFC comparison boxes to their ST operator. Extensible
+// comparisons compare each input with the next, so GT(a, b, c) is
+// a > b AND b > c.
+var cfcCompareOps = map[string]string{
+	"GT": ">", "GE": ">=", "EQ": "=", "NE": "<>", "LE": "<=", "LT": "<",
+}
+
+type cfcExpr struct {
+	text   string
+	atomic bool // no parentheses needed when used as an operand
+}
+
+type cfcGraph struct {
+	byID     map[int]*cfcElement
+	cache    map[int]cfcExpr
+	visiting map[int]bool
+}
+
+// cfcToST converts a _CFC_BODY into equivalent ST statements.
+func cfcToST(body string) (string, error) {
+	elems, err := parseCFC(body)
+	if err != nil {
+		return "", err
+	}
+	g := &cfcGraph{
+		byID:     make(map[int]*cfcElement),
+		cache:    make(map[int]cfcExpr),
+		visiting: make(map[int]bool),
+	}
+	var comments []string
+	var stmts []*cfcElement
+	for _, e := range elems {
+		switch e.tag {
+		case "JUMP", "LABEL":
+			return "", fmt.Errorf("CFC %s elements have no ST equivalent", strings.ToLower(e.tag))
+		case "COMMENT":
+			comments = append(comments, e.text)
+			continue
+		}
+		if e.id < 0 {
+			return "", fmt.Errorf("CFC %s element without _ID", strings.ToLower(e.tag))
+		}
+		if _, dup := g.byID[e.id]; dup {
+			return "", fmt.Errorf("duplicate CFC element id %d", e.id)
+		}
+		g.byID[e.id] = e
+		if e.tag == "OUTPUT" || e.tag == "RETURN" || (e.tag == "BOX" && e.instance != "") {
+			stmts = append(stmts, e)
+		}
+	}
+	sort.SliceStable(stmts, func(i, j int) bool { return stmts[i].order < stmts[j].order })
+
+	var lines []string
+	for _, c := range comments {
+		for _, cl := range strings.Split(c, "\n") {
+			lines = append(lines, "// "+strings.TrimSpace(cl))
+		}
+	}
+	for _, e := range stmts {
+		switch e.tag {
+		case "OUTPUT":
+			src, err := g.source(e.conn)
+			if err != nil {
+				return "", fmt.Errorf("output %q: %w", e.text, err)
+			}
+			lines = append(lines, fmt.Sprintf("%s := %s;", e.text, src.text))
+		case "RETURN":
+			src, err := g.source(e.conn)
+			if err != nil {
+				return "", fmt.Errorf("return: %w", err)
+			}
+			lines = append(lines, fmt.Sprintf("IF %s THEN", src.text), "    RETURN;", "END_IF;")
+		case "BOX":
+			var args []string
+			for _, p := range e.inputs {
+				if p.srcID < 0 {
+					continue
+				}
+				src, err := g.source(p)
+				if err != nil {
+					return "", fmt.Errorf("%s.%s: %w", e.instance, p.name, err)
+				}
+				args = append(args, fmt.Sprintf("%s := %s", p.name, src.text))
+			}
+			lines = append(lines, fmt.Sprintf("%s(%s);", e.instance, strings.Join(args, ", ")))
+		}
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// source returns the ST expression feeding a connected input pin.
+func (g *cfcGraph) source(p cfcPin) (cfcExpr, error) {
+	if p.srcID < 0 {
+		return cfcExpr{}, fmt.Errorf("unconnected input")
+	}
+	e, ok := g.byID[p.srcID]
+	if !ok {
+		return cfcExpr{}, fmt.Errorf("connection to unknown element %d", p.srcID)
+	}
+	var x cfcExpr
+	var err error
+	switch e.tag {
+	case "INPUT":
+		x = cfcExpr{text: e.text, atomic: true}
+		if e.negated {
+			x = negate(x)
+		}
+	case "BOX":
+		x, err = g.boxOutput(e, p.srcPin)
+	default:
+		err = fmt.Errorf("element %d (%s) has no output", e.id, strings.ToLower(e.tag))
+	}
+	if err != nil {
+		return cfcExpr{}, err
+	}
+	if p.negated {
+		x = negate(x)
+	}
+	return x, nil
+}
+
+// boxOutput returns the expression for output pin pin of box e.
+func (g *cfcGraph) boxOutput(e *cfcElement, pin int) (cfcExpr, error) {
+	var x cfcExpr
+	if e.instance != "" {
+		if pin < 0 || pin >= len(e.outputs) {
+			return cfcExpr{}, fmt.Errorf("%s has no output pin %d", e.instance, pin)
+		}
+		x = cfcExpr{text: e.instance + "." + e.outputs[pin].name, atomic: true}
+	} else {
+		if pin != 0 {
+			return cfcExpr{}, fmt.Errorf("%s box %d has a single output", e.typeName, e.id)
+		}
+		if cached, ok := g.cache[e.id]; ok {
+			x = cached
+		} else {
+			if g.visiting[e.id] {
+				return cfcExpr{}, fmt.Errorf("feedback loop through box %d (%s)", e.id, e.typeName)
+			}
+			g.visiting[e.id] = true
+			var err error
+			x, err = g.pureBox(e)
+			g.visiting[e.id] = false
+			if err != nil {
+				return cfcExpr{}, err
+			}
+			g.cache[e.id] = x
+		}
+	}
+	if pin >= 0 && pin < len(e.outputs) && e.outputs[pin].negated {
+		x = negate(x)
+	}
+	return x, nil
+}
+
+// pureBox builds the expression for an operator or function box.
+func (g *cfcGraph) pureBox(e *cfcElement) (cfcExpr, error) {
+	var args []cfcExpr
+	for _, p := range e.inputs {
+		a, err := g.source(p)
+		if err != nil {
+			return cfcExpr{}, fmt.Errorf("%s box %d: %w", e.typeName, e.id, err)
+		}
+		args = append(args, a)
+	}
+	op := strings.ToUpper(e.typeName)
+	switch {
+	case op == "MOVE" && len(args) == 1:
+		return args[0], nil
+	case op == "NOT" && len(args) == 1:
+		return negate(args[0]), nil
+	case cfcInfixOps[op] != "" && len(args) >= 2:
+		parts := make([]string, len(args))
+		for i, a := range args {
+			parts[i] = operand(a)
+		}
+		return cfcExpr{text: strings.Join(parts, " "+cfcInfixOps[op]+" ")}, nil
+	case cfcCompareOps[op] != "" && len(args) >= 2:
+		parts := make([]string, len(args)-1)
+		for i := range parts {
+			parts[i] = operand(args[i]) + " " + cfcCompareOps[op] + " " + operand(args[i+1])
+		}
+		return cfcExpr{text: strings.Join(parts, " AND ")}, nil
+	}
+	parts := make([]string, len(args))
+	for i, a := range args {
+		parts[i] = a.text
+	}
+	return cfcExpr{text: fmt.Sprintf("%s(%s)", e.typeName, strings.Join(parts, ", ")), atomic: true}, nil
+}
+
+func operand(x cfcExpr) string {
+	if x.atomic {
+		return x.text
+	}
+	return "(" + x.text + ")"
+}
+
+func negate(x cfcExpr) cfcExpr {
+	return cfcExpr{text: "NOT " + operand(x), atomic: false}
+}
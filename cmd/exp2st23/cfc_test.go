@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestCFCFixture converts testdata/codesys23/cfc.EXP and compares every
+// generated file with its counterpart in testdata/codesys23/cfc/.
+func TestCFCFixture(t *testing.T) {
+	raw, err := os.ReadFile("../../testdata/codesys23/cfc.EXP")
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := strings.ReplaceAll(string(raw), "\r\n", "\n")
+	blocks := splitObjects(text)
+	if len(blocks) == 0 {
+		t.Fatal("no objects in fixture")
+	}
+	for _, block := range blocks {
+		obj := parseBlock(block)
+		if obj == nil {
+			t.Fatal("unrecognized block in fixture")
+		}
+		content, relPath, src := generateST(obj)
+		if src != implCFC {
+			t.Errorf("%s: body not converted from CFC", obj.name)
+		}
+		want, err := os.ReadFile(filepath.Join("../../testdata/codesys23/cfc", relPath))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if content != string(want) {
+			t.Errorf("%s:\ngot:\n%s\nwant:\n%s", relPath, content, want)
+		}
+	}
+}
+
+func TestCFCComparisonBoxes(t *testing.T) {
+	body := `_CFC_BODY
+_INPUT
+_ID : 1
+_TEXT : 'a'
+_INPUT
+_ID : 2
+_TEXT : 'b'
+_INPUT
+_ID : 3
+_TEXT : 'c'
+_BOX
+_ID : 4
+_TYPE : '%s'
+_INPUTS : %d
+%s_OUTPUTS : 1
+_PIN : '', 0
+_OUTPUT
+_ID : 5
+_TEXT : 'x'
+_ORDER : 1
+_CONNECTION : 4, 0
+`
+	pins := func(n int) string {
+		var b strings.Builder
+		for i := 1; i <= n; i++ {
+			fmt.Fprintf(&b, "_PIN : '', %d, 0, 0\n", i)
+		}
+		return b.String()
+	}
+	tests := []struct {
+		op   string
+		n    int
+		want string
+	}{
+		{"GT", 2, "x := a > b;"},
+		{"GT", 3, "x := a > b AND b > c;"},
+		{"EQ", 3, "x := a = b AND b = c;"},
+		{"LE", 3, "x := a <= b AND b <= c;"},
+		{"ADD", 3, "x := a + b + c;"},
+	}
+	for _, tt := range tests {
+		got, err := cfcToST(fmt.Sprintf(body, tt.op, tt.n, pins(tt.n)))
+		if err != nil {
+			t.Errorf("%s/%d: %v", tt.op, tt.n, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s/%d: got %q, want %q", tt.op, tt.n, got, tt.want)
+		}
+	}
+}
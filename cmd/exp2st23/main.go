@@ -1,20 +1,31 @@
 // exp2st23 — CoDeSys 2.3 EXP plain-text export → IEC 61131-3 .st file importer
 //
 // Reads a CoDeSys 2.3 .EXP file and writes one .st file per POU/GVL/TYPE.
-// Non-ST implementations (FBD, Ladder, SFC, IL) are replaced with a minimal
-// ST stub so the interface is preserved and usable as a code template.
+// CFC implementations are converted to ST statements in CFC execution order.
+// Other non-ST implementations (FBD, Ladder, SFC, IL) are replaced with a
+// minimal ST stub so the interface is preserved and usable as a code template.
 //
 // GVL objects are wrapped in a CONFIGURATION block as required by trust-LSP
 // (IEC 61131-3 Ed.3).
 //
+// The @OBJECTFLAGS, @SYMFILEFLAGS and @CONNECTIONS metadata of each object is
+// written to a <name>.meta.json sidecar next to its .st file, so that st2exp23
+// can restore it.
+//
+// EXP files are decoded from the Windows ANSI code page given by -encoding and
+// the .st files are always written as UTF-8. Input that carries a UTF-8 BOM or
+// is valid UTF-8 with non-ASCII characters is detected and read as UTF-8.
+//
 // Usage:
 //
-//	exp2st23 -in <file.EXP> [-out <dir>]
+//	exp2st23 -in <file.EXP> [-out <dir>] [-encoding <cp>] [-meta=false]
 //
 // Flags:
 //
-//	-in     input .EXP file (required)
-//	-out    output root directory for .st files (default "src")
+//	-in        input .EXP file (required)
+//	-out       output root directory for .st files (default "src")
+//	-encoding  code page of the input file (default "windows-1252")
+//	-meta      write .meta.json sidecars (default true)
 package main
 
 import (
@@ -24,6 +35,9 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+
+	"github.com/damischa1/iec-st-tools/codepage"
+	"github.com/damischa1/iec-st-tools/meta"
 )
 
 // ── Metadata regex patterns ──────────────────────────────────────────────────
@@ -32,8 +46,8 @@ var (
 	reNestedComments = regexp.MustCompile(`\(\*\s*@NESTEDCOMMENTS\s*:=\s*'[^']*'\s*\*\)`)
 	reGlobalVarList  = regexp.MustCompile(`\(\*\s*@GLOBAL_VARIABLE_LIST\s*:=\s*'([^']*)'\s*\*\)`)
 	rePath           = regexp.MustCompile(`\(\*\s*@PATH\s*:=\s*'([^']*)'\s*\*\)`)
-	reObjectFlags    = regexp.MustCompile(`\(\*\s*@OBJECTFLAGS\s*:=\s*'[^']*'\s*\*\)`)
-	reSymFileFlags   = regexp.MustCompile(`\(\*\s*@SYMFILEFLAGS\s*:=\s*'[^']*'\s*\*\)`)
+	reObjectFlags    = regexp.MustCompile(`\(\*\s*@OBJECTFLAGS\s*:=\s*'([^']*)'\s*\*\)`)
+	reSymFileFlags   = regexp.MustCompile(`\(\*\s*@SYMFILEFLAGS\s*:=\s*'([^']*)'\s*\*\)`)
 	reEndDecl        = regexp.MustCompile(`\(\*\s*@END_DECLARATION\s*:=\s*'[^']*'\s*\*\)`)
 	reObjectEnd      = regexp.MustCompile(`\(\*\s*@OBJECT_END\s*:=\s*'([^']*)'\s*\*\)`)
 	reConnections    = regexp.MustCompile(`\(\*\s*@CONNECTIONS\s*:=`)
@@ -81,6 +95,19 @@ type expObject struct {
 	path string // raw CoDeSys path, e.g. "\/Implicit Globals"
 	decl string // declaration part (before @END_DECLARATION or the whole block for TYPE)
 	body string // implementation part (after @END_DECLARATION); empty for TYPE/GVL
+
+	objectFlags  string          // @OBJECTFLAGS value, e.g. "0, 8"
+	symFileFlags string          // @SYMFILEFLAGS value; empty if absent
+	connections  *expConnections // @CONNECTIONS block of a GVL; nil if absent
+}
+
+// expConnections is the @CONNECTIONS block that links a global variable list
+// to an external file.
+type expConnections struct {
+	Filename string   `json:"filename"`
+	Filetime string   `json:"filetime"`
+	Export   string   `json:"export"`
+	Entries  []string `json:"entries,omitempty"` // lines after NUMOFCONNECTIONS, verbatim
 }
 
 // ── Splitting .EXP into objects ──────────────────────────────────────────────
@@ -122,8 +149,24 @@ func parseBlock(raw string) *expObject {
 		obj.path = m[1]
 	}
 
+	if m := reObjectFlags.FindStringSubmatch(raw); m != nil {
+		obj.objectFlags = m[1]
+	}
+	if m := reSymFileFlags.FindStringSubmatch(raw); m != nil {
+		obj.symFileFlags = m[1]
+	}
+	obj.connections = parseConnections(raw)
+
+	// Everything from @OBJECT_END / @CONNECTIONS on is trailing metadata.
+	contentRaw := raw
+	for _, re := range []*regexp.Regexp{reObjectEnd, reConnections} {
+		if loc := re.FindStringIndex(contentRaw); loc != nil {
+			contentRaw = contentRaw[:loc[0]]
+		}
+	}
+
 	// Strip all metadata comments from top of block to get the real content.
-	lines := strings.Split(raw, "\n")
+	lines := strings.Split(contentRaw, "\n")
 
 	// Find first non-meta, non-blank line index
 	contentStart := 0
@@ -182,6 +225,40 @@ func parseBlock(raw string) *expObject {
 	return obj
 }
 
+// parseConnections extracts the @CONNECTIONS block of an object, if any.
+func parseConnections(raw string) *expConnections {
+	loc := reConnections.FindStringIndex(raw)
+	if loc == nil {
+		return nil
+	}
+	lines := strings.Split(raw[loc[1]:], "\n")
+	c := &expConnections{}
+	// lines[0] holds the list name after "@CONNECTIONS :="; fields follow.
+	for _, line := range lines[1:] {
+		t := strings.TrimSpace(line)
+		if t == "*)" {
+			break
+		}
+		key, val, _ := strings.Cut(t, ":")
+		val = strings.TrimSpace(val)
+		switch strings.TrimSpace(key) {
+		case "FILENAME":
+			c.Filename = strings.Trim(val, "'")
+		case "FILETIME":
+			c.Filetime = val
+		case "EXPORT":
+			c.Export = val
+		case "NUMOFCONNECTIONS":
+			// Derived from Entries on export.
+		default:
+			if t != "" {
+				c.Entries = append(c.Entries, t)
+			}
+		}
+	}
+	return c
+}
+
 // detectKind identifies the object kind from the declaration text.
 func detectKind(decl string) objKind {
 	line := firstCodeLine(decl)
@@ -353,6 +430,33 @@ func stubBody(decl string) string {
 	return strings.Join(lines, "\n")
 }
 
+// implSource tells where the ST body of a generated POU came from.
+type implSource int
+
+const (
+	implNone implSource = iota // not a POU
+	implST                     // original ST body
+	implCFC                    // converted from CFC
+	implStub                   // stub for a non-ST body
+)
+
+// implementationST returns the ST body for a POU together with the note to
+// append after its declaration. CFC bodies are converted to equivalent ST;
+// other non-ST bodies, and CFC that cannot be converted, become a stub.
+func implementationST(obj *expObject) (body, note string, src implSource) {
+	if isSTBody(obj.body) {
+		return obj.body, "", implST
+	}
+	if isCFCBody(obj.body) {
+		st, err := cfcToST(obj.body)
+		if err == nil {
+			return st, "\n// NOTE: Converted from CFC in execution order.", implCFC
+		}
+		fmt.Fprintf(os.Stderr, "WARNING: %s: cannot convert CFC body: %v\n", obj.name, err)
+	}
+	return stubBody(obj.decl), "\n// NOTE: Original implementation was non-ST (FBD/Ladder/SFC/IL). Stub generated.", implStub
+}
+
 // ── .st file generation ─────────────────────────────────────────────────────
 
 func pathToDir(rawPath string) string {
@@ -373,7 +477,7 @@ func indentBlock(s, prefix string) string {
 	return strings.Join(lines, "\n")
 }
 
-func generateST(obj *expObject) (content, relPath string) {
+func generateST(obj *expObject) (content, relPath string, src implSource) {
 	dir := pathToDir(obj.path)
 	relPath = filepath.Join(dir, obj.name+".st")
 
@@ -395,12 +499,8 @@ func generateST(obj *expObject) (content, relPath string) {
 
 	case kindFunction, kindFunctionBlock, kindProgram:
 		endKW := pouEndKeyword(obj.decl)
-		body := obj.body
-		stubFlag := ""
-		if !isSTBody(body) {
-			body = stubBody(obj.decl)
-			stubFlag = "\n// NOTE: Original implementation was non-ST (FBD/Ladder/SFC/IL). Stub generated."
-		}
+		var body, stubFlag string
+		body, stubFlag, src = implementationST(obj)
 		decl := strings.TrimRight(obj.decl, "\r\n ")
 		body = strings.TrimRight(body, "\r\n ")
 
@@ -422,13 +522,30 @@ func generateST(obj *expObject) (content, relPath string) {
 	return
 }
 
+// ── Metadata sidecars ─────────────────────────────────────────────────────────
+
+// sidecarFields returns the CoDeSys 2.3 metadata persisted for obj.
+func sidecarFields(obj *expObject) map[string]any {
+	f := map[string]any{
+		"objectFlags":  obj.objectFlags,
+		"symFileFlags": obj.symFileFlags,
+		"connections":  nil,
+	}
+	if obj.connections != nil {
+		f["connections"] = obj.connections
+	}
+	return f
+}
+
 // ── Main ──────────────────────────────────────────────────────────────────────
 
 func main() {
 	inFile := flag.String("in", "", "input .EXP file (required)")
 	outDir := flag.String("out", "src", "output root directory")
+	writeMeta := flag.Bool("meta", true, "write .meta.json sidecars with object flags and connections")
+	encoding := flag.String("encoding", "windows-1252", "code page of the input file (utf-8, windows-1252, windows-1250, iso-8859-1, iso-8859-15)")
 	flag.Usage = func() {
-		fmt.Fprintln(os.Stderr, "exp2st23 - Import CoDeSys 2.3 .EXP files to IEC 61131-3 .st format\n")
+		fmt.Fprint(os.Stderr, "exp2st23 - Import CoDeSys 2.3 .EXP files to IEC 61131-3 .st format\n\n")
 		fmt.Fprintln(os.Stderr, "Usage:")
 		flag.PrintDefaults()
 	}
@@ -445,8 +562,20 @@ func main() {
 		os.Exit(1)
 	}
 
+	decoded, used, warnings, err := codepage.Decode(raw, *encoding)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "cannot decode input:", err)
+		os.Exit(1)
+	}
+	for _, w := range warnings {
+		fmt.Fprintf(os.Stderr, "WARNING: %s: %s\n", *inFile, w)
+	}
+	if want, _ := codepage.Normalize(*encoding); used != want {
+		fmt.Fprintf(os.Stderr, "NOTE: %s is UTF-8 encoded, ignoring -encoding %s\n", *inFile, *encoding)
+	}
+
 	// Normalize to LF for parsing (EXP files are CRLF)
-	text := strings.ReplaceAll(string(raw), "\r\n", "\n")
+	text := strings.ReplaceAll(decoded, "\r\n", "\n")
 
 	blocks := splitObjects(text)
 	if len(blocks) == 0 {
@@ -454,7 +583,7 @@ func main() {
 		os.Exit(1)
 	}
 
-	written, skipped, stubbed := 0, 0, 0
+	written, skipped, stubbed, converted := 0, 0, 0, 0
 
 	for _, block := range blocks {
 		obj := parseBlock(block)
@@ -464,15 +593,7 @@ func main() {
 			continue
 		}
 
-		wasStubbed := false
-		switch obj.kind {
-		case kindFunction, kindFunctionBlock, kindProgram:
-			if !isSTBody(obj.body) {
-				wasStubbed = true
-			}
-		}
-
-		content, relPath := generateST(obj)
+		content, relPath, src := generateST(obj)
 		outPath := filepath.Join(*outDir, relPath)
 
 		if err := os.MkdirAll(filepath.Dir(outPath), 0755); err != nil {
@@ -483,15 +604,25 @@ func main() {
 			fmt.Fprintf(os.Stderr, "cannot write %s: %v\n", outPath, err)
 			continue
 		}
+		if *writeMeta {
+			metaPath := strings.TrimSuffix(outPath, ".st") + ".meta.json"
+			if err := meta.WriteSidecar(metaPath, sidecarFields(obj)); err != nil {
+				fmt.Fprintf(os.Stderr, "cannot write %s: %v\n", metaPath, err)
+			}
+		}
 
 		tag := ""
-		if wasStubbed {
+		switch src {
+		case implStub:
 			tag = " [STUB]"
 			stubbed++
+		case implCFC:
+			tag = " [CFC]"
+			converted++
 		}
 		fmt.Printf("  %-10s  %s%s\n", kindLabel(obj.kind), outPath, tag)
 		written++
 	}
 
-	fmt.Printf("\nDone: %d written (%d stubs), %d skipped\n", written, stubbed, skipped)
+	fmt.Printf("\nDone: %d written (%d stubs, %d from CFC), %d skipped\n", written, stubbed, converted, skipped)
 }
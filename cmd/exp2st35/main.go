@@ -7,9 +7,13 @@
 // GVL objects are wrapped in a CONFIGURATION block as required by trust-LSP
 // (IEC 61131-3 Ed.3).
 //
+// Object and folder GUIDs, timestamps and build properties are written to a
+// <name>.meta.json sidecar next to each .st file or folder, so that st2exp35
+// can restore them.
+//
 // Usage:
 //
-//	exp2st35 -in <file.export> [-out <dir>] [-base <path>] [-strip <n>]
+//	exp2st35 -in <file.export> [-out <dir>] [-base <path>] [-strip <n>] [-meta=false]
 //
 // Flags:
 //
@@ -19,6 +23,7 @@
 //	        (default "Device,PLC Logic,Application")
 //	-strip  number of path elements to strip as prefix instead of using -base
 //	        (overrides -base if > 0)
+//	-meta   write .meta.json sidecars (default true)
 package main
 
 import (
@@ -27,7 +32,10 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+
+	"github.com/damischa1/iec-st-tools/meta"
 )
 
 // ── Generic XML node tree ─────────────────────────────────────────────────────
@@ -110,33 +118,51 @@ const (
 // ── Object extraction ─────────────────────────────────────────────────────────
 
 type importedObj struct {
-	name     string
-	typeGUID string
-	path     []string
-	decl     string
-	impl     string
-	isRoot   bool
+	name       string
+	typeGUID   string
+	guid       string
+	parentGUID string
+	timestamp  int64 // .NET ticks of the last change, 0 if unknown
+	props      *objectProps
+	path       []string
+	decl       string
+	impl       string
+	isRoot     bool
 }
 
 func parseEntry(entry *xmlNode) *importedObj {
 	isRootNode := entry.namedChild("IsRoot")
 	isRoot := isRootNode != nil && strings.EqualFold(isRootNode.text(), "true")
 
-	meta := entry.namedChild("MetaObject")
-	if meta == nil {
+	metaObj := entry.namedChild("MetaObject")
+	if metaObj == nil {
 		return nil
 	}
 
-	nameNode := meta.namedChild("Name")
+	nameNode := metaObj.namedChild("Name")
 	if nameNode == nil {
 		return nil
 	}
-	typeGUIDNode := meta.namedChild("TypeGuid")
+	typeGUIDNode := metaObj.namedChild("TypeGuid")
 	typeGUID := ""
 	if typeGUIDNode != nil {
 		typeGUID = typeGUIDNode.text()
 	}
 
+	guid := ""
+	if g := metaObj.namedChild("Guid"); g != nil {
+		guid = g.text()
+	}
+	parentGUID := ""
+	if g := metaObj.namedChild("ParentGuid"); g != nil {
+		parentGUID = g.text()
+	}
+
+	var timestamp int64
+	if ts := metaObj.namedChild("Timestamp"); ts != nil {
+		timestamp, _ = strconv.ParseInt(strings.TrimSpace(ts.text()), 10, 64)
+	}
+
 	var pathParts []string
 	pathArr := entry.namedChild("Path")
 	if pathArr != nil {
@@ -159,15 +185,89 @@ func parseEntry(entry *xmlNode) *importedObj {
 	}
 
 	return &importedObj{
-		name:     nameNode.text(),
-		typeGUID: typeGUID,
-		path:     pathParts,
-		decl:     decl,
-		impl:     impl,
-		isRoot:   isRoot,
+		name:       nameNode.text(),
+		typeGUID:   typeGUID,
+		guid:       guid,
+		parentGUID: parentGUID,
+		timestamp:  timestamp,
+		props:      parseBuildProperties(metaObj.namedChild("Properties")),
+		path:       pathParts,
+		decl:       decl,
+		impl:       impl,
+		isRoot:     isRoot,
 	}
 }
 
+// ── Object metadata ───────────────────────────────────────────────────────────
+
+// tBuildProps is the key of the build properties entry in a MetaObject's
+// Properties dictionary.
+const tBuildProps = "24568a24-c491-472c-a21f-ee5d33859fab"
+
+// objectProps holds the per-object build properties of a CoDeSys 3.5 object.
+type objectProps struct {
+	ExcludeFromBuild             bool     `json:"excludeFromBuild"`
+	External                     bool     `json:"external"`
+	EnableSystemCall             bool     `json:"enableSystemCall"`
+	LinkAlways                   bool     `json:"linkAlways"`
+	CompilerDefines              string   `json:"compilerDefines"`
+	MemoryReserveForOnlineChange int      `json:"memoryReserveForOnlineChange"`
+	Undefines                    []string `json:"undefines,omitempty"`
+}
+
+// parseBuildProperties extracts the build properties from a MetaObject's
+// Properties dictionary. It returns nil if the object has none (e.g. folders).
+func parseBuildProperties(dict *xmlNode) *objectProps {
+	if dict == nil {
+		return nil
+	}
+	for _, entry := range dict.allChildren("Entry") {
+		key := entry.child("Key")
+		if key == nil || key.child("Single") == nil || key.child("Single").text() != tBuildProps {
+			continue
+		}
+		value := entry.child("Value")
+		if value == nil || value.child("Single") == nil {
+			continue
+		}
+		v := value.child("Single")
+		p := &objectProps{}
+		isTrue := func(name string) bool {
+			n := v.namedChild(name)
+			return n != nil && strings.EqualFold(n.text(), "true")
+		}
+		p.ExcludeFromBuild = isTrue("ExcludeFromBuild")
+		p.External = isTrue("External")
+		p.EnableSystemCall = isTrue("EnableSystemCall")
+		p.LinkAlways = isTrue("LinkAlways")
+		if n := v.namedChild("CompilerDefines"); n != nil {
+			p.CompilerDefines = n.text()
+		}
+		if n := v.namedChild("MemoryReserveForOnlineChange"); n != nil {
+			fmt.Sscan(n.text(), &p.MemoryReserveForOnlineChange)
+		}
+		if n := v.namedChild("Undefines"); n != nil {
+			for _, u := range n.allChildren("Single") {
+				p.Undefines = append(p.Undefines, u.text())
+			}
+		}
+		return p
+	}
+	return nil
+}
+
+// sidecarFields returns the metadata persisted for obj.
+func sidecarFields(obj *importedObj) map[string]any {
+	f := map[string]any{"guid": obj.guid, "parentGuid": obj.parentGUID}
+	if obj.timestamp != 0 {
+		f["timestamp"] = obj.timestamp
+	}
+	if obj.props != nil {
+		f["properties"] = obj.props
+	}
+	return f
+}
+
 // ── ST detection & stub generation ───────────────────────────────────────────
 
 func isST(impl string) bool {
@@ -249,12 +349,21 @@ func stubBody(decl string) string {
 
 // ── File generation ───────────────────────────────────────────────────────────
 
-func generateST(obj *importedObj, strip int) (content, relPath string) {
+// entryDir returns the output directory of an entry relative to -out. The
+// CoDeSys Path of an entry ends with the entry's own name, which is dropped.
+func entryDir(obj *importedObj, strip int) string {
 	stripped := obj.path
 	if strip > 0 && len(stripped) > strip {
 		stripped = stripped[strip:]
 	}
-	relPath = filepath.Join(append(stripped, obj.name+".st")...)
+	if n := len(stripped); n > 0 && stripped[n-1] == obj.name {
+		stripped = stripped[:n-1]
+	}
+	return filepath.Join(stripped...)
+}
+
+func generateST(obj *importedObj, strip int) (content, relPath string) {
+	relPath = filepath.Join(entryDir(obj, strip), obj.name+".st")
 
 	switch obj.typeGUID {
 	case tDUT:
@@ -306,8 +415,9 @@ func main() {
 	outDir := flag.String("out", "src", "output root directory")
 	basePath := flag.String("base", "Device,PLC Logic,Application", "CoDeSys tree prefix to strip from Path")
 	stripN := flag.Int("strip", 0, "number of leading path elements to strip (overrides -base)")
+	writeMeta := flag.Bool("meta", true, "write .meta.json sidecars with GUIDs and build properties")
 	flag.Usage = func() {
-		fmt.Fprintln(os.Stderr, "exp2st35 - Import CoDeSys 3.5 .export XML files to IEC 61131-3 .st format\n")
+		fmt.Fprint(os.Stderr, "exp2st35 - Import CoDeSys 3.5 .export XML files to IEC 61131-3 .st format\n\n")
 		fmt.Fprintln(os.Stderr, "Usage:")
 		flag.PrintDefaults()
 	}
@@ -360,7 +470,15 @@ func main() {
 		if obj == nil {
 			continue
 		}
-		if obj.isRoot && obj.typeGUID == tFolder {
+		if obj.typeGUID == tFolder {
+			if *writeMeta && obj.guid != "" {
+				metaPath := filepath.Join(*outDir, entryDir(obj, strip), obj.name+".meta.json")
+				if err := os.MkdirAll(filepath.Dir(metaPath), 0755); err != nil {
+					fmt.Fprintf(os.Stderr, "cannot create dir for %s: %v\n", metaPath, err)
+				} else if err := meta.WriteSidecar(metaPath, sidecarFields(obj)); err != nil {
+					fmt.Fprintf(os.Stderr, "cannot write %s: %v\n", metaPath, err)
+				}
+			}
 			skipped++
 			continue
 		}
@@ -381,6 +499,12 @@ func main() {
 			fmt.Fprintf(os.Stderr, "cannot write %s: %v\n", outPath, err)
 			continue
 		}
+		if *writeMeta && obj.guid != "" {
+			metaPath := strings.TrimSuffix(outPath, ".st") + ".meta.json"
+			if err := meta.WriteSidecar(metaPath, sidecarFields(obj)); err != nil {
+				fmt.Fprintf(os.Stderr, "cannot write %s: %v\n", metaPath, err)
+			}
+		}
 
 		tag := ""
 		if wasStubbed {
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/damischa1/iec-st-tools/st"
+)
+
+// ── check ─────────────────────────────────────────────────────────────────────
+
+// runCheck type-checks .st sources with st.Project.Check. Arguments are
+// files or directories, which together form one project. Syntax errors are
+// reported too, so a clean run means the sources should import into CoDeSys
+// without compile errors from names or types.
+func runCheck(args []string) int {
+	flags := flag.NewFlagSet("check", flag.ExitOnError)
+	format := flags.String("format", "text", "output format: text, json or sarif")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, "iecst check — type-check Structured Text sources\n\n")
+		fmt.Fprintln(os.Stderr, "Usage:")
+		fmt.Fprint(os.Stderr, "  iecst check [-format text|json|sarif] [file or directory ...]\n\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	proj, err := st.LoadProject(paths...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "iecst check:", err)
+		return 2
+	}
+	findings := append(syntaxFindings(proj), checkFindings(proj)...)
+	sortFindings(findings)
+
+	rules := []ruleInfo{
+		{"syntax", "source text does not parse"},
+		{"type", "unknown name, type mismatch or invalid call"},
+	}
+	if err := writeFindings(os.Stdout, *format, "iecst check", rules, findings); err != nil {
+		fmt.Fprintln(os.Stderr, "iecst check:", err)
+		return 2
+	}
+	if len(findings) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// checkFindings converts the type errors of a project into findings.
+func checkFindings(p *st.Project) []finding {
+	var out []finding
+	for f, list := range p.Check() {
+		for _, e := range list {
+			out = append(out, finding{Rule: "type", Level: "error", File: f.Name, Line: e.Pos.Line, Column: e.Pos.Col, Message: e.Msg})
+		}
+	}
+	return out
+}
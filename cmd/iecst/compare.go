@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ── Semantic project comparison ───────────────────────────────────────────────
+
+// change is one semantic difference between two projects.
+type change struct {
+	what   string // folder, object, moved, renamed, kind, declaration or body
+	op     byte   // '+' added, '-' removed, '~' modified
+	path   string
+	detail string // kind transition or unified diff of the text
+}
+
+// compareProjects reports folders and objects that were added or removed,
+// objects that were moved or renamed and objects whose kind, declaration or
+// body text differs.
+//
+// Objects are paired in order of confidence: by GUID when both sides carry
+// one in their .meta.json sidecar, then by identical path, then by identical
+// name and kind in another folder (a move), and finally by content similarity
+// of the remaining objects of the same kind (a rename).
+func compareProjects(a, b *project) []change {
+	var changes []change
+
+	for _, f := range a.sortedFolders() {
+		if !b.folders[f] {
+			changes = append(changes, change{what: "folder", op: '-', path: f})
+		}
+	}
+	for _, f := range b.sortedFolders() {
+		if !a.folders[f] {
+			changes = append(changes, change{what: "folder", op: '+', path: f})
+		}
+	}
+
+	pairs := matchObjects(a, b)
+	usedB := map[string]bool{}
+	for _, pb := range pairs {
+		usedB[pb] = true
+	}
+
+	for _, pa := range a.sortedPaths() {
+		oa := a.objects[pa]
+		pb, ok := pairs[pa]
+		if !ok {
+			changes = append(changes, change{what: "object", op: '-', path: pa, detail: oa.kind})
+			continue
+		}
+		ob := b.objects[pb]
+		if pa != pb {
+			what := "moved"
+			if oa.name != ob.name {
+				what = "renamed"
+			}
+			changes = append(changes, change{what: what, op: '~', path: pb, detail: "from " + pa})
+		}
+		changes = append(changes, compareObjects(oa, ob)...)
+	}
+	for _, pb := range b.sortedPaths() {
+		if !usedB[pb] {
+			changes = append(changes, change{what: "object", op: '+', path: pb, detail: b.objects[pb].kind})
+		}
+	}
+	return changes
+}
+
+// renameThreshold is the minimum content similarity for two otherwise
+// unrelated objects to be reported as a rename instead of remove + add.
+const renameThreshold = 0.6
+
+// matchObjects pairs the objects of a with those of b and returns a map from
+// a-path to b-path. Unpaired objects are absent from the map.
+func matchObjects(a, b *project) map[string]string {
+	pairs := map[string]string{}
+	usedB := map[string]bool{}
+	pair := func(pa, pb string) {
+		pairs[pa] = pb
+		usedB[pb] = true
+	}
+
+	byGUID := map[string]string{}
+	for _, pb := range b.sortedPaths() {
+		if g := b.objects[pb].guid(); g != "" {
+			byGUID[strings.ToLower(g)] = pb
+		}
+	}
+	for _, pa := range a.sortedPaths() {
+		if g := a.objects[pa].guid(); g != "" {
+			if pb, ok := byGUID[strings.ToLower(g)]; ok && !usedB[pb] {
+				pair(pa, pb)
+			}
+		}
+	}
+
+	for _, pa := range a.sortedPaths() {
+		if _, done := pairs[pa]; !done {
+			if _, ok := b.objects[pa]; ok && !usedB[pa] {
+				pair(pa, pa)
+			}
+		}
+	}
+
+	// Moves: the same name and kind exactly once among the unpaired objects.
+	unpaired := func(p *project, used func(string) bool) map[string][]string {
+		byName := map[string][]string{}
+		for _, path := range p.sortedPaths() {
+			if !used(path) {
+				o := p.objects[path]
+				key := strings.ToLower(o.name) + "\x00" + o.kind
+				byName[key] = append(byName[key], path)
+			}
+		}
+		return byName
+	}
+	nameA := unpaired(a, func(p string) bool { _, ok := pairs[p]; return ok })
+	nameB := unpaired(b, func(p string) bool { return usedB[p] })
+	for key, pas := range nameA {
+		if pbs := nameB[key]; len(pas) == 1 && len(pbs) == 1 {
+			pair(pas[0], pbs[0])
+		}
+	}
+
+	// Renames: the most similar remaining object of the same kind.
+	for _, pa := range a.sortedPaths() {
+		if _, done := pairs[pa]; done {
+			continue
+		}
+		oa := a.objects[pa]
+		best, bestScore := "", renameThreshold
+		for _, pb := range b.sortedPaths() {
+			ob := b.objects[pb]
+			if usedB[pb] || ob.kind != oa.kind {
+				continue
+			}
+			if score := similarity(oa, ob); score >= bestScore {
+				best, bestScore = pb, score
+			}
+		}
+		if best != "" {
+			pair(pa, best)
+		}
+	}
+	return pairs
+}
+
+// similarity returns the share of lines two objects have in common, after the
+// old name has been replaced by the new one, as a value between 0 and 1.
+func similarity(oa, ob *stObject) float64 {
+	la := splitLines(strings.ReplaceAll(oa.decl+"\n"+oa.body, oa.name, ob.name))
+	lb := splitLines(ob.decl + "\n" + ob.body)
+	if len(la)+len(lb) == 0 {
+		return 1
+	}
+	common := 0
+	for _, op := range diffLines(la, lb) {
+		if op.op == ' ' {
+			common++
+		}
+	}
+	return 2 * float64(common) / float64(len(la)+len(lb))
+}
+
+// compareObjects reports kind, declaration and body differences of two
+// versions of the same object. The path of ob is used for the report.
+func compareObjects(oa, ob *stObject) []change {
+	var changes []change
+	if oa.kind != ob.kind {
+		changes = append(changes, change{what: "kind", op: '~', path: ob.path, detail: oa.kind + " → " + ob.kind})
+	}
+	if d := unifiedDiff(oa.decl, ob.decl, 3); d != "" {
+		changes = append(changes, change{what: "declaration", op: '~', path: ob.path, detail: d})
+	}
+	if d := unifiedDiff(oa.body, ob.body, 3); d != "" {
+		changes = append(changes, change{what: "body", op: '~', path: ob.path, detail: d})
+	}
+	return changes
+}
+
+// printChanges writes a human-readable report, one change per line followed
+// by an indented diff where there is one.
+func printChanges(w io.Writer, changes []change) {
+	for _, c := range changes {
+		switch c.what {
+		case "folder", "object", "moved", "renamed", "kind":
+			if c.detail != "" {
+				fmt.Fprintf(w, "  %c %-12s %s  (%s)\n", c.op, c.what, c.path, c.detail)
+			} else {
+				fmt.Fprintf(w, "  %c %-12s %s\n", c.op, c.what, c.path)
+			}
+		default:
+			fmt.Fprintf(w, "  %c %-12s %s\n", c.op, c.what, c.path)
+			if c.detail == "" {
+				continue
+			}
+			for _, l := range strings.Split(strings.TrimRight(c.detail, "\n"), "\n") {
+				fmt.Fprintf(w, "      %s\n", l)
+			}
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// ── Export formats ────────────────────────────────────────────────────────────
+
+// exportFormat describes one supported export file format and the pair of
+// converters that translate it to and from a .st source tree.
+type exportFormat struct {
+	name     string // short name used in flags and messages
+	ext      string // extension written by the exporter
+	importer string
+	exporter string
+}
+
+var (
+	formatEXP23 = &exportFormat{name: "codesys23", ext: ".EXP", importer: "exp2st23", exporter: "st2exp23"}
+	formatEXP35 = &exportFormat{name: "codesys35", ext: ".export", importer: "exp2st35", exporter: "st2exp35"}
+	formatXML   = &exportFormat{name: "plcopen", ext: ".xml", importer: "plcopen2st", exporter: "st2plcopen"}
+)
+
+var allFormats = []*exportFormat{formatEXP23, formatEXP35, formatXML}
+
+func formatByName(name string) (*exportFormat, error) {
+	for _, f := range allFormats {
+		if f.name == name {
+			return f, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown format %q (use codesys23, codesys35 or plcopen)", name)
+}
+
+// detectFormat identifies an export file by its extension, falling back to
+// sniffing the first bytes for files with unusual names.
+func detectFormat(path string) (*exportFormat, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".exp":
+		return formatEXP23, nil
+	case ".export":
+		return formatEXP35, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	head := make([]byte, 4096)
+	n, _ := f.Read(head)
+	head = head[:n]
+
+	switch {
+	case bytes.Contains(head, []byte("plcopen.org/xml/tc6")):
+		return formatXML, nil
+	case bytes.Contains(head, []byte("<ExportFile")) || bytes.Contains(head, []byte("<Single ")):
+		return formatEXP35, nil
+	case bytes.Contains(head, []byte("(* @NESTEDCOMMENTS")):
+		return formatEXP23, nil
+	}
+	return nil, fmt.Errorf("cannot determine the format of %s", path)
+}
+
+// resolveFormat returns the named format, or detects it from path when name
+// is empty.
+func resolveFormat(path, name string) (*exportFormat, error) {
+	if name != "" {
+		return formatByName(name)
+	}
+	return detectFormat(path)
+}
+
+// ── Running the converters ────────────────────────────────────────────────────
+
+// findTool locates one of the converters of this repository. A binary next to
+// the running iecst wins over one found in PATH, so that a single
+// `go build -o bin/ ./cmd/...` is self-contained.
+func findTool(name string) (string, error) {
+	if self, err := os.Executable(); err == nil {
+		candidate := filepath.Join(filepath.Dir(self), name)
+		for _, c := range []string{candidate, candidate + ".exe"} {
+			if info, err := os.Stat(c); err == nil && !info.IsDir() {
+				return c, nil
+			}
+		}
+	}
+	if p, err := exec.LookPath(name); err == nil {
+		return p, nil
+	}
+	return "", fmt.Errorf("%s not found next to iecst or in PATH (install it with: go install github.com/damischa1/iec-st-tools/cmd/%s@latest)", name, name)
+}
+
+// runTool runs a converter and returns its combined output as part of the
+// error when it fails. Successful runs are silent.
+func runTool(name string, args ...string) error {
+	path, err := findTool(name)
+	if err != nil {
+		return err
+	}
+	out, err := exec.Command(path, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s %s: %v\n%s", name, strings.Join(args, " "), err, strings.TrimRight(string(out), "\n"))
+	}
+	return nil
+}
+
+// importExport converts an export file into a .st tree below outDir.
+func importExport(f *exportFormat, in, outDir string) error {
+	return runTool(f.importer, "-in", in, "-out", outDir)
+}
+
+// exportProject converts the .st tree in srcDir into an export file in outDir
+// and returns the path of the written file. With reproducible set, formats
+// that carry timestamps and generated IDs are written deterministically.
+// Folders named test are exported like any other, since the tree comes from
+// an import.
+func exportProject(f *exportFormat, srcDir, outDir, name string, reproducible bool, extra ...string) (string, error) {
+	args := []string{"-src", srcDir, "-out", outDir, "-name", name, "-tests"}
+	if reproducible && f != formatEXP23 {
+		args = append(args, "-reproducible")
+	}
+	args = append(args, extra...)
+	if err := runTool(f.exporter, args...); err != nil {
+		return "", err
+	}
+	return filepath.Join(outDir, name+f.ext), nil
+}
+
+// loadInput returns the project model of an export file or of a .st source
+// tree. Export files are imported into a fresh directory below work.
+func loadInput(path, formatName, work string) (*project, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return loadProject(path)
+	}
+
+	format, err := resolveFormat(path, formatName)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp(work, "import-")
+	if err != nil {
+		return nil, err
+	}
+	if err := importExport(format, path, dir); err != nil {
+		return nil, fmt.Errorf("import: %w", err)
+	}
+	return loadProject(dir)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// converters are the commands that findTool looks for.
+var converters = []string{"exp2st23", "st2exp23", "exp2st35", "st2exp35", "plcopen2st", "st2plcopen"}
+
+// buildConverters builds the converters into a temporary directory and
+// puts it first in PATH, so that runTool finds them there.
+func buildConverters(t *testing.T) {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("builds the converters")
+	}
+	dir := t.TempDir()
+	args := []string{"build", "-o", dir + string(filepath.Separator)}
+	for _, c := range converters {
+		args = append(args, "../"+c)
+	}
+	if out, err := exec.Command("go", args...).CombinedOutput(); err != nil {
+		t.Fatalf("go build: %v\n%s", err, out)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestRoundtrip(t *testing.T) {
+	buildConverters(t)
+	for _, file := range []string{
+		"../../testdata/codesys23/export.EXP",
+		"../../testdata/codesys35/export.export",
+		"../../testdata/plcopen/TestProject.xml",
+	} {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			if code := runRoundtrip([]string{file}); code != 0 {
+				t.Errorf("iecst roundtrip %s: exit status %d", file, code)
+			}
+		})
+	}
+}
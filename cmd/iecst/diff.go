@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// ── diff ──────────────────────────────────────────────────────────────────────
+
+// runDiff compares two projects at object level. Either side may be an export
+// file of any supported format or a .st source tree, so a CoDeSys 2.3 EXP can
+// be compared with a PLCOpen file or with the sources it was exported from.
+//
+// Exit status follows diff(1): 0 when the projects are equal, 1 when they
+// differ and 2 on errors.
+func runDiff(args []string) int {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	formatA := fs.String("format-a", "", "format of the first file (codesys23, codesys35, plcopen); detected when empty")
+	formatB := fs.String("format-b", "", "format of the second file; detected when empty")
+	stat := fs.Bool("stat", false, "list changed objects only, without text diffs")
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, "iecst diff — semantic diff of two exports or .st trees\n\n")
+		fmt.Fprintln(os.Stderr, "Usage:")
+		fmt.Fprint(os.Stderr, "  iecst diff [-stat] [-format-a <name>] [-format-b <name>] <a> <b>\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return 2
+	}
+
+	work, err := os.MkdirTemp("", "iecst-diff-")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "cannot create temporary directory:", err)
+		return 2
+	}
+	defer os.RemoveAll(work)
+
+	a, err := loadInput(fs.Arg(0), *formatA, work)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", fs.Arg(0), err)
+		return 2
+	}
+	b, err := loadInput(fs.Arg(1), *formatB, work)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", fs.Arg(1), err)
+		return 2
+	}
+
+	changes := compareProjects(a, b)
+	if len(changes) == 0 {
+		return 0
+	}
+	fmt.Printf("--- %s\n+++ %s\n", fs.Arg(0), fs.Arg(1))
+	if *stat {
+		for i := range changes {
+			if changes[i].what == "declaration" || changes[i].what == "body" {
+				changes[i].detail = ""
+			}
+		}
+	}
+	printChanges(os.Stdout, changes)
+	return 1
+}
@@ -0,0 +1,783 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"html"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/damischa1/iec-st-tools/st"
+)
+
+// ── doc ───────────────────────────────────────────────────────────────────────
+
+// runDoc writes a static reference of a source tree: one page per POU, data
+// type and GVL, placed in the same folders as the .st files, so the
+// navigation follows the CoDeSys project tree. The text comes from the
+// comments the parser attaches to declarations (POU.Doc, VarDecl.Comment,
+// TypeDecl.Comment, EnumValue.Comment), which is where the importers put
+// the documentation of the original project.
+func runDoc(args []string) int {
+	flags := flag.NewFlagSet("doc", flag.ExitOnError)
+	format := flags.String("format", "html", "output format: html or md")
+	out := flags.String("out", "doc", "directory to write the pages to")
+	title := flags.String("title", "", "title of the reference (default the name of the source directory)")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, "iecst doc — generate an HTML or Markdown reference from declarations and comments\n\n")
+		fmt.Fprintln(os.Stderr, "Usage:")
+		fmt.Fprint(os.Stderr, "  iecst doc [-format html|md] [-out DIR] [-title TEXT] [source directory]\n\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if *format != "html" && *format != "md" {
+		fmt.Fprintf(os.Stderr, "iecst doc: unknown output format %q (want html or md)\n", *format)
+		return 2
+	}
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return 2
+	}
+	root := "."
+	if flags.NArg() == 1 {
+		root = flags.Arg(0)
+	}
+	proj, err := st.LoadProject(root)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "iecst doc:", err)
+		return 2
+	}
+	if findings := syntaxFindings(proj); len(findings) > 0 {
+		sortFindings(findings)
+		for _, f := range findings {
+			fmt.Fprintf(os.Stderr, "WARNING: %s:%d:%d: %s\n", f.File, f.Line, f.Column, f.Message)
+		}
+	}
+	if *title == "" {
+		abs, _ := filepath.Abs(root)
+		*title = filepath.Base(abs)
+	}
+
+	site := newDocSite(proj, root, *title)
+	for _, pg := range append([]*docPage{site.index}, site.pages...) {
+		var text string
+		if *format == "html" {
+			text = site.html(pg)
+		} else {
+			text = site.markdown(pg)
+		}
+		file := filepath.Join(*out, filepath.FromSlash(pg.path)+"."+*format)
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			fmt.Fprintln(os.Stderr, "iecst doc:", err)
+			return 2
+		}
+		if err := os.WriteFile(file, []byte(text), 0o644); err != nil {
+			fmt.Fprintln(os.Stderr, "iecst doc:", err)
+			return 2
+		}
+		fmt.Println(file)
+	}
+	return 0
+}
+
+// ── Site model ────────────────────────────────────────────────────────────────
+
+// docPage is one page of the reference. Exactly one of pou, td and gvl is
+// set, except for the index page.
+type docPage struct {
+	path    string // slash-separated output path without extension
+	folder  string // slash-separated folder below the root, "" for the root
+	name    string
+	kind    string // PROGRAM, FUNCTION_BLOCK, FUNCTION, STRUCT, ENUM, ALIAS, GVL
+	file    string // source file, relative to the root
+	summary string // first line of the documentation comment
+
+	pou *st.POU
+	td  *st.TypeDecl
+	gvl []*st.Symbol
+}
+
+type docSite struct {
+	p      *st.Project
+	title  string
+	index  *docPage
+	pages  []*docPage          // sorted by path
+	byName map[string]*docPage // upper-case POU and type names
+	gvls   map[string]*docPage // upper-case GVL names
+	users  map[*docPage][]docUser
+}
+
+// docUser is a declaration on another page that uses a type or function
+// block, for the "Used by" lists.
+type docUser struct {
+	page    *docPage
+	what    string // the POU, method or type on that page
+	extends bool
+}
+
+func newDocSite(p *st.Project, root, title string) *docSite {
+	s := &docSite{
+		p:      p,
+		title:  title,
+		index:  &docPage{path: "index", name: title},
+		byName: map[string]*docPage{},
+		gvls:   map[string]*docPage{},
+		users:  map[*docPage][]docUser{},
+	}
+	taken := map[string]bool{"index": true}
+	add := func(pg *docPage, f *st.File) {
+		rel, err := filepath.Rel(root, f.Name)
+		if err != nil {
+			rel = f.Name
+		}
+		pg.file = filepath.ToSlash(rel)
+		if dir := path.Dir(pg.file); dir != "." {
+			pg.folder = dir
+		}
+		pg.path = path.Join(pg.folder, pg.name)
+		if taken[strings.ToUpper(pg.path)] {
+			pg.path += "." + strings.ToLower(pg.kind)
+		}
+		taken[strings.ToUpper(pg.path)] = true
+		s.pages = append(s.pages, pg)
+	}
+	inTree := func(f *st.File) bool {
+		return f != nil && !p.IsTestFile(f)
+	}
+
+	for _, d := range p.POUs() {
+		if f := p.FileOf(d); inTree(f) {
+			pg := &docPage{name: d.Name.Name, kind: d.Kind.String(), summary: firstLine(d.Doc), pou: d}
+			add(pg, f)
+			s.byName[strings.ToUpper(d.Name.Name)] = pg
+		}
+	}
+	for _, td := range p.TypeDecls() {
+		if f := p.FileOf(td); inTree(f) {
+			pg := &docPage{name: td.Name.Name, kind: dutKind(td), summary: firstLine(td.Comment), td: td}
+			add(pg, f)
+			s.byName[strings.ToUpper(td.Name.Name)] = pg
+		}
+	}
+	var gvlOrder []string
+	gvlVars := map[string][]*st.Symbol{}
+	for _, g := range p.Globals() {
+		if !inTree(g.File) {
+			continue
+		}
+		key := strings.ToUpper(g.GVL)
+		if gvlVars[key] == nil {
+			gvlOrder = append(gvlOrder, key)
+		}
+		gvlVars[key] = append(gvlVars[key], g)
+	}
+	for _, key := range gvlOrder {
+		vars := gvlVars[key]
+		pg := &docPage{name: vars[0].GVL, kind: "GVL", gvl: vars}
+		add(pg, vars[0].File)
+		s.gvls[key] = pg
+	}
+	sort.Slice(s.pages, func(i, j int) bool { return strings.ToUpper(s.pages[i].path) < strings.ToUpper(s.pages[j].path) })
+
+	for _, e := range typeGraph(p).Edges {
+		to := s.byName[strings.ToUpper(e.To)]
+		var from *docPage
+		if s.gvls[strings.ToUpper(e.From)] != nil && s.byName[strings.ToUpper(e.From)] == nil {
+			from = s.gvls[strings.ToUpper(e.From)]
+		} else {
+			owner, _, _ := strings.Cut(e.From, ".")
+			from = s.byName[strings.ToUpper(owner)]
+		}
+		if to != nil && from != nil && from != to {
+			s.users[to] = append(s.users[to], docUser{page: from, what: e.From, extends: e.Kind == "extends"})
+		}
+	}
+	return s
+}
+
+func dutKind(td *st.TypeDecl) string {
+	switch td.Type.(type) {
+	case *st.StructType:
+		return "STRUCT"
+	case *st.EnumType:
+		return "ENUM"
+	}
+	return "ALIAS"
+}
+
+func firstLine(s string) string {
+	for _, l := range strings.Split(s, "\n") {
+		if l = strings.TrimSpace(l); l != "" {
+			return l
+		}
+	}
+	return ""
+}
+
+// folders returns the folders that contain pages, parents included, in
+// tree order.
+func (s *docSite) folders() []string {
+	seen := map[string]bool{"": true}
+	out := []string{""}
+	for _, pg := range s.pages {
+		parts := strings.Split(pg.folder, "/")
+		for i := range parts {
+			f := strings.Join(parts[:i+1], "/")
+			if f != "" && !seen[f] {
+				seen[f] = true
+				out = append(out, f)
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return strings.ToUpper(out[i]) < strings.ToUpper(out[j]) })
+	return out
+}
+
+// relLink returns the link from page from to page to, both output paths.
+func relLink(from, to, ext string) string {
+	a := strings.Split(path.Dir(from), "/")
+	b := strings.Split(to, "/")
+	if a[0] == "." {
+		a = nil
+	}
+	i := 0
+	for i < len(a) && i < len(b)-1 && a[i] == b[i] {
+		i++
+	}
+	return strings.Repeat("../", len(a)-i) + strings.Join(b[i:], "/") + ext
+}
+
+// ── Page content ──────────────────────────────────────────────────────────────
+
+// docWriter is the markup of one output format. Methods that return a
+// string produce inline markup for use in tables and paragraphs; the others
+// append blocks to the page.
+type docWriter interface {
+	heading(level int, markup string)
+	para(markup string)
+	comment(text string)
+	code(text string)
+	table(head []string, rows [][]string)
+	text(s string) string
+	code1(s string) string
+	link(markup, to string) string
+	cell(comment string) string
+}
+
+// content writes the body of a page.
+func (s *docSite) content(w docWriter, pg *docPage) {
+	if pg == s.index {
+		s.indexContent(w)
+		return
+	}
+	w.heading(1, w.text(pg.name))
+	meta := w.text(pg.kind)
+	if pg.folder != "" {
+		meta += " in " + w.text(pg.folder)
+	}
+	w.para(meta + " · " + w.code1(pg.file))
+	switch {
+	case pg.pou != nil:
+		s.pouContent(w, pg, pg.pou, 2)
+		if len(pg.pou.Methods) > 0 {
+			w.heading(2, w.text("Methods"))
+			for _, m := range pg.pou.Methods {
+				w.heading(3, w.text(m.Name.Name))
+				s.pouContent(w, pg, m, 4)
+			}
+		}
+	case pg.td != nil:
+		s.typeContent(w, pg, pg.td)
+	default:
+		s.gvlContent(w, pg)
+	}
+	if users := s.users[pg]; len(users) > 0 {
+		var ext, use []string
+		seen := map[string]bool{}
+		for _, u := range users {
+			l := w.link(w.text(u.what), u.page.path)
+			if u.extends {
+				ext = append(ext, l)
+			} else if !seen[u.what] {
+				seen[u.what] = true
+				use = append(use, l)
+			}
+		}
+		if len(ext) > 0 {
+			w.para("Extended by " + strings.Join(ext, ", "))
+		}
+		if len(use) > 0 {
+			w.para("Used by " + strings.Join(use, ", "))
+		}
+	}
+}
+
+func (s *docSite) indexContent(w docWriter) {
+	w.heading(1, w.text(s.title))
+	for _, folder := range s.folders() {
+		var rows [][]string
+		for _, pg := range s.pages {
+			if pg.folder == folder {
+				rows = append(rows, []string{w.link(w.text(pg.name), pg.path), w.text(pg.kind), w.text(pg.summary)})
+			}
+		}
+		if len(rows) == 0 {
+			continue
+		}
+		if folder != "" {
+			w.heading(2, w.text(folder))
+		}
+		w.table([]string{"Name", "Kind", "Description"}, rows)
+	}
+}
+
+func (s *docSite) pouContent(w docWriter, pg *docPage, d *st.POU, level int) {
+	if d.Doc != "" {
+		w.comment(d.Doc)
+	}
+	w.code(s.pouHeader(d))
+	if d.Extends != nil {
+		w.para("Extends " + s.typeRef(w, d.Extends.Name))
+	}
+	for _, sec := range []struct{ kind, title string }{
+		{"VAR_INPUT", "Inputs"},
+		{"VAR_OUTPUT", "Outputs"},
+		{"VAR_IN_OUT", "In-outs"},
+	} {
+		var rows [][]string
+		for _, b := range d.VarBlocks {
+			if b.Kind != sec.kind {
+				continue
+			}
+			for _, v := range b.Vars {
+				for _, id := range v.Names {
+					rows = append(rows, []string{w.code1(id.Name), s.typeMarkup(w, v.Type), s.initMarkup(w, id, v.Init), w.cell(v.Comment)})
+				}
+			}
+		}
+		if len(rows) > 0 {
+			w.heading(level, w.text(sec.title))
+			w.table([]string{"Name", "Type", "Default", "Description"}, rows)
+		}
+	}
+	if d.ReturnType != nil {
+		w.heading(level, w.text("Return value"))
+		w.para(s.typeMarkup(w, d.ReturnType))
+	}
+}
+
+// pouHeader renders the header and interface of a POU as in the source.
+func (s *docSite) pouHeader(d *st.POU) string {
+	var b strings.Builder
+	b.WriteString(d.Kind.String() + " " + d.Name.Name)
+	if d.Extends != nil {
+		b.WriteString(" EXTENDS " + d.Extends.Name)
+	}
+	if d.ReturnType != nil {
+		b.WriteString(" : " + typeSpecText(d.ReturnType))
+	}
+	for _, vb := range d.VarBlocks {
+		switch vb.Kind {
+		case "VAR_INPUT", "VAR_OUTPUT", "VAR_IN_OUT":
+		default:
+			continue
+		}
+		b.WriteString("\n" + blockTitle(vb))
+		for _, v := range vb.Vars {
+			names := make([]string, len(v.Names))
+			for i, id := range v.Names {
+				names[i] = id.Name
+			}
+			fmt.Fprintf(&b, "\n    %s : %s", strings.Join(names, ", "), typeSpecText(v.Type))
+			if v.Init != nil {
+				b.WriteString(" := " + s.initText(v.Names[0], v.Init))
+			}
+			b.WriteString(";")
+		}
+		b.WriteString("\nEND_VAR")
+	}
+	return b.String()
+}
+
+func (s *docSite) typeContent(w docWriter, pg *docPage, td *st.TypeDecl) {
+	if td.Comment != "" {
+		w.comment(td.Comment)
+	}
+	switch spec := td.Type.(type) {
+	case *st.StructType:
+		if td.Extends != nil {
+			w.para("Extends " + s.typeRef(w, td.Extends.Name))
+		}
+		var rows [][]string
+		for _, v := range spec.Fields {
+			for _, id := range v.Names {
+				rows = append(rows, []string{w.code1(id.Name), s.typeMarkup(w, v.Type), s.initMarkup(w, id, v.Init), w.cell(v.Comment)})
+			}
+		}
+		w.heading(2, w.text("Members"))
+		w.table([]string{"Name", "Type", "Default", "Description"}, rows)
+	case *st.EnumType:
+		if spec.Base != nil {
+			w.para("Base type " + s.typeMarkup(w, spec.Base))
+		}
+		t := s.p.TypeOfDecl(td)
+		var rows [][]string
+		for _, v := range spec.Values {
+			value := ""
+			if m := t.Member(v.Name.Name); m != nil {
+				value = fmt.Sprint(m.Value)
+			}
+			rows = append(rows, []string{w.code1(v.Name.Name), w.text(value), w.cell(v.Comment)})
+		}
+		w.heading(2, w.text("Values"))
+		w.table([]string{"Name", "Value", "Description"}, rows)
+	default:
+		w.para("Alias of " + s.typeMarkup(w, td.Type))
+	}
+	if td.Init != nil {
+		w.para("Default " + s.initMarkup(w, td.Name, td.Init))
+	}
+}
+
+func (s *docSite) gvlContent(w docWriter, pg *docPage) {
+	var blocks []*st.VarBlock
+	vars := map[*st.VarBlock][]*st.Symbol{}
+	located := false
+	for _, g := range pg.gvl {
+		if vars[g.Block] == nil {
+			blocks = append(blocks, g.Block)
+		}
+		vars[g.Block] = append(vars[g.Block], g)
+		located = located || g.Decl.At != nil
+	}
+	head := []string{"Name", "Type", "Initial value", "Description"}
+	if located {
+		head = []string{"Name", "Type", "Address", "Initial value", "Description"}
+	}
+	for _, b := range blocks {
+		var rows [][]string
+		for _, g := range vars[b] {
+			row := []string{w.code1(g.Name), s.typeMarkup(w, g.Decl.Type)}
+			if located {
+				at := ""
+				if g.Decl.At != nil {
+					at = w.code1(g.Decl.At.Text)
+				}
+				row = append(row, at)
+			}
+			rows = append(rows, append(row, s.initMarkup(w, g.Ident, g.Decl.Init), w.cell(g.Decl.Comment)))
+		}
+		w.heading(2, w.text(blockTitle(b)))
+		w.table(head, rows)
+	}
+}
+
+// typeRef links a type or function block name to its page.
+func (s *docSite) typeRef(w docWriter, name string) string {
+	short := name
+	if i := strings.LastIndexByte(short, '.'); i >= 0 {
+		short = short[i+1:] // library namespace
+	}
+	if pg := s.byName[strings.ToUpper(short)]; pg != nil && (pg.td != nil || pg.pou.Kind == st.FunctionBlock) {
+		return w.link(w.text(name), pg.path)
+	}
+	return w.text(name)
+}
+
+// typeMarkup renders a type expression with links to the pages of the
+// types it names.
+func (s *docSite) typeMarkup(w docWriter, ts st.TypeSpec) string {
+	switch t := ts.(type) {
+	case *st.NamedType:
+		return s.typeRef(w, t.Name.Name)
+	case *st.ArrayType:
+		return w.text(strings.TrimSuffix(typeSpecText(t), typeSpecText(t.Elem))) + s.typeMarkup(w, t.Elem)
+	case *st.PointerType:
+		return w.text(strings.TrimSuffix(typeSpecText(t), typeSpecText(t.Elem))) + s.typeMarkup(w, t.Elem)
+	case *st.SubrangeType:
+		return s.typeMarkup(w, t.Base) + w.text(strings.TrimPrefix(typeSpecText(t), typeSpecText(t.Base)))
+	}
+	return w.text(typeSpecText(ts))
+}
+
+// typeSpecText renders a type expression as it is written in ST.
+func typeSpecText(ts st.TypeSpec) string {
+	switch t := ts.(type) {
+	case *st.NamedType:
+		return t.Name.Name
+	case *st.StringType:
+		s := "STRING"
+		if t.Wide {
+			s = "WSTRING"
+		}
+		if t.Len != nil {
+			s += "(" + st.ExprString(t.Len) + ")"
+		}
+		return s
+	case *st.ArrayType:
+		dims := make([]string, len(t.Dims))
+		for i, d := range t.Dims {
+			dims[i] = st.ExprString(d.Lo) + ".." + st.ExprString(d.Hi)
+		}
+		return "ARRAY[" + strings.Join(dims, ", ") + "] OF " + typeSpecText(t.Elem)
+	case *st.PointerType:
+		if t.Ref {
+			return "REFERENCE TO " + typeSpecText(t.Elem)
+		}
+		return "POINTER TO " + typeSpecText(t.Elem)
+	case *st.StructType:
+		return "STRUCT"
+	case *st.EnumType:
+		names := make([]string, len(t.Values))
+		for i, v := range t.Values {
+			names[i] = v.Name.Name
+		}
+		return "(" + strings.Join(names, ", ") + ")"
+	case *st.SubrangeType:
+		return typeSpecText(t.Base) + "(" + st.ExprString(t.Range.Lo) + ".." + st.ExprString(t.Range.Hi) + ")"
+	}
+	return ""
+}
+
+func (s *docSite) initMarkup(w docWriter, id *st.Ident, e st.Expr) string {
+	if e == nil {
+		return ""
+	}
+	return w.code1(s.initText(id, e))
+}
+
+// initText returns an initial value as written in the source, so array and
+// structure initialisers keep their elements. The text runs to the ';' that
+// ends the declaration of id.
+func (s *docSite) initText(id *st.Ident, e st.Expr) string {
+	f := s.p.FileOf(id)
+	if f == nil || e.Pos().Offset >= len(f.Source) {
+		return st.ExprString(e)
+	}
+	src := f.Source[e.Pos().Offset:]
+	depth, end := 0, len(src)
+scan:
+	for i := 0; i < len(src); i++ {
+		switch c := src[i]; c {
+		case '(', '[':
+			if c == '(' && i+1 < len(src) && src[i+1] == '*' {
+				end = i
+				break scan
+			}
+			depth++
+		case ')', ']':
+			depth--
+			if depth < 0 {
+				end = i
+				break scan
+			}
+		case '\'', '"':
+			if j := strings.IndexByte(src[i+1:], c); j >= 0 {
+				i += j + 1
+			}
+		case ';', ',':
+			if depth == 0 {
+				end = i
+				break scan
+			}
+		case '/':
+			if i+1 < len(src) && src[i+1] == '/' {
+				end = i
+				break scan
+			}
+		}
+	}
+	return strings.Join(strings.Fields(src[:end]), " ")
+}
+
+// ── HTML ──────────────────────────────────────────────────────────────────────
+
+const docCSS = `body{margin:0;display:flex;font:15px/1.5 -apple-system,"Segoe UI",Helvetica,Arial,sans-serif;color:#222}
+nav{width:16rem;flex:none;padding:1rem;background:#f5f6f8;border-right:1px solid #ddd;min-height:100vh;box-sizing:border-box;font-size:14px}
+nav ul{list-style:none;margin:0;padding-left:1rem}nav>ul{padding:0}
+nav .folder{color:#666;font-weight:600}nav .current{font-weight:600}nav .home{display:block;font-weight:700;margin-bottom:.5rem}
+main{padding:1rem 2rem;max-width:60rem;flex:auto}a{color:#0b5cad;text-decoration:none}a:hover{text-decoration:underline}
+table{border-collapse:collapse;margin:.5rem 0 1rem}th,td{border:1px solid #ddd;padding:.25rem .6rem;text-align:left;vertical-align:top}
+th{background:#f5f6f8}pre{background:#f5f6f8;padding:.75rem;overflow:auto}code{font:13px/1.4 Menlo,Consolas,monospace}`
+
+type htmlWriter struct {
+	from string
+	b    strings.Builder
+}
+
+func (w *htmlWriter) heading(level int, markup string) {
+	fmt.Fprintf(&w.b, "<h%d>%s</h%d>\n", level, markup, level)
+}
+func (w *htmlWriter) para(markup string) { fmt.Fprintf(&w.b, "<p>%s</p>\n", markup) }
+func (w *htmlWriter) comment(text string) {
+	for _, p := range paragraphs(text) {
+		for i, l := range p {
+			p[i] = html.EscapeString(l)
+		}
+		w.para(strings.Join(p, "<br>\n"))
+	}
+}
+func (w *htmlWriter) code(text string) {
+	fmt.Fprintf(&w.b, "<pre><code>%s</code></pre>\n", html.EscapeString(text))
+}
+func (w *htmlWriter) table(head []string, rows [][]string) {
+	w.b.WriteString("<table>\n<tr>")
+	for _, h := range head {
+		fmt.Fprintf(&w.b, "<th>%s</th>", html.EscapeString(h))
+	}
+	w.b.WriteString("</tr>\n")
+	for _, r := range rows {
+		w.b.WriteString("<tr>")
+		for _, c := range r {
+			fmt.Fprintf(&w.b, "<td>%s</td>", c)
+		}
+		w.b.WriteString("</tr>\n")
+	}
+	w.b.WriteString("</table>\n")
+}
+func (w *htmlWriter) text(s string) string  { return html.EscapeString(s) }
+func (w *htmlWriter) code1(s string) string { return "<code>" + html.EscapeString(s) + "</code>" }
+func (w *htmlWriter) link(markup, to string) string {
+	return `<a href="` + html.EscapeString(relLink(w.from, to, ".html")) + `">` + markup + "</a>"
+}
+func (w *htmlWriter) cell(comment string) string {
+	lines := strings.Split(strings.TrimSpace(comment), "\n")
+	for i, l := range lines {
+		lines[i] = html.EscapeString(l)
+	}
+	return strings.Join(lines, "<br>")
+}
+
+func (s *docSite) html(pg *docPage) string {
+	w := &htmlWriter{from: pg.path}
+	s.content(w, pg)
+
+	var b strings.Builder
+	title := s.title
+	if pg != s.index {
+		title = pg.name + " — " + s.title
+	}
+	fmt.Fprintf(&b, "<!DOCTYPE html>\n<html lang=\"en\">\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n<style>\n%s\n</style>\n</head>\n<body>\n<nav>\n", html.EscapeString(title), docCSS)
+	fmt.Fprintf(&b, "<a class=\"home\" href=\"%s\">%s</a>\n", html.EscapeString(relLink(pg.path, "index", ".html")), html.EscapeString(s.title))
+	s.navTree(&b, w, pg, "")
+	fmt.Fprintf(&b, "</nav>\n<main>\n%s</main>\n</body>\n</html>\n", w.b.String())
+	return b.String()
+}
+
+// navTree writes the folder tree below folder as nested lists.
+func (s *docSite) navTree(b *strings.Builder, w *htmlWriter, cur *docPage, folder string) {
+	b.WriteString("<ul>\n")
+	for _, f := range s.folders() {
+		parent := path.Dir(f)
+		if parent == "." {
+			parent = ""
+		}
+		if f != "" && parent == folder {
+			fmt.Fprintf(b, "<li><span class=\"folder\">%s</span>\n", html.EscapeString(path.Base(f)))
+			s.navTree(b, w, cur, f)
+			b.WriteString("</li>\n")
+		}
+	}
+	for _, pg := range s.pages {
+		if pg.folder != folder {
+			continue
+		}
+		class := ""
+		if pg == cur {
+			class = ` class="current"`
+		}
+		fmt.Fprintf(b, "<li%s>%s</li>\n", class, w.link(html.EscapeString(pg.name), pg.path))
+	}
+	b.WriteString("</ul>\n")
+}
+
+// ── Markdown ──────────────────────────────────────────────────────────────────
+
+type mdWriter struct {
+	from string
+	b    strings.Builder
+}
+
+var mdEscaper = strings.NewReplacer(`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`, "[", `\[`, "]", `\]`, "<", `\<`, "|", `\|`)
+
+func (w *mdWriter) heading(level int, markup string) {
+	fmt.Fprintf(&w.b, "%s %s\n\n", strings.Repeat("#", level), markup)
+}
+func (w *mdWriter) para(markup string) { w.b.WriteString(markup + "\n\n") }
+func (w *mdWriter) comment(text string) {
+	for _, p := range paragraphs(text) {
+		for i, l := range p {
+			p[i] = mdEscaper.Replace(l)
+		}
+		w.para(strings.Join(p, "\\\n"))
+	}
+}
+func (w *mdWriter) code(text string) { fmt.Fprintf(&w.b, "```iec\n%s\n```\n\n", text) }
+func (w *mdWriter) table(head []string, rows [][]string) {
+	w.b.WriteString("| " + strings.Join(head, " | ") + " |\n|")
+	for _, h := range head {
+		w.b.WriteString(strings.Repeat("-", len(h)+2) + "|")
+	}
+	w.b.WriteString("\n")
+	for _, r := range rows {
+		w.b.WriteString("| " + strings.Join(r, " | ") + " |\n")
+	}
+	w.b.WriteString("\n")
+}
+func (w *mdWriter) text(s string) string { return mdEscaper.Replace(s) }
+func (w *mdWriter) code1(s string) string {
+	if s == "" {
+		return ""
+	}
+	s = strings.ReplaceAll(s, "|", `\|`)
+	if strings.Contains(s, "`") {
+		return "`` " + s + " ``"
+	}
+	return "`" + s + "`"
+}
+func (w *mdWriter) link(markup, to string) string {
+	return "[" + markup + "](" + relLink(w.from, to, ".md") + ")"
+}
+func (w *mdWriter) cell(comment string) string {
+	lines := strings.Split(strings.TrimSpace(comment), "\n")
+	for i, l := range lines {
+		lines[i] = mdEscaper.Replace(l)
+	}
+	return strings.Join(lines, "<br>")
+}
+
+func (s *docSite) markdown(pg *docPage) string {
+	w := &mdWriter{from: pg.path}
+	if pg != s.index {
+		crumbs := []string{w.link(w.text(s.title), "index")}
+		if pg.folder != "" {
+			crumbs = append(crumbs, w.text(pg.folder))
+		}
+		w.para(strings.Join(crumbs, " / "))
+	}
+	s.content(w, pg)
+	return strings.TrimRight(w.b.String(), "\n") + "\n"
+}
+
+// paragraphs splits comment text into paragraphs of lines at blank lines.
+func paragraphs(text string) [][]string {
+	var out [][]string
+	var cur []string
+	for _, l := range strings.Split(text, "\n") {
+		if l = strings.TrimRight(l, " \t"); l == "" {
+			if cur != nil {
+				out = append(out, cur)
+				cur = nil
+			}
+			continue
+		}
+		cur = append(cur, l)
+	}
+	if cur != nil {
+		out = append(out, cur)
+	}
+	return out
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+
+	"github.com/damischa1/iec-st-tools/st"
+)
+
+// ── Findings ──────────────────────────────────────────────────────────────────
+
+// finding is one diagnostic reported by lint or check.
+type finding struct {
+	Rule    string `json:"rule"`
+	Level   string `json:"level"` // error, warning or note
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Message string `json:"message"`
+}
+
+// ruleInfo describes a rule for the SARIF rule table.
+type ruleInfo struct {
+	id      string
+	summary string
+}
+
+// syntaxFindings converts the parse errors of a project into findings.
+func syntaxFindings(p *st.Project) []finding {
+	var out []finding
+	for f, list := range p.SyntaxErrors {
+		for _, e := range list {
+			out = append(out, finding{Rule: "syntax", Level: "error", File: f.Name, Line: e.Pos.Line, Column: e.Pos.Col, Message: e.Msg})
+		}
+	}
+	return out
+}
+
+func sortFindings(fs []finding) {
+	sort.SliceStable(fs, func(i, j int) bool {
+		a, b := fs[i], fs[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		if a.Column != b.Column {
+			return a.Column < b.Column
+		}
+		return a.Rule < b.Rule
+	})
+}
+
+// writeFindings writes findings as "text", "json" or "sarif".
+func writeFindings(w io.Writer, format, tool string, rules []ruleInfo, fs []finding) error {
+	switch format {
+	case "text":
+		for _, f := range fs {
+			fmt.Fprintf(w, "%s:%d:%d: %s: %s [%s]\n", f.File, f.Line, f.Column, f.Level, f.Message, f.Rule)
+		}
+		return nil
+	case "json":
+		if fs == nil {
+			fs = []finding{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(fs)
+	case "sarif":
+		return writeSARIF(w, tool, rules, fs)
+	}
+	return fmt.Errorf("unknown output format %q (want text, json or sarif)", format)
+}
+
+// ── SARIF ─────────────────────────────────────────────────────────────────────
+
+// writeSARIF writes a SARIF 2.1.0 log with one run, as consumed by GitHub
+// code scanning and most CI dashboards.
+func writeSARIF(w io.Writer, tool string, rules []ruleInfo, fs []finding) error {
+	type message struct {
+		Text string `json:"text"`
+	}
+	type rule struct {
+		ID               string  `json:"id"`
+		ShortDescription message `json:"shortDescription"`
+	}
+	type region struct {
+		StartLine   int `json:"startLine"`
+		StartColumn int `json:"startColumn"`
+	}
+	type artifact struct {
+		URI string `json:"uri"`
+	}
+	type physical struct {
+		ArtifactLocation artifact `json:"artifactLocation"`
+		Region           region   `json:"region"`
+	}
+	type location struct {
+		PhysicalLocation physical `json:"physicalLocation"`
+	}
+	type result struct {
+		RuleID    string     `json:"ruleId"`
+		Level     string     `json:"level"`
+		Message   message    `json:"message"`
+		Locations []location `json:"locations"`
+	}
+	type driver struct {
+		Name           string `json:"name"`
+		InformationURI string `json:"informationUri"`
+		Rules          []rule `json:"rules"`
+	}
+	type run struct {
+		Tool struct {
+			Driver driver `json:"driver"`
+		} `json:"tool"`
+		Results []result `json:"results"`
+	}
+	type log struct {
+		Schema  string `json:"$schema"`
+		Version string `json:"version"`
+		Runs    []run  `json:"runs"`
+	}
+
+	r := run{Results: []result{}}
+	r.Tool.Driver = driver{Name: tool, InformationURI: "https://github.com/damischa1/iec-st-tools", Rules: []rule{}}
+	for _, ri := range rules {
+		r.Tool.Driver.Rules = append(r.Tool.Driver.Rules, rule{ID: ri.id, ShortDescription: message{ri.summary}})
+	}
+	for _, f := range fs {
+		r.Results = append(r.Results, result{
+			RuleID:  f.Rule,
+			Level:   f.Level,
+			Message: message{f.Message},
+			Locations: []location{{PhysicalLocation: physical{
+				ArtifactLocation: artifact{URI: filepath.ToSlash(f.File)},
+				Region:           region{StartLine: f.Line, StartColumn: f.Column},
+			}}},
+		})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(log{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []run{r},
+	})
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/damischa1/iec-st-tools/st"
+)
+
+// ── fmt ───────────────────────────────────────────────────────────────────────
+
+// runFmt formats .st files with st.Format. Arguments are files or directories,
+// which are searched recursively for *.st; without arguments the source is
+// read from stdin and written to stdout, for editor integration.
+//
+// Without flags the formatted sources are printed. -w rewrites changed files
+// in place and -check only lists the files that are not formatted, exiting 1
+// if there are any, for CI. Files with syntax errors are reported and never
+// rewritten; they make the exit status 2.
+func runFmt(args []string) int {
+	flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	write := flags.Bool("w", false, "rewrite files in place instead of printing them")
+	check := flags.Bool("check", false, "list files whose formatting differs and exit 1 if there are any")
+	tabs := flags.Bool("tabs", false, "indent with tabs instead of four spaces")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, "iecst fmt — format Structured Text sources\n\n")
+		fmt.Fprintln(os.Stderr, "Usage:")
+		fmt.Fprint(os.Stderr, "  iecst fmt [-w | -check] [-tabs] [file or directory ...]\n\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if *write && *check {
+		fmt.Fprintln(os.Stderr, "iecst fmt: -w and -check are mutually exclusive")
+		return 2
+	}
+	opts := &st.FormatOptions{}
+	if *tabs {
+		opts.Indent = "\t"
+	}
+
+	if flags.NArg() == 0 {
+		src, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "iecst fmt:", err)
+			return 2
+		}
+		out, err := st.Format(string(src), opts)
+		if err != nil {
+			printSyntaxErrors("<stdin>", err)
+			return 2
+		}
+		if *check {
+			if out != string(src) {
+				fmt.Println("<stdin>")
+				return 1
+			}
+			return 0
+		}
+		fmt.Print(out)
+		return 0
+	}
+
+	files, err := collectSTFiles(flags.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "iecst fmt:", err)
+		return 2
+	}
+
+	status := 0
+	for _, path := range files {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "iecst fmt:", err)
+			status = 2
+			continue
+		}
+		out, err := st.Format(string(src), opts)
+		if err != nil {
+			printSyntaxErrors(path, err)
+			status = 2
+			continue
+		}
+		changed := !bytes.Equal(src, []byte(out))
+		switch {
+		case *check:
+			if changed {
+				fmt.Println(path)
+				if status == 0 {
+					status = 1
+				}
+			}
+		case *write:
+			if changed {
+				if err := os.WriteFile(path, []byte(out), 0644); err != nil {
+					fmt.Fprintln(os.Stderr, "iecst fmt:", err)
+					status = 2
+				}
+			}
+		default:
+			if len(files) > 1 {
+				fmt.Printf("// %s\n", path)
+			}
+			fmt.Print(out)
+		}
+	}
+	return status
+}
+
+// printSyntaxErrors prints the errors of st.Parse or st.Format as
+// "file:line:col: message" lines.
+func printSyntaxErrors(path string, err error) {
+	if list, ok := err.(st.ErrorList); ok {
+		for _, e := range list {
+			fmt.Fprintf(os.Stderr, "%s:%s: %s\n", path, e.Pos, e.Msg)
+		}
+		return
+	}
+	fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+}
+
+// collectSTFiles expands the arguments to a sorted list of .st files.
+// Directories are walked recursively; hidden directories are skipped.
+func collectSTFiles(args []string) ([]string, error) {
+	var files []string
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, arg)
+			continue
+		}
+		err = filepath.WalkDir(arg, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				if path != arg && strings.HasPrefix(d.Name(), ".") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if strings.EqualFold(filepath.Ext(path), ".st") {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
@@ -0,0 +1,475 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/damischa1/iec-st-tools/st"
+)
+
+// ── gen-io ────────────────────────────────────────────────────────────────────
+
+// runGenIO generates CONFIGURATION-wrapped GVLs from an I/O list kept as CSV
+// with the columns tag, address, type, comment and module. The declarations
+// go between "BEGIN gen-io" and "END gen-io" comments inside VAR_GLOBAL, where
+// the exporters keep them. New files are written whole; with -update only
+// the generated region of an existing file is replaced, so variables added
+// by hand around it stay. -check lists the files that are out of date with
+// the list and exits 1 if there are any, for CI.
+func runGenIO(args []string) int {
+	flags := flag.NewFlagSet("gen-io", flag.ExitOnError)
+	csvPath := flags.String("csv", "", "I/O list with the columns tag, address, type, comment and module (- for stdin)")
+	out := flags.String("out", ".", "directory of the GVL files")
+	gvl := flags.String("gvl", "GVL_IO", "name of the GVL and its file; with -split, the GVL of rows without module")
+	split := flags.Bool("split", false, "one GVL per module, named GVL_<module>")
+	update := flags.Bool("update", false, "rewrite the generated regions of existing files and keep everything else")
+	check := flags.Bool("check", false, "list files that differ from the I/O list and exit 1 if there are any")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, "iecst gen-io — generate GVLs with located variables from an I/O list\n\n")
+		fmt.Fprintln(os.Stderr, "Usage:")
+		fmt.Fprint(os.Stderr, "  iecst gen-io -csv FILE [-out DIR] [-gvl NAME] [-split] [-update | -check]\n\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if *csvPath == "" || flags.NArg() > 0 {
+		flags.Usage()
+		return 2
+	}
+	if *update && *check {
+		fmt.Fprintln(os.Stderr, "iecst gen-io: -update and -check are mutually exclusive")
+		return 2
+	}
+	if !stIdentRe.MatchString(*gvl) {
+		fmt.Fprintf(os.Stderr, "iecst gen-io: %q is not a valid GVL name\n", *gvl)
+		return 2
+	}
+
+	rows, findings, err := readIOList(*csvPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "iecst gen-io:", err)
+		return 2
+	}
+	sortFindings(findings)
+	writeFindings(os.Stderr, "text", "iecst gen-io", nil, findings)
+	for _, f := range findings {
+		if f.Level == "error" {
+			fmt.Fprintln(os.Stderr, "iecst gen-io: the I/O list has errors, nothing written")
+			return 1
+		}
+	}
+
+	source := filepath.Base(*csvPath)
+	if *csvPath == "-" {
+		source = "stdin"
+	}
+	status := 0
+	seen := map[string]bool{}
+	for _, g := range groupIORows(rows, *gvl, *split) {
+		path := filepath.Join(*out, g.name+".st")
+		seen[path] = true
+		region := ioRegion(g.rows, source, !*split)
+		old, err := os.ReadFile(path)
+		var text string
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			old = nil
+			text = newIOGVL(g.name, region)
+		case err != nil:
+			fmt.Fprintln(os.Stderr, "iecst gen-io:", err)
+			status = 2
+			continue
+		case !*update && !*check:
+			fmt.Fprintf(os.Stderr, "ERROR: %s exists; use -update to regenerate it\n", path)
+			status = max(status, 1)
+			continue
+		default:
+			if text, err = updateIOGVL(path, string(old), source, region, g.rows); err != nil {
+				fmt.Fprintf(os.Stderr, "ERROR: %s: %v\n", path, err)
+				status = max(status, 1)
+				continue
+			}
+		}
+		status = max(status, writeGenerated(path, old, text, *check))
+	}
+
+	// Files generated from this list earlier whose rows are all gone keep
+	// their hand-written variables and lose the generated ones.
+	if *update || *check {
+		stale, _ := filepath.Glob(filepath.Join(*out, "*.st"))
+		for _, path := range stale {
+			if seen[path] {
+				continue
+			}
+			old, err := os.ReadFile(path)
+			if err != nil {
+				continue
+			}
+			if begin, _ := findIORegion(strings.Split(string(old), "\n"), source); begin < 0 {
+				continue
+			}
+			text, err := updateIOGVL(path, string(old), source, ioRegion(nil, source, false), nil)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "ERROR: %s: %v\n", path, err)
+				status = max(status, 1)
+				continue
+			}
+			if text != string(old) {
+				fmt.Fprintf(os.Stderr, "WARNING: %s: no rows of %s left, generated region emptied\n", path, source)
+			}
+			status = max(status, writeGenerated(path, old, text, *check))
+		}
+	}
+	return status
+}
+
+// writeGenerated writes text to path when it differs from old and prints
+// the path; with check it only prints it and returns 1.
+func writeGenerated(path string, old []byte, text string, check bool) int {
+	if old != nil && string(old) == text {
+		return 0
+	}
+	fmt.Println(path)
+	if check {
+		return 1
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		fmt.Fprintln(os.Stderr, "iecst gen-io:", err)
+		return 2
+	}
+	if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+		fmt.Fprintln(os.Stderr, "iecst gen-io:", err)
+		return 2
+	}
+	return 0
+}
+
+// ── I/O list ──────────────────────────────────────────────────────────────────
+
+// ioRow is one line of the I/O list.
+type ioRow struct {
+	line    int
+	tag     string
+	addr    string // normalised
+	typ     string
+	comment string
+	module  string
+}
+
+var (
+	stIdentRe   = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	nonIdentRun = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+)
+
+// readIOList reads the CSV I/O list. The first line names the columns, in
+// any order and case; the separator is a comma, semicolon or tab, whichever
+// the header uses, since spreadsheets export all three. Bad rows are
+// reported as findings against the CSV file.
+func readIOList(path string) ([]ioRow, []finding, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	header, _, _ := bytes.Cut(data, []byte("\n"))
+	r := csv.NewReader(bytes.NewReader(data))
+	r.Comma = ','
+	for _, sep := range []rune{';', '\t'} {
+		if bytes.Count(header, []byte(string(sep))) > bytes.Count(header, []byte(string(r.Comma))) {
+			r.Comma = sep
+		}
+	}
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	head, err := r.Read()
+	if err == io.EOF {
+		return nil, nil, fmt.Errorf("%s: empty I/O list", path)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	col := map[string]int{}
+	for i, h := range head {
+		col[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	for _, name := range []string{"tag", "address", "type"} {
+		if _, ok := col[name]; !ok {
+			return nil, nil, fmt.Errorf("%s: the header has no %q column (want tag, address, type, comment, module)", path, name)
+		}
+	}
+
+	var rows []ioRow
+	var out []finding
+	tags := map[string]int{}
+	addrs := map[string]ioRow{}
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", path, err)
+		}
+		line, _ := r.FieldPos(0)
+		field := func(name string) string {
+			if c, ok := col[name]; ok && c < len(rec) {
+				return strings.TrimSpace(rec[c])
+			}
+			return ""
+		}
+		report := func(rule, level, format string, args ...any) {
+			out = append(out, finding{Rule: rule, Level: level, File: path, Line: line, Column: 1, Message: fmt.Sprintf(format, args...)})
+		}
+		if strings.TrimSpace(strings.Join(rec, "")) == "" {
+			continue
+		}
+		row := ioRow{
+			line:    line,
+			tag:     field("tag"),
+			typ:     field("type"),
+			comment: strings.Join(strings.Fields(field("comment")), " "),
+			module:  field("module"),
+		}
+		switch {
+		case row.tag == "":
+			report("tag", "error", "row has no tag")
+			continue
+		case !stIdentRe.MatchString(row.tag) || st.IsKeyword(row.tag):
+			report("tag", "error", "tag %q is not a valid ST identifier", row.tag)
+			continue
+		}
+		if prev, ok := tags[strings.ToUpper(row.tag)]; ok {
+			report("tag", "error", "tag %s is already used in line %d", row.tag, prev)
+			continue
+		}
+		tags[strings.ToUpper(row.tag)] = line
+
+		a := parseIOAddress(field("address"))
+		switch {
+		case field("address") == "":
+			report("address", "error", "%s has no address", row.tag)
+			continue
+		case a.err != "":
+			report("address", "error", "%s", a.err)
+			continue
+		}
+		row.addr = a.String()
+		if prev, ok := addrs[row.addr]; ok && !a.star {
+			level := "warning"
+			if a.area == 'Q' {
+				level = "error"
+			}
+			report("duplicate", level, "%s is at %s, like %s in line %d", row.tag, row.addr, prev.tag, prev.line)
+		} else {
+			addrs[row.addr] = row
+		}
+
+		if row.typ == "" {
+			report("type", "error", "%s has no type", row.tag)
+			continue
+		}
+		if _, err := st.Parse(path, "VAR_GLOBAL x : "+row.typ+"; END_VAR"); err != nil {
+			report("type", "error", "%s: %q is not a data type", row.tag, row.typ)
+			continue
+		}
+		rows = append(rows, row)
+	}
+	return rows, out, nil
+}
+
+// ioGVL is one generated GVL and its rows.
+type ioGVL struct {
+	name string
+	rows []ioRow
+}
+
+// groupIORows assigns the rows to GVLs: all to name, or with split one GVL
+// per module, in the order the modules first appear in the list.
+func groupIORows(rows []ioRow, name string, split bool) []ioGVL {
+	if !split {
+		return []ioGVL{{name, rows}}
+	}
+	var gvls []ioGVL
+	index := map[string]int{}
+	for _, r := range rows {
+		g := name
+		if r.module != "" {
+			g = "GVL_" + nonIdentRun.ReplaceAllString(r.module, "_")
+		}
+		i, ok := index[strings.ToUpper(g)]
+		if !ok {
+			i = len(gvls)
+			index[strings.ToUpper(g)] = i
+			gvls = append(gvls, ioGVL{name: g})
+		}
+		gvls[i].rows = append(gvls[i].rows, r)
+	}
+	return gvls
+}
+
+// ── Generated region ──────────────────────────────────────────────────────────
+
+const (
+	ioBegin = "// BEGIN gen-io"
+	ioEnd   = "// END gen-io"
+)
+
+// ioRegion returns the unindented lines of the generated region: the
+// markers and one declaration per row, in list order, aligned the way
+// iecst fmt aligns them. With modules,
+// a comment line introduces each run of rows of the same module.
+func ioRegion(rows []ioRow, source string, modules bool) []string {
+	lines := []string{ioBegin + " " + source + " — generated from the I/O list, edit the list instead"}
+	var wName, wType int
+	for _, r := range rows {
+		wName = max(wName, len(r.tag)+len(" AT ")+len(r.addr))
+		if r.comment != "" {
+			wType = max(wType, len(r.typ)+1)
+		}
+	}
+	module := ""
+	for _, r := range rows {
+		if modules && r.module != module && r.module != "" {
+			lines = append(lines, "// Module "+r.module)
+		}
+		module = r.module
+		decl := fmt.Sprintf("%-*s : %s;", wName, r.tag+" AT "+r.addr, r.typ)
+		if r.comment != "" {
+			decl = fmt.Sprintf("%-*s // %s", wName+3+wType, decl, r.comment)
+		}
+		lines = append(lines, decl)
+	}
+	return append(lines, ioEnd+" "+source)
+}
+
+// newIOGVL returns a new GVL file around the region, in the layout the
+// importers write.
+func newIOGVL(name string, region []string) string {
+	var b strings.Builder
+	b.WriteString("// trust-LSP wrapper — compiler extracts VAR_GLOBAL automatically\n")
+	fmt.Fprintf(&b, "CONFIGURATION %s\n    VAR_GLOBAL\n", name)
+	for _, l := range region {
+		b.WriteString("        " + l + "\n")
+	}
+	b.WriteString("    END_VAR\nEND_CONFIGURATION\n")
+	return b.String()
+}
+
+// updateIOGVL replaces the region generated from source in an existing GVL
+// file, or inserts it at the top of the first VAR_GLOBAL block. It fails
+// when a tag is also declared by hand, since the file would no longer
+// compile.
+func updateIOGVL(path, old, source string, region []string, rows []ioRow) (string, error) {
+	crlf := strings.Contains(old, "\r\n")
+	lines := strings.Split(strings.ReplaceAll(old, "\r\n", "\n"), "\n")
+
+	begin, end := findIORegion(lines, source)
+	var indent string
+	switch {
+	case begin >= 0 && end < 0:
+		return "", fmt.Errorf("line %d: %s %s has no matching %s", begin+1, ioBegin, source, ioEnd)
+	case begin >= 0:
+		indent = lines[begin][:len(lines[begin])-len(strings.TrimLeft(lines[begin], " \t"))]
+	default:
+		f, err := st.Parse(path, strings.Join(lines, "\n"))
+		if err != nil {
+			return "", err
+		}
+		blocks := globalBlocks(f)
+		if len(blocks) == 0 {
+			return "", fmt.Errorf("no VAR_GLOBAL block to put the generated region in")
+		}
+		vb := blocks[0]
+		kw := lines[vb.KwPos.Line-1]
+		indent = kw[:len(kw)-len(strings.TrimLeft(kw, " \t"))] + "    "
+		if len(vb.Vars) > 0 {
+			first := lines[vb.Vars[0].Pos().Line-1]
+			indent = first[:len(first)-len(strings.TrimLeft(first, " \t"))]
+		}
+		begin, end = vb.KwPos.Line, vb.KwPos.Line-1
+	}
+
+	var spliced []string
+	spliced = append(spliced, lines[:begin]...)
+	for _, l := range region {
+		spliced = append(spliced, indent+l)
+	}
+	spliced = append(spliced, lines[end+1:]...)
+	text := strings.Join(spliced, "\n")
+
+	// The tags must not be declared outside the region as well.
+	f, err := st.Parse(path, text)
+	if err != nil {
+		return "", err
+	}
+	tags := map[string]bool{}
+	for _, r := range rows {
+		tags[strings.ToUpper(r.tag)] = true
+	}
+	first, last := begin+1, begin+len(region)
+	for _, vb := range globalBlocks(f) {
+		for _, v := range vb.Vars {
+			for _, id := range v.Names {
+				if l := id.NamePos.Line; tags[strings.ToUpper(id.Name)] && (l < first || l > last) {
+					return "", fmt.Errorf("line %d: %s is declared by hand and in the I/O list", l, id.Name)
+				}
+			}
+		}
+	}
+	if crlf {
+		text = strings.ReplaceAll(text, "\n", "\r\n")
+	}
+	return text, nil
+}
+
+// findIORegion returns the line indexes of the markers of the region
+// generated from source, or -1.
+func findIORegion(lines []string, source string) (begin, end int) {
+	begin, end = -1, -1
+	for i, l := range lines {
+		t := strings.TrimSpace(l)
+		switch {
+		case begin < 0 && (t == ioBegin+" "+source || strings.HasPrefix(t, ioBegin+" "+source+" ")):
+			begin = i
+		case begin >= 0 && t == ioEnd+" "+source:
+			return begin, i
+		}
+	}
+	return begin, end
+}
+
+// globalBlocks returns the VAR_GLOBAL blocks of a file, inside a
+// CONFIGURATION or bare.
+func globalBlocks(f *st.File) []*st.VarBlock {
+	var out []*st.VarBlock
+	for _, d := range f.Decls {
+		var blocks []*st.VarBlock
+		switch d := d.(type) {
+		case *st.Configuration:
+			blocks = d.VarBlocks
+		case *st.VarBlock:
+			blocks = []*st.VarBlock{d}
+		}
+		for _, vb := range blocks {
+			if strings.EqualFold(vb.Kind, "VAR_GLOBAL") {
+				out = append(out, vb)
+			}
+		}
+	}
+	return out
+}
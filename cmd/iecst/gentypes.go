@@ -0,0 +1,514 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/format"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/damischa1/iec-st-tools/st"
+)
+
+// ── gen-types ─────────────────────────────────────────────────────────────────
+
+// runGenTypes generates host-side types for the STRUCT and enumeration DUTs
+// of a source tree: Go structs whose encoding/binary layout is the PLC's,
+// with explicit padding fields where the PLC aligns members and honouring
+// {attribute 'pack_mode'}, and one JSON Schema document per type for the
+// JSON form of the same structs. STRING(n) becomes a fixed [n+1]byte array
+// type that marshals as Latin-1 text. -types limits the output to some
+// types and the types they use.
+func runGenTypes(args []string) int {
+	flags := flag.NewFlagSet("gen-types", flag.ExitOnError)
+	goOut := flags.String("go", "", "write Go types to this file (- for stdout)")
+	pkg := flags.String("package", "plc", "package name of the Go file")
+	schemaDir := flags.String("schema", "", "write one <type>.schema.json per type to this directory")
+	only := flags.String("types", "", "comma-separated types to generate, with the types they use (default all STRUCT and enumeration types)")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, "iecst gen-types — Go structs and JSON Schema for STRUCT and enumeration DUTs\n\n")
+		fmt.Fprintln(os.Stderr, "Usage:")
+		fmt.Fprint(os.Stderr, "  iecst gen-types [-go FILE] [-package NAME] [-schema DIR] [-types T1,T2] [source directory]\n\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() > 1 || *goOut == "" && *schemaDir == "" {
+		flags.Usage()
+		return 2
+	}
+	if !token.IsIdentifier(*pkg) {
+		fmt.Fprintf(os.Stderr, "iecst gen-types: %q is not a valid package name\n", *pkg)
+		return 2
+	}
+	root := "."
+	if flags.NArg() == 1 {
+		root = flags.Arg(0)
+	}
+	proj, err := st.LoadProject(root)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "iecst gen-types:", err)
+		return 2
+	}
+
+	g := &typeGen{p: proj, done: map[*st.Type]bool{}, strings: map[string]*st.Type{}}
+	var roots []*st.TypeDecl
+	if *only == "" {
+		for _, td := range proj.TypeDecls() {
+			if f := proj.FileOf(td.Name); f != nil && !proj.IsTestFile(f) {
+				roots = append(roots, td)
+			}
+		}
+	} else {
+		for _, name := range strings.Split(*only, ",") {
+			td := proj.TypeDecl(strings.TrimSpace(name))
+			if td == nil {
+				fmt.Fprintf(os.Stderr, "iecst gen-types: unknown type %q\n", strings.TrimSpace(name))
+				return 2
+			}
+			roots = append(roots, td)
+		}
+	}
+	for _, td := range roots {
+		t := proj.TypeOfDecl(td)
+		if t.Class != st.StructClass && t.Class != st.EnumClass {
+			if *only != "" {
+				fmt.Fprintf(os.Stderr, "iecst gen-types: %s is neither a STRUCT nor an enumeration\n", td.Name.Name)
+				return 2
+			}
+			continue
+		}
+		if _, msg := typeLayout(t); msg != "" {
+			g.warn(td, "%s is not generated: %s", td.Name.Name, msg)
+			continue
+		}
+		g.add(t)
+	}
+	findings := append(syntaxFindings(proj), g.findings...)
+	sortFindings(findings)
+	writeFindings(os.Stderr, "text", "iecst gen-types", nil, findings)
+
+	if *goOut != "" {
+		abs, _ := filepath.Abs(root)
+		src, err := g.goSource(*pkg, filepath.Base(abs))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "iecst gen-types:", err)
+			return 2
+		}
+		if *goOut == "-" {
+			os.Stdout.Write(src)
+		} else if err := writeTypeFile(*goOut, src); err != nil {
+			fmt.Fprintln(os.Stderr, "iecst gen-types:", err)
+			return 2
+		}
+	}
+	if *schemaDir != "" {
+		for _, t := range g.types {
+			data, _ := json.MarshalIndent(g.schema(t), "", "  ")
+			path := filepath.Join(*schemaDir, t.Name+".schema.json")
+			if err := writeTypeFile(path, append(data, '\n')); err != nil {
+				fmt.Fprintln(os.Stderr, "iecst gen-types:", err)
+				return 2
+			}
+		}
+	}
+	return 0
+}
+
+func writeTypeFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return err
+	}
+	fmt.Println(path)
+	return nil
+}
+
+type typeGen struct {
+	p        *st.Project
+	types    []*st.Type          // STRUCT and enumeration types, used types first
+	done     map[*st.Type]bool   // types already in types
+	strings  map[string]*st.Type // Go name of a STRING type → the type
+	findings []finding
+}
+
+func (g *typeGen) warn(td *st.TypeDecl, format string, args ...any) {
+	f := finding{Rule: "type", Level: "warning", Line: td.Name.NamePos.Line, Column: td.Name.NamePos.Col, Message: fmt.Sprintf(format, args...)}
+	if file := g.p.FileOf(td.Name); file != nil {
+		f.File = file.Name
+	}
+	g.findings = append(g.findings, f)
+}
+
+// add records t and, first, the STRUCT, enumeration and STRING types its
+// members use. t has a layout, so its members have one too.
+func (g *typeGen) add(t *st.Type) {
+	t = underlying(g.p, t)
+	switch t.Class {
+	case st.ArrayClass:
+		g.add(t.Elem)
+		return
+	case st.StringClass:
+		g.strings[goStringType(t)] = t
+		return
+	case st.StructClass, st.EnumClass:
+	default:
+		return
+	}
+	if g.done[t] {
+		return
+	}
+	g.done[t] = true
+	if t.Base != nil && t.Class == st.StructClass {
+		g.add(t.Base)
+	}
+	for _, f := range t.Fields {
+		g.add(f.Type)
+	}
+	g.types = append(g.types, t)
+}
+
+// ── Go source ─────────────────────────────────────────────────────────────────
+
+// goBasic is the Go type of each elementary type. Times and dates are the
+// integers the PLC stores: milliseconds for TIME, nanoseconds for LTIME,
+// seconds since 1970 for DATE and DT, milliseconds since midnight for TOD.
+var goBasic = map[string]string{
+	"BOOL": "bool", "BYTE": "uint8", "WORD": "uint16", "DWORD": "uint32", "LWORD": "uint64",
+	"SINT": "int8", "INT": "int16", "DINT": "int32", "LINT": "int64",
+	"USINT": "uint8", "UINT": "uint16", "UDINT": "uint32", "ULINT": "uint64",
+	"REAL": "float32", "LREAL": "float64", "TIME": "uint32", "LTIME": "uint64",
+	"DATE": "uint32", "TOD": "uint32", "DT": "uint32",
+	"LDATE": "uint64", "LTOD": "uint64", "LDT": "uint64",
+	"CHAR": "uint8", "WCHAR": "uint16",
+}
+
+// goName makes an ST name an exported Go name.
+func goName(name string) string {
+	r := []rune(name)
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
+
+// goStringType is the name of the generated Go type for a STRING type.
+func goStringType(t *st.Type) string {
+	if t.Wide {
+		return "WString" + strconv.Itoa(t.Len)
+	}
+	return "String" + strconv.Itoa(t.Len)
+}
+
+// goType returns the Go type of a value of type t.
+func (g *typeGen) goType(t *st.Type) string {
+	t = underlying(g.p, t)
+	switch t.Class {
+	case st.ArrayClass:
+		var sb strings.Builder
+		for _, d := range t.Dims {
+			fmt.Fprintf(&sb, "[%d]", d.Len())
+		}
+		return sb.String() + g.goType(t.Elem)
+	case st.StringClass:
+		return goStringType(t)
+	case st.StructClass, st.EnumClass:
+		return goName(t.Name)
+	}
+	return goBasic[strings.ToUpper(t.Name)]
+}
+
+// goSource returns the gofmt-ed Go file with all types.
+func (g *typeGen) goSource(pkg, source string) ([]byte, error) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by iecst gen-types from %s; DO NOT EDIT.\n\n", source)
+	fmt.Fprintf(&b, "package %s\n\n", pkg)
+	wide, enums := false, false
+	for _, t := range g.strings {
+		wide = wide || t.Wide
+	}
+	for _, t := range g.types {
+		enums = enums || t.Class == st.EnumClass
+	}
+	if len(g.strings) > 0 || enums {
+		b.WriteString("import (\n\t\"fmt\"\n")
+		if wide {
+			b.WriteString("\t\"unicode/utf16\"\n")
+		}
+		b.WriteString(")\n\n")
+	}
+	b.WriteString("// The structs read and write with encoding/binary in the PLC's byte order,\n")
+	b.WriteString("// usually binary.LittleEndian; blank fields are the PLC's padding.\n")
+	for _, t := range g.types {
+		b.WriteString("\n")
+		if t.Class == st.EnumClass {
+			g.goEnum(&b, t)
+		} else {
+			g.goStruct(&b, t)
+		}
+	}
+	names := make([]string, 0, len(g.strings))
+	for n := range g.strings {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		b.WriteString("\n")
+		goString(&b, n, g.strings[n])
+	}
+	return format.Source(b.Bytes())
+}
+
+func goDoc(b *bytes.Buffer, indent, text string) {
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			fmt.Fprintf(b, "%s// %s\n", indent, line)
+		}
+	}
+}
+
+func (g *typeGen) goStruct(b *bytes.Buffer, t *st.Type) {
+	l, fields, _ := structLayout(t)
+	name := goName(t.Name)
+	fmt.Fprintf(b, "// %s is the STRUCT %s, %d bytes on the PLC.\n", name, t.Name, l.size)
+	if t.Decl != nil && t.Decl.Comment != "" {
+		b.WriteString("//\n")
+		goDoc(b, "", t.Decl.Comment)
+	}
+	fmt.Fprintf(b, "type %s struct {\n", name)
+	var off int64
+	if t.Base != nil {
+		bl, bfields, _ := structLayout(t.Base)
+		fmt.Fprintf(b, "\t%s\n", goName(t.Base.Name))
+		off = bl.size
+		fields = fields[len(bfields):]
+	}
+	for _, f := range fields {
+		if f.offset > off {
+			fmt.Fprintf(b, "\t_ [%d]byte\n", f.offset-off)
+		}
+		if f.field.Decl != nil {
+			goDoc(b, "\t", f.field.Decl.Comment)
+		}
+		fmt.Fprintf(b, "\t%s %s `json:\"%s\"`\n", goName(f.field.Name), g.goType(f.field.Type), f.field.Name)
+		off = f.offset + f.size
+	}
+	if l.size > off {
+		fmt.Fprintf(b, "\t_ [%d]byte\n", l.size-off)
+	}
+	b.WriteString("}\n")
+}
+
+func (g *typeGen) goEnum(b *bytes.Buffer, t *st.Type) {
+	name := goName(t.Name)
+	base := st.TypeInt
+	if t.Base != nil {
+		base = t.Base
+	}
+	fmt.Fprintf(b, "// %s is the enumeration %s.\n", name, t.Name)
+	if t.Decl != nil && t.Decl.Comment != "" {
+		b.WriteString("//\n")
+		goDoc(b, "", t.Decl.Comment)
+	}
+	fmt.Fprintf(b, "type %s %s\n\nconst (\n", name, g.goType(base))
+	for _, m := range t.Members {
+		fmt.Fprintf(b, "\t%s_%s %s = %d\n", name, m.Name, name, m.Value)
+	}
+	b.WriteString(")\n\n")
+	fmt.Fprintf(b, "func (v %s) String() string {\n\tswitch v {\n", name)
+	seen := map[int64]bool{}
+	for _, m := range t.Members {
+		if !seen[m.Value] {
+			seen[m.Value] = true
+			fmt.Fprintf(b, "\tcase %s_%s:\n\t\treturn %q\n", name, m.Name, m.Name)
+		}
+	}
+	fmt.Fprintf(b, "\t}\n\treturn fmt.Sprintf(\"%s(%%d)\", v)\n}\n", t.Name)
+}
+
+// goString writes the array type of a STRING or WSTRING and its text
+// methods. STRING holds Latin-1 bytes and WSTRING UTF-16, both ended by a
+// zero unless they are full.
+func goString(b *bytes.Buffer, name string, t *st.Type) {
+	n := t.Len
+	if t.Wide {
+		fmt.Fprintf(b, `// %[1]s is a WSTRING(%[2]d): UTF-16 code units ended by a zero.
+type %[1]s [%[3]d]uint16
+
+func (s %[1]s) String() string {
+	n := 0
+	for n < len(s) && s[n] != 0 {
+		n++
+	}
+	return string(utf16.Decode(s[:n]))
+}
+
+func (s %[1]s) MarshalText() ([]byte, error) { return []byte(s.String()), nil }
+
+func (s *%[1]s) UnmarshalText(text []byte) error {
+	u := utf16.Encode([]rune(string(text)))
+	if len(u) > %[2]d {
+		return fmt.Errorf("%%q does not fit in a WSTRING(%[2]d)", text)
+	}
+	*s = %[1]s{}
+	copy(s[:], u)
+	return nil
+}
+`, name, n, n+1)
+		return
+	}
+	fmt.Fprintf(b, `// %[1]s is a STRING(%[2]d): Latin-1 bytes ended by a zero.
+type %[1]s [%[3]d]byte
+
+func (s %[1]s) String() string {
+	r := make([]rune, 0, len(s))
+	for _, c := range s {
+		if c == 0 {
+			break
+		}
+		r = append(r, rune(c))
+	}
+	return string(r)
+}
+
+func (s %[1]s) MarshalText() ([]byte, error) { return []byte(s.String()), nil }
+
+func (s *%[1]s) UnmarshalText(text []byte) error {
+	var v %[1]s
+	i := 0
+	for _, r := range string(text) {
+		if r > 0xFF || i == %[2]d {
+			return fmt.Errorf("%%q does not fit in a STRING(%[2]d)", text)
+		}
+		v[i] = byte(r)
+		i++
+	}
+	*s = v
+	return nil
+}
+`, name, n, n+1)
+}
+
+// ── JSON Schema ───────────────────────────────────────────────────────────────
+
+// jsonSchema is the part of JSON Schema 2020-12 the generated documents use.
+type jsonSchema struct {
+	Schema      string        `json:"$schema,omitempty"`
+	ID          string        `json:"$id,omitempty"`
+	Ref         string        `json:"$ref,omitempty"`
+	Title       string        `json:"title,omitempty"`
+	Description string        `json:"description,omitempty"`
+	Type        string        `json:"type,omitempty"`
+	Properties  schemaProps   `json:"properties,omitempty"`
+	Required    []string      `json:"required,omitempty"`
+	Additional  *bool         `json:"additionalProperties,omitempty"`
+	Items       *jsonSchema   `json:"items,omitempty"`
+	MinItems    *int64        `json:"minItems,omitempty"`
+	MaxItems    *int64        `json:"maxItems,omitempty"`
+	MaxLength   *int          `json:"maxLength,omitempty"`
+	Minimum     json.Number   `json:"minimum,omitempty"`
+	Maximum     json.Number   `json:"maximum,omitempty"`
+	Const       *int64        `json:"const,omitempty"`
+	OneOf       []*jsonSchema `json:"oneOf,omitempty"`
+}
+
+// schemaProps keeps the properties in declaration order.
+type schemaProps []schemaProp
+
+type schemaProp struct {
+	name   string
+	schema *jsonSchema
+}
+
+func (ps schemaProps) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, p := range ps {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		k, _ := json.Marshal(p.name)
+		v, err := json.Marshal(p.schema)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(k)
+		b.WriteByte(':')
+		b.Write(v)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// schema returns the document of a STRUCT or enumeration type. Other DUTs
+// are referenced by file name; members of a base STRUCT are listed as the
+// struct's own, as they appear in the JSON of the Go struct.
+func (g *typeGen) schema(t *st.Type) *jsonSchema {
+	s := g.valueSchema(t, true)
+	s.Schema = "https://json-schema.org/draft/2020-12/schema"
+	s.ID = t.Name + ".schema.json"
+	s.Title = t.Name
+	if t.Decl != nil {
+		s.Description = strings.Join(strings.Fields(t.Decl.Comment), " ")
+	}
+	return s
+}
+
+func (g *typeGen) valueSchema(t *st.Type, top bool) *jsonSchema {
+	t = underlying(g.p, t)
+	switch t.Class {
+	case st.StructClass:
+		if !top {
+			return &jsonSchema{Ref: t.Name + ".schema.json"}
+		}
+		s := &jsonSchema{Type: "object", Additional: new(bool)}
+		_, fields, _ := structLayout(t)
+		for _, f := range fields {
+			fs := g.valueSchema(f.field.Type, false)
+			if f.field.Decl != nil && fs.Ref == "" {
+				fs.Description = strings.Join(strings.Fields(f.field.Decl.Comment), " ")
+			}
+			s.Properties = append(s.Properties, schemaProp{f.field.Name, fs})
+			s.Required = append(s.Required, f.field.Name)
+		}
+		return s
+	case st.EnumClass:
+		if !top {
+			return &jsonSchema{Ref: t.Name + ".schema.json"}
+		}
+		s := &jsonSchema{Type: "integer"}
+		for _, m := range t.Members {
+			v := m.Value
+			s.OneOf = append(s.OneOf, &jsonSchema{Const: &v, Title: m.Name})
+		}
+		return s
+	case st.ArrayClass:
+		s := g.valueSchema(t.Elem, false)
+		for i := len(t.Dims) - 1; i >= 0; i-- {
+			n := t.Dims[i].Len()
+			s = &jsonSchema{Type: "array", Items: s, MinItems: &n, MaxItems: &n}
+		}
+		return s
+	case st.StringClass:
+		n := t.Len
+		return &jsonSchema{Type: "string", MaxLength: &n}
+	case st.BoolClass:
+		return &jsonSchema{Type: "boolean"}
+	case st.RealClass:
+		return &jsonSchema{Type: "number"}
+	}
+	s := &jsonSchema{Type: "integer", Minimum: "0"}
+	if t.Class == st.IntClass && t.Signed {
+		s.Minimum = json.Number(strconv.FormatInt(int64(-1)<<(t.Bits-1), 10))
+		s.Maximum = json.Number(strconv.FormatInt(int64(1)<<(t.Bits-1)-1, 10))
+	} else {
+		s.Maximum = json.Number(strconv.FormatUint(uint64(1)<<t.Bits-1, 10))
+	}
+	return s
+}
@@ -0,0 +1,457 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/damischa1/iec-st-tools/st"
+)
+
+// ── iomap ─────────────────────────────────────────────────────────────────────
+
+// runIomap lists every variable declared AT a direct address, in GVLs and in
+// POUs, and checks the map: malformed addresses, two variables at the same
+// address, overlapping ranges and types whose size does not fit the address.
+// The map goes to stdout in the chosen format, the findings to stderr.
+func runIomap(args []string) int {
+	flags := flag.NewFlagSet("iomap", flag.ExitOnError)
+	format := flags.String("format", "text", "output format: text, csv, md or json")
+	mode := flags.String("addressing", "indexed", "meaning of the number in %IW, %ID, %IL: indexed (CoDeSys: %IW2 is byte 4) or byte (%IW2 is byte 2)")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, "iecst iomap — I/O address map of Structured Text sources, with conflict checks\n\n")
+		fmt.Fprintln(os.Stderr, "Usage:")
+		fmt.Fprint(os.Stderr, "  iecst iomap [-format text|csv|md|json] [-addressing indexed|byte] [file or directory ...]\n\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	switch *format {
+	case "text", "csv", "md", "json":
+	default:
+		fmt.Fprintf(os.Stderr, "iecst iomap: unknown output format %q (want text, csv, md or json)\n", *format)
+		return 2
+	}
+	if *mode != "indexed" && *mode != "byte" {
+		fmt.Fprintf(os.Stderr, "iecst iomap: unknown addressing %q (want indexed or byte)\n", *mode)
+		return 2
+	}
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	proj, err := st.LoadProject(paths...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "iecst iomap:", err)
+		return 2
+	}
+
+	entries := collectIO(proj, *mode == "byte")
+	findings := append(syntaxFindings(proj), checkIO(entries)...)
+	sortFindings(findings)
+	sortIO(entries)
+
+	switch *format {
+	case "text":
+		writeIOText(os.Stdout, entries)
+	case "csv":
+		err = writeIOCSV(os.Stdout, entries)
+	case "md":
+		writeIOMarkdown(os.Stdout, entries)
+	case "json":
+		if entries == nil {
+			entries = []*ioEntry{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(entries)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "iecst iomap:", err)
+		return 2
+	}
+	writeFindings(os.Stderr, "text", "iecst iomap", nil, findings)
+	for _, f := range findings {
+		if f.Level == "error" {
+			return 1
+		}
+	}
+	return 0
+}
+
+// ── Address model ─────────────────────────────────────────────────────────────
+
+// ioEntry is one located variable.
+type ioEntry struct {
+	Address  string `json:"address"`            // normalised: %IX0.3, %QW4, %M*
+	Declared string `json:"declared,omitempty"` // as written, when it differs
+	Area     string `json:"area"`               // input, output or memory
+	Offset   string `json:"offset,omitempty"`   // byte or byte.bit; empty when not known
+	Bits     int64  `json:"bits,omitempty"`     // bits the variable occupies
+	Variable string `json:"variable"`           // GVL.name, POU.name or FB.Method.name
+	Type     string `json:"type"`
+	Comment  string `json:"comment,omitempty"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+
+	addr ioAddress
+	typ  *st.Type
+	from int64 // first bit in the area, for ranged addresses
+}
+
+// ioAddress is a parsed direct address.
+type ioAddress struct {
+	area   byte // I, Q or M
+	size   int  // bits of the address unit: 1 (X), 8, 16, 32 or 64
+	fields []int64
+	star   bool   // incomplete address %I*, assigned by the configuration
+	ranged bool   // plain byte.bit or index form, so overlaps can be checked
+	err    string // why the address is malformed
+}
+
+var ioAddrRe = regexp.MustCompile(`^%([IQMiqm])([XBWDLxbwdl]?)(\*|[0-9]+(?:\.[0-9]+)*)$`)
+
+var ioSizes = map[byte]int{'X': 1, 'B': 8, 'W': 16, 'D': 32, 'L': 64}
+
+// parseIOAddress parses %IX0.0, %I0.0, %QB3, %MW10, %IX1.2.3 and %I*.
+func parseIOAddress(text string) ioAddress {
+	m := ioAddrRe.FindStringSubmatch(text)
+	if m == nil {
+		return ioAddress{err: fmt.Sprintf("%s is not a direct address of the form %%<I|Q|M><X|B|W|D|L><number>", text)}
+	}
+	a := ioAddress{area: strings.ToUpper(m[1])[0], size: 1}
+	if m[2] != "" {
+		a.size = ioSizes[strings.ToUpper(m[2])[0]]
+	}
+	if m[3] == "*" {
+		a.star = true
+		return a
+	}
+	for _, f := range strings.Split(m[3], ".") {
+		n, err := strconv.ParseInt(f, 10, 64)
+		if err != nil {
+			return ioAddress{err: fmt.Sprintf("%s: address %s is out of range", text, f)}
+		}
+		a.fields = append(a.fields, n)
+	}
+	switch {
+	case a.size == 1 && len(a.fields) == 2:
+		if a.fields[1] > 7 {
+			return ioAddress{err: fmt.Sprintf("%s: bit number %d is not in 0..7", text, a.fields[1])}
+		}
+		a.ranged = true
+	case a.size > 1 && len(a.fields) == 1:
+		a.ranged = true
+	}
+	return a
+}
+
+// String returns the normalised address: upper case, explicit X for bits and
+// no leading zeros.
+func (a ioAddress) String() string {
+	var b strings.Builder
+	b.WriteByte('%')
+	b.WriteByte(a.area)
+	for _, k := range []byte("XBWDL") {
+		if ioSizes[k] == a.size && !(a.star && k == 'X') {
+			b.WriteByte(k)
+		}
+	}
+	if a.star {
+		b.WriteByte('*')
+		return b.String()
+	}
+	for i, f := range a.fields {
+		if i > 0 {
+			b.WriteByte('.')
+		}
+		b.WriteString(strconv.FormatInt(f, 10))
+	}
+	return b.String()
+}
+
+// start returns the first bit the address refers to. With indexed
+// addressing the number of %IW, %ID and %IL counts units of that size, as in
+// CoDeSys; with byte addressing it is a byte offset.
+func (a ioAddress) start(byteAddressing bool) int64 {
+	if a.size == 1 {
+		return a.fields[0]*8 + a.fields[1]
+	}
+	if byteAddressing {
+		return a.fields[0] * 8
+	}
+	return a.fields[0] * int64(a.size)
+}
+
+var ioAreas = map[byte]string{'I': "input", 'Q': "output", 'M': "memory"}
+
+// ioStorage returns the size of one element of a located variable and the
+// bits it occupies in total. total is 0 when the size is not known.
+func ioStorage(t *st.Type) (elem int, total int64) {
+	switch t.Class {
+	case st.BoolClass, st.BitsClass, st.IntClass, st.RealClass, st.CharClass, st.TimeClass, st.DateClass, st.EnumClass:
+		return t.Bits, int64(t.Bits)
+	case st.StringClass:
+		unit := 8
+		if t.Wide {
+			unit = 16
+		}
+		return unit, int64(unit * (t.Len + 1))
+	case st.ArrayClass:
+		elem, _ := ioStorage(t.Elem)
+		if t.Elem.Class == st.BoolClass {
+			elem = 8 // BOOL array elements take a byte each
+		}
+		n := int64(1)
+		for _, d := range t.Dims {
+			if !d.Known {
+				return elem, 0
+			}
+			n *= d.Len()
+		}
+		if t.Elem.Class == st.ArrayClass || t.Elem.Class == st.StringClass {
+			_, inner := ioStorage(t.Elem)
+			return elem, inner * n
+		}
+		return elem, int64(elem) * n
+	}
+	return 0, 0
+}
+
+// ── Collection and checks ─────────────────────────────────────────────────────
+
+func collectIO(p *st.Project, byteAddressing bool) []*ioEntry {
+	var out []*ioEntry
+	add := func(sc *st.Scope, owner string, id *st.Ident, v *st.VarDecl) {
+		e := &ioEntry{
+			Declared: v.At.Text,
+			Variable: owner + "." + id.Name,
+			Comment:  strings.Join(strings.Fields(v.Comment), " "),
+			Line:     id.NamePos.Line,
+			Column:   id.NamePos.Col,
+			addr:     parseIOAddress(v.At.Text),
+			typ:      sc.ResolveType(v.Type),
+		}
+		if f := p.FileOf(id); f != nil {
+			e.File = f.Name
+		}
+		e.Type = e.typ.Name
+		if e.addr.err == "" {
+			e.Address = e.addr.String()
+			e.Area = ioAreas[e.addr.area]
+		} else {
+			e.Address = v.At.Text
+		}
+		if e.Declared == e.Address {
+			e.Declared = ""
+		}
+		_, e.Bits = ioStorage(e.typ)
+		if e.addr.ranged {
+			e.from = e.addr.start(byteAddressing)
+			if e.Bits == 0 {
+				e.Bits = int64(e.addr.size)
+			}
+			e.Offset = strconv.FormatInt(e.from/8, 10)
+			if e.addr.size == 1 {
+				e.Offset += "." + strconv.FormatInt(e.from%8, 10)
+			}
+		}
+		out = append(out, e)
+	}
+	gs := p.GlobalScope()
+	for _, g := range p.Globals() {
+		if g.Decl.At != nil {
+			add(gs, g.GVL, g.Ident, g.Decl)
+		}
+	}
+	for _, d := range p.POUs() {
+		for _, u := range append([]*st.POU{d}, d.Methods...) {
+			sc := p.Scope(u)
+			for _, b := range u.VarBlocks {
+				for _, v := range b.Vars {
+					if v.At == nil {
+						continue
+					}
+					for _, id := range v.Names {
+						add(sc, xrefPOUName(p, u), id, v)
+					}
+				}
+			}
+		}
+	}
+	return out
+}
+
+// checkIO reports malformed addresses, sizes that do not fit the address,
+// and variables that share or overlap an address.
+func checkIO(entries []*ioEntry) []finding {
+	var out []finding
+	report := func(e *ioEntry, rule, level, format string, args ...any) {
+		out = append(out, finding{Rule: rule, Level: level, File: e.File, Line: e.Line, Column: e.Column, Message: fmt.Sprintf(format, args...)})
+	}
+	var ranged []*ioEntry
+	for _, e := range entries {
+		if e.addr.err != "" {
+			report(e, "address", "error", "%s", e.addr.err)
+			continue
+		}
+		if e.addr.star {
+			continue
+		}
+		elem, total := ioStorage(e.typ)
+		switch {
+		case e.typ.Class == st.InvalidClass:
+		case e.addr.size == 1 && e.typ.Class != st.BoolClass:
+			report(e, "size", "error", "%s at bit address %s must be BOOL, not %s", e.Variable, e.Address, e.Type)
+		case e.addr.size > 1 && e.typ.Class == st.BoolClass:
+			report(e, "size", "error", "BOOL %s needs a bit address %%%cX…, not %s", e.Variable, e.addr.area, e.Address)
+		case e.addr.size > 1 && elem != 0 && elem != e.addr.size:
+			report(e, "size", "error", "%s is %s (%d bits) but %s addresses %d bits", e.Variable, e.Type, elem, e.Address, e.addr.size)
+		case elem == 0 || total == 0:
+			report(e, "size", "warning", "size of %s (%s) is not known; its range is not checked", e.Variable, e.Type)
+		}
+		if e.addr.ranged {
+			ranged = append(ranged, e)
+		}
+	}
+
+	// Conflicts are reported on the later declaration, naming the earlier one.
+	sort.SliceStable(ranged, func(i, j int) bool { return ioBefore(ranged[i], ranged[j]) })
+	for i, e := range ranged {
+		for _, o := range ranged[:i] {
+			if o.addr.area != e.addr.area || o.from >= e.from+e.Bits || e.from >= o.from+o.Bits {
+				continue
+			}
+			where := fmt.Sprintf("%s:%d", o.File, o.Line)
+			if o.Address == e.Address && o.Bits == e.Bits {
+				level := "warning"
+				if e.addr.area == 'Q' {
+					level = "error" // two writers of the same output
+				}
+				report(e, "duplicate", level, "%s is at %s, like %s (%s)", e.Variable, e.Address, o.Variable, where)
+			} else {
+				report(e, "overlap", "warning", "%s at %s overlaps %s at %s (%s)", e.Variable, e.Address, o.Variable, o.Address, where)
+			}
+		}
+	}
+	return out
+}
+
+// ioBefore orders entries by source position.
+func ioBefore(a, b *ioEntry) bool {
+	if a.File != b.File {
+		return a.File < b.File
+	}
+	if a.Line != b.Line {
+		return a.Line < b.Line
+	}
+	return a.Column < b.Column
+}
+
+// sortIO orders the map by area (inputs, outputs, memory), then by position
+// in the area; incomplete and malformed addresses come last.
+func sortIO(entries []*ioEntry) {
+	rank := func(e *ioEntry) int {
+		switch {
+		case e.addr.err != "":
+			return 9
+		case e.addr.star:
+			return strings.IndexByte("IQM", e.addr.area)*2 + 1
+		}
+		return strings.IndexByte("IQM", e.addr.area) * 2
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if ra, rb := rank(a), rank(b); ra != rb {
+			return ra < rb
+		}
+		if a.addr.ranged != b.addr.ranged {
+			return a.addr.ranged
+		}
+		if a.from != b.from {
+			return a.from < b.from
+		}
+		if a.Address != b.Address {
+			return a.Address < b.Address
+		}
+		return ioBefore(a, b)
+	})
+}
+
+// ── Output ────────────────────────────────────────────────────────────────────
+
+func writeIOText(w io.Writer, entries []*ioEntry) {
+	rows := [][]string{{"ADDRESS", "OFFSET", "VARIABLE", "TYPE", "SOURCE", "COMMENT"}}
+	for _, e := range entries {
+		rows = append(rows, []string{e.Address, e.Offset, e.Variable, e.Type, fmt.Sprintf("%s:%d", e.File, e.Line), e.Comment})
+	}
+	widths := make([]int, len(rows[0]))
+	for _, r := range rows {
+		for i, c := range r {
+			widths[i] = max(widths[i], len([]rune(c)))
+		}
+	}
+	for _, r := range rows {
+		var b strings.Builder
+		for i, c := range r {
+			if i == len(r)-1 {
+				b.WriteString(c)
+				break
+			}
+			b.WriteString(c + strings.Repeat(" ", widths[i]-len([]rune(c))+2))
+		}
+		fmt.Fprintln(w, strings.TrimRight(b.String(), " "))
+	}
+}
+
+func writeIOCSV(w io.Writer, entries []*ioEntry) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"address", "area", "offset", "bits", "variable", "type", "comment", "declared", "file", "line"})
+	for _, e := range entries {
+		bits := ""
+		if e.Bits > 0 {
+			bits = strconv.FormatInt(e.Bits, 10)
+		}
+		cw.Write([]string{e.Address, e.Area, e.Offset, bits, e.Variable, e.Type, e.Comment, e.Declared, e.File, strconv.Itoa(e.Line)})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func writeIOMarkdown(w io.Writer, entries []*ioEntry) {
+	sections := []struct {
+		title string
+		keep  func(e *ioEntry) bool
+	}{
+		{"Inputs (%I)", func(e *ioEntry) bool { return e.addr.err == "" && e.addr.area == 'I' }},
+		{"Outputs (%Q)", func(e *ioEntry) bool { return e.addr.err == "" && e.addr.area == 'Q' }},
+		{"Memory (%M)", func(e *ioEntry) bool { return e.addr.err == "" && e.addr.area == 'M' }},
+		{"Invalid addresses", func(e *ioEntry) bool { return e.addr.err != "" }},
+	}
+	fmt.Fprint(w, "# I/O map\n")
+	for _, sec := range sections {
+		var rows []*ioEntry
+		for _, e := range entries {
+			if sec.keep(e) {
+				rows = append(rows, e)
+			}
+		}
+		if len(rows) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "\n## %s\n\n", sec.title)
+		fmt.Fprintln(w, "| Address | Variable | Type | Description | Source |")
+		fmt.Fprintln(w, "|---------|----------|------|-------------|--------|")
+		for _, e := range rows {
+			fmt.Fprintf(w, "| `%s` | %s | %s | %s | %s:%d |\n", e.Address, mdEscaper.Replace(e.Variable), mdEscaper.Replace(e.Type), mdEscaper.Replace(e.Comment), mdEscaper.Replace(e.File), e.Line)
+		}
+	}
+}
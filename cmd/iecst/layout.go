@@ -0,0 +1,131 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/damischa1/iec-st-tools/st"
+)
+
+// ── Memory layout ─────────────────────────────────────────────────────────────
+
+// memLayout is the size and alignment in bytes of a type in PLC memory.
+// Elementary types are aligned to their size, as on the 64-bit and ARM
+// targets of CoDeSys V3; STRUCT members are padded to their alignment,
+// capped by the struct's {attribute 'pack_mode'}.
+type memLayout struct {
+	size, align int64
+}
+
+// fieldLayout places one member of a STRUCT, base struct members included.
+type fieldLayout struct {
+	field  *st.Field
+	offset int64
+	memLayout
+}
+
+// typeLayout returns the layout of t. msg says why a type has none:
+// pointers, references and function block instances depend on the target,
+// and array bounds must be constant.
+func typeLayout(t *st.Type) (l memLayout, msg string) {
+	switch t.Class {
+	case st.BoolClass:
+		return memLayout{1, 1}, ""
+	case st.StringClass:
+		if t.Wide {
+			return memLayout{2 * int64(t.Len+1), 2}, ""
+		}
+		return memLayout{int64(t.Len + 1), 1}, ""
+	case st.BitsClass, st.IntClass, st.RealClass, st.CharClass, st.TimeClass, st.DateClass, st.EnumClass:
+		n := int64(t.Bits / 8)
+		return memLayout{n, n}, ""
+	case st.ArrayClass:
+		el, msg := typeLayout(t.Elem)
+		if msg != "" {
+			return memLayout{}, msg
+		}
+		n := int64(1)
+		for _, d := range t.Dims {
+			if !d.Known {
+				return memLayout{}, "array bounds of " + t.Name + " are not constant"
+			}
+			n *= d.Len()
+		}
+		return memLayout{n * el.size, el.align}, ""
+	case st.StructClass:
+		l, _, msg := structLayout(t)
+		return l, msg
+	case st.PointerClass:
+		return memLayout{}, t.Name + " has a target-dependent size"
+	case st.InstanceClass:
+		return memLayout{}, "function block instance " + t.Name + " has no fixed layout"
+	}
+	return memLayout{}, "unknown type " + t.Name
+}
+
+// structLayout returns the layout of a STRUCT and the offsets of its
+// members. The members of an EXTENDS base come first, laid out as the base
+// struct on its own; the struct's members follow at the base's size.
+// pack_mode applies to the base as a whole, like to any member.
+func structLayout(t *st.Type) (l memLayout, fields []fieldLayout, msg string) {
+	pack, msg := packMode(t)
+	if msg != "" {
+		return memLayout{}, nil, msg
+	}
+	l.align = 1
+	if t.Base != nil {
+		if l, fields, msg = structLayout(t.Base); msg != "" {
+			return memLayout{}, nil, msg
+		}
+		l.align = min(l.align, pack)
+	}
+	off := l.size
+	for _, f := range t.Fields {
+		fl, msg := typeLayout(f.Type)
+		if msg != "" {
+			return memLayout{}, nil, t.Name + "." + f.Name + ": " + msg
+		}
+		a := min(fl.align, pack)
+		off = alignUp(off, a)
+		fields = append(fields, fieldLayout{f, off, fl})
+		off += fl.size
+		l.align = max(l.align, a)
+	}
+	l.size = alignUp(off, l.align)
+	return l, fields, ""
+}
+
+// packMode returns the largest alignment {attribute 'pack_mode'} allows in
+// a STRUCT: 8 without the attribute, and 1 for '0' and '1', which both
+// leave no gaps.
+func packMode(t *st.Type) (int64, string) {
+	if t.Decl == nil {
+		return 8, ""
+	}
+	v, ok := t.Decl.Attribute("pack_mode")
+	if !ok {
+		return 8, ""
+	}
+	switch v = strings.TrimSpace(v); v {
+	case "0", "1":
+		return 1, ""
+	case "2", "4", "8":
+		n, _ := strconv.Atoi(v)
+		return int64(n), ""
+	}
+	return 0, "invalid pack_mode '" + v + "' on " + t.Name
+}
+
+// underlying follows aliases of elementary, string and array types to the
+// type they name; STRUCT and enumeration types keep their own name.
+func underlying(p *st.Project, t *st.Type) *st.Type {
+	if t.Class == st.StructClass || t.Class == st.EnumClass {
+		return t
+	}
+	for i := 0; i < 8 && st.Elementary(t.Name) == nil && t.Decl != nil; i++ {
+		t = p.GlobalScope().ResolveType(t.Decl.Type)
+	}
+	return t
+}
+
+func alignUp(n, a int64) int64 { return (n + a - 1) / a * a }
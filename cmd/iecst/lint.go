@@ -0,0 +1,560 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/damischa1/iec-st-tools/st"
+)
+
+// ── lint ──────────────────────────────────────────────────────────────────────
+
+// lintRule is one check of iecst lint. Rules are independent: each walks the
+// project through the shared lintContext and reports findings. New rules
+// only need an entry in lintRules.
+type lintRule struct {
+	id      string
+	level   string // default level: error, warning or note
+	summary string
+	check   func(c *lintContext)
+}
+
+var lintRules = []*lintRule{
+	{"unused-variable", "warning", "local variable is never used", lintUnused},
+	{"unassigned-output", "warning", "output of a FUNCTION_BLOCK is never assigned", lintUnassignedOutput},
+	{"unassigned-result", "warning", "return value of a FUNCTION or METHOD is never assigned", lintUnassignedResult},
+	{"case-enum-else", "warning", "CASE on an enumeration has no ELSE branch", lintCaseEnumElse},
+	{"if-output-else", "warning", "IF/ELSIF chain assigns outputs but has no ELSE branch", lintIfOutputElse},
+	{"implicit-narrowing", "warning", "assignment converts implicitly to a smaller or incompatible type", lintNarrowing},
+	{"shadowed-global", "warning", "local variable hides a global variable", lintShadowedGlobal},
+	{"naming", "note", "name does not start with the configured prefix", lintNaming},
+}
+
+// lintConfig is read from the -config file:
+//
+//	{
+//	  "disable":  ["naming"],
+//	  "levels":   {"implicit-narrowing": "error"},
+//	  "prefixes": {"functionBlock": "FB_", "enum": "E_", "struct": "ST_", "global": "G_"}
+//	}
+//
+// Prefix categories are program, function, functionBlock, method, struct,
+// enum, alias, global and constant (global constants). Categories without a
+// prefix are not checked; an empty string disables a default.
+type lintConfig struct {
+	Disable  []string          `json:"disable"`
+	Levels   map[string]string `json:"levels"`
+	Prefixes map[string]string `json:"prefixes"`
+}
+
+var defaultPrefixes = map[string]string{
+	"functionBlock": "FB_",
+	"enum":          "E_",
+	"struct":        "ST_",
+	"global":        "G_",
+}
+
+// runLint checks .st sources with the rules in lintRules. Arguments are files
+// or directories; all of them form one project, so globals, types and POUs
+// declared in one file are known in the others.
+func runLint(args []string) int {
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	format := flags.String("format", "text", "output format: text, json or sarif")
+	configPath := flags.String("config", "", "JSON configuration file (disabled rules, levels, naming prefixes)")
+	disable := flags.String("disable", "", "comma-separated rules to skip")
+	only := flags.String("rules", "", "comma-separated rules to run (default all)")
+	list := flags.Bool("list", false, "list the rules and exit")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, "iecst lint — static analysis of Structured Text sources\n\n")
+		fmt.Fprintln(os.Stderr, "Usage:")
+		fmt.Fprint(os.Stderr, "  iecst lint [-format text|json|sarif] [-config file] [-rules list] [-disable list] [file or directory ...]\n\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if *list {
+		for _, r := range lintRules {
+			fmt.Printf("%-20s %-8s %s\n", r.id, r.level, r.summary)
+		}
+		return 0
+	}
+
+	cfg := &lintConfig{Prefixes: map[string]string{}}
+	for k, v := range defaultPrefixes {
+		cfg.Prefixes[k] = v
+	}
+	if *configPath != "" {
+		data, err := os.ReadFile(*configPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "iecst lint:", err)
+			return 2
+		}
+		var user lintConfig
+		if err := json.Unmarshal(data, &user); err != nil {
+			fmt.Fprintf(os.Stderr, "iecst lint: %s: %v\n", *configPath, err)
+			return 2
+		}
+		cfg.Disable = user.Disable
+		cfg.Levels = user.Levels
+		for k, v := range user.Prefixes {
+			cfg.Prefixes[k] = v
+		}
+	}
+	if *disable != "" {
+		cfg.Disable = append(cfg.Disable, splitList(*disable)...)
+	}
+
+	rules, err := selectRules(splitList(*only), cfg.Disable)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "iecst lint:", err)
+		return 2
+	}
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	proj, err := st.LoadProject(paths...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "iecst lint:", err)
+		return 2
+	}
+
+	c := newLintContext(proj, cfg)
+	for _, r := range rules {
+		c.rule = r
+		r.check(c)
+	}
+	findings := append(syntaxFindings(proj), c.findings...)
+	sortFindings(findings)
+
+	var infos []ruleInfo
+	for _, r := range rules {
+		infos = append(infos, ruleInfo{r.id, r.summary})
+	}
+	if err := writeFindings(os.Stdout, *format, "iecst lint", infos, findings); err != nil {
+		fmt.Fprintln(os.Stderr, "iecst lint:", err)
+		return 2
+	}
+	if len(findings) > 0 {
+		return 1
+	}
+	return 0
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, f := range strings.Split(s, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// selectRules returns the rules to run, validating the rule names.
+func selectRules(only, disabled []string) ([]*lintRule, error) {
+	known := map[string]bool{}
+	for _, r := range lintRules {
+		known[r.id] = true
+	}
+	for _, n := range append(append([]string{}, only...), disabled...) {
+		if !known[n] {
+			return nil, fmt.Errorf("unknown rule %q (see iecst lint -list)", n)
+		}
+	}
+	skip := map[string]bool{}
+	for _, n := range disabled {
+		skip[n] = true
+	}
+	want := map[string]bool{}
+	for _, n := range only {
+		want[n] = true
+	}
+	var out []*lintRule
+	for _, r := range lintRules {
+		if !skip[r.id] && (len(want) == 0 || want[r.id]) {
+			out = append(out, r)
+		}
+	}
+	return out, nil
+}
+
+// ── Context ───────────────────────────────────────────────────────────────────
+
+// lintContext holds the project, the resolved references shared by the
+// rules and the findings collected so far.
+type lintContext struct {
+	proj     *st.Project
+	cfg      *lintConfig
+	rule     *lintRule
+	used     map[*st.Ident]bool // declaring identifiers that are referenced
+	written  map[*st.Ident]bool // declaring identifiers that are assigned
+	findings []finding
+}
+
+func newLintContext(proj *st.Project, cfg *lintConfig) *lintContext {
+	c := &lintContext{proj: proj, cfg: cfg, used: map[*st.Ident]bool{}, written: map[*st.Ident]bool{}}
+	for _, r := range proj.References() {
+		if r.Symbol == nil || r.Symbol.Ident == nil {
+			continue
+		}
+		c.used[r.Symbol.Ident] = true
+		if r.Write {
+			c.written[r.Symbol.Ident] = true
+		}
+	}
+	return c
+}
+
+func (c *lintContext) report(file *st.File, pos st.Pos, format string, args ...any) {
+	level := c.rule.level
+	if l, ok := c.cfg.Levels[c.rule.id]; ok {
+		level = l
+	}
+	name := ""
+	if file != nil {
+		name = file.Name
+	}
+	c.findings = append(c.findings, finding{
+		Rule: c.rule.id, Level: level, File: name, Line: pos.Line, Column: pos.Col,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// eachPOU calls fn for every POU and method of the project.
+func (c *lintContext) eachPOU(fn func(d *st.POU, f *st.File, s *st.Scope)) {
+	for _, f := range c.proj.Files {
+		for _, decl := range f.Decls {
+			d, ok := decl.(*st.POU)
+			if !ok {
+				continue
+			}
+			fn(d, f, c.proj.Scope(d))
+			for _, m := range d.Methods {
+				fn(m, f, c.proj.Scope(m))
+			}
+		}
+	}
+}
+
+// eachStmt calls fn for every statement in list, including nested ones.
+func eachStmt(list []st.Stmt, fn func(st.Stmt)) {
+	for _, s := range list {
+		st.Inspect(s, func(n st.Node) bool {
+			if s, ok := n.(st.Stmt); ok {
+				fn(s)
+			}
+			return true
+		})
+	}
+}
+
+// ── Rules ─────────────────────────────────────────────────────────────────────
+
+func lintUnused(c *lintContext) {
+	c.eachPOU(func(d *st.POU, f *st.File, _ *st.Scope) {
+		for _, b := range d.VarBlocks {
+			switch b.Kind {
+			case "VAR", "VAR_TEMP", "VAR_STAT", "VAR_INST":
+			default:
+				continue
+			}
+			for _, v := range b.Vars {
+				if v.At != nil {
+					continue // located variables are used by the I/O image
+				}
+				for _, id := range v.Names {
+					if !c.used[id] {
+						c.report(f, id.NamePos, "variable %s is declared but never used", id.Name)
+					}
+				}
+			}
+		}
+	})
+}
+
+func lintUnassignedOutput(c *lintContext) {
+	c.eachPOU(func(d *st.POU, f *st.File, _ *st.Scope) {
+		if d.Kind != st.FunctionBlock {
+			return
+		}
+		for _, b := range d.VarBlocks {
+			if b.Kind != "VAR_OUTPUT" {
+				continue
+			}
+			for _, v := range b.Vars {
+				for _, id := range v.Names {
+					if !c.written[id] && v.Init == nil {
+						c.report(f, id.NamePos, "output %s of %s is never assigned", id.Name, d.Name.Name)
+					}
+				}
+			}
+		}
+	})
+}
+
+func lintUnassignedResult(c *lintContext) {
+	c.eachPOU(func(d *st.POU, f *st.File, _ *st.Scope) {
+		if d.ReturnType == nil || (d.Kind != st.Function && d.Kind != st.Method) {
+			return
+		}
+		if !c.written[d.Name] {
+			c.report(f, d.Name.NamePos, "return value of %s %s is never assigned", d.Kind, d.Name.Name)
+		}
+	})
+}
+
+func lintCaseEnumElse(c *lintContext) {
+	c.eachPOU(func(d *st.POU, f *st.File, s *st.Scope) {
+		eachStmt(d.Body, func(stmt st.Stmt) {
+			cs, ok := stmt.(*st.CaseStmt)
+			if !ok || cs.HasElse {
+				return
+			}
+			t := s.TypeOf(cs.Selector)
+			if t.Class != st.EnumClass {
+				return
+			}
+			covered := map[int64]bool{}
+			for _, cl := range cs.Cases {
+				for _, l := range cl.Labels {
+					if r, ok := l.(*st.RangeExpr); ok {
+						lo, ok1 := s.ConstInt(r.Lo)
+						hi, ok2 := s.ConstInt(r.Hi)
+						for v := lo; ok1 && ok2 && v <= hi && v-lo < 1<<16; v++ {
+							covered[v] = true
+						}
+					} else if v, ok := s.ConstInt(l); ok {
+						covered[v] = true
+					}
+				}
+			}
+			var missing []string
+			for _, m := range t.Members {
+				if !covered[m.Value] {
+					missing = append(missing, m.Name)
+				}
+			}
+			if len(missing) > 0 {
+				c.report(f, cs.KwPos, "CASE on %s has no ELSE and does not handle %s", t.Name, strings.Join(missing, ", "))
+			} else {
+				c.report(f, cs.KwPos, "CASE on %s has no ELSE branch for out-of-range values", t.Name)
+			}
+		})
+	})
+}
+
+func lintIfOutputElse(c *lintContext) {
+	c.eachPOU(func(d *st.POU, f *st.File, s *st.Scope) {
+		isOutput := func(sym *st.Symbol) bool {
+			if sym == nil || sym.Kind != st.VarSymbol {
+				return false
+			}
+			return sym.BlockKind() == "VAR_OUTPUT" || sym.Block == nil && sym.POU != nil && sym.POU.ReturnType != nil
+		}
+		eachStmt(d.Body, func(stmt st.Stmt) {
+			is, ok := stmt.(*st.IfStmt)
+			if !ok || is.HasElse || len(is.Elsifs) == 0 {
+				return
+			}
+			branches := [][]st.Stmt{is.Then}
+			for _, e := range is.Elsifs {
+				branches = append(branches, e.Body)
+			}
+			var outs []string
+			seen := map[string]bool{}
+			for _, br := range branches {
+				eachStmt(br, func(inner st.Stmt) {
+					a, ok := inner.(*st.AssignStmt)
+					if !ok {
+						return
+					}
+					root := rootIdent(a.Target)
+					if root == nil || !isOutput(s.Lookup(root.Name)) {
+						return
+					}
+					if key := strings.ToUpper(root.Name); !seen[key] {
+						seen[key] = true
+						outs = append(outs, root.Name)
+					}
+				})
+			}
+			if len(outs) > 0 {
+				c.report(f, is.KwPos, "IF/ELSIF chain assigns %s but has no ELSE; the previous value is kept when no condition holds", strings.Join(outs, ", "))
+			}
+		})
+	})
+}
+
+// rootIdent returns the variable at the root of an assignment target.
+func rootIdent(e st.Expr) *st.Ident {
+	for {
+		switch x := e.(type) {
+		case *st.Ident:
+			return x
+		case *st.MemberExpr:
+			e = x.X
+		case *st.IndexExpr:
+			e = x.X
+		default:
+			return nil
+		}
+	}
+}
+
+func lintNarrowing(c *lintContext) {
+	c.eachPOU(func(d *st.POU, f *st.File, s *st.Scope) {
+		check := func(pos st.Pos, what string, dst *st.Type, value st.Expr) {
+			src := s.TypeOf(value)
+			if v, ok := s.ConstInt(value); ok && src.Untyped {
+				if lo, hi, ok := dst.Range(); ok && (v < lo || v > hi) {
+					c.report(f, pos, "constant %d does not fit %s of %s", v, dst, what)
+				}
+				return
+			}
+			switch st.Convert(dst, src) {
+			case st.ConvNarrowing:
+				c.report(f, pos, "implicit narrowing conversion from %s to %s in %s", src, dst, what)
+			case st.ConvIncompatible:
+				if dst.Class != st.VoidClass && src.Class != st.VoidClass {
+					c.report(f, pos, "implicit conversion from %s to %s in %s", src, dst, what)
+				}
+			}
+		}
+		eachStmt(d.Body, func(stmt st.Stmt) {
+			if a, ok := stmt.(*st.AssignStmt); ok {
+				check(a.Value.Pos(), "assignment to "+st.ExprString(a.Target), s.TypeOf(a.Target), a.Value)
+			}
+			st.Inspect(stmt, func(n st.Node) bool {
+				if inner, ok := n.(st.Stmt); ok && inner != stmt {
+					return false // nested statements are visited by eachStmt
+				}
+				call, ok := n.(*st.CallExpr)
+				if !ok {
+					return true
+				}
+				callee := s.Callee(call)
+				if callee == nil {
+					return true
+				}
+				params := inputParams(c.proj, callee)
+				for i, a := range call.Args {
+					if a.Output || a.Value == nil {
+						continue
+					}
+					var p *st.Field
+					if a.Name != nil {
+						p = c.proj.InstanceType(callee).Field(a.Name.Name)
+						if p == nil && i < len(params) {
+							continue
+						}
+					} else if i < len(params) {
+						p = params[i]
+					}
+					if p != nil && p.Block == "VAR_INPUT" {
+						check(a.Value.Pos(), "argument "+p.Name+" of "+callee.Name.Name, p.Type, a.Value)
+					}
+				}
+				return true
+			})
+		})
+	})
+}
+
+// inputParams returns the VAR_INPUT and VAR_IN_OUT variables of a POU in
+// declaration order, which is the order of positional arguments.
+func inputParams(p *st.Project, d *st.POU) []*st.Field {
+	var out []*st.Field
+	for _, f := range paramFields(p, d) {
+		if f.Block == "VAR_INPUT" || f.Block == "VAR_IN_OUT" {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// paramFields returns the variables of a POU with their resolved types.
+// Functions and methods are not instance types, so their variables are
+// resolved through the POU's scope.
+func paramFields(p *st.Project, d *st.POU) []*st.Field {
+	if d.Kind == st.FunctionBlock || d.Kind == st.Program {
+		return p.InstanceType(d).Fields
+	}
+	s := p.Scope(d)
+	var out []*st.Field
+	for _, b := range d.VarBlocks {
+		for _, v := range b.Vars {
+			t := s.ResolveType(v.Type)
+			for _, id := range v.Names {
+				out = append(out, &st.Field{Name: id.Name, Type: t, Decl: v, Block: b.Kind, Ident: id})
+			}
+		}
+	}
+	return out
+}
+
+func lintShadowedGlobal(c *lintContext) {
+	c.eachPOU(func(d *st.POU, f *st.File, _ *st.Scope) {
+		for _, b := range d.VarBlocks {
+			if b.Kind == "VAR_EXTERNAL" {
+				continue
+			}
+			for _, v := range b.Vars {
+				for _, id := range v.Names {
+					if g := c.proj.Global(id.Name); g != nil {
+						c.report(f, id.NamePos, "%s hides global variable %s of %s", id.Name, g.Name, g.GVL)
+					}
+				}
+			}
+		}
+	})
+}
+
+func lintNaming(c *lintContext) {
+	check := func(f *st.File, id *st.Ident, category, what string) {
+		prefix := c.cfg.Prefixes[category]
+		if prefix != "" && !strings.HasPrefix(id.Name, prefix) {
+			c.report(f, id.NamePos, "%s %s should start with %q", what, id.Name, prefix)
+		}
+	}
+	for _, f := range c.proj.Files {
+		for _, decl := range f.Decls {
+			switch d := decl.(type) {
+			case *st.POU:
+				switch d.Kind {
+				case st.Program:
+					check(f, d.Name, "program", "PROGRAM")
+				case st.Function:
+					check(f, d.Name, "function", "FUNCTION")
+				case st.FunctionBlock:
+					check(f, d.Name, "functionBlock", "FUNCTION_BLOCK")
+				}
+				for _, m := range d.Methods {
+					check(f, m.Name, "method", "METHOD")
+				}
+			case *st.TypeBlock:
+				for _, td := range d.Types {
+					switch td.Type.(type) {
+					case *st.StructType:
+						check(f, td.Name, "struct", "structure")
+					case *st.EnumType:
+						check(f, td.Name, "enum", "enumeration")
+					default:
+						check(f, td.Name, "alias", "type")
+					}
+				}
+			}
+		}
+	}
+	for _, g := range c.proj.Globals() {
+		if g.IsConstant() {
+			check(g.File, g.Ident, "constant", "global constant")
+		} else {
+			check(g.File, g.Ident, "global", "global variable")
+		}
+	}
+}
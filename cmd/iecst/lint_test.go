@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/damischa1/iec-st-tools/st"
+)
+
+// lintSources runs one rule with the default configuration over the given
+// files, named file0.st, file1.st, … in order.
+func lintSources(t *testing.T, rule string, srcs ...string) []string {
+	t.Helper()
+	var files []*st.File
+	for i, src := range srcs {
+		f, err := st.Parse(fmt.Sprintf("file%d.st", i), src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, f)
+	}
+	rules, err := selectRules([]string{rule}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newLintContext(st.NewProject(files), &lintConfig{Prefixes: defaultPrefixes})
+	c.rule = rules[0]
+	c.rule.check(c)
+	var out []string
+	for _, f := range c.findings {
+		out = append(out, fmt.Sprintf("%s:%d:%d: %s: %s", f.File, f.Line, f.Column, f.Level, f.Message))
+	}
+	return out
+}
+
+func TestLintRules(t *testing.T) {
+	tests := []struct {
+		rule string
+		srcs []string
+		want []string
+	}{
+		{
+			"unused-variable",
+			[]string{"PROGRAM Main\nVAR\n    i : INT;\n    unused : INT;\nEND_VAR\ni := 1;\nEND_PROGRAM\n"},
+			[]string{"file0.st:4:5: warning: variable unused is declared but never used"},
+		},
+		{
+			"unassigned-output",
+			[]string{"FUNCTION_BLOCK FB_Motor\nVAR_OUTPUT\n    q : BOOL;\n    o : INT;\nEND_VAR\nq := TRUE;\nEND_FUNCTION_BLOCK\n"},
+			[]string{"file0.st:4:5: warning: output o of FB_Motor is never assigned"},
+		},
+		{
+			"unassigned-result",
+			[]string{"FUNCTION F_Add : INT\nVAR_INPUT\n    a : INT;\nEND_VAR\nEND_FUNCTION\n"},
+			[]string{"file0.st:1:10: warning: return value of FUNCTION F_Add is never assigned"},
+		},
+		{
+			"case-enum-else",
+			[]string{
+				"PROGRAM Main\nVAR\n    e : E_Mode;\n    i : INT;\nEND_VAR\nCASE e OF\n    E_Mode.Auto: i := 2;\nEND_CASE\nEND_PROGRAM\n",
+				"TYPE E_Mode :\n(\n    Auto,\n    Manual\n);\nEND_TYPE\n",
+			},
+			[]string{"file0.st:6:1: warning: CASE on E_Mode has no ELSE and does not handle Manual"},
+		},
+		{
+			"if-output-else",
+			[]string{"FUNCTION_BLOCK FB_Motor\nVAR_INPUT\n    x : BOOL;\nEND_VAR\nVAR_OUTPUT\n    q : BOOL;\nEND_VAR\nIF x THEN\n    q := TRUE;\nELSIF NOT x THEN\n    q := FALSE;\nEND_IF\nEND_FUNCTION_BLOCK\n"},
+			[]string{"file0.st:8:1: warning: IF/ELSIF chain assigns q but has no ELSE; the previous value is kept when no condition holds"},
+		},
+		{
+			"implicit-narrowing",
+			[]string{"PROGRAM Main\nVAR\n    i : INT;\n    d : DINT;\nEND_VAR\ni := d;\nd := i;\nEND_PROGRAM\n"},
+			[]string{"file0.st:6:6: warning: implicit narrowing conversion from DINT to INT in assignment to i"},
+		},
+		{
+			"shadowed-global",
+			[]string{
+				"PROGRAM Main\nVAR\n    G_x : INT;\nEND_VAR\nG_x := 1;\nEND_PROGRAM\n",
+				"VAR_GLOBAL\n    G_x : INT;\nEND_VAR\n",
+			},
+			[]string{"file0.st:3:5: warning: G_x hides global variable G_x of file1"},
+		},
+		{
+			"naming",
+			[]string{
+				"FUNCTION_BLOCK Motor\nEND_FUNCTION_BLOCK\n",
+				"VAR_GLOBAL\n    G_x : INT;\n    count : INT;\nEND_VAR\n",
+			},
+			[]string{
+				"file0.st:1:16: note: FUNCTION_BLOCK Motor should start with \"FB_\"",
+				"file1.st:3:5: note: global variable count should start with \"G_\"",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			got := lintSources(t, tt.rule, tt.srcs...)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d findings, want %d:\n%q", len(got), len(tt.want), got)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("got  %s\nwant %s", got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
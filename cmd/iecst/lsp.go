@@ -0,0 +1,1118 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/damischa1/iec-st-tools/st"
+)
+
+// ── lsp ───────────────────────────────────────────────────────────────────────
+
+// runLsp serves the Language Server Protocol over stdin/stdout. The whole
+// source tree is one project: every .st file below src/ of the workspace
+// (or the workspace itself when it has no src/ directory) is parsed, so
+// globals from CONFIGURATION-wrapped GVLs, types and POUs are known in every
+// file. Open editor buffers replace the files on disk.
+func runLsp(args []string) int {
+	flags := flag.NewFlagSet("lsp", flag.ExitOnError)
+	src := flags.String("src", "", "source tree (default: src/ below the workspace root, or the root itself)")
+	logPath := flags.String("log", "", "append protocol errors to this file")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, "iecst lsp — language server for Structured Text over stdio\n\n")
+		fmt.Fprintln(os.Stderr, "Usage:")
+		fmt.Fprint(os.Stderr, "  iecst lsp [-src dir] [-log file]\n\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	s := &lspServer{out: os.Stdout, src: *src, docs: map[string]*lspDoc{}, published: map[string]bool{}, log: io.Discard}
+	if *logPath != "" {
+		f, err := os.OpenFile(*logPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "iecst lsp:", err)
+			return 2
+		}
+		defer f.Close()
+		s.log = f
+	}
+	return s.serve(bufio.NewReader(os.Stdin))
+}
+
+// ── Transport ─────────────────────────────────────────────────────────────────
+
+type lspRequest struct {
+	ID     json.RawMessage `json:"id,omitempty"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+type lspResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result"`
+}
+
+type lspErrorResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Error   struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+type lspNotification struct {
+	JSONRPC string `json:"jsonrpc"`
+	Method  string `json:"method"`
+	Params  any    `json:"params"`
+}
+
+// readMessage reads one Content-Length framed message.
+func readMessage(r *bufio.Reader) ([]byte, error) {
+	length := -1
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if ok && strings.EqualFold(strings.TrimSpace(name), "Content-Length") {
+			length, err = strconv.Atoi(strings.TrimSpace(value))
+			if err != nil {
+				return nil, fmt.Errorf("bad Content-Length %q", value)
+			}
+		}
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("message without Content-Length")
+	}
+	buf := make([]byte, length)
+	_, err := io.ReadFull(r, buf)
+	return buf, err
+}
+
+func (s *lspServer) send(v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		fmt.Fprintln(s.log, "marshal:", err)
+		return
+	}
+	fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(data), data)
+}
+
+// ── Server ────────────────────────────────────────────────────────────────────
+
+// lspDoc is one .st file of the project, from disk or an open buffer.
+type lspDoc struct {
+	path string
+	file *st.File
+	errs st.ErrorList
+	open bool
+}
+
+// lspEntry is an identifier of a file with the symbol it names.
+type lspEntry struct {
+	id  *st.Ident
+	sym *st.Symbol
+}
+
+type lspServer struct {
+	out       io.Writer
+	log       io.Writer
+	src       string // source tree; set from -src or the workspace root
+	docs      map[string]*lspDoc
+	published map[string]bool // paths with diagnostics at the client
+	shutdown  bool
+
+	proj    *st.Project
+	entries map[*st.File][]lspEntry
+	refs    []*st.Ref
+}
+
+func (s *lspServer) serve(r *bufio.Reader) int {
+	for {
+		data, err := readMessage(r)
+		if err != nil {
+			if err != io.EOF {
+				fmt.Fprintln(s.log, "read:", err)
+			}
+			return 1
+		}
+		var req lspRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			fmt.Fprintln(s.log, "decode:", err)
+			continue
+		}
+		if req.Method == "exit" {
+			if s.shutdown {
+				return 0
+			}
+			return 1
+		}
+		result, err := s.handle(req.Method, req.Params)
+		if len(req.ID) == 0 {
+			if err != nil {
+				fmt.Fprintf(s.log, "%s: %v\n", req.Method, err)
+			}
+			continue // notification
+		}
+		if err != nil {
+			resp := lspErrorResponse{JSONRPC: "2.0", ID: req.ID}
+			resp.Error.Code = -32603
+			if err == errMethodNotFound {
+				resp.Error.Code = -32601
+			}
+			resp.Error.Message = err.Error()
+			s.send(resp)
+			continue
+		}
+		s.send(lspResponse{JSONRPC: "2.0", ID: req.ID, Result: result})
+	}
+}
+
+var errMethodNotFound = fmt.Errorf("method not found")
+
+type lspPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type lspRange struct {
+	Start lspPosition `json:"start"`
+	End   lspPosition `json:"end"`
+}
+
+type lspLocation struct {
+	URI   string   `json:"uri"`
+	Range lspRange `json:"range"`
+}
+
+type lspTextDocumentPosition struct {
+	TextDocument struct {
+		URI string `json:"uri"`
+	} `json:"textDocument"`
+	Position lspPosition `json:"position"`
+	Context  struct {
+		IncludeDeclaration bool `json:"includeDeclaration"`
+	} `json:"context"`
+}
+
+func (s *lspServer) handle(method string, params json.RawMessage) (any, error) {
+	switch method {
+	case "initialize":
+		var p struct {
+			RootURI          string `json:"rootUri"`
+			RootPath         string `json:"rootPath"`
+			WorkspaceFolders []struct {
+				URI string `json:"uri"`
+			} `json:"workspaceFolders"`
+		}
+		json.Unmarshal(params, &p)
+		root := p.RootPath
+		if p.RootURI != "" {
+			root = uriToPath(p.RootURI)
+		} else if len(p.WorkspaceFolders) > 0 {
+			root = uriToPath(p.WorkspaceFolders[0].URI)
+		}
+		if s.src == "" && root != "" {
+			s.src = root
+			if info, err := os.Stat(filepath.Join(root, "src")); err == nil && info.IsDir() {
+				s.src = filepath.Join(root, "src")
+			}
+		}
+		return map[string]any{
+			"capabilities": map[string]any{
+				"textDocumentSync":       map[string]any{"openClose": true, "change": 1, "save": true},
+				"definitionProvider":     true,
+				"referencesProvider":     true,
+				"hoverProvider":          true,
+				"documentSymbolProvider": true,
+				"completionProvider":     map[string]any{"triggerCharacters": []string{"."}},
+			},
+			"serverInfo": map[string]any{"name": "iecst"},
+		}, nil
+	case "initialized", "workspace/didChangeWatchedFiles":
+		s.scan()
+		s.rebuild()
+		return nil, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/didOpen":
+		var p struct {
+			TextDocument struct {
+				URI  string `json:"uri"`
+				Text string `json:"text"`
+			} `json:"textDocument"`
+		}
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+		s.setText(uriToPath(p.TextDocument.URI), p.TextDocument.Text, true)
+		s.rebuild()
+		return nil, nil
+	case "textDocument/didChange":
+		var p struct {
+			TextDocument struct {
+				URI string `json:"uri"`
+			} `json:"textDocument"`
+			ContentChanges []struct {
+				Text string `json:"text"`
+			} `json:"contentChanges"`
+		}
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+		if n := len(p.ContentChanges); n > 0 {
+			s.setText(uriToPath(p.TextDocument.URI), p.ContentChanges[n-1].Text, true)
+			s.rebuild()
+		}
+		return nil, nil
+	case "textDocument/didClose":
+		var p lspTextDocumentPosition
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+		path := uriToPath(p.TextDocument.URI)
+		if d := s.docs[path]; d != nil {
+			d.open = false
+			if src, err := os.ReadFile(path); err == nil && s.inTree(path) {
+				s.setText(path, string(src), false)
+			} else {
+				delete(s.docs, path)
+			}
+		}
+		s.rebuild()
+		return nil, nil
+	case "textDocument/didSave":
+		return nil, nil
+	case "textDocument/definition":
+		var p lspTextDocumentPosition
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+		e := s.entryAt(p.TextDocument.URI, p.Position)
+		if e == nil || e.sym == nil || e.sym.Ident == nil {
+			return nil, nil
+		}
+		if loc, ok := s.location(e.sym.Ident, e.sym.File); ok {
+			return loc, nil
+		}
+		return nil, nil
+	case "textDocument/references":
+		var p lspTextDocumentPosition
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+		return s.references(p), nil
+	case "textDocument/hover":
+		var p lspTextDocumentPosition
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+		return s.hover(p), nil
+	case "textDocument/documentSymbol":
+		var p lspTextDocumentPosition
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+		return s.documentSymbols(uriToPath(p.TextDocument.URI)), nil
+	case "textDocument/completion":
+		var p lspTextDocumentPosition
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+		return s.completion(p), nil
+	}
+	if strings.HasPrefix(method, "$/") {
+		return nil, nil
+	}
+	return nil, errMethodNotFound
+}
+
+// ── Project state ─────────────────────────────────────────────────────────────
+
+func (s *lspServer) inTree(path string) bool {
+	rel, err := filepath.Rel(s.src, path)
+	return s.src != "" && err == nil && !strings.HasPrefix(rel, "..")
+}
+
+// scan reads the .st files of the source tree that are not open in the
+// editor.
+func (s *lspServer) scan() {
+	for path, d := range s.docs {
+		if !d.open {
+			delete(s.docs, path)
+		}
+	}
+	if s.src == "" {
+		return
+	}
+	if abs, err := filepath.Abs(s.src); err == nil {
+		s.src = abs
+	}
+	files, err := collectSTFiles([]string{s.src})
+	if err != nil {
+		fmt.Fprintln(s.log, "scan:", err)
+		return
+	}
+	for _, path := range files {
+		abs, _ := filepath.Abs(path)
+		if d := s.docs[abs]; d != nil && d.open {
+			continue
+		}
+		src, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintln(s.log, "scan:", err)
+			continue
+		}
+		s.setText(abs, string(src), false)
+	}
+}
+
+func (s *lspServer) setText(path, text string, open bool) {
+	f, err := st.Parse(path, text)
+	errs, _ := err.(st.ErrorList)
+	s.docs[path] = &lspDoc{path: path, file: f, errs: errs, open: open}
+}
+
+// rebuild indexes the project after a change and publishes diagnostics.
+func (s *lspServer) rebuild() {
+	paths := make([]string, 0, len(s.docs))
+	for p := range s.docs {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	var files []*st.File
+	for _, p := range paths {
+		files = append(files, s.docs[p].file)
+	}
+	s.proj = st.NewProject(files)
+	if s.src != "" {
+		s.proj.Roots = []string{s.src}
+	}
+	for _, p := range paths {
+		if d := s.docs[p]; len(d.errs) > 0 {
+			s.proj.SyntaxErrors[d.file] = d.errs
+		}
+	}
+	s.refs = s.proj.References()
+	s.entries = lspEntries(s.proj, s.refs)
+	s.publishDiagnostics(paths)
+}
+
+// lspEntries lists the identifiers of every file: uses from the reference
+// index and declaring identifiers with their symbols.
+func lspEntries(p *st.Project, refs []*st.Ref) map[*st.File][]lspEntry {
+	out := map[*st.File][]lspEntry{}
+	for _, r := range refs {
+		out[r.File] = append(out[r.File], lspEntry{r.Ident, r.Symbol})
+	}
+	addVars := func(f *st.File, d *st.POU) {
+		sc := p.Scope(d)
+		for _, sym := range sc.Locals() {
+			if sym.POU == d {
+				out[f] = append(out[f], lspEntry{sym.Ident, sc.Lookup(sym.Name)})
+			}
+		}
+	}
+	for _, f := range p.Files {
+		for _, decl := range f.Decls {
+			switch d := decl.(type) {
+			case *st.POU:
+				out[f] = append(out[f], lspEntry{d.Name, p.GlobalScope().Lookup(d.Name.Name)})
+				addVars(f, d)
+				for _, m := range d.Methods {
+					sym := &st.Symbol{Kind: st.POUSymbol, Name: m.Name.Name, Ident: m.Name, POU: m, File: f}
+					out[f] = append(out[f], lspEntry{m.Name, sym})
+					addVars(f, m)
+				}
+			case *st.TypeBlock:
+				for _, td := range d.Types {
+					t := p.TypeOfDecl(td)
+					out[f] = append(out[f], lspEntry{td.Name, &st.Symbol{Kind: st.TypeSymbol, Name: td.Name.Name, Ident: td.Name, TypeDecl: td, Type: t, File: f}})
+					if t.Decl == td {
+						for _, fl := range t.Fields {
+							out[f] = append(out[f], lspEntry{fl.Ident, &st.Symbol{Kind: st.FieldSymbol, Name: fl.Name, Ident: fl.Ident, Type: fl.Type, Decl: fl.Decl, File: f}})
+						}
+						for _, m := range t.Members {
+							out[f] = append(out[f], lspEntry{m.Ident, &st.Symbol{Kind: st.EnumValueSymbol, Name: m.Name, Ident: m.Ident, Type: t, Member: m, File: f}})
+						}
+					}
+				}
+			case *st.Configuration:
+				out[f] = append(out[f], lspEntry{d.Name, &st.Symbol{Kind: st.GVLSymbol, Name: d.Name.Name, GVL: d.Name.Name, File: f}})
+			}
+		}
+	}
+	for _, g := range append(p.Globals(), p.Duplicates()...) {
+		if g.Kind == st.GlobalSymbol {
+			out[g.File] = append(out[g.File], lspEntry{g.Ident, p.GlobalScope().Lookup(g.Name)})
+		}
+	}
+	return out
+}
+
+// ── Diagnostics ───────────────────────────────────────────────────────────────
+
+type lspDiagnostic struct {
+	Range    lspRange `json:"range"`
+	Severity int      `json:"severity"` // 1 error, 2 warning, 3 information
+	Source   string   `json:"source"`
+	Message  string   `json:"message"`
+}
+
+func (s *lspServer) publishDiagnostics(paths []string) {
+	diags := map[string][]lspDiagnostic{}
+	for _, p := range paths {
+		d := s.docs[p]
+		for _, e := range d.errs {
+			diags[p] = append(diags[p], lspDiagnostic{Range: wordRange(d.file.Source, e.Pos), Severity: 1, Source: "iecst", Message: e.Msg})
+		}
+	}
+	for f, list := range s.proj.Check() {
+		for _, e := range list {
+			diags[f.Name] = append(diags[f.Name], lspDiagnostic{Range: wordRange(f.Source, e.Pos), Severity: 1, Source: "iecst", Message: e.Msg})
+		}
+	}
+	next := map[string]bool{}
+	for _, p := range paths {
+		list := diags[p]
+		if len(list) == 0 && !s.published[p] {
+			continue
+		}
+		if list == nil {
+			list = []lspDiagnostic{}
+		} else {
+			next[p] = true
+		}
+		s.send(lspNotification{JSONRPC: "2.0", Method: "textDocument/publishDiagnostics",
+			Params: map[string]any{"uri": pathToURI(p), "diagnostics": list}})
+	}
+	for p := range s.published {
+		if _, ok := s.docs[p]; !ok {
+			s.send(lspNotification{JSONRPC: "2.0", Method: "textDocument/publishDiagnostics",
+				Params: map[string]any{"uri": pathToURI(p), "diagnostics": []lspDiagnostic{}}})
+		}
+	}
+	s.published = next
+}
+
+// ── Navigation ────────────────────────────────────────────────────────────────
+
+// entryAt returns the identifier under the cursor.
+func (s *lspServer) entryAt(uri string, pos lspPosition) *lspEntry {
+	d := s.docs[uriToPath(uri)]
+	if d == nil || s.proj == nil {
+		return nil
+	}
+	off := offsetAt(d.file.Source, pos)
+	entries := s.entries[d.file]
+	for i := range entries {
+		e := &entries[i]
+		if e.id != nil && e.id.NamePos.Offset <= off && off <= e.id.NamePos.Offset+len(e.id.Name) {
+			return e
+		}
+	}
+	return nil
+}
+
+func (s *lspServer) location(id *st.Ident, f *st.File) (lspLocation, bool) {
+	if f == nil {
+		f = s.proj.FileOf(id)
+	}
+	if f == nil || s.docs[f.Name] == nil {
+		return lspLocation{}, false // standard library
+	}
+	return lspLocation{URI: pathToURI(f.Name), Range: identRange(f.Source, id)}, true
+}
+
+func (s *lspServer) references(p lspTextDocumentPosition) []lspLocation {
+	e := s.entryAt(p.TextDocument.URI, p.Position)
+	if e == nil || e.sym == nil || e.sym.Ident == nil {
+		return nil
+	}
+	target := e.sym.Ident
+	out := []lspLocation{}
+	if p.Context.IncludeDeclaration {
+		if loc, ok := s.location(target, e.sym.File); ok {
+			out = append(out, loc)
+		}
+	}
+	for _, r := range s.refs {
+		if r.Symbol != nil && r.Symbol.Ident == target {
+			out = append(out, lspLocation{URI: pathToURI(r.File.Name), Range: identRange(r.File.Source, r.Ident)})
+		}
+	}
+	return out
+}
+
+// ── Hover ─────────────────────────────────────────────────────────────────────
+
+func (s *lspServer) hover(p lspTextDocumentPosition) any {
+	e := s.entryAt(p.TextDocument.URI, p.Position)
+	if e == nil {
+		return nil
+	}
+	var text string
+	if e.sym != nil {
+		text = describeSymbol(s.proj, e.sym)
+	} else if f, ok := st.LookupStdFunc(e.id.Name); ok {
+		text = fmt.Sprintf("```st\nFUNCTION %s\n```\nStandard function: %s", f.Name, f.Doc)
+	}
+	if text == "" {
+		return nil
+	}
+	d := s.docs[uriToPath(p.TextDocument.URI)]
+	return map[string]any{
+		"contents": map[string]any{"kind": "markdown", "value": text},
+		"range":    identRange(d.file.Source, e.id),
+	}
+}
+
+// describeSymbol renders a symbol as Markdown: its declaration in an ST
+// code block, followed by where it is declared and its comment.
+func describeSymbol(p *st.Project, sym *st.Symbol) string {
+	var b strings.Builder
+	code := func(format string, args ...any) {
+		fmt.Fprintf(&b, "```st\n"+format+"\n```\n", args...)
+	}
+	varDecl := func() string {
+		s := sym.Name + " : " + sym.Type.String()
+		if sym.Decl != nil && sym.Decl.Init != nil {
+			s += " := " + st.ExprString(sym.Decl.Init)
+		}
+		return s
+	}
+	switch sym.Kind {
+	case st.VarSymbol:
+		if sym.Block == nil {
+			code("%s : %s", sym.Name, sym.Type)
+			fmt.Fprintf(&b, "Return value of %s", sym.Name)
+			break
+		}
+		code("%s", varDecl())
+		fmt.Fprintf(&b, "%s of %s", blockTitle(sym.Block), sym.POU.Name.Name)
+	case st.GlobalSymbol:
+		code("%s", varDecl())
+		fmt.Fprintf(&b, "%s of %s", blockTitle(sym.Block), sym.GVL)
+	case st.FieldSymbol:
+		code("%s", varDecl())
+	case st.EnumValueSymbol:
+		code("%s.%s := %d", sym.Type.Name, sym.Name, sym.Member.Value)
+	case st.GVLSymbol:
+		n := 0
+		for _, g := range p.Globals() {
+			if strings.EqualFold(g.GVL, sym.GVL) {
+				n++
+			}
+		}
+		code("CONFIGURATION %s", sym.Name)
+		fmt.Fprintf(&b, "Global variable list with %d variables", n)
+	case st.TypeSymbol:
+		code("%s", typeSignature(sym.TypeDecl, sym.Type))
+		if sym.TypeDecl.Comment != "" {
+			b.WriteString(sym.TypeDecl.Comment)
+		}
+		return strings.TrimSpace(b.String())
+	case st.POUSymbol:
+		code("%s", pouSignature(p, sym.POU))
+		if st.IsStandard(sym.POU) {
+			b.WriteString("Standard function block")
+		} else if owner := p.Owner(sym.POU); owner != nil {
+			fmt.Fprintf(&b, "Method of %s", owner.Name.Name)
+		}
+		if sym.POU.Doc != "" {
+			b.WriteString("\n\n" + sym.POU.Doc)
+		}
+		return strings.TrimSpace(b.String())
+	}
+	if sym.Decl != nil && sym.Decl.Comment != "" {
+		b.WriteString("\n\n" + sym.Decl.Comment)
+	}
+	return strings.TrimSpace(b.String())
+}
+
+func blockTitle(b *st.VarBlock) string {
+	s := b.Kind
+	if b.Constant {
+		s += " CONSTANT"
+	}
+	if b.Retain {
+		s += " RETAIN"
+	}
+	if b.Persistent {
+		s += " PERSISTENT"
+	}
+	return s
+}
+
+// pouSignature renders a POU header with its interface variables.
+func pouSignature(p *st.Project, d *st.POU) string {
+	var b strings.Builder
+	b.WriteString(d.Kind.String() + " " + d.Name.Name)
+	if d.Extends != nil {
+		b.WriteString(" EXTENDS " + d.Extends.Name)
+	}
+	if d.ReturnType != nil {
+		b.WriteString(" : " + p.Scope(d).ResolveType(d.ReturnType).String())
+	}
+	sc := p.Scope(d)
+	for _, vb := range d.VarBlocks {
+		switch vb.Kind {
+		case "VAR_INPUT", "VAR_OUTPUT", "VAR_IN_OUT":
+		default:
+			continue
+		}
+		b.WriteString("\n" + vb.Kind)
+		for _, v := range vb.Vars {
+			names := make([]string, len(v.Names))
+			for i, id := range v.Names {
+				names[i] = id.Name
+			}
+			fmt.Fprintf(&b, "\n    %s : %s;", strings.Join(names, ", "), sc.ResolveType(v.Type))
+		}
+		b.WriteString("\nEND_VAR")
+	}
+	return b.String()
+}
+
+// typeSignature renders a data type declaration.
+func typeSignature(td *st.TypeDecl, t *st.Type) string {
+	switch t.Class {
+	case st.StructClass:
+		var b strings.Builder
+		b.WriteString("TYPE " + td.Name.Name + " :\nSTRUCT")
+		if td.Extends != nil {
+			b.WriteString(" EXTENDS " + td.Extends.Name)
+		}
+		for _, f := range t.Fields {
+			fmt.Fprintf(&b, "\n    %s : %s;", f.Name, f.Type)
+		}
+		b.WriteString("\nEND_STRUCT")
+		return b.String()
+	case st.EnumClass:
+		names := make([]string, len(t.Members))
+		for i, m := range t.Members {
+			names[i] = fmt.Sprintf("%s := %d", m.Name, m.Value)
+		}
+		return "TYPE " + td.Name.Name + " : (" + strings.Join(names, ", ") + ")"
+	}
+	return "TYPE " + td.Name.Name + " : " + t.String()
+}
+
+// ── Document symbols ──────────────────────────────────────────────────────────
+
+type lspDocumentSymbol struct {
+	Name           string              `json:"name"`
+	Detail         string              `json:"detail,omitempty"`
+	Kind           int                 `json:"kind"`
+	Range          lspRange            `json:"range"`
+	SelectionRange lspRange            `json:"selectionRange"`
+	Children       []lspDocumentSymbol `json:"children,omitempty"`
+}
+
+// LSP SymbolKind values.
+const (
+	symModule     = 2
+	symNamespace  = 3
+	symClass      = 5
+	symMethod     = 6
+	symField      = 8
+	symEnum       = 10
+	symFunction   = 12
+	symVariable   = 13
+	symConstant   = 14
+	symEnumMember = 22
+	symStruct     = 23
+	symTypeParam  = 26
+)
+
+func (s *lspServer) documentSymbols(path string) []lspDocumentSymbol {
+	d := s.docs[path]
+	if d == nil || s.proj == nil {
+		return nil
+	}
+	src := d.file.Source
+	vars := func(sc *st.Scope, blocks []*st.VarBlock) []lspDocumentSymbol {
+		var out []lspDocumentSymbol
+		for _, b := range blocks {
+			kind := symVariable
+			if b.Constant {
+				kind = symConstant
+			}
+			for _, v := range b.Vars {
+				t := sc.ResolveType(v.Type)
+				for _, id := range v.Names {
+					r := identRange(src, id)
+					out = append(out, lspDocumentSymbol{Name: id.Name, Detail: t.String() + " (" + b.Kind + ")", Kind: kind, Range: r, SelectionRange: r})
+				}
+			}
+		}
+		return out
+	}
+	var pou func(p *st.POU) lspDocumentSymbol
+	pou = func(p *st.POU) lspDocumentSymbol {
+		kind := map[st.POUKind]int{st.Program: symModule, st.FunctionBlock: symClass, st.Function: symFunction, st.Method: symMethod}[p.Kind]
+		sym := lspDocumentSymbol{Name: p.Name.Name, Detail: p.Kind.String(), Kind: kind,
+			Range: spanRange(src, p.KwPos, p.EndPos), SelectionRange: identRange(src, p.Name)}
+		sym.Children = vars(s.proj.Scope(p), p.VarBlocks)
+		for _, m := range p.Methods {
+			sym.Children = append(sym.Children, pou(m))
+		}
+		return sym
+	}
+	var out []lspDocumentSymbol
+	for _, decl := range d.file.Decls {
+		switch decl := decl.(type) {
+		case *st.POU:
+			out = append(out, pou(decl))
+		case *st.TypeBlock:
+			for _, td := range decl.Types {
+				t := s.proj.TypeOfDecl(td)
+				r := identRange(src, td.Name)
+				if len(decl.Types) == 1 {
+					r = spanRange(src, decl.KwPos, decl.EndPos)
+				}
+				sym := lspDocumentSymbol{Name: td.Name.Name, Kind: symTypeParam, Range: r, SelectionRange: identRange(src, td.Name)}
+				switch t.Class {
+				case st.StructClass:
+					sym.Kind, sym.Detail = symStruct, "STRUCT"
+					for _, f := range t.Fields {
+						if s.proj.FileOf(f.Ident) == d.file {
+							fr := identRange(src, f.Ident)
+							sym.Children = append(sym.Children, lspDocumentSymbol{Name: f.Name, Detail: f.Type.String(), Kind: symField, Range: fr, SelectionRange: fr})
+						}
+					}
+				case st.EnumClass:
+					sym.Kind, sym.Detail = symEnum, "enumeration"
+					for _, m := range t.Members {
+						mr := identRange(src, m.Ident)
+						sym.Children = append(sym.Children, lspDocumentSymbol{Name: m.Name, Detail: strconv.FormatInt(m.Value, 10), Kind: symEnumMember, Range: mr, SelectionRange: mr})
+					}
+				default:
+					sym.Detail = t.String()
+				}
+				out = append(out, sym)
+			}
+		case *st.Configuration:
+			sym := lspDocumentSymbol{Name: decl.Name.Name, Detail: "CONFIGURATION", Kind: symNamespace,
+				Range: spanRange(src, decl.KwPos, decl.EndPos), SelectionRange: identRange(src, decl.Name)}
+			sym.Children = vars(s.proj.GlobalScope(), decl.VarBlocks)
+			for _, r := range decl.Resources {
+				sym.Children = append(sym.Children, vars(s.proj.GlobalScope(), r.VarBlocks)...)
+			}
+			out = append(out, sym)
+		case *st.VarBlock:
+			out = append(out, vars(s.proj.GlobalScope(), []*st.VarBlock{decl})...)
+		}
+	}
+	return out
+}
+
+// ── Completion ────────────────────────────────────────────────────────────────
+
+type lspCompletionItem struct {
+	Label         string `json:"label"`
+	Kind          int    `json:"kind"`
+	Detail        string `json:"detail,omitempty"`
+	Documentation any    `json:"documentation,omitempty"`
+}
+
+// LSP CompletionItemKind values.
+const (
+	compMethod     = 2
+	compFunction   = 3
+	compField      = 5
+	compVariable   = 6
+	compClass      = 7
+	compModule     = 9
+	compEnum       = 13
+	compConstant   = 21
+	compEnumMember = 20
+	compStruct     = 22
+	compTypeParam  = 25
+)
+
+// memberChain matches "a.b[i].c." before the cursor; group 1 is the chain
+// without the final dot.
+var memberChain = regexp.MustCompile(`([A-Za-z_]\w*(?:\s*\[[^\[\]]*\])*\^?(?:\s*\.\s*[A-Za-z_]\w*(?:\s*\[[^\[\]]*\])*\^?)*)\s*\.\s*\w*$`)
+
+var chainSegment = regexp.MustCompile(`^\s*([A-Za-z_]\w*)((?:\s*\[[^\[\]]*\])*)\s*(\^?)\s*$`)
+
+func (s *lspServer) completion(p lspTextDocumentPosition) any {
+	d := s.docs[uriToPath(p.TextDocument.URI)]
+	if d == nil || s.proj == nil {
+		return nil
+	}
+	src := d.file.Source
+	off := offsetAt(src, p.Position)
+	lineStart := strings.LastIndexByte(src[:off], '\n') + 1
+	before := src[lineStart:off]
+	sc := s.scopeAt(d.file, off)
+
+	if m := memberChain.FindStringSubmatch(before); m != nil {
+		return s.memberItems(sc, m[1])
+	}
+
+	var items []lspCompletionItem
+	seen := map[string]bool{}
+	add := func(it lspCompletionItem) {
+		if key := strings.ToUpper(it.Label); !seen[key] {
+			seen[key] = true
+			items = append(items, it)
+		}
+	}
+	if sc.POU != nil {
+		for _, sym := range sc.Locals() {
+			sym = sc.Lookup(sym.Name)
+			add(lspCompletionItem{Label: sym.Name, Kind: compVariable, Detail: sym.Type.String() + " (" + sym.BlockKind() + ")"})
+		}
+		if fb := s.proj.InstanceType(ownerOrSelf(sc)); fb.Class == st.InstanceClass {
+			for _, m := range methodsOf(fb) {
+				add(lspCompletionItem{Label: m.Name.Name, Kind: compMethod, Detail: "METHOD"})
+			}
+		}
+	}
+	gvls := map[string]bool{}
+	for _, g := range s.proj.Globals() {
+		g = s.proj.GlobalScope().Lookup(g.Name)
+		kind := compVariable
+		if g.IsConstant() {
+			kind = compConstant
+		}
+		add(lspCompletionItem{Label: g.Name, Kind: kind, Detail: g.Type.String() + " (" + g.GVL + ")"})
+		gvls[g.GVL] = true
+	}
+	for _, d := range append(s.proj.POUs(), st.StandardPOUs()...) {
+		kind := map[st.POUKind]int{st.Program: compModule, st.FunctionBlock: compClass, st.Function: compFunction}[d.Kind]
+		add(lspCompletionItem{Label: d.Name.Name, Kind: kind, Detail: d.Kind.String(),
+			Documentation: map[string]string{"kind": "markdown", "value": "```st\n" + pouSignature(s.proj, d) + "\n```"}})
+	}
+	for _, td := range s.proj.TypeDecls() {
+		t := s.proj.TypeOfDecl(td)
+		kind := map[st.Class]int{st.StructClass: compStruct, st.EnumClass: compEnum}[t.Class]
+		if kind == 0 {
+			kind = compTypeParam
+		}
+		add(lspCompletionItem{Label: td.Name.Name, Kind: kind, Detail: "TYPE"})
+	}
+	for name := range gvls {
+		add(lspCompletionItem{Label: name, Kind: compModule, Detail: "global variable list"})
+	}
+	for _, f := range st.StdFuncs() {
+		add(lspCompletionItem{Label: f.Name, Kind: compFunction, Detail: f.Doc})
+	}
+	return map[string]any{"isIncomplete": false, "items": items}
+}
+
+// memberItems completes after "chain.": fields and methods of a struct or
+// instance, values of an enumeration type, or the variables of a GVL.
+func (s *lspServer) memberItems(sc *st.Scope, chain string) any {
+	segs := strings.Split(chain, ".")
+	items := []lspCompletionItem{}
+	first := chainSegment.FindStringSubmatch(segs[0])
+	if first == nil {
+		return nil
+	}
+	if len(segs) == 1 && first[2] == "" && first[3] == "" {
+		if sym := sc.Lookup(first[1]); sym != nil {
+			switch sym.Kind {
+			case st.GVLSymbol:
+				for _, g := range s.proj.Globals() {
+					if strings.EqualFold(g.GVL, sym.GVL) {
+						g = s.proj.GlobalScope().Lookup(g.Name)
+						items = append(items, lspCompletionItem{Label: g.Name, Kind: compVariable, Detail: g.Type.String()})
+					}
+				}
+				return map[string]any{"isIncomplete": false, "items": items}
+			case st.TypeSymbol:
+				for _, m := range sym.Type.Members {
+					items = append(items, lspCompletionItem{Label: m.Name, Kind: compEnumMember, Detail: strconv.FormatInt(m.Value, 10)})
+				}
+				return map[string]any{"isIncomplete": false, "items": items}
+			}
+		}
+	}
+	var t *st.Type
+	for i, seg := range segs {
+		m := chainSegment.FindStringSubmatch(seg)
+		if m == nil {
+			return nil
+		}
+		if i == 0 {
+			t = sc.TypeOf(&st.Ident{Name: m[1]})
+		} else if f := derefType(t).Field(m[1]); f != nil {
+			t = f.Type
+		} else {
+			return nil
+		}
+		for n := strings.Count(m[2], "["); n > 0 && t.Class == st.ArrayClass; n-- {
+			t = t.Elem
+		}
+		if m[3] != "" && t.Class == st.PointerClass {
+			t = t.Elem
+		}
+	}
+	t = derefType(t)
+	for x := t; x != nil && (x.Class == st.StructClass || x.Class == st.InstanceClass); x = x.Base {
+		for _, f := range x.Fields {
+			if x.Class == st.InstanceClass && f.Block != "VAR_INPUT" && f.Block != "VAR_OUTPUT" && f.Block != "VAR_IN_OUT" {
+				continue
+			}
+			items = append(items, lspCompletionItem{Label: f.Name, Kind: compField, Detail: strings.TrimSpace(f.Type.String() + " " + f.Block)})
+		}
+	}
+	if t.Class == st.InstanceClass {
+		for _, m := range methodsOf(t) {
+			items = append(items, lspCompletionItem{Label: m.Name.Name, Kind: compMethod, Detail: "METHOD"})
+		}
+	}
+	return map[string]any{"isIncomplete": false, "items": items}
+}
+
+// derefType looks through REFERENCE TO, which is accessed without ^.
+func derefType(t *st.Type) *st.Type {
+	if t.Class == st.PointerClass && t.Ref {
+		return t.Elem
+	}
+	return t
+}
+
+// methodsOf returns the methods of a function block type and its bases.
+func methodsOf(t *st.Type) []*st.POU {
+	var out []*st.POU
+	seen := map[string]bool{}
+	for x := t; x != nil && x.Class == st.InstanceClass; x = x.Base {
+		for _, m := range x.POU.Methods {
+			if key := strings.ToUpper(m.Name.Name); !seen[key] {
+				seen[key] = true
+				out = append(out, m)
+			}
+		}
+	}
+	return out
+}
+
+func ownerOrSelf(sc *st.Scope) *st.POU {
+	if sc.Owner != nil {
+		return sc.Owner
+	}
+	return sc.POU
+}
+
+// scopeAt returns the scope of the POU or method containing off.
+func (s *lspServer) scopeAt(f *st.File, off int) *st.Scope {
+	inside := func(d *st.POU) bool {
+		return d.KwPos.Offset <= off && (!d.EndPos.IsValid() || off <= d.EndPos.Offset)
+	}
+	for _, decl := range f.Decls {
+		d, ok := decl.(*st.POU)
+		if !ok || !inside(d) {
+			continue
+		}
+		for _, m := range d.Methods {
+			if inside(m) {
+				return s.proj.Scope(m)
+			}
+		}
+		return s.proj.Scope(d)
+	}
+	return s.proj.GlobalScope()
+}
+
+// ── Positions and URIs ────────────────────────────────────────────────────────
+
+// offsetAt converts an LSP position (UTF-16 code units) to a byte offset.
+func offsetAt(src string, pos lspPosition) int {
+	off := 0
+	for line := 0; line < pos.Line; line++ {
+		i := strings.IndexByte(src[off:], '\n')
+		if i < 0 {
+			return len(src)
+		}
+		off += i + 1
+	}
+	for units := 0; off < len(src) && src[off] != '\n' && units < pos.Character; {
+		r, size := utf8.DecodeRuneInString(src[off:])
+		units += len(utf16.Encode([]rune{r}))
+		off += size
+	}
+	return off
+}
+
+// positionAt converts a byte offset to an LSP position.
+func positionAt(src string, off int) lspPosition {
+	if off > len(src) {
+		off = len(src)
+	}
+	lineStart := strings.LastIndexByte(src[:off], '\n') + 1
+	line := strings.Count(src[:lineStart], "\n")
+	return lspPosition{Line: line, Character: len(utf16.Encode([]rune(src[lineStart:off])))}
+}
+
+func identRange(src string, id *st.Ident) lspRange {
+	return lspRange{positionAt(src, id.NamePos.Offset), positionAt(src, id.NamePos.Offset+len(id.Name))}
+}
+
+// wordRange covers the word starting at pos, or one character.
+func wordRange(src string, pos st.Pos) lspRange {
+	return lspRange{positionAt(src, pos.Offset), positionAt(src, wordEnd(src, pos.Offset))}
+}
+
+// spanRange covers from start to the end of the keyword at end.
+func spanRange(src string, start, end st.Pos) lspRange {
+	if !end.IsValid() {
+		end = start
+	}
+	return lspRange{positionAt(src, start.Offset), positionAt(src, wordEnd(src, end.Offset))}
+}
+
+func wordEnd(src string, off int) int {
+	end := off
+	for end < len(src) && (src[end] == '_' || src[end] >= '0' && src[end] <= '9' || src[end]|0x20 >= 'a' && src[end]|0x20 <= 'z') {
+		end++
+	}
+	if end == off && end < len(src) {
+		end++
+	}
+	return end
+}
+
+func uriToPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+	p := u.Path
+	if runtime.GOOS == "windows" {
+		p = strings.TrimPrefix(p, "/")
+	}
+	return filepath.Clean(filepath.FromSlash(p))
+}
+
+func pathToURI(path string) string {
+	p := filepath.ToSlash(path)
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+	return (&url.URL{Scheme: "file", Path: p}).String()
+}
@@ -0,0 +1,104 @@
+// iecst — project-level tooling for IEC 61131-3 Structured Text projects
+//
+// iecst works on whole projects rather than single conversions. Export files
+// (CoDeSys 2.3 .EXP, CoDeSys 3.5 .export, PLCOpen XML) are read through the
+// importers of this repository (exp2st23, exp2st35, plcopen2st) and written
+// through the matching exporters, so every command sees the same .st project
+// tree that the converters produce. The converters are looked up next to the
+// iecst executable first and then in PATH.
+//
+// Usage:
+//
+//	iecst <command> [flags] [arguments]
+//
+// Commands:
+//
+//	roundtrip      import, export and re-import export files and report what changed
+//	diff           semantic diff of two exports or .st trees, across formats
+//	merge          three-way merge of export files, usable as a git merge driver
+//	textconv       print an export file as canonical ST, usable as a git textconv driver
+//	fmt            format .st sources (keyword case, indentation, alignment, spacing)
+//	check          type-check .st sources: names, types, calls and constant indices
+//	lint           static analysis of .st sources, as text, JSON or SARIF
+//	test           run unit tests written in ST, with JUnit XML output
+//	sim            run a .st project as a soft PLC with tasks and a scriptable process image
+//	gen-types      Go structs with the PLC's byte layout and JSON Schema for STRUCT and enumeration DUTs
+//	gen-io         generate GVLs with located variables from a CSV I/O list
+//	iomap          I/O address map of located variables with conflict checks, as text, CSV or Markdown
+//	modbus         Modbus register map of GVL variables, with ST code that copies the registers
+//	opcua-nodeset  OPC UA NodeSet2 XML of GVL variables and their STRUCT and enumeration types
+//	symbols        CoDeSys symbol configuration XML or 2.3 style .SYM listing of global and PROGRAM variables
+//	doc            generate an HTML or Markdown reference from declarations and comments
+//	transpile      translate a .st project to portable C99 for gcc, fuzzers and simulations
+//	xref           cross-reference, call graph and type usage of .st sources, as text, JSON or DOT
+//	lsp            language server over stdio for editors
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+// ── Command table ─────────────────────────────────────────────────────────────
+
+type command struct {
+	summary string
+	run     func(args []string) int
+}
+
+var commands = map[string]command{
+	"fmt":           {"format .st sources (keyword case, indentation, alignment, spacing)", runFmt},
+	"check":         {"type-check .st sources: names, types, calls and constant indices", runCheck},
+	"lint":          {"static analysis of .st sources, as text, JSON or SARIF", runLint},
+	"test":          {"run unit tests written in ST, with JUnit XML output", runTest},
+	"sim":           {"run a .st project as a soft PLC with tasks and a scriptable process image", runSim},
+	"gen-types":     {"Go structs with the PLC's byte layout and JSON Schema for STRUCT and enumeration DUTs", runGenTypes},
+	"gen-io":        {"generate GVLs with located variables from a CSV I/O list", runGenIO},
+	"iomap":         {"I/O address map of located variables with conflict checks, as text, CSV or Markdown", runIomap},
+	"modbus":        {"Modbus register map of GVL variables, with ST code that copies the registers", runModbus},
+	"opcua-nodeset": {"OPC UA NodeSet2 XML of GVL variables and their STRUCT and enumeration types", runOpcuaNodeset},
+	"symbols":       {"CoDeSys symbol configuration XML or 2.3 style .SYM listing of global and PROGRAM variables", runSymbols},
+	"doc":           {"generate an HTML or Markdown reference from declarations and comments", runDoc},
+	"transpile":     {"translate a .st project to portable C99 for gcc, fuzzers and simulations", runTranspile},
+	"xref":          {"cross-reference, call graph and type usage of .st sources, as text, JSON or DOT", runXref},
+	"lsp":           {"language server over stdio for editors", runLsp},
+	"diff":          {"semantic diff of two exports or .st trees, across formats", runDiff},
+	"merge":         {"three-way merge of export files, usable as a git merge driver", runMerge},
+	"textconv":      {"print an export file as canonical ST, usable as a git textconv driver", runTextconv},
+	"roundtrip":     {"import, export and re-import export files and report what changed", runRoundtrip},
+}
+
+func usage() {
+	fmt.Fprint(os.Stderr, "iecst — project tooling for IEC 61131-3 Structured Text\n\n")
+	fmt.Fprintln(os.Stderr, "Usage:")
+	fmt.Fprint(os.Stderr, "  iecst <command> [flags] [arguments]\n\n")
+	fmt.Fprintln(os.Stderr, "Commands:")
+	names := make([]string, 0, len(commands))
+	width := 0
+	for name := range commands {
+		names = append(names, name)
+		width = max(width, len(name))
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-*s  %s\n", width, name, commands[name].summary)
+	}
+	fmt.Fprint(os.Stderr, "\nRun 'iecst <command> -h' for the flags of a command.\n")
+}
+
+// ── Main ──────────────────────────────────────────────────────────────────────
+
+func main() {
+	if len(os.Args) < 2 || os.Args[1] == "-h" || os.Args[1] == "-help" || os.Args[1] == "help" {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "iecst: unknown command %q\n\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+	os.Exit(cmd.run(os.Args[2:]))
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ── merge ─────────────────────────────────────────────────────────────────────
+
+// runMerge is a git merge driver for export files. It merges base, ours and
+// theirs at object granularity and writes the result over ours, as git
+// expects. Register it with:
+//
+//	git config merge.iecst.driver "iecst merge %O %A %B"
+//	echo "*.export merge=iecst" >> .gitattributes
+//
+// Exit status is 0 for a clean merge, 1 when conflicts remain (the result is
+// still written, with markers inside the ST text) and 2 on errors, in which
+// case ours is left untouched.
+func runMerge(args []string) int {
+	fs := flag.NewFlagSet("merge", flag.ExitOnError)
+	formatName := fs.String("format", "", "format of the files (codesys23, codesys35, plcopen); detected from ours when empty")
+	out := fs.String("o", "", "write the result to this file instead of over ours")
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, "iecst merge — three-way merge of export files (git merge driver)\n\n")
+		fmt.Fprintln(os.Stderr, "Usage:")
+		fmt.Fprint(os.Stderr, "  iecst merge [-format <name>] [-o <file>] <base> <ours> <theirs>\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 3 {
+		fs.Usage()
+		return 2
+	}
+	basePath, oursPath, theirsPath := fs.Arg(0), fs.Arg(1), fs.Arg(2)
+	if *out == "" {
+		*out = oursPath
+	}
+
+	// git hands the driver temporary files without extension, so the format
+	// has to come from the flag or from the content of ours.
+	format, err := resolveFormat(oursPath, *formatName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "iecst merge:", err)
+		return 2
+	}
+
+	work, err := os.MkdirTemp("", "iecst-merge-")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "cannot create temporary directory:", err)
+		return 2
+	}
+	defer os.RemoveAll(work)
+
+	var trees [3]*project
+	for i, p := range []string{basePath, oursPath, theirsPath} {
+		if trees[i], err = loadInput(p, format.name, work); err != nil {
+			fmt.Fprintf(os.Stderr, "iecst merge: %s: %v\n", p, err)
+			return 2
+		}
+	}
+
+	merged, conflicts := mergeProjects(trees[0], trees[1], trees[2])
+
+	mergedDir := filepath.Join(work, "merged")
+	if err := writeProject(merged, mergedDir); err != nil {
+		fmt.Fprintln(os.Stderr, "iecst merge:", err)
+		return 2
+	}
+	// Reproducible mode gives objects without a GUID in their sidecar the same
+	// ID in every merge, so repeated merges do not conflict over fresh IDs.
+	// Name, time and company come from ours so that they do not change.
+	name, extra := oursSettings(format, oursPath, trees[1])
+	exported, err := exportProject(format, mergedDir, filepath.Join(work, "export"), name, true, extra...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "iecst merge: export:", err)
+		return 2
+	}
+	data, err := os.ReadFile(exported)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "iecst merge:", err)
+		return 2
+	}
+	if err := os.WriteFile(*out, data, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, "iecst merge:", err)
+		return 2
+	}
+
+	if len(conflicts) > 0 {
+		for _, c := range conflicts {
+			fmt.Fprintf(os.Stderr, "CONFLICT %s\n", c)
+		}
+		return 1
+	}
+	return 0
+}
+
+var (
+	plcopenFileHeader    = regexp.MustCompile(`<fileHeader\b[^>]*\bcompanyName="([^"]*)"`)
+	plcopenContentHeader = regexp.MustCompile(`<contentHeader\b[^>]*\bname="([^"]*)"[^>]*\bmodificationDateTime="([^"]*)"`)
+)
+
+// oursSettings returns the project name and the extra exporter flags that
+// reproduce the header of ours: the PLCopen content header name, time and
+// company, or the latest object timestamp of a 3.5 export. Other formats
+// take the name from the file name of ours.
+func oursSettings(format *exportFormat, oursPath string, ours *project) (string, []string) {
+	name := strings.TrimSuffix(filepath.Base(oursPath), filepath.Ext(oursPath))
+	var extra []string
+	switch format {
+	case formatXML:
+		data, err := os.ReadFile(oursPath)
+		if err != nil {
+			break
+		}
+		if m := plcopenContentHeader.FindSubmatch(data); m != nil {
+			name = strings.TrimSuffix(html.UnescapeString(string(m[1])), ".project")
+			if t, err := time.Parse("2006-01-02T15:04:05.9999999", string(m[2])); err == nil {
+				extra = append(extra, "-time", t.Format(time.RFC3339Nano))
+			}
+		}
+		if m := plcopenFileHeader.FindSubmatch(data); m != nil {
+			extra = append(extra, "-company", html.UnescapeString(string(m[1])))
+		}
+	case formatEXP35:
+		// Objects keep the timestamps of their sidecars; new objects get
+		// the latest of them.
+		var latest int64
+		for _, obj := range ours.objects {
+			var ticks int64
+			if json.Unmarshal(obj.meta["timestamp"], &ticks) == nil && ticks > latest {
+				latest = ticks
+			}
+		}
+		if latest > 0 {
+			const epochOffset = 621355968000000000 // .NET ticks at the Unix epoch
+			t := time.Unix(0, (latest-epochOffset)*100).UTC()
+			extra = append(extra, "-time", t.Format(time.RFC3339Nano))
+		}
+	}
+	return name, extra
+}
+
+// mergedProject is the result of a three-way merge, ready to be written as a
+// .st tree. Folder sidecars are carried over from the side that has them.
+type mergedProject struct {
+	folders    map[string]bool
+	folderMeta map[string][]byte
+	objects    map[string]*stObject
+}
+
+// mergeProjects merges the object trees of ours and theirs against base.
+// Objects are paired the same way as for diff (GUID, path, move, rename).
+// It returns the merged tree and a description of each conflict.
+func mergeProjects(base, ours, theirs *project) (*mergedProject, []string) {
+	m := &mergedProject{folders: map[string]bool{}, folderMeta: map[string][]byte{}, objects: map[string]*stObject{}}
+	var conflicts []string
+
+	toOurs := matchObjects(base, ours)
+	toTheirs := matchObjects(base, theirs)
+	usedOurs, usedTheirs := map[string]bool{}, map[string]bool{}
+	for _, p := range toOurs {
+		usedOurs[p] = true
+	}
+	for _, p := range toTheirs {
+		usedTheirs[p] = true
+	}
+
+	add := func(obj *stObject) {
+		if prev, ok := m.objects[obj.path]; ok {
+			// two different objects ended up at the same path
+			text, n := merge3("", prev.src, obj.src, "ours", "theirs")
+			if n > 0 {
+				conflicts = append(conflicts, fmt.Sprintf("%s: added on both sides with different content", obj.path))
+			}
+			prev.src = text
+			return
+		}
+		m.objects[obj.path] = obj
+	}
+
+	for _, bp := range base.sortedPaths() {
+		ob := base.objects[bp]
+		oPath, inOurs := toOurs[bp]
+		tPath, inTheirs := toTheirs[bp]
+
+		switch {
+		case !inOurs && !inTheirs:
+			continue
+		case !inOurs:
+			t := theirs.objects[tPath]
+			if t.src != ob.src || tPath != bp {
+				conflicts = append(conflicts, fmt.Sprintf("%s: deleted in ours, modified in theirs (theirs kept)", bp))
+				add(copyObject(t, tPath, t.src, t.meta))
+			}
+			continue
+		case !inTheirs:
+			o := ours.objects[oPath]
+			if o.src != ob.src || oPath != bp {
+				conflicts = append(conflicts, fmt.Sprintf("%s: deleted in theirs, modified in ours (ours kept)", bp))
+				add(copyObject(o, oPath, o.src, o.meta))
+			}
+			continue
+		}
+
+		o, t := ours.objects[oPath], theirs.objects[tPath]
+		path := oPath
+		switch {
+		case oPath == bp:
+			path = tPath
+		case tPath != bp && tPath != oPath:
+			conflicts = append(conflicts, fmt.Sprintf("%s: moved to %s in ours and to %s in theirs (ours kept)", bp, oPath, tPath))
+		}
+
+		text, n := merge3(ob.src, o.src, t.src, "ours", "theirs")
+		if n > 0 {
+			conflicts = append(conflicts, fmt.Sprintf("%s: %d conflicting change(s) in the ST text", path, n))
+		}
+		add(copyObject(o, path, text, mergeMeta(ob.meta, o.meta, t.meta)))
+	}
+
+	for _, p := range ours.sortedPaths() {
+		if !usedOurs[p] {
+			o := ours.objects[p]
+			add(copyObject(o, p, o.src, o.meta))
+		}
+	}
+	for _, p := range theirs.sortedPaths() {
+		if !usedTheirs[p] {
+			t := theirs.objects[p]
+			add(copyObject(t, p, t.src, t.meta))
+		}
+	}
+
+	// Folders: everything either side has, except folders one side deleted
+	// that did not receive new objects.
+	for _, side := range []*project{ours, theirs} {
+		other := theirs
+		if side == theirs {
+			other = ours
+		}
+		for f := range side.folders {
+			if base.folders[f] && !other.folders[f] {
+				continue
+			}
+			m.folders[f] = true
+			if _, ok := m.folderMeta[f]; !ok {
+				if data, err := os.ReadFile(filepath.Join(side.root, filepath.FromSlash(f)) + ".meta.json"); err == nil {
+					m.folderMeta[f] = data
+				}
+			}
+		}
+	}
+	for path := range m.objects {
+		for dir := filepath.ToSlash(filepath.Dir(path)); dir != "."; dir = filepath.ToSlash(filepath.Dir(dir)) {
+			m.folders[dir] = true
+		}
+	}
+	return m, conflicts
+}
+
+func copyObject(o *stObject, path, src string, meta map[string]json.RawMessage) *stObject {
+	c := *o
+	c.path = path
+	c.src = src
+	c.meta = meta
+	return &c
+}
+
+// mergeMeta merges sidecar documents key by key: a key changed in ours wins,
+// otherwise the value from theirs is taken.
+func mergeMeta(base, ours, theirs map[string]json.RawMessage) map[string]json.RawMessage {
+	if ours == nil && theirs == nil {
+		return nil
+	}
+	out := map[string]json.RawMessage{}
+	keys := map[string]bool{}
+	for _, doc := range []map[string]json.RawMessage{base, ours, theirs} {
+		for k := range doc {
+			keys[k] = true
+		}
+	}
+	for k := range keys {
+		b, bok := base[k]
+		o, ook := ours[k]
+		t, tok := theirs[k]
+		if ook != bok || !bytes.Equal(o, b) {
+			if ook {
+				out[k] = o
+			}
+			continue
+		}
+		if tok {
+			out[k] = t
+		}
+	}
+	return out
+}
+
+// writeProject writes a merged tree as .st files with their sidecars.
+func writeProject(m *mergedProject, dir string) error {
+	for f := range m.folders {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.FromSlash(f)), 0755); err != nil {
+			return err
+		}
+		if data, ok := m.folderMeta[f]; ok {
+			if err := os.WriteFile(filepath.Join(dir, filepath.FromSlash(f))+".meta.json", data, 0644); err != nil {
+				return err
+			}
+		}
+	}
+	for path, obj := range m.objects {
+		file := filepath.Join(dir, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(file+".st", []byte(strings.TrimRight(obj.src, "\n")+"\n"), 0644); err != nil {
+			return err
+		}
+		if len(obj.meta) > 0 {
+			data, err := json.MarshalIndent(obj.meta, "", "  ")
+			if err != nil {
+				return err
+			}
+			if err := os.WriteFile(file+".meta.json", append(data, '\n'), 0644); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"testing"
+)
+
+// plcopenIdentity matches what a merge must keep from ours in a PLCopen
+// export: the header names and times and the ObjectId of every element.
+var plcopenIdentity = regexp.MustCompile(`<fileHeader [^>]*>|<contentHeader [^>]*>|<ObjectId>[^<]*</ObjectId>`)
+
+// TestMergeUnchanged merges an export with itself and checks that ours comes
+// back. 3.5 exports come back byte for byte, CoDeSys 2.3 exports up to line
+// endings and PLCopen exports with the same names, times and ObjectIds.
+func TestMergeUnchanged(t *testing.T) {
+	buildConverters(t)
+	for _, file := range []string{
+		"../../testdata/codesys23/export.EXP",
+		"../../testdata/codesys35/export.export",
+		"../../testdata/plcopen/TestProject.xml",
+	} {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			want, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out := filepath.Join(t.TempDir(), filepath.Base(file))
+			if code := runMerge([]string{"-o", out, file, file, file}); code != 0 {
+				t.Fatalf("iecst merge: exit status %d", code)
+			}
+			got, err := os.ReadFile(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			switch filepath.Ext(file) {
+			case ".export":
+				if !bytes.Equal(got, want) {
+					t.Errorf("merge changed the export")
+				}
+			case ".EXP":
+				crlf := []byte("\r\n")
+				if !bytes.Equal(bytes.ReplaceAll(got, crlf, []byte("\n")), bytes.ReplaceAll(want, crlf, []byte("\n"))) {
+					t.Errorf("merge changed the export")
+				}
+			case ".xml":
+				g, w := identity(got), identity(want)
+				if len(g) != len(w) {
+					t.Fatalf("got %d names and IDs, want %d:\n%q\n%q", len(g), len(w), g, w)
+				}
+				for i := range w {
+					if g[i] != w[i] {
+						t.Errorf("got %s, want %s", g[i], w[i])
+					}
+				}
+			}
+		})
+	}
+}
+
+func identity(data []byte) []string {
+	var ids []string
+	for _, m := range plcopenIdentity.FindAll(data, -1) {
+		ids = append(ids, string(m))
+	}
+	sort.Strings(ids)
+	return ids
+}
@@ -0,0 +1,593 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/damischa1/iec-st-tools/st"
+)
+
+// ── modbus ────────────────────────────────────────────────────────────────────
+
+// runModbus lays out GVL variables in the four Modbus tables and prints the
+// register map. Variables take part when they, or their VAR_GLOBAL block,
+// carry {attribute 'modbus' := 'table[:address]'}, and with -memory every
+// %MW, %MD and %ML variable is a holding register at its word address.
+// With -out it also writes a GVL with the register arrays and a PROGRAM that
+// copies between them and the variables each cycle.
+func runModbus(args []string) int {
+	flags := flag.NewFlagSet("modbus", flag.ExitOnError)
+	format := flags.String("format", "csv", "map format: csv or json")
+	memory := flags.Bool("memory", false, "map all %MW, %MD and %ML variables to holding registers at their word address")
+	order := flags.String("word-order", "big", "register order of 32- and 64-bit values: big (most significant word first) or little")
+	out := flags.String("out", "", "directory to write the register GVL and the mapping PROGRAM to")
+	name := flags.String("name", "Modbus", "suffix of the generated GVL_<name> and PRG_<name>")
+	mode := flags.String("addressing", "indexed", "meaning of the number in %MW, %MD, %ML for -memory: indexed or byte, as in iecst iomap")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, "iecst modbus — Modbus register map and mapping code for GVL variables\n\n")
+		fmt.Fprintln(os.Stderr, "Usage:")
+		fmt.Fprint(os.Stderr, "  iecst modbus [-format csv|json] [-memory] [-addressing indexed|byte] [-word-order big|little] [-out DIR] [-name NAME] [file or directory ...]\n\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if *format != "csv" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "iecst modbus: unknown output format %q (want csv or json)\n", *format)
+		return 2
+	}
+	if *order != "big" && *order != "little" {
+		fmt.Fprintf(os.Stderr, "iecst modbus: unknown word order %q (want big or little)\n", *order)
+		return 2
+	}
+	if *mode != "indexed" && *mode != "byte" {
+		fmt.Fprintf(os.Stderr, "iecst modbus: unknown addressing %q (want indexed or byte)\n", *mode)
+		return 2
+	}
+	if !stIdentRe.MatchString(*name) {
+		fmt.Fprintf(os.Stderr, "iecst modbus: %q is not a valid name\n", *name)
+		return 2
+	}
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	proj, err := st.LoadProject(paths...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "iecst modbus:", err)
+		return 2
+	}
+
+	b := &mbBuilder{p: proj, order: *order, memory: *memory, byteAddressing: *mode == "byte"}
+	b.collect()
+	b.check()
+	findings := append(syntaxFindings(proj), b.findings...)
+	sortFindings(findings)
+
+	switch *format {
+	case "csv":
+		err = writeModbusCSV(os.Stdout, b.entries)
+	case "json":
+		entries := b.entries
+		if entries == nil {
+			entries = []*mbEntry{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(entries)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "iecst modbus:", err)
+		return 2
+	}
+	writeFindings(os.Stderr, "text", "iecst modbus", nil, findings)
+	for _, f := range findings {
+		if f.Level == "error" {
+			if *out != "" {
+				fmt.Fprintln(os.Stderr, "iecst modbus: the map has errors, nothing written")
+			}
+			return 1
+		}
+	}
+
+	if *out != "" {
+		files := map[string]string{
+			"GVL_" + *name + ".st": b.registerGVL("GVL_" + *name),
+			"PRG_" + *name + ".st": b.mappingProgram("PRG_" + *name),
+		}
+		if err := os.MkdirAll(*out, 0755); err != nil {
+			fmt.Fprintln(os.Stderr, "iecst modbus:", err)
+			return 2
+		}
+		for _, file := range []string{"GVL_" + *name + ".st", "PRG_" + *name + ".st"} {
+			text, err := st.Format(files[file], &st.FormatOptions{})
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "iecst modbus: generated %s does not parse: %v\n", file, err)
+				return 2
+			}
+			if err := os.WriteFile(filepath.Join(*out, file), []byte(text), 0644); err != nil {
+				fmt.Fprintln(os.Stderr, "iecst modbus:", err)
+				return 2
+			}
+		}
+	}
+	return 0
+}
+
+// ── Register map ──────────────────────────────────────────────────────────────
+
+// mbTables are the Modbus tables in protocol order, with the array of the
+// register GVL that holds each and whether the client can write it.
+var mbTables = []struct {
+	name, array string
+	bits        bool
+	writable    bool
+}{
+	{"coil", "aCoils", true, true},
+	{"discrete", "aDiscreteInputs", true, false},
+	{"input", "aInputRegisters", false, false},
+	{"holding", "aHoldingRegisters", false, true},
+}
+
+func mbTable(name string) int {
+	for i, t := range mbTables {
+		if t.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// mbEntry is one elementary value in a Modbus table. Arrays and structures
+// are split into their elements and members.
+type mbEntry struct {
+	Table     string `json:"table"`               // coil, discrete, input or holding
+	Address   int64  `json:"address"`             // 0-based protocol address
+	Count     int64  `json:"count"`               // bits or registers
+	Variable  string `json:"variable"`            // GVL.name, GVL.name[2], GVL.name.member
+	Type      string `json:"type"`                // IEC type
+	Encoding  string `json:"encoding"`            // bool, int16, uint16, int32, uint32, float32, int64, uint64, float64
+	Access    string `json:"access"`              // read or read-write, seen from the client
+	WordOrder string `json:"wordOrder,omitempty"` // big or little, for values of more than one register
+	Comment   string `json:"comment,omitempty"`
+	File      string `json:"file"`
+	Line      int    `json:"line"`
+	Column    int    `json:"column"`
+
+	table int
+	expr  string // ST expression of the value
+	typ   *st.Type
+}
+
+type mbBuilder struct {
+	p              *st.Project
+	order          string
+	memory         bool
+	byteAddressing bool
+
+	entries  []*mbEntry
+	findings []finding
+	next     [4]int64 // next free address per table
+}
+
+func (b *mbBuilder) report(file string, id *st.Ident, rule, level, format string, args ...any) {
+	b.findings = append(b.findings, finding{Rule: rule, Level: level, File: file, Line: id.NamePos.Line, Column: id.NamePos.Col, Message: fmt.Sprintf(format, args...)})
+}
+
+// collect walks the globals in GVL and declaration order. A variable
+// without an address follows the previous one of its table; a block
+// attribute with an address places the first variable of the block there.
+func (b *mbBuilder) collect() {
+	gs := b.p.GlobalScope()
+	started := map[*st.VarBlock]bool{}
+	for _, sym := range b.p.Globals() {
+		file := ""
+		if sym.File != nil {
+			file = sym.File.Name
+		}
+		spec, ok := sym.Decl.Attribute("modbus")
+		if !ok && sym.Block != nil {
+			if spec, ok = sym.Block.Attribute("modbus"); ok && started[sym.Block] {
+				spec, _, _ = strings.Cut(spec, ":")
+			}
+			started[sym.Block] = ok
+		}
+
+		table, addr := -1, int64(-1)
+		switch {
+		case ok:
+			name, at, hasAt := strings.Cut(spec, ":")
+			table = mbTable(strings.ToLower(strings.TrimSpace(name)))
+			if table < 0 {
+				b.report(file, sym.Ident, "attribute", "error", "modbus table %q is not coil, discrete, input or holding", strings.TrimSpace(name))
+				continue
+			}
+			if hasAt {
+				n, err := strconv.ParseInt(strings.TrimSpace(at), 10, 64)
+				if err != nil || n < 0 || n > 65535 {
+					b.report(file, sym.Ident, "attribute", "error", "modbus address %q is not in 0..65535", strings.TrimSpace(at))
+					continue
+				}
+				addr = n
+			}
+		case b.memory && sym.Decl.At != nil:
+			a := parseIOAddress(sym.Decl.At.Text)
+			if a.err != "" || a.area != 'M' || !a.ranged {
+				continue
+			}
+			from := a.start(b.byteAddressing)
+			if a.size < 16 || from%16 != 0 {
+				b.report(file, sym.Ident, "address", "warning", "%s at %s does not start on a register and is not mapped", sym.Name, sym.Decl.At.Text)
+				continue
+			}
+			table, addr = mbTable("holding"), from/16
+		default:
+			continue
+		}
+
+		if addr < 0 {
+			addr = b.next[table]
+		}
+		expr := sym.Name
+		if _, qualified := sym.Block.Attribute("qualified_only"); qualified {
+			expr = sym.GVL + "." + sym.Name
+		}
+		e := &mbEntry{
+			Variable: sym.GVL + "." + sym.Name,
+			Comment:  strings.Join(strings.Fields(sym.Decl.Comment), " "),
+			File:     file,
+			Line:     sym.Ident.NamePos.Line,
+			Column:   sym.Ident.NamePos.Col,
+			table:    table,
+			expr:     expr,
+		}
+		if mbTables[table].writable && sym.IsConstant() {
+			b.report(file, sym.Ident, "access", "error", "%s is CONSTANT but %s can be written by the client", sym.Name, mbTables[table].name)
+			continue
+		}
+		b.next[table] = b.leaves(e, gs.ResolveType(sym.Decl.Type), addr, file, sym.Ident)
+	}
+}
+
+// leaves adds the elementary values of e, starting at addr, and returns the
+// address after them.
+func (b *mbBuilder) leaves(e *mbEntry, t *st.Type, addr int64, file string, id *st.Ident) int64 {
+	switch t.Class {
+	case st.ArrayClass:
+		n := int64(1)
+		for _, d := range t.Dims {
+			if !d.Known {
+				b.report(file, id, "type", "error", "%s: array bounds of %s are not constant", e.Variable, t.Name)
+				return addr
+			}
+			n *= d.Len()
+		}
+		for i := int64(0); i < n; i++ {
+			var idx []string
+			for k, rest := len(t.Dims)-1, i; k >= 0; k-- {
+				idx = append([]string{strconv.FormatInt(t.Dims[k].Lo+rest%t.Dims[k].Len(), 10)}, idx...)
+				rest /= t.Dims[k].Len()
+			}
+			x := *e
+			x.Variable += "[" + strings.Join(idx, ", ") + "]"
+			x.expr += "[" + strings.Join(idx, ", ") + "]"
+			addr = b.leaves(&x, t.Elem, addr, file, id)
+		}
+		return addr
+	case st.StructClass:
+		var chain []*st.Type
+		for s := t; s != nil; s = s.Base {
+			chain = append([]*st.Type{s}, chain...)
+		}
+		for _, s := range chain {
+			for _, f := range s.Fields {
+				x := *e
+				x.Variable += "." + f.Name
+				x.expr += "." + f.Name
+				if f.Decl != nil {
+					x.Comment = strings.Join(strings.Fields(f.Decl.Comment), " ")
+				}
+				addr = b.leaves(&x, f.Type, addr, file, id)
+			}
+		}
+		return addr
+	}
+
+	enc, regs := mbEncoding(t)
+	if enc == "" {
+		b.report(file, id, "type", "error", "%s: %s cannot be mapped to Modbus", e.Variable, t.Name)
+		return addr
+	}
+	x := *e
+	tbl := mbTables[x.table]
+	x.Table, x.Address, x.typ, x.Type, x.Encoding = tbl.name, addr, t, t.Name, enc
+	x.Count = int64(regs)
+	x.Access = "read"
+	if tbl.writable {
+		x.Access = "read-write"
+	}
+	if tbl.bits {
+		if t.Class != st.BoolClass {
+			b.report(file, id, "type", "error", "%s: %s tables hold BOOL, not %s", x.Variable, tbl.name, t.Name)
+			return addr
+		}
+		x.Count = 1
+	} else if x.Count > 1 {
+		x.WordOrder = b.order
+	}
+	b.entries = append(b.entries, &x)
+	return addr + x.Count
+}
+
+// mbEncoding returns how a value of an elementary type travels in registers
+// and how many registers it takes. Values of 8 bits take a register each.
+func mbEncoding(t *st.Type) (string, int) {
+	bits := max(t.Bits, 16)
+	switch t.Class {
+	case st.BoolClass:
+		return "bool", 1
+	case st.IntClass:
+		if t.Signed {
+			return "int" + strconv.Itoa(bits), bits / 16
+		}
+		return "uint" + strconv.Itoa(bits), bits / 16
+	case st.BitsClass, st.CharClass, st.TimeClass, st.DateClass:
+		return "uint" + strconv.Itoa(bits), bits / 16
+	case st.EnumClass:
+		return "int" + strconv.Itoa(bits), bits / 16
+	case st.RealClass:
+		return "float" + strconv.Itoa(bits), bits / 16
+	}
+	return "", 0
+}
+
+// check reports values that share registers and addresses past the end of
+// a table, and sorts the entries by table and address.
+func (b *mbBuilder) check() {
+	sort.SliceStable(b.entries, func(i, j int) bool {
+		x, y := b.entries[i], b.entries[j]
+		if x.table != y.table {
+			return x.table < y.table
+		}
+		return x.Address < y.Address
+	})
+	for i, e := range b.entries {
+		report := func(rule, format string, args ...any) {
+			b.findings = append(b.findings, finding{Rule: rule, Level: "error", File: e.File, Line: e.Line, Column: e.Column, Message: fmt.Sprintf(format, args...)})
+		}
+		if e.Address+e.Count > 65536 {
+			report("address", "%s at %s %d does not fit below address 65536", e.Variable, e.Table, e.Address)
+		}
+		for _, prev := range b.entries[:i] {
+			if prev.table == e.table && prev.Address+prev.Count > e.Address {
+				report("overlap", "%s at %s %d overlaps %s at %d (%s:%d)", e.Variable, e.Table, e.Address, prev.Variable, prev.Address, prev.File, prev.Line)
+				break
+			}
+		}
+	}
+}
+
+func writeModbusCSV(w io.Writer, entries []*mbEntry) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"table", "address", "count", "variable", "type", "encoding", "access", "word order", "comment"})
+	for _, e := range entries {
+		cw.Write([]string{e.Table, strconv.FormatInt(e.Address, 10), strconv.FormatInt(e.Count, 10), e.Variable, e.Type, e.Encoding, e.Access, e.WordOrder, e.Comment})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ── Mapping code ──────────────────────────────────────────────────────────────
+
+// size returns the number of bits or registers used in each table.
+func (b *mbBuilder) size() [4]int64 {
+	var n [4]int64
+	for _, e := range b.entries {
+		n[e.table] = max(n[e.table], e.Address+e.Count)
+	}
+	return n
+}
+
+// registerGVL returns the GVL with one array per table in use, indexed by
+// protocol address, for the Modbus server to map.
+func (b *mbBuilder) registerGVL(name string) string {
+	var sb strings.Builder
+	sb.WriteString("// trust-LSP wrapper — compiler extracts VAR_GLOBAL automatically\n")
+	fmt.Fprintf(&sb, "CONFIGURATION %s\n    VAR_GLOBAL\n", name)
+	sb.WriteString("        // Generated by iecst modbus. Do not edit.\n")
+	for i, n := range b.size() {
+		if n == 0 {
+			continue
+		}
+		elem := "WORD"
+		if mbTables[i].bits {
+			elem = "BOOL"
+		}
+		fmt.Fprintf(&sb, "        %s : ARRAY[0..%d] OF %s;\n", mbTables[i].array, n-1, elem)
+	}
+	sb.WriteString("    END_VAR\nEND_CONFIGURATION\n")
+	return sb.String()
+}
+
+// mappingProgram returns the PROGRAM that copies between the variables and
+// the register arrays. Read-only tables are filled from the variables every
+// cycle. For coils and holding registers a shadow copy shows which values
+// the client wrote since the last cycle; those go into the variables first,
+// then all variables are copied out, so changes made by the PLC show too.
+func (b *mbBuilder) mappingProgram(name string) string {
+	var body strings.Builder
+	used := map[string]bool{}
+	line := func(indent int, format string, args ...any) {
+		fmt.Fprintf(&body, "%s%s\n", strings.Repeat("    ", indent), fmt.Sprintf(format, args...))
+	}
+	for _, e := range b.entries {
+		tbl := mbTables[e.table]
+		reg := func(i int64) string { return fmt.Sprintf("%s[%d]", tbl.array, e.Address+i) }
+		shadow := func(i int64) string { return fmt.Sprintf("%sShadow[%d]", tbl.array, e.Address+i) }
+		line(0, "")
+		line(0, "// %s %d: %s : %s", tbl.name, e.Address, e.Variable, e.Type)
+		if tbl.writable {
+			var changed []string
+			for i := int64(0); i < e.Count; i++ {
+				changed = append(changed, reg(i)+" <> "+shadow(i))
+			}
+			line(0, "IF %s THEN", strings.Join(changed, " OR "))
+			for _, s := range b.decode(e, reg, used) {
+				line(1, "%s", s)
+			}
+			line(0, "END_IF;")
+		}
+		for _, s := range b.encode(e, reg, used) {
+			line(0, "%s", s)
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString("// Generated by iecst modbus. Do not edit.\n")
+	sb.WriteString("// Copies between the Modbus register arrays and the variables they map;\n")
+	sb.WriteString("// call once per cycle of the task that serves Modbus.\n")
+	fmt.Fprintf(&sb, "PROGRAM %s\nVAR\n", name)
+	for i, n := range b.size() {
+		if n > 0 && mbTables[i].writable {
+			elem := "WORD"
+			if mbTables[i].bits {
+				elem = "BOOL"
+			}
+			fmt.Fprintf(&sb, "    %sShadow : ARRAY[0..%d] OF %s;\n", mbTables[i].array, n-1, elem)
+		}
+	}
+	for _, v := range []struct{ name, decl string }{
+		{"dw", "DWORD"}, {"lw", "LWORD"}, {"pdw", "POINTER TO DWORD"}, {"plw", "POINTER TO LWORD"},
+	} {
+		if used[v.name] {
+			fmt.Fprintf(&sb, "    %s : %s;\n", v.name, v.decl)
+		}
+	}
+	sb.WriteString("END_VAR\n")
+	sb.WriteString(strings.TrimPrefix(body.String(), "\n"))
+	sb.WriteString("\n")
+	for i, n := range b.size() {
+		if n > 0 && mbTables[i].writable {
+			fmt.Fprintf(&sb, "%sShadow := %s;\n", mbTables[i].array, mbTables[i].array)
+		}
+	}
+	sb.WriteString("END_PROGRAM\n")
+	return sb.String()
+}
+
+// words returns the registers of a multi-register value from the most
+// significant word down, as the word order lays them out.
+func (b *mbBuilder) words(e *mbEntry, reg func(int64) string) []string {
+	out := make([]string, e.Count)
+	for i := range out {
+		if b.order == "big" {
+			out[i] = reg(int64(i))
+		} else {
+			out[i] = reg(e.Count - 1 - int64(i))
+		}
+	}
+	return out
+}
+
+// wide returns the temporary and pointer used for values of n registers.
+func wide(n int64, used map[string]bool) (tmp, ptr, typ string) {
+	tmp, ptr, typ = "dw", "pdw", "DWORD"
+	if n == 4 {
+		tmp, ptr, typ = "lw", "plw", "LWORD"
+	}
+	used[tmp] = true
+	return tmp, ptr, typ
+}
+
+// encode returns the statements that copy a variable into its registers.
+func (b *mbBuilder) encode(e *mbEntry, reg func(int64) string, used map[string]bool) []string {
+	t := e.typ
+	switch {
+	case mbTables[e.table].bits, t.Class == st.BitsClass && t.Bits == 16:
+		return []string{fmt.Sprintf("%s := %s;", reg(0), e.expr)}
+	case e.Count == 1:
+		return []string{fmt.Sprintf("%s := %s_TO_WORD(%s);", reg(0), b.convName(t), e.expr)}
+	}
+	tmp, ptr, typ := wide(e.Count, used)
+	var out []string
+	switch {
+	case t.Class == st.RealClass:
+		used[ptr] = true
+		out = append(out, fmt.Sprintf("%s := ADR(%s);", ptr, e.expr), fmt.Sprintf("%s := %s^;", tmp, ptr))
+	case t.Class == st.BitsClass:
+		out = append(out, fmt.Sprintf("%s := %s;", tmp, e.expr))
+	default:
+		out = append(out, fmt.Sprintf("%s := %s_TO_%s(%s);", tmp, b.convName(t), typ, e.expr))
+	}
+	for i, r := range b.words(e, reg) {
+		shift := (e.Count - 1 - int64(i)) * 16
+		if shift == 0 {
+			out = append(out, fmt.Sprintf("%s := %s_TO_WORD(%s);", r, typ, tmp))
+		} else {
+			out = append(out, fmt.Sprintf("%s := %s_TO_WORD(SHR(%s, %d));", r, typ, tmp, shift))
+		}
+	}
+	return out
+}
+
+// decode returns the statements that copy registers into a variable.
+func (b *mbBuilder) decode(e *mbEntry, reg func(int64) string, used map[string]bool) []string {
+	t := e.typ
+	switch {
+	case mbTables[e.table].bits, t.Class == st.BitsClass && t.Bits == 16:
+		return []string{fmt.Sprintf("%s := %s;", e.expr, reg(0))}
+	case t.Class == st.BoolClass:
+		return []string{fmt.Sprintf("%s := %s <> 0;", e.expr, reg(0))}
+	case e.Count == 1:
+		return []string{fmt.Sprintf("%s := WORD_TO_%s(%s);", e.expr, b.convName(t), reg(0))}
+	}
+	tmp, ptr, typ := wide(e.Count, used)
+	var parts []string
+	for i, r := range b.words(e, reg) {
+		shift := (e.Count - 1 - int64(i)) * 16
+		if shift == 0 {
+			parts = append(parts, fmt.Sprintf("WORD_TO_%s(%s)", typ, r))
+		} else {
+			parts = append(parts, fmt.Sprintf("SHL(WORD_TO_%s(%s), %d)", typ, r, shift))
+		}
+	}
+	out := []string{fmt.Sprintf("%s := %s;", tmp, strings.Join(parts, " OR "))}
+	switch {
+	case t.Class == st.RealClass:
+		used[ptr] = true
+		out = append(out, fmt.Sprintf("%s := ADR(%s);", ptr, e.expr), fmt.Sprintf("%s^ := %s;", ptr, tmp))
+	case t.Class == st.BitsClass:
+		out = append(out, fmt.Sprintf("%s := %s;", e.expr, tmp))
+	default:
+		out = append(out, fmt.Sprintf("%s := %s_TO_%s(%s);", e.expr, typ, b.convName(t), tmp))
+	}
+	return out
+}
+
+// convName is the elementary type name used in conversion functions:
+// aliases resolve to the type they name, enumerations to their base type.
+func (b *mbBuilder) convName(t *st.Type) string {
+	if t.Class == st.EnumClass {
+		if t.Base != nil {
+			return b.convName(t.Base)
+		}
+		return "INT"
+	}
+	for i := 0; i < 8 && st.Elementary(t.Name) == nil && t.Decl != nil; i++ {
+		t = b.p.GlobalScope().ResolveType(t.Decl.Type)
+	}
+	switch strings.ToUpper(t.Name) {
+	case "TIME_OF_DAY":
+		return "TOD"
+	case "DATE_AND_TIME":
+		return "DT"
+	}
+	return strings.ToUpper(t.Name)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/damischa1/iec-st-tools/interp"
+	"github.com/damischa1/iec-st-tools/st"
+)
+
+const modbusGVL = `CONFIGURATION GVL_Hmi
+    {attribute 'modbus' := 'holding:0'}
+    VAR_GLOBAL
+        rSetpoint : REAL := 1.5;
+        lrTotal   : LREAL := -2.5;
+        diCount   : DINT := -2;
+        wMode     : WORD := 16#1234;
+    END_VAR
+END_CONFIGURATION
+`
+
+// TestModbusProgram runs the generated PRG_Modbus in the interpreter, as
+// iecst sim would: variables must reach the holding registers bit for bit,
+// and registers the client writes must reach the variables.
+func TestModbusProgram(t *testing.T) {
+	for _, order := range []string{"big", "little"} {
+		t.Run(order, func(t *testing.T) {
+			m := simModbus(t, order)
+			prog, err := m.Program("PRG_Modbus")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := prog.Call(nil); err != nil {
+				t.Fatal(err)
+			}
+			// REAL 1.5 = 16#3FC00000, LREAL -2.5 = 16#C004000000000000.
+			want := []int64{0x3FC0, 0x0000, 0xC004, 0, 0, 0, 0xFFFF, 0xFFFE, 0x1234}
+			if order == "little" {
+				want = []int64{0x0000, 0x3FC0, 0, 0, 0, 0xC004, 0xFFFE, 0xFFFF, 0x1234}
+			}
+			checkRegisters(t, m, want)
+
+			// The client writes REAL 2.0 = 16#40000000 and DINT 7.
+			regs := map[int]int64{0: 0x4000, 1: 0, 6: 0, 7: 7}
+			if order == "little" {
+				regs = map[int]int64{0: 0, 1: 0x4000, 6: 7, 7: 0}
+			}
+			for i, v := range regs {
+				if err := m.Set(fmt.Sprintf("aHoldingRegisters[%d]", i), v); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if _, err := prog.Call(nil); err != nil {
+				t.Fatal(err)
+			}
+			for path, want := range map[string]any{"rSetpoint": 2.0, "diCount": int64(7), "lrTotal": -2.5} {
+				got, err := m.Get(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != want {
+					t.Errorf("%s = %v, want %v", path, got, want)
+				}
+			}
+		})
+	}
+}
+
+// simModbus writes the GVL and the generated files to a directory and
+// returns a machine for the project.
+func simModbus(t *testing.T, order string) *interp.Machine {
+	t.Helper()
+	dir := t.TempDir()
+	write := func(name, text string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("GVL_Hmi.st", modbusGVL)
+	proj, err := st.LoadProject(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &mbBuilder{p: proj, order: order}
+	b.collect()
+	b.check()
+	if len(b.findings) > 0 {
+		t.Fatalf("findings: %v", b.findings)
+	}
+	write("GVL_Modbus.st", b.registerGVL("GVL_Modbus"))
+	write("PRG_Modbus.st", b.mappingProgram("PRG_Modbus"))
+
+	proj, err = st.LoadProject(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for f, list := range proj.SyntaxErrors {
+		t.Fatalf("%s: %v", f.Name, list)
+	}
+	for f, list := range proj.Check() {
+		t.Fatalf("%s: %v", f.Name, list)
+	}
+	m, err := interp.New(proj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func checkRegisters(t *testing.T, m *interp.Machine, want []int64) {
+	t.Helper()
+	for i, w := range want {
+		got, err := m.Get(fmt.Sprintf("aHoldingRegisters[%d]", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != w {
+			t.Errorf("register %d = 16#%X, want 16#%X", i, got, w)
+		}
+	}
+}
@@ -0,0 +1,442 @@
+package main
+
+import (
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/damischa1/iec-st-tools/st"
+)
+
+// ── opcua-nodeset ─────────────────────────────────────────────────────────────
+
+// runOpcuaNodeset writes an OPC UA NodeSet2 XML for the global variables of
+// a source tree, so clients can be built before the PLC runs. Folders and
+// GVLs become objects below the Objects folder, mirroring the source tree;
+// variables get the built-in data type matching their IEC type, and the
+// STRUCT and enumeration types they use become DataType nodes with
+// definitions. {attribute 'symbol'} on a variable or VAR_GLOBAL block sets
+// its access ('read', 'write', 'readwrite' or 'none'); with -symbol only
+// variables that carry it are exported, as in a CoDeSys symbol
+// configuration.
+func runOpcuaNodeset(args []string) int {
+	flags := flag.NewFlagSet("opcua-nodeset", flag.ExitOnError)
+	name := flags.String("name", "", "browse name of the root object (default the name of the source directory)")
+	uri := flags.String("uri", "", "namespace URI of the model (default urn:iecst:<name>)")
+	version := flags.String("version", "1.0.0", "model version")
+	prefix := flags.String("prefix", "", "prefix of the string NodeIds of variables, e.g. |var|Device.Application.")
+	symbol := flags.Bool("symbol", false, "export only variables with {attribute 'symbol'} on them or their VAR_GLOBAL block")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, "iecst opcua-nodeset — OPC UA NodeSet2 XML for GVL variables and their data types\n\n")
+		fmt.Fprintln(os.Stderr, "Usage:")
+		fmt.Fprint(os.Stderr, "  iecst opcua-nodeset [-name NAME] [-uri URI] [-version V] [-prefix P] [-symbol] [source directory] > model.xml\n\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return 2
+	}
+	root := "."
+	if flags.NArg() == 1 {
+		root = flags.Arg(0)
+	}
+	proj, err := st.LoadProject(root)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "iecst opcua-nodeset:", err)
+		return 2
+	}
+	if *name == "" {
+		abs, _ := filepath.Abs(root)
+		*name = filepath.Base(abs)
+	}
+	if *uri == "" {
+		*uri = "urn:iecst:" + *name
+	}
+	date := time.Now().UTC()
+	if sde := os.Getenv("SOURCE_DATE_EPOCH"); sde != "" {
+		secs, err := strconv.ParseInt(sde, 10, 64)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "iecst opcua-nodeset: invalid SOURCE_DATE_EPOCH %q\n", sde)
+			return 2
+		}
+		date = time.Unix(secs, 0).UTC()
+	}
+
+	g := &uaBuilder{p: proj, root: root, name: *name, prefix: *prefix, symbol: *symbol,
+		types: map[*st.Type]string{}, aliases: map[string]string{}, folders: map[string]bool{}}
+	g.build()
+	set := g.nodeSet(*uri, *version, date.Format(time.RFC3339))
+
+	findings := append(syntaxFindings(proj), g.findings...)
+	sortFindings(findings)
+	writeFindings(os.Stderr, "text", "iecst opcua-nodeset", nil, findings)
+
+	os.Stdout.WriteString(xml.Header)
+	enc := xml.NewEncoder(os.Stdout)
+	enc.Indent("", "  ")
+	if err := enc.Encode(set); err != nil {
+		fmt.Fprintln(os.Stderr, "iecst opcua-nodeset:", err)
+		return 2
+	}
+	fmt.Println()
+	return 0
+}
+
+// ── NodeSet2 model ────────────────────────────────────────────────────────────
+
+type uaNodeSet struct {
+	XMLName       xml.Name     `xml:"UANodeSet"`
+	Xmlns         string       `xml:"xmlns,attr"`
+	LastModified  string       `xml:"LastModified,attr"`
+	NamespaceUris []string     `xml:"NamespaceUris>Uri"`
+	Models        []uaModel    `xml:"Models>Model"`
+	Aliases       []uaAlias    `xml:"Aliases>Alias"`
+	DataTypes     []uaDataType `xml:"UADataType"`
+	Objects       []uaObject   `xml:"UAObject"`
+	Variables     []uaVariable `xml:"UAVariable"`
+}
+
+type uaModel struct {
+	ModelUri        string    `xml:"ModelUri,attr"`
+	Version         string    `xml:"Version,attr"`
+	PublicationDate string    `xml:"PublicationDate,attr"`
+	Required        []uaModel `xml:"RequiredModel"`
+}
+
+type uaAlias struct {
+	Alias  string `xml:"Alias,attr"`
+	NodeId string `xml:",chardata"`
+}
+
+// uaNode holds what all node classes share.
+type uaNode struct {
+	NodeId       string  `xml:"NodeId,attr"`
+	BrowseName   string  `xml:"BrowseName,attr"`
+	SymbolicName string  `xml:"SymbolicName,attr,omitempty"`
+	ParentNodeId string  `xml:"ParentNodeId,attr,omitempty"`
+	DisplayName  string  `xml:"DisplayName"`
+	Description  string  `xml:"Description,omitempty"`
+	References   []uaRef `xml:"References>Reference"`
+}
+
+type uaRef struct {
+	ReferenceType string `xml:"ReferenceType,attr"`
+	IsForward     string `xml:"IsForward,attr,omitempty"` // "false" for inverse references
+	Target        string `xml:",chardata"`
+}
+
+type uaObject struct {
+	uaNode
+}
+
+type uaVariable struct {
+	uaNode
+	DataType        string `xml:"DataType,attr"`
+	ValueRank       string `xml:"ValueRank,attr,omitempty"`
+	ArrayDimensions string `xml:"ArrayDimensions,attr,omitempty"`
+	AccessLevel     string `xml:"AccessLevel,attr"`
+}
+
+type uaDataType struct {
+	uaNode
+	Definition *uaDefinition `xml:"Definition"`
+}
+
+type uaDefinition struct {
+	Name   string    `xml:"Name,attr"`
+	Fields []uaField `xml:"Field"`
+}
+
+type uaField struct {
+	Name            string `xml:"Name,attr"`
+	DataType        string `xml:"DataType,attr,omitempty"`
+	ValueRank       string `xml:"ValueRank,attr,omitempty"`
+	ArrayDimensions string `xml:"ArrayDimensions,attr,omitempty"`
+	Value           string `xml:"Value,attr,omitempty"`
+	Description     string `xml:"Description,omitempty"`
+}
+
+// uaStandard are the namespace 0 nodes the model refers to.
+var uaStandard = map[string]string{
+	"Boolean": "i=1", "SByte": "i=2", "Byte": "i=3", "Int16": "i=4", "UInt16": "i=5",
+	"Int32": "i=6", "UInt32": "i=7", "Int64": "i=8", "UInt64": "i=9", "Float": "i=10",
+	"Double": "i=11", "String": "i=12",
+	"Structure": "i=22", "Enumeration": "i=29",
+	"Organizes": "i=35", "HasEncoding": "i=38", "HasTypeDefinition": "i=40", "HasSubtype": "i=45",
+	"HasComponent":   "i=47",
+	"BaseObjectType": "i=58", "FolderType": "i=61", "BaseDataVariableType": "i=63",
+	"DataTypeEncodingType": "i=76", "ObjectsFolder": "i=85",
+}
+
+// ── Building ──────────────────────────────────────────────────────────────────
+
+type uaBuilder struct {
+	p      *st.Project
+	root   string
+	name   string
+	prefix string
+	symbol bool
+
+	dataTypes []uaDataType
+	objects   []uaObject
+	variables []uaVariable
+	types     map[*st.Type]string // DUT → NodeId, once emitted
+	aliases   map[string]string
+	folders   map[string]bool
+	findings  []finding
+}
+
+func (g *uaBuilder) ref(kind, target string, inverse bool) uaRef {
+	g.aliases[kind] = uaStandard[kind]
+	r := uaRef{ReferenceType: kind, Target: target}
+	if inverse {
+		r.IsForward = "false"
+	}
+	return r
+}
+
+// std returns the alias of a namespace 0 node and records it.
+func (g *uaBuilder) std(name string) string {
+	g.aliases[name] = uaStandard[name]
+	return name
+}
+
+func (g *uaBuilder) warn(sym *st.Symbol, format string, args ...any) {
+	f := finding{Rule: "type", Level: "warning", Line: sym.Ident.NamePos.Line, Column: sym.Ident.NamePos.Col, Message: fmt.Sprintf(format, args...)}
+	if sym.File != nil {
+		f.File = sym.File.Name
+	}
+	g.findings = append(g.findings, f)
+}
+
+// build adds the root object, one object per folder and GVL, and the
+// variables, in GVL name and declaration order.
+func (g *uaBuilder) build() {
+	g.objects = append(g.objects, uaObject{uaNode{
+		NodeId: "ns=1;s=" + g.name, BrowseName: "1:" + g.name, DisplayName: g.name,
+		References: []uaRef{g.ref("Organizes", g.std("ObjectsFolder"), true), g.ref("HasTypeDefinition", g.std("FolderType"), false)},
+	}})
+	gs := g.p.GlobalScope()
+	gvls := map[string]string{}
+	for _, sym := range g.p.Globals() {
+		if sym.File == nil || g.p.IsTestFile(sym.File) {
+			continue
+		}
+		access, ok := symbolAccess(sym.Decl, sym.Block, nil)
+		if g.symbol && !ok || strings.EqualFold(access, "none") {
+			continue
+		}
+		level := "3" // CurrentRead | CurrentWrite
+		switch {
+		case sym.IsConstant(), strings.EqualFold(access, "read"):
+			level = "1"
+		case strings.EqualFold(access, "write"):
+			level = "2"
+		}
+
+		t := gs.ResolveType(sym.Decl.Type)
+		dt, rank, dims, msg := g.dataType(t)
+		if msg != "" {
+			g.warn(sym, "%s.%s is not exported: %s", sym.GVL, sym.Name, msg)
+			continue
+		}
+		parent, ok := gvls[strings.ToUpper(sym.GVL)]
+		if !ok {
+			parent = g.gvlObject(sym)
+			gvls[strings.ToUpper(sym.GVL)] = parent
+		}
+		g.variables = append(g.variables, uaVariable{
+			uaNode: uaNode{
+				NodeId:       "ns=1;s=" + g.prefix + sym.GVL + "." + sym.Name,
+				BrowseName:   "1:" + sym.Name,
+				ParentNodeId: parent,
+				DisplayName:  sym.Name,
+				Description:  strings.Join(strings.Fields(sym.Decl.Comment), " "),
+				References: []uaRef{
+					g.ref("HasComponent", parent, true),
+					g.ref("HasTypeDefinition", g.std("BaseDataVariableType"), false),
+				},
+			},
+			DataType: dt, ValueRank: rank, ArrayDimensions: dims, AccessLevel: level,
+		})
+	}
+}
+
+// gvlObject adds the object of the GVL that declares sym, below the folder
+// objects of its source file, and returns its NodeId.
+func (g *uaBuilder) gvlObject(sym *st.Symbol) string {
+	rel, err := filepath.Rel(g.root, sym.File.Name)
+	if err != nil {
+		rel = sym.File.Name
+	}
+	dir := path.Dir(filepath.ToSlash(rel))
+	parent := "ns=1;s=" + g.name
+	if dir != "." {
+		parts := strings.Split(dir, "/")
+		for i, part := range parts {
+			id := "ns=1;s=" + g.name + "/" + strings.Join(parts[:i+1], "/")
+			if !g.folders[id] {
+				g.folders[id] = true
+				g.objects = append(g.objects, uaObject{uaNode{
+					NodeId: id, BrowseName: "1:" + part, ParentNodeId: parent, DisplayName: part,
+					References: []uaRef{g.ref("Organizes", parent, true), g.ref("HasTypeDefinition", g.std("FolderType"), false)},
+				}})
+			}
+			parent = id
+		}
+	}
+	id := strings.TrimPrefix(parent, "ns=1;s=") + "/" + sym.GVL
+	g.objects = append(g.objects, uaObject{uaNode{
+		NodeId: "ns=1;s=" + id, BrowseName: "1:" + sym.GVL, ParentNodeId: parent, DisplayName: sym.GVL,
+		References: []uaRef{g.ref("Organizes", parent, true), g.ref("HasTypeDefinition", g.std("BaseObjectType"), false)},
+	}})
+	return "ns=1;s=" + id
+}
+
+// dataType returns the DataType, ValueRank and ArrayDimensions of a value
+// of type t, adding DataType nodes for the STRUCT and enumeration types it
+// uses. msg says why t cannot be exported.
+func (g *uaBuilder) dataType(t *st.Type) (dt, rank, dims, msg string) {
+	if t.Class == st.ArrayClass {
+		var lens []string
+		for t.Class == st.ArrayClass {
+			for _, d := range t.Dims {
+				if !d.Known {
+					return "", "", "", "array bounds of " + t.Name + " are not constant"
+				}
+				lens = append(lens, strconv.FormatInt(d.Len(), 10))
+			}
+			t = t.Elem
+		}
+		dt, _, _, msg = g.dataType(t)
+		return dt, strconv.Itoa(len(lens)), strings.Join(lens, ","), msg
+	}
+	switch t.Class {
+	case st.StructClass, st.EnumClass:
+		return g.userType(t), "", "", ""
+	case st.BoolClass:
+		return g.std("Boolean"), "", "", ""
+	case st.StringClass:
+		return g.std("String"), "", "", ""
+	case st.RealClass:
+		if t.Bits == 64 {
+			return g.std("Double"), "", "", ""
+		}
+		return g.std("Float"), "", "", ""
+	case st.IntClass, st.BitsClass, st.CharClass, st.TimeClass, st.DateClass:
+		names := map[int]string{8: "Byte", 16: "UInt16", 32: "UInt32", 64: "UInt64"}
+		if t.Class == st.IntClass && t.Signed {
+			names = map[int]string{8: "SByte", 16: "Int16", 32: "Int32", 64: "Int64"}
+		}
+		if n, ok := names[t.Bits]; ok {
+			return g.std(n), "", "", ""
+		}
+	}
+	return "", "", "", t.Name + " has no OPC UA data type"
+}
+
+// userType returns the NodeId of the DataType node of a STRUCT or
+// enumeration type, adding it and the types it depends on first.
+func (g *uaBuilder) userType(t *st.Type) string {
+	if id, ok := g.types[t]; ok {
+		return id
+	}
+	id := "ns=1;s=|type|" + t.Name
+	g.types[t] = id
+	n := uaDataType{uaNode: uaNode{NodeId: id, BrowseName: "1:" + t.Name, DisplayName: t.Name}}
+	if t.Decl != nil {
+		n.Description = strings.Join(strings.Fields(t.Decl.Comment), " ")
+	}
+	def := &uaDefinition{Name: "1:" + t.Name}
+	if t.Class == st.EnumClass {
+		n.References = []uaRef{g.ref("HasSubtype", g.std("Enumeration"), true)}
+		comments := map[string]string{}
+		if t.Decl != nil {
+			if et, ok := t.Decl.Type.(*st.EnumType); ok {
+				for _, v := range et.Values {
+					comments[v.Name.Name] = strings.Join(strings.Fields(v.Comment), " ")
+				}
+			}
+		}
+		for _, m := range t.Members {
+			def.Fields = append(def.Fields, uaField{Name: m.Name, Value: strconv.FormatInt(m.Value, 10), Description: comments[m.Name]})
+		}
+	} else {
+		super := g.std("Structure")
+		if t.Base != nil {
+			super = g.userType(t.Base)
+		}
+		n.References = []uaRef{g.ref("HasSubtype", super, true)}
+		var chain []*st.Type
+		for s := t; s != nil; s = s.Base {
+			chain = append([]*st.Type{s}, chain...)
+		}
+		for _, s := range chain {
+			for _, f := range s.Fields {
+				dt, rank, dims, msg := g.dataType(f.Type)
+				if msg != "" {
+					g.findings = append(g.findings, g.fieldFinding(f, "member %s.%s is left out: %s", t.Name, f.Name, msg))
+					continue
+				}
+				field := uaField{Name: f.Name, DataType: dt, ValueRank: rank, ArrayDimensions: dims}
+				if f.Decl != nil {
+					field.Description = strings.Join(strings.Fields(f.Decl.Comment), " ")
+				}
+				def.Fields = append(def.Fields, field)
+			}
+		}
+		enc := id + "/DefaultBinary"
+		n.References = append(n.References, g.ref("HasEncoding", enc, false))
+		g.objects = append(g.objects, uaObject{uaNode{
+			NodeId: enc, BrowseName: "Default Binary", SymbolicName: "DefaultBinary", DisplayName: "Default Binary",
+			References: []uaRef{g.ref("HasEncoding", id, true), g.ref("HasTypeDefinition", g.std("DataTypeEncodingType"), false)},
+		}})
+	}
+	n.Definition = def
+	g.dataTypes = append(g.dataTypes, n)
+	return id
+}
+
+func (g *uaBuilder) fieldFinding(f *st.Field, format string, args ...any) finding {
+	out := finding{Rule: "type", Level: "warning", Message: fmt.Sprintf(format, args...)}
+	if f.Ident != nil {
+		out.Line, out.Column = f.Ident.NamePos.Line, f.Ident.NamePos.Col
+		if file := g.p.FileOf(f.Ident); file != nil {
+			out.File = file.Name
+		}
+	}
+	return out
+}
+
+// nodeSet assembles the document.
+func (g *uaBuilder) nodeSet(uri, version, date string) *uaNodeSet {
+	set := &uaNodeSet{
+		Xmlns:         "http://opcfoundation.org/UA/2011/03/UANodeSet.xsd",
+		LastModified:  date,
+		NamespaceUris: []string{uri},
+		Models: []uaModel{{
+			ModelUri: uri, Version: version, PublicationDate: date,
+			Required: []uaModel{{ModelUri: "http://opcfoundation.org/UA/", Version: "1.04", PublicationDate: "2019-05-01T00:00:00Z"}},
+		}},
+		DataTypes: g.dataTypes,
+		Objects:   g.objects,
+		Variables: g.variables,
+	}
+	for alias, id := range g.aliases {
+		set.Aliases = append(set.Aliases, uaAlias{alias, id})
+	}
+	sort.Slice(set.Aliases, func(i, j int) bool {
+		a, _ := strconv.Atoi(strings.TrimPrefix(set.Aliases[i].NodeId, "i="))
+		b, _ := strconv.Atoi(strings.TrimPrefix(set.Aliases[j].NodeId, "i="))
+		return a < b
+	})
+	return set
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ── Project model ─────────────────────────────────────────────────────────────
+
+// stObject is one .st source file of a project tree, split the same way the
+// exporters split it: declaration (header and VAR blocks) and body.
+type stObject struct {
+	path string // slash-separated path relative to the project root, without .st
+	name string
+	kind string // PROGRAM, FUNCTION_BLOCK, FUNCTION, GVL or DUT
+	src  string // file content with LF line endings, without trailing newlines
+	decl string
+	body string
+	meta map[string]json.RawMessage // contents of the .meta.json sidecar, if any
+}
+
+// folder returns the slash-separated folder that contains the object.
+func (o *stObject) folder() string {
+	if i := strings.LastIndex(o.path, "/"); i >= 0 {
+		return o.path[:i]
+	}
+	return ""
+}
+
+// guid returns the object GUID recorded by exp2st35, or "".
+func (o *stObject) guid() string {
+	var g string
+	if raw, ok := o.meta["guid"]; ok {
+		_ = json.Unmarshal(raw, &g)
+	}
+	return g
+}
+
+// project is a .st source tree as written by the importers.
+type project struct {
+	root    string
+	folders map[string]bool // slash-separated folder paths
+	objects map[string]*stObject
+}
+
+// sortedPaths returns the object paths in lexical order.
+func (p *project) sortedPaths() []string {
+	paths := make([]string, 0, len(p.objects))
+	for path := range p.objects {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// sortedFolders returns the folder paths in lexical order.
+func (p *project) sortedFolders() []string {
+	folders := make([]string, 0, len(p.folders))
+	for f := range p.folders {
+		folders = append(folders, f)
+	}
+	sort.Strings(folders)
+	return folders
+}
+
+// loadProject reads every .st file below root into the project model.
+func loadProject(root string) (*project, error) {
+	p := &project{root: root, folders: map[string]bool{}, objects: map[string]*stObject{}}
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, path)
+		rel = filepath.ToSlash(rel)
+		if info.IsDir() {
+			if rel != "." {
+				p.folders[rel] = true
+			}
+			return nil
+		}
+		if strings.ToLower(filepath.Ext(path)) != ".st" {
+			return nil
+		}
+		obj, err := loadObject(path)
+		if err != nil {
+			return err
+		}
+		obj.path = strings.TrimSuffix(rel, filepath.Ext(rel))
+		p.objects[obj.path] = obj
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func loadObject(path string) (*stObject, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	src := strings.ReplaceAll(strings.ReplaceAll(string(raw), "\r\n", "\n"), "\r", "\n")
+	src = strings.TrimPrefix(src, "\uFEFF")
+	lines := strings.Split(src, "\n")
+
+	obj := &stObject{
+		name: strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)),
+		kind: detectKind(firstCodeLine(lines)),
+		src:  strings.TrimRight(src, "\n"),
+	}
+	switch obj.kind {
+	case "CONFIGURATION":
+		obj.kind = "GVL"
+		obj.decl = extractGVLFromConfiguration(lines)
+	case "PROGRAM", "FUNCTION_BLOCK", "FUNCTION":
+		obj.decl, obj.body = splitDeclImpl(src)
+	default:
+		obj.decl = src
+	}
+	obj.decl = normalizeText(obj.decl)
+	obj.body = normalizeText(obj.body)
+
+	metaRaw, err := os.ReadFile(strings.TrimSuffix(path, filepath.Ext(path)) + ".meta.json")
+	if err == nil {
+		if err := json.Unmarshal(metaRaw, &obj.meta); err != nil {
+			return nil, err
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// normalizeText removes trailing whitespace from every line and trailing blank
+// lines, so that comparisons ignore differences no IDE would preserve.
+func normalizeText(s string) string {
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimRight(l, " \t")
+	}
+	return strings.TrimRight(strings.Join(lines, "\n"), "\n")
+}
+
+// ── Source parsing ────────────────────────────────────────────────────────────
+
+func detectKind(line string) string {
+	u := strings.ToUpper(strings.TrimSpace(line))
+	switch {
+	case strings.HasPrefix(u, "PROGRAM ") || u == "PROGRAM":
+		return "PROGRAM"
+	case strings.HasPrefix(u, "FUNCTION_BLOCK ") || u == "FUNCTION_BLOCK":
+		return "FUNCTION_BLOCK"
+	case strings.HasPrefix(u, "FUNCTION ") || u == "FUNCTION":
+		return "FUNCTION"
+	case strings.HasPrefix(u, "VAR_GLOBAL"):
+		return "GVL"
+	case strings.HasPrefix(u, "TYPE ") || u == "TYPE":
+		return "DUT"
+	case strings.HasPrefix(u, "CONFIGURATION ") || u == "CONFIGURATION":
+		return "CONFIGURATION"
+	default:
+		return "PROGRAM"
+	}
+}
+
+func firstCodeLine(lines []string) string {
+	for _, l := range lines {
+		t := strings.TrimSpace(l)
+		if t == "" || strings.HasPrefix(t, "//") || strings.HasPrefix(t, "(*") || strings.HasPrefix(t, "{") {
+			continue
+		}
+		return t
+	}
+	return ""
+}
+
+func extractGVLFromConfiguration(lines []string) string {
+	inVarGlobal := false
+	var out []string
+	for _, l := range lines {
+		u := strings.ToUpper(strings.TrimSpace(l))
+		if strings.HasPrefix(u, "VAR_GLOBAL") {
+			inVarGlobal = true
+		}
+		if inVarGlobal {
+			trimmed := strings.TrimPrefix(l, "\t")
+			if trimmed == l && strings.HasPrefix(l, "    ") {
+				trimmed = l[4:]
+			}
+			out = append(out, trimmed)
+			if strings.HasPrefix(u, "END_VAR") {
+				inVarGlobal = false
+			}
+		}
+	}
+	return strings.Join(out, "\n")
+}
+
+func splitDeclImpl(src string) (decl, impl string) {
+	lines := strings.Split(src, "\n")
+	lastEndVar := -1
+	for i, l := range lines {
+		if strings.ToUpper(strings.TrimSpace(l)) == "END_VAR" {
+			lastEndVar = i
+		}
+	}
+	if lastEndVar < 0 {
+		return src, ""
+	}
+	declLines := lines[:lastEndVar+1]
+	implLines := lines[lastEndVar+1:]
+	for len(implLines) > 0 {
+		u := strings.ToUpper(strings.TrimSpace(implLines[len(implLines)-1]))
+		if u == "END_PROGRAM" || u == "END_FUNCTION_BLOCK" || u == "END_FUNCTION" || u == "" {
+			implLines = implLines[:len(implLines)-1]
+		} else {
+			break
+		}
+	}
+	for len(implLines) > 0 && strings.TrimSpace(implLines[0]) == "" {
+		implLines = implLines[1:]
+	}
+	return strings.Join(declLines, "\n"), strings.Join(implLines, "\n")
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ── roundtrip ─────────────────────────────────────────────────────────────────
+
+// runRoundtrip imports each export file, exports the resulting .st tree in the
+// same format and imports that again. The two imported trees must agree in
+// folders, objects, declarations and bodies.
+//
+// Exit status is 0 when every file survives the round trip, 1 when any file
+// changed and 2 when a file could not be converted at all.
+func runRoundtrip(args []string) int {
+	fs := flag.NewFlagSet("roundtrip", flag.ExitOnError)
+	formatName := fs.String("format", "", "format of the input files (codesys23, codesys35, plcopen); detected when empty")
+	keep := fs.String("keep", "", "keep the intermediate trees and export files in this directory")
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, "iecst roundtrip — verify that export files survive import → export → import\n\n")
+		fmt.Fprintln(os.Stderr, "Usage:")
+		fmt.Fprint(os.Stderr, "  iecst roundtrip [-format <name>] [-keep <dir>] <file>...\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	status := 0
+	for i, in := range fs.Args() {
+		work := ""
+		if *keep != "" {
+			work = filepath.Join(*keep, fmt.Sprintf("%d_%s", i+1, filepath.Base(in)))
+			if err := os.MkdirAll(work, 0755); err != nil {
+				fmt.Fprintln(os.Stderr, "cannot create work directory:", err)
+				return 2
+			}
+		} else {
+			tmp, err := os.MkdirTemp("", "iecst-roundtrip-")
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "cannot create temporary directory:", err)
+				return 2
+			}
+			defer os.RemoveAll(tmp)
+			work = tmp
+		}
+
+		changes, err := roundtripFile(in, *formatName, work)
+		switch {
+		case err != nil:
+			fmt.Printf("ERROR  %s\n", in)
+			fmt.Fprintf(os.Stderr, "  %v\n", err)
+			status = 2
+		case len(changes) > 0:
+			fmt.Printf("FAIL   %s  (%d change(s))\n", in, len(changes))
+			printChanges(os.Stdout, changes)
+			if status == 0 {
+				status = 1
+			}
+		default:
+			fmt.Printf("ok     %s\n", in)
+		}
+	}
+	return status
+}
+
+// roundtripFile runs one import → export → import cycle inside work and
+// returns the differences between the first and the second import.
+func roundtripFile(in, formatName, work string) ([]change, error) {
+	format, err := resolveFormat(in, formatName)
+	if err != nil {
+		return nil, err
+	}
+
+	first := filepath.Join(work, "first")
+	second := filepath.Join(work, "second")
+	if err := importExport(format, in, first); err != nil {
+		return nil, fmt.Errorf("import: %w", err)
+	}
+	exported, err := exportProject(format, first, filepath.Join(work, "export"), "roundtrip", true)
+	if err != nil {
+		return nil, fmt.Errorf("export: %w", err)
+	}
+	if err := importExport(format, exported, second); err != nil {
+		return nil, fmt.Errorf("re-import: %w", err)
+	}
+
+	a, err := loadProject(first)
+	if err != nil {
+		return nil, err
+	}
+	b, err := loadProject(second)
+	if err != nil {
+		return nil, err
+	}
+	if len(a.objects) == 0 {
+		return nil, fmt.Errorf("no objects imported from %s", in)
+	}
+	return compareProjects(a, b), nil
+}
@@ -0,0 +1,568 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/damischa1/iec-st-tools/interp"
+	"github.com/damischa1/iec-st-tools/st"
+)
+
+// ── sim ───────────────────────────────────────────────────────────────────────
+
+// runSim runs a .st tree as a soft PLC. Programs are scheduled by the tasks
+// of the RESOURCE blocks in CONFIGURATION files; without them every PROGRAM
+// that no other POU calls runs in one default task. Commands read from a
+// script, stdin or a socket drive the process image and the clock.
+func runSim(args []string) int {
+	flags := flag.NewFlagSet("sim", flag.ExitOnError)
+	listen := flags.String("listen", "", "serve commands on a Unix socket path or host:port instead of reading a script")
+	script := flags.String("script", "", "read commands from this file instead of stdin")
+	cycle := flags.Duration("cycle", 10*time.Millisecond, "interval of the default task and of tasks without INTERVAL")
+	realtime := flags.Bool("realtime", false, "let simulated time follow the wall clock")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, "iecst sim — run a .st project as a soft PLC\n\n")
+		fmt.Fprintln(os.Stderr, "Usage:")
+		fmt.Fprint(os.Stderr, "  iecst sim [flags] [file or directory ...] < script\n")
+		fmt.Fprint(os.Stderr, "  iecst sim -listen /tmp/plc.sock [flags] [file or directory ...]\n\n")
+		flags.PrintDefaults()
+		fmt.Fprint(os.Stderr, "\nCommands:\n"+simHelp)
+	}
+	flags.Parse(args)
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	proj, err := st.LoadProject(paths...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "iecst sim:", err)
+		return 2
+	}
+	if findings := append(syntaxFindings(proj), checkFindings(proj)...); len(findings) > 0 {
+		sortFindings(findings)
+		writeFindings(os.Stderr, "text", "iecst sim", nil, findings)
+		fmt.Fprintln(os.Stderr, "iecst sim: sources have errors, not started")
+		return 2
+	}
+	s, err := newSimulator(proj, *cycle)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "iecst sim:", err)
+		return 2
+	}
+	s.realtime = *realtime
+	if s.realtime {
+		go s.clock()
+	}
+	if *listen != "" {
+		return s.serve(*listen)
+	}
+
+	in, name := io.Reader(os.Stdin), "stdin"
+	if *script != "" {
+		f, err := os.Open(*script)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "iecst sim:", err)
+			return 2
+		}
+		defer f.Close()
+		in, name = f, *script
+	}
+	failed := s.session(in, os.Stdout, name, false)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped != nil {
+		fmt.Fprintln(os.Stderr, "iecst sim: PLC stopped:", s.stopped)
+	}
+	if failed > 0 || s.stopped != nil {
+		return 1
+	}
+	return 0
+}
+
+const simHelp = `  get PATH ...       print variables: G_Count, GVL.x, PLC_PRG.state, %QX0.0
+  set PATH VALUE     assign an ST expression: TRUE, 42, T#1s, E_Mode.Auto
+  expect PATH VALUE  fail unless the variable equals the value
+  run DURATION       let time pass, running the tasks that fall due: 100ms, T#1s
+  step [N]           run the next N task releases
+  io                 print the process image (direct addresses)
+  tasks              print the tasks with their programs and cycle counts
+  time               print the simulated time
+  quit               end the session
+`
+
+// ── Simulator ─────────────────────────────────────────────────────────────────
+
+// simulator is a machine with its task schedule. mu serialises the socket
+// sessions and the real-time clock.
+type simulator struct {
+	mu        sync.Mutex
+	m         *interp.Machine
+	tasks     []*simTask                  // by priority, then declaration order
+	instances map[string]*interp.Instance // configured program instances by upper-case name
+	realtime  bool
+	stopped   error // run-time error that stopped the PLC
+}
+
+// simTask is a TASK: cyclic with an interval, or triggered by the rising
+// edge of a SINGLE variable.
+type simTask struct {
+	name     string
+	interval time.Duration
+	priority int64
+	single   string // trigger expression of an event task
+	prev     bool   // last value of single
+	next     time.Duration
+	cycles   int64
+	programs []simProgram
+}
+
+type simProgram struct {
+	name string
+	inst *interp.Instance
+}
+
+func (t *simTask) cyclic() bool { return t.single == "" }
+
+// newSimulator initialises the globals and program instances of p and
+// builds the task schedule.
+func newSimulator(p *st.Project, cycle time.Duration) (*simulator, error) {
+	m, err := interp.New(p)
+	if err != nil {
+		return nil, err
+	}
+	s := &simulator{m: m, instances: map[string]*interp.Instance{}}
+	byName := map[string]*simTask{}
+	used := map[*st.POU]bool{}
+	var unassigned []simProgram
+	configured := false
+	for _, f := range p.Files {
+		for _, d := range f.Decls {
+			c, ok := d.(*st.Configuration)
+			if !ok {
+				continue
+			}
+			for _, r := range c.Resources {
+				for _, td := range r.Tasks {
+					t, err := s.task(td, cycle)
+					if err != nil {
+						return nil, err
+					}
+					byName[strings.ToUpper(t.name)] = t
+					s.tasks = append(s.tasks, t)
+				}
+				for _, pc := range r.Programs {
+					configured = true
+					d := p.POU(pc.Type.Name)
+					if d == nil || d.Kind != st.Program {
+						return nil, fmt.Errorf("%s: no PROGRAM %s", pc.Name.Name, pc.Type.Name)
+					}
+					// the first instance of a program type is the one other
+					// code sees as PLC_PRG.x; further instances are separate
+					newInst := m.Program
+					if used[d] {
+						newInst = m.NewInstance
+					}
+					used[d] = true
+					inst, err := newInst(d.Name.Name)
+					if err != nil {
+						return nil, err
+					}
+					s.instances[strings.ToUpper(pc.Name.Name)] = inst
+					sp := simProgram{name: pc.Name.Name, inst: inst}
+					if pc.Task == nil {
+						unassigned = append(unassigned, sp)
+						continue
+					}
+					t := byName[strings.ToUpper(pc.Task.Name)]
+					if t == nil {
+						return nil, fmt.Errorf("%s: no TASK %s", pc.Name.Name, pc.Task.Name)
+					}
+					t.programs = append(t.programs, sp)
+				}
+			}
+		}
+	}
+	if !configured {
+		called := map[*st.POU]bool{}
+		for _, r := range p.References() {
+			if r.Call && r.Symbol != nil && r.Symbol.Kind == st.POUSymbol {
+				called[r.Symbol.POU] = true
+			}
+		}
+		for _, d := range p.POUs() {
+			if d.Kind != st.Program || called[d] {
+				continue
+			}
+			inst, err := m.Program(d.Name.Name)
+			if err != nil {
+				return nil, err
+			}
+			unassigned = append(unassigned, simProgram{name: d.Name.Name, inst: inst})
+		}
+	}
+	if len(unassigned) > 0 {
+		s.tasks = append(s.tasks, &simTask{name: "Default", interval: cycle, priority: 31, programs: unassigned})
+	}
+	var tasks []*simTask
+	for _, t := range s.tasks {
+		if len(t.programs) == 0 {
+			fmt.Fprintf(os.Stderr, "WARNING: task %s has no programs\n", t.name)
+			continue
+		}
+		tasks = append(tasks, t)
+	}
+	if len(tasks) == 0 {
+		return nil, errors.New("no programs to run")
+	}
+	sort.SliceStable(tasks, func(i, j int) bool { return tasks[i].priority < tasks[j].priority })
+	s.tasks = tasks
+	return s, nil
+}
+
+// task evaluates the parameters of a TASK declaration.
+func (s *simulator) task(td *st.TaskDecl, cycle time.Duration) (*simTask, error) {
+	t := &simTask{name: td.Name.Name}
+	for _, a := range td.Params {
+		if a.Name == nil || a.Value == nil {
+			continue
+		}
+		switch strings.ToUpper(a.Name.Name) {
+		case "INTERVAL":
+			x, err := s.m.Eval(st.ExprString(a.Value))
+			d, ok := x.(time.Duration)
+			if err != nil || !ok || d <= 0 {
+				return nil, fmt.Errorf("task %s: INTERVAL must be a positive TIME", t.name)
+			}
+			t.interval = d
+		case "PRIORITY":
+			x, err := s.m.Eval(st.ExprString(a.Value))
+			n, ok := x.(int64)
+			if err != nil || !ok {
+				return nil, fmt.Errorf("task %s: PRIORITY must be an integer", t.name)
+			}
+			t.priority = n
+		case "SINGLE":
+			t.single = st.ExprString(a.Value)
+		default:
+			fmt.Fprintf(os.Stderr, "WARNING: task %s: parameter %s ignored\n", t.name, a.Name.Name)
+		}
+	}
+	if t.interval == 0 && t.single == "" {
+		t.interval = cycle
+	}
+	return t, nil
+}
+
+// ── Scheduling ────────────────────────────────────────────────────────────────
+
+// nextRelease returns the earliest release time of the cyclic tasks.
+func (s *simulator) nextRelease() time.Duration {
+	next := time.Duration(-1)
+	for _, t := range s.tasks {
+		if t.cyclic() && (next < 0 || t.next < next) {
+			next = t.next
+		}
+	}
+	return next
+}
+
+// advance runs every task release before to, then sets the clock to to.
+func (s *simulator) advance(to time.Duration) error {
+	for s.stopped == nil {
+		next := s.nextRelease()
+		if next < 0 || next >= to {
+			break
+		}
+		s.release(next)
+	}
+	if s.stopped != nil {
+		return s.stopped
+	}
+	if to > s.m.Now {
+		s.m.Advance(to - s.m.Now)
+	}
+	return nil
+}
+
+// release sets the clock to at and runs, in priority order, the cyclic tasks
+// due then and the event tasks whose trigger has risen.
+func (s *simulator) release(at time.Duration) {
+	if at > s.m.Now {
+		s.m.Advance(at - s.m.Now)
+	}
+	for _, t := range s.tasks {
+		due := t.cyclic() && t.next <= at
+		if !t.cyclic() {
+			x, err := s.m.Eval(t.single)
+			if err != nil {
+				s.stopped = fmt.Errorf("task %s: SINGLE: %v", t.name, err)
+				return
+			}
+			on, _ := x.(bool)
+			due = on && !t.prev
+			t.prev = on
+		}
+		if !due {
+			continue
+		}
+		for _, p := range t.programs {
+			if _, err := p.inst.Call(nil); err != nil {
+				s.stopped = fmt.Errorf("task %s, program %s: %v", t.name, p.name, err)
+				return
+			}
+		}
+		t.cycles++
+		if t.cyclic() {
+			t.next += t.interval
+		}
+	}
+}
+
+// clock lets simulated time follow the wall clock.
+func (s *simulator) clock() {
+	start := time.Now()
+	s.mu.Lock()
+	base := s.m.Now
+	s.mu.Unlock()
+	for {
+		s.mu.Lock()
+		now := base + time.Since(start)
+		if s.advance(now) != nil {
+			s.mu.Unlock()
+			return
+		}
+		wait := 10 * time.Millisecond
+		if next := s.nextRelease(); next >= 0 && next-now < wait {
+			wait = next - now
+		}
+		s.mu.Unlock()
+		time.Sleep(max(wait, 100*time.Microsecond))
+	}
+}
+
+// ── Commands ──────────────────────────────────────────────────────────────────
+
+var errQuit = errors.New("quit")
+
+// session executes the commands read from r and returns the number that
+// failed. With reply set, as on a socket, every command is answered by its
+// output followed by "ok" or "error: …"; otherwise errors go to stderr.
+func (s *simulator) session(r io.Reader, w io.Writer, name string, reply bool) int {
+	failed := 0
+	sc := bufio.NewScanner(r)
+	line := 0
+	for sc.Scan() {
+		line++
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") || strings.HasPrefix(text, "//") {
+			continue
+		}
+		err := s.exec(text, w)
+		if err == errQuit {
+			break
+		}
+		switch {
+		case err != nil && reply:
+			fmt.Fprintf(w, "error: %v\n", err)
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "%s:%d: %v\n", name, line, err)
+		case reply:
+			fmt.Fprintln(w, "ok")
+		}
+		if err != nil {
+			failed++
+		}
+	}
+	return failed
+}
+
+// exec runs one command line.
+func (s *simulator) exec(line string, w io.Writer) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cmd, rest := cutWord(line)
+	switch strings.ToLower(cmd) {
+	case "get":
+		if rest == "" {
+			return errors.New("usage: get PATH ...")
+		}
+		for _, path := range strings.Fields(rest) {
+			x, err := s.get(path)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "%s = %s\n", path, stValue(x))
+		}
+	case "set", "expect":
+		path, expr := cutWord(rest)
+		if expr == "" {
+			return fmt.Errorf("usage: %s PATH VALUE", strings.ToLower(cmd))
+		}
+		want, err := s.m.Eval(expr)
+		if err != nil {
+			return err
+		}
+		if strings.EqualFold(cmd, "set") {
+			return s.set(path, want)
+		}
+		got, err := s.get(path)
+		if err != nil {
+			return err
+		}
+		if !equalValues(want, got) {
+			return fmt.Errorf("expect %s: expected %s, got %s", path, stValue(want), stValue(got))
+		}
+	case "run":
+		d, ok := parseSimDuration(rest)
+		if !ok {
+			return errors.New("usage: run DURATION (100ms, T#1s)")
+		}
+		if s.realtime {
+			s.mu.Unlock()
+			time.Sleep(d)
+			s.mu.Lock()
+			return s.stopped
+		}
+		return s.advance(s.m.Now + d)
+	case "step":
+		if s.realtime {
+			return errors.New("step is not available with -realtime")
+		}
+		n := 1
+		if rest != "" {
+			var err error
+			if n, err = strconv.Atoi(rest); err != nil || n < 1 {
+				return errors.New("usage: step [N]")
+			}
+		}
+		if s.nextRelease() < 0 {
+			return errors.New("no cyclic task to step")
+		}
+		for ; n > 0 && s.stopped == nil; n-- {
+			s.release(s.nextRelease())
+		}
+		return s.stopped
+	case "io":
+		for _, addr := range s.m.Addresses() {
+			x, err := s.m.Get(addr)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "%s = %s\n", addr, stValue(x))
+		}
+	case "tasks":
+		for _, t := range s.tasks {
+			names := make([]string, len(t.programs))
+			for i, p := range t.programs {
+				names[i] = p.name
+			}
+			trigger := "interval=" + stValue(t.interval)
+			if !t.cyclic() {
+				trigger = "single=" + t.single
+			}
+			fmt.Fprintf(w, "%s %s priority=%d cycles=%d programs=%s\n", t.name, trigger, t.priority, t.cycles, strings.Join(names, ","))
+		}
+	case "time":
+		fmt.Fprintln(w, stValue(s.m.Now))
+	case "help":
+		fmt.Fprint(w, simHelp)
+	case "quit", "exit":
+		return errQuit
+	default:
+		return fmt.Errorf("unknown command %q (try help)", cmd)
+	}
+	return nil
+}
+
+// get reads a variable; paths starting with a configured program instance
+// name address that instance.
+func (s *simulator) get(path string) (any, error) {
+	name, rest, _ := strings.Cut(path, ".")
+	if inst := s.instances[strings.ToUpper(name)]; inst != nil {
+		return inst.Get(rest)
+	}
+	return s.m.Get(path)
+}
+
+func (s *simulator) set(path string, x any) error {
+	name, rest, _ := strings.Cut(path, ".")
+	if inst := s.instances[strings.ToUpper(name)]; inst != nil && rest != "" {
+		return inst.Set(rest, x)
+	}
+	return s.m.Set(path, x)
+}
+
+// cutWord splits the first blank-separated word off s.
+func cutWord(s string) (word, rest string) {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexAny(s, " \t"); i >= 0 {
+		return s[:i], strings.TrimSpace(s[i+1:])
+	}
+	return s, ""
+}
+
+// parseSimDuration accepts 100ms, 1.5s or a TIME literal such as T#1s.
+func parseSimDuration(s string) (time.Duration, bool) {
+	if i := strings.IndexByte(s, '#'); i >= 0 {
+		switch strings.ToUpper(s[:i]) {
+		case "T", "TIME", "LT", "LTIME":
+			s = s[i+1:]
+		}
+	}
+	d, ok := st.ParseDuration(s)
+	return d, ok && d > 0
+}
+
+// ── Socket server ─────────────────────────────────────────────────────────────
+
+// serve accepts connections on a Unix socket, or on TCP when addr has a
+// port, and runs a session per connection until interrupted.
+func (s *simulator) serve(addr string) int {
+	network := "unix"
+	if strings.Contains(addr, ":") {
+		network = "tcp"
+	} else {
+		os.Remove(addr)
+	}
+	ln, err := net.Listen(network, addr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "iecst sim:", err)
+		return 2
+	}
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	go func() {
+		<-sig
+		ln.Close()
+	}()
+	fmt.Fprintf(os.Stderr, "iecst sim: listening on %s %s\n", network, addr)
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			break
+		}
+		go func() {
+			defer conn.Close()
+			s.session(conn, conn, conn.RemoteAddr().String(), true)
+		}()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped != nil {
+		fmt.Fprintln(os.Stderr, "iecst sim: PLC stopped:", s.stopped)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"bufio"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/damischa1/iec-st-tools/st"
+)
+
+// ── symbols ───────────────────────────────────────────────────────────────────
+
+// runSymbols writes the symbol set a CoDeSys project exports for the global
+// variables and PROGRAM variables of a source tree: a symbol configuration
+// XML as CoDeSys V3 writes it next to the boot application, or a listing in
+// the style of a CoDeSys 2.3 .SYM file. {attribute 'symbol'} on a variable,
+// its VAR block or its PROGRAM sets the access ('read', 'write', 'readwrite'
+// or 'none'); with -symbol only variables that carry it are exported.
+// STRUCT types are listed with the byte offsets of their members, following
+// the layout typeLayout computes.
+func runSymbols(args []string) int {
+	flags := flag.NewFlagSet("symbols", flag.ExitOnError)
+	format := flags.String("format", "xml", "output format: xml (CoDeSys V3 symbol configuration) or sym (CoDeSys 2.3 style listing)")
+	symbol := flags.Bool("symbol", false, "export only variables with {attribute 'symbol'} on them, their VAR block or their PROGRAM")
+	project := flags.String("project", "", "project name in the XML header (default the name of the source directory)")
+	device := flags.String("device", "Device", "device name in the XML header")
+	app := flags.String("app", "Application", "application name, the root of the symbol paths in the XML")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, "iecst symbols — symbol configuration of global and PROGRAM variables\n\n")
+		fmt.Fprintln(os.Stderr, "Usage:")
+		fmt.Fprint(os.Stderr, "  iecst symbols [-format xml|sym] [-symbol] [-project NAME] [-device NAME] [-app NAME] [source directory] > symbols.xml\n\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() > 1 || *format != "xml" && *format != "sym" {
+		flags.Usage()
+		return 2
+	}
+	root := "."
+	if flags.NArg() == 1 {
+		root = flags.Arg(0)
+	}
+	proj, err := st.LoadProject(root)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "iecst symbols:", err)
+		return 2
+	}
+	if *project == "" {
+		abs, _ := filepath.Abs(root)
+		*project = filepath.Base(abs)
+	}
+
+	b := &symBuilder{p: proj, symbol: *symbol, types: map[string]bool{}}
+	b.collect()
+	findings := append(syntaxFindings(proj), b.findings...)
+	sortFindings(findings)
+	writeFindings(os.Stderr, "text", "iecst symbols", nil, findings)
+
+	w := bufio.NewWriter(os.Stdout)
+	if *format == "sym" {
+		b.writeSym(w, *project)
+	} else {
+		w.WriteString(xml.Header)
+		enc := xml.NewEncoder(w)
+		enc.Indent("", "  ")
+		if err := enc.Encode(b.config(*project, *device, *app)); err != nil {
+			fmt.Fprintln(os.Stderr, "iecst symbols:", err)
+			return 2
+		}
+		fmt.Fprintln(w)
+	}
+	if err := w.Flush(); err != nil {
+		fmt.Fprintln(os.Stderr, "iecst symbols:", err)
+		return 2
+	}
+	return 0
+}
+
+// symbolAccess returns the value of the {attribute 'symbol'} that applies
+// to a variable: its own, else its VAR block's, else its POU's. pou may be
+// nil for global variables. ok is false when none of them carries it.
+func symbolAccess(decl *st.VarDecl, block *st.VarBlock, pou *st.POU) (access string, ok bool) {
+	if access, ok = decl.Attribute("symbol"); ok {
+		return access, true
+	}
+	if block != nil {
+		if access, ok = block.Attribute("symbol"); ok {
+			return access, true
+		}
+	}
+	if pou != nil {
+		return pou.Attribute("symbol")
+	}
+	return "", false
+}
+
+// ── Collection ────────────────────────────────────────────────────────────────
+
+// symGroup is a GVL or PROGRAM and its exported variables.
+type symGroup struct {
+	name   string
+	global bool
+	vars   []symVar
+}
+
+type symVar struct {
+	name    string
+	t       *st.Type
+	access  string // Read, Write or ReadWrite
+	comment string
+}
+
+type symBuilder struct {
+	p      *st.Project
+	symbol bool
+
+	groups   []*symGroup
+	typeList []symType
+	types    map[string]bool // type names already in typeList
+	findings []finding
+}
+
+// collect gathers the exported variables of the GVLs and PROGRAMs, in
+// declaration order within a group and by name across groups. PROGRAMs
+// export VAR, VAR_INPUT and VAR_OUTPUT; unit tests are left out.
+func (b *symBuilder) collect() {
+	byName := map[string]*symGroup{}
+	group := func(name string, global bool) *symGroup {
+		g := byName[strings.ToUpper(name)]
+		if g == nil {
+			g = &symGroup{name: name, global: global}
+			byName[strings.ToUpper(name)] = g
+			b.groups = append(b.groups, g)
+		}
+		return g
+	}
+	gs := b.p.GlobalScope()
+	for _, sym := range b.p.Globals() {
+		if sym.File == nil || b.p.IsTestFile(sym.File) {
+			continue
+		}
+		b.add(group(sym.GVL, true), sym.File, sym.Decl, sym.Ident, sym.Block, nil, sym.IsConstant(), gs.ResolveType(sym.Decl.Type))
+	}
+	for _, d := range b.p.POUs() {
+		f := b.p.FileOf(d)
+		if d.Kind != st.Program || f == nil || b.p.IsTestFile(f) {
+			continue
+		}
+		s := b.p.Scope(d)
+		for _, blk := range d.VarBlocks {
+			switch blk.Kind {
+			case "VAR", "VAR_INPUT", "VAR_OUTPUT":
+			default:
+				continue
+			}
+			for _, v := range blk.Vars {
+				t := s.ResolveType(v.Type)
+				for _, id := range v.Names {
+					b.add(group(d.Name.Name, false), f, v, id, blk, d, blk.Constant, t)
+				}
+			}
+		}
+	}
+	sort.SliceStable(b.groups, func(i, j int) bool {
+		return strings.ToUpper(b.groups[i].name) < strings.ToUpper(b.groups[j].name)
+	})
+}
+
+// add appends one variable to g unless its access is 'none', -symbol is set
+// and no attribute applies, or its type has no fixed layout.
+func (b *symBuilder) add(g *symGroup, f *st.File, decl *st.VarDecl, id *st.Ident, blk *st.VarBlock, pou *st.POU, constant bool, t *st.Type) {
+	access, ok := symbolAccess(decl, blk, pou)
+	if b.symbol && !ok || strings.EqualFold(access, "none") {
+		return
+	}
+	mode := "ReadWrite"
+	switch {
+	case constant, strings.EqualFold(access, "read"):
+		mode = "Read"
+	case strings.EqualFold(access, "write"):
+		mode = "Write"
+	}
+	if _, msg := typeLayout(t); msg != "" {
+		fd := finding{Rule: "type", Level: "warning", Line: id.NamePos.Line, Column: id.NamePos.Col,
+			Message: fmt.Sprintf("%s.%s is not exported: %s", g.name, id.Name, msg)}
+		if f != nil {
+			fd.File = f.Name
+		}
+		b.findings = append(b.findings, fd)
+		return
+	}
+	g.vars = append(g.vars, symVar{name: id.Name, t: t, access: mode, comment: strings.Join(strings.Fields(decl.Comment), " ")})
+}
+
+// ── Symbol configuration XML ──────────────────────────────────────────────────
+
+type symConfig struct {
+	XMLName xml.Name   `xml:"Symbolconfiguration"`
+	Xmlns   string     `xml:"xmlns,attr"`
+	Header  symHeader  `xml:"Header"`
+	Types   []symType  `xml:"TypeList>Type"`
+	Nodes   []*symNode `xml:"NodeList>Node"`
+}
+
+type symHeader struct {
+	Project struct {
+		Name   string `xml:"name,attr"`
+		Device string `xml:"devicename,attr"`
+		App    string `xml:"appname,attr"`
+	} `xml:"ProjectInfo"`
+}
+
+// symType is a TypeSimple, TypeArray or TypeUserDef entry; XMLName picks
+// the element.
+type symType struct {
+	XMLName   xml.Name
+	Name      string       `xml:"name,attr"`
+	Size      int64        `xml:"size,attr"`
+	TypeClass string       `xml:"typeclass,attr"`
+	PouClass  string       `xml:"pouclass,attr,omitempty"`
+	IecName   string       `xml:"iecname,attr"`
+	BaseType  string       `xml:"basetype,attr,omitempty"`
+	Dims      []symDim     `xml:"ArrayDim"`
+	Elements  []symElement `xml:"UserDefElement"`
+	Values    []symValue   `xml:"EnumValue"`
+}
+
+type symDim struct {
+	Min int64 `xml:"minrange,attr"`
+	Max int64 `xml:"maxrange,attr"`
+}
+
+type symElement struct {
+	IecName    string `xml:"iecname,attr"`
+	Type       string `xml:"type,attr"`
+	ByteOffset int64  `xml:"byteoffset,attr"`
+	VarType    string `xml:"vartype,attr"`
+}
+
+type symValue struct {
+	IecName string `xml:"iecname,attr"`
+	Value   int64  `xml:"value,attr"`
+}
+
+type symNode struct {
+	Name    string     `xml:"name,attr"`
+	Type    string     `xml:"type,attr,omitempty"`
+	Access  string     `xml:"access,attr,omitempty"`
+	Comment string     `xml:"Comment,omitempty"`
+	Nodes   []*symNode `xml:"Node"`
+}
+
+// symTypeClass is the typeclass of each elementary type.
+var symTypeClass = map[string]string{
+	"BOOL": "Bool", "BYTE": "Byte", "WORD": "Word", "DWORD": "DWord", "LWORD": "LWord",
+	"SINT": "SInt", "INT": "Int", "DINT": "DInt", "LINT": "LInt",
+	"USINT": "USInt", "UINT": "UInt", "UDINT": "UDInt", "ULINT": "ULInt",
+	"REAL": "Real", "LREAL": "LReal", "TIME": "Time", "LTIME": "LTime",
+	"DATE": "Date", "TOD": "TimeOfDay", "DT": "DateAndTime",
+	"LDATE": "LDate", "LTOD": "LTimeOfDay", "LDT": "LDateAndTime",
+	"CHAR": "Char", "WCHAR": "WChar",
+}
+
+// config builds the XML document: one node per GVL and PROGRAM below the
+// application node, and the types of the exported variables.
+func (b *symBuilder) config(project, device, app string) *symConfig {
+	c := &symConfig{Xmlns: "http://www.3s-software.com/schemas/Symbolconfiguration.xsd"}
+	c.Header.Project.Name, c.Header.Project.Device, c.Header.Project.App = project, device, app
+	root := &symNode{Name: app}
+	for _, g := range b.groups {
+		if len(g.vars) == 0 {
+			continue
+		}
+		n := &symNode{Name: g.name}
+		for _, v := range g.vars {
+			n.Nodes = append(n.Nodes, &symNode{Name: v.name, Type: b.typeRef(v.t), Access: v.access, Comment: v.comment})
+		}
+		root.Nodes = append(root.Nodes, n)
+	}
+	c.Nodes = []*symNode{root}
+	c.Types = b.typeList
+	return c
+}
+
+// typeRef returns the name of the type list entry for t, adding it and the
+// types it uses first. Only types with a layout reach it.
+func (b *symBuilder) typeRef(t *st.Type) string {
+	t = underlying(b.p, t)
+	name := "T_" + nonIdentRun.ReplaceAllString(t.Name, "_")
+	if b.types[name] {
+		return name
+	}
+	l, _ := typeLayout(t)
+	e := symType{Name: name, Size: l.size, IecName: t.Name}
+	switch t.Class {
+	case st.StringClass:
+		e.XMLName.Local, e.TypeClass = "TypeSimple", "String"
+		if t.Wide {
+			e.TypeClass = "WString"
+		}
+	case st.ArrayClass:
+		e.XMLName.Local, e.TypeClass = "TypeArray", "Array"
+		e.BaseType = b.typeRef(t.Elem)
+		for _, d := range t.Dims {
+			e.Dims = append(e.Dims, symDim{d.Lo, d.Hi})
+		}
+	case st.StructClass:
+		e.XMLName.Local, e.TypeClass, e.PouClass = "TypeUserDef", "Userdef", "STRUCTURE"
+		_, fields, _ := structLayout(t)
+		for _, f := range fields {
+			e.Elements = append(e.Elements, symElement{f.field.Name, b.typeRef(f.field.Type), f.offset, "VAR"})
+		}
+	case st.EnumClass:
+		e.XMLName.Local, e.TypeClass, e.PouClass = "TypeUserDef", "Enum", "ENUM"
+		base := st.TypeInt
+		if t.Base != nil {
+			base = t.Base
+		}
+		e.BaseType = b.typeRef(base)
+		for _, m := range t.Members {
+			e.Values = append(e.Values, symValue{m.Name, m.Value})
+		}
+	default:
+		e.XMLName.Local, e.TypeClass = "TypeSimple", symTypeClass[strings.ToUpper(t.Name)]
+	}
+	b.types[name] = true
+	b.typeList = append(b.typeList, e)
+	return name
+}
+
+// ── CoDeSys 2.3 style listing ─────────────────────────────────────────────────
+
+// writeSym writes one line per exported value: global variables as
+// .name and PROGRAM variables as PROGRAM.name, as CoDeSys 2.3 names them.
+// STRUCT members and the elements of arrays of STRUCTs get lines of their
+// own; arrays of other types are one line.
+func (b *symBuilder) writeSym(w *bufio.Writer, project string) {
+	fmt.Fprintf(w, "; symbols of %s\r\n", project)
+	fmt.Fprint(w, "; name;type;access\r\n")
+	for _, g := range b.groups {
+		prefix := g.name
+		if g.global {
+			prefix = ""
+		}
+		for _, v := range g.vars {
+			b.symLines(w, prefix+"."+v.name, v.t, strings.NewReplacer("ReadWrite", "RW", "Read", "R", "Write", "W").Replace(v.access))
+		}
+	}
+}
+
+func (b *symBuilder) symLines(w *bufio.Writer, name string, t *st.Type, access string) {
+	t = underlying(b.p, t)
+	switch {
+	case t.Class == st.StructClass:
+		_, fields, _ := structLayout(t)
+		for _, f := range fields {
+			b.symLines(w, name+"."+f.field.Name, f.field.Type, access)
+		}
+		return
+	case t.Class == st.ArrayClass && b.hasMembers(t.Elem):
+		var walk func(name string, i int)
+		walk = func(name string, i int) {
+			if i == len(t.Dims) {
+				b.symLines(w, name+"]", t.Elem, access)
+				return
+			}
+			sep := ","
+			if i == 0 {
+				sep = "["
+			}
+			for k := t.Dims[i].Lo; k <= t.Dims[i].Hi; k++ {
+				walk(name+sep+strconv.FormatInt(k, 10), i+1)
+			}
+		}
+		walk(name, 0)
+		return
+	}
+	fmt.Fprintf(w, "%s;%s;%s\r\n", name, t.Name, access)
+}
+
+// hasMembers reports whether values of t are listed member by member.
+func (b *symBuilder) hasMembers(t *st.Type) bool {
+	t = underlying(b.p, t)
+	return t.Class == st.StructClass || t.Class == st.ArrayClass && b.hasMembers(t.Elem)
+}
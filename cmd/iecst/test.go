@@ -0,0 +1,396 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/damischa1/iec-st-tools/interp"
+	"github.com/damischa1/iec-st-tools/st"
+)
+
+// ── test ──────────────────────────────────────────────────────────────────────
+
+// runTest runs unit tests written in ST. A test is a method marked
+// {attribute 'test'} of a FUNCTION_BLOCK in a test/ directory (see
+// st.Project.IsTestFile). Every test gets a fresh interpreter and instance
+// and is called once per simulated cycle until it calls TEST_FINISHED, an
+// assertion fails or the cycle count is reached.
+func runTest(args []string) int {
+	flags := flag.NewFlagSet("test", flag.ExitOnError)
+	cycles := flags.Int("cycles", 1, "cycles to run each test for, unless it calls TEST_FINISHED earlier")
+	cycle := flags.Duration("cycle", 10*time.Millisecond, "simulated time between two cycles")
+	run := flags.String("run", "", "run only tests whose FB.Method name matches this regular expression")
+	junit := flags.String("junit", "", "also write a JUnit XML report to this file")
+	verbose := flags.Bool("v", false, "list passing tests too")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, "iecst test — run unit tests written in Structured Text\n\n")
+		fmt.Fprintln(os.Stderr, "Usage:")
+		fmt.Fprint(os.Stderr, "  iecst test [flags] [file or directory ...]\n\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	var filter *regexp.Regexp
+	if *run != "" {
+		var err error
+		if filter, err = regexp.Compile(*run); err != nil {
+			fmt.Fprintln(os.Stderr, "iecst test: -run:", err)
+			return 2
+		}
+	}
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	proj, err := st.LoadProject(paths...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "iecst test:", err)
+		return 2
+	}
+	if findings := append(syntaxFindings(proj), checkFindings(proj)...); len(findings) > 0 {
+		sortFindings(findings)
+		writeFindings(os.Stderr, "text", "iecst test", nil, findings)
+		fmt.Fprintln(os.Stderr, "iecst test: sources have errors, no tests run")
+		return 2
+	}
+
+	tests := findTests(proj, *cycles, filter)
+	if len(tests) == 0 {
+		fmt.Println("no tests found")
+		return 0
+	}
+	failed := 0
+	for _, t := range tests {
+		t.run(proj, *cycle)
+		switch {
+		case t.failure != "" || t.err != "":
+			failed++
+			fmt.Printf("--- FAIL: %s (%d cycles)\n", t.name(), t.ran)
+			fmt.Printf("    %s%s\n", t.failure, t.err)
+		case *verbose:
+			fmt.Printf("--- PASS: %s (%d cycles)\n", t.name(), t.ran)
+		}
+	}
+	if *junit != "" {
+		if err := writeJUnit(*junit, tests); err != nil {
+			fmt.Fprintln(os.Stderr, "iecst test:", err)
+			return 2
+		}
+	}
+	if failed > 0 {
+		fmt.Printf("FAIL: %d of %d tests failed\n", failed, len(tests))
+		return 1
+	}
+	fmt.Printf("PASS: %d tests\n", len(tests))
+	return 0
+}
+
+// ── Discovery ─────────────────────────────────────────────────────────────────
+
+// unitTest is one test method and, after run, its outcome.
+type unitTest struct {
+	fb, method *st.POU
+	file       string
+	cycles     int
+
+	ran     int           // cycles executed
+	failure string        // failed assertion
+	err     string        // run-time error
+	elapsed time.Duration // wall-clock time
+}
+
+func (t *unitTest) name() string { return t.fb.Name.Name + "." + t.method.Name.Name }
+
+// findTests returns the test methods of the project in the order of their
+// function blocks and declarations. {attribute 'cycles' := 'n'} on the
+// method or the function block overrides the cycle count.
+func findTests(p *st.Project, cycles int, filter *regexp.Regexp) []*unitTest {
+	var out []*unitTest
+	for _, d := range p.POUs() {
+		f := p.FileOf(d)
+		if d.Kind != st.FunctionBlock || f == nil || !p.IsTestFile(f) {
+			continue
+		}
+		for _, m := range d.Methods {
+			if _, ok := m.Attribute("test"); !ok {
+				continue
+			}
+			t := &unitTest{fb: d, method: m, file: f.Name, cycles: cycles}
+			for _, x := range []*st.POU{d, m} {
+				if v, ok := x.Attribute("cycles"); ok {
+					if n, err := strconv.Atoi(v); err == nil && n > 0 {
+						t.cycles = n
+					} else {
+						fmt.Fprintf(os.Stderr, "WARNING: %s: invalid cycles attribute %q\n", x.Name.Name, v)
+					}
+				}
+			}
+			if filter == nil || filter.MatchString(t.name()) {
+				out = append(out, t)
+			}
+		}
+	}
+	return out
+}
+
+// ── Execution ─────────────────────────────────────────────────────────────────
+
+// assertionError is a failed assertion; other errors are run-time errors.
+type assertionError struct{ msg string }
+
+func (e *assertionError) Error() string { return e.msg }
+
+// run executes the test in a fresh machine, advancing the clock by cycle
+// after every call.
+func (t *unitTest) run(p *st.Project, cycle time.Duration) {
+	start := time.Now()
+	defer func() { t.elapsed = time.Since(start) }()
+
+	m, err := interp.New(p)
+	if err != nil {
+		t.err = err.Error()
+		return
+	}
+	finished := false
+	defineAssertions(m, &finished)
+	inst, err := m.NewInstance(t.fb.Name.Name)
+	if err != nil {
+		t.err = err.Error()
+		return
+	}
+	for !finished && t.ran < t.cycles {
+		t.ran++
+		if _, _, err := inst.Method(t.method.Name.Name, nil); err != nil {
+			var a *assertionError
+			if errors.As(err, &a) {
+				t.failure = err.Error()
+			} else {
+				t.err = err.Error()
+			}
+			return
+		}
+		m.Advance(cycle)
+	}
+}
+
+// defineAssertions implements the functions of st.TestPOUs for one test.
+func defineAssertions(m *interp.Machine, finished *bool) {
+	check := func(name string, ok bool, msg any, format string, args ...any) (any, error) {
+		if ok {
+			return true, nil
+		}
+		detail := fmt.Sprintf(format, args...)
+		if s, _ := msg.(string); s != "" {
+			return nil, &assertionError{s + ": " + detail}
+		}
+		return nil, &assertionError{name + ": " + detail}
+	}
+	funcs := map[string]interp.GoFunc{
+		"ASSERTEQUALS": func(a []any) (any, error) {
+			return check("AssertEquals", equalValues(a[0], a[1]), a[2], "expected %s, got %s", stValue(a[0]), stValue(a[1]))
+		},
+		"ASSERTNOTEQUALS": func(a []any) (any, error) {
+			return check("AssertNotEquals", !equalValues(a[0], a[1]), a[2], "expected a value other than %s", stValue(a[0]))
+		},
+		"ASSERTEQUALS_REAL":  assertNear("AssertEquals_REAL", check),
+		"ASSERTEQUALS_LREAL": assertNear("AssertEquals_LREAL", check),
+		"ASSERTTRUE": func(a []any) (any, error) {
+			return check("AssertTrue", a[0] == true, a[1], "condition is FALSE")
+		},
+		"ASSERTFALSE": func(a []any) (any, error) {
+			return check("AssertFalse", a[0] == false, a[1], "condition is TRUE")
+		},
+		"TEST_FINISHED": func([]any) (any, error) {
+			*finished = true
+			return true, nil
+		},
+	}
+	for _, d := range st.TestPOUs() {
+		m.Define(d, funcs[strings.ToUpper(d.Name.Name)])
+	}
+}
+
+func assertNear(name string, check func(string, bool, any, string, ...any) (any, error)) interp.GoFunc {
+	return func(a []any) (any, error) {
+		want, got, delta := a[0].(float64), a[1].(float64), a[2].(float64)
+		return check(name, math.Abs(want-got) <= math.Abs(delta), a[3], "expected %v ± %v, got %v", want, delta, got)
+	}
+}
+
+// equalValues compares two interpreter values; integers and reals compare
+// by numeric value.
+func equalValues(a, b any) bool {
+	switch x := a.(type) {
+	case int64:
+		switch y := b.(type) {
+		case int64:
+			return x == y
+		case float64:
+			return float64(x) == y
+		}
+		return false
+	case float64:
+		switch y := b.(type) {
+		case int64:
+			return x == float64(y)
+		case float64:
+			return x == y
+		}
+		return false
+	case time.Time:
+		y, ok := b.(time.Time)
+		return ok && x.Equal(y)
+	case []any:
+		y, ok := b.([]any)
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !equalValues(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]any:
+		y, ok := b.(map[string]any)
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for k, v := range x {
+			if w, ok := y[k]; !ok || !equalValues(v, w) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
+
+// stValue formats an interpreter value in ST notation for messages.
+func stValue(x any) string {
+	switch x := x.(type) {
+	case bool:
+		if x {
+			return "TRUE"
+		}
+		return "FALSE"
+	case string:
+		return "'" + x + "'"
+	case time.Duration:
+		return "T#" + x.String()
+	case time.Time:
+		return "DT#" + x.Format("2006-01-02-15:04:05")
+	case []any:
+		parts := make([]string, len(x))
+		for i, v := range x {
+			parts[i] = stValue(v)
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	case map[string]any:
+		keys := make([]string, 0, len(x))
+		for k := range x {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		parts := make([]string, len(keys))
+		for i, k := range keys {
+			parts[i] = k + " := " + stValue(x[k])
+		}
+		return "(" + strings.Join(parts, ", ") + ")"
+	}
+	return fmt.Sprint(x)
+}
+
+// ── JUnit report ──────────────────────────────────────────────────────────────
+
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Errors   int          `xml:"errors,attr"`
+	Time     string       `xml:"time,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Errors   int         `xml:"errors,attr"`
+	Time     string      `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+
+	elapsed time.Duration
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	File      string        `xml:"file,attr"`
+	Line      int           `xml:"line,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitProblem `xml:"failure"`
+	Error     *junitProblem `xml:"error"`
+}
+
+type junitProblem struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func seconds(d time.Duration) string { return strconv.FormatFloat(d.Seconds(), 'f', 3, 64) }
+
+// writeJUnit writes the results as JUnit XML, one testsuite per function
+// block, as read by CI servers.
+func writeJUnit(path string, tests []*unitTest) error {
+	var all junitSuites
+	var total time.Duration
+	for _, t := range tests {
+		if n := len(all.Suites); n == 0 || all.Suites[n-1].Name != t.fb.Name.Name {
+			all.Suites = append(all.Suites, junitSuite{Name: t.fb.Name.Name})
+		}
+		s := &all.Suites[len(all.Suites)-1]
+		c := junitCase{
+			Name:      t.method.Name.Name,
+			ClassName: t.fb.Name.Name,
+			File:      t.file,
+			Line:      t.method.Pos().Line,
+			Time:      seconds(t.elapsed),
+		}
+		switch {
+		case t.failure != "":
+			c.Failure = &junitProblem{Message: t.failure, Type: "assertion", Text: t.failure}
+			s.Failures++
+		case t.err != "":
+			c.Error = &junitProblem{Message: t.err, Type: "runtime", Text: t.err}
+			s.Errors++
+		}
+		s.Cases = append(s.Cases, c)
+		s.Tests++
+		s.elapsed += t.elapsed
+		total += t.elapsed
+	}
+	for i := range all.Suites {
+		s := &all.Suites[i]
+		s.Time = seconds(s.elapsed)
+		all.Tests += s.Tests
+		all.Failures += s.Failures
+		all.Errors += s.Errors
+	}
+	all.Time = seconds(total)
+	out, err := xml.MarshalIndent(all, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append([]byte(xml.Header), append(out, '\n')...), 0644)
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ── Line diff ─────────────────────────────────────────────────────────────────
+
+// diffOp is one line of an edit script: ' ' keep, '-' delete, '+' insert.
+type diffOp struct {
+	op   byte
+	text string
+}
+
+// diffLines computes a minimal line edit script between a and b using the
+// longest common subsequence. ST objects are small enough for the quadratic
+// table; common prefix and suffix are trimmed first to keep it smaller still.
+func diffLines(a, b []string) []diffOp {
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+	ma, mb := a[pre:len(a)-suf], b[pre:len(b)-suf]
+
+	// lcs[i][j] = length of the LCS of ma[i:] and mb[j:]
+	lcs := make([][]int, len(ma)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(mb)+1)
+	}
+	for i := len(ma) - 1; i >= 0; i-- {
+		for j := len(mb) - 1; j >= 0; j-- {
+			if ma[i] == mb[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	ops := make([]diffOp, 0, len(a)+len(b))
+	for _, l := range a[:pre] {
+		ops = append(ops, diffOp{' ', l})
+	}
+	i, j := 0, 0
+	for i < len(ma) || j < len(mb) {
+		switch {
+		case i < len(ma) && j < len(mb) && ma[i] == mb[j]:
+			ops = append(ops, diffOp{' ', ma[i]})
+			i++
+			j++
+		case j < len(mb) && (i == len(ma) || lcs[i][j+1] > lcs[i+1][j]):
+			ops = append(ops, diffOp{'+', mb[j]})
+			j++
+		default:
+			ops = append(ops, diffOp{'-', ma[i]})
+			i++
+		}
+	}
+	for _, l := range a[len(a)-suf:] {
+		ops = append(ops, diffOp{' ', l})
+	}
+	return ops
+}
+
+// splitLines splits normalised text into lines; empty text has no lines.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+// unifiedDiff renders the difference between two texts as unified diff hunks
+// with the given number of context lines. It returns "" for equal texts.
+func unifiedDiff(a, b string, context int) string {
+	ops := diffLines(splitLines(a), splitLines(b))
+
+	var sb strings.Builder
+	for start := 0; start < len(ops); {
+		// find the next change
+		for start < len(ops) && ops[start].op == ' ' {
+			start++
+		}
+		if start == len(ops) {
+			break
+		}
+		lo := start - context
+		if lo < 0 {
+			lo = 0
+		}
+		// extend the hunk while changes are within 2*context lines
+		hi := start
+		for k := start; k < len(ops); k++ {
+			if ops[k].op != ' ' {
+				hi = k
+			} else if k-hi > 2*context {
+				break
+			}
+		}
+		end := hi + context + 1
+		if end > len(ops) {
+			end = len(ops)
+		}
+
+		aLine, bLine := 1, 1
+		for _, op := range ops[:lo] {
+			if op.op != '+' {
+				aLine++
+			}
+			if op.op != '-' {
+				bLine++
+			}
+		}
+		aCount, bCount := 0, 0
+		for _, op := range ops[lo:end] {
+			if op.op != '+' {
+				aCount++
+			}
+			if op.op != '-' {
+				bCount++
+			}
+		}
+		fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@\n", aLine, aCount, bLine, bCount)
+		for _, op := range ops[lo:end] {
+			fmt.Fprintf(&sb, "%c%s\n", op.op, op.text)
+		}
+		start = end
+	}
+	return sb.String()
+}
+
+// ── Three-way line merge ──────────────────────────────────────────────────────
+
+// matchIndex maps every line of a to the line of b it is kept as, or -1.
+func matchIndex(a, b []string) []int {
+	m := make([]int, len(a))
+	i, j := 0, 0
+	for _, op := range diffLines(a, b) {
+		switch op.op {
+		case ' ':
+			m[i] = j
+			i++
+			j++
+		case '-':
+			m[i] = -1
+			i++
+		case '+':
+			j++
+		}
+	}
+	return m
+}
+
+// merge3 merges the changes from base to ours and from base to theirs, in the
+// manner of diff3. Chunks changed on only one side, or identically on both,
+// are taken over; chunks changed differently on both sides are emitted
+// between git-style conflict markers. It returns the merged text and the
+// number of conflicts.
+func merge3(base, ours, theirs, oursLabel, theirsLabel string) (string, int) {
+	o, a, b := splitLines(base), splitLines(ours), splitLines(theirs)
+	ma, mb := matchIndex(o, a), matchIndex(o, b)
+
+	var out []string
+	conflicts := 0
+	equal := func(x, y []string) bool {
+		if len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if x[i] != y[i] {
+				return false
+			}
+		}
+		return true
+	}
+
+	io, ia, ib := 0, 0, 0
+	for io < len(o) || ia < len(a) || ib < len(b) {
+		if io < len(o) && ma[io] == ia && mb[io] == ib {
+			out = append(out, o[io])
+			io, ia, ib = io+1, ia+1, ib+1
+			continue
+		}
+		// the next base line kept by both sides ends the unstable chunk
+		j, ea, eb := io, len(a), len(b)
+		for ; j < len(o); j++ {
+			if ma[j] >= 0 && mb[j] >= 0 {
+				ea, eb = ma[j], mb[j]
+				break
+			}
+		}
+		co, ca, cb := o[io:j], a[ia:ea], b[ib:eb]
+		switch {
+		case equal(ca, co):
+			out = append(out, cb...)
+		case equal(cb, co), equal(ca, cb):
+			out = append(out, ca...)
+		default:
+			conflicts++
+			out = append(out, "<<<<<<< "+oursLabel)
+			out = append(out, ca...)
+			out = append(out, "=======")
+			out = append(out, cb...)
+			out = append(out, ">>>>>>> "+theirsLabel)
+		}
+		io, ia, ib = j, ea, eb
+	}
+	return strings.Join(out, "\n"), conflicts
+}
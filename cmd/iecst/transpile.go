@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/damischa1/iec-st-tools/cgen"
+	"github.com/damischa1/iec-st-tools/st"
+)
+
+// ── transpile ─────────────────────────────────────────────────────────────────
+
+// runTranspile translates a .st tree into another language. The C backend
+// writes iec_rt.h, NAME.h and NAME.c (see package cgen); nothing is written
+// when a construct cannot be translated.
+func runTranspile(args []string) int {
+	flags := flag.NewFlagSet("transpile", flag.ExitOnError)
+	to := flags.String("to", "c", "target language: c")
+	out := flags.String("out", ".", "directory to write the generated files to")
+	name := flags.String("name", "plc", "base name of the generated files and prefix of NAME_init and NAME_cycle")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, "iecst transpile — translate a .st project to portable C99\n\n")
+		fmt.Fprintln(os.Stderr, "Usage:")
+		fmt.Fprint(os.Stderr, "  iecst transpile [-to c] [-out DIR] [-name plc] [file or directory ...]\n\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if *to != "c" {
+		fmt.Fprintf(os.Stderr, "iecst transpile: unknown target %q (supported: c)\n", *to)
+		return 2
+	}
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	proj, err := st.LoadProject(paths...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "iecst transpile:", err)
+		return 2
+	}
+	if findings := append(syntaxFindings(proj), checkFindings(proj)...); len(findings) > 0 {
+		sortFindings(findings)
+		writeFindings(os.Stderr, "text", "iecst transpile", nil, findings)
+		fmt.Fprintln(os.Stderr, "iecst transpile: sources have errors, nothing written")
+		return 2
+	}
+
+	files, err := cgen.Generate(proj, cgen.Options{Name: *name})
+	if err != nil {
+		var el cgen.ErrorList
+		if !errors.As(err, &el) {
+			fmt.Fprintln(os.Stderr, "iecst transpile:", err)
+			return 2
+		}
+		for _, e := range el {
+			fmt.Fprintln(os.Stderr, "ERROR:", e)
+		}
+		fmt.Fprintf(os.Stderr, "iecst transpile: %d construct(s) not translatable to C, nothing written\n", len(el))
+		return 1
+	}
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		fmt.Fprintln(os.Stderr, "iecst transpile:", err)
+		return 2
+	}
+	for _, f := range files {
+		path := filepath.Join(*out, f.Name)
+		if err := os.WriteFile(path, f.Data, 0o644); err != nil {
+			fmt.Fprintln(os.Stderr, "iecst transpile:", err)
+			return 2
+		}
+		fmt.Println(path)
+	}
+	return 0
+}
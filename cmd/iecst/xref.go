@@ -0,0 +1,558 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/damischa1/iec-st-tools/st"
+)
+
+// ── xref ──────────────────────────────────────────────────────────────────────
+
+// runXref prints where every POU, data type, global variable and enumeration
+// value is declared and used, together with the call graph and the type-usage
+// graph of the project. The reference index is the one the language server
+// uses (st.Project.References), so both agree on what a name resolves to.
+func runXref(args []string) int {
+	flags := flag.NewFlagSet("xref", flag.ExitOnError)
+	format := flags.String("format", "text", "output format: text, json or dot")
+	graph := flags.String("graph", "calls", "graph written by -format dot: calls or types")
+	symbols := flags.String("symbol", "", "comma-separated names to list: POUs, types, GVLs, GVL.var or Type.value (default all)")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, "iecst xref — cross-reference, call graph and type usage of Structured Text sources\n\n")
+		fmt.Fprintln(os.Stderr, "Usage:")
+		fmt.Fprint(os.Stderr, "  iecst xref [-format text|json|dot] [-graph calls|types] [-symbol list] [file or directory ...]\n\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	switch *format {
+	case "text", "json", "dot":
+	default:
+		fmt.Fprintf(os.Stderr, "iecst xref: unknown output format %q (want text, json or dot)\n", *format)
+		return 2
+	}
+	if *graph != "calls" && *graph != "types" {
+		fmt.Fprintf(os.Stderr, "iecst xref: unknown graph %q (want calls or types)\n", *graph)
+		return 2
+	}
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	proj, err := st.LoadProject(paths...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "iecst xref:", err)
+		return 2
+	}
+	if findings := syntaxFindings(proj); len(findings) > 0 {
+		sortFindings(findings)
+		for _, f := range findings {
+			fmt.Fprintf(os.Stderr, "WARNING: %s:%d:%d: %s\n", f.File, f.Line, f.Column, f.Message)
+		}
+	}
+
+	x := buildXref(proj)
+	status := 0
+	if patterns := splitList(*symbols); len(patterns) > 0 {
+		var kept []*xrefSymbol
+		matched := make([]bool, len(patterns))
+		for _, s := range x.Symbols {
+			hit := false
+			for i, pat := range patterns {
+				if s.matches(pat) {
+					matched[i], hit = true, true
+				}
+			}
+			if hit {
+				kept = append(kept, s)
+			}
+		}
+		for i, pat := range patterns {
+			if !matched[i] {
+				fmt.Fprintf(os.Stderr, "iecst xref: no symbol matches %q\n", pat)
+				status = 1
+			}
+		}
+		x.Symbols = kept
+	}
+
+	switch *format {
+	case "text":
+		writeXrefText(os.Stdout, x.Symbols)
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(x); err != nil {
+			fmt.Fprintln(os.Stderr, "iecst xref:", err)
+			return 2
+		}
+	case "dot":
+		if *graph == "types" {
+			writeXrefDot(os.Stdout, "types", &x.Types)
+		} else {
+			writeXrefDot(os.Stdout, "calls", &x.Calls)
+		}
+	}
+	return status
+}
+
+// ── Report model ──────────────────────────────────────────────────────────────
+
+// xrefReport is the JSON output of iecst xref.
+type xrefReport struct {
+	Symbols []*xrefSymbol `json:"symbols"`
+	Calls   xrefGraph     `json:"calls"`
+	Types   xrefGraph     `json:"types"`
+}
+
+// xrefSymbol is a declared name with its uses. Kind is program,
+// function_block, function, method, type, enum_value or global. Methods are
+// named FB.Method, enumeration values Type.Value and globals GVL.Variable.
+type xrefSymbol struct {
+	Kind   string    `json:"kind"`
+	Name   string    `json:"name"`
+	Type   string    `json:"type,omitempty"`
+	File   string    `json:"file"`
+	Line   int       `json:"line"`
+	Column int       `json:"column"`
+	Refs   []xrefUse `json:"refs"`
+}
+
+// xrefUse is one use of a symbol. Access is read, write, call, use (a type
+// or POU named in a declaration) or external (a VAR_EXTERNAL declaration of
+// a global). In names the POU, type or GVL the use is in.
+type xrefUse struct {
+	Access string `json:"access"`
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+	In     string `json:"in,omitempty"`
+}
+
+// matches reports whether the symbol is selected by a -symbol pattern: its
+// full name, its last name component, or a prefix before a dot, so a GVL
+// name selects its variables and a type name its enumeration values.
+func (s *xrefSymbol) matches(pat string) bool {
+	name := strings.ToUpper(s.Name)
+	pat = strings.ToUpper(pat)
+	if name == pat || strings.HasPrefix(name, pat+".") {
+		return true
+	}
+	i := strings.LastIndexByte(name, '.')
+	return i >= 0 && name[i+1:] == pat
+}
+
+type xrefNode struct {
+	Name     string `json:"name"`
+	Kind     string `json:"kind"` // POU kind, type or gvl
+	Standard bool   `json:"standard,omitempty"`
+}
+
+// xrefEdge is an edge of a graph. In the call graph Via lists the FB
+// instances through which From calls To; in the type graph Kind is uses or
+// extends.
+type xrefEdge struct {
+	From string   `json:"from"`
+	To   string   `json:"to"`
+	Kind string   `json:"kind,omitempty"`
+	Via  []string `json:"via,omitempty"`
+}
+
+type xrefGraph struct {
+	Nodes []xrefNode `json:"nodes"`
+	Edges []xrefEdge `json:"edges"`
+}
+
+// graphBuilder collects nodes and deduplicated edges in a stable order.
+type graphBuilder struct {
+	nodes map[string]xrefNode
+	edges map[[3]string]*xrefEdge
+}
+
+func newGraphBuilder() *graphBuilder {
+	return &graphBuilder{nodes: map[string]xrefNode{}, edges: map[[3]string]*xrefEdge{}}
+}
+
+func (b *graphBuilder) node(n xrefNode) { b.nodes[n.Name] = n }
+
+func (b *graphBuilder) edge(from, to, kind, via string) {
+	key := [3]string{from, to, kind}
+	e := b.edges[key]
+	if e == nil {
+		e = &xrefEdge{From: from, To: to, Kind: kind}
+		b.edges[key] = e
+	}
+	if via != "" {
+		for _, v := range e.Via {
+			if strings.EqualFold(v, via) {
+				return
+			}
+		}
+		e.Via = append(e.Via, via)
+	}
+}
+
+func (b *graphBuilder) graph() xrefGraph {
+	g := xrefGraph{Nodes: []xrefNode{}, Edges: []xrefEdge{}}
+	for _, n := range b.nodes {
+		g.Nodes = append(g.Nodes, n)
+	}
+	sort.Slice(g.Nodes, func(i, j int) bool { return g.Nodes[i].Name < g.Nodes[j].Name })
+	for _, e := range b.edges {
+		sort.Strings(e.Via)
+		g.Edges = append(g.Edges, *e)
+	}
+	sort.Slice(g.Edges, func(i, j int) bool {
+		a, b := g.Edges[i], g.Edges[j]
+		if a.From != b.From {
+			return a.From < b.From
+		}
+		if a.To != b.To {
+			return a.To < b.To
+		}
+		return a.Kind < b.Kind
+	})
+	return g
+}
+
+// ── Building the report ───────────────────────────────────────────────────────
+
+func buildXref(p *st.Project) *xrefReport {
+	x := &xrefReport{Symbols: []*xrefSymbol{}}
+	byIdent := map[*st.Ident]*xrefSymbol{}
+	declare := func(kind, name, typ string, id *st.Ident) {
+		s := &xrefSymbol{Kind: kind, Name: name, Type: typ, Refs: []xrefUse{}}
+		if f := p.FileOf(id); f != nil {
+			s.File = f.Name
+		}
+		s.Line, s.Column = id.NamePos.Line, id.NamePos.Col
+		x.Symbols = append(x.Symbols, s)
+		byIdent[id] = s
+	}
+
+	gs := p.GlobalScope()
+	pous := p.POUs()
+	for _, d := range pous {
+		declare(pouKind(d), d.Name.Name, returnTypeName(p, d), d.Name)
+		for _, m := range d.Methods {
+			declare(pouKind(m), xrefPOUName(p, m), returnTypeName(p, m), m.Name)
+		}
+	}
+	for _, td := range p.TypeDecls() {
+		declare("type", td.Name.Name, gs.ResolveType(td.Type).Name, td.Name)
+		if t := p.TypeOfDecl(td); t.Decl == td && t.Class == st.EnumClass {
+			for _, m := range t.Members {
+				declare("enum_value", td.Name.Name+"."+m.Name, td.Name.Name, m.Ident)
+			}
+		}
+	}
+	for _, g := range p.Globals() {
+		declare("global", g.GVL+"."+g.Name, gs.ResolveType(g.Decl.Type).Name, g.Ident)
+	}
+
+	calls := newGraphBuilder()
+	for _, d := range pous {
+		calls.node(xrefNode{Name: d.Name.Name, Kind: pouKind(d)})
+		for _, m := range d.Methods {
+			calls.node(xrefNode{Name: xrefPOUName(p, m), Kind: pouKind(m)})
+		}
+	}
+
+	use := func(s *xrefSymbol, access string, f *st.File, id *st.Ident, in string) {
+		s.Refs = append(s.Refs, xrefUse{Access: access, File: f.Name, Line: id.NamePos.Line, Column: id.NamePos.Col, In: in})
+	}
+	for _, r := range p.References() {
+		sym := r.Symbol
+		if sym == nil {
+			continue
+		}
+		in := xrefContext(p, r)
+		if r.Call && r.POU != nil {
+			if callee, via := calleeOf(sym); callee != nil {
+				name := xrefPOUName(p, callee)
+				if _, ok := calls.nodes[name]; !ok { // standard FB or test assertion
+					calls.node(xrefNode{Name: name, Kind: pouKind(callee), Standard: true})
+				}
+				calls.edge(in, name, "", via)
+			}
+		}
+		if sym.Kind == st.VarSymbol && sym.BlockKind() == "VAR_EXTERNAL" {
+			if g := p.Global(sym.Name); g != nil {
+				sym = g
+			}
+		}
+		if sym.Kind == st.VarSymbol && sym.Decl == nil {
+			continue // function result, named like the function
+		}
+		s := byIdent[sym.Ident]
+		if s == nil {
+			continue
+		}
+		access := "read"
+		switch {
+		case r.Call:
+			access = "call"
+		case r.Write:
+			access = "write"
+		case sym.Kind == st.POUSymbol || sym.Kind == st.TypeSymbol:
+			access = "use"
+		}
+		use(s, access, r.File, r.Ident, in)
+	}
+	for _, d := range pous {
+		for _, u := range append([]*st.POU{d}, d.Methods...) {
+			for _, b := range u.VarBlocks {
+				if b.Kind != "VAR_EXTERNAL" {
+					continue
+				}
+				for _, v := range b.Vars {
+					for _, id := range v.Names {
+						if g := p.Global(id.Name); g != nil && byIdent[g.Ident] != nil {
+							use(byIdent[g.Ident], "external", p.FileOf(id), id, xrefPOUName(p, u))
+						}
+					}
+				}
+			}
+		}
+	}
+	for _, s := range x.Symbols {
+		sort.SliceStable(s.Refs, func(i, j int) bool {
+			a, b := s.Refs[i], s.Refs[j]
+			if a.File != b.File {
+				return a.File < b.File
+			}
+			if a.Line != b.Line {
+				return a.Line < b.Line
+			}
+			return a.Column < b.Column
+		})
+	}
+	x.Calls = calls.graph()
+	x.Types = typeGraph(p)
+	return x
+}
+
+// calleeOf returns the POU a call reference invokes and, for a function
+// block call, the name of the instance.
+func calleeOf(sym *st.Symbol) (*st.POU, string) {
+	switch sym.Kind {
+	case st.POUSymbol:
+		return sym.POU, ""
+	case st.VarSymbol, st.GlobalSymbol, st.FieldSymbol:
+		t := sym.Type
+		if t != nil && t.Class == st.PointerClass && t.Ref {
+			t = t.Elem
+		}
+		if t != nil && t.Class == st.InstanceClass {
+			return t.POU, sym.Name
+		}
+	}
+	return nil, ""
+}
+
+// typeGraph links POUs, data types and GVLs to the data types and function
+// blocks their declarations use.
+func typeGraph(p *st.Project) xrefGraph {
+	b := newGraphBuilder()
+	var walk func(from string, ts st.TypeSpec)
+	walk = func(from string, ts st.TypeSpec) {
+		switch t := ts.(type) {
+		case *st.NamedType:
+			name := t.Name.Name
+			if i := strings.LastIndexByte(name, '.'); i >= 0 {
+				name = name[i+1:]
+			}
+			if td := p.TypeDecl(name); td != nil {
+				b.edge(from, td.Name.Name, "uses", "")
+			} else if d := p.POU(name); d != nil && d.Kind == st.FunctionBlock && !st.IsStandard(d) {
+				b.edge(from, d.Name.Name, "uses", "")
+			}
+		case *st.ArrayType:
+			walk(from, t.Elem)
+		case *st.PointerType:
+			walk(from, t.Elem)
+		case *st.StructType:
+			for _, v := range t.Fields {
+				walk(from, v.Type)
+			}
+		case *st.EnumType:
+			if t.Base != nil {
+				walk(from, t.Base)
+			}
+		case *st.SubrangeType:
+			walk(from, t.Base)
+		}
+	}
+	for _, td := range p.TypeDecls() {
+		b.node(xrefNode{Name: td.Name.Name, Kind: "type"})
+		walk(td.Name.Name, td.Type)
+		if td.Extends != nil {
+			if base := p.TypeDecl(td.Extends.Name); base != nil {
+				b.edge(td.Name.Name, base.Name.Name, "extends", "")
+			}
+		}
+	}
+	for _, d := range p.POUs() {
+		if d.Kind == st.FunctionBlock {
+			b.node(xrefNode{Name: d.Name.Name, Kind: pouKind(d)})
+		}
+		if d.Extends != nil {
+			if base := p.POU(d.Extends.Name); base != nil {
+				b.edge(d.Name.Name, base.Name.Name, "extends", "")
+			}
+		}
+		for _, u := range append([]*st.POU{d}, d.Methods...) {
+			from := xrefPOUName(p, u)
+			n := len(b.edges)
+			if u.ReturnType != nil {
+				walk(from, u.ReturnType)
+			}
+			for _, blk := range u.VarBlocks {
+				for _, v := range blk.Vars {
+					walk(from, v.Type)
+				}
+			}
+			if len(b.edges) > n || u.Kind == st.FunctionBlock {
+				b.node(xrefNode{Name: from, Kind: pouKind(u)})
+			}
+		}
+	}
+	seen := map[*st.VarDecl]bool{}
+	for _, g := range p.Globals() {
+		if seen[g.Decl] {
+			continue
+		}
+		seen[g.Decl] = true
+		n := len(b.edges)
+		walk(g.GVL, g.Decl.Type)
+		if len(b.edges) > n {
+			b.node(xrefNode{Name: g.GVL, Kind: "gvl"})
+		}
+	}
+	return b.graph()
+}
+
+// xrefContext names what a reference is in: its POU or method, or else the
+// data type or GVL whose declaration contains it.
+func xrefContext(p *st.Project, r *st.Ref) string {
+	if r.POU != nil {
+		return xrefPOUName(p, r.POU)
+	}
+	off := r.Ident.NamePos.Offset
+	for _, d := range r.File.Decls {
+		switch d := d.(type) {
+		case *st.TypeBlock:
+			if off < d.KwPos.Offset || off > d.EndPos.Offset {
+				continue
+			}
+			name := ""
+			for _, td := range d.Types {
+				if td.Name.NamePos.Offset <= off {
+					name = td.Name.Name
+				}
+			}
+			return name
+		case *st.Configuration:
+			if off >= d.KwPos.Offset && off <= d.EndPos.Offset {
+				return d.Name.Name
+			}
+		case *st.VarBlock:
+			if off >= d.KwPos.Offset && off <= d.EndPos.Offset {
+				return strings.TrimSuffix(filepath.Base(r.File.Name), filepath.Ext(r.File.Name))
+			}
+		}
+	}
+	return ""
+}
+
+// xrefPOUName returns the name of a POU; methods are named FB.Method.
+func xrefPOUName(p *st.Project, d *st.POU) string {
+	if owner := p.Owner(d); owner != nil {
+		return owner.Name.Name + "." + d.Name.Name
+	}
+	return d.Name.Name
+}
+
+func pouKind(d *st.POU) string { return strings.ToLower(d.Kind.String()) }
+
+func returnTypeName(p *st.Project, d *st.POU) string {
+	if d.ReturnType == nil {
+		return ""
+	}
+	return p.Scope(d).ResolveType(d.ReturnType).Name
+}
+
+// ── Output ────────────────────────────────────────────────────────────────────
+
+func writeXrefText(w io.Writer, symbols []*xrefSymbol) {
+	for i, s := range symbols {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		head := s.Kind + " " + s.Name
+		if s.Type != "" {
+			head += " : " + s.Type
+		}
+		fmt.Fprintf(w, "%s  %s:%d:%d\n", head, s.File, s.Line, s.Column)
+		if len(s.Refs) == 0 {
+			fmt.Fprintln(w, "    no references")
+			continue
+		}
+		width := 0
+		locs := make([]string, len(s.Refs))
+		for j, r := range s.Refs {
+			locs[j] = fmt.Sprintf("%s:%d:%d", r.File, r.Line, r.Column)
+			width = max(width, len(locs[j]))
+		}
+		for j, r := range s.Refs {
+			fmt.Fprintf(w, "    %-8s %-*s  %s\n", r.Access, width, locs[j], r.In)
+		}
+	}
+}
+
+// dotShapes gives the Graphviz node attributes for each node kind.
+var dotShapes = map[string]string{
+	"program":        "shape=box, style=bold",
+	"function_block": "shape=box",
+	"method":         "shape=box, style=rounded",
+	"function":       "shape=ellipse",
+	"type":           "shape=note",
+	"gvl":            "shape=folder",
+}
+
+func writeXrefDot(w io.Writer, name string, g *xrefGraph) {
+	fmt.Fprintf(w, "digraph %s {\n", name)
+	fmt.Fprintln(w, "    rankdir=LR;")
+	fmt.Fprintln(w, "    node [fontname=\"Helvetica\", fontsize=10];")
+	fmt.Fprintln(w, "    edge [fontname=\"Helvetica\", fontsize=9];")
+	for _, n := range g.Nodes {
+		attrs := dotShapes[n.Kind]
+		if n.Standard {
+			attrs = "shape=box, style=dashed"
+		}
+		fmt.Fprintf(w, "    %s [%s];\n", strconv.Quote(n.Name), attrs)
+	}
+	for _, e := range g.Edges {
+		var attrs []string
+		if len(e.Via) > 0 {
+			attrs = append(attrs, "label="+strconv.Quote(strings.Join(e.Via, ", ")))
+		}
+		if e.Kind == "extends" {
+			attrs = append(attrs, "arrowhead=empty")
+		}
+		line := fmt.Sprintf("    %s -> %s", strconv.Quote(e.From), strconv.Quote(e.To))
+		if len(attrs) > 0 {
+			line += " [" + strings.Join(attrs, ", ") + "]"
+		}
+		fmt.Fprintln(w, line+";")
+	}
+	fmt.Fprintln(w, "}")
+}
@@ -12,13 +12,14 @@
 //
 // Usage:
 //
-//	plcopen2st -in <file.xml> [-out <dir>] [-flat]
+//	plcopen2st -in <file.xml> [-out <dir>] [-flat] [-meta=false]
 //
 // Flags:
 //
 //	-in    input PLCOpen XML file (required)
 //	-out   output root directory for .st files (default "src")
 //	-flat  write all files to -out directly, no subdirectories
+//	-meta  write .meta.json sidecars with the CoDeSys ObjectIds (default true)
 package main
 
 import (
@@ -28,6 +29,8 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+
+	"github.com/damischa1/iec-st-tools/meta"
 )
 
 // ── Generic XML node tree ─────────────────────────────────────────────────────
@@ -109,6 +112,7 @@ type importedPOU struct {
 	bodyText string // ST body text
 	bodyType string // "ST", "FBD", "LD", "SFC", "IL"
 	folder   string // project folder path
+	objectID string // CoDeSys ObjectId, "" if none
 }
 
 // extractInterfaceAsPlainText gets the CoDeSys-specific InterfaceAsPlainText
@@ -307,6 +311,7 @@ func extractBodyText(bodyNode *xmlNode) (string, string) {
 type importedDUT struct {
 	name     string
 	declText string
+	objectID string
 }
 
 func reconstructDUT(dtNode *xmlNode) string {
@@ -367,7 +372,7 @@ func reconstructDUT(dtNode *xmlNode) string {
 			vals := valuesNode.allChildren("value")
 			for i, v := range vals {
 				eName := v.attr("name")
-				eVal := ""
+				eVal := v.attr("value") // TC6 attribute form, as written by st2plcopen
 				sv := v.child("simpleValue")
 				if sv != nil {
 					eVal = sv.attr("value")
@@ -394,6 +399,7 @@ func reconstructDUT(dtNode *xmlNode) string {
 type importedGVL struct {
 	name     string
 	declText string
+	objectID string
 }
 
 func reconstructGVL(gvlNode *xmlNode) string {
@@ -550,6 +556,36 @@ func generateDUTST(dut importedDUT) string {
 	return strings.TrimRight(dut.declText, "\n") + "\n"
 }
 
+// objectID returns the CoDeSys ObjectId that node carries in its addData,
+// or "".
+func objectID(node *xmlNode) string {
+	addData := node.child("addData")
+	if addData == nil {
+		return ""
+	}
+	for _, data := range addData.allChildren("data") {
+		if strings.HasSuffix(data.attr("name"), "/objectid") {
+			if id := data.child("ObjectId"); id != nil {
+				return strings.TrimSpace(id.text())
+			}
+		}
+	}
+	return ""
+}
+
+// writeSidecar records the ObjectId of the object written to stPath in its
+// .meta.json sidecar, under the same key as the GUIDs of exp2st35, so that
+// st2plcopen can reuse it and iecst diff and merge can pair objects by it.
+func writeSidecar(stPath, objectID string) {
+	if objectID == "" {
+		return
+	}
+	path := strings.TrimSuffix(stPath, ".st") + ".meta.json"
+	if err := meta.WriteSidecar(path, map[string]any{"guid": objectID}); err != nil {
+		fmt.Fprintf(os.Stderr, "cannot write %s: %v\n", path, err)
+	}
+}
+
 // ── ProjectStructure folder resolution ────────────────────────────────────────
 
 func extractProjectFolders(root *xmlNode) map[string]string {
@@ -595,8 +631,9 @@ func main() {
 	inFile := flag.String("in", "", "input PLCOpen XML file (required)")
 	outDir := flag.String("out", "src", "output root directory")
 	flat := flag.Bool("flat", false, "write all files flat, no subdirectories")
+	writeMeta := flag.Bool("meta", true, "write .meta.json sidecars with the ObjectIds")
 	flag.Usage = func() {
-		fmt.Fprintln(os.Stderr, "plcopen2st — Import PLCOpen XML (TC6) files to IEC 61131-3 .st format\n")
+		fmt.Fprint(os.Stderr, "plcopen2st — Import PLCOpen XML (TC6) files to IEC 61131-3 .st format\n\n")
 		fmt.Fprintln(os.Stderr, "Usage:")
 		flag.PrintDefaults()
 	}
@@ -647,6 +684,7 @@ func main() {
 				allDUTs = append(allDUTs, importedDUT{
 					name:     name,
 					declText: declText,
+					objectID: objectID(dtNode),
 				})
 			}
 		}
@@ -669,10 +707,8 @@ func main() {
 	addData := root.child("addData")
 	if addData != nil {
 		for _, data := range addData.allChildren("data") {
-			res := data.child("resource")
-			if res != nil {
-				extractGVLsRecursive(res, &allGVLs)
-			}
+			// CoDeSys 3.5 places GVLs directly under <data name=".../globalvars">
+			extractGVLsRecursive(data, &allGVLs)
 		}
 	}
 
@@ -701,6 +737,9 @@ func main() {
 			fmt.Fprintf(os.Stderr, "cannot write %s: %v\n", outPath, err)
 			continue
 		}
+		if *writeMeta {
+			writeSidecar(outPath, pou.objectID)
+		}
 
 		tag := ""
 		if pou.bodyType != "ST" && pou.bodyType != "" {
@@ -730,6 +769,9 @@ func main() {
 			fmt.Fprintf(os.Stderr, "cannot write %s: %v\n", outPath, err)
 			continue
 		}
+		if *writeMeta {
+			writeSidecar(outPath, dut.objectID)
+		}
 
 		fmt.Printf("  %-10s  %s\n", "DUT", outPath)
 		written++
@@ -754,6 +796,9 @@ func main() {
 			fmt.Fprintf(os.Stderr, "cannot write %s: %v\n", outPath, err)
 			continue
 		}
+		if *writeMeta {
+			writeSidecar(outPath, gvl.objectID)
+		}
 
 		fmt.Printf("  %-10s  %s\n", "GVL", outPath)
 		written++
@@ -793,6 +838,7 @@ func extractPOU(pouNode *xmlNode, projFolders map[string]string) importedPOU {
 		bodyText: bodyText,
 		bodyType: bodyType,
 		folder:   folder,
+		objectID: objectID(pouNode),
 	}
 }
 
@@ -846,6 +892,7 @@ func extractGVLsRecursive(node *xmlNode, allGVLs *[]importedGVL) {
 			*allGVLs = append(*allGVLs, importedGVL{
 				name:     name,
 				declText: declText,
+				objectID: objectID(c),
 			})
 		case "configuration", "resource":
 			extractGVLsRecursive(c, allGVLs)
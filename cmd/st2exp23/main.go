@@ -4,6 +4,15 @@
 // NOTE: CoDeSys 2.3 requires Windows-style CRLF (\r\n) line endings.
 // This tool always outputs CRLF. CoDeSys runs on Windows only.
 //
+// The .st sources are read as UTF-8 and the EXP file is written in the Windows
+// ANSI code page given by -encoding. Characters that the code page cannot
+// represent are reported with their position and nothing is written.
+//
+// A <name>.meta.json sidecar next to a .st file (as written by exp2st23)
+// restores the object's @OBJECTFLAGS, @SYMFILEFLAGS and @CONNECTIONS values.
+// Without a sidecar the defaults '0, 8' and '2048' and an empty connection
+// block are used.
+//
 // Usage:
 //
 //	st2exp23 [flags]
@@ -12,6 +21,8 @@
 //	  -out    string   Output directory for the .EXP file   (default "build")
 //	  -name   string   Base name of the output file          (default "export")
 //	  -path   string   CoDeSys PATH value for all objects    (default "")
+//	  -encoding string Code page of the .EXP file            (default "windows-1252")
+//	  -check           Type-check the sources first; write nothing on errors
 //	  -help            Show this help message
 //
 // Examples:
@@ -22,6 +33,9 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
@@ -29,6 +43,10 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"unicode/utf8"
+
+	"github.com/damischa1/iec-st-tools/codepage"
+	"github.com/damischa1/iec-st-tools/st"
 )
 
 // pouKind represents the top-level type of a Structured Text object.
@@ -63,14 +81,75 @@ func detectKind(firstLine string) pouKind {
 	return kindUnknown
 }
 
+// objectMeta is the part of a .meta.json sidecar used by st2exp23. Nil fields
+// were not recorded and fall back to the defaults.
+type objectMeta struct {
+	ObjectFlags  *string         `json:"objectFlags"`
+	SymFileFlags *string         `json:"symFileFlags"`
+	Connections  *expConnections `json:"connections"`
+}
+
+// expConnections is the @CONNECTIONS block that links a global variable list
+// to an external file.
+type expConnections struct {
+	Filename string   `json:"filename"`
+	Filetime string   `json:"filetime"`
+	Export   string   `json:"export"`
+	Entries  []string `json:"entries,omitempty"`
+}
+
+// readMetaSidecar loads the sidecar belonging to the .st file at path.
+// A missing sidecar yields an empty objectMeta.
+func readMetaSidecar(path string) (*objectMeta, error) {
+	metaPath := strings.TrimSuffix(path, filepath.Ext(path)) + ".meta.json"
+	meta := &objectMeta{}
+	raw, err := os.ReadFile(metaPath)
+	if os.IsNotExist(err) {
+		return meta, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, meta); err != nil {
+		return nil, fmt.Errorf("%s: %w", metaPath, err)
+	}
+	return meta, nil
+}
+
+// unencodableError reports source characters that the target code page
+// cannot represent.
+type unencodableError struct {
+	path     string
+	encoding string
+	chars    []codepage.EncodeError
+}
+
+func (e *unencodableError) Error() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "file %s contains characters not representable in %s:", e.path, e.encoding)
+	for _, c := range e.chars {
+		fmt.Fprintf(&sb, "\n  %s:%d:%d: %q (U+%04X)", e.path, c.Line, c.Col, c.Rune, c.Rune)
+	}
+	return sb.String()
+}
+
 // convertFile reads a single .st file and returns the corresponding EXP block(s).
 // A CONFIGURATION file may contain multiple VAR_GLOBAL sections, each becoming
 // a separate CoDeSys global variable list named after the CONFIGURATION.
-func convertFile(path, expPath string) (string, error) {
+func convertFile(path, expPath, encoding string) (string, error) {
 	raw, err := os.ReadFile(path)
 	if err != nil {
 		return "", fmt.Errorf("cannot read %s: %w", path, err)
 	}
+	raw = bytes.TrimPrefix(raw, []byte{0xEF, 0xBB, 0xBF})
+	if !utf8.Valid(raw) {
+		return "", fmt.Errorf("file %s is not valid UTF-8 – skipped", path)
+	}
+	if _, bad, err := codepage.Encode(string(raw), encoding); err != nil {
+		return "", err
+	} else if len(bad) > 0 {
+		return "", &unencodableError{path: path, encoding: encoding, chars: bad}
+	}
 
 	// Split into lines; normalize line endings to LF first, then handle as plain strings.
 	// Output always uses CRLF regardless of what the source file contains.
@@ -101,16 +180,21 @@ func convertFile(path, expPath string) (string, error) {
 
 	listName := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
 
+	meta, err := readMetaSidecar(path)
+	if err != nil {
+		return "", err
+	}
+
 	// CONFIGURATION: extract each VAR_GLOBAL block inside it.
 	if kind == kindConfiguration {
 		parts := strings.Fields(strings.TrimSpace(lines[0]))
 		if len(parts) >= 2 {
 			listName = parts[1]
 		}
-		return convertConfiguration(lines, listName, expPath)
+		return convertConfiguration(lines, listName, expPath, meta)
 	}
 
-	return convertPou(lines, kind, listName, expPath)
+	return convertPou(lines, kind, listName, expPath, meta)
 }
 
 // ensureEmptyVarBlock ensures a FUNCTION / FUNCTION_BLOCK / PROGRAM has at
@@ -146,7 +230,7 @@ func ensureEmptyVarBlock(lines []string) []string {
 
 // convertConfiguration extracts VAR_GLOBAL blocks from a CONFIGURATION wrapper
 // and renders each as a separate CoDeSys global variable list.
-func convertConfiguration(lines []string, listName, expPath string) (string, error) {
+func convertConfiguration(lines []string, listName, expPath string, meta *objectMeta) (string, error) {
 	var sb strings.Builder
 	inVarGlobal := false
 	var block []string
@@ -178,7 +262,7 @@ func convertConfiguration(lines []string, listName, expPath string) (string, err
 				for i, bl := range block {
 					block[i] = strings.TrimPrefix(bl, prefix)
 				}
-				chunk, err := convertPou(block, kindVarGlobal, listName, expPath)
+				chunk, err := convertPou(block, kindVarGlobal, listName, expPath, meta)
 				if err != nil {
 					return "", err
 				}
@@ -195,18 +279,30 @@ func convertConfiguration(lines []string, listName, expPath string) (string, err
 
 // convertPou renders a single POU (FUNCTION, FUNCTION_BLOCK, PROGRAM, TYPE, VAR_GLOBAL)
 // as a CoDeSys 2.3 EXP block.
-func convertPou(lines []string, kind pouKind, listName, expPath string) (string, error) {
+func convertPou(lines []string, kind pouKind, listName, expPath string, meta *objectMeta) (string, error) {
 	var sb strings.Builder
 
+	objectFlags := "0, 8"
+	if meta.ObjectFlags != nil {
+		objectFlags = *meta.ObjectFlags
+	}
+	symFileFlags := ""
+	if kind == kindFunction || kind == kindFunctionBlock || kind == kindProgram || kind == kindVarGlobal {
+		symFileFlags = "2048"
+	}
+	if meta.SymFileFlags != nil {
+		symFileFlags = *meta.SymFileFlags
+	}
+
 	// --- Metadata header ---
 	sb.WriteString("(* @NESTEDCOMMENTS := 'Yes' *)\r\n")
 	if kind == kindVarGlobal {
 		fmt.Fprintf(&sb, "(* @GLOBAL_VARIABLE_LIST := '%s' *)\r\n", listName)
 	}
 	fmt.Fprintf(&sb, "(* @PATH := '%s' *)\r\n", expPath)
-	sb.WriteString("(* @OBJECTFLAGS := '0, 8' *)\r\n")
-	if kind == kindFunction || kind == kindFunctionBlock || kind == kindProgram || kind == kindVarGlobal {
-		sb.WriteString("(* @SYMFILEFLAGS := '2048' *)\r\n")
+	fmt.Fprintf(&sb, "(* @OBJECTFLAGS := '%s' *)\r\n", objectFlags)
+	if symFileFlags != "" {
+		fmt.Fprintf(&sb, "(* @SYMFILEFLAGS := '%s' *)\r\n", symFileFlags)
 	}
 
 	switch kind {
@@ -244,11 +340,18 @@ func convertPou(lines []string, kind pouKind, listName, expPath string) (string,
 		}
 		sb.WriteString("\r\n")
 		fmt.Fprintf(&sb, "(* @OBJECT_END := '%s' *)\r\n", listName)
+		conn := meta.Connections
+		if conn == nil {
+			conn = &expConnections{Filetime: "0", Export: "0"}
+		}
 		fmt.Fprintf(&sb, "(* @CONNECTIONS := %s\r\n", listName)
-		sb.WriteString("FILENAME : ''\r\n")
-		sb.WriteString("FILETIME : 0\r\n")
-		sb.WriteString("EXPORT : 0\r\n")
-		sb.WriteString("NUMOFCONNECTIONS : 0\r\n")
+		fmt.Fprintf(&sb, "FILENAME : '%s'\r\n", conn.Filename)
+		fmt.Fprintf(&sb, "FILETIME : %s\r\n", conn.Filetime)
+		fmt.Fprintf(&sb, "EXPORT : %s\r\n", conn.Export)
+		fmt.Fprintf(&sb, "NUMOFCONNECTIONS : %d\r\n", len(conn.Entries))
+		for _, e := range conn.Entries {
+			sb.WriteString(e + "\r\n")
+		}
 		sb.WriteString("*)\r\n")
 	}
 
@@ -256,6 +359,44 @@ func convertPou(lines []string, kind pouKind, listName, expPath string) (string,
 	return sb.String(), nil
 }
 
+// ── Type check ────────────────────────────────────────────────────────────────
+
+// checkSources type-checks files with the st package before anything is
+// written. Names are resolved across every .st file below dir, so a single
+// exported file still sees the project's types and globals; only errors in
+// files are reported. It reports whether the files are clean.
+func checkSources(dir string, files []string) bool {
+	want := map[string]bool{}
+	paths := []string{dir}
+	absDir, _ := filepath.Abs(dir)
+	for _, f := range files {
+		abs, _ := filepath.Abs(f)
+		want[abs] = true
+		if rel, err := filepath.Rel(absDir, abs); err != nil || strings.HasPrefix(rel, "..") {
+			paths = append(paths, f)
+		}
+	}
+	proj, err := st.LoadProject(paths...)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		return false
+	}
+	typeErrs := proj.Check()
+	n := 0
+	for _, f := range proj.Files {
+		if abs, _ := filepath.Abs(f.Name); !want[abs] {
+			continue
+		}
+		list := append(append(st.ErrorList{}, proj.SyntaxErrors[f]...), typeErrs[f]...)
+		list.Sort()
+		for _, e := range list {
+			log.Printf("ERROR: %s:%d:%d: %s", f.Name, e.Pos.Line, e.Pos.Col, e.Msg)
+			n++
+		}
+	}
+	return n == 0
+}
+
 func main() {
 	log.SetFlags(0)
 	log.SetPrefix("st2exp23: ")
@@ -265,8 +406,11 @@ func main() {
 	outDir := flag.String("out", "build", "Output directory for the .EXP file")
 	name := flag.String("name", "export", "Base name of the output .EXP file")
 	expPath := flag.String("path", "", `CoDeSys PATH value for all objects, e.g. "\/MyLib"`)
+	encoding := flag.String("encoding", "windows-1252", "code page of the .EXP file (utf-8, windows-1252, windows-1250, iso-8859-1, iso-8859-15)")
+	check := flag.Bool("check", false, "type-check the sources and write nothing if there are errors")
+	tests := flag.Bool("tests", false, "include unit tests (directories named test)")
 	flag.Usage = func() {
-		fmt.Fprintln(os.Stderr, "st2exp23 - Convert IEC 61131-3 .st files to CoDeSys 2.3 .EXP format\n")
+		fmt.Fprint(os.Stderr, "st2exp23 - Convert IEC 61131-3 .st files to CoDeSys 2.3 .EXP format\n\n")
 		fmt.Fprintln(os.Stderr, "Usage:")
 		flag.PrintDefaults()
 		fmt.Fprintln(os.Stderr, "\nExamples:")
@@ -276,13 +420,21 @@ func main() {
 	}
 	flag.Parse()
 
+	if _, err := codepage.Normalize(*encoding); err != nil {
+		log.Fatal(err)
+	}
+
 	var stFiles []string
+	checkDir := *srcDir
 	if *srcFile != "" {
 		if _, err := os.Stat(*srcFile); os.IsNotExist(err) {
 			log.Fatalf("file %q does not exist", *srcFile)
 		}
 		stFiles = []string{*srcFile}
 		*srcDir = filepath.Dir(*srcFile)
+		if info, err := os.Stat(checkDir); err != nil || !info.IsDir() {
+			checkDir = *srcDir
+		}
 	} else {
 		if _, err := os.Stat(*srcDir); os.IsNotExist(err) {
 			log.Fatalf("source directory %q does not exist", *srcDir)
@@ -291,6 +443,10 @@ func main() {
 			if err != nil {
 				return err
 			}
+			if d.IsDir() && !*tests && p != *srcDir && strings.EqualFold(d.Name(), "test") {
+				fmt.Fprintf(os.Stderr, "NOTE: leaving out unit tests in %s (use -tests to export them)\n", p)
+				return filepath.SkipDir
+			}
 			if !d.IsDir() && strings.EqualFold(filepath.Ext(p), ".st") {
 				stFiles = append(stFiles, p)
 			}
@@ -305,6 +461,10 @@ func main() {
 	}
 	sort.Strings(stFiles)
 
+	if *check && !checkSources(checkDir, stFiles) {
+		log.Fatal("type check failed – nothing written")
+	}
+
 	if err := os.MkdirAll(*outDir, 0755); err != nil {
 		log.Fatalf("cannot create output directory %q: %v", *outDir, err)
 	}
@@ -313,7 +473,7 @@ func main() {
 
 	var all strings.Builder
 	all.WriteString("\r\n")
-	processed := 0
+	processed, unencodable := 0, 0
 
 	absSrc, err := filepath.Abs(*srcDir)
 	if err != nil {
@@ -332,7 +492,13 @@ func main() {
 		}
 
 		fmt.Printf("Processing: %-30s  PATH='%s'\n", filepath.Base(f), filePath)
-		block, err := convertFile(f, filePath)
+		block, err := convertFile(f, filePath, *encoding)
+		var ue *unencodableError
+		if errors.As(err, &ue) {
+			log.Printf("ERROR: %v", err)
+			unencodable++
+			continue
+		}
 		if err != nil {
 			log.Printf("WARNING: %v", err)
 			continue
@@ -341,13 +507,20 @@ func main() {
 		processed++
 	}
 
+	if unencodable > 0 {
+		log.Fatalf("%d file(s) contain characters not representable in %s – nothing written (use -encoding utf-8 or replace them)", unencodable, *encoding)
+	}
 	if processed == 0 {
 		log.Fatal("no files were successfully converted")
 	}
 
 	content := strings.TrimRight(all.String(), "\r\n") + "\r\n"
+	encoded, _, err := codepage.Encode(content, *encoding)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	if err := os.WriteFile(outPath, []byte(content), 0644); err != nil {
+	if err := os.WriteFile(outPath, encoded, 0644); err != nil {
 		log.Fatalf("cannot write output file: %v", err)
 	}
 
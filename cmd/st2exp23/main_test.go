@@ -0,0 +1,59 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestMain runs the command instead of the tests when RUN_MAIN is set, so
+// a test can start it as a subprocess with its own flags.
+func TestMain(m *testing.M) {
+	if os.Getenv("RUN_MAIN") != "" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// export runs st2exp23 on testdata/src and returns the export and stderr.
+func export(t *testing.T, args ...string) (out, stderr string) {
+	t.Helper()
+	dir := t.TempDir()
+	cmd := exec.Command(os.Args[0], append([]string{"-src", "../../testdata/src", "-out", dir}, args...)...)
+	cmd.Env = append(os.Environ(), "RUN_MAIN=1")
+	var errBuf strings.Builder
+	cmd.Stderr = &errBuf
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("%v\n%s", err, errBuf.String())
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*"))
+	if len(files) != 1 {
+		t.Fatalf("want one export file, got %v", files)
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data), errBuf.String()
+}
+
+// TestUnitTestsLeftOut checks that the POUs below test/ are exported only
+// with -tests.
+func TestUnitTestsLeftOut(t *testing.T) {
+	out, stderr := export(t)
+	if !strings.Contains(out, "SafeInvert") {
+		t.Fatal("SafeInvert missing from the export")
+	}
+	if strings.Contains(out, "FB_Test_SafeInvert") || strings.Contains(out, "AssertEquals") {
+		t.Error("unit tests exported without -tests")
+	}
+	if !strings.Contains(stderr, "NOTE: leaving out unit tests") {
+		t.Errorf("no note about the unit tests left out, stderr:\n%s", stderr)
+	}
+	if out, _ := export(t, "-tests"); !strings.Contains(out, "FB_Test_SafeInvert") {
+		t.Error("unit tests missing with -tests")
+	}
+}
@@ -14,6 +14,14 @@
 //	-out   output directory (default "build")
 //	-name  output filename without extension (default "export")
 //	-base  comma-separated CoDeSys tree base path (default "Device,PLC Logic,Application")
+//	-reproducible  derive GUIDs from -name and object paths, and fix timestamps
+//	-time          export timestamp in RFC 3339 format
+//	-check         type-check the sources first; write nothing on errors
+//
+// Timestamps are taken from -time, else from SOURCE_DATE_EPOCH when it is
+// set. With -reproducible and neither of them they are fixed to the Unix
+// epoch, so exporting the same source tree twice produces byte-identical
+// files.
 //
 // Object types detected from first code line:
 //
@@ -27,16 +35,26 @@
 // Directory structure below -src maps to CoDeSys tree path:
 //
 //	src/UserCode/Handlers/Foo.st → base + ["UserCode","Handlers"] path
+//
+// A <name>.meta.json sidecar next to a .st file or folder (as written by
+// exp2st35) restores the object's GUID, timestamp and build properties:
+//
+//	src/UserCode.meta.json           → GUID of folder UserCode
+//	src/UserCode/Handlers/Foo.meta.json → GUID and properties of Foo
 package main
 
 import (
-	"crypto/rand"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
+
+	"github.com/damischa1/iec-st-tools/repro"
+	"github.com/damischa1/iec-st-tools/st"
 )
 
 // ── CoDeSys 3.5 well-known type GUIDs ────────────────────────────────────────
@@ -59,19 +77,31 @@ const profileBlob = "AAEAAAD/////AQAAAAAAAAAMAgAAAAAAAAUBAAAAIVN5c3RlbS5Db2xsZWN
 
 // ── Helpers ───────────────────────────────────────────────────────────────────
 
-func newGUID() string {
-	b := make([]byte, 16)
-	_, _ = rand.Read(b)
-	b[6] = (b[6] & 0x0f) | 0x40
-	b[8] = (b[8] & 0x3f) | 0x80
-	return fmt.Sprintf("%08x-%04x-%04x-%04x-%012x",
-		b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
-}
+// guidNamespace is the UUIDv5 namespace for reproducible GUIDs, derived from
+// the project name. When nil, newGUID returns random (v4) GUIDs.
+var guidNamespace []byte
 
-func dotnetTicks() int64 {
-	const ticksPerSecond int64 = 10_000_000
+// buildTime is stamped into every object Timestamp.
+var buildTime = time.Now()
+
+// newGUID returns the GUID of the object identified by key, see repro.GUID.
+func newGUID(key string) string { return repro.GUID(guidNamespace, key) }
+
+// dotnetTicks returns the Timestamp of an object: the one from its sidecar,
+// or the export time when the sidecar has none.
+func dotnetTicks(sidecar int64) int64 {
 	const epochOffset int64 = 621355968000000000
-	return time.Now().UTC().UnixNano()/100 + epochOffset
+	if sidecar != 0 {
+		return sidecar
+	}
+	return buildTime.UTC().UnixNano()/100 + epochOffset
+}
+
+func dotnetBool(b bool) string {
+	if b {
+		return "True"
+	}
+	return "False"
 }
 
 func xmlEscape(s string) string {
@@ -200,6 +230,70 @@ type stObject struct {
 	decl      string
 	impl      string
 	pathParts []string
+	timestamp int64 // .NET ticks from the sidecar, 0 for the export time
+	props     *objectProps
+	meta      *objectMeta // sidecar contents, nil if none
+}
+
+// ── Metadata sidecars ─────────────────────────────────────────────────────────
+
+// objectProps holds the per-object build properties of a CoDeSys 3.5 object.
+type objectProps struct {
+	ExcludeFromBuild             bool     `json:"excludeFromBuild"`
+	External                     bool     `json:"external"`
+	EnableSystemCall             bool     `json:"enableSystemCall"`
+	LinkAlways                   bool     `json:"linkAlways"`
+	CompilerDefines              string   `json:"compilerDefines"`
+	MemoryReserveForOnlineChange int      `json:"memoryReserveForOnlineChange"`
+	Undefines                    []string `json:"undefines,omitempty"`
+}
+
+// objectMeta is the part of a .meta.json sidecar used by st2exp35. The
+// parent of an object is always taken from the folder layout below -src so
+// that moved objects get the right parent; the recorded parentGuid of
+// root-level objects restores the StructuredView GUID.
+type objectMeta struct {
+	GUID       string       `json:"guid"`
+	ParentGUID string       `json:"parentGuid"`
+	Timestamp  int64        `json:"timestamp"`
+	Properties *objectProps `json:"properties"`
+}
+
+// readMetaSidecar loads the sidecar at path. A missing file is not an error.
+func readMetaSidecar(path string) (*objectMeta, error) {
+	raw, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var m objectMeta
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &m, nil
+}
+
+// applyFolderMeta restores folder GUIDs from <folder>.meta.json sidecars.
+func applyFolderMeta(f *folderNode, dir string) error {
+	for _, key := range sortedKeys(f.children) {
+		child := f.children[key]
+		m, err := readMetaSidecar(filepath.Join(dir, key+".meta.json"))
+		if err != nil {
+			return err
+		}
+		if m != nil && m.GUID != "" {
+			child.guid = m.GUID
+		}
+		if m != nil {
+			child.timestamp = m.Timestamp
+		}
+		if err := applyFolderMeta(child, filepath.Join(dir, key)); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (o *stObject) typeGUID() string {
@@ -223,16 +317,18 @@ func (o *stObject) embeddedGuids() []string {
 // ── Folder tree ───────────────────────────────────────────────────────────────
 
 type folderNode struct {
-	guid     string
-	name     string
-	parent   *folderNode
-	children map[string]*folderNode
-	objects  []*stObject
+	guid      string
+	timestamp int64 // .NET ticks from the sidecar, 0 for the export time
+	name      string
+	parent    *folderNode
+	children  map[string]*folderNode
+	objects   []*stObject
 }
 
 func newFolderNode(name string, parent *folderNode) *folderNode {
+	key := "folder:" + strings.Join(append(codeysFolderPath(nil, parent), name), "/")
 	return &folderNode{
-		guid:     newGUID(),
+		guid:     newGUID(key),
 		name:     name,
 		parent:   parent,
 		children: make(map[string]*folderNode),
@@ -268,7 +364,10 @@ func writePathArray(w *os.File, codeysParts []string) {
 	fmt.Fprintf(w, "      </Array>\n")
 }
 
-func writePropertiesForObject(w *os.File, parentSVGuid string, parentGUID string) {
+func writePropertiesForObject(w *os.File, props *objectProps, parentSVGuid string, parentGUID string) {
+	if props == nil {
+		props = &objectProps{}
+	}
 	fmt.Fprintf(w, "        <Dictionary Type=\"{2c41fa04-1834-41c1-816e-303c7aa2c05b}\" Name=\"Properties\">\n")
 	fmt.Fprintf(w, "          <Entry>\n")
 	fmt.Fprintf(w, "            <Key>\n")
@@ -276,13 +375,21 @@ func writePropertiesForObject(w *os.File, parentSVGuid string, parentGUID string
 	fmt.Fprintf(w, "            </Key>\n")
 	fmt.Fprintf(w, "            <Value>\n")
 	fmt.Fprintf(w, "              <Single Type=\"{24568a24-c491-472c-a21f-ee5d33859fab}\" Method=\"IArchivable\">\n")
-	fmt.Fprintf(w, "                <Single Name=\"MemoryReserveForOnlineChange\" Type=\"int\">0</Single>\n")
-	fmt.Fprintf(w, "                <Single Name=\"ExcludeFromBuild\" Type=\"bool\">False</Single>\n")
-	fmt.Fprintf(w, "                <Single Name=\"External\" Type=\"bool\">False</Single>\n")
-	fmt.Fprintf(w, "                <Single Name=\"EnableSystemCall\" Type=\"bool\">False</Single>\n")
-	fmt.Fprintf(w, "                <Single Name=\"CompilerDefines\" Type=\"string\"></Single>\n")
-	fmt.Fprintf(w, "                <Single Name=\"LinkAlways\" Type=\"bool\">False</Single>\n")
-	fmt.Fprintf(w, "                <Array Name=\"Undefines\" Type=\"string\" />\n")
+	fmt.Fprintf(w, "                <Single Name=\"MemoryReserveForOnlineChange\" Type=\"int\">%d</Single>\n", props.MemoryReserveForOnlineChange)
+	fmt.Fprintf(w, "                <Single Name=\"ExcludeFromBuild\" Type=\"bool\">%s</Single>\n", dotnetBool(props.ExcludeFromBuild))
+	fmt.Fprintf(w, "                <Single Name=\"External\" Type=\"bool\">%s</Single>\n", dotnetBool(props.External))
+	fmt.Fprintf(w, "                <Single Name=\"EnableSystemCall\" Type=\"bool\">%s</Single>\n", dotnetBool(props.EnableSystemCall))
+	fmt.Fprintf(w, "                <Single Name=\"CompilerDefines\" Type=\"string\">%s</Single>\n", xmlEscape(props.CompilerDefines))
+	fmt.Fprintf(w, "                <Single Name=\"LinkAlways\" Type=\"bool\">%s</Single>\n", dotnetBool(props.LinkAlways))
+	if len(props.Undefines) == 0 {
+		fmt.Fprintf(w, "                <Array Name=\"Undefines\" Type=\"string\" />\n")
+	} else {
+		fmt.Fprintf(w, "                <Array Name=\"Undefines\" Type=\"string\">\n")
+		for _, u := range props.Undefines {
+			fmt.Fprintf(w, "                  <Single Type=\"string\">%s</Single>\n", xmlEscape(u))
+		}
+		fmt.Fprintf(w, "                </Array>\n")
+	}
 	fmt.Fprintf(w, "              </Single>\n")
 	fmt.Fprintf(w, "            </Value>\n")
 	fmt.Fprintf(w, "          </Entry>\n")
@@ -353,7 +460,7 @@ func writeFolderEntry(w *os.File, f *folderNode, svRootGUID string, base []strin
 	fmt.Fprintf(w, "        </Dictionary>\n")
 	fmt.Fprintf(w, "        <Single Name=\"TypeGuid\" Type=\"System.Guid\">%s</Single>\n", tFolder)
 	fmt.Fprintf(w, "        <Null Name=\"EmbeddedTypeGuids\" />\n")
-	fmt.Fprintf(w, "        <Single Name=\"Timestamp\" Type=\"long\">%d</Single>\n", dotnetTicks())
+	fmt.Fprintf(w, "        <Single Name=\"Timestamp\" Type=\"long\">%d</Single>\n", dotnetTicks(f.timestamp))
 	fmt.Fprintf(w, "      </Single>\n")
 	fmt.Fprintf(w, "      <Single Name=\"Object\" Type=\"{%s}\" Method=\"IArchivable\">\n", tFolder)
 	fmt.Fprintf(w, "        <Single Name=\"StructuredViewGuid\" Type=\"System.Guid\">%s</Single>\n", svRootGUID)
@@ -370,7 +477,7 @@ func writeObjectEntry(w *os.File, obj *stObject, parentFolder *folderNode, svRoo
 		parentFolderGUID = parentFolder.guid
 	}
 	tyGUID := obj.typeGUID()
-	ts := dotnetTicks()
+	ts := dotnetTicks(obj.timestamp)
 	codeyPath := append(base, obj.pathParts...)
 
 	fmt.Fprintf(w, "    <Single Type=\"{6198ad31-4b98-445c-927f-3258a0e82fe3}\" Method=\"IArchivable\">\n")
@@ -379,7 +486,7 @@ func writeObjectEntry(w *os.File, obj *stObject, parentFolder *folderNode, svRoo
 	fmt.Fprintf(w, "        <Single Name=\"Guid\" Type=\"System.Guid\">%s</Single>\n", obj.guid)
 	fmt.Fprintf(w, "        <Single Name=\"ParentGuid\" Type=\"System.Guid\">%s</Single>\n", parentFolderGUID)
 	fmt.Fprintf(w, "        <Single Name=\"Name\" Type=\"string\">%s</Single>\n", xmlEscape(obj.name))
-	writePropertiesForObject(w, svRootGUID, parentFolderGUID)
+	writePropertiesForObject(w, obj.props, svRootGUID, parentFolderGUID)
 	fmt.Fprintf(w, "        <Single Name=\"TypeGuid\" Type=\"System.Guid\">%s</Single>\n", tyGUID)
 	embGuids := obj.embeddedGuids()
 	fmt.Fprintf(w, "        <Array Name=\"EmbeddedTypeGuids\" Type=\"System.Guid\">\n")
@@ -488,14 +595,52 @@ func convertFile(stPath, srcRoot string) (*stObject, error) {
 		decl = src
 	}
 
-	return &stObject{
-		guid:      newGUID(),
+	obj := &stObject{
+		guid:      newGUID("object:" + strings.Join(pathParts, "/")),
 		name:      name,
 		kind:      kind,
 		decl:      strings.TrimRight(decl, "\n") + "\n",
 		impl:      strings.TrimRight(impl, "\n") + "\n",
 		pathParts: pathParts,
-	}, nil
+	}
+
+	meta, err := readMetaSidecar(strings.TrimSuffix(stPath, filepath.Ext(stPath)) + ".meta.json")
+	if err != nil {
+		return nil, err
+	}
+	if meta != nil {
+		if meta.GUID != "" {
+			obj.guid = meta.GUID
+		}
+		obj.timestamp = meta.Timestamp
+		obj.props = meta.Properties
+		obj.meta = meta
+	}
+	return obj, nil
+}
+
+// ── Type check ────────────────────────────────────────────────────────────────
+
+// checkSources type-checks the .st files to be exported with the st package
+// before anything is written and prints syntax and type errors. It reports
+// whether the sources are clean.
+func checkSources(files []string) bool {
+	proj, err := st.LoadProject(files...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "cannot check sources:", err)
+		return false
+	}
+	typeErrs := proj.Check()
+	n := 0
+	for _, f := range proj.Files {
+		list := append(append(st.ErrorList{}, proj.SyntaxErrors[f]...), typeErrs[f]...)
+		list.Sort()
+		for _, e := range list {
+			fmt.Fprintf(os.Stderr, "%s:%d:%d: %s\n", f.Name, e.Pos.Line, e.Pos.Col, e.Msg)
+			n++
+		}
+	}
+	return n == 0
 }
 
 // ── Main ──────────────────────────────────────────────────────────────────────
@@ -505,13 +650,27 @@ func main() {
 	outDir := flag.String("out", "build", "output directory")
 	outName := flag.String("name", "export", "output filename (without extension)")
 	basePath := flag.String("base", "Device,PLC Logic,Application", "comma-separated CoDeSys tree base path")
+	reproducible := flag.Bool("reproducible", false, "derive GUIDs from -name and object paths, and fix timestamps")
+	at := flag.String("time", "", "export timestamp in RFC 3339 format; overrides SOURCE_DATE_EPOCH")
+	check := flag.Bool("check", false, "type-check the sources and write nothing if there are errors")
+	tests := flag.Bool("tests", false, "include unit tests (directories named test)")
 	flag.Usage = func() {
-		fmt.Fprintln(os.Stderr, "st2exp35 - Convert IEC 61131-3 .st files to CoDeSys 3.5 .export XML format\n")
+		fmt.Fprint(os.Stderr, "st2exp35 - Convert IEC 61131-3 .st files to CoDeSys 3.5 .export XML format\n\n")
 		fmt.Fprintln(os.Stderr, "Usage:")
 		flag.PrintDefaults()
 	}
 	flag.Parse()
 
+	var err error
+	buildTime, err = repro.BuildTime(*at, *reproducible)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *reproducible {
+		guidNamespace = repro.Namespace(*outName)
+	}
+
 	base := strings.Split(*basePath, ",")
 	for i, b := range base {
 		base[i] = strings.TrimSpace(b)
@@ -519,6 +678,10 @@ func main() {
 
 	var files []string
 	_ = filepath.Walk(*srcDir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.IsDir() && !*tests && path != *srcDir && strings.EqualFold(info.Name(), "test") {
+			fmt.Fprintf(os.Stderr, "NOTE: leaving out unit tests in %s (use -tests to export them)\n", path)
+			return filepath.SkipDir
+		}
 		if err == nil && !info.IsDir() && strings.ToLower(filepath.Ext(path)) == ".st" {
 			files = append(files, path)
 		}
@@ -529,9 +692,15 @@ func main() {
 		fmt.Fprintln(os.Stderr, "no .st files found in", *srcDir)
 		os.Exit(1)
 	}
+	sort.Strings(files)
+
+	if *check && !checkSources(files) {
+		fmt.Fprintln(os.Stderr, "type check failed, nothing written")
+		os.Exit(1)
+	}
 
 	syntheticRoot := newFolderNode("", nil)
-	svRootGUID := newGUID()
+	svRootGUID := newGUID("structuredview")
 
 	var allObjs []*stObject
 	for _, f := range files {
@@ -548,6 +717,17 @@ func main() {
 			filepath.Base(f), kindName(obj.kind), strings.Join(obj.pathParts, "/"))
 	}
 
+	if err := applyFolderMeta(syntheticRoot, *srcDir); err != nil {
+		fmt.Fprintln(os.Stderr, "cannot read folder metadata:", err)
+		os.Exit(1)
+	}
+	for _, obj := range syntheticRoot.objects {
+		if obj.meta != nil && obj.meta.ParentGUID != "" && obj.meta.ParentGUID != "00000000-0000-0000-0000-000000000000" {
+			svRootGUID = obj.meta.ParentGUID
+			break
+		}
+	}
+
 	if err := os.MkdirAll(*outDir, 0755); err != nil {
 		fmt.Fprintln(os.Stderr, "cannot create output dir:", err)
 		os.Exit(1)
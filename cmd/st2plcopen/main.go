@@ -15,6 +15,14 @@
 //	-out     output directory (default "build")
 //	-name    output filename without extension (default "plcopen_export")
 //	-company company name in file header (default "iec-st-tools")
+//	-reproducible  derive ObjectIds from -name and object paths, and fix timestamps
+//	-time          export timestamp in RFC 3339 format
+//	-check         type-check the sources first; write nothing on errors
+//
+// Timestamps are taken from -time, else from SOURCE_DATE_EPOCH when it is
+// set. With -reproducible and neither of them they are fixed to the Unix
+// epoch, so exporting the same source tree twice produces byte-identical
+// files.
 //
 // Object types detected from first code line:
 //
@@ -28,14 +36,18 @@ package main
 
 import (
 	"bufio"
-	"crypto/rand"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
+
+	"github.com/damischa1/iec-st-tools/repro"
+	"github.com/damischa1/iec-st-tools/st"
 )
 
 // crlfWriter wraps an io.Writer and converts \n to \r\n.
@@ -78,17 +90,38 @@ func xmlEscape(s string) string {
 	return s
 }
 
+// guidNamespace is the UUIDv5 namespace for reproducible ObjectIds, derived
+// from the project name. When nil, newGUID returns random (v4) GUIDs.
+var guidNamespace []byte
+
+// buildTime is stamped into the file and content headers.
+var buildTime = time.Now()
+
 func nowISO() string {
-	return time.Now().Format("2006-01-02T15:04:05.0000000")
+	return buildTime.Format("2006-01-02T15:04:05.0000000")
 }
 
-func newGUID() string {
-	b := make([]byte, 16)
-	_, _ = rand.Read(b)
-	b[6] = (b[6] & 0x0f) | 0x40 // version 4
-	b[8] = (b[8] & 0x3f) | 0x80 // variant 1
-	return fmt.Sprintf("%08x-%04x-%04x-%04x-%012x",
-		b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+// newGUID returns the GUID of the object identified by key, see repro.GUID.
+func newGUID(key string) string { return repro.GUID(guidNamespace, key) }
+
+// sidecarGUID returns the ObjectId recorded in the .meta.json sidecar of the
+// .st file at path by plcopen2st or exp2st35, or "" when there is none.
+func sidecarGUID(path string) (string, error) {
+	metaPath := strings.TrimSuffix(path, filepath.Ext(path)) + ".meta.json"
+	raw, err := os.ReadFile(metaPath)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	var m struct {
+		GUID string `json:"guid"`
+	}
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return "", fmt.Errorf("%s: %w", metaPath, err)
+	}
+	return m.GUID, nil
 }
 
 // ── Source classification ─────────────────────────────────────────────────────
@@ -917,6 +950,30 @@ func sortedKeys(m map[string]*projFolder) []string {
 	return keys
 }
 
+// ── Type check ────────────────────────────────────────────────────────────────
+
+// checkSources type-checks the .st files to be exported with the st package
+// before anything is written and prints syntax and type errors. It reports
+// whether the sources are clean.
+func checkSources(files []string) bool {
+	proj, err := st.LoadProject(files...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "cannot check sources:", err)
+		return false
+	}
+	typeErrs := proj.Check()
+	n := 0
+	for _, f := range proj.Files {
+		list := append(append(st.ErrorList{}, proj.SyntaxErrors[f]...), typeErrs[f]...)
+		list.Sort()
+		for _, e := range list {
+			fmt.Fprintf(os.Stderr, "%s:%d:%d: %s\n", f.Name, e.Pos.Line, e.Pos.Col, e.Msg)
+			n++
+		}
+	}
+	return n == 0
+}
+
 // ── Main ──────────────────────────────────────────────────────────────────────
 
 func main() {
@@ -924,16 +981,34 @@ func main() {
 	outDir := flag.String("out", "build", "output directory")
 	outName := flag.String("name", "plcopen_export", "output filename (without extension)")
 	company := flag.String("company", "iec-st-tools", "company name in file header")
+	reproducible := flag.Bool("reproducible", false, "derive ObjectIds from -name and object paths, and fix timestamps")
+	at := flag.String("time", "", "export timestamp in RFC 3339 format; overrides SOURCE_DATE_EPOCH")
+	check := flag.Bool("check", false, "type-check the sources and write nothing if there are errors")
+	tests := flag.Bool("tests", false, "include unit tests (directories named test)")
 	flag.Usage = func() {
-		fmt.Fprintln(os.Stderr, "st2plcopen — Convert IEC 61131-3 .st files to PLCOpen XML (TC6) format\n")
+		fmt.Fprint(os.Stderr, "st2plcopen — Convert IEC 61131-3 .st files to PLCOpen XML (TC6) format\n\n")
 		fmt.Fprintln(os.Stderr, "Usage:")
 		flag.PrintDefaults()
 	}
 	flag.Parse()
 
+	var err error
+	buildTime, err = repro.BuildTime(*at, *reproducible)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *reproducible {
+		guidNamespace = repro.Namespace(*outName)
+	}
+
 	// Walk source files
 	var files []string
 	_ = filepath.Walk(*srcDir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.IsDir() && !*tests && path != *srcDir && strings.EqualFold(info.Name(), "test") {
+			fmt.Fprintf(os.Stderr, "NOTE: leaving out unit tests in %s (use -tests to export them)\n", path)
+			return filepath.SkipDir
+		}
 		if err == nil && !info.IsDir() && strings.ToLower(filepath.Ext(path)) == ".st" {
 			files = append(files, path)
 		}
@@ -944,6 +1019,12 @@ func main() {
 		fmt.Fprintln(os.Stderr, "no .st files found in", *srcDir)
 		os.Exit(1)
 	}
+	sort.Strings(files)
+
+	if *check && !checkSources(files) {
+		fmt.Fprintln(os.Stderr, "type check failed, nothing written")
+		os.Exit(1)
+	}
 
 	// Parse all files
 	var pous []*stObject
@@ -958,7 +1039,12 @@ func main() {
 			continue
 		}
 
-		obj.objectID = newGUID()
+		obj.objectID = newGUID("object:" + strings.Join(obj.pathParts, "/"))
+		if id, err := sidecarGUID(f); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		} else if id != "" {
+			obj.objectID = id
+		}
 
 		folderParts := obj.pathParts[:len(obj.pathParts)-1]
 		folder := ensureProjPath(projRoot, folderParts)
@@ -985,7 +1071,12 @@ func main() {
 			if duts[i].rawDecl == "" {
 				duts[i].rawDecl = obj.rawSource
 			}
-			duts[i].objectID = newGUID()
+			duts[i].objectID = newGUID("type:" + strings.Join(obj.pathParts, "/") + "/" + duts[i].name)
+		}
+		// plcopen2st writes each data type to a file of its own, whose
+		// sidecar holds the ObjectId of that type.
+		if len(duts) == 1 && duts[0].name == obj.name && obj.objectID != "" {
+			duts[0].objectID = obj.objectID
 		}
 		allDUTs = append(allDUTs, duts...)
 	}
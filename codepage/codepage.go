@@ -0,0 +1,227 @@
+// Package codepage converts CoDeSys 2.3 EXP files between UTF-8 and the
+// single-byte Windows ANSI code pages CoDeSys 2.3 reads and writes them in.
+package codepage
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// UTF8 is the canonical name of UTF-8, which needs no conversion.
+const UTF8 = "utf-8"
+
+type codePage struct {
+	name  string     // canonical name
+	table *[128]rune // bytes 0x80–0xFF; nil for UTF-8
+}
+
+// codePages lists the supported encodings by every accepted spelling. Bytes
+// that are undefined in a code page are U+FFFD in its table.
+var codePages = map[string]codePage{
+	"utf-8":        {UTF8, nil},
+	"utf8":         {UTF8, nil},
+	"windows-1252": {"windows-1252", &cp1252},
+	"cp1252":       {"windows-1252", &cp1252},
+	"windows-1250": {"windows-1250", &cp1250},
+	"cp1250":       {"windows-1250", &cp1250},
+	"iso-8859-1":   {"iso-8859-1", &iso88591},
+	"latin1":       {"iso-8859-1", &iso88591},
+	"iso-8859-15":  {"iso-8859-15", &iso885915},
+	"latin9":       {"iso-8859-15", &iso885915},
+}
+
+func lookup(name string) (codePage, error) {
+	if cp, ok := codePages[strings.ToLower(strings.TrimSpace(name))]; ok {
+		return cp, nil
+	}
+	return codePage{}, fmt.Errorf("unsupported encoding %q (use utf-8, windows-1252, windows-1250, iso-8859-1 or iso-8859-15)", name)
+}
+
+// Normalize returns the canonical name of an encoding, so that e.g. "utf8",
+// "UTF-8" and "utf-8" compare equal.
+func Normalize(name string) (string, error) {
+	cp, err := lookup(name)
+	return cp.name, err
+}
+
+// Decode converts raw EXP bytes to a UTF-8 string. Input that starts with a
+// UTF-8 BOM, or is valid UTF-8 containing non-ASCII characters, is detected as
+// UTF-8 and passed through; the returned name is the canonical name of the
+// encoding actually used. Bytes that are undefined in the code page are
+// reported as warnings and mapped to the C1 control character of the same
+// value, as Windows does.
+func Decode(raw []byte, encoding string) (text, used string, warnings []string, err error) {
+	cp, err := lookup(encoding)
+	if err != nil {
+		return "", "", nil, err
+	}
+	if bytes.HasPrefix(raw, []byte{0xEF, 0xBB, 0xBF}) {
+		return string(raw[3:]), UTF8, nil, nil
+	}
+	if cp.table == nil || (utf8.Valid(raw) && hasNonASCII(raw)) {
+		if !utf8.Valid(raw) {
+			return "", "", nil, fmt.Errorf("input is not valid UTF-8")
+		}
+		return string(raw), UTF8, nil, nil
+	}
+
+	var sb strings.Builder
+	sb.Grow(len(raw))
+	line := 1
+	for _, b := range raw {
+		switch {
+		case b == '\n':
+			line++
+			sb.WriteByte(b)
+		case b < 0x80:
+			sb.WriteByte(b)
+		default:
+			r := cp.table[b-0x80]
+			if r == utf8.RuneError {
+				warnings = append(warnings, fmt.Sprintf("line %d: byte 0x%02X is undefined in %s", line, b, cp.name))
+				r = rune(b)
+			}
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String(), cp.name, warnings, nil
+}
+
+func hasNonASCII(b []byte) bool {
+	for _, c := range b {
+		if c >= 0x80 {
+			return true
+		}
+	}
+	return false
+}
+
+// EncodeError describes a character that the target code page cannot
+// represent.
+type EncodeError struct {
+	Line, Col int
+	Rune      rune
+}
+
+// Encode converts UTF-8 text to the named encoding. Characters that cannot be
+// represented are written as '?' and returned, so that the caller can report
+// them.
+func Encode(text, encoding string) ([]byte, []EncodeError, error) {
+	cp, err := lookup(encoding)
+	if err != nil {
+		return nil, nil, err
+	}
+	if cp.table == nil {
+		return []byte(text), nil, nil
+	}
+	reverse := make(map[rune]byte, 128)
+	for i, r := range cp.table {
+		if r != utf8.RuneError {
+			reverse[r] = byte(0x80 + i)
+		}
+	}
+
+	out := make([]byte, 0, len(text))
+	var bad []EncodeError
+	line, col := 1, 0
+	for _, r := range text {
+		col++
+		switch {
+		case r == '\n':
+			line, col = line+1, 0
+			out = append(out, '\n')
+		case r < 0x80:
+			out = append(out, byte(r))
+		default:
+			if b, ok := reverse[r]; ok {
+				out = append(out, b)
+			} else {
+				bad = append(bad, EncodeError{Line: line, Col: col, Rune: r})
+				out = append(out, '?')
+			}
+		}
+	}
+	return out, bad, nil
+}
+
+// cp1252 maps bytes 0x80–0xFF of Windows-1252 (Western European) to Unicode.
+var cp1252 = [128]rune{
+	0x20AC, 0xFFFD, 0x201A, 0x0192, 0x201E, 0x2026, 0x2020, 0x2021,
+	0x02C6, 0x2030, 0x0160, 0x2039, 0x0152, 0xFFFD, 0x017D, 0xFFFD,
+	0xFFFD, 0x2018, 0x2019, 0x201C, 0x201D, 0x2022, 0x2013, 0x2014,
+	0x02DC, 0x2122, 0x0161, 0x203A, 0x0153, 0xFFFD, 0x017E, 0x0178,
+	0x00A0, 0x00A1, 0x00A2, 0x00A3, 0x00A4, 0x00A5, 0x00A6, 0x00A7,
+	0x00A8, 0x00A9, 0x00AA, 0x00AB, 0x00AC, 0x00AD, 0x00AE, 0x00AF,
+	0x00B0, 0x00B1, 0x00B2, 0x00B3, 0x00B4, 0x00B5, 0x00B6, 0x00B7,
+	0x00B8, 0x00B9, 0x00BA, 0x00BB, 0x00BC, 0x00BD, 0x00BE, 0x00BF,
+	0x00C0, 0x00C1, 0x00C2, 0x00C3, 0x00C4, 0x00C5, 0x00C6, 0x00C7,
+	0x00C8, 0x00C9, 0x00CA, 0x00CB, 0x00CC, 0x00CD, 0x00CE, 0x00CF,
+	0x00D0, 0x00D1, 0x00D2, 0x00D3, 0x00D4, 0x00D5, 0x00D6, 0x00D7,
+	0x00D8, 0x00D9, 0x00DA, 0x00DB, 0x00DC, 0x00DD, 0x00DE, 0x00DF,
+	0x00E0, 0x00E1, 0x00E2, 0x00E3, 0x00E4, 0x00E5, 0x00E6, 0x00E7,
+	0x00E8, 0x00E9, 0x00EA, 0x00EB, 0x00EC, 0x00ED, 0x00EE, 0x00EF,
+	0x00F0, 0x00F1, 0x00F2, 0x00F3, 0x00F4, 0x00F5, 0x00F6, 0x00F7,
+	0x00F8, 0x00F9, 0x00FA, 0x00FB, 0x00FC, 0x00FD, 0x00FE, 0x00FF,
+}
+
+// cp1250 maps bytes 0x80–0xFF of Windows-1250 (Central European) to Unicode.
+var cp1250 = [128]rune{
+	0x20AC, 0xFFFD, 0x201A, 0xFFFD, 0x201E, 0x2026, 0x2020, 0x2021,
+	0xFFFD, 0x2030, 0x0160, 0x2039, 0x015A, 0x0164, 0x017D, 0x0179,
+	0xFFFD, 0x2018, 0x2019, 0x201C, 0x201D, 0x2022, 0x2013, 0x2014,
+	0xFFFD, 0x2122, 0x0161, 0x203A, 0x015B, 0x0165, 0x017E, 0x017A,
+	0x00A0, 0x02C7, 0x02D8, 0x0141, 0x00A4, 0x0104, 0x00A6, 0x00A7,
+	0x00A8, 0x00A9, 0x015E, 0x00AB, 0x00AC, 0x00AD, 0x00AE, 0x017B,
+	0x00B0, 0x00B1, 0x02DB, 0x0142, 0x00B4, 0x00B5, 0x00B6, 0x00B7,
+	0x00B8, 0x0105, 0x015F, 0x00BB, 0x013D, 0x02DD, 0x013E, 0x017C,
+	0x0154, 0x00C1, 0x00C2, 0x0102, 0x00C4, 0x0139, 0x0106, 0x00C7,
+	0x010C, 0x00C9, 0x0118, 0x00CB, 0x011A, 0x00CD, 0x00CE, 0x010E,
+	0x0110, 0x0143, 0x0147, 0x00D3, 0x00D4, 0x0150, 0x00D6, 0x00D7,
+	0x0158, 0x016E, 0x00DA, 0x0170, 0x00DC, 0x00DD, 0x0162, 0x00DF,
+	0x0155, 0x00E1, 0x00E2, 0x0103, 0x00E4, 0x013A, 0x0107, 0x00E7,
+	0x010D, 0x00E9, 0x0119, 0x00EB, 0x011B, 0x00ED, 0x00EE, 0x010F,
+	0x0111, 0x0144, 0x0148, 0x00F3, 0x00F4, 0x0151, 0x00F6, 0x00F7,
+	0x0159, 0x016F, 0x00FA, 0x0171, 0x00FC, 0x00FD, 0x0163, 0x02D9,
+}
+
+// iso885915 maps bytes 0x80–0xFF of ISO-8859-15 (Latin-9) to Unicode.
+var iso885915 = [128]rune{
+	0x0080, 0x0081, 0x0082, 0x0083, 0x0084, 0x0085, 0x0086, 0x0087,
+	0x0088, 0x0089, 0x008A, 0x008B, 0x008C, 0x008D, 0x008E, 0x008F,
+	0x0090, 0x0091, 0x0092, 0x0093, 0x0094, 0x0095, 0x0096, 0x0097,
+	0x0098, 0x0099, 0x009A, 0x009B, 0x009C, 0x009D, 0x009E, 0x009F,
+	0x00A0, 0x00A1, 0x00A2, 0x00A3, 0x20AC, 0x00A5, 0x0160, 0x00A7,
+	0x0161, 0x00A9, 0x00AA, 0x00AB, 0x00AC, 0x00AD, 0x00AE, 0x00AF,
+	0x00B0, 0x00B1, 0x00B2, 0x00B3, 0x017D, 0x00B5, 0x00B6, 0x00B7,
+	0x017E, 0x00B9, 0x00BA, 0x00BB, 0x0152, 0x0153, 0x0178, 0x00BF,
+	0x00C0, 0x00C1, 0x00C2, 0x00C3, 0x00C4, 0x00C5, 0x00C6, 0x00C7,
+	0x00C8, 0x00C9, 0x00CA, 0x00CB, 0x00CC, 0x00CD, 0x00CE, 0x00CF,
+	0x00D0, 0x00D1, 0x00D2, 0x00D3, 0x00D4, 0x00D5, 0x00D6, 0x00D7,
+	0x00D8, 0x00D9, 0x00DA, 0x00DB, 0x00DC, 0x00DD, 0x00DE, 0x00DF,
+	0x00E0, 0x00E1, 0x00E2, 0x00E3, 0x00E4, 0x00E5, 0x00E6, 0x00E7,
+	0x00E8, 0x00E9, 0x00EA, 0x00EB, 0x00EC, 0x00ED, 0x00EE, 0x00EF,
+	0x00F0, 0x00F1, 0x00F2, 0x00F3, 0x00F4, 0x00F5, 0x00F6, 0x00F7,
+	0x00F8, 0x00F9, 0x00FA, 0x00FB, 0x00FC, 0x00FD, 0x00FE, 0x00FF,
+}
+
+// iso88591 maps bytes 0x80–0xFF of ISO-8859-1 (Latin-1) to Unicode.
+var iso88591 = [128]rune{
+	0x0080, 0x0081, 0x0082, 0x0083, 0x0084, 0x0085, 0x0086, 0x0087,
+	0x0088, 0x0089, 0x008A, 0x008B, 0x008C, 0x008D, 0x008E, 0x008F,
+	0x0090, 0x0091, 0x0092, 0x0093, 0x0094, 0x0095, 0x0096, 0x0097,
+	0x0098, 0x0099, 0x009A, 0x009B, 0x009C, 0x009D, 0x009E, 0x009F,
+	0x00A0, 0x00A1, 0x00A2, 0x00A3, 0x00A4, 0x00A5, 0x00A6, 0x00A7,
+	0x00A8, 0x00A9, 0x00AA, 0x00AB, 0x00AC, 0x00AD, 0x00AE, 0x00AF,
+	0x00B0, 0x00B1, 0x00B2, 0x00B3, 0x00B4, 0x00B5, 0x00B6, 0x00B7,
+	0x00B8, 0x00B9, 0x00BA, 0x00BB, 0x00BC, 0x00BD, 0x00BE, 0x00BF,
+	0x00C0, 0x00C1, 0x00C2, 0x00C3, 0x00C4, 0x00C5, 0x00C6, 0x00C7,
+	0x00C8, 0x00C9, 0x00CA, 0x00CB, 0x00CC, 0x00CD, 0x00CE, 0x00CF,
+	0x00D0, 0x00D1, 0x00D2, 0x00D3, 0x00D4, 0x00D5, 0x00D6, 0x00D7,
+	0x00D8, 0x00D9, 0x00DA, 0x00DB, 0x00DC, 0x00DD, 0x00DE, 0x00DF,
+	0x00E0, 0x00E1, 0x00E2, 0x00E3, 0x00E4, 0x00E5, 0x00E6, 0x00E7,
+	0x00E8, 0x00E9, 0x00EA, 0x00EB, 0x00EC, 0x00ED, 0x00EE, 0x00EF,
+	0x00F0, 0x00F1, 0x00F2, 0x00F3, 0x00F4, 0x00F5, 0x00F6, 0x00F7,
+	0x00F8, 0x00F9, 0x00FA, 0x00FB, 0x00FC, 0x00FD, 0x00FE, 0x00FF,
+}
@@ -0,0 +1,57 @@
+package codepage
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	for in, want := range map[string]string{
+		"utf8": UTF8, "UTF-8": UTF8, " utf-8 ": UTF8,
+		"CP1252": "windows-1252", "latin9": "iso-8859-15",
+	} {
+		got, err := Normalize(in)
+		if err != nil || got != want {
+			t.Errorf("Normalize(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := Normalize("koi8-r"); err == nil {
+		t.Error("Normalize(koi8-r): no error")
+	}
+}
+
+func TestDecodeDetectsUTF8(t *testing.T) {
+	tests := []struct {
+		raw      string
+		encoding string
+		text     string
+		used     string
+	}{
+		{"\xEF\xBB\xBFTÄ", "utf8", "TÄ", UTF8},
+		{"\xEF\xBB\xBFTÄ", "windows-1252", "TÄ", UTF8},
+		{"TÄ", "windows-1252", "TÄ", UTF8},
+		{"T\xC4", "cp1252", "TÄ", "windows-1252"},
+		{"T", "CP1252", "T", "windows-1252"},
+	}
+	for _, tt := range tests {
+		text, used, _, err := Decode([]byte(tt.raw), tt.encoding)
+		if err != nil || text != tt.text || used != tt.used {
+			t.Errorf("Decode(%q, %s) = %q, %s, %v; want %q, %s", tt.raw, tt.encoding, text, used, err, tt.text, tt.used)
+		}
+	}
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	const text = "Größe: 5 €\nŠ"
+	for _, enc := range []string{"windows-1252", "iso-8859-15"} {
+		raw, bad, err := Encode(text, enc)
+		if err != nil || len(bad) != 0 {
+			t.Fatalf("Encode(%s): %v, %v", enc, bad, err)
+		}
+		back, _, _, err := Decode(raw, enc)
+		if err != nil || back != text {
+			t.Errorf("%s round trip: got %q, %v", enc, back, err)
+		}
+	}
+	_, bad, _ := Encode("a\nbŁ", "windows-1252")
+	if len(bad) != 1 || bad[0] != (EncodeError{Line: 2, Col: 2, Rune: 'Ł'}) {
+		t.Errorf("unencodable characters = %v", bad)
+	}
+}
@@ -0,0 +1,539 @@
+package interp
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/damischa1/iec-st-tools/st"
+)
+
+// ── Names ─────────────────────────────────────────────────────────────────────
+
+// resolve returns the symbol an identifier, member access or enumeration
+// literal names in frame f, cached per expression.
+func (m *Machine) resolve(f *frame, e st.Expr) *st.Symbol {
+	if sym, ok := m.syms[e]; ok {
+		return sym
+	}
+	sym := f.scope.Resolve(e)
+	m.syms[e] = sym
+	return sym
+}
+
+// typeOf returns the static type of e in frame f, cached per expression.
+func (m *Machine) typeOf(f *frame, e st.Expr) *st.Type {
+	t := m.types[e]
+	if t == nil {
+		t = f.scope.TypeOf(e)
+		m.types[e] = t
+	}
+	return t
+}
+
+// cell returns the variable e denotes, following references.
+func (m *Machine) cell(f *frame, e st.Expr) *value { return m.deref(m.slot(f, e)) }
+
+// deref follows REFERENCE TO variables and VAR_IN_OUT bindings.
+func (m *Machine) deref(v *value) *value {
+	for v.t.Class == st.PointerClass && v.t.Ref {
+		if v.ptr == nil {
+			m.fail("reference is not bound")
+		}
+		v = v.ptr
+	}
+	return v
+}
+
+// slot returns the storage of a variable expression without following a
+// reference it holds.
+func (m *Machine) slot(f *frame, e st.Expr) *value {
+	switch e := e.(type) {
+	case *st.Ident:
+		sym := m.resolve(f, e)
+		if sym == nil {
+			m.failAt(e, "undeclared identifier %s", e.Name)
+		}
+		switch sym.Kind {
+		case st.VarSymbol:
+			key := strings.ToUpper(e.Name)
+			if key == "THIS" || key == "SUPER" {
+				if f.this == nil {
+					m.failAt(e, "%s outside a function block", e.Name)
+				}
+				return &value{t: sym.Type, ptr: f.this}
+			}
+			if v := f.lookup(key); v != nil {
+				return v
+			}
+		case st.GlobalSymbol:
+			return m.global(sym)
+		case st.EnumValueSymbol:
+			return &value{t: sym.Type, i: sym.Member.Value}
+		case st.POUSymbol:
+			if sym.POU.Kind == st.Program {
+				return m.program(sym.POU)
+			}
+		}
+		m.failAt(e, "%s is not a variable", e.Name)
+	case *st.MemberExpr:
+		if isBitNumber(e.Name.Name) {
+			m.failAt(e.Name, "bit %s of %s is not a variable", e.Name.Name, st.ExprString(e.X))
+		}
+		if sym := m.resolve(f, e); sym != nil {
+			switch sym.Kind {
+			case st.GlobalSymbol:
+				return m.global(sym)
+			case st.EnumValueSymbol:
+				return &value{t: sym.Type, i: sym.Member.Value}
+			}
+		}
+		x := m.cell(f, e.X)
+		v := x.fields[strings.ToUpper(e.Name.Name)]
+		if v == nil {
+			m.failAt(e.Name, "%s has no member %s", x.t.Name, e.Name.Name)
+		}
+		return v
+	case *st.IndexExpr:
+		x := m.cell(f, e.X)
+		switch x.t.Class {
+		case st.ArrayClass:
+			idx := make([]int64, len(e.Indices))
+			for i, ie := range e.Indices {
+				idx[i] = m.toInt(m.eval(f, ie))
+			}
+			m.pos = e.Pos()
+			return m.element(x, idx)
+		case st.StringClass:
+			// read-only: the character code at a 0-based position
+			i := m.toInt(m.eval(f, e.Indices[0]))
+			rs := runes(x.s, x.t.Wide)
+			if i < 0 || i >= int64(len(rs)) {
+				m.failAt(e, "index %d out of range of %s", i, st.ExprString(e.X))
+			}
+			return &value{t: m.typeOf(f, e), i: int64(rs[i])}
+		}
+		m.failAt(e, "%s is not an array", st.ExprString(e.X))
+	case *st.DerefExpr:
+		p := m.cell(f, e.X)
+		if p.t.Class != st.PointerClass {
+			m.failAt(e, "%s is not a pointer", st.ExprString(e.X))
+		}
+		if p.ptr == nil {
+			m.failAt(e, "null pointer dereference of %s", st.ExprString(e.X))
+		}
+		return m.pointee(p, e)
+	case *st.ParenExpr:
+		return m.slot(f, e.X)
+	case *st.AddressExpr:
+		return m.address(e.Text, m.typeOf(f, e))
+	}
+	m.failAt(e, "%s is not a variable", st.ExprString(e))
+	return nil
+}
+
+// pointee returns the variable pointer p points to, as the type p points
+// to. A pointer to a scalar of the same size but another type, such as a
+// POINTER TO DWORD at a REAL, reinterprets its bits as the PLC does; other
+// mismatches fail rather than convert the value.
+func (m *Machine) pointee(p *value, e *st.DerefExpr) *value {
+	target, elem := p.ptr, p.t.Elem
+	if elem == nil || elem.Class == st.AnyClass || st.Identical(elem, target.t) {
+		return target
+	}
+	switch target.t.Class {
+	case st.ArrayClass, st.StructClass, st.InstanceClass, st.StringClass:
+		if st.Convert(elem, target.t) != st.ConvIncompatible {
+			return target // base FB or structure, other bounds or length
+		}
+	}
+	if w := bitWidth(elem); w == 0 || w != bitWidth(target.t) {
+		m.failAt(e, "%s points to %s, which cannot be read as %s", st.ExprString(e.X), target.t.Name, elem.Name)
+	}
+	v := fromBits(rawBits(target), elem)
+	v.alias = target
+	return v
+}
+
+// element returns the array element at the given indices.
+func (m *Machine) element(x *value, idx []int64) *value {
+	if len(idx) != len(x.t.Dims) {
+		m.fail("%s has %d dimensions, not %d", x.t.Name, len(x.t.Dims), len(idx))
+	}
+	off := int64(0)
+	for k, d := range x.t.Dims {
+		if !d.Known {
+			m.fail("bounds of %s are not constant", x.t.Name)
+		}
+		if idx[k] < d.Lo || idx[k] > d.Hi {
+			m.fail("index %d out of range [%d..%d]", idx[k], d.Lo, d.Hi)
+		}
+		off = off*d.Len() + idx[k] - d.Lo
+	}
+	return x.elems[off]
+}
+
+func isBitNumber(s string) bool {
+	_, err := strconv.Atoi(s)
+	return err == nil
+}
+
+// bitNumber returns the bit of x.n, checked against the width of x.
+func (m *Machine) bitNumber(x *value, e *st.MemberExpr) int64 {
+	n, _ := strconv.Atoi(e.Name.Name)
+	bits, _ := intInfo(x.t)
+	if !x.t.IsInteger() || n >= bits {
+		m.failAt(e.Name, "bit %d out of range for %s", n, x.t.Name)
+	}
+	return int64(n)
+}
+
+// ── Expressions ───────────────────────────────────────────────────────────────
+
+// eval evaluates an expression. Variables are returned as their storage,
+// which callers must not modify; store copies.
+func (m *Machine) eval(f *frame, e st.Expr) *value {
+	switch e := e.(type) {
+	case *st.Literal:
+		return m.literal(f, e)
+	case *st.Ident, *st.IndexExpr, *st.DerefExpr, *st.AddressExpr, *st.EnumLiteral:
+		if el, ok := e.(*st.EnumLiteral); ok {
+			sym := m.resolve(f, el)
+			if sym == nil || sym.Member == nil {
+				m.failAt(el, "%s has no value %s", el.Type.Name, el.Value.Name)
+			}
+			return &value{t: sym.Type, i: sym.Member.Value}
+		}
+		return m.cell(f, e)
+	case *st.MemberExpr:
+		if isBitNumber(e.Name.Name) {
+			x := m.eval(f, e.X)
+			n := m.bitNumber(x, e)
+			return boolValue(x.i>>n&1 != 0)
+		}
+		return m.cell(f, e)
+	case *st.ParenExpr:
+		return m.eval(f, e.X)
+	case *st.UnaryExpr:
+		return m.unary(f, e)
+	case *st.BinaryExpr:
+		return m.binary(f, e)
+	case *st.CallExpr:
+		return m.call(f, e)
+	}
+	m.failAt(e, "cannot evaluate %s", st.ExprString(e))
+	return nil
+}
+
+// literal returns the value of a literal, cached per literal.
+func (m *Machine) literal(f *frame, e *st.Literal) *value {
+	if v := m.literals[e]; v != nil {
+		return v
+	}
+	t := m.typeOf(f, e)
+	v := &value{t: t}
+	ok := true
+	switch e.Kind {
+	case st.KEYWORD:
+		b, _ := e.Bool()
+		v = boolValue(b)
+	case st.INT:
+		if b, isBool := e.Bool(); isBool {
+			v = boolValue(b)
+			break
+		}
+		var n int64
+		n, ok = e.Int()
+		if t.Class == st.RealClass {
+			v.f = float64(n)
+		} else {
+			v.i = wrap(n, t)
+		}
+	case st.REAL:
+		v.f, ok = e.Real()
+		if t.Class != st.RealClass {
+			v.i = wrap(int64(v.f), t)
+		}
+	case st.STRING, st.WSTRING:
+		v.s, _ = e.Str()
+	case st.TIME:
+		if t.Class == st.TimeClass {
+			var d time.Duration
+			d, ok = e.Duration()
+			v.i = int64(d)
+		} else {
+			v.i, ok = dateLiteral(e)
+		}
+	default:
+		ok = false
+	}
+	if !ok {
+		m.failAt(e, "invalid literal %s", e.Text)
+	}
+	m.literals[e] = v
+	return v
+}
+
+// dateLiteral returns D#, TOD# and DT# literals in nanoseconds since 1970
+// or, for times of day, since midnight.
+func dateLiteral(e *st.Literal) (int64, bool) {
+	text := e.Text[strings.IndexByte(e.Text, '#')+1:]
+	var layouts []string
+	switch e.TypePrefix() {
+	case "D", "DATE", "LD", "LDATE":
+		layouts = []string{"2006-01-02"}
+	case "TOD", "TIME_OF_DAY", "LTOD":
+		layouts = []string{"15:04:05", "15:04"}
+	case "DT", "DATE_AND_TIME", "LDT":
+		layouts = []string{"2006-01-02-15:04:05", "2006-01-02-15:04"}
+	}
+	for _, l := range layouts {
+		if t, err := time.ParseInLocation(l, text, time.UTC); err == nil {
+			if l[0] == '1' {
+				return int64(t.Sub(time.Date(0, 1, 1, 0, 0, 0, 0, time.UTC))), true
+			}
+			return t.UnixNano(), true
+		}
+	}
+	return 0, false
+}
+
+func (m *Machine) unary(f *frame, e *st.UnaryExpr) *value {
+	x := m.eval(f, e.X)
+	t := m.typeOf(f, e)
+	switch e.Op {
+	case "NOT":
+		if t.Class == st.BoolClass {
+			return boolValue(!m.truth(x))
+		}
+		return &value{t: t, i: wrap(^m.toInt(x), t)}
+	case "-":
+		switch t.Class {
+		case st.RealClass:
+			return &value{t: t, f: -m.toFloat(x)}
+		case st.TimeClass:
+			return &value{t: t, i: -x.i}
+		}
+		return &value{t: t, i: wrap(-m.toInt(x), t)}
+	}
+	return x
+}
+
+func (m *Machine) binary(f *frame, e *st.BinaryExpr) *value {
+	switch e.Op {
+	case "AND_THEN":
+		return boolValue(m.truth(m.eval(f, e.X)) && m.truth(m.eval(f, e.Y)))
+	case "OR_ELSE":
+		return boolValue(m.truth(m.eval(f, e.X)) || m.truth(m.eval(f, e.Y)))
+	}
+	x, y := m.eval(f, e.X), m.eval(f, e.Y)
+	m.pos = e.OpPos
+	switch e.Op {
+	case "=":
+		return boolValue(m.equal(x, y))
+	case "<>":
+		return boolValue(!m.equal(x, y))
+	case "<":
+		return boolValue(m.compare(x, y) < 0)
+	case ">":
+		return boolValue(m.compare(x, y) > 0)
+	case "<=":
+		return boolValue(m.compare(x, y) <= 0)
+	case ">=":
+		return boolValue(m.compare(x, y) >= 0)
+	}
+	return m.arith(e.Op, x, y, m.typeOf(f, e))
+}
+
+// arith applies an arithmetic or bitwise operator, giving a value of the
+// result type t. Integer results wrap to t.
+func (m *Machine) arith(op string, x, y *value, t *st.Type) *value {
+	switch t.Class {
+	case st.BoolClass:
+		a, b := m.truth(x), m.truth(y)
+		switch op {
+		case "AND":
+			return boolValue(a && b)
+		case "OR":
+			return boolValue(a || b)
+		case "XOR":
+			return boolValue(a != b)
+		}
+	case st.RealClass:
+		a, b := m.toFloat(x), m.toFloat(y)
+		var r float64
+		switch op {
+		case "+":
+			r = a + b
+		case "-":
+			r = a - b
+		case "*":
+			r = a * b
+		case "/":
+			r = a / b
+		case "**":
+			r = math.Pow(a, b)
+		default:
+			m.fail("operator %s not defined on %s", op, t.Name)
+		}
+		return m.convert(&value{t: st.TypeLReal, f: r}, t)
+	case st.IntClass, st.BitsClass, st.EnumClass, st.CharClass:
+		a, b := m.toInt(x), m.toInt(y)
+		_, signed := intInfo(t)
+		var r int64
+		switch op {
+		case "+":
+			r = a + b
+		case "-":
+			r = a - b
+		case "*":
+			r = a * b
+		case "/", "MOD":
+			if b == 0 {
+				m.fail("integer division by zero")
+			}
+			switch {
+			case !signed && op == "/":
+				r = int64(uint64(a) / uint64(b))
+			case !signed:
+				r = int64(uint64(a) % uint64(b))
+			case op == "/":
+				r = a / b
+			default:
+				r = a % b
+			}
+		case "AND":
+			r = a & b
+		case "OR":
+			r = a | b
+		case "XOR":
+			r = a ^ b
+		default:
+			m.fail("operator %s not defined on %s", op, t.Name)
+		}
+		return &value{t: t, i: wrap(r, t)}
+	case st.TimeClass, st.DateClass:
+		return m.timeArith(op, x, y, t)
+	}
+	m.fail("operator %s not defined on %s and %s", op, x.t.Name, y.t.Name)
+	return nil
+}
+
+// timeArith computes TIME ± TIME, TIME * n, TIME / n and the date
+// differences. Plain numbers added to a TIME count milliseconds.
+func (m *Machine) timeArith(op string, x, y *value, t *st.Type) *value {
+	ns := func(v *value) int64 {
+		if isTime(v.t) {
+			return v.i
+		}
+		return m.toInt(v) * int64(time.Millisecond)
+	}
+	var r int64
+	switch op {
+	case "+":
+		r = ns(x) + ns(y)
+	case "-":
+		r = ns(x) - ns(y)
+	case "*", "/":
+		d, n := x, y
+		if !isTime(d.t) {
+			d, n = y, x
+		}
+		if n.t.Class == st.RealClass {
+			f := m.toFloat(n)
+			if op == "/" {
+				if f == 0 {
+					m.fail("division by zero")
+				}
+				f = 1 / f
+			}
+			r = int64(float64(d.i) * f)
+			break
+		}
+		k := m.toInt(n)
+		if isTime(n.t) && op == "/" {
+			k = n.i
+		}
+		if op == "*" {
+			r = d.i * k
+		} else {
+			if k == 0 {
+				m.fail("division by zero")
+			}
+			r = d.i / k
+		}
+	default:
+		m.fail("operator %s not defined on %s", op, t.Name)
+	}
+	return m.convert(&value{t: st.TypeLTime, i: r}, t)
+}
+
+// equal compares two values for = and <>.
+func (m *Machine) equal(x, y *value) bool {
+	if x.t.Class == st.PointerClass || y.t.Class == st.PointerClass {
+		return x.ptr == y.ptr && (x.t.Class == y.t.Class || m.toInt(x)|m.toInt(y) == 0)
+	}
+	return m.compare(x, y) == 0
+}
+
+// compare orders two elementary values.
+func (m *Machine) compare(x, y *value) int {
+	switch {
+	case x.t.Class == st.StringClass && y.t.Class == st.StringClass:
+		return strings.Compare(x.s, y.s)
+	case x.t.Class == st.RealClass || y.t.Class == st.RealClass:
+		a, b := m.toFloat(x), m.toFloat(y)
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+		return 0
+	case isComposite(x.t) || isComposite(y.t) || x.t.Class == st.StringClass || y.t.Class == st.StringClass:
+		m.fail("cannot compare %s with %s", x.t.Name, y.t.Name)
+	}
+	a, b := m.ordinal(x), m.ordinal(y)
+	if isTime(x.t) != isTime(y.t) {
+		// a plain number compared with a TIME counts milliseconds
+		if isTime(x.t) {
+			b *= int64(time.Millisecond)
+		} else {
+			a *= int64(time.Millisecond)
+		}
+	}
+	if unsigned64(x.t) && unsigned64(y.t) {
+		ua, ub := uint64(a), uint64(b)
+		switch {
+		case ua < ub:
+			return -1
+		case ua > ub:
+			return 1
+		}
+		return 0
+	}
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// ordinal is the integer a value is ordered by: nanoseconds for TIME and
+// the date types, the value itself for the others.
+func (m *Machine) ordinal(v *value) int64 {
+	if isTime(v.t) {
+		return v.i
+	}
+	return m.toInt(v)
+}
+
+func isTime(t *st.Type) bool { return t.Class == st.TimeClass || t.Class == st.DateClass }
+
+func unsigned64(t *st.Type) bool {
+	bits, signed := intInfo(t)
+	return bits >= 64 && !signed
+}
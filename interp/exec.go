@@ -0,0 +1,534 @@
+package interp
+
+import (
+	"strings"
+
+	"github.com/damischa1/iec-st-tools/st"
+)
+
+// ── Frames ────────────────────────────────────────────────────────────────────
+
+// frame is one activation of a POU body.
+type frame struct {
+	pou   *st.POU
+	scope *st.Scope
+	file  string
+	vars  map[string]*value // locals by upper-case name; VAR_IN_OUT as binding slots
+	this  *value            // FB or program instance of bodies and methods
+}
+
+// lookup returns the variable key of the frame: a local, then a variable of
+// the instance.
+func (f *frame) lookup(key string) *value {
+	if v := f.vars[key]; v != nil {
+		return v
+	}
+	if f.this != nil {
+		return f.this.fields[key]
+	}
+	return nil
+}
+
+func (m *Machine) scope(d *st.POU) *st.Scope {
+	s := m.scopes[d]
+	if s == nil {
+		s = m.Project.Scope(d)
+		m.scopes[d] = s
+	}
+	return s
+}
+
+func (m *Machine) fileName(s *st.Scope) string {
+	if s.File != nil {
+		return s.File.Name
+	}
+	return ""
+}
+
+// declType resolves the type of a variable declaration in scope s.
+func (m *Machine) declType(s *st.Scope, v *st.VarDecl) *st.Type {
+	t := m.declTypes[v]
+	if t == nil {
+		t = s.ResolveType(v.Type)
+		m.declTypes[v] = t
+	}
+	return t
+}
+
+// newFrame creates the frame of a FUNCTION or METHOD call: fresh local
+// variables with their initial values, the persistent VAR_STAT variables
+// and the result variable.
+func (m *Machine) newFrame(d *st.POU, this *value) *frame {
+	s := m.scope(d)
+	cf := &frame{pou: d, scope: s, file: m.fileName(s), vars: map[string]*value{}, this: this}
+	for _, b := range d.VarBlocks {
+		for _, v := range b.Vars {
+			t := m.declType(s, v)
+			for _, id := range v.Names {
+				key := strings.ToUpper(id.Name)
+				switch {
+				case b.Kind == "VAR_IN_OUT":
+					cf.vars[key] = &value{t: bindType}
+				case b.Kind == "VAR_STAT":
+					sv := m.statics[id]
+					if sv == nil {
+						sv = m.newValue(t)
+						if v.Init != nil {
+							m.initialize(sv, v.Init, cf)
+						}
+						m.statics[id] = sv
+					}
+					cf.vars[key] = sv
+				default:
+					cv := m.newValue(t)
+					if v.Init != nil {
+						m.initialize(cv, v.Init, cf)
+					}
+					cf.vars[key] = cv
+				}
+			}
+		}
+	}
+	if d.ReturnType != nil {
+		cf.vars[strings.ToUpper(d.Name.Name)] = m.newValue(s.ResolveType(d.ReturnType))
+	}
+	return cf
+}
+
+// instanceFrame creates the frame of an FB or program body. The instance
+// holds the variables; only VAR_TEMP starts fresh on every call.
+func (m *Machine) instanceFrame(d *st.POU, inst *value) *frame {
+	s := m.scope(d)
+	cf := &frame{pou: d, scope: s, file: m.fileName(s), this: inst}
+	for _, x := range chain(m.Project, d) {
+		for _, b := range x.VarBlocks {
+			if b.Kind != "VAR_TEMP" {
+				continue
+			}
+			if cf.vars == nil {
+				cf.vars = map[string]*value{}
+			}
+			for _, v := range b.Vars {
+				t := m.declType(m.scope(x), v)
+				for _, id := range v.Names {
+					cv := m.newValue(t)
+					if v.Init != nil {
+						m.initialize(cv, v.Init, cf)
+					}
+					cf.vars[strings.ToUpper(id.Name)] = cv
+				}
+			}
+		}
+	}
+	return cf
+}
+
+// chain returns d and the function blocks it extends, base first.
+func chain(p *st.Project, d *st.POU) []*st.POU {
+	out := []*st.POU{d}
+	for x := d; x.Extends != nil && len(out) < 16; {
+		if x = p.POU(x.Extends.Name); x == nil {
+			break
+		}
+		out = append([]*st.POU{x}, out...)
+	}
+	return out
+}
+
+// ── Signatures ────────────────────────────────────────────────────────────────
+
+// signature describes the parameters of a POU, including those inherited
+// from base function blocks.
+type signature struct {
+	inputs []string            // VAR_INPUT and VAR_IN_OUT keys in positional order
+	order  []string            // declared names of all variables
+	blocks map[string]string   // VAR block by upper-case name
+	types  map[string]*st.Type // declared type by upper-case name
+}
+
+func (m *Machine) signature(d *st.POU) *signature {
+	if sig := m.sigs[d]; sig != nil {
+		return sig
+	}
+	sig := &signature{blocks: map[string]string{}, types: map[string]*st.Type{}}
+	pous := []*st.POU{d}
+	if d.Kind == st.FunctionBlock || d.Kind == st.Program {
+		pous = chain(m.Project, d)
+	}
+	for _, x := range pous {
+		s := m.scope(x)
+		for _, b := range x.VarBlocks {
+			for _, v := range b.Vars {
+				for _, id := range v.Names {
+					key := strings.ToUpper(id.Name)
+					if b.Kind == "VAR_INPUT" || b.Kind == "VAR_IN_OUT" {
+						sig.inputs = append(sig.inputs, key)
+					}
+					sig.order = append(sig.order, id.Name)
+					sig.blocks[key] = b.Kind
+					sig.types[key] = m.declType(s, v)
+				}
+			}
+		}
+	}
+	m.sigs[d] = sig
+	return sig
+}
+
+// ── Statements ────────────────────────────────────────────────────────────────
+
+// flow tells how a statement list ended.
+type flow int
+
+const (
+	flowNext flow = iota
+	flowExit
+	flowContinue
+	flowReturn
+)
+
+// step counts a statement or loop iteration against the step limit.
+func (m *Machine) step(pos st.Pos) {
+	m.pos = pos
+	m.steps++
+	if m.MaxSteps > 0 && m.steps > m.MaxSteps {
+		m.fail("step limit of %d exceeded (endless loop?)", m.MaxSteps)
+	}
+}
+
+func (m *Machine) exec(f *frame, list []st.Stmt) flow {
+	for _, s := range list {
+		if fl := m.stmt(f, s); fl != flowNext {
+			return fl
+		}
+	}
+	return flowNext
+}
+
+func (m *Machine) stmt(f *frame, s st.Stmt) flow {
+	m.step(s.Pos())
+	switch s := s.(type) {
+	case *st.AssignStmt:
+		m.assign(f, s.Target, m.eval(f, s.Value))
+	case *st.CallStmt:
+		m.call(f, s.Call)
+	case *st.IfStmt:
+		if m.truth(m.eval(f, s.Cond)) {
+			return m.exec(f, s.Then)
+		}
+		for _, e := range s.Elsifs {
+			if m.truth(m.eval(f, e.Cond)) {
+				return m.exec(f, e.Body)
+			}
+		}
+		return m.exec(f, s.Else)
+	case *st.CaseStmt:
+		sel := m.toInt(m.eval(f, s.Selector))
+		for _, cl := range s.Cases {
+			for _, l := range cl.Labels {
+				if r, ok := l.(*st.RangeExpr); ok {
+					if m.toInt(m.eval(f, r.Lo)) <= sel && sel <= m.toInt(m.eval(f, r.Hi)) {
+						return m.exec(f, cl.Body)
+					}
+				} else if m.toInt(m.eval(f, l)) == sel {
+					return m.exec(f, cl.Body)
+				}
+			}
+		}
+		return m.exec(f, s.Else)
+	case *st.ForStmt:
+		return m.forStmt(f, s)
+	case *st.WhileStmt:
+		for m.truth(m.eval(f, s.Cond)) {
+			switch m.exec(f, s.Body) {
+			case flowExit:
+				return flowNext
+			case flowReturn:
+				return flowReturn
+			}
+			m.step(s.KwPos)
+		}
+	case *st.RepeatStmt:
+		for {
+			switch m.exec(f, s.Body) {
+			case flowExit:
+				return flowNext
+			case flowReturn:
+				return flowReturn
+			}
+			if m.truth(m.eval(f, s.Cond)) {
+				break
+			}
+			m.step(s.KwPos)
+		}
+	case *st.ExitStmt:
+		return flowExit
+	case *st.ContinueStmt:
+		return flowContinue
+	case *st.ReturnStmt:
+		return flowReturn
+	}
+	return flowNext
+}
+
+// forStmt runs a FOR loop. The bounds and step are evaluated once; the
+// counter wraps like any other variable, so a loop to the maximum of its
+// type does not end, as on the PLC.
+func (m *Machine) forStmt(f *frame, s *st.ForStmt) flow {
+	v := m.cell(f, s.Var)
+	m.store(v, m.eval(f, s.From))
+	to := m.toInt(m.eval(f, s.To))
+	by := int64(1)
+	if s.By != nil {
+		by = m.toInt(m.eval(f, s.By))
+	}
+	if by == 0 {
+		m.failAt(s.By, "FOR step is zero")
+	}
+	for {
+		i := m.toInt(v)
+		if by > 0 && i > to || by < 0 && i < to {
+			return flowNext
+		}
+		switch m.exec(f, s.Body) {
+		case flowExit:
+			return flowNext
+		case flowReturn:
+			return flowReturn
+		}
+		m.step(s.KwPos)
+		v.i = wrap(m.toInt(v)+by, v.t)
+		m.writeThrough(v)
+	}
+}
+
+// assign stores v in the variable target, which may be a bit (x.3).
+func (m *Machine) assign(f *frame, target st.Expr, v *value) {
+	if me, ok := target.(*st.MemberExpr); ok && isBitNumber(me.Name.Name) {
+		x := m.cell(f, me.X)
+		n := m.bitNumber(x, me)
+		bit := int64(0)
+		if m.truth(v) {
+			bit = 1
+		}
+		x.i = wrap(x.i&^(1<<n)|bit<<n, x.t)
+		m.writeThrough(x)
+		return
+	}
+	m.store(m.cell(f, target), v)
+}
+
+// ── Calls ─────────────────────────────────────────────────────────────────────
+
+// call evaluates a call of a function, method, FB instance or program and
+// returns its result; calls without a result return a VOID value.
+func (m *Machine) call(f *frame, e *st.CallExpr) *value {
+	switch fn := e.Func.(type) {
+	case *st.Ident:
+		sym := m.resolve(f, fn)
+		if sym == nil {
+			return m.stdCall(f, e, fn.Name)
+		}
+		switch sym.Kind {
+		case st.POUSymbol:
+			d := sym.POU
+			switch d.Kind {
+			case st.Function:
+				cf := m.newFrame(d, nil)
+				m.invoke(f, e, cf, d)
+				return cf.vars[strings.ToUpper(d.Name.Name)]
+			case st.Method:
+				if f.this == nil {
+					m.failAt(fn, "method %s called outside its function block", fn.Name)
+				}
+				if dm := f.this.t.Method(fn.Name); dm != nil {
+					d = dm
+				}
+				return m.callMethod(f, e, f.this, d)
+			case st.Program:
+				inst := m.program(d)
+				m.invoke(f, e, m.instanceFrame(d, inst), d)
+				return voidValue
+			}
+			m.failAt(fn, "%s is a function block type; call an instance of it", fn.Name)
+		case st.TypeSymbol:
+			m.failAt(fn, "%s is a type, not a function", fn.Name)
+		}
+	case *st.MemberExpr:
+		sym := m.resolve(f, fn)
+		if sym != nil && sym.Kind == st.POUSymbol && sym.POU.Kind == st.Method {
+			recv := m.cell(f, fn.X)
+			d := sym.POU
+			if !isSuper(fn.X) {
+				if dm := recv.t.Method(fn.Name.Name); dm != nil {
+					d = dm // dynamic dispatch on the instance's type
+				}
+			}
+			return m.callMethod(f, e, recv, d)
+		}
+	case *st.DerefExpr:
+		if isSuper(fn) {
+			// SUPER^() runs the body of the base function block
+			base := f.pou
+			if base != nil && base.Kind == st.Method {
+				base = m.Project.Owner(base)
+			}
+			if f.this == nil || base == nil || base.Extends == nil || m.Project.POU(base.Extends.Name) == nil {
+				m.failAt(fn, "SUPER^() outside a derived function block")
+			}
+			d := m.Project.POU(base.Extends.Name)
+			m.invoke(f, e, m.instanceFrame(d, f.this), d)
+			return voidValue
+		}
+	}
+	inst := m.cell(f, e.Func)
+	if inst.t.Class != st.InstanceClass {
+		m.failAt(e.Func, "%s is not a function block instance", st.ExprString(e.Func))
+	}
+	d := inst.t.POU
+	m.invoke(f, e, m.instanceFrame(d, inst), d)
+	return voidValue
+}
+
+func (m *Machine) callMethod(f *frame, e *st.CallExpr, recv *value, d *st.POU) *value {
+	if recv.t.Class != st.InstanceClass {
+		m.failAt(e.Func, "%s is not a function block instance", st.ExprString(e.Func))
+	}
+	cf := m.newFrame(d, recv)
+	m.invoke(f, e, cf, d)
+	if r := cf.vars[strings.ToUpper(d.Name.Name)]; r != nil {
+		return r
+	}
+	return voidValue
+}
+
+// isSuper reports whether e is SUPER^.
+func isSuper(e st.Expr) bool {
+	d, ok := e.(*st.DerefExpr)
+	if !ok {
+		return false
+	}
+	id, ok := d.X.(*st.Ident)
+	return ok && strings.EqualFold(id.Name, "SUPER")
+}
+
+// invoke binds the arguments of e, evaluated in the caller's frame f, to
+// the parameters in cf, runs d and copies the outputs given with => back.
+func (m *Machine) invoke(f *frame, e *st.CallExpr, cf *frame, d *st.POU) {
+	sig := m.signature(d)
+	var outs []*st.Arg
+	positional := 0
+	for _, a := range e.Args {
+		var key string
+		if a.Name == nil {
+			if positional >= len(sig.inputs) {
+				m.failAt(a.Value, "too many arguments in call of %s", d.Name.Name)
+			}
+			key = sig.inputs[positional]
+			positional++
+		} else {
+			key = strings.ToUpper(a.Name.Name)
+		}
+		if a.Output {
+			outs = append(outs, a)
+			continue
+		}
+		slot := cf.lookup(key)
+		if slot == nil || a.Value == nil {
+			m.failAt(e, "%s has no parameter %s", d.Name.Name, key)
+		}
+		switch {
+		case sig.blocks[key] == "VAR_IN_OUT":
+			slot.ptr = m.cell(f, a.Value)
+		case slot.t.Class == st.AnyClass:
+			// generic parameters take the type of the argument
+			x := m.eval(f, a.Value)
+			c := m.newValue(x.t)
+			m.store(c, x)
+			*slot = *c
+		default:
+			m.store(m.deref(slot), m.eval(f, a.Value))
+		}
+	}
+	m.run(cf, d)
+	for _, a := range outs {
+		if a.Value == nil {
+			continue
+		}
+		v := cf.lookup(strings.ToUpper(a.Name.Name))
+		if v == nil {
+			m.failAt(a.Name, "%s has no output %s", d.Name.Name, a.Name.Name)
+		}
+		v = m.deref(v)
+		if a.Not {
+			v = boolValue(!m.truth(v))
+		}
+		m.assign(f, a.Value, v)
+	}
+}
+
+// run executes the body of d in frame cf; standard function blocks run
+// natively.
+func (m *Machine) run(cf *frame, d *st.POU) {
+	if st.IsStandard(d) {
+		m.native(d, cf.this)
+		return
+	}
+	if fn := m.funcs[d]; fn != nil {
+		m.goCall(cf, d, fn)
+		return
+	}
+	if m.depth++; m.depth > maxDepth {
+		m.fail("calls nested deeper than %d (recursion?)", maxDepth)
+	}
+	file, pos := m.file, m.pos
+	m.file = cf.file
+	m.exec(cf, d.Body)
+	m.file, m.pos = file, pos
+	m.depth--
+}
+
+// program returns the instance of a PROGRAM, creating it on first use.
+func (m *Machine) program(d *st.POU) *value {
+	v := m.programs[d]
+	if v == nil {
+		v = m.newValue(m.Project.InstanceType(d))
+		m.programs[d] = v
+	}
+	return v
+}
+
+// global returns a global variable, creating and initialising it on first
+// use so initial values may refer to globals of other GVLs.
+func (m *Machine) global(sym *st.Symbol) *value {
+	key := strings.ToUpper(sym.Name)
+	if v := m.globals[key]; v != nil {
+		return v
+	}
+	if m.pending[key] {
+		m.fail("initial value of %s refers to itself", sym.Name)
+	}
+	m.pending[key] = true
+	defer delete(m.pending, key)
+	gs := m.Project.GlobalScope()
+	t := sym.Type
+	if t == nil {
+		t = m.declType(gs, sym.Decl)
+	}
+	v := m.newValue(t)
+	if sym.Decl != nil && sym.Decl.Init != nil {
+		f := &frame{scope: gs}
+		if sym.File != nil {
+			f.file = sym.File.Name
+		}
+		file := m.file
+		m.file = f.file
+		m.initialize(v, sym.Decl.Init, f)
+		m.file = file
+	}
+	if sym.Decl != nil && sym.Decl.At != nil {
+		v = m.locate(sym.Decl.At.Text, v)
+	}
+	m.globals[key] = v
+	return v
+}
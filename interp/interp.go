@@ -0,0 +1,467 @@
+// Package interp executes Structured Text: it runs the POUs of an st.Project
+// without a PLC, so FUNCTIONs and FUNCTION_BLOCKs can be unit tested from Go.
+//
+// Supported are the elementary types with the wrap-around of the PLC (every
+// integer operation wraps to its result type, so INT 32767 + 1 is -32768),
+// REAL arithmetic in single precision, STRING and WSTRING, TIME and the date
+// types, arrays, structures, enumerations, pointers and references, all
+// statements, FUNCTION calls, FUNCTION_BLOCK instances with persistent state,
+// methods with EXTENDS and SUPER, PROGRAMs, global variables, the standard
+// functions and the standard function blocks (TON, TOF, TP, R_TRIG, F_TRIG,
+// CTU, CTD, CTUD, SR, RS).
+//
+// Time does not pass by itself: timers read Machine.Now, which tests move
+// forward with Advance.
+//
+//	p, _ := st.LoadProject("src")
+//	m, _ := interp.New(p)
+//	res, _, err := m.Call("SafeInvert", map[string]any{"value": -32768})
+//	// res == int64(32767)
+//
+//	tmr, _ := m.NewInstance("TON")
+//	tmr.Call(map[string]any{"IN": true, "PT": time.Second})
+//	m.Advance(time.Second)
+//	out, _ := tmr.Call(map[string]any{"IN": true})
+//	// out["Q"] == true
+//
+// Values cross the Go boundary as bool, int64 (integers, bit strings,
+// characters), float64, string, time.Duration (TIME, LTIME, TOD), time.Time
+// (DATE, DT), the member name of enumerations, []any for arrays and
+// map[string]any for structures and instances. Inputs accept any Go integer
+// or float type where the ST type allows it.
+package interp
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/damischa1/iec-st-tools/st"
+)
+
+// ── Machine ───────────────────────────────────────────────────────────────────
+
+// DefaultMaxSteps is the default step limit of a Machine.
+const DefaultMaxSteps = 10_000_000
+
+// maxDepth limits nested calls, catching unbounded recursion.
+const maxDepth = 256
+
+// Machine holds the state of a running project: global variables, program
+// instances and the simulated clock.
+type Machine struct {
+	Project *st.Project
+
+	// Now is the simulated time since start, read by the timers.
+	Now time.Duration
+
+	// MaxSteps limits the statements and loop iterations one call may
+	// execute, so an endless loop fails instead of hanging. Zero means no
+	// limit.
+	MaxSteps int
+
+	globals  map[string]*value
+	pending  map[string]bool // globals whose initial value is being computed
+	programs map[*st.POU]*value
+	statics  map[*st.Ident]*value // VAR_STAT of functions and methods
+	io       map[string]*value    // direct addresses (%IX0.0) by upper-case text
+	funcs    map[*st.POU]GoFunc   // functions implemented in Go, see Define
+
+	scopes    map[*st.POU]*st.Scope
+	sigs      map[*st.POU]*signature
+	types     map[st.Expr]*st.Type
+	syms      map[st.Expr]*st.Symbol
+	declTypes map[*st.VarDecl]*st.Type
+	literals  map[*st.Literal]*value
+
+	steps int
+	depth int
+	file  string // file and position of the statement being executed
+	pos   st.Pos
+}
+
+// New returns a machine for p and initialises the global variables. The
+// project should be free of syntax and type errors (see st.Project.Check);
+// constructs the interpreter cannot execute fail when they are reached.
+func New(p *st.Project) (m *Machine, err error) {
+	m = &Machine{
+		Project:   p,
+		MaxSteps:  DefaultMaxSteps,
+		globals:   map[string]*value{},
+		pending:   map[string]bool{},
+		programs:  map[*st.POU]*value{},
+		statics:   map[*st.Ident]*value{},
+		io:        map[string]*value{},
+		funcs:     map[*st.POU]GoFunc{},
+		scopes:    map[*st.POU]*st.Scope{},
+		sigs:      map[*st.POU]*signature{},
+		types:     map[st.Expr]*st.Type{},
+		syms:      map[st.Expr]*st.Symbol{},
+		declTypes: map[*st.VarDecl]*st.Type{},
+		literals:  map[*st.Literal]*value{},
+	}
+	defer m.protect(&err)
+	for _, g := range p.Globals() {
+		m.global(g)
+	}
+	return m, nil
+}
+
+// Advance moves the simulated clock forward by d.
+func (m *Machine) Advance(d time.Duration) { m.Now += d }
+
+// Error is a run-time error: division by zero, an array index out of range,
+// a null pointer, the step limit, a construct the interpreter does not
+// support, or an error returned by a GoFunc.
+type Error struct {
+	File string
+	Pos  st.Pos
+	Msg  string
+	Err  error // the error of a GoFunc, nil otherwise
+}
+
+func (e *Error) Error() string {
+	if !e.Pos.IsValid() {
+		return e.Msg
+	}
+	return fmt.Sprintf("%s:%d:%d: %s", e.File, e.Pos.Line, e.Pos.Col, e.Msg)
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// fail aborts execution with an error at the current statement.
+func (m *Machine) fail(format string, args ...any) {
+	panic(&Error{File: m.file, Pos: m.pos, Msg: fmt.Sprintf(format, args...)})
+}
+
+// failAt aborts execution with an error at n.
+func (m *Machine) failAt(n st.Node, format string, args ...any) {
+	m.pos = n.Pos()
+	m.fail(format, args...)
+}
+
+// protect turns a run-time error raised by fail into err and resets the
+// per-call state. It is deferred by every exported entry point.
+func (m *Machine) protect(err *error) {
+	m.steps, m.depth, m.file, m.pos = 0, 0, "", st.Pos{}
+	if r := recover(); r != nil {
+		e, ok := r.(*Error)
+		if !ok {
+			panic(r)
+		}
+		*err = e
+	}
+}
+
+// ── Functions ─────────────────────────────────────────────────────────────────
+
+// GoFunc implements a FUNCTION in Go. args holds the VAR_INPUT values in
+// declaration order; the result is stored into the function result unless
+// it is nil. An error aborts execution at the calling statement.
+type GoFunc func(args []any) (any, error)
+
+// Define makes fn the implementation of the FUNCTION d, replacing its body.
+// d is usually declared without a body so calls type check; the assertion
+// functions of st.TestPOUs are defined this way by iecst test.
+func (m *Machine) Define(d *st.POU, fn GoFunc) {
+	m.funcs[d] = fn
+}
+
+// goCall runs the GoFunc of d in frame cf.
+func (m *Machine) goCall(cf *frame, d *st.POU, fn GoFunc) {
+	sig := m.signature(d)
+	var args []any
+	for _, p := range sig.order {
+		if key := strings.ToUpper(p); sig.blocks[key] == "VAR_INPUT" {
+			args = append(args, m.toGo(cf.vars[key]))
+		}
+	}
+	r, err := fn(args)
+	if err != nil {
+		panic(&Error{File: m.file, Pos: m.pos, Msg: err.Error(), Err: err})
+	}
+	if v := cf.vars[strings.ToUpper(d.Name.Name)]; v != nil && r != nil {
+		m.fromGo(v, r)
+	}
+}
+
+// Call runs the FUNCTION name once. args sets inputs and VAR_IN_OUT
+// parameters by name; inputs not given keep their initial values. It
+// returns the function result and the values of the VAR_OUTPUT and
+// VAR_IN_OUT parameters after the call.
+func (m *Machine) Call(name string, args map[string]any) (result any, outputs map[string]any, err error) {
+	d := m.Project.POU(name)
+	if d == nil || d.Kind != st.Function {
+		return nil, nil, fmt.Errorf("no FUNCTION %s", name)
+	}
+	defer m.protect(&err)
+	cf := m.newFrame(d, nil)
+	m.setArgs(cf, d, args)
+	m.run(cf, d)
+	if r := cf.vars[strings.ToUpper(d.Name.Name)]; r != nil {
+		result = m.toGo(r)
+	}
+	return result, m.outputs(cf, d), nil
+}
+
+// setArgs stores Go values into the parameters of a frame. VAR_IN_OUT
+// parameters are bound to fresh variables holding the value.
+func (m *Machine) setArgs(cf *frame, d *st.POU, args map[string]any) {
+	sig := m.signature(d)
+	for name, x := range args {
+		key := strings.ToUpper(name)
+		slot := cf.lookup(key)
+		switch sig.blocks[key] {
+		case "VAR_INPUT":
+			m.fromGo(m.deref(slot), x)
+		case "VAR_IN_OUT":
+			v := m.newValue(sig.types[key])
+			m.fromGo(v, x)
+			slot.ptr = v
+		case "":
+			m.fail("%s has no parameter %s", d.Name.Name, name)
+		default:
+			m.fail("%s is not an input of %s", name, d.Name.Name)
+		}
+	}
+}
+
+// outputs returns the VAR_OUTPUT and VAR_IN_OUT values of a frame by their
+// declared names.
+func (m *Machine) outputs(cf *frame, d *st.POU) map[string]any {
+	out := map[string]any{}
+	sig := m.signature(d)
+	for _, p := range sig.order {
+		switch sig.blocks[strings.ToUpper(p)] {
+		case "VAR_OUTPUT", "VAR_IN_OUT":
+			if v := cf.lookup(strings.ToUpper(p)); v != nil && (v.t != bindType || v.ptr != nil) {
+				out[p] = m.toGo(m.deref(v))
+			}
+		}
+	}
+	return out
+}
+
+// ── Instances ─────────────────────────────────────────────────────────────────
+
+// Instance is a FUNCTION_BLOCK or PROGRAM instance. Its variables keep their
+// values from one call to the next.
+type Instance struct {
+	m *Machine
+	v *value
+}
+
+// NewInstance creates an instance of the FUNCTION_BLOCK fb, a project block
+// or a standard one such as TON. fb may also name a PROGRAM, for a further
+// instance besides the one returned by Program.
+func (m *Machine) NewInstance(fb string) (inst *Instance, err error) {
+	d := m.Project.POU(fb)
+	if d == nil || d.Kind != st.FunctionBlock && d.Kind != st.Program {
+		return nil, fmt.Errorf("no FUNCTION_BLOCK %s", fb)
+	}
+	defer m.protect(&err)
+	return &Instance{m: m, v: m.newValue(m.Project.InstanceType(d))}, nil
+}
+
+// Program returns the instance of the PROGRAM name. There is one per
+// machine, shared with the code that calls the program.
+func (m *Machine) Program(name string) (inst *Instance, err error) {
+	d := m.Project.POU(name)
+	if d == nil || d.Kind != st.Program {
+		return nil, fmt.Errorf("no PROGRAM %s", name)
+	}
+	defer m.protect(&err)
+	return &Instance{m: m, v: m.program(d)}, nil
+}
+
+// POU returns the FUNCTION_BLOCK or PROGRAM of the instance.
+func (in *Instance) POU() *st.POU { return in.v.t.POU }
+
+// Call sets the inputs and VAR_IN_OUT parameters given in args, executes
+// the body once and returns the outputs and VAR_IN_OUT values.
+func (in *Instance) Call(args map[string]any) (outputs map[string]any, err error) {
+	m := in.m
+	defer m.protect(&err)
+	d := in.v.t.POU
+	cf := m.instanceFrame(d, in.v)
+	m.setArgs(cf, d, args)
+	m.run(cf, d)
+	return m.outputs(cf, d), nil
+}
+
+// Method calls the method name of the instance, dispatching on the
+// instance's type like inst.Name() in ST.
+func (in *Instance) Method(name string, args map[string]any) (result any, outputs map[string]any, err error) {
+	m := in.m
+	d := in.v.t.Method(name)
+	if d == nil {
+		return nil, nil, fmt.Errorf("%s has no method %s", in.v.t.Name, name)
+	}
+	defer m.protect(&err)
+	cf := m.newFrame(d, in.v)
+	m.setArgs(cf, d, args)
+	m.run(cf, d)
+	if r := cf.vars[strings.ToUpper(d.Name.Name)]; r != nil {
+		result = m.toGo(r)
+	}
+	return result, m.outputs(cf, d), nil
+}
+
+// Get returns the value of a variable of the instance. path may reach into
+// structures, instances and arrays: Motor.Speed, Table[2].Value.
+func (in *Instance) Get(path string) (x any, err error) {
+	defer in.m.protect(&err)
+	return in.m.toGo(in.m.walk(in.v, path)), nil
+}
+
+// Set assigns a variable of the instance, including internal ones, which
+// lets a test prepare a state.
+func (in *Instance) Set(path string, x any) (err error) {
+	defer in.m.protect(&err)
+	in.m.fromGo(in.m.walk(in.v, path), x)
+	return nil
+}
+
+// ── Globals ───────────────────────────────────────────────────────────────────
+
+// Get returns the value of a global variable, of a program variable or of a
+// direct address: G_Count, GVL_Main.G_Count, PLC_PRG.state,
+// G_Motors[1].Speed, %QX0.1.
+func (m *Machine) Get(path string) (x any, err error) {
+	defer m.protect(&err)
+	return m.toGo(m.rootPath(path)), nil
+}
+
+// Set assigns a global or program variable or a direct address.
+func (m *Machine) Set(path string, x any) (err error) {
+	defer m.protect(&err)
+	m.fromGo(m.rootPath(path), x)
+	return nil
+}
+
+// Eval evaluates an expression over the global state: literals, globals,
+// program variables, direct addresses and the operators and functions
+// between them.
+func (m *Machine) Eval(expr string) (x any, err error) {
+	e, err := st.ParseExpr(expr)
+	if err != nil {
+		return nil, err
+	}
+	defer m.protect(&err)
+	return m.toGo(m.eval(&frame{scope: m.Project.GlobalScope()}, e)), nil
+}
+
+// rootPath resolves a path whose first element is a global variable, a GVL
+// or a program, or a path that is a direct address.
+func (m *Machine) rootPath(path string) *value {
+	if addr := strings.TrimSpace(path); strings.HasPrefix(addr, "%") {
+		return m.address(addr, m.Project.GlobalScope().TypeOf(&st.AddressExpr{Text: addr}))
+	}
+	name, rest := splitPath(path)
+	sym := m.Project.GlobalScope().Lookup(name)
+	switch {
+	case sym == nil:
+	case sym.Kind == st.GlobalSymbol:
+		return m.walk(m.global(sym), rest)
+	case sym.Kind == st.GVLSymbol:
+		g, rest := splitPath(rest)
+		for _, gs := range m.Project.Globals() {
+			if strings.EqualFold(gs.GVL, name) && strings.EqualFold(gs.Name, g) {
+				return m.walk(m.global(gs), rest)
+			}
+		}
+		m.fail("%s has no variable %s", name, g)
+	case sym.Kind == st.POUSymbol && sym.POU.Kind == st.Program:
+		return m.walk(m.program(sym.POU), rest)
+	}
+	m.fail("no global variable or program %s", name)
+	return nil
+}
+
+// splitPath splits the first name off a variable path. rest keeps its
+// leading '[' or drops the '.'.
+func splitPath(path string) (name, rest string) {
+	i := strings.IndexAny(path, ".[")
+	if i < 0 {
+		return strings.TrimSpace(path), ""
+	}
+	if path[i] == '.' {
+		return strings.TrimSpace(path[:i]), path[i+1:]
+	}
+	return strings.TrimSpace(path[:i]), path[i:]
+}
+
+// walk follows a path of member names and [i, j] indices from v.
+func (m *Machine) walk(v *value, path string) *value {
+	v = m.deref(v)
+	for path != "" {
+		if path[0] == '[' {
+			end := strings.IndexByte(path, ']')
+			if end < 0 || v.t.Class != st.ArrayClass {
+				m.fail("bad index in %s", path)
+			}
+			var idx []int64
+			for _, s := range strings.Split(path[1:end], ",") {
+				n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+				if err != nil {
+					m.fail("bad index %q", s)
+				}
+				idx = append(idx, n)
+			}
+			v = m.deref(m.element(v, idx))
+			path = strings.TrimPrefix(path[end+1:], ".")
+			continue
+		}
+		var name string
+		name, path = splitPath(path)
+		f := v.fields[strings.ToUpper(name)]
+		if f == nil {
+			m.fail("%s has no member %s", v.t.Name, name)
+		}
+		v = m.deref(f)
+	}
+	return v
+}
+
+// ── Process image ─────────────────────────────────────────────────────────────
+
+// address returns the variable behind a direct address such as %IX0.0. A
+// variable declared AT the address shares it; otherwise it is created on
+// first use.
+func (m *Machine) address(text string, t *st.Type) *value {
+	key := strings.ToUpper(text)
+	if v := m.io[key]; v != nil {
+		return v
+	}
+	v := m.newValue(t)
+	m.io[key] = v
+	return v
+}
+
+// locate places v at a direct address and returns the variable that holds
+// the address: v, or an earlier variable declared AT the same address.
+// Incomplete addresses such as %I* are left to the configuration.
+func (m *Machine) locate(text string, v *value) *value {
+	if strings.Contains(text, "*") {
+		return v
+	}
+	key := strings.ToUpper(text)
+	if w := m.io[key]; w != nil {
+		return w
+	}
+	m.io[key] = v
+	return v
+}
+
+// Addresses returns the direct addresses in use, sorted: those of located
+// variables and those read or written by the program so far.
+func (m *Machine) Addresses() []string {
+	out := make([]string, 0, len(m.io))
+	for k := range m.io {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,138 @@
+package interp
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/damischa1/iec-st-tools/st"
+)
+
+// TestCases runs the projects in testdata/interp. Each file is one project
+// whose PROGRAM Main is called once per cycle. Comment lines at the top of
+// the file control the run:
+//
+//	// cycles: 15          calls of Main (default 1)
+//	// cycle: 10ms         clock advance after each call (default 10ms)
+//	// want: Main.x = 16#FF  value of a variable after the last call
+//	// error: text         the run fails with an error containing text
+//
+// Every case must also pass the type checker.
+func TestCases(t *testing.T) {
+	files, err := filepath.Glob("../testdata/interp/*.st")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no test cases: %v", err)
+	}
+	for _, file := range files {
+		t.Run(strings.TrimSuffix(filepath.Base(file), ".st"), func(t *testing.T) {
+			runCase(t, file)
+		})
+	}
+}
+
+type wantValue struct {
+	path, expr string
+}
+
+func runCase(t *testing.T, file string) {
+	cycles, cycle := 1, 10*time.Millisecond
+	var wants []wantValue
+	var wantErr string
+	for _, line := range headerComments(t, file) {
+		key, val, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		val = strings.TrimSpace(val)
+		var err error
+		switch key {
+		case "cycles":
+			cycles, err = strconv.Atoi(val)
+		case "cycle":
+			cycle, err = time.ParseDuration(val)
+		case "want":
+			path, expr, found := strings.Cut(val, "=")
+			if !found {
+				t.Fatalf("want without '=': %s", line)
+			}
+			wants = append(wants, wantValue{strings.TrimSpace(path), strings.TrimSpace(expr)})
+		case "error":
+			wantErr = val
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", line, err)
+		}
+	}
+
+	p, err := st.LoadProject(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for f, list := range p.SyntaxErrors {
+		t.Fatalf("%s: %v", f.Name, list)
+	}
+	for f, list := range p.Check() {
+		t.Fatalf("%s: %v", f.Name, list)
+	}
+
+	m, err := New(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prog, err := m.Program("Main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < cycles && err == nil; i++ {
+		_, err = prog.Call(nil)
+		m.Advance(cycle)
+	}
+	switch {
+	case wantErr != "" && err == nil:
+		t.Fatalf("no error, want %q", wantErr)
+	case wantErr != "" && !strings.Contains(err.Error(), wantErr):
+		t.Fatalf("error %q, want %q", err, wantErr)
+	case wantErr == "" && err != nil:
+		t.Fatal(err)
+	}
+
+	for _, w := range wants {
+		got, err := m.Get(w.path)
+		if err != nil {
+			t.Errorf("%s: %v", w.path, err)
+			continue
+		}
+		want, err := m.Eval(w.expr)
+		if err != nil {
+			t.Errorf("%s: %v", w.expr, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s = %v (%T), want %s = %v (%T)", w.path, got, got, w.expr, want, want)
+		}
+	}
+}
+
+// headerComments returns the // comment lines before the first declaration.
+func headerComments(t *testing.T, file string) []string {
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var out []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line, ok := strings.CutPrefix(strings.TrimSpace(sc.Text()), "//")
+		if !ok {
+			break
+		}
+		out = append(out, strings.TrimSpace(line))
+	}
+	return out
+}
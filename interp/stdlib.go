@@ -0,0 +1,468 @@
+package interp
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/damischa1/iec-st-tools/st"
+)
+
+// ── Standard function blocks ──────────────────────────────────────────────────
+
+// fbState is the hidden state of a standard function block.
+type fbState struct {
+	start   time.Duration // timers: when the current interval began
+	running bool          // timers: an interval is being timed
+	prev    bool          // previous IN, CU or CLK for edge detection
+	prev2   bool          // previous CD of CTUD
+}
+
+// native executes a standard function block on its instance. Timers read
+// the machine's simulated clock.
+func (m *Machine) native(d *st.POU, inst *value) {
+	if inst.state == nil {
+		inst.state = &fbState{}
+	}
+	s := inst.state
+	get := func(name string) *value { return inst.fields[name] }
+	in := func(name string) bool { return get(name).i != 0 }
+	set := func(name string, b bool) { get(name).i = boolValue(b).i }
+	setTime := func(name string, d time.Duration) { m.store(get(name), &value{t: st.TypeLTime, i: int64(d)}) }
+	pt := func() time.Duration { return time.Duration(get("PT").i) }
+
+	switch strings.ToUpper(d.Name.Name) {
+	case "TON":
+		// Q rises PT after IN, and falls with IN
+		if !in("IN") {
+			s.running = false
+			set("Q", false)
+			setTime("ET", 0)
+			break
+		}
+		if !s.running {
+			s.running, s.start = true, m.Now
+		}
+		et := min(m.Now-s.start, pt())
+		setTime("ET", et)
+		set("Q", et >= pt())
+	case "TOF":
+		// Q rises with IN, and falls PT after IN falls
+		if in("IN") {
+			s.running = false
+			set("Q", true)
+			setTime("ET", 0)
+			break
+		}
+		if s.prev {
+			s.running, s.start = true, m.Now
+		}
+		if s.running {
+			et := min(m.Now-s.start, pt())
+			setTime("ET", et)
+			if et >= pt() {
+				s.running = false
+				set("Q", false)
+			}
+		}
+	case "TP":
+		// a pulse of length PT on each rising edge of IN
+		if in("IN") && !s.prev && !s.running {
+			s.running, s.start = true, m.Now
+		}
+		if s.running {
+			et := min(m.Now-s.start, pt())
+			setTime("ET", et)
+			set("Q", et < pt())
+			if et >= pt() {
+				s.running = false
+			}
+		} else if !in("IN") {
+			setTime("ET", 0)
+		}
+	case "R_TRIG":
+		clk := in("CLK")
+		set("Q", clk && !in("M"))
+		set("M", clk)
+	case "F_TRIG":
+		clk := in("CLK")
+		set("Q", !clk && in("M"))
+		set("M", clk)
+	case "CTU":
+		cv := get("CV")
+		switch {
+		case in("RESET"):
+			cv.i = 0
+		case in("CU") && !s.prev && cv.i < 0xFFFF:
+			cv.i++
+		}
+		set("Q", cv.i >= get("PV").i)
+	case "CTD":
+		cv := get("CV")
+		switch {
+		case in("LOAD"):
+			cv.i = get("PV").i
+		case in("CD") && !s.prev && cv.i > 0:
+			cv.i--
+		}
+		set("Q", cv.i <= 0)
+	case "CTUD":
+		cv := get("CV")
+		switch {
+		case in("RESET"):
+			cv.i = 0
+		case in("LOAD"):
+			cv.i = get("PV").i
+		default:
+			if in("CU") && !s.prev && cv.i < 0xFFFF {
+				cv.i++
+			}
+			if in("CD") && !s.prev2 && cv.i > 0 {
+				cv.i--
+			}
+		}
+		set("QU", cv.i >= get("PV").i)
+		set("QD", cv.i <= 0)
+		s.prev2 = in("CD")
+	case "SR":
+		set("Q1", in("SET1") || !in("RESET") && in("Q1"))
+	case "RS":
+		set("Q1", !in("RESET1") && (in("SET") || in("Q1")))
+	}
+
+	switch strings.ToUpper(d.Name.Name) {
+	case "TON", "TOF", "TP":
+		s.prev = in("IN")
+	case "CTU", "CTUD":
+		s.prev = in("CU")
+	case "CTD":
+		s.prev = in("CD")
+	}
+}
+
+// ── Standard functions ────────────────────────────────────────────────────────
+
+// stdParams names the parameters of standard functions that have more than
+// IN or IN1, IN2, …, for calls with named arguments.
+var stdParams = map[string][]string{
+	"SEL": {"G", "IN0", "IN1"}, "LIMIT": {"MN", "IN", "MX"}, "MUX": {"K"},
+	"SHL": {"IN", "N"}, "SHR": {"IN", "N"}, "ROL": {"IN", "N"}, "ROR": {"IN", "N"},
+	"LEFT": {"IN", "L"}, "RIGHT": {"IN", "L"}, "MID": {"IN", "L", "P"},
+	"INSERT": {"IN1", "IN2", "P"}, "DELETE": {"IN", "L", "P"}, "REPLACE": {"IN1", "IN2", "L", "P"},
+	"FIND": {"IN1", "IN2"},
+}
+
+// stdArgs returns the argument expressions of a standard function call in
+// parameter order.
+func (m *Machine) stdArgs(e *st.CallExpr, u string) []st.Expr {
+	var out []st.Expr
+	put := func(i int, x st.Expr) {
+		for len(out) <= i {
+			out = append(out, nil)
+		}
+		out[i] = x
+	}
+	for k, a := range e.Args {
+		if a.Output {
+			m.failAt(a.Name, "%s has no outputs", u)
+		}
+		if a.Name == nil {
+			put(k, a.Value)
+			continue
+		}
+		name := strings.ToUpper(a.Name.Name)
+		i := -1
+		for j, p := range stdParams[u] {
+			if p == name {
+				i = j
+			}
+		}
+		if n, err := strconv.Atoi(strings.TrimPrefix(name, "IN")); i < 0 && err == nil && strings.HasPrefix(name, "IN") {
+			i = n - 1
+			if u == "MUX" {
+				i = n + 1
+			}
+		} else if i < 0 && name == "IN" {
+			i = 0
+		}
+		if i < 0 {
+			m.failAt(a.Name, "%s has no parameter %s", u, a.Name.Name)
+		}
+		put(i, a.Value)
+	}
+	for i, x := range out {
+		if x == nil {
+			m.failAt(e, "argument %d of %s is missing", i+1, u)
+		}
+	}
+	return out
+}
+
+// stdCall evaluates a call of a standard function or type conversion.
+func (m *Machine) stdCall(f *frame, e *st.CallExpr, name string) *value {
+	u := strings.ToUpper(name)
+	sf, ok := st.LookupStdFunc(u)
+	if !ok {
+		m.failAt(e, "undeclared function %s", name)
+	}
+	exprs := m.stdArgs(e, u)
+	if len(exprs) < sf.MinArgs || sf.MaxArgs >= 0 && len(exprs) > sf.MaxArgs {
+		m.failAt(e, "wrong number of arguments in call of %s", u)
+	}
+	rt := m.typeOf(f, e)
+	switch u {
+	case "ADR":
+		return &value{t: rt, ptr: m.cell(f, exprs[0])}
+	case "SIZEOF":
+		t := m.typeOf(f, exprs[0])
+		if id, ok := exprs[0].(*st.Ident); ok {
+			if sym := m.resolve(f, id); sym != nil && sym.Kind == st.TypeSymbol {
+				t = sym.Type
+			}
+		}
+		return &value{t: rt, i: sizeOf(t)}
+	}
+	args := make([]*value, len(exprs))
+	for i, x := range exprs {
+		args[i] = m.eval(f, x)
+	}
+	m.pos = e.Pos()
+
+	if strings.HasPrefix(u, "TO_") || strings.Contains(u, "_TO_") || strings.HasPrefix(u, "TRUNC_") {
+		x := args[0]
+		switch {
+		case strings.HasPrefix(u, "BCD_TO_"):
+			return m.convert(&value{t: st.TypeLInt, i: fromBCD(m.toInt(x))}, rt)
+		case strings.HasSuffix(u, "_TO_BCD"):
+			return &value{t: rt, i: wrap(toBCD(m.toInt(x)), rt)}
+		case strings.HasPrefix(u, "TRUNC_"), x.t.Class == st.RealClass && strings.HasPrefix(u, "TRUNC"):
+			return m.convert(&value{t: st.TypeLInt, i: int64(math.Trunc(x.f))}, rt)
+		}
+		return m.convert(x, rt)
+	}
+
+	num := func(fn func(float64) float64) *value {
+		return m.convert(&value{t: st.TypeLReal, f: fn(m.toFloat(args[0]))}, rt)
+	}
+	switch u {
+	case "ABS":
+		if rt.Class == st.RealClass {
+			return num(math.Abs)
+		}
+		n := m.toInt(args[0])
+		if n < 0 {
+			n = -n
+		}
+		return &value{t: rt, i: wrap(n, rt)}
+	case "SQRT":
+		return num(math.Sqrt)
+	case "LN":
+		return num(math.Log)
+	case "LOG":
+		return num(math.Log10)
+	case "EXP":
+		return num(math.Exp)
+	case "SIN":
+		return num(math.Sin)
+	case "COS":
+		return num(math.Cos)
+	case "TAN":
+		return num(math.Tan)
+	case "ASIN":
+		return num(math.Asin)
+	case "ACOS":
+		return num(math.Acos)
+	case "ATAN":
+		return num(math.Atan)
+	case "EXPT":
+		return m.convert(&value{t: st.TypeLReal, f: math.Pow(m.toFloat(args[0]), m.toFloat(args[1]))}, rt)
+	case "ADD", "MUL", "SUB", "DIV", "MOD":
+		op := map[string]string{"ADD": "+", "MUL": "*", "SUB": "-", "DIV": "/", "MOD": "MOD"}[u]
+		r := args[0]
+		for _, a := range args[1:] {
+			r = m.arith(op, r, a, rt)
+		}
+		return m.convert(r, rt)
+	case "MOVE":
+		return m.result(args[0], rt)
+	case "SEL":
+		if m.truth(args[0]) {
+			return m.result(args[2], rt)
+		}
+		return m.result(args[1], rt)
+	case "MUX":
+		k := m.toInt(args[0])
+		if k < 0 || k >= int64(len(args)-1) {
+			m.fail("MUX selector %d out of range 0..%d", k, len(args)-2)
+		}
+		return m.result(args[k+1], rt)
+	case "MAX", "MIN":
+		r := args[0]
+		for _, a := range args[1:] {
+			if c := m.compare(a, r); u == "MAX" && c > 0 || u == "MIN" && c < 0 {
+				r = a
+			}
+		}
+		return m.convert(r, rt)
+	case "LIMIT":
+		r := args[1]
+		if m.compare(r, args[0]) < 0 {
+			r = args[0]
+		}
+		if m.compare(r, args[2]) > 0 {
+			r = args[2]
+		}
+		return m.convert(r, rt)
+	case "SHL", "SHR", "ROL", "ROR":
+		return &value{t: rt, i: wrap(shift(u, m.toInt(args[0]), m.toInt(args[1]), rt), rt)}
+	case "TRUNC":
+		return m.convert(&value{t: st.TypeLInt, i: int64(math.Trunc(m.toFloat(args[0])))}, rt)
+	}
+	return m.stringFunc(u, args, rt)
+}
+
+// result converts the value a selection function passes through;
+// structures and arrays pass unchanged.
+func (m *Machine) result(v *value, rt *st.Type) *value {
+	if isComposite(v.t) || rt.Class == st.AnyClass {
+		return v
+	}
+	return m.convert(v, rt)
+}
+
+// shift implements SHL, SHR, ROL and ROR on the bit pattern of n in the
+// width of t.
+func shift(op string, n, k int64, t *st.Type) int64 {
+	bits, _ := intInfo(t)
+	mask := uint64(1)<<bits - 1
+	if bits >= 64 {
+		mask = math.MaxUint64
+	}
+	u := uint64(n) & mask
+	switch op {
+	case "SHL":
+		if k >= int64(bits) {
+			return 0
+		}
+		return int64(u << k & mask)
+	case "SHR":
+		if k >= int64(bits) {
+			return 0
+		}
+		return int64(u >> k)
+	}
+	k %= int64(bits)
+	if op == "ROR" {
+		k = (int64(bits) - k) % int64(bits)
+	}
+	return int64((u<<k | u>>(int64(bits)-k)) & mask)
+}
+
+// stringFunc implements the string functions. Positions are 1-based;
+// arguments out of range give the nearest sensible result.
+func (m *Machine) stringFunc(u string, args []*value, rt *st.Type) *value {
+	wide := rt.Class == st.StringClass && rt.Wide
+	str := func(i int) []rune { return runes(m.toString(args[i]), wide) }
+	n := func(i int) int {
+		k := m.toInt(args[i])
+		if k < 0 {
+			return 0
+		}
+		return int(k)
+	}
+	clip := func(i, len_ int) int { return max(0, min(i, len_)) }
+	var r []rune
+	switch u {
+	case "LEN":
+		if args[0].t.Class == st.StringClass && args[0].t.Wide {
+			wide = true
+		}
+		return m.convert(&value{t: st.TypeLInt, i: int64(len(runes(m.toString(args[0]), wide)))}, rt)
+	case "FIND":
+		s, sub := string(str(0)), string(str(1))
+		i := strings.Index(s, sub)
+		if i < 0 {
+			return &value{t: rt}
+		}
+		return &value{t: rt, i: int64(len([]rune(s[:i])) + 1)}
+	case "LEFT":
+		s := str(0)
+		r = s[:clip(n(1), len(s))]
+	case "RIGHT":
+		s := str(0)
+		r = s[len(s)-clip(n(1), len(s)):]
+	case "MID":
+		s := str(0)
+		p := clip(n(2)-1, len(s))
+		r = s[p:clip(p+n(1), len(s))]
+	case "CONCAT":
+		for i := range args {
+			r = append(r, str(i)...)
+		}
+	case "INSERT":
+		s, ins := str(0), str(1)
+		p := clip(n(2), len(s))
+		r = append(append(append([]rune{}, s[:p]...), ins...), s[p:]...)
+	case "DELETE":
+		s := str(0)
+		p := clip(n(2)-1, len(s))
+		r = append(append([]rune{}, s[:p]...), s[clip(p+n(1), len(s)):]...)
+	case "REPLACE":
+		s, rep := str(0), str(1)
+		p := clip(n(3)-1, len(s))
+		r = append(append(append([]rune{}, s[:p]...), rep...), s[clip(p+n(2), len(s)):]...)
+	default:
+		m.fail("standard function %s is not supported", u)
+	}
+	return m.convert(&value{t: st.StringOf(len(r), wide), s: fromRunes(r, wide)}, rt)
+}
+
+// sizeOf returns the storage size of a type in bytes, without padding.
+func sizeOf(t *st.Type) int64 {
+	switch t.Class {
+	case st.BoolClass:
+		return 1
+	case st.StringClass:
+		if t.Wide {
+			return 2 * int64(t.Len+1)
+		}
+		return int64(t.Len + 1)
+	case st.ArrayClass:
+		n := int64(1)
+		for _, d := range t.Dims {
+			n *= d.Len()
+		}
+		return n * sizeOf(t.Elem)
+	case st.StructClass, st.InstanceClass:
+		var n int64
+		for _, f := range fieldsOf(t) {
+			n += sizeOf(f.Type)
+		}
+		return n
+	case st.EnumClass:
+		bits, _ := intInfo(t)
+		return int64(bits / 8)
+	case st.PointerClass:
+		return 8
+	}
+	return int64(t.Bits / 8)
+}
+
+func toBCD(n int64) int64 {
+	var r, shift int64
+	for ; n > 0; n /= 10 {
+		r |= n % 10 << shift
+		shift += 4
+	}
+	return r
+}
+
+func fromBCD(n int64) int64 {
+	var r, mul int64 = 0, 1
+	for ; n > 0; n >>= 4 {
+		r += n & 0xF * mul
+		mul *= 10
+	}
+	return r
+}
@@ -0,0 +1,714 @@
+package interp
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/damischa1/iec-st-tools/st"
+)
+
+// ── Values ────────────────────────────────────────────────────────────────────
+
+// value is a variable or an intermediate result. Variables are *value cells
+// that assignments copy into, so pointers, references and VAR_IN_OUT
+// bindings to them stay valid.
+//
+// TIME and LTIME hold nanoseconds, DATE and DT nanoseconds since 1970, TOD
+// nanoseconds since midnight. Integers are kept wrapped to their type.
+type value struct {
+	t      *st.Type
+	i      int64             // BOOL, integers, bit strings, enumerations, CHAR, TIME and dates
+	f      float64           // REAL, LREAL
+	s      string            // STRING, WSTRING
+	elems  []*value          // array elements in row-major order
+	fields map[string]*value // struct members and FB variables by upper-case name
+	ptr    *value            // POINTER TO, REFERENCE TO and VAR_IN_OUT target; nil when unset
+	state  *fbState          // standard function blocks
+	alias  *value            // variable a bit-cast view reads and writes through
+}
+
+// bindType is the type of a VAR_IN_OUT parameter slot: a reference bound on
+// every call.
+var bindType = &st.Type{Class: st.PointerClass, Name: "VAR_IN_OUT", Ref: true}
+
+// voidValue is the result of calls without one.
+var voidValue = &value{t: st.TypeVoid}
+
+func boolValue(b bool) *value {
+	if b {
+		return &value{t: st.TypeBool, i: 1}
+	}
+	return &value{t: st.TypeBool}
+}
+
+func isComposite(t *st.Type) bool {
+	return t.Class == st.ArrayClass || t.Class == st.StructClass || t.Class == st.InstanceClass
+}
+
+// newValue creates a variable of type t holding the type's initial value.
+func (m *Machine) newValue(t *st.Type) *value {
+	v := &value{t: t}
+	switch t.Class {
+	case st.ArrayClass:
+		n := int64(1)
+		for _, d := range t.Dims {
+			if !d.Known {
+				n = 0
+				break
+			}
+			n *= d.Len()
+		}
+		v.elems = make([]*value, n)
+		for i := range v.elems {
+			v.elems[i] = m.newValue(t.Elem)
+		}
+	case st.StructClass:
+		v.fields = map[string]*value{}
+		gf := &frame{scope: m.Project.GlobalScope()}
+		for _, f := range fieldsOf(t) {
+			fv := m.newValue(f.Type)
+			if f.Decl != nil && f.Decl.Init != nil {
+				m.initialize(fv, f.Decl.Init, gf)
+			}
+			v.fields[strings.ToUpper(f.Name)] = fv
+		}
+	case st.InstanceClass:
+		v.fields = map[string]*value{}
+		for _, d := range chain(m.Project, t.POU) {
+			s := m.scope(d)
+			f := &frame{pou: d, scope: s, file: m.fileName(s), this: v}
+			for _, b := range d.VarBlocks {
+				for _, vd := range b.Vars {
+					ft := m.declType(s, vd)
+					for _, id := range vd.Names {
+						key := strings.ToUpper(id.Name)
+						switch b.Kind {
+						case "VAR_IN_OUT":
+							v.fields[key] = &value{t: bindType}
+							continue
+						case "VAR_TEMP":
+							continue // created per call
+						}
+						fv := m.newValue(ft)
+						if vd.Init != nil {
+							m.initialize(fv, vd.Init, f)
+						}
+						if vd.At != nil {
+							fv = m.locate(vd.At.Text, fv)
+						}
+						v.fields[key] = fv
+					}
+				}
+			}
+		}
+	case st.EnumClass:
+		if len(t.Members) > 0 {
+			v.i = t.Members[0].Value
+		}
+	}
+	if t.Decl != nil && t.Decl.Init != nil && t.Class != st.InstanceClass {
+		m.initialize(v, t.Decl.Init, &frame{scope: m.Project.GlobalScope()})
+	}
+	return v
+}
+
+// fieldsOf returns the members of a structure or the variables of a
+// function block, those of base types first.
+func fieldsOf(t *st.Type) []*st.Field {
+	var types []*st.Type
+	for x := t; x != nil && len(types) < 16; x = x.Base {
+		types = append([]*st.Type{x}, types...)
+	}
+	var out []*st.Field
+	for _, x := range types {
+		out = append(out, x.Fields...)
+	}
+	return out
+}
+
+// initialize assigns an initial value: an expression, [1, 2, 3(0)] for
+// arrays or (a := 1, b := 2) for structures and instances.
+func (m *Machine) initialize(v *value, e st.Expr, f *frame) {
+	v = m.deref(v)
+	switch e := e.(type) {
+	case *st.ArrayInit:
+		if v.t.Class != st.ArrayClass {
+			m.failAt(e, "array initial value for %s", v.t.Name)
+		}
+		i := 0
+		for _, el := range e.Elems {
+			n := int64(1)
+			if el.Count != nil {
+				n = m.toInt(m.eval(f, el.Count))
+			}
+			for ; n > 0 && i < len(v.elems); n-- {
+				m.initialize(v.elems[i], el.Value, f)
+				i++
+			}
+		}
+	case *st.StructInit:
+		if v.fields == nil {
+			m.failAt(e, "structure initial value for %s", v.t.Name)
+		}
+		for _, fi := range e.Fields {
+			fv := v.fields[strings.ToUpper(fi.Name.Name)]
+			if fv == nil {
+				m.failAt(fi.Name, "%s has no member %s", v.t.Name, fi.Name.Name)
+			}
+			m.initialize(fv, fi.Value, f)
+		}
+	default:
+		m.store(v, m.eval(f, e))
+	}
+}
+
+// store copies src into the variable dst, converting it to dst's type.
+func (m *Machine) store(dst, src *value) {
+	switch dst.t.Class {
+	case st.ArrayClass:
+		if src.t.Class != st.ArrayClass {
+			m.fail("cannot assign %s to %s", src.t.Name, dst.t.Name)
+		}
+		for i := range dst.elems {
+			if i < len(src.elems) {
+				m.store(dst.elems[i], src.elems[i])
+			}
+		}
+	case st.StructClass, st.InstanceClass:
+		if src.fields == nil {
+			m.fail("cannot assign %s to %s", src.t.Name, dst.t.Name)
+		}
+		if dst == src {
+			return
+		}
+		for k, d := range dst.fields {
+			if s := src.fields[k]; s != nil && d.t != bindType {
+				m.store(d, s)
+			}
+		}
+		if src.state != nil {
+			state := *src.state
+			dst.state = &state
+		}
+	default:
+		c := m.convert(src, dst.t)
+		dst.i, dst.f, dst.s, dst.ptr = c.i, c.f, c.s, c.ptr
+		m.writeThrough(dst)
+	}
+}
+
+// writeThrough copies a changed bit-cast view back into the variable it
+// reinterprets.
+func (m *Machine) writeThrough(v *value) {
+	if v.alias != nil {
+		w := fromBits(rawBits(v), v.alias.t)
+		v.alias.i, v.alias.f = w.i, w.f
+	}
+}
+
+// ── Conversions ───────────────────────────────────────────────────────────────
+
+// intInfo returns the width and signedness of an integer-like type.
+func intInfo(t *st.Type) (bits int, signed bool) {
+	switch t.Class {
+	case st.BoolClass:
+		return 1, false
+	case st.IntClass:
+		return t.Bits, t.Signed || t.Untyped
+	case st.EnumClass:
+		if t.Base != nil {
+			return intInfo(t.Base)
+		}
+		return 16, true
+	case st.BitsClass, st.CharClass:
+		return t.Bits, false
+	}
+	return 64, true
+}
+
+// wrap reduces n to the range of t, as the PLC's fixed-width arithmetic
+// does: INT 32768 becomes -32768, UINT -1 becomes 65535.
+func wrap(n int64, t *st.Type) int64 {
+	if t.Class == st.BoolClass {
+		if n != 0 {
+			return 1
+		}
+		return 0
+	}
+	bits, signed := intInfo(t)
+	if bits >= 64 || bits <= 0 {
+		return n
+	}
+	n &= 1<<bits - 1
+	if signed && n&(1<<(bits-1)) != 0 {
+		n -= 1 << bits
+	}
+	return n
+}
+
+// truth returns the value of a BOOL.
+func (m *Machine) truth(v *value) bool {
+	switch v.t.Class {
+	case st.RealClass:
+		return v.f != 0
+	case st.StringClass:
+		m.fail("%s is not a BOOL", v.t.Name)
+	}
+	return v.i != 0
+}
+
+// toInt converts a value to an integer. REAL rounds to the nearest integer
+// as REAL_TO_INT does; TIME counts milliseconds, LTIME nanoseconds; DATE and
+// DT count seconds, TOD milliseconds.
+func (m *Machine) toInt(v *value) int64 {
+	switch v.t.Class {
+	case st.RealClass:
+		f := math.Round(v.f)
+		switch {
+		case math.IsNaN(f):
+			return 0
+		case f >= math.MaxInt64:
+			return math.MaxInt64
+		case f <= math.MinInt64:
+			return math.MinInt64
+		}
+		return int64(f)
+	case st.TimeClass:
+		if v.t.Bits == 64 {
+			return v.i
+		}
+		return v.i / int64(time.Millisecond)
+	case st.DateClass:
+		switch {
+		case v.t.Bits == 64:
+			return v.i
+		case v.t == st.TypeTOD:
+			return v.i / int64(time.Millisecond)
+		}
+		return v.i / int64(time.Second)
+	case st.StringClass:
+		s := strings.TrimSpace(v.s)
+		if n, ok := st.ParseInt(s); ok {
+			return n
+		}
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return m.toInt(&value{t: st.TypeLReal, f: f})
+		}
+		return 0
+	case st.PointerClass:
+		if v.ptr != nil {
+			m.fail("pointer arithmetic is not supported")
+		}
+		return 0
+	case st.IntClass, st.BitsClass, st.BoolClass, st.EnumClass, st.CharClass:
+		return v.i
+	}
+	m.fail("%s is not a number", v.t.Name)
+	return 0
+}
+
+// toFloat converts a value to a float.
+func (m *Machine) toFloat(v *value) float64 {
+	switch v.t.Class {
+	case st.RealClass:
+		return v.f
+	case st.StringClass:
+		f, _ := strconv.ParseFloat(strings.TrimSpace(v.s), 64)
+		return f
+	}
+	if unsigned64(v.t) {
+		return float64(uint64(v.i))
+	}
+	return float64(m.toInt(v))
+}
+
+// toString converts a value to text like the X_TO_STRING functions.
+func (m *Machine) toString(v *value) string {
+	switch v.t.Class {
+	case st.StringClass:
+		return v.s
+	case st.BoolClass:
+		if v.i != 0 {
+			return "TRUE"
+		}
+		return "FALSE"
+	case st.RealClass:
+		bits := 64
+		if v.t.Bits == 32 {
+			bits = 32
+		}
+		return strconv.FormatFloat(v.f, 'g', -1, bits)
+	case st.CharClass:
+		return string(rune(v.i))
+	case st.TimeClass:
+		prefix := "T#"
+		if v.t.Bits == 64 {
+			prefix = "LTIME#"
+		}
+		return prefix + formatDuration(time.Duration(v.i))
+	case st.DateClass:
+		switch v.t {
+		case st.TypeTOD, st.TypeLTOD:
+			t := time.Date(0, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(v.i))
+			return "TOD#" + t.Format("15:04:05.999")
+		case st.TypeDate, st.TypeLDate:
+			return "D#" + time.Unix(0, v.i).UTC().Format("2006-01-02")
+		}
+		return "DT#" + time.Unix(0, v.i).UTC().Format("2006-01-02-15:04:05")
+	}
+	if unsigned64(v.t) {
+		return strconv.FormatUint(uint64(v.i), 10)
+	}
+	return strconv.FormatInt(m.toInt(v), 10)
+}
+
+// formatDuration writes a duration in the units of a TIME literal: 1h2m3s4ms.
+func formatDuration(d time.Duration) string {
+	if d == 0 {
+		return "0ms"
+	}
+	var sb strings.Builder
+	if d < 0 {
+		sb.WriteByte('-')
+		d = -d
+	}
+	for _, u := range []struct {
+		name string
+		d    time.Duration
+	}{{"d", 24 * time.Hour}, {"h", time.Hour}, {"m", time.Minute}, {"s", time.Second},
+		{"ms", time.Millisecond}, {"us", time.Microsecond}, {"ns", time.Nanosecond}} {
+		if n := d / u.d; n > 0 {
+			fmt.Fprintf(&sb, "%d%s", n, u.name)
+			d -= n * u.d
+		}
+	}
+	return sb.String()
+}
+
+// convert returns v converted to type t. Composite values are returned
+// unchanged; store copies them element by element.
+func (m *Machine) convert(v *value, t *st.Type) *value {
+	switch t.Class {
+	case st.BoolClass:
+		return boolValue(m.truth(v))
+	case st.IntClass, st.BitsClass, st.EnumClass, st.CharClass:
+		return &value{t: t, i: wrap(m.toInt(v), t)}
+	case st.RealClass:
+		f := m.toFloat(v)
+		if t.Bits == 32 {
+			f = float64(float32(f))
+		}
+		return &value{t: t, f: f}
+	case st.StringClass:
+		s := m.toString(v)
+		if t.Len > 0 {
+			if rs := runes(s, t.Wide); len(rs) > t.Len {
+				s = fromRunes(rs[:t.Len], t.Wide)
+			}
+		}
+		return &value{t: t, s: s}
+	case st.TimeClass:
+		var ns int64
+		switch v.t.Class {
+		case st.TimeClass, st.DateClass:
+			ns = v.i
+		case st.RealClass:
+			ns = int64(v.f * float64(time.Millisecond))
+			if t.Bits == 64 {
+				ns = int64(v.f)
+			}
+		default:
+			ns = m.toInt(v) * int64(time.Millisecond)
+			if t.Bits == 64 {
+				ns = m.toInt(v)
+			}
+		}
+		if t.Bits < 64 {
+			ns -= ns % int64(time.Millisecond)
+		}
+		return &value{t: t, i: ns}
+	case st.DateClass:
+		if v.t.Class == st.DateClass || v.t.Class == st.TimeClass {
+			return &value{t: t, i: v.i}
+		}
+		unit := int64(time.Second)
+		switch {
+		case t.Bits == 64:
+			unit = 1
+		case t == st.TypeTOD:
+			unit = int64(time.Millisecond)
+		}
+		return &value{t: t, i: m.toInt(v) * unit}
+	case st.PointerClass:
+		if v.t.Class == st.PointerClass {
+			return &value{t: t, ptr: v.ptr}
+		}
+		if m.toInt(v) != 0 {
+			m.fail("cannot convert %s to a pointer", v.t.Name)
+		}
+		return &value{t: t}
+	}
+	return v
+}
+
+// ── Bit casts ─────────────────────────────────────────────────────────────────
+
+// bitWidth returns the size in bits of a scalar type whose bits a pointer of
+// another type may reinterpret, or 0 for other types.
+func bitWidth(t *st.Type) int {
+	switch t.Class {
+	case st.RealClass:
+		return t.Bits
+	case st.IntClass, st.BitsClass, st.EnumClass, st.CharClass:
+		if t.Untyped || t.Bits == 0 && t.Class != st.EnumClass {
+			return 0
+		}
+		bits, _ := intInfo(t)
+		return bits
+	}
+	return 0
+}
+
+// rawBits returns the memory representation of a scalar: the IEEE 754 bits
+// of a REAL or LREAL, the two's complement bits of an integer.
+func rawBits(v *value) uint64 {
+	if v.t.Class == st.RealClass {
+		if v.t.Bits == 32 {
+			return uint64(math.Float32bits(float32(v.f)))
+		}
+		return math.Float64bits(v.f)
+	}
+	return uint64(v.i)
+}
+
+// fromBits reads raw memory bits as a value of type t.
+func fromBits(raw uint64, t *st.Type) *value {
+	if t.Class == st.RealClass {
+		if t.Bits == 32 {
+			return &value{t: t, f: float64(math.Float32frombits(uint32(raw)))}
+		}
+		return &value{t: t, f: math.Float64frombits(raw)}
+	}
+	return &value{t: t, i: wrap(int64(raw), t)}
+}
+
+// runes splits a string into characters: bytes for STRING, code points for
+// WSTRING.
+func runes(s string, wide bool) []rune {
+	if wide {
+		return []rune(s)
+	}
+	rs := make([]rune, len(s))
+	for i := 0; i < len(s); i++ {
+		rs[i] = rune(s[i])
+	}
+	return rs
+}
+
+func fromRunes(rs []rune, wide bool) string {
+	if wide {
+		return string(rs)
+	}
+	b := make([]byte, len(rs))
+	for i, r := range rs {
+		b[i] = byte(r)
+	}
+	return string(b)
+}
+
+// ── Go values ─────────────────────────────────────────────────────────────────
+
+// toGo converts a value for the Go API.
+func (m *Machine) toGo(v *value) any {
+	if v.t == bindType {
+		if v.ptr == nil {
+			return nil
+		}
+		v = m.deref(v)
+	}
+	switch v.t.Class {
+	case st.BoolClass:
+		return v.i != 0
+	case st.IntClass, st.BitsClass, st.CharClass:
+		return v.i
+	case st.EnumClass:
+		for _, mem := range v.t.Members {
+			if mem.Value == v.i {
+				return mem.Name
+			}
+		}
+		return v.i
+	case st.RealClass:
+		return v.f
+	case st.StringClass:
+		return v.s
+	case st.TimeClass:
+		return time.Duration(v.i)
+	case st.DateClass:
+		if v.t == st.TypeTOD || v.t == st.TypeLTOD {
+			return time.Duration(v.i)
+		}
+		return time.Unix(0, v.i).UTC()
+	case st.ArrayClass:
+		return m.arrayToGo(v.t.Dims, v.elems)
+	case st.StructClass, st.InstanceClass:
+		out := map[string]any{}
+		for _, f := range fieldsOf(v.t) {
+			if fv := v.fields[strings.ToUpper(f.Name)]; fv != nil {
+				out[f.Name] = m.toGo(fv)
+			}
+		}
+		return out
+	case st.PointerClass:
+		if v.t.Ref && v.ptr != nil {
+			return m.toGo(v.ptr)
+		}
+		return nil
+	}
+	return nil
+}
+
+// arrayToGo nests multi-dimensional arrays: [][]any for ARRAY[a, b].
+func (m *Machine) arrayToGo(dims []st.Dim, elems []*value) []any {
+	if len(dims) <= 1 {
+		out := make([]any, len(elems))
+		for i, e := range elems {
+			out[i] = m.toGo(e)
+		}
+		return out
+	}
+	n := int(dims[0].Len())
+	out := make([]any, n)
+	step := len(elems) / max(n, 1)
+	for i := range out {
+		out[i] = m.arrayToGo(dims[1:], elems[i*step:(i+1)*step])
+	}
+	return out
+}
+
+// fromGo stores a Go value in the variable dst.
+func (m *Machine) fromGo(dst *value, x any) {
+	dst = m.deref(dst)
+	t := dst.t
+	switch t.Class {
+	case st.ArrayClass:
+		m.arrayFromGo(dst.t.Dims, dst.elems, x)
+		return
+	case st.StructClass, st.InstanceClass:
+		mp, ok := x.(map[string]any)
+		if !ok {
+			m.fail("cannot use %T as %s", x, t.Name)
+		}
+		for k, fx := range mp {
+			fv := dst.fields[strings.ToUpper(k)]
+			if fv == nil {
+				m.fail("%s has no member %s", t.Name, k)
+			}
+			m.fromGo(fv, fx)
+		}
+		return
+	case st.EnumClass:
+		if s, ok := x.(string); ok {
+			if i := strings.LastIndexAny(s, "#."); i >= 0 {
+				s = s[i+1:]
+			}
+			mem := t.Member(s)
+			if mem == nil {
+				m.fail("%s has no value %s", t.Name, s)
+			}
+			dst.i = mem.Value
+			return
+		}
+	}
+
+	var src *value
+	rv := reflect.ValueOf(x)
+	switch x := x.(type) {
+	case bool:
+		src = boolValue(x)
+	case time.Duration:
+		src = &value{t: st.TypeLTime, i: int64(x)}
+	case time.Time:
+		src = &value{t: st.TypeLDT, i: x.UnixNano()}
+	case string:
+		src = &value{t: st.StringOf(utf8.RuneCountInString(x), true), s: x}
+	default:
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			src = &value{t: st.TypeLInt, i: rv.Int()}
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			src = &value{t: st.TypeULInt, i: int64(rv.Uint())}
+		case reflect.Float32, reflect.Float64:
+			src = &value{t: st.TypeLReal, f: rv.Float()}
+		}
+	}
+	if src == nil || !goAssignable(t, src.t) {
+		m.fail("cannot use %T value as %s", x, t.Name)
+	}
+	if lo, hi, ok := t.Range(); ok && src.t.Class == st.IntClass {
+		n := src.i
+		if src.t.Signed && (n < lo || n > hi) || !src.t.Signed && !unsigned64(t) && (uint64(n) > uint64(hi) || n < 0) {
+			m.fail("%v overflows %s", x, t.Name)
+		}
+	}
+	m.store(dst, src)
+}
+
+// goAssignable reports whether a Go value of class src may set a variable
+// of type t.
+func goAssignable(t, src *st.Type) bool {
+	switch t.Class {
+	case st.BoolClass:
+		return src.Class == st.BoolClass
+	case st.IntClass, st.BitsClass, st.EnumClass, st.CharClass:
+		return src.Class == st.IntClass
+	case st.RealClass:
+		return src.Class == st.IntClass || src.Class == st.RealClass
+	case st.StringClass:
+		return src.Class == st.StringClass
+	case st.TimeClass:
+		return src.Class == st.TimeClass
+	case st.DateClass:
+		if t == st.TypeTOD || t == st.TypeLTOD {
+			return src.Class == st.TimeClass
+		}
+		return src.Class == st.DateClass
+	}
+	return false
+}
+
+func (m *Machine) arrayFromGo(dims []st.Dim, elems []*value, x any) {
+	xs, ok := x.([]any)
+	if !ok {
+		rv := reflect.ValueOf(x)
+		if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+			m.fail("cannot use %T as an array", x)
+		}
+		xs = make([]any, rv.Len())
+		for i := range xs {
+			xs[i] = rv.Index(i).Interface()
+		}
+	}
+	n := 0
+	if len(dims) > 0 {
+		n = int(dims[0].Len())
+	}
+	if len(xs) > n {
+		m.fail("%d values for an array of %d", len(xs), n)
+	}
+	if len(dims) <= 1 {
+		for i, e := range xs {
+			m.fromGo(elems[i], e)
+		}
+		return
+	}
+	step := len(elems) / max(n, 1)
+	for i, e := range xs {
+		m.arrayFromGo(dims[1:], elems[i*step:(i+1)*step], e)
+	}
+}
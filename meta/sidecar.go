@@ -0,0 +1,40 @@
+// Package meta writes the <name>.meta.json sidecars in which the importers
+// keep the metadata of an object that has no place in its .st file, such as
+// CoDeSys 3.5 GUIDs or CoDeSys 2.3 object flags.
+//
+// Several importers may write to the same sidecar, each owning its own keys,
+// so a sidecar is always merged key by key rather than overwritten.
+package meta
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// WriteSidecar merges fields into the JSON sidecar at path. Keys written by
+// other importers are kept; nil values remove a key.
+func WriteSidecar(path string, fields map[string]any) error {
+	doc := make(map[string]json.RawMessage)
+	if raw, err := os.ReadFile(path); err == nil {
+		if err := json.Unmarshal(raw, &doc); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	for k, v := range fields {
+		if v == nil {
+			delete(doc, k)
+			continue
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		doc[k] = b
+	}
+	out, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(out, '\n'), 0644)
+}
@@ -0,0 +1,75 @@
+// Package repro provides the object GUIDs and the export timestamp of the
+// exporters. By default GUIDs are random and the timestamp is the current
+// time; in reproducible mode GUIDs are derived from the project name and
+// an object key, and the timestamp is fixed, so exporting the same tree
+// twice gives identical output. SOURCE_DATE_EPOCH or an explicit time
+// override the timestamp in either mode.
+package repro
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// nsURL is the RFC 4122 URL namespace used to derive project namespaces.
+var nsURL = []byte{0x6b, 0xa7, 0xb8, 0x11, 0x9d, 0xad, 0x11, 0xd1,
+	0x80, 0xb4, 0x00, 0xc0, 0x4f, 0xd4, 0x30, 0xc8}
+
+// Namespace returns the UUIDv5 namespace of the GUIDs of project.
+func Namespace(project string) []byte {
+	return uuidV5(nsURL, "iec-st-tools:"+project)
+}
+
+func uuidV5(ns []byte, name string) []byte {
+	h := sha1.New()
+	h.Write(ns)
+	h.Write([]byte(name))
+	b := h.Sum(nil)[:16]
+	b[6] = (b[6] & 0x0f) | 0x50 // version 5
+	b[8] = (b[8] & 0x3f) | 0x80 // variant 1
+	return b
+}
+
+// GUID returns a GUID for the object identified by key: a UUIDv5 of key
+// within ns, or a random (v4) GUID when ns is nil.
+func GUID(ns []byte, key string) string {
+	var b []byte
+	if ns != nil {
+		b = uuidV5(ns, key)
+	} else {
+		b = make([]byte, 16)
+		_, _ = rand.Read(b)
+		b[6] = (b[6] & 0x0f) | 0x40 // version 4
+		b[8] = (b[8] & 0x3f) | 0x80 // variant 1
+	}
+	return fmt.Sprintf("%08x-%04x-%04x-%04x-%012x",
+		b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// BuildTime returns the export timestamp: at, in RFC 3339 format, when it
+// is given, then SOURCE_DATE_EPOCH if set, the Unix epoch in reproducible
+// mode, and the current time otherwise.
+func BuildTime(at string, reproducible bool) (time.Time, error) {
+	if at != "" {
+		t, err := time.Parse(time.RFC3339Nano, at)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid time %q (want RFC 3339, e.g. 2026-02-26T16:23:28Z)", at)
+		}
+		return t.UTC(), nil
+	}
+	if sde := os.Getenv("SOURCE_DATE_EPOCH"); sde != "" {
+		secs, err := strconv.ParseInt(sde, 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid SOURCE_DATE_EPOCH %q", sde)
+		}
+		return time.Unix(secs, 0).UTC(), nil
+	}
+	if reproducible {
+		return time.Unix(0, 0).UTC(), nil
+	}
+	return time.Now(), nil
+}
@@ -0,0 +1,47 @@
+package repro
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGUID(t *testing.T) {
+	ns := Namespace("export")
+	a, b := GUID(ns, "object:Foo"), GUID(ns, "object:Foo")
+	if a != b {
+		t.Errorf("reproducible GUIDs differ: %s, %s", a, b)
+	}
+	if a == GUID(ns, "object:Bar") || a == GUID(Namespace("other"), "object:Foo") {
+		t.Error("different keys or projects give the same GUID")
+	}
+	if a[14] != '5' {
+		t.Errorf("%s is not a version 5 UUID", a)
+	}
+	if r := GUID(nil, "object:Foo"); r[14] != '4' || r == GUID(nil, "object:Foo") {
+		t.Errorf("%s is not a random version 4 UUID", r)
+	}
+}
+
+func TestBuildTime(t *testing.T) {
+	t.Setenv("SOURCE_DATE_EPOCH", "")
+	if got, _ := BuildTime("", true); !got.Equal(time.Unix(0, 0)) {
+		t.Errorf("reproducible build time %v, want the Unix epoch", got)
+	}
+	t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+	for _, reproducible := range []bool{false, true} {
+		if got, err := BuildTime("", reproducible); err != nil || !got.Equal(time.Unix(1700000000, 0)) {
+			t.Errorf("BuildTime(%v) = %v, %v; want SOURCE_DATE_EPOCH", reproducible, got, err)
+		}
+	}
+	at := "2026-02-26T16:23:28.3873371Z"
+	if got, err := BuildTime(at, true); err != nil || got.Format(time.RFC3339Nano) != at {
+		t.Errorf("BuildTime(%q) = %v, %v; want the given time", at, got, err)
+	}
+	if _, err := BuildTime("yesterday", false); err == nil {
+		t.Error("no error for an invalid time")
+	}
+	t.Setenv("SOURCE_DATE_EPOCH", "yesterday")
+	if _, err := BuildTime("", false); err == nil {
+		t.Error("no error for an invalid SOURCE_DATE_EPOCH")
+	}
+}
@@ -0,0 +1,583 @@
+package st
+
+import "strings"
+
+// ── AST ───────────────────────────────────────────────────────────────────────
+
+// Node is implemented by every AST node.
+type Node interface {
+	Pos() Pos // first character of the node
+}
+
+// File is one parsed .st file.
+type File struct {
+	Name     string  // file name as passed to Parse
+	Decls    []Decl  // top-level declarations in source order
+	Comments []Token // every comment of the file, in source order
+	Source   string  // the parsed source text
+}
+
+// ── Declarations ──────────────────────────────────────────────────────────────
+
+// Decl is a top-level declaration: *POU, *TypeBlock, *Configuration or a bare
+// *VarBlock (a CoDeSys GVL).
+type Decl interface {
+	Node
+	declNode()
+}
+
+// POUKind distinguishes the program organisation units.
+type POUKind int
+
+const (
+	Program POUKind = iota
+	FunctionBlock
+	Function
+	Method
+)
+
+func (k POUKind) String() string {
+	switch k {
+	case Program:
+		return "PROGRAM"
+	case FunctionBlock:
+		return "FUNCTION_BLOCK"
+	case Function:
+		return "FUNCTION"
+	case Method:
+		return "METHOD"
+	}
+	return "?"
+}
+
+// Pragma is a {…} pragma such as {attribute 'test'}.
+type Pragma struct {
+	Text    string // full text including braces
+	PragPos Pos
+}
+
+func (p *Pragma) Pos() Pos { return p.PragPos }
+
+// Attribute returns name and value of an {attribute 'name' := 'value'}
+// pragma. ok is false for other pragmas.
+func (p *Pragma) Attribute() (name, value string, ok bool) {
+	return parseAttribute(p.Text)
+}
+
+// POU is a PROGRAM, FUNCTION_BLOCK, FUNCTION or METHOD.
+type POU struct {
+	Kind       POUKind
+	Name       *Ident
+	ReturnType TypeSpec // FUNCTION and METHOD only, may be nil
+	Extends    *Ident   // FUNCTION_BLOCK … EXTENDS base
+	Pragmas    []*Pragma
+	VarBlocks  []*VarBlock
+	Methods    []*POU      // FUNCTION_BLOCK only
+	Properties []*Property // FUNCTION_BLOCK only
+	Body       []Stmt
+	Doc        string // comment lines directly above the header
+	KwPos      Pos
+	EndPos     Pos // position of the END_… keyword
+}
+
+func (d *POU) Pos() Pos { return d.KwPos }
+func (*POU) declNode()  {}
+
+// Attribute returns the value of {attribute 'name' …} on the POU.
+func (d *POU) Attribute(name string) (string, bool) { return findAttribute(d.Pragmas, name) }
+
+// Property is a PROPERTY of a FUNCTION_BLOCK. Its GET and SET accessors are
+// METHODs named after the property; GET returns the property type.
+type Property struct {
+	Name    *Ident
+	Type    TypeSpec
+	Pragmas []*Pragma
+	Get     *POU // nil when there is no GET accessor
+	Set     *POU // nil when there is no SET accessor
+	KwPos   Pos
+	EndPos  Pos // position of END_PROPERTY
+}
+
+func (d *Property) Pos() Pos { return d.KwPos }
+
+// VarBlock is a VAR … END_VAR section.
+type VarBlock struct {
+	Kind       string // VAR, VAR_INPUT, VAR_OUTPUT, VAR_IN_OUT, VAR_GLOBAL, …
+	Constant   bool
+	Retain     bool
+	Persistent bool
+	Pragmas    []*Pragma
+	Vars       []*VarDecl
+	KwPos      Pos
+	EndPos     Pos
+}
+
+func (b *VarBlock) Pos() Pos { return b.KwPos }
+func (*VarBlock) declNode()  {}
+
+// Attribute returns the value of {attribute 'name' …} in front of the block.
+func (b *VarBlock) Attribute(name string) (string, bool) { return findAttribute(b.Pragmas, name) }
+
+// VarDecl declares one or more variables of the same type.
+type VarDecl struct {
+	Names   []*Ident
+	At      *Token // location such as %IX0.0, nil if not located
+	Type    TypeSpec
+	Init    Expr // may be nil
+	Pragmas []*Pragma
+	Comment string // trailing comment on the same line, or comment lines above
+}
+
+func (v *VarDecl) Pos() Pos { return v.Names[0].NamePos }
+
+// Attribute returns the value of {attribute 'name' …} on the declaration.
+func (v *VarDecl) Attribute(name string) (string, bool) { return findAttribute(v.Pragmas, name) }
+
+// TypeBlock is a TYPE … END_TYPE block with one or more type declarations.
+type TypeBlock struct {
+	Types  []*TypeDecl
+	KwPos  Pos
+	EndPos Pos
+}
+
+func (b *TypeBlock) Pos() Pos { return b.KwPos }
+func (*TypeBlock) declNode()  {}
+
+// TypeDecl declares one named type.
+type TypeDecl struct {
+	Name    *Ident
+	Extends *Ident // STRUCT … EXTENDS base, may be nil
+	Type    TypeSpec
+	Init    Expr // default value, may be nil
+	Pragmas []*Pragma
+	Comment string
+}
+
+func (t *TypeDecl) Pos() Pos { return t.Name.NamePos }
+
+// Attribute returns the value of {attribute 'name' …} on the type.
+func (t *TypeDecl) Attribute(name string) (string, bool) { return findAttribute(t.Pragmas, name) }
+
+// Configuration is a CONFIGURATION … END_CONFIGURATION block. The importers
+// wrap GVLs in it; a full configuration can also declare resources and tasks.
+type Configuration struct {
+	Name      *Ident
+	Pragmas   []*Pragma
+	VarBlocks []*VarBlock
+	Resources []*Resource
+	KwPos     Pos
+	EndPos    Pos
+}
+
+func (c *Configuration) Pos() Pos { return c.KwPos }
+func (*Configuration) declNode()  {}
+
+// Resource is a RESOURCE … END_RESOURCE block inside a configuration.
+type Resource struct {
+	Name      *Ident
+	On        *Ident
+	VarBlocks []*VarBlock
+	Tasks     []*TaskDecl
+	Programs  []*ProgramConfig
+	KwPos     Pos
+}
+
+func (r *Resource) Pos() Pos { return r.KwPos }
+
+// TaskDecl is TASK name (INTERVAL := …, PRIORITY := …);
+type TaskDecl struct {
+	Name   *Ident
+	Params []*Arg
+	KwPos  Pos
+}
+
+func (t *TaskDecl) Pos() Pos { return t.KwPos }
+
+// ProgramConfig is PROGRAM inst [WITH task] : Type;
+type ProgramConfig struct {
+	Name  *Ident
+	Task  *Ident // may be nil
+	Type  *Ident
+	KwPos Pos
+}
+
+func (p *ProgramConfig) Pos() Pos { return p.KwPos }
+
+// ── Types ─────────────────────────────────────────────────────────────────────
+
+// TypeSpec is a type expression in a declaration.
+type TypeSpec interface {
+	Node
+	typeNode()
+}
+
+// NamedType refers to an elementary or user-defined type by name.
+type NamedType struct {
+	Name *Ident
+}
+
+// StringType is STRING or WSTRING with an optional length: STRING(80), STRING[80].
+type StringType struct {
+	Wide  bool
+	Len   Expr // may be nil
+	KwPos Pos
+}
+
+// ArrayType is ARRAY[lo..hi, …] OF Elem.
+type ArrayType struct {
+	Dims  []*Subrange
+	Elem  TypeSpec
+	KwPos Pos
+}
+
+// Subrange is lo..hi, used for array bounds and subrange types.
+type Subrange struct {
+	Lo, Hi Expr
+}
+
+// PointerType is POINTER TO Elem or REFERENCE TO Elem.
+type PointerType struct {
+	Ref   bool
+	Elem  TypeSpec
+	KwPos Pos
+}
+
+// StructType is STRUCT … END_STRUCT.
+type StructType struct {
+	Fields []*VarDecl
+	KwPos  Pos
+	EndPos Pos
+}
+
+// EnumType is (a, b := 2, c) with an optional base type after the list.
+type EnumType struct {
+	Values []*EnumValue
+	Base   TypeSpec // may be nil
+	LPos   Pos
+}
+
+// EnumValue is one member of an enumeration.
+type EnumValue struct {
+	Name    *Ident
+	Value   Expr // may be nil
+	Comment string
+}
+
+// SubrangeType is INT(lo..hi).
+type SubrangeType struct {
+	Base  TypeSpec
+	Range *Subrange
+}
+
+func (t *NamedType) Pos() Pos    { return t.Name.NamePos }
+func (t *StringType) Pos() Pos   { return t.KwPos }
+func (t *ArrayType) Pos() Pos    { return t.KwPos }
+func (t *PointerType) Pos() Pos  { return t.KwPos }
+func (t *StructType) Pos() Pos   { return t.KwPos }
+func (t *EnumType) Pos() Pos     { return t.LPos }
+func (t *SubrangeType) Pos() Pos { return t.Base.Pos() }
+
+func (*NamedType) typeNode()    {}
+func (*StringType) typeNode()   {}
+func (*ArrayType) typeNode()    {}
+func (*PointerType) typeNode()  {}
+func (*StructType) typeNode()   {}
+func (*EnumType) typeNode()     {}
+func (*SubrangeType) typeNode() {}
+
+// ── Statements ────────────────────────────────────────────────────────────────
+
+// Stmt is a statement of a POU body.
+type Stmt interface {
+	Node
+	stmtNode()
+}
+
+// AssignStmt is Target := Value; (or Target REF= Value, not supported).
+type AssignStmt struct {
+	Target Expr
+	Value  Expr
+}
+
+// CallStmt is a function, FB instance or method call used as a statement.
+type CallStmt struct {
+	Call *CallExpr
+}
+
+// IfStmt is IF … THEN … {ELSIF … THEN …} [ELSE …] END_IF.
+type IfStmt struct {
+	Cond    Expr
+	Then    []Stmt
+	Elsifs  []*ElsifClause
+	Else    []Stmt // nil when there is no ELSE
+	HasElse bool
+	KwPos   Pos
+	EndPos  Pos
+}
+
+// ElsifClause is one ELSIF branch.
+type ElsifClause struct {
+	Cond  Expr
+	Body  []Stmt
+	KwPos Pos
+}
+
+// CaseStmt is CASE sel OF … [ELSE …] END_CASE.
+type CaseStmt struct {
+	Selector Expr
+	Cases    []*CaseClause
+	Else     []Stmt
+	HasElse  bool
+	KwPos    Pos
+	EndPos   Pos
+}
+
+// CaseClause is one labelled branch. Labels are expressions or *RangeExpr.
+type CaseClause struct {
+	Labels []Expr
+	Body   []Stmt
+}
+
+// ForStmt is FOR v := from TO to [BY step] DO … END_FOR.
+type ForStmt struct {
+	Var    *Ident
+	From   Expr
+	To     Expr
+	By     Expr // may be nil
+	Body   []Stmt
+	KwPos  Pos
+	EndPos Pos
+}
+
+// WhileStmt is WHILE cond DO … END_WHILE.
+type WhileStmt struct {
+	Cond   Expr
+	Body   []Stmt
+	KwPos  Pos
+	EndPos Pos
+}
+
+// RepeatStmt is REPEAT … UNTIL cond END_REPEAT.
+type RepeatStmt struct {
+	Body   []Stmt
+	Cond   Expr
+	KwPos  Pos
+	EndPos Pos
+}
+
+// ExitStmt, ContinueStmt and ReturnStmt are the jump statements.
+type ExitStmt struct{ KwPos Pos }
+type ContinueStmt struct{ KwPos Pos }
+type ReturnStmt struct{ KwPos Pos }
+
+// EmptyStmt is a lone semicolon.
+type EmptyStmt struct{ SemiPos Pos }
+
+func (s *AssignStmt) Pos() Pos   { return s.Target.Pos() }
+func (s *CallStmt) Pos() Pos     { return s.Call.Pos() }
+func (s *IfStmt) Pos() Pos       { return s.KwPos }
+func (s *CaseStmt) Pos() Pos     { return s.KwPos }
+func (s *ForStmt) Pos() Pos      { return s.KwPos }
+func (s *WhileStmt) Pos() Pos    { return s.KwPos }
+func (s *RepeatStmt) Pos() Pos   { return s.KwPos }
+func (s *ExitStmt) Pos() Pos     { return s.KwPos }
+func (s *ContinueStmt) Pos() Pos { return s.KwPos }
+func (s *ReturnStmt) Pos() Pos   { return s.KwPos }
+func (s *EmptyStmt) Pos() Pos    { return s.SemiPos }
+
+func (*AssignStmt) stmtNode()   {}
+func (*CallStmt) stmtNode()     {}
+func (*IfStmt) stmtNode()       {}
+func (*CaseStmt) stmtNode()     {}
+func (*ForStmt) stmtNode()      {}
+func (*WhileStmt) stmtNode()    {}
+func (*RepeatStmt) stmtNode()   {}
+func (*ExitStmt) stmtNode()     {}
+func (*ContinueStmt) stmtNode() {}
+func (*ReturnStmt) stmtNode()   {}
+func (*EmptyStmt) stmtNode()    {}
+
+// ── Expressions ───────────────────────────────────────────────────────────────
+
+// Expr is an expression.
+type Expr interface {
+	Node
+	exprNode()
+}
+
+// Ident is a name.
+type Ident struct {
+	Name    string
+	NamePos Pos
+}
+
+// Literal is a numeric, boolean, string or time literal. Text is the source
+// spelling, including any type prefix such as INT#.
+type Literal struct {
+	Kind   Kind // Int, Real, String, WString, Time or Keyword (TRUE/FALSE)
+	Text   string
+	LitPos Pos
+}
+
+// EnumLiteral is a qualified enumeration value: Type#Value.
+type EnumLiteral struct {
+	Type  *Ident
+	Value *Ident
+}
+
+// BinaryExpr is X Op Y. Op is the upper-case operator spelling: +, -, *, /,
+// MOD, **, =, <>, <, >, <=, >=, AND, OR, XOR, AND_THEN, OR_ELSE. & is
+// normalised to AND.
+type BinaryExpr struct {
+	Op    string
+	X, Y  Expr
+	OpPos Pos
+}
+
+// UnaryExpr is Op X with Op one of -, + or NOT.
+type UnaryExpr struct {
+	Op    string
+	X     Expr
+	OpPos Pos
+}
+
+// ParenExpr is (X).
+type ParenExpr struct {
+	X      Expr
+	LParen Pos
+}
+
+// MemberExpr is X.Name. Name may be a bit number for bit access (x.3).
+type MemberExpr struct {
+	X    Expr
+	Name *Ident
+}
+
+// IndexExpr is X[i, j, …].
+type IndexExpr struct {
+	X       Expr
+	Indices []Expr
+}
+
+// DerefExpr is X^.
+type DerefExpr struct {
+	X Expr
+}
+
+// CallExpr is Func(args). Arguments are positional or named (IN := x,
+// Q => y, NOT Q => y).
+type CallExpr struct {
+	Func   Expr
+	Args   []*Arg
+	RParen Pos
+}
+
+// Arg is one call argument.
+type Arg struct {
+	Name   *Ident // nil for positional arguments
+	Output bool   // Name => Value
+	Not    bool   // NOT Name => Value
+	Value  Expr   // may be nil for an empty output assignment
+}
+
+// RangeExpr is Lo..Hi in CASE labels.
+type RangeExpr struct {
+	Lo, Hi Expr
+}
+
+// ArrayInit is [1, 2, 3(0)] in an initialiser.
+type ArrayInit struct {
+	Elems  []*ArrayElem
+	LBrack Pos
+}
+
+// ArrayElem is Value or Count(Value) in an array initialiser.
+type ArrayElem struct {
+	Count Expr // nil when not repeated
+	Value Expr
+}
+
+// StructInit is (a := 1, b := 2) in an initialiser.
+type StructInit struct {
+	Fields []*FieldInit
+	LParen Pos
+}
+
+// FieldInit is one member initialisation.
+type FieldInit struct {
+	Name  *Ident
+	Value Expr
+}
+
+// AddressExpr is a direct address such as %IX0.0 used in an expression.
+type AddressExpr struct {
+	Text    string
+	AddrPos Pos
+}
+
+func (e *Ident) Pos() Pos       { return e.NamePos }
+func (e *Literal) Pos() Pos     { return e.LitPos }
+func (e *EnumLiteral) Pos() Pos { return e.Type.NamePos }
+func (e *BinaryExpr) Pos() Pos  { return e.X.Pos() }
+func (e *UnaryExpr) Pos() Pos   { return e.OpPos }
+func (e *ParenExpr) Pos() Pos   { return e.LParen }
+func (e *MemberExpr) Pos() Pos  { return e.X.Pos() }
+func (e *IndexExpr) Pos() Pos   { return e.X.Pos() }
+func (e *DerefExpr) Pos() Pos   { return e.X.Pos() }
+func (e *CallExpr) Pos() Pos    { return e.Func.Pos() }
+func (e *RangeExpr) Pos() Pos   { return e.Lo.Pos() }
+func (e *ArrayInit) Pos() Pos   { return e.LBrack }
+func (e *StructInit) Pos() Pos  { return e.LParen }
+func (e *AddressExpr) Pos() Pos { return e.AddrPos }
+
+func (*Ident) exprNode()       {}
+func (*Literal) exprNode()     {}
+func (*EnumLiteral) exprNode() {}
+func (*BinaryExpr) exprNode()  {}
+func (*UnaryExpr) exprNode()   {}
+func (*ParenExpr) exprNode()   {}
+func (*MemberExpr) exprNode()  {}
+func (*IndexExpr) exprNode()   {}
+func (*DerefExpr) exprNode()   {}
+func (*CallExpr) exprNode()    {}
+func (*RangeExpr) exprNode()   {}
+func (*ArrayInit) exprNode()   {}
+func (*StructInit) exprNode()  {}
+func (*AddressExpr) exprNode() {}
+
+// ExprString renders an expression in ST syntax for messages. Calls are
+// abbreviated to f(…).
+func ExprString(e Expr) string {
+	switch x := e.(type) {
+	case *Ident:
+		return x.Name
+	case *Literal:
+		return x.Text
+	case *EnumLiteral:
+		return x.Type.Name + "#" + x.Value.Name
+	case *MemberExpr:
+		return ExprString(x.X) + "." + x.Name.Name
+	case *IndexExpr:
+		idx := make([]string, len(x.Indices))
+		for i, e := range x.Indices {
+			idx[i] = ExprString(e)
+		}
+		return ExprString(x.X) + "[" + strings.Join(idx, ", ") + "]"
+	case *DerefExpr:
+		return ExprString(x.X) + "^"
+	case *ParenExpr:
+		return "(" + ExprString(x.X) + ")"
+	case *UnaryExpr:
+		if x.Op == "NOT" {
+			return "NOT " + ExprString(x.X)
+		}
+		return x.Op + ExprString(x.X)
+	case *BinaryExpr:
+		return ExprString(x.X) + " " + x.Op + " " + ExprString(x.Y)
+	case *CallExpr:
+		return ExprString(x.Func) + "(…)"
+	case *AddressExpr:
+		return x.Text
+	}
+	return "expression"
+}
@@ -0,0 +1,436 @@
+package st
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ── Standard function blocks ──────────────────────────────────────────────────
+
+// stdSource declares the interfaces of the IEC 61131-3 standard function
+// blocks. Their behaviour is implemented natively by the interpreter; here
+// they only provide names and types for checking, completion and hover.
+const stdSource = `
+FUNCTION_BLOCK TON
+VAR_INPUT
+    IN : BOOL;
+    PT : TIME;
+END_VAR
+VAR_OUTPUT
+    Q  : BOOL;
+    ET : TIME;
+END_VAR
+END_FUNCTION_BLOCK
+
+FUNCTION_BLOCK TOF
+VAR_INPUT
+    IN : BOOL;
+    PT : TIME;
+END_VAR
+VAR_OUTPUT
+    Q  : BOOL;
+    ET : TIME;
+END_VAR
+END_FUNCTION_BLOCK
+
+FUNCTION_BLOCK TP
+VAR_INPUT
+    IN : BOOL;
+    PT : TIME;
+END_VAR
+VAR_OUTPUT
+    Q  : BOOL;
+    ET : TIME;
+END_VAR
+END_FUNCTION_BLOCK
+
+FUNCTION_BLOCK R_TRIG
+VAR_INPUT
+    CLK : BOOL;
+END_VAR
+VAR_OUTPUT
+    Q : BOOL;
+END_VAR
+VAR
+    M : BOOL;
+END_VAR
+END_FUNCTION_BLOCK
+
+FUNCTION_BLOCK F_TRIG
+VAR_INPUT
+    CLK : BOOL;
+END_VAR
+VAR_OUTPUT
+    Q : BOOL;
+END_VAR
+VAR
+    M : BOOL;
+END_VAR
+END_FUNCTION_BLOCK
+
+FUNCTION_BLOCK CTU
+VAR_INPUT
+    CU    : BOOL;
+    RESET : BOOL;
+    PV    : WORD;
+END_VAR
+VAR_OUTPUT
+    Q  : BOOL;
+    CV : WORD;
+END_VAR
+END_FUNCTION_BLOCK
+
+FUNCTION_BLOCK CTD
+VAR_INPUT
+    CD   : BOOL;
+    LOAD : BOOL;
+    PV   : WORD;
+END_VAR
+VAR_OUTPUT
+    Q  : BOOL;
+    CV : WORD;
+END_VAR
+END_FUNCTION_BLOCK
+
+FUNCTION_BLOCK CTUD
+VAR_INPUT
+    CU    : BOOL;
+    CD    : BOOL;
+    RESET : BOOL;
+    LOAD  : BOOL;
+    PV    : WORD;
+END_VAR
+VAR_OUTPUT
+    QU : BOOL;
+    QD : BOOL;
+    CV : WORD;
+END_VAR
+END_FUNCTION_BLOCK
+
+FUNCTION_BLOCK SR
+VAR_INPUT
+    SET1  : BOOL;
+    RESET : BOOL;
+END_VAR
+VAR_OUTPUT
+    Q1 : BOOL;
+END_VAR
+END_FUNCTION_BLOCK
+
+FUNCTION_BLOCK RS
+VAR_INPUT
+    SET   : BOOL;
+    RESET1 : BOOL;
+END_VAR
+VAR_OUTPUT
+    Q1 : BOOL;
+END_VAR
+END_FUNCTION_BLOCK
+`
+
+// stdPOUs holds the parsed standard function blocks by upper-case name.
+var stdPOUs = map[string]*POU{}
+
+func init() {
+	f, err := Parse("<standard>", stdSource)
+	if err != nil {
+		panic("st: standard library: " + err.Error())
+	}
+	for _, d := range f.Decls {
+		if pou, ok := d.(*POU); ok {
+			stdPOUs[strings.ToUpper(pou.Name.Name)] = pou
+		}
+	}
+}
+
+// StandardPOUs returns the standard function blocks, in declaration order.
+func StandardPOUs() []*POU {
+	var out []*POU
+	for _, name := range []string{"TON", "TOF", "TP", "R_TRIG", "F_TRIG", "CTU", "CTD", "CTUD", "SR", "RS"} {
+		out = append(out, stdPOUs[name])
+	}
+	return out
+}
+
+// ── Test library ──────────────────────────────────────────────────────────────
+
+// testSource declares the assertion functions available to unit tests. They
+// resolve only in test files (see Project.IsTestFile); iecst test implements
+// them.
+const testSource = `
+FUNCTION AssertEquals : BOOL
+VAR_INPUT
+    Expected : ANY;
+    Actual   : ANY;
+    Message  : STRING(255);
+END_VAR
+END_FUNCTION
+
+FUNCTION AssertNotEquals : BOOL
+VAR_INPUT
+    Expected : ANY;
+    Actual   : ANY;
+    Message  : STRING(255);
+END_VAR
+END_FUNCTION
+
+FUNCTION AssertEquals_REAL : BOOL
+VAR_INPUT
+    Expected : REAL;
+    Actual   : REAL;
+    Delta    : REAL;
+    Message  : STRING(255);
+END_VAR
+END_FUNCTION
+
+FUNCTION AssertEquals_LREAL : BOOL
+VAR_INPUT
+    Expected : LREAL;
+    Actual   : LREAL;
+    Delta    : LREAL;
+    Message  : STRING(255);
+END_VAR
+END_FUNCTION
+
+FUNCTION AssertTrue : BOOL
+VAR_INPUT
+    Condition : BOOL;
+    Message   : STRING(255);
+END_VAR
+END_FUNCTION
+
+FUNCTION AssertFalse : BOOL
+VAR_INPUT
+    Condition : BOOL;
+    Message   : STRING(255);
+END_VAR
+END_FUNCTION
+
+FUNCTION TEST_FINISHED : BOOL
+END_FUNCTION
+`
+
+// testPOUs holds the parsed assertion functions by upper-case name,
+// testOrder in declaration order.
+var (
+	testPOUs  = map[string]*POU{}
+	testOrder []*POU
+)
+
+func init() {
+	f, err := Parse("<test>", testSource)
+	if err != nil {
+		panic("st: test library: " + err.Error())
+	}
+	for _, d := range f.Decls {
+		if pou, ok := d.(*POU); ok {
+			testPOUs[strings.ToUpper(pou.Name.Name)] = pou
+			testOrder = append(testOrder, pou)
+		}
+	}
+}
+
+// TestPOUs returns the assertion functions of the test library, in
+// declaration order.
+func TestPOUs() []*POU { return testOrder }
+
+// IsTestPath reports whether rel, the path of a .st file relative to its
+// source root, lies in a directory called test (in any letter case). The
+// root itself and the directories above it do not count, as in the
+// exporters' -src walk.
+func IsTestPath(rel string) bool {
+	dirs := strings.Split(filepath.ToSlash(filepath.Dir(rel)), "/")
+	for _, d := range dirs {
+		if strings.EqualFold(d, "test") {
+			return true
+		}
+	}
+	return false
+}
+
+// IsTestFile reports whether f holds unit tests: it lies in a directory
+// called test below one of p.Roots (see IsTestPath). A file outside the
+// roots, such as one named on the command line, is a test file if its own
+// directory is called test. The exporters can leave such files out and the
+// assertion functions resolve only inside them.
+func (p *Project) IsTestFile(f *File) bool {
+	for _, root := range p.Roots {
+		if rel, err := filepath.Rel(root, f.Name); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return IsTestPath(rel)
+		}
+	}
+	return IsTestPath(filepath.Join(filepath.Base(filepath.Dir(f.Name)), filepath.Base(f.Name)))
+}
+
+// ── Standard functions ────────────────────────────────────────────────────────
+
+// StdFunc describes a standard function: its argument count and how the
+// result type follows from the argument types.
+type StdFunc struct {
+	Name    string
+	MinArgs int
+	MaxArgs int // -1 for extensible functions such as MAX and CONCAT
+	Doc     string
+}
+
+var stdFuncs = map[string]StdFunc{}
+
+func init() {
+	for _, f := range []StdFunc{
+		{"ABS", 1, 1, "absolute value"},
+		{"SQRT", 1, 1, "square root"},
+		{"LN", 1, 1, "natural logarithm"},
+		{"LOG", 1, 1, "logarithm base 10"},
+		{"EXP", 1, 1, "natural exponential"},
+		{"SIN", 1, 1, "sine"},
+		{"COS", 1, 1, "cosine"},
+		{"TAN", 1, 1, "tangent"},
+		{"ASIN", 1, 1, "arc sine"},
+		{"ACOS", 1, 1, "arc cosine"},
+		{"ATAN", 1, 1, "arc tangent"},
+		{"EXPT", 2, 2, "IN1 raised to the power IN2"},
+		{"ADD", 2, -1, "sum"},
+		{"MUL", 2, -1, "product"},
+		{"SUB", 2, 2, "difference"},
+		{"DIV", 2, 2, "quotient"},
+		{"MOD", 2, 2, "remainder"},
+		{"MOVE", 1, 1, "assignment"},
+		{"SEL", 3, 3, "binary selection: IN0 if G is FALSE, IN1 if TRUE"},
+		{"MAX", 2, -1, "maximum"},
+		{"MIN", 2, -1, "minimum"},
+		{"LIMIT", 3, 3, "IN limited to MN..MX"},
+		{"MUX", 2, -1, "multiplexer: the K-th of the following inputs"},
+		{"SHL", 2, 2, "shift left"},
+		{"SHR", 2, 2, "shift right"},
+		{"ROL", 2, 2, "rotate left"},
+		{"ROR", 2, 2, "rotate right"},
+		{"LEN", 1, 1, "length of a string"},
+		{"LEFT", 2, 2, "leftmost SIZE characters"},
+		{"RIGHT", 2, 2, "rightmost SIZE characters"},
+		{"MID", 3, 3, "LEN characters from position POS"},
+		{"CONCAT", 2, -1, "concatenation"},
+		{"INSERT", 3, 3, "STR2 inserted into STR1 after position POS"},
+		{"DELETE", 3, 3, "LEN characters deleted from position POS"},
+		{"REPLACE", 4, 4, "L characters replaced by STR2 from position P"},
+		{"FIND", 2, 2, "position of STR2 in STR1, 0 if not found"},
+		{"ADR", 1, 1, "address of a variable"},
+		{"SIZEOF", 1, 1, "size of a variable or type in bytes"},
+		{"TRUNC", 1, 1, "real truncated towards zero"},
+	} {
+		stdFuncs[f.Name] = f
+	}
+}
+
+// LookupStdFunc returns the standard function called name, including the
+// type conversions X_TO_Y and TO_Y.
+func LookupStdFunc(name string) (StdFunc, bool) {
+	u := strings.ToUpper(name)
+	if f, ok := stdFuncs[u]; ok {
+		return f, true
+	}
+	if conversionTarget(u) != nil {
+		return StdFunc{Name: u, MinArgs: 1, MaxArgs: 1, Doc: "type conversion"}, true
+	}
+	return StdFunc{}, false
+}
+
+// StdFuncs returns the standard functions sorted by name. The type
+// conversions are not listed; LookupStdFunc recognises them by name.
+func StdFuncs() []StdFunc {
+	out := make([]StdFunc, 0, len(stdFuncs))
+	for _, f := range stdFuncs {
+		out = append(out, f)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// conversionTarget returns the target type of a conversion function such as
+// INT_TO_REAL, TO_DINT or BCD_TO_WORD, or nil.
+func conversionTarget(u string) *Type {
+	var from, to string
+	switch {
+	case strings.HasPrefix(u, "TO_"):
+		to = u[3:]
+	case strings.Contains(u, "_TO_"):
+		i := strings.LastIndex(u, "_TO_")
+		from, to = u[:i], u[i+4:]
+		if from != "BCD" && Elementary(from) == nil {
+			return nil
+		}
+	default:
+		if strings.HasPrefix(u, "TRUNC_") {
+			to = u[6:]
+		}
+	}
+	if to == "BCD" {
+		return TypeDWord
+	}
+	t := Elementary(to)
+	if t == nil || t.Class == AnyClass {
+		return nil
+	}
+	return t
+}
+
+// stdFunctionType returns the result type of a call of the standard
+// function name with the given arguments.
+func stdFunctionType(s *Scope, name string, args []*Arg) (*Type, bool) {
+	u := strings.ToUpper(name)
+	if _, ok := LookupStdFunc(u); !ok {
+		return nil, false
+	}
+	argType := func(i int) *Type {
+		if i < len(args) && args[i].Value != nil {
+			return s.TypeOf(args[i].Value)
+		}
+		return TypeAny
+	}
+	common := func(from int) *Type {
+		t := argType(from)
+		for i := from + 1; i < len(args); i++ {
+			t = commonType(t, argType(i))
+		}
+		if t.Untyped {
+			if t.Class == RealClass {
+				return TypeLReal
+			}
+			return TypeDInt
+		}
+		return t
+	}
+	if t := conversionTarget(u); t != nil {
+		return t, true
+	}
+	switch u {
+	case "ABS", "MOVE", "SHL", "SHR", "ROL", "ROR":
+		return common(0), true
+	case "SQRT", "LN", "LOG", "EXP", "SIN", "COS", "TAN", "ASIN", "ACOS", "ATAN", "EXPT":
+		if t := argType(0); t.Class == RealClass && !t.Untyped {
+			return t, true
+		}
+		return TypeReal, true
+	case "ADD", "MUL", "SUB", "DIV", "MOD", "MAX", "MIN":
+		return common(0), true
+	case "SEL", "MUX":
+		return common(1), true
+	case "LIMIT":
+		return common(0), true
+	case "LEN", "FIND":
+		return TypeInt, true
+	case "LEFT", "RIGHT", "MID", "CONCAT", "INSERT", "DELETE", "REPLACE":
+		if t := argType(0); t.Class == StringClass && t.Wide {
+			return StringOf(DefaultStringLen, true), true
+		}
+		return StringOf(DefaultStringLen, false), true
+	case "ADR":
+		t := argType(0)
+		return &Type{Class: PointerClass, Name: "POINTER TO " + t.Name, Elem: t, Bits: 64}, true
+	case "SIZEOF":
+		return TypeUDInt, true
+	case "TRUNC":
+		return TypeDInt, true
+	}
+	return TypeAny, true
+}
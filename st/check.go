@@ -0,0 +1,972 @@
+package st
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ── Type checking ─────────────────────────────────────────────────────────────
+
+// Check type-checks the whole project: every type name is resolved against
+// the elementary types, the project's data types and function blocks, and
+// every statement and expression is checked. It reports
+//
+//   - unknown types, identifiers, members and enumeration values
+//   - assignments and initial values of incompatible types, constants that
+//     do not fit their target, and assignments to constants, inputs of other
+//     instances and other values that cannot be written
+//   - calls of functions, methods and function block instances with unknown
+//     parameters, wrong argument counts or incompatible arguments
+//   - constant array indices outside the declared bounds
+//   - non-BOOL conditions, non-constant CASE labels and redeclared names
+//
+// Implicit narrowing conversions are allowed, as in CoDeSys; iecst lint
+// reports them. The result maps files to their errors sorted by position;
+// files without errors have no entry. Syntax errors are not included.
+func (p *Project) Check() map[*File]ErrorList {
+	c := &checker{p: p, errs: map[*File]ErrorList{}}
+	for _, sym := range p.dups {
+		c.file = sym.File
+		c.errorf(sym.Ident.NamePos, "%s redeclared", sym.Name)
+	}
+	for _, f := range p.Files {
+		c.file = f
+		for _, d := range f.Decls {
+			switch d := d.(type) {
+			case *POU:
+				c.pou(d)
+				for _, m := range d.Methods {
+					c.pou(m)
+				}
+			case *TypeBlock:
+				c.scope = p.global
+				for _, td := range d.Types {
+					c.typeDecl(td)
+				}
+			case *Configuration:
+				c.scope = p.global
+				c.varBlocks(d.VarBlocks)
+				for _, r := range d.Resources {
+					c.resource(r)
+				}
+			case *VarBlock:
+				c.scope = p.global
+				c.varBlocks([]*VarBlock{d})
+			}
+		}
+	}
+	for _, list := range c.errs {
+		list.Sort()
+	}
+	return c.errs
+}
+
+type checker struct {
+	p     *Project
+	file  *File
+	scope *Scope
+	loops int // nesting depth of FOR, WHILE and REPEAT
+	errs  map[*File]ErrorList
+}
+
+func (c *checker) errorf(pos Pos, format string, args ...any) {
+	list := c.errs[c.file]
+	list.Add(pos, format, args...)
+	c.errs[c.file] = list
+}
+
+// ── Declarations ──────────────────────────────────────────────────────────────
+
+func (c *checker) pou(d *POU) {
+	c.scope = c.p.Scope(d)
+	if d.Extends != nil {
+		switch base := c.p.POU(d.Extends.Name); {
+		case base == nil:
+			c.errorf(d.Extends.NamePos, "unknown function block %s", d.Extends.Name)
+		case base.Kind != FunctionBlock:
+			c.errorf(d.Extends.NamePos, "%s is a %s, not a function block", base.Name.Name, base.Kind)
+		}
+	}
+	if d.ReturnType != nil {
+		c.typeSpec(d.ReturnType)
+	}
+	seen := map[string]bool{}
+	if d.ReturnType != nil {
+		seen[strings.ToUpper(d.Name.Name)] = true
+	}
+	for _, b := range d.VarBlocks {
+		for _, v := range b.Vars {
+			for _, id := range v.Names {
+				key := strings.ToUpper(id.Name)
+				if seen[key] {
+					c.errorf(id.NamePos, "%s redeclared in %s", id.Name, d.Name.Name)
+				}
+				seen[key] = true
+			}
+		}
+	}
+	c.varBlocks(d.VarBlocks)
+	c.loops = 0
+	c.stmts(d.Body)
+}
+
+func (c *checker) varBlocks(blocks []*VarBlock) {
+	for _, b := range blocks {
+		for _, v := range b.Vars {
+			c.typeSpec(v.Type)
+			if v.Init != nil {
+				t := c.scope.ResolveType(v.Type)
+				c.init(v.Init, t, v.Names[0].Name)
+			}
+		}
+	}
+}
+
+func (c *checker) resource(r *Resource) {
+	c.varBlocks(r.VarBlocks)
+	tasks := map[string]bool{}
+	for _, t := range r.Tasks {
+		tasks[strings.ToUpper(t.Name.Name)] = true
+		for _, a := range t.Params {
+			if a.Value != nil {
+				c.expr(a.Value)
+			}
+		}
+	}
+	for _, pc := range r.Programs {
+		if d := c.p.POU(pc.Type.Name); d == nil || d.Kind != Program {
+			c.errorf(pc.Type.NamePos, "unknown program %s", pc.Type.Name)
+		}
+		if pc.Task != nil && !tasks[strings.ToUpper(pc.Task.Name)] {
+			c.errorf(pc.Task.NamePos, "unknown task %s", pc.Task.Name)
+		}
+	}
+}
+
+func (c *checker) typeDecl(td *TypeDecl) {
+	if td.Extends != nil {
+		if base := c.p.TypeDecl(td.Extends.Name); base == nil {
+			c.errorf(td.Extends.NamePos, "unknown structure %s", td.Extends.Name)
+		} else if _, ok := base.Type.(*StructType); !ok {
+			c.errorf(td.Extends.NamePos, "%s is not a structure", td.Extends.Name)
+		}
+	}
+	c.typeSpec(td.Type)
+	if td.Init != nil {
+		c.init(td.Init, c.p.typeDeclType(td), td.Name.Name)
+	}
+}
+
+// typeSpec checks that the names in a type expression resolve to types and
+// that lengths and array bounds are constants.
+func (c *checker) typeSpec(ts TypeSpec) {
+	switch t := ts.(type) {
+	case *NamedType:
+		if c.scope.ResolveType(t).Class != InvalidClass {
+			return
+		}
+		if d := c.p.POU(t.Name.Name); d != nil {
+			c.errorf(t.Name.NamePos, "%s is a %s, not a type", d.Name.Name, d.Kind)
+		} else {
+			c.errorf(t.Name.NamePos, "unknown type %s", t.Name.Name)
+		}
+	case *StringType:
+		if t.Len != nil {
+			if n, ok := c.scope.ConstInt(t.Len); !ok {
+				c.errorf(t.Len.Pos(), "string length must be a constant")
+			} else if n < 1 {
+				c.errorf(t.Len.Pos(), "invalid string length %d", n)
+			}
+		}
+	case *ArrayType:
+		for _, d := range t.Dims {
+			lo, ok1 := c.scope.ConstInt(d.Lo)
+			hi, ok2 := c.scope.ConstInt(d.Hi)
+			switch {
+			case !ok1:
+				c.errorf(d.Lo.Pos(), "array bound must be a constant")
+			case !ok2:
+				c.errorf(d.Hi.Pos(), "array bound must be a constant")
+			case lo > hi:
+				c.errorf(d.Lo.Pos(), "array lower bound %d exceeds upper bound %d", lo, hi)
+			}
+		}
+		c.typeSpec(t.Elem)
+	case *PointerType:
+		c.typeSpec(t.Elem)
+	case *StructType:
+		seen := map[string]bool{}
+		for _, v := range t.Fields {
+			for _, id := range v.Names {
+				if key := strings.ToUpper(id.Name); seen[key] {
+					c.errorf(id.NamePos, "member %s redeclared", id.Name)
+				} else {
+					seen[key] = true
+				}
+			}
+			c.typeSpec(v.Type)
+			if v.Init != nil {
+				c.init(v.Init, c.scope.ResolveType(v.Type), v.Names[0].Name)
+			}
+		}
+	case *EnumType:
+		seen := map[string]bool{}
+		for _, v := range t.Values {
+			if key := strings.ToUpper(v.Name.Name); seen[key] {
+				c.errorf(v.Name.NamePos, "enumeration value %s redeclared", v.Name.Name)
+			} else {
+				seen[key] = true
+			}
+			if v.Value != nil {
+				if _, ok := c.scope.ConstInt(v.Value); !ok {
+					c.errorf(v.Value.Pos(), "enumeration value must be an integer constant")
+				}
+			}
+		}
+		if t.Base != nil {
+			c.typeSpec(t.Base)
+			if bt := c.scope.ResolveType(t.Base); bt.Class != InvalidClass && !bt.IsInteger() {
+				c.errorf(t.Base.Pos(), "enumeration base type must be an integer type, not %s", bt)
+			}
+		}
+	case *SubrangeType:
+		c.typeSpec(t.Base)
+		if bt := c.scope.ResolveType(t.Base); bt.Class != InvalidClass && !bt.IsInteger() {
+			c.errorf(t.Base.Pos(), "subrange base type must be an integer type, not %s", bt)
+		}
+		for _, e := range []Expr{t.Range.Lo, t.Range.Hi} {
+			if _, ok := c.scope.ConstInt(e); !ok {
+				c.errorf(e.Pos(), "subrange bound must be a constant")
+			}
+		}
+	}
+}
+
+// init checks an initial value against the declared type; structure and
+// array initialisers are checked member by member.
+func (c *checker) init(e Expr, t *Type, what string) {
+	switch e := e.(type) {
+	case *StructInit:
+		if t.Class != StructClass && t.Class != InstanceClass && t.Class != InvalidClass {
+			c.errorf(e.LParen, "structure initialiser for %s of type %s", what, t)
+			return
+		}
+		for _, fi := range e.Fields {
+			f := t.Field(fi.Name.Name)
+			if f == nil {
+				if t.Class != InvalidClass {
+					c.errorf(fi.Name.NamePos, "%s has no member %s", t, fi.Name.Name)
+				}
+				c.expr(fi.Value)
+				continue
+			}
+			c.init(fi.Value, f.Type, fi.Name.Name)
+		}
+	case *ArrayInit:
+		if t.Class != ArrayClass {
+			if t.Class != InvalidClass {
+				c.errorf(e.LBrack, "array initialiser for %s of type %s", what, t)
+			}
+			return
+		}
+		var n int64
+		for _, el := range e.Elems {
+			count := int64(1)
+			if el.Count != nil {
+				v, ok := c.scope.ConstInt(el.Count)
+				if !ok {
+					c.errorf(el.Count.Pos(), "repeat count must be a constant")
+				}
+				count = v
+			}
+			n += count
+			c.init(el.Value, t.Elem, what)
+		}
+		size := int64(1)
+		for _, d := range t.Dims {
+			if !d.Known {
+				return
+			}
+			size *= d.Len()
+		}
+		if n > size {
+			c.errorf(e.LBrack, "%d initial values for %s of %d elements", n, what, size)
+		}
+	default:
+		c.convert(e, t, c.expr(e), "initial value of "+what)
+	}
+}
+
+// ── Statements ────────────────────────────────────────────────────────────────
+
+func (c *checker) stmts(list []Stmt) {
+	for _, s := range list {
+		c.stmt(s)
+	}
+}
+
+func (c *checker) stmt(s Stmt) {
+	switch s := s.(type) {
+	case *AssignStmt:
+		tt := c.target(s.Target)
+		vt := c.expr(s.Value)
+		c.convert(s.Value, tt, vt, "assignment to "+ExprString(s.Target))
+	case *CallStmt:
+		c.expr(s.Call)
+	case *IfStmt:
+		c.cond(s.Cond, "IF")
+		c.stmts(s.Then)
+		for _, e := range s.Elsifs {
+			c.cond(e.Cond, "ELSIF")
+			c.stmts(e.Body)
+		}
+		c.stmts(s.Else)
+	case *CaseStmt:
+		sel := c.expr(s.Selector)
+		if sel.Class != InvalidClass && !sel.IsInteger() && sel.Class != BitsClass && sel.Class != EnumClass {
+			c.errorf(s.Selector.Pos(), "CASE selector must be an integer or enumeration, not %s", sel)
+		}
+		seen := map[int64]bool{}
+		for _, cl := range s.Cases {
+			for _, l := range cl.Labels {
+				c.caseLabel(l, sel, seen)
+			}
+			c.stmts(cl.Body)
+		}
+		c.stmts(s.Else)
+	case *ForStmt:
+		vt := c.target(s.Var)
+		if vt.Class != InvalidClass && !vt.IsInteger() {
+			c.errorf(s.Var.NamePos, "FOR variable %s must be an integer, not %s", s.Var.Name, vt)
+		}
+		for _, e := range []Expr{s.From, s.To, s.By} {
+			if e == nil {
+				continue
+			}
+			if t := c.expr(e); t.Class != InvalidClass && t.Class != AnyClass && !t.IsInteger() {
+				c.errorf(e.Pos(), "FOR bound must be an integer, not %s", t)
+			}
+		}
+		c.loop(s.Body)
+	case *WhileStmt:
+		c.cond(s.Cond, "WHILE")
+		c.loop(s.Body)
+	case *RepeatStmt:
+		c.loop(s.Body)
+		c.cond(s.Cond, "UNTIL")
+	case *ExitStmt:
+		if c.loops == 0 {
+			c.errorf(s.KwPos, "EXIT outside a loop")
+		}
+	case *ContinueStmt:
+		if c.loops == 0 {
+			c.errorf(s.KwPos, "CONTINUE outside a loop")
+		}
+	}
+}
+
+func (c *checker) loop(body []Stmt) {
+	c.loops++
+	c.stmts(body)
+	c.loops--
+}
+
+func (c *checker) cond(e Expr, what string) {
+	if t := c.expr(e); t.Class != InvalidClass && t.Class != BoolClass && t.Class != AnyClass {
+		c.errorf(e.Pos(), "%s condition must be BOOL, not %s", what, t)
+	}
+}
+
+func (c *checker) caseLabel(l Expr, sel *Type, seen map[int64]bool) {
+	if r, ok := l.(*RangeExpr); ok {
+		c.caseLabel(r.Lo, sel, nil)
+		c.caseLabel(r.Hi, sel, nil)
+		return
+	}
+	t := c.expr(l)
+	v, ok := c.scope.ConstInt(l)
+	if !ok {
+		if t.Class != InvalidClass {
+			c.errorf(l.Pos(), "CASE label must be a constant")
+		}
+		return
+	}
+	if sel.Class == EnumClass && t.Class == EnumClass && !Identical(sel, t) {
+		c.errorf(l.Pos(), "CASE label of type %s for selector of type %s", t, sel)
+	}
+	if seen != nil {
+		if seen[v] {
+			c.errorf(l.Pos(), "duplicate CASE label %s", ExprString(l))
+		}
+		seen[v] = true
+	}
+}
+
+// convert reports a value of type vt that cannot be stored in a variable of
+// type dst, and untyped constants that do not fit.
+func (c *checker) convert(value Expr, dst, vt *Type, what string) {
+	if dst.Class == InvalidClass || vt.Class == InvalidClass {
+		return
+	}
+	if vt.Class == VoidClass {
+		c.errorf(value.Pos(), "%s has no value", ExprString(value))
+		return
+	}
+	if vt.Untyped && vt.Class == IntClass {
+		if v, ok := c.scope.ConstInt(value); ok {
+			if lo, hi, ok := dst.Range(); ok && (v < lo || v > hi) {
+				c.errorf(value.Pos(), "constant %d overflows %s in %s", v, dst, what)
+				return
+			}
+		}
+	}
+	if dst.Class == PointerClass && !dst.Ref && isAdrCall(value) {
+		return // ADR yields a plain address, which any POINTER TO takes
+	}
+	if Convert(dst, vt) == ConvIncompatible {
+		c.errorf(value.Pos(), "cannot use %s (%s) as %s in %s", ExprString(value), vt, dst, what)
+	}
+}
+
+// isAdrCall reports whether e is a call of ADR.
+func isAdrCall(e Expr) bool {
+	call, ok := e.(*CallExpr)
+	if !ok {
+		return false
+	}
+	id, ok := call.Func.(*Ident)
+	return ok && strings.EqualFold(id.Name, "ADR")
+}
+
+// target checks an assignment target and returns its type.
+func (c *checker) target(e Expr) *Type {
+	t := c.expr(e)
+	switch x := e.(type) {
+	case *Ident:
+		sym := c.scope.Lookup(x.Name)
+		if sym == nil {
+			return t
+		}
+		switch sym.Kind {
+		case VarSymbol, GlobalSymbol:
+			if sym.IsConstant() {
+				c.errorf(x.NamePos, "cannot assign to constant %s", x.Name)
+			}
+		case POUSymbol, TypeSymbol, EnumValueSymbol, GVLSymbol:
+			c.errorf(x.NamePos, "cannot assign to %s %s", sym.Kind, x.Name)
+			return TypeBad
+		}
+	case *MemberExpr:
+		if isBitNumber(x.Name.Name) {
+			c.target(x.X)
+			return t
+		}
+		sym := c.scope.Resolve(x)
+		if sym == nil {
+			return t
+		}
+		switch sym.Kind {
+		case GlobalSymbol:
+			if sym.IsConstant() {
+				c.errorf(x.Name.NamePos, "cannot assign to constant %s", sym.Name)
+			}
+		case FieldSymbol:
+			if xt := c.scope.TypeOf(x.X); xt.Class == InstanceClass && !c.inside(xt) {
+				if f := xt.Field(x.Name.Name); f != nil && f.Block == "VAR_OUTPUT" {
+					c.errorf(x.Name.NamePos, "cannot assign to output %s of %s", f.Name, ExprString(x.X))
+				}
+			}
+			c.target(x.X)
+		case EnumValueSymbol, POUSymbol:
+			c.errorf(x.Name.NamePos, "cannot assign to %s %s", sym.Kind, sym.Name)
+			return TypeBad
+		}
+	case *IndexExpr:
+		c.target(x.X)
+	case *DerefExpr:
+	default:
+		if t.Class != InvalidClass {
+			c.errorf(e.Pos(), "cannot assign to %s", ExprString(e))
+		}
+		return TypeBad
+	}
+	return t
+}
+
+// inside reports whether the checked POU is the function block of instance
+// type t, one of its methods, or derived from it.
+func (c *checker) inside(t *Type) bool {
+	fb := c.scope.POU
+	if c.scope.Owner != nil {
+		fb = c.scope.Owner
+	}
+	if fb == nil || fb.Kind != FunctionBlock {
+		return false
+	}
+	return derives(c.p.instanceType(fb), t)
+}
+
+// ── Expressions ───────────────────────────────────────────────────────────────
+
+// expr checks an expression and returns its type. Errors are reported once,
+// at the innermost offending expression; the enclosing expressions then see
+// a type of InvalidClass and stay silent.
+func (c *checker) expr(e Expr) *Type {
+	switch e := e.(type) {
+	case nil:
+		return TypeBad
+	case *Ident:
+		sym := c.scope.Lookup(e.Name)
+		switch {
+		case sym == nil:
+			if _, ok := LookupStdFunc(e.Name); ok {
+				c.errorf(e.NamePos, "%s is a function; call it with ( )", e.Name)
+			} else {
+				c.errorf(e.NamePos, "undeclared identifier %s", e.Name)
+			}
+			return TypeBad
+		case sym.Kind == TypeSymbol, sym.Kind == GVLSymbol:
+			c.errorf(e.NamePos, "%s %s used as a value", sym.Kind, e.Name)
+			return TypeBad
+		case sym.Kind == POUSymbol && sym.POU.Kind != Program:
+			c.errorf(e.NamePos, "%s %s used as a value", sym.POU.Kind, e.Name)
+			return TypeBad
+		}
+	case *Literal:
+		t := literalType(e)
+		if v, ok := e.Int(); ok && !t.Untyped {
+			if lo, hi, ok := t.Range(); ok && (v < lo || v > hi) {
+				c.errorf(e.LitPos, "constant %s overflows %s", e.Text, t)
+			}
+		}
+		return t
+	case *EnumLiteral:
+		if c.scope.Resolve(e) == nil {
+			if c.p.TypeDecl(e.Type.Name) == nil {
+				c.errorf(e.Type.NamePos, "unknown enumeration type %s", e.Type.Name)
+			} else {
+				c.errorf(e.Value.NamePos, "%s has no value %s", e.Type.Name, e.Value.Name)
+			}
+			return TypeBad
+		}
+	case *MemberExpr:
+		return c.member(e)
+	case *BinaryExpr:
+		return c.binary(e)
+	case *UnaryExpr:
+		t := c.expr(e.X)
+		if t.Class == InvalidClass || t.Class == AnyClass {
+			return TypeBad
+		}
+		switch {
+		case e.Op == "NOT" && t.Class != BoolClass && t.Class != BitsClass && !t.IsInteger():
+			c.errorf(e.OpPos, "operator NOT not defined on %s", t)
+			return TypeBad
+		case e.Op != "NOT" && !t.IsNumeric() && t.Class != TimeClass:
+			c.errorf(e.OpPos, "operator %s not defined on %s", e.Op, t)
+			return TypeBad
+		}
+	case *ParenExpr:
+		return c.expr(e.X)
+	case *IndexExpr:
+		return c.index(e)
+	case *DerefExpr:
+		t := c.expr(e.X)
+		if t.Class != InvalidClass && t.Class != PointerClass {
+			c.errorf(e.X.Pos(), "cannot dereference %s of type %s", ExprString(e.X), t)
+			return TypeBad
+		}
+	case *CallExpr:
+		return c.call(e)
+	case *RangeExpr:
+		c.expr(e.Lo)
+		c.expr(e.Hi)
+	case *ArrayInit:
+		for _, el := range e.Elems {
+			c.expr(el.Count)
+			c.expr(el.Value)
+		}
+	case *StructInit:
+		for _, fi := range e.Fields {
+			c.expr(fi.Value)
+		}
+	}
+	return c.scope.TypeOf(e)
+}
+
+func (c *checker) member(e *MemberExpr) *Type {
+	if x, ok := e.X.(*Ident); ok {
+		if base := c.scope.Lookup(x.Name); base != nil && (base.Kind == TypeSymbol || base.Kind == GVLSymbol) {
+			if c.scope.Resolve(e) != nil {
+				return c.scope.TypeOf(e)
+			}
+			if base.Kind == GVLSymbol {
+				c.errorf(e.Name.NamePos, "%s has no variable %s", base.Name, e.Name.Name)
+			} else if base.Type.Class == EnumClass {
+				c.errorf(e.Name.NamePos, "%s has no value %s", base.Name, e.Name.Name)
+			} else {
+				c.errorf(e.Name.NamePos, "type %s used as a value", base.Name)
+			}
+			return TypeBad
+		}
+	}
+	xt := c.expr(e.X)
+	if xt.Class == InvalidClass {
+		return TypeBad
+	}
+	if isBitNumber(e.Name.Name) {
+		bit, _ := ParseInt(e.Name.Name)
+		if !xt.IsInteger() && xt.Class != BitsClass {
+			c.errorf(e.Name.NamePos, "bit access on %s of type %s", ExprString(e.X), xt)
+			return TypeBad
+		}
+		if xt.Bits > 0 && bit >= int64(xt.Bits) {
+			c.errorf(e.Name.NamePos, "bit %d out of range for %s", bit, xt)
+			return TypeBad
+		}
+		return TypeBool
+	}
+	if xt.Class == PointerClass && xt.Ref {
+		xt = xt.Elem
+	}
+	sym := c.scope.Resolve(e)
+	switch {
+	case sym == nil && xt.Class == PointerClass:
+		c.errorf(e.Name.NamePos, "%s is a pointer; use %s^.%s", ExprString(e.X), ExprString(e.X), e.Name.Name)
+		return TypeBad
+	case sym == nil && (xt.Class == StructClass || xt.Class == InstanceClass):
+		c.errorf(e.Name.NamePos, "%s has no member %s", xt, e.Name.Name)
+		return TypeBad
+	case sym == nil:
+		c.errorf(e.Name.NamePos, "%s of type %s has no members", ExprString(e.X), xt)
+		return TypeBad
+	case sym.Kind == FieldSymbol && xt.Class == InstanceClass && xt.POU.Kind == FunctionBlock && !c.inside(xt):
+		if f := xt.Field(e.Name.Name); f != nil && f.Block != "VAR_INPUT" && f.Block != "VAR_OUTPUT" && f.Block != "VAR_IN_OUT" {
+			c.errorf(e.Name.NamePos, "%s is not an input or output of %s", f.Name, xt)
+			return TypeBad
+		}
+	}
+	return c.scope.TypeOf(e)
+}
+
+func (c *checker) binary(e *BinaryExpr) *Type {
+	x, y := c.expr(e.X), c.expr(e.Y)
+	if x.Class == InvalidClass || y.Class == InvalidClass || x.Class == AnyClass || y.Class == AnyClass {
+		return TypeBad
+	}
+	bad := func() *Type {
+		if Identical(x, y) {
+			c.errorf(e.OpPos, "operator %s not defined on %s", e.Op, x)
+		} else {
+			c.errorf(e.OpPos, "operator %s not defined on %s and %s", e.Op, x, y)
+		}
+		return TypeBad
+	}
+	arith := func(t *Type) bool { return t.IsNumeric() || t.Class == BitsClass }
+	switch e.Op {
+	case "+", "-":
+		timeLike := func(t *Type) bool { return t.Class == TimeClass || t.Class == DateClass }
+		if !(arith(x) && arith(y)) && !(timeLike(x) && (timeLike(y) || y.Untyped)) && !(timeLike(y) && x.Untyped) {
+			return bad()
+		}
+	case "*", "/":
+		if !(arith(x) && arith(y)) && !(x.Class == TimeClass && y.IsNumeric()) {
+			return bad()
+		}
+	case "MOD":
+		if !(x.IsInteger() || x.Class == BitsClass) || !(y.IsInteger() || y.Class == BitsClass) {
+			return bad()
+		}
+	case "**":
+		if !x.IsNumeric() || !y.IsNumeric() {
+			return bad()
+		}
+	case "AND", "OR", "XOR":
+		logical := func(t *Type) bool { return t.Class == BoolClass || t.Class == BitsClass || t.IsInteger() }
+		if !logical(x) || !logical(y) || (x.Class == BoolClass) != (y.Class == BoolClass) {
+			return bad()
+		}
+	case "AND_THEN", "OR_ELSE":
+		if x.Class != BoolClass || y.Class != BoolClass {
+			return bad()
+		}
+	case "=", "<>", "<", ">", "<=", ">=":
+		if x.Class == ArrayClass || x.Class == StructClass || x.Class == InstanceClass || x.Class == VoidClass {
+			return bad()
+		}
+		if Convert(x, y) == ConvIncompatible && Convert(y, x) == ConvIncompatible {
+			c.errorf(e.OpPos, "cannot compare %s and %s", x, y)
+			return TypeBad
+		}
+	}
+	return c.scope.TypeOf(e)
+}
+
+func (c *checker) index(e *IndexExpr) *Type {
+	t := c.expr(e.X)
+	for _, i := range e.Indices {
+		if it := c.expr(i); it.Class != InvalidClass && it.Class != AnyClass && !it.IsInteger() && it.Class != BitsClass && it.Class != EnumClass {
+			c.errorf(i.Pos(), "index must be an integer, not %s", it)
+		}
+	}
+	switch t.Class {
+	case InvalidClass:
+		return TypeBad
+	case ArrayClass:
+		if len(e.Indices) != len(t.Dims) {
+			c.errorf(e.Indices[0].Pos(), "%s has %s, not %d", ExprString(e.X), plural(len(t.Dims), "dimension"), len(e.Indices))
+			return TypeBad
+		}
+		for k, i := range e.Indices {
+			d := t.Dims[k]
+			if v, ok := c.scope.ConstInt(i); ok && d.Known && (v < d.Lo || v > d.Hi) {
+				c.errorf(i.Pos(), "index %d out of range [%d..%d] of %s", v, d.Lo, d.Hi, ExprString(e.X))
+			}
+		}
+	case StringClass, PointerClass:
+		if len(e.Indices) != 1 {
+			c.errorf(e.Indices[0].Pos(), "%s takes one index", ExprString(e.X))
+			return TypeBad
+		}
+	default:
+		c.errorf(e.X.Pos(), "%s of type %s is not an array", ExprString(e.X), t)
+		return TypeBad
+	}
+	return c.scope.TypeOf(e)
+}
+
+// ── Calls ─────────────────────────────────────────────────────────────────────
+
+func (c *checker) call(e *CallExpr) *Type {
+	var name string
+	var sym *Symbol
+	switch fn := e.Func.(type) {
+	case *Ident:
+		name = fn.Name
+		sym = c.scope.Lookup(fn.Name)
+		if sym == nil {
+			if f, ok := LookupStdFunc(fn.Name); ok {
+				c.stdCall(e, f)
+				return c.scope.TypeOf(e)
+			}
+			c.errorf(fn.NamePos, "undeclared function %s", fn.Name)
+			c.args(e.Args)
+			return TypeBad
+		}
+	case *MemberExpr:
+		name = ExprString(fn)
+		c.member(fn)
+		sym = c.scope.Resolve(fn)
+	default:
+		name = ExprString(fn)
+		if t := c.expr(fn); t.Class == InstanceClass {
+			c.callArgs(e, t.POU, name, true)
+			return TypeVoid
+		} else if t.Class != InvalidClass {
+			c.errorf(fn.Pos(), "%s is not callable", name)
+		}
+		c.args(e.Args)
+		return TypeBad
+	}
+	if sym == nil {
+		c.args(e.Args)
+		return TypeBad
+	}
+	switch sym.Kind {
+	case POUSymbol:
+		switch sym.POU.Kind {
+		case FunctionBlock:
+			c.errorf(e.Func.Pos(), "%s is a function block type; call an instance of it", sym.Name)
+			c.args(e.Args)
+			return TypeBad
+		case Program:
+			c.callArgs(e, sym.POU, name, true)
+		default:
+			c.callArgs(e, sym.POU, name, false)
+		}
+	case VarSymbol, GlobalSymbol, FieldSymbol:
+		t := c.scope.valueType(sym)
+		if t.Class == InstanceClass {
+			c.callArgs(e, t.POU, name, true)
+			break
+		}
+		if t.Class != InvalidClass {
+			c.errorf(e.Func.Pos(), "%s of type %s is not callable", name, t)
+		}
+		c.args(e.Args)
+		return TypeBad
+	default:
+		c.errorf(e.Func.Pos(), "%s %s is not callable", sym.Kind, name)
+		c.args(e.Args)
+		return TypeBad
+	}
+	return c.scope.TypeOf(e)
+}
+
+// args checks argument values without a known callee.
+func (c *checker) args(args []*Arg) {
+	for _, a := range args {
+		if a.Value != nil {
+			c.expr(a.Value)
+		}
+	}
+}
+
+func (c *checker) stdCall(e *CallExpr, f StdFunc) {
+	n := len(e.Args)
+	switch {
+	case n < f.MinArgs && f.MinArgs == f.MaxArgs, f.MaxArgs >= 0 && n > f.MaxArgs && f.MinArgs == f.MaxArgs:
+		c.errorf(e.Func.Pos(), "%s takes %s, not %d", f.Name, plural(f.MinArgs, "argument"), n)
+	case n < f.MinArgs:
+		c.errorf(e.Func.Pos(), "%s takes at least %s, not %d", f.Name, plural(f.MinArgs, "argument"), n)
+	case f.MaxArgs >= 0 && n > f.MaxArgs:
+		c.errorf(e.Func.Pos(), "%s takes at most %s, not %d", f.Name, plural(f.MaxArgs, "argument"), n)
+	}
+	for _, a := range e.Args {
+		if a.Output {
+			c.errorf(a.Name.NamePos, "%s has no output %s", f.Name, a.Name.Name)
+		}
+		if a.Value != nil {
+			c.expr(a.Value)
+		}
+	}
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// param is a variable of a called POU.
+type param struct {
+	id    *Ident
+	block string
+	typ   *Type
+}
+
+// callArgs checks the arguments of a call of callee. Inputs are passed with
+// := or positionally, outputs with =>. instance is true for function block
+// and program calls, whose inputs keep their previous values when omitted.
+func (c *checker) callArgs(e *CallExpr, callee *POU, name string, instance bool) {
+	// the variables of base function blocks come first
+	chain := []*POU{callee}
+	for d := callee; d.Extends != nil && len(chain) < 16; {
+		if d = c.p.POU(d.Extends.Name); d == nil {
+			break
+		}
+		chain = append([]*POU{d}, chain...)
+	}
+	cs := c.p.Scope(callee)
+	var inputs []*param
+	byName := map[string]*param{}
+	for _, d := range chain {
+		for _, b := range d.VarBlocks {
+			for _, v := range b.Vars {
+				t := cs.ResolveType(v.Type)
+				for _, id := range v.Names {
+					p := &param{id: id, block: b.Kind, typ: t}
+					byName[strings.ToUpper(id.Name)] = p
+					if b.Kind == "VAR_INPUT" || b.Kind == "VAR_IN_OUT" {
+						inputs = append(inputs, p)
+					}
+				}
+			}
+		}
+	}
+	given := map[*param]bool{}
+	positional, named := 0, false
+	for k, a := range e.Args {
+		var p *param
+		if a.Name == nil {
+			if named {
+				c.errorf(a.Value.Pos(), "positional argument after named arguments in call of %s", name)
+			}
+			if positional >= len(inputs) {
+				c.errorf(a.Value.Pos(), "too many arguments in call of %s (%d expected)", name, len(inputs))
+				c.expr(a.Value)
+				positional++
+				continue
+			}
+			p = inputs[positional]
+			positional++
+		} else {
+			named = true
+			p = byName[strings.ToUpper(a.Name.Name)]
+			switch {
+			case p == nil:
+				c.errorf(a.Name.NamePos, "%s has no parameter %s", callee.Name.Name, a.Name.Name)
+			case a.Output && p.block != "VAR_OUTPUT":
+				c.errorf(a.Name.NamePos, "%s is not an output of %s; use :=", p.id.Name, callee.Name.Name)
+				p = nil
+			case !a.Output && p.block != "VAR_INPUT" && p.block != "VAR_IN_OUT":
+				if p.block == "VAR_OUTPUT" {
+					c.errorf(a.Name.NamePos, "%s is an output of %s; use =>", p.id.Name, callee.Name.Name)
+				} else {
+					c.errorf(a.Name.NamePos, "%s is not an input of %s", p.id.Name, callee.Name.Name)
+				}
+				p = nil
+			}
+		}
+		if p != nil {
+			if given[p] {
+				c.errorf(a.Name.NamePos, "parameter %s given twice", p.id.Name)
+			}
+			given[p] = true
+		}
+		if a.Value == nil {
+			continue
+		}
+		what := fmt.Sprintf("argument %d of %s", k+1, name)
+		if p != nil {
+			what = fmt.Sprintf("argument %s of %s", p.id.Name, name)
+		}
+		switch {
+		case p == nil:
+			c.expr(a.Value)
+		case a.Output:
+			vt := c.target(a.Value)
+			if vt.Class != InvalidClass && p.typ.Class != InvalidClass && Convert(vt, p.typ) == ConvIncompatible {
+				c.errorf(a.Value.Pos(), "cannot store output %s (%s) in %s (%s)", p.id.Name, p.typ, ExprString(a.Value), vt)
+			}
+		case p.block == "VAR_IN_OUT":
+			if !isVariable(a.Value) {
+				c.errorf(a.Value.Pos(), "%s must be a variable (VAR_IN_OUT)", what)
+				c.expr(a.Value)
+				continue
+			}
+			vt := c.target(a.Value)
+			if conv := Convert(p.typ, vt); vt.Class != InvalidClass && p.typ.Class != InvalidClass &&
+				(conv == ConvIncompatible || conv == ConvNarrowing && vt.Class != StringClass) {
+				c.errorf(a.Value.Pos(), "cannot pass %s (%s) as %s in %s (VAR_IN_OUT)", ExprString(a.Value), vt, p.typ, what)
+			}
+		default:
+			c.convert(a.Value, p.typ, c.expr(a.Value), what)
+		}
+	}
+	if !named && !instance && positional > 0 && positional < len(inputs) {
+		c.errorf(e.RParen, "not enough arguments in call of %s (%d expected)", name, len(inputs))
+	}
+	if !instance {
+		for _, p := range inputs {
+			if p.block == "VAR_IN_OUT" && !given[p] && (named || positional > 0 || len(e.Args) == 0) {
+				c.errorf(e.RParen, "missing VAR_IN_OUT argument %s in call of %s", p.id.Name, name)
+			}
+		}
+	}
+}
+
+// isVariable reports whether e denotes storage that can be passed by
+// reference.
+func isVariable(e Expr) bool {
+	switch e := e.(type) {
+	case *Ident, *IndexExpr, *DerefExpr:
+		return true
+	case *MemberExpr:
+		return true
+	case *ParenExpr:
+		return isVariable(e.X)
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+package st
+
+import (
+	"fmt"
+	"testing"
+)
+
+// checkDecls are the declarations the checker tests can refer to.
+var checkDecls = []string{
+	"FUNCTION F_Add : INT\nVAR_INPUT\n    a : INT;\n    b : INT;\nEND_VAR\nF_Add := a + b;\nEND_FUNCTION\n",
+	"TYPE E_Mode :\n(\n    Auto,\n    Manual\n);\nEND_TYPE\n",
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name string
+		body string // statements of PROGRAM Main
+		want []string
+	}{
+		{"valid", "i := F_Add(1, 2);\nb := i > 0;\ne := E_Mode.Auto;", nil},
+		{"undeclared", "i := x;", []string{"8:6: undeclared identifier x"}},
+		{"BOOL from INT", "b := i;", []string{"8:6: cannot use i (INT) as BOOL in assignment to b"}},
+		{"INT from STRING", "i := s;", []string{"8:6: cannot use s (STRING) as INT in assignment to i"}},
+		{"IF condition", "IF i THEN\n    i := 1;\nEND_IF", []string{"8:4: IF condition must be BOOL, not INT"}},
+		{"too few arguments", "i := F_Add(1);", []string{"8:13: not enough arguments in call of F_Add (2 expected)"}},
+		{"too many arguments", "i := F_Add(1, 2, 3);", []string{"8:18: too many arguments in call of F_Add (2 expected)"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := "PROGRAM Main\nVAR\n    i : INT;\n    b : BOOL;\n    s : STRING;\n    e : E_Mode;\nEND_VAR\n" + tt.body + "\nEND_PROGRAM\n"
+			var files []*File
+			for i, s := range append([]string{src}, checkDecls...) {
+				f, err := Parse(fmt.Sprintf("file%d.st", i), s)
+				if err != nil {
+					t.Fatal(err)
+				}
+				files = append(files, f)
+			}
+			errs := NewProject(files).Check()[files[0]]
+			if len(errs) != len(tt.want) {
+				t.Fatalf("got %d errors, want %d:\n%v", len(errs), len(tt.want), errs)
+			}
+			for i, e := range errs {
+				if e.Error() != tt.want[i] {
+					t.Errorf("got %q, want %q", e.Error(), tt.want[i])
+				}
+			}
+		})
+	}
+}
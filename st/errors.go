@@ -0,0 +1,47 @@
+package st
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ── Errors ────────────────────────────────────────────────────────────────────
+
+// Error is a syntax error at a source position.
+type Error struct {
+	Pos Pos
+	Msg string
+}
+
+func (e *Error) Error() string { return fmt.Sprintf("%s: %s", e.Pos, e.Msg) }
+
+// ErrorList collects the errors of one file. Its Error method lists them all,
+// one per line.
+type ErrorList []*Error
+
+// Add appends an error at p.
+func (el *ErrorList) Add(p Pos, format string, args ...any) {
+	*el = append(*el, &Error{Pos: p, Msg: fmt.Sprintf(format, args...)})
+}
+
+// Sort orders the errors by position.
+func (el ErrorList) Sort() {
+	sort.SliceStable(el, func(i, j int) bool { return el[i].Pos.Offset < el[j].Pos.Offset })
+}
+
+// Err returns el as an error, or nil when it is empty.
+func (el ErrorList) Err() error {
+	if len(el) == 0 {
+		return nil
+	}
+	return el
+}
+
+func (el ErrorList) Error() string {
+	msgs := make([]string, len(el))
+	for i, e := range el {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
@@ -0,0 +1,651 @@
+package st
+
+import (
+	"strings"
+)
+
+// ── Formatter ─────────────────────────────────────────────────────────────────
+
+// FormatOptions controls the layout produced by Format.
+type FormatOptions struct {
+	Indent string // one indentation level, default four spaces
+}
+
+// Format returns src in canonical layout:
+//
+//   - keywords, TRUE/FALSE and elementary type names in type position are
+//     written in upper case;
+//   - statement bodies of IF, CASE, FOR, WHILE and REPEAT and the contents of
+//     VAR, TYPE, STRUCT and CONFIGURATION blocks are indented one level, CASE
+//     branches one level below their label;
+//   - the ':' and ':=' columns of the declarations in a VAR block or STRUCT,
+//     and the ':=' column of enumeration values, are aligned, and trailing
+//     comments of such runs start in a common column;
+//   - binary operators and ':=' are surrounded by single spaces, commas are
+//     followed by one, and parentheses, brackets and member access are tight.
+//
+// Line breaks, comments and pragmas are kept, except that control statements
+// written on one line are split: the body of IF, CASE, FOR, WHILE and REPEAT
+// starts on a new line, and so do ELSIF, ELSE, UNTIL, the END_ keywords, a
+// CASE label and a control statement that follows another statement. Runs
+// of blank lines collapse to one and trailing whitespace is removed. Sources that do not parse are
+// returned unchanged together with the syntax errors, so a broken file is
+// never rewritten.
+func Format(src string, opts *FormatOptions) (string, error) {
+	if _, err := Parse("", src); err != nil {
+		return src, err
+	}
+	indent := "    "
+	if opts != nil && opts.Indent != "" {
+		indent = opts.Indent
+	}
+	toks, _ := Tokenize(src)
+	toks = toks[:len(toks)-1] // drop EOF
+
+	f := &formatter{indent: indent}
+	f.layout(splitStatements(groupLines(toks)))
+	f.align()
+
+	var sb strings.Builder
+	for i, l := range f.lines {
+		if l.blankBefore && i > 0 {
+			sb.WriteString("\n")
+		}
+		if l.text != "" {
+			sb.WriteString(strings.Repeat(indent, l.indent))
+			sb.WriteString(l.text)
+		}
+		sb.WriteString("\n")
+	}
+	out := sb.String()
+	if strings.Count(src, "\r\n") > strings.Count(src, "\n")/2 {
+		out = strings.ReplaceAll(out, "\n", "\r\n")
+	}
+	if strings.HasPrefix(src, "\uFEFF") {
+		out = "\uFEFF" + out
+	}
+	return out, nil
+}
+
+// srcLine is a group of tokens that start on the same source line, extended
+// over the lines a multi-line comment spans.
+type srcLine struct {
+	toks        []Token
+	blankBefore bool
+}
+
+func groupLines(toks []Token) []srcLine {
+	var lines []srcLine
+	lastEnd := 0
+	for _, t := range toks {
+		if len(lines) > 0 && t.Pos.Line <= lastEnd {
+			cur := &lines[len(lines)-1]
+			cur.toks = append(cur.toks, t)
+		} else {
+			lines = append(lines, srcLine{toks: []Token{t}, blankBefore: len(lines) > 0 && t.Pos.Line > lastEnd+1})
+		}
+		if t.End.Line > lastEnd {
+			lastEnd = t.End.Line
+		}
+	}
+	return lines
+}
+
+// controlEnds are the keywords that close a control statement.
+var controlEnds = map[string]bool{
+	"END_IF": true, "END_CASE": true, "END_FOR": true, "END_WHILE": true, "END_REPEAT": true,
+}
+
+// splitStatements breaks lines apart where a control statement continues on
+// the same line, so that every body gets lines of its own to be indented.
+// Statements after a ';' stay together unless the next one is a control
+// statement or a CASE label.
+func splitStatements(lines []srcLine) []srcLine {
+	var out []srcLine
+	var stack []string // open control statements; "OF" marks a CASE past its selector
+	depth := 0
+	breakNext := false // the next statement starts a new line
+	endOpen := false   // an END_ keyword waits for its ';'
+	for _, sl := range lines {
+		start, hasCode := 0, false
+		breakNext, endOpen = false, false
+		var prev Token
+		for i, t := range sl.toks {
+			if t.Kind == COMMENT || t.Kind == PRAGMA {
+				continue
+			}
+			top := ""
+			if len(stack) > 0 {
+				top = stack[len(stack)-1]
+			}
+			brk := breakNext
+			if depth == 0 && t.Kind == KEYWORD {
+				switch u := t.Upper(); {
+				case u == "ELSIF", u == "ELSE", u == "UNTIL", controlEnds[u]:
+					brk = true
+				case u == "IF", u == "CASE", u == "FOR", u == "WHILE", u == "REPEAT":
+					brk = brk || prev.Kind == SEMICOLON
+				}
+			}
+			if depth == 0 && top == "OF" && prev.Kind == SEMICOLON && caseLabelColon(sl.toks[i:]) >= 0 {
+				brk = true
+			}
+			if endOpen && t.Kind != SEMICOLON {
+				brk = true
+			}
+			if brk && hasCode && !(endOpen && t.Kind == SEMICOLON) {
+				out = append(out, srcLine{toks: sl.toks[start:i], blankBefore: start == 0 && sl.blankBefore})
+				start = i
+			}
+			hasCode = true
+			breakNext = false
+			if endOpen {
+				endOpen = false
+				breakNext = t.Kind == SEMICOLON
+			}
+
+			switch t.Kind {
+			case LPAREN, LBRACK:
+				depth++
+			case RPAREN, RBRACK:
+				if depth > 0 {
+					depth--
+				}
+			case KEYWORD:
+				if depth > 0 {
+					break
+				}
+				switch u := t.Upper(); {
+				case u == "IF", u == "CASE", u == "FOR", u == "WHILE":
+					stack = append(stack, u)
+				case u == "REPEAT":
+					stack = append(stack, u)
+					breakNext = true
+				case u == "OF" && top == "CASE":
+					stack[len(stack)-1] = "OF"
+					breakNext = true
+				case u == "THEN", u == "DO", u == "ELSE":
+					breakNext = true
+				case controlEnds[u]:
+					if len(stack) > 0 {
+						stack = stack[:len(stack)-1]
+					}
+					endOpen = true
+				}
+			}
+			prev = t
+		}
+		out = append(out, srcLine{toks: sl.toks[start:], blankBefore: start == 0 && sl.blankBefore})
+	}
+	return out
+}
+
+// ── Layout ────────────────────────────────────────────────────────────────────
+
+type frame struct {
+	kind   string // IF, CASE, FOR, WHILE, REPEAT, VAR, STRUCT, TYPE, CONFIGURATION, RESOURCE
+	weight int
+	id     int
+}
+
+// outLine is one formatted line before alignment.
+type outLine struct {
+	indent      int
+	text        string
+	blankBefore bool
+
+	// alignment data; alignKind is "" for lines that are not aligned
+	alignKind string // "decl" or "assign"
+	group     int
+	name      string
+	typ       string
+	init      string
+	comment   string
+}
+
+type formatter struct {
+	indent string
+	stack  []frame
+	nextID int
+	depth  int // parenthesis and bracket depth
+	lines  []outLine
+}
+
+func (f *formatter) level() int {
+	n := 0
+	for _, fr := range f.stack {
+		n += fr.weight
+	}
+	return n
+}
+
+func (f *formatter) top() *frame {
+	if len(f.stack) == 0 {
+		return nil
+	}
+	return &f.stack[len(f.stack)-1]
+}
+
+func (f *formatter) push(kind string, weight int) {
+	f.nextID++
+	f.stack = append(f.stack, frame{kind: kind, weight: weight, id: f.nextID})
+}
+
+func (f *formatter) pop(kind string) {
+	for i := len(f.stack) - 1; i >= 0; i-- {
+		if f.stack[i].kind == kind {
+			f.stack = f.stack[:i]
+			return
+		}
+	}
+}
+
+var blockEnds = map[string]string{
+	"END_IF": "IF", "END_CASE": "CASE", "END_FOR": "FOR", "END_WHILE": "WHILE",
+	"END_REPEAT": "REPEAT", "END_VAR": "VAR", "END_STRUCT": "STRUCT", "END_TYPE": "TYPE",
+	"END_CONFIGURATION": "CONFIGURATION", "END_RESOURCE": "RESOURCE",
+}
+
+// continues reports whether a line ending in t leaves its statement open.
+func continues(t Token) bool {
+	switch t.Kind {
+	case ASSIGN, OUTPUT, COMMA, PLUS, MINUS, STAR, SLASH, POWER, AMP, EQ, NEQ, LT, GT, LEQ, GEQ, LPAREN, LBRACK:
+		return true
+	case KEYWORD:
+		switch t.Upper() {
+		case "AND", "OR", "XOR", "MOD", "NOT", "AND_THEN", "OR_ELSE":
+			return true
+		}
+	}
+	return false
+}
+
+func (f *formatter) layout(lines []srcLine) {
+	var prevLast Token
+	for _, sl := range lines {
+		code := significant(sl.toks)
+		lvl := f.level()
+		first := sl.toks[0]
+		top := f.top()
+		label := -1
+
+		switch {
+		case first.Kind == KEYWORD && blockEnds[first.Upper()] != "":
+			ind := lvl
+			for i := len(f.stack) - 1; i >= 0; i-- {
+				ind -= f.stack[i].weight
+				if f.stack[i].kind == blockEnds[first.Upper()] {
+					break
+				}
+			}
+			lvl = ind
+		case first.Is("ELSIF"), first.Is("ELSE") && top != nil && top.kind == "IF", first.Is("UNTIL"):
+			lvl--
+		case first.Is("ELSE") && top != nil && top.kind == "CASE":
+			lvl -= top.weight
+		case top != nil && top.kind == "CASE" && top.weight == 2 && f.depth == 0:
+			if label = caseLabelColon(sl.toks); label >= 0 {
+				lvl--
+			} else if prevLast.Kind != 0 && continues(prevLast) {
+				lvl++
+			}
+		case f.depth > 0:
+			if first.Kind != RPAREN && first.Kind != RBRACK {
+				lvl++
+			}
+		case prevLast.Kind != 0 && continues(prevLast) && first.Kind != COMMENT:
+			lvl++
+		}
+		if lvl < 0 {
+			lvl = 0
+		}
+
+		out := outLine{indent: lvl, blankBefore: sl.blankBefore}
+		out.text = f.render(sl.toks, label)
+		f.classify(&out, sl.toks)
+		f.lines = append(f.lines, out)
+
+		for _, t := range sl.toks {
+			f.track(t)
+		}
+		if len(code) > 0 {
+			prevLast = code[len(code)-1]
+		}
+	}
+}
+
+func significant(toks []Token) []Token {
+	var out []Token
+	for _, t := range toks {
+		if t.Kind != COMMENT && t.Kind != PRAGMA {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// track updates the block stack and bracket depth after a token.
+func (f *formatter) track(t Token) {
+	switch t.Kind {
+	case LPAREN, LBRACK:
+		f.depth++
+		return
+	case RPAREN, RBRACK:
+		if f.depth > 0 {
+			f.depth--
+		}
+		return
+	case KEYWORD:
+	default:
+		return
+	}
+	u := t.Upper()
+	switch u {
+	case "IF", "FOR", "WHILE", "REPEAT", "TYPE", "STRUCT", "CONFIGURATION", "RESOURCE":
+		f.push(u, 1)
+	case "CASE":
+		f.push("CASE", 2)
+	case "ELSE":
+		if top := f.top(); top != nil && top.kind == "CASE" {
+			top.weight = 1
+		}
+	default:
+		if isVarBlockKw(t) {
+			f.push("VAR", 1)
+		} else if kind := blockEnds[u]; kind != "" {
+			f.pop(kind)
+		}
+	}
+}
+
+// caseLabelColon returns the index of the colon that ends a CASE label at
+// the start of the line, or -1.
+func caseLabelColon(toks []Token) int {
+	for i, t := range toks {
+		switch t.Kind {
+		case COLON:
+			if i == 0 {
+				return -1
+			}
+			return i
+		case INT, IDENT, MINUS, PLUS, RANGE, COMMA, HASH, DOT, TIME, STRING:
+			continue
+		case KEYWORD:
+			if t.Is("TRUE") || t.Is("FALSE") {
+				continue
+			}
+		}
+		return -1
+	}
+	return -1
+}
+
+// ── Token rendering ───────────────────────────────────────────────────────────
+
+// tokenText returns the canonical spelling of a token.
+func tokenText(t Token, prev, prev2 Token) string {
+	switch t.Kind {
+	case KEYWORD:
+		return t.Upper()
+	case IDENT:
+		if IsElementaryType(t.Text) && typePosition(prev, prev2) {
+			return t.Upper()
+		}
+	case INT, REAL, TIME:
+		// upper-case type prefixes: t#1s → T#1s, int#5 → INT#5
+		if i := strings.IndexByte(t.Text, '#'); i > 0 && isLetter(t.Text[0]) {
+			return strings.ToUpper(t.Text[:i]) + t.Text[i:]
+		}
+	}
+	return t.Text
+}
+
+// typePosition reports whether a name following prev (and prev2 before it)
+// is written where a type is expected.
+func typePosition(prev, prev2 Token) bool {
+	switch {
+	case prev.Kind == COLON:
+		return true
+	case prev.Is("OF"):
+		return prev2.Kind == RBRACK
+	case prev.Is("TO"):
+		return prev2.Is("POINTER") || prev2.Is("REFERENCE")
+	}
+	return false
+}
+
+// isUnary reports whether a '+' or '-' following prev is a sign.
+func isUnary(prev Token) bool {
+	switch prev.Kind {
+	case 0, ASSIGN, OUTPUT, COLON, COMMA, LPAREN, LBRACK, PLUS, MINUS, STAR, SLASH, POWER,
+		AMP, EQ, NEQ, LT, GT, LEQ, GEQ, RANGE:
+		return true
+	case KEYWORD:
+		return !prev.Is("TRUE") && !prev.Is("FALSE")
+	}
+	return false
+}
+
+// space decides whether a blank goes between prev and t. unary is true when
+// prev is a sign.
+func space(prev, t Token, unaryPrev, labelColon bool) bool {
+	if t.Kind == COMMENT || t.Kind == PRAGMA || prev.Kind == COMMENT || prev.Kind == PRAGMA {
+		return true
+	}
+	if unaryPrev {
+		return false
+	}
+	switch t.Kind {
+	case SEMICOLON, COMMA, RPAREN, RBRACK, DOT, RANGE, CARET, HASH:
+		return false
+	case COLON:
+		return !labelColon
+	case LBRACK:
+		return prev.Kind != IDENT && !prev.Is("ARRAY") && prev.Kind != RBRACK && prev.Kind != CARET && prev.Kind != RPAREN
+	case LPAREN:
+		switch prev.Kind {
+		case IDENT, INT, RBRACK, CARET, RPAREN:
+			return false
+		}
+		return prev.Kind != LPAREN && prev.Kind != LBRACK
+	}
+	switch prev.Kind {
+	case LPAREN, LBRACK, DOT, RANGE, HASH:
+		return false
+	}
+	return true
+}
+
+// render writes the tokens of one line with canonical spacing. label is the
+// index of a CASE label colon, or -1.
+func (f *formatter) render(toks []Token, label int) string {
+	var sb strings.Builder
+	var prev, prev2 Token
+	unaryPrev := false
+	for i, t := range toks {
+		if i > 0 && space(prev, t, unaryPrev, i == label) {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(tokenText(t, prev, prev2))
+		unaryPrev = (t.Kind == MINUS || t.Kind == PLUS) && isUnary(prev)
+		if t.Kind != COMMENT && t.Kind != PRAGMA {
+			prev2, prev = prev, t
+		}
+	}
+	return sb.String()
+}
+
+// ── Alignment ─────────────────────────────────────────────────────────────────
+
+// classify records the parts of declaration lines in VAR blocks and STRUCTs
+// and of "name := value" lines inside parentheses, for alignment.
+func (f *formatter) classify(out *outLine, toks []Token) {
+	code := toks
+	comment := ""
+	if n := len(toks); n > 0 && toks[n-1].Kind == COMMENT && !strings.Contains(toks[n-1].Text, "\n") {
+		comment = toks[n-1].Text
+		code = toks[:n-1]
+	}
+	if len(code) < 3 || code[0].Kind != IDENT {
+		return
+	}
+	for _, t := range code {
+		if t.Kind == PRAGMA || t.Kind == COMMENT {
+			return
+		}
+	}
+
+	top := f.top()
+	inDecls := top != nil && (top.kind == "VAR" || top.kind == "STRUCT") && f.depth == 0
+	if inDecls {
+		if code[len(code)-1].Kind != SEMICOLON {
+			return
+		}
+		colon, assign, depth := -1, -1, 0
+		for i, t := range code[:len(code)-1] {
+			switch t.Kind {
+			case LPAREN, LBRACK:
+				depth++
+			case RPAREN, RBRACK:
+				depth--
+			case SEMICOLON:
+				return
+			case COLON:
+				if depth == 0 && colon < 0 {
+					colon = i
+				}
+			case ASSIGN:
+				if depth == 0 && assign < 0 && colon >= 0 {
+					assign = i
+				}
+			}
+		}
+		if colon < 1 {
+			return
+		}
+		end := len(code) - 1
+		tEnd := end
+		if assign >= 0 {
+			tEnd = assign
+			out.init = f.render(code[assign+1:end], -1)
+		}
+		out.alignKind = "decl"
+		out.group = top.id
+		out.name = f.render(code[:colon], -1)
+		out.typ = renderType(code[colon+1 : tEnd])
+		out.comment = comment
+		return
+	}
+
+	if f.depth > 0 && code[1].Kind == ASSIGN {
+		out.alignKind = "assign"
+		out.group = -1
+		out.name = code[0].Text
+		out.init = f.render(code[2:], -1)
+		out.comment = comment
+	}
+}
+
+// renderType renders a type expression; elementary names are upper-cased.
+func renderType(toks []Token) string {
+	if len(toks) == 0 {
+		return ""
+	}
+	colon := Token{Kind: COLON}
+	var f formatter
+	s := f.render(append([]Token{colon}, toks...), -1)
+	return strings.TrimPrefix(strings.TrimPrefix(s, ":"), " ")
+}
+
+// align pads the parts of consecutive alignable lines to common columns.
+// Runs of declaration lines belong to one VAR block or STRUCT; runs of
+// assignment lines must be adjacent and equally indented.
+func (f *formatter) align() {
+	for i := 0; i < len(f.lines); {
+		l := f.lines[i]
+		if l.alignKind == "" {
+			i++
+			continue
+		}
+		j := i + 1
+		for j < len(f.lines) {
+			m := f.lines[j]
+			if m.alignKind == l.alignKind && m.indent == l.indent &&
+				(l.alignKind == "decl" && m.group == l.group || l.alignKind == "assign" && !m.blankBefore) {
+				j++
+				continue
+			}
+			if l.alignKind == "decl" && m.alignKind == "" && isCommentLine(m.text) {
+				j++
+				continue
+			}
+			break
+		}
+		f.alignRun(f.lines[i:j])
+		i = j
+	}
+}
+
+func isCommentLine(s string) bool {
+	return strings.HasPrefix(s, "//") || strings.HasPrefix(s, "(*") || strings.HasPrefix(s, "/*")
+}
+
+func (f *formatter) alignRun(run []outLine) {
+	nameW, typW, codeW := 0, 0, 0
+	for _, l := range run {
+		if l.alignKind == "" {
+			continue
+		}
+		nameW = maxInt(nameW, len([]rune(l.name)))
+		if l.init != "" {
+			typW = maxInt(typW, len([]rune(l.typ)))
+		}
+	}
+	texts := make([]string, len(run))
+	for i, l := range run {
+		if l.alignKind == "" {
+			continue
+		}
+		s := pad(l.name, nameW)
+		switch l.alignKind {
+		case "decl":
+			s += " : "
+			if l.init != "" {
+				s += pad(l.typ, typW) + " := " + l.init
+			} else {
+				s += l.typ
+			}
+			s += ";"
+		case "assign":
+			s += " := " + l.init
+		}
+		texts[i] = s
+		if l.comment != "" {
+			codeW = maxInt(codeW, len([]rune(s)))
+		}
+	}
+	for i := range run {
+		l := &run[i]
+		if l.alignKind == "" {
+			continue
+		}
+		l.text = texts[i]
+		if l.comment != "" {
+			l.text = pad(l.text, codeW) + " " + l.comment
+		}
+	}
+}
+
+func pad(s string, w int) string {
+	if n := len([]rune(s)); n < w {
+		return s + strings.Repeat(" ", w-n)
+	}
+	return s
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
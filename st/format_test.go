@@ -0,0 +1,96 @@
+package st
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestFormatGolden formats every testdata/fmt/*.st file and compares the
+// result with the .golden file next to it. Formatting the result again must
+// not change it.
+func TestFormatGolden(t *testing.T) {
+	files, err := filepath.Glob("../testdata/fmt/*.st")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no test cases: %v", err)
+	}
+	for _, file := range files {
+		t.Run(strings.TrimSuffix(filepath.Base(file), ".st"), func(t *testing.T) {
+			src, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := os.ReadFile(strings.TrimSuffix(file, ".st") + ".golden")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := Format(string(src), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != string(want) {
+				t.Errorf("got:\n%s\nwant:\n%s", got, want)
+			}
+			again, err := Format(got, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if again != got {
+				t.Errorf("second run changed the output:\n%s", again)
+			}
+		})
+	}
+}
+
+func TestFormatOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		opts *FormatOptions
+		want string
+	}{
+		{
+			"tabs",
+			"PROGRAM Main\nVAR\nx : INT;\nEND_VAR\nIF x > 0 THEN x := 0; END_IF\nEND_PROGRAM\n",
+			&FormatOptions{Indent: "\t"},
+			"PROGRAM Main\nVAR\n\tx : INT;\nEND_VAR\nIF x > 0 THEN\n\tx := 0;\nEND_IF\nEND_PROGRAM\n",
+		},
+		{
+			"crlf",
+			"PROGRAM Main\r\nVAR\r\nx:INT;\r\nEND_VAR\r\nEND_PROGRAM\r\n",
+			nil,
+			"PROGRAM Main\r\nVAR\r\n    x : INT;\r\nEND_VAR\r\nEND_PROGRAM\r\n",
+		},
+		{
+			"bom",
+			"\uFEFFPROGRAM Main\nx:=1;   \nEND_PROGRAM",
+			nil,
+			"\uFEFFPROGRAM Main\nx := 1;\nEND_PROGRAM\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Format(tt.src, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestFormatSyntaxError checks that a file that does not parse comes back
+// unchanged together with the errors.
+func TestFormatSyntaxError(t *testing.T) {
+	src := "PROGRAM Main\nx :=  ;\nEND_PROGRAM\n"
+	got, err := Format(src, nil)
+	if err == nil {
+		t.Fatal("no error")
+	}
+	if got != src {
+		t.Errorf("source was changed:\n%s", got)
+	}
+}
@@ -0,0 +1,331 @@
+package st
+
+import (
+	"strings"
+)
+
+// ── Lexer ─────────────────────────────────────────────────────────────────────
+
+// Lexer splits Structured Text into tokens. Comments and pragmas are returned
+// as tokens too; the parser skips comments and attaches pragmas to the
+// declaration that follows them.
+type Lexer struct {
+	src  string
+	off  int
+	line int
+	col  int
+	errs ErrorList
+}
+
+// NewLexer returns a lexer for src. A leading UTF-8 byte order mark is skipped.
+func NewLexer(src string) *Lexer {
+	l := &Lexer{src: src, line: 1, col: 1}
+	if strings.HasPrefix(src, "\uFEFF") {
+		l.off = len("\uFEFF")
+	}
+	return l
+}
+
+// Errors returns the lexical errors found so far.
+func (l *Lexer) Errors() ErrorList { return l.errs }
+
+// Tokenize returns all tokens of src up to and including EOF, together with
+// any lexical errors.
+func Tokenize(src string) ([]Token, ErrorList) {
+	l := NewLexer(src)
+	var toks []Token
+	for {
+		t := l.Next()
+		toks = append(toks, t)
+		if t.Kind == EOF {
+			return toks, l.errs
+		}
+	}
+}
+
+func (l *Lexer) pos() Pos { return Pos{Offset: l.off, Line: l.line, Col: l.col} }
+
+func (l *Lexer) peek(n int) byte {
+	if l.off+n < len(l.src) {
+		return l.src[l.off+n]
+	}
+	return 0
+}
+
+func (l *Lexer) advance(n int) {
+	for i := 0; i < n && l.off < len(l.src); i++ {
+		if l.src[l.off] == '\n' {
+			l.line++
+			l.col = 1
+		} else {
+			l.col++
+		}
+		l.off++
+	}
+}
+
+func (l *Lexer) errorf(p Pos, format string, args ...any) {
+	l.errs.Add(p, format, args...)
+}
+
+func isLetter(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+func isHexDigit(c byte) bool {
+	return isDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+// Next returns the next token.
+func (l *Lexer) Next() Token {
+	for l.off < len(l.src) {
+		c := l.src[l.off]
+		if c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\f' || c == '\v' {
+			l.advance(1)
+			continue
+		}
+		break
+	}
+	start := l.pos()
+	if l.off >= len(l.src) {
+		return Token{Kind: EOF, Pos: start, End: start}
+	}
+
+	kind := l.scan(start)
+	return Token{Kind: kind, Text: l.src[start.Offset:l.off], Pos: start, End: l.pos()}
+}
+
+func (l *Lexer) scan(start Pos) Kind {
+	c := l.src[l.off]
+	switch {
+	case c == '/' && l.peek(1) == '/':
+		for l.off < len(l.src) && l.src[l.off] != '\n' && l.src[l.off] != '\r' {
+			l.advance(1)
+		}
+		return COMMENT
+	case c == '(' && l.peek(1) == '*':
+		l.blockComment(start, "(*", "*)")
+		return COMMENT
+	case c == '/' && l.peek(1) == '*':
+		l.blockComment(start, "/*", "*/")
+		return COMMENT
+	case c == '{':
+		end := strings.IndexByte(l.src[l.off:], '}')
+		if end < 0 {
+			l.errorf(start, "pragma not terminated")
+			l.advance(len(l.src) - l.off)
+		} else {
+			l.advance(end + 1)
+		}
+		return PRAGMA
+	case isLetter(c):
+		return l.identOrTyped()
+	case isDigit(c):
+		return l.number()
+	case c == '\'' || c == '"':
+		l.stringLit(start, c)
+		if c == '"' {
+			return WSTRING
+		}
+		return STRING
+	case c == '%':
+		l.advance(1)
+		for l.off < len(l.src) && (isLetter(l.src[l.off]) || isDigit(l.src[l.off]) || l.src[l.off] == '.' || l.src[l.off] == '*') {
+			l.advance(1)
+		}
+		return ADDRESS
+	}
+
+	two := ""
+	if l.off+1 < len(l.src) {
+		two = l.src[l.off : l.off+2]
+	}
+	switch two {
+	case ":=":
+		l.advance(2)
+		return ASSIGN
+	case "=>":
+		l.advance(2)
+		return OUTPUT
+	case "..":
+		l.advance(2)
+		return RANGE
+	case "**":
+		l.advance(2)
+		return POWER
+	case "<>":
+		l.advance(2)
+		return NEQ
+	case "<=":
+		l.advance(2)
+		return LEQ
+	case ">=":
+		l.advance(2)
+		return GEQ
+	}
+
+	l.advance(1)
+	switch c {
+	case ':':
+		return COLON
+	case ';':
+		return SEMICOLON
+	case ',':
+		return COMMA
+	case '.':
+		return DOT
+	case '#':
+		return HASH
+	case '^':
+		return CARET
+	case '(':
+		return LPAREN
+	case ')':
+		return RPAREN
+	case '[':
+		return LBRACK
+	case ']':
+		return RBRACK
+	case '+':
+		return PLUS
+	case '-':
+		return MINUS
+	case '*':
+		return STAR
+	case '/':
+		return SLASH
+	case '&':
+		return AMP
+	case '=':
+		return EQ
+	case '<':
+		return LT
+	case '>':
+		return GT
+	}
+	l.errorf(start, "illegal character %q", c)
+	return ILLEGAL
+}
+
+// blockComment consumes a comment delimited by open/close. Comments of the
+// same style nest, as in CoDeSys with nested comments enabled.
+func (l *Lexer) blockComment(start Pos, open, close string) {
+	depth := 0
+	for l.off < len(l.src) {
+		switch {
+		case strings.HasPrefix(l.src[l.off:], open):
+			depth++
+			l.advance(2)
+		case strings.HasPrefix(l.src[l.off:], close):
+			depth--
+			l.advance(2)
+			if depth == 0 {
+				return
+			}
+		default:
+			l.advance(1)
+		}
+	}
+	l.errorf(start, "comment not terminated")
+}
+
+func (l *Lexer) stringLit(start Pos, quote byte) {
+	l.advance(1)
+	for l.off < len(l.src) {
+		c := l.src[l.off]
+		switch {
+		case c == '$' && l.off+1 < len(l.src):
+			l.advance(2)
+		case c == quote:
+			l.advance(1)
+			return
+		case c == '\n':
+			l.errorf(start, "string literal not terminated")
+			return
+		default:
+			l.advance(1)
+		}
+	}
+	l.errorf(start, "string literal not terminated")
+}
+
+func (l *Lexer) identOrTyped() Kind {
+	begin := l.off
+	for l.off < len(l.src) && (isLetter(l.src[l.off]) || isDigit(l.src[l.off])) {
+		l.advance(1)
+	}
+	word := strings.ToUpper(l.src[begin:l.off])
+	if l.peek(0) == '#' {
+		switch {
+		case timePrefixes[word]:
+			l.advance(1)
+			if l.peek(0) == '-' || l.peek(0) == '+' {
+				l.advance(1)
+			}
+			for l.off < len(l.src) {
+				c := l.src[l.off]
+				if isLetter(c) || isDigit(c) || c == '.' || c == ':' || c == '-' {
+					// '-' only separates date parts, never starts an operator here
+					if c == '-' && !isDigit(l.peek(1)) {
+						break
+					}
+					l.advance(1)
+					continue
+				}
+				break
+			}
+			return TIME
+		case elementaryTypes[word] && word != "STRING" && word != "WSTRING":
+			// typed literal such as INT#5, WORD#16#FF, BOOL#TRUE, REAL#1.5
+			l.advance(1)
+			c := l.peek(0)
+			switch {
+			case isDigit(c):
+				return l.number()
+			case c == '-' || c == '+':
+				l.advance(1)
+				return l.number()
+			case isLetter(c):
+				for l.off < len(l.src) && (isLetter(l.src[l.off]) || isDigit(l.src[l.off])) {
+					l.advance(1)
+				}
+				return INT // BOOL#TRUE and friends; Literal.Bool sorts it out
+			}
+			return INT
+		}
+	}
+	if keywords[word] {
+		return KEYWORD
+	}
+	return IDENT
+}
+
+func (l *Lexer) number() Kind {
+	digits := func(ok func(byte) bool) {
+		for l.off < len(l.src) && (ok(l.src[l.off]) || l.src[l.off] == '_') {
+			l.advance(1)
+		}
+	}
+	digits(isDigit)
+	if l.peek(0) == '#' && isHexDigit(l.peek(1)) {
+		// based integer: 2#…, 8#…, 16#…
+		l.advance(1)
+		digits(isHexDigit)
+		return INT
+	}
+	kind := INT
+	if l.peek(0) == '.' && isDigit(l.peek(1)) {
+		kind = REAL
+		l.advance(1)
+		digits(isDigit)
+	}
+	if (l.peek(0) == 'e' || l.peek(0) == 'E') &&
+		(isDigit(l.peek(1)) || ((l.peek(1) == '+' || l.peek(1) == '-') && isDigit(l.peek(2)))) {
+		kind = REAL
+		l.advance(2)
+		digits(isDigit)
+	}
+	return kind
+}
@@ -0,0 +1,263 @@
+package st
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ── Literal values ────────────────────────────────────────────────────────────
+
+// splitTyped splits a typed literal such as INT#5 or T#1s into its upper-case
+// prefix and the value text. Based integers (16#FF) have no prefix.
+func splitTyped(text string) (prefix, value string) {
+	i := strings.IndexByte(text, '#')
+	if i <= 0 || !isLetter(text[0]) {
+		return "", text
+	}
+	return strings.ToUpper(text[:i]), text[i+1:]
+}
+
+// TypePrefix returns the upper-case type prefix of a typed literal (INT of
+// INT#5, T of T#1s), or "".
+func (e *Literal) TypePrefix() string {
+	p, _ := splitTyped(e.Text)
+	return p
+}
+
+// Int returns the value of an integer or boolean literal. TRUE is 1.
+func (e *Literal) Int() (int64, bool) {
+	if e.Kind == KEYWORD {
+		if strings.EqualFold(e.Text, "TRUE") {
+			return 1, true
+		}
+		return 0, true
+	}
+	if e.Kind != INT {
+		return 0, false
+	}
+	_, v := splitTyped(e.Text)
+	return ParseInt(v)
+}
+
+// Real returns the value of a numeric literal as a float.
+func (e *Literal) Real() (float64, bool) {
+	switch e.Kind {
+	case INT:
+		n, ok := e.Int()
+		return float64(n), ok
+	case REAL:
+		_, v := splitTyped(e.Text)
+		f, err := strconv.ParseFloat(strings.ReplaceAll(v, "_", ""), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// Bool returns the value of TRUE, FALSE and BOOL#… literals.
+func (e *Literal) Bool() (bool, bool) {
+	switch e.Kind {
+	case KEYWORD:
+		return strings.EqualFold(e.Text, "TRUE"), true
+	case INT:
+		if e.TypePrefix() == "BOOL" {
+			_, v := splitTyped(e.Text)
+			switch strings.ToUpper(v) {
+			case "TRUE", "1":
+				return true, true
+			case "FALSE", "0":
+				return false, true
+			}
+		}
+	}
+	return false, false
+}
+
+// Str returns the decoded value of a string literal, with $-escapes resolved.
+func (e *Literal) Str() (string, bool) {
+	if e.Kind != STRING && e.Kind != WSTRING {
+		return "", false
+	}
+	return Unquote(e.Text), true
+}
+
+// Duration returns the value of a TIME or LTIME literal (T#1h2m3s4ms).
+func (e *Literal) Duration() (time.Duration, bool) {
+	if e.Kind != TIME {
+		return 0, false
+	}
+	switch e.TypePrefix() {
+	case "T", "TIME", "LT", "LTIME":
+	default:
+		return 0, false
+	}
+	_, v := splitTyped(e.Text)
+	return ParseDuration(v)
+}
+
+// ParseInt parses a decimal or based (2#, 8#, 16#) integer with optional
+// underscores and sign.
+func ParseInt(s string) (int64, bool) {
+	s = strings.ReplaceAll(s, "_", "")
+	neg := false
+	if strings.HasPrefix(s, "-") || strings.HasPrefix(s, "+") {
+		neg = s[0] == '-'
+		s = s[1:]
+	}
+	base := 10
+	if i := strings.IndexByte(s, '#'); i > 0 {
+		b, err := strconv.Atoi(s[:i])
+		if err != nil || (b != 2 && b != 8 && b != 16) {
+			return 0, false
+		}
+		base, s = b, s[i+1:]
+	}
+	u, err := strconv.ParseUint(s, base, 64)
+	if err != nil {
+		return 0, false
+	}
+	if neg {
+		if u > 1<<63 {
+			return 0, false
+		}
+		return -int64(u), true
+	}
+	return int64(u), true // ULINT values above MaxInt64 wrap, as in two's complement
+}
+
+// ParseDuration parses the value part of a time literal: 1h2m3s4ms, 1.5s,
+// 10us, 5ns, 2d. Units may be written in any case and separated by '_'.
+func ParseDuration(s string) (time.Duration, bool) {
+	s = strings.ToLower(strings.ReplaceAll(s, "_", ""))
+	neg := false
+	if strings.HasPrefix(s, "-") {
+		neg, s = true, s[1:]
+	}
+	if s == "" {
+		return 0, false
+	}
+	units := []struct {
+		name string
+		d    time.Duration
+	}{
+		{"ms", time.Millisecond}, {"us", time.Microsecond}, {"ns", time.Nanosecond},
+		{"d", 24 * time.Hour}, {"h", time.Hour}, {"m", time.Minute}, {"s", time.Second},
+	}
+	var total float64
+	for s != "" {
+		i := 0
+		for i < len(s) && (isDigit(s[i]) || s[i] == '.') {
+			i++
+		}
+		if i == 0 {
+			return 0, false
+		}
+		n, err := strconv.ParseFloat(s[:i], 64)
+		if err != nil {
+			return 0, false
+		}
+		s = s[i:]
+		found := false
+		for _, u := range units {
+			if strings.HasPrefix(s, u.name) {
+				total += n * float64(u.d)
+				s = s[len(u.name):]
+				found = true
+				break
+			}
+		}
+		if !found {
+			if s != "" {
+				return 0, false
+			}
+			total += n * float64(time.Millisecond) // a bare number counts milliseconds
+		}
+	}
+	if total > math.MaxInt64 {
+		return 0, false
+	}
+	if neg {
+		total = -total
+	}
+	return time.Duration(total), true
+}
+
+// Unquote decodes a 'string' or "wstring" literal: $$, $', $", $L, $N, $P,
+// $R, $T and $hh (two hex digits, four for WSTRING).
+func Unquote(lit string) string {
+	if len(lit) < 2 {
+		return lit
+	}
+	wide := lit[0] == '"'
+	s := lit[1 : len(lit)-1]
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '$' || i+1 >= len(s) {
+			sb.WriteByte(c)
+			continue
+		}
+		i++
+		switch n := s[i]; n {
+		case 'L', 'l', 'N', 'n':
+			sb.WriteByte('\n')
+		case 'P', 'p':
+			sb.WriteByte('\f')
+		case 'R', 'r':
+			sb.WriteByte('\r')
+		case 'T', 't':
+			sb.WriteByte('\t')
+		default:
+			digits := 2
+			if wide {
+				digits = 4
+			}
+			if i+digits <= len(s) {
+				if v, err := strconv.ParseUint(s[i:i+digits], 16, 32); err == nil {
+					if wide {
+						sb.WriteRune(rune(v))
+					} else {
+						sb.WriteByte(byte(v))
+					}
+					i += digits - 1
+					continue
+				}
+			}
+			sb.WriteByte(n) // $$, $', $"
+		}
+	}
+	return sb.String()
+}
+
+// Quote encodes s as an ST string literal, escaping quotes, $ and control
+// characters.
+func Quote(s string, wide bool) string {
+	q := byte('\'')
+	if wide {
+		q = '"'
+	}
+	var sb strings.Builder
+	sb.WriteByte(q)
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '$' || c == q:
+			sb.WriteByte('$')
+			sb.WriteByte(c)
+		case c == '\n':
+			sb.WriteString("$N")
+		case c == '\r':
+			sb.WriteString("$R")
+		case c == '\t':
+			sb.WriteString("$T")
+		case c == '\f':
+			sb.WriteString("$P")
+		case c < 0x20:
+			sb.WriteString("$" + strings.ToUpper(strconv.FormatUint(uint64(c)|0x100, 16)[1:]))
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	sb.WriteByte(q)
+	return sb.String()
+}
@@ -0,0 +1,1119 @@
+package st
+
+import (
+	"sort"
+	"strings"
+)
+
+// ── Parser ────────────────────────────────────────────────────────────────────
+
+// Parse parses the Structured Text in src. It always returns a File; when the
+// source contains errors the File holds everything that could be recovered
+// and the returned error is an ErrorList.
+func Parse(name, src string) (*File, error) {
+	all, lexErrs := Tokenize(src)
+	p := &parser{errs: lexErrs}
+	var pending []*Pragma
+	for _, t := range all {
+		switch t.Kind {
+		case COMMENT:
+			p.comments = append(p.comments, t)
+		case PRAGMA:
+			pending = append(pending, &Pragma{Text: t.Text, PragPos: t.Pos})
+		default:
+			p.toks = append(p.toks, t)
+			p.prags = append(p.prags, pending)
+			pending = nil
+		}
+	}
+
+	f := &File{Name: name, Comments: p.comments, Source: src}
+	for p.tok().Kind != EOF {
+		if d := p.parseDecl(); d != nil {
+			f.Decls = append(f.Decls, d)
+		}
+	}
+	p.errs.Sort()
+	return f, p.errs.Err()
+}
+
+type parser struct {
+	toks     []Token     // significant tokens, ending with EOF
+	prags    [][]*Pragma // pragmas directly in front of toks[i]
+	comments []Token
+	i        int
+	errs     ErrorList
+}
+
+func (p *parser) tok() Token { return p.toks[p.i] }
+
+func (p *parser) peek(n int) Token {
+	if p.i+n < len(p.toks) {
+		return p.toks[p.i+n]
+	}
+	return p.toks[len(p.toks)-1]
+}
+
+func (p *parser) next() Token {
+	t := p.toks[p.i]
+	if p.i < len(p.toks)-1 {
+		p.i++
+	}
+	return t
+}
+
+func (p *parser) errorf(pos Pos, format string, args ...any) {
+	// one error per position is enough; recovery often re-reports
+	if n := len(p.errs); n > 0 && p.errs[n-1].Pos == pos {
+		return
+	}
+	p.errs.Add(pos, format, args...)
+}
+
+func (p *parser) expect(k Kind) Token {
+	t := p.tok()
+	if t.Kind != k {
+		p.errorf(t.Pos, "expected %s, found %s", k, t)
+		return Token{Kind: k, Pos: t.Pos}
+	}
+	return p.next()
+}
+
+func (p *parser) expectKw(kw string) Token {
+	t := p.tok()
+	if !t.Is(kw) {
+		p.errorf(t.Pos, "expected %s, found %s", kw, t)
+		return Token{Kind: KEYWORD, Text: kw, Pos: t.Pos}
+	}
+	return p.next()
+}
+
+func (p *parser) accept(k Kind) bool {
+	if p.tok().Kind == k {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *parser) acceptKw(kw string) bool {
+	if p.tok().Is(kw) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *parser) ident() *Ident {
+	t := p.tok()
+	if t.Kind != IDENT {
+		p.errorf(t.Pos, "expected identifier, found %s", t)
+		return &Ident{Name: "_", NamePos: t.Pos}
+	}
+	p.next()
+	return &Ident{Name: t.Text, NamePos: t.Pos}
+}
+
+// pragmas returns the pragmas written in front of the current token.
+func (p *parser) pragmas() []*Pragma { return p.prags[p.i] }
+
+// skipTo advances to the next token of one of the given kinds or keywords
+// (given in upper case), for error recovery.
+func (p *parser) skipTo(kinds []Kind, kws ...string) {
+	for {
+		t := p.tok()
+		if t.Kind == EOF {
+			return
+		}
+		for _, k := range kinds {
+			if t.Kind == k {
+				return
+			}
+		}
+		if t.Kind == KEYWORD {
+			for _, kw := range kws {
+				if t.Is(kw) {
+					return
+				}
+			}
+		}
+		p.next()
+	}
+}
+
+// ── Comments ──────────────────────────────────────────────────────────────────
+
+// trailingComment returns the text of a comment that starts on line after
+// offset off, or "".
+func (p *parser) trailingComment(line, off int) string {
+	for _, c := range p.comments {
+		if c.Pos.Line == line && c.Pos.Offset >= off {
+			return commentText(c.Text)
+		}
+		if c.Pos.Line > line {
+			break
+		}
+	}
+	return ""
+}
+
+// leadingComment returns the comment lines that end directly above pos, with
+// no code in between. A comment on the line where the previous code ends
+// trails that code and is not included.
+func (p *parser) leadingComment(pos Pos, prevEnd int) string {
+	prevLine := 0
+	if k := sort.Search(len(p.toks), func(k int) bool { return p.toks[k].End.Offset >= prevEnd }); prevEnd > 0 && k < len(p.toks) {
+		prevLine = p.toks[k].End.Line
+	}
+	var lines []string
+	want := pos.Line - 1
+	for k := len(p.comments) - 1; k >= 0; k-- {
+		c := p.comments[k]
+		if c.Pos.Offset >= pos.Offset {
+			continue
+		}
+		if c.Pos.Offset < prevEnd || c.End.Line != want || c.Pos.Line == prevLine {
+			break
+		}
+		lines = append([]string{commentText(c.Text)}, lines...)
+		want = c.Pos.Line - 1
+	}
+	return strings.Join(lines, "\n")
+}
+
+// headerComment returns all comments between prevEnd and pos, used for the
+// description block in front of a POU.
+func (p *parser) headerComment(pos Pos, prevEnd int) string {
+	var lines []string
+	for _, c := range p.comments {
+		if c.Pos.Offset >= prevEnd && c.Pos.Offset < pos.Offset {
+			lines = append(lines, commentText(c.Text))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// commentText strips the comment delimiters.
+func commentText(s string) string {
+	switch {
+	case strings.HasPrefix(s, "//"):
+		return strings.TrimSpace(s[2:])
+	case strings.HasPrefix(s, "(*"), strings.HasPrefix(s, "/*"):
+		s = s[2:]
+		if len(s) >= 2 {
+			s = s[:len(s)-2]
+		}
+		return strings.TrimSpace(s)
+	}
+	return s
+}
+
+func (p *parser) prevEnd() int {
+	if p.i == 0 {
+		return 0
+	}
+	return p.toks[p.i-1].End.Offset
+}
+
+// ── Declarations ──────────────────────────────────────────────────────────────
+
+func isVarBlockKw(t Token) bool {
+	if t.Kind != KEYWORD {
+		return false
+	}
+	switch t.Upper() {
+	case "VAR", "VAR_INPUT", "VAR_OUTPUT", "VAR_IN_OUT", "VAR_GLOBAL", "VAR_EXTERNAL",
+		"VAR_TEMP", "VAR_STAT", "VAR_INST", "VAR_CONFIG", "VAR_ACCESS":
+		return true
+	}
+	return false
+}
+
+func (p *parser) parseDecl() Decl {
+	t := p.tok()
+	switch {
+	case t.Is("PROGRAM"), t.Is("FUNCTION_BLOCK"), t.Is("FUNCTION"):
+		return p.parsePOU()
+	case t.Is("TYPE"):
+		return p.parseTypeBlock()
+	case t.Is("CONFIGURATION"):
+		return p.parseConfiguration()
+	case isVarBlockKw(t):
+		return p.parseVarBlock()
+	}
+	p.errorf(t.Pos, "expected PROGRAM, FUNCTION_BLOCK, FUNCTION, TYPE, CONFIGURATION or VAR_GLOBAL, found %s", t)
+	p.next()
+	p.skipTo(nil, "PROGRAM", "FUNCTION_BLOCK", "FUNCTION", "TYPE", "CONFIGURATION", "VAR_GLOBAL")
+	return nil
+}
+
+var accessModifiers = []string{"PUBLIC", "PRIVATE", "PROTECTED", "INTERNAL", "ABSTRACT", "FINAL"}
+
+func (p *parser) skipModifiers() {
+	for {
+		found := false
+		for _, m := range accessModifiers {
+			if p.acceptKw(m) {
+				found = true
+			}
+		}
+		if !found {
+			return
+		}
+	}
+}
+
+func (p *parser) parsePOU() *POU {
+	prevEnd := p.prevEnd()
+	pragmas := p.pragmas()
+	kw := p.next()
+	d := &POU{KwPos: kw.Pos, Pragmas: pragmas}
+	d.Doc = p.headerComment(kw.Pos, prevEnd)
+	end := "END_" + kw.Upper()
+	switch kw.Upper() {
+	case "PROGRAM":
+		d.Kind = Program
+	case "FUNCTION_BLOCK":
+		d.Kind = FunctionBlock
+	case "FUNCTION":
+		d.Kind = Function
+	case "METHOD":
+		d.Kind = Method
+	}
+	p.skipModifiers()
+	d.Name = p.ident()
+
+	if d.Kind == Function || d.Kind == Method {
+		if p.accept(COLON) {
+			d.ReturnType = p.parseTypeSpec()
+		}
+	}
+	if d.Kind == FunctionBlock {
+		if p.acceptKw("EXTENDS") {
+			d.Extends = p.ident()
+		}
+		if p.acceptKw("IMPLEMENTS") {
+			p.ident()
+			for p.accept(COMMA) {
+				p.ident()
+			}
+		}
+	}
+	p.accept(SEMICOLON)
+
+	for {
+		switch t := p.tok(); {
+		case isVarBlockKw(t):
+			d.VarBlocks = append(d.VarBlocks, p.parseVarBlock())
+			continue
+		case d.Kind == FunctionBlock && t.Is("METHOD"):
+			d.Methods = append(d.Methods, p.parsePOU())
+			continue
+		case d.Kind == FunctionBlock && t.Is("PROPERTY"):
+			d.Properties = append(d.Properties, p.parseProperty())
+			continue
+		}
+		break
+	}
+
+	d.Body = p.parseStmtList(end, "METHOD", "PROPERTY")
+	for d.Kind == FunctionBlock && (p.tok().Is("METHOD") || p.tok().Is("PROPERTY")) {
+		if p.tok().Is("METHOD") {
+			d.Methods = append(d.Methods, p.parsePOU())
+		} else {
+			d.Properties = append(d.Properties, p.parseProperty())
+		}
+		d.Body = append(d.Body, p.parseStmtList(end, "METHOD", "PROPERTY")...)
+	}
+	d.EndPos = p.expectKw(end).Pos
+	p.accept(SEMICOLON)
+	return d
+}
+
+// parseProperty parses PROPERTY name : type followed by GET … END_GET and
+// SET … END_SET accessors. GET and SET are not reserved words, so they are
+// only recognised here.
+func (p *parser) parseProperty() *Property {
+	pragmas := p.pragmas()
+	kw := p.next()
+	d := &Property{KwPos: kw.Pos, Pragmas: pragmas}
+	p.skipModifiers()
+	d.Name = p.ident()
+	p.expect(COLON)
+	d.Type = p.parseTypeSpec()
+	p.accept(SEMICOLON)
+
+	for {
+		t := p.tok()
+		if t.Kind != IDENT || !(strings.EqualFold(t.Text, "GET") || strings.EqualFold(t.Text, "SET")) {
+			break
+		}
+		p.next()
+		m := &POU{Kind: Method, Name: d.Name, KwPos: t.Pos}
+		end := "END_SET"
+		if strings.EqualFold(t.Text, "GET") {
+			m.ReturnType = d.Type
+			end = "END_GET"
+		}
+		for isVarBlockKw(p.tok()) {
+			m.VarBlocks = append(m.VarBlocks, p.parseVarBlock())
+		}
+		m.Body = p.parseStmtList(end, "END_PROPERTY")
+		m.EndPos = p.expectKw(end).Pos
+		p.accept(SEMICOLON)
+		if end == "END_GET" {
+			d.Get = m
+		} else {
+			d.Set = m
+		}
+	}
+	d.EndPos = p.expectKw("END_PROPERTY").Pos
+	p.accept(SEMICOLON)
+	return d
+}
+
+func (p *parser) parseVarBlock() *VarBlock {
+	pragmas := p.pragmas()
+	kw := p.next()
+	b := &VarBlock{Kind: kw.Upper(), KwPos: kw.Pos, Pragmas: pragmas}
+	for {
+		switch {
+		case p.acceptKw("CONSTANT"):
+			b.Constant = true
+		case p.acceptKw("RETAIN"):
+			b.Retain = true
+		case p.acceptKw("PERSISTENT"):
+			b.Persistent = true
+		case p.acceptKw("NON_RETAIN"):
+		default:
+			goto decls
+		}
+	}
+decls:
+	for !p.tok().Is("END_VAR") && p.tok().Kind != EOF {
+		if v := p.parseVarDecl(); v != nil {
+			b.Vars = append(b.Vars, v)
+		}
+		if t := p.tok(); isVarBlockKw(t) || t.Is("END_STRUCT") || t.Is("END_TYPE") {
+			break
+		}
+	}
+	b.EndPos = p.expectKw("END_VAR").Pos
+	p.accept(SEMICOLON)
+	return b
+}
+
+// parseVarDecl parses name {, name} [AT addr] : type [:= init] ;
+func (p *parser) parseVarDecl() *VarDecl {
+	prevEnd := p.prevEnd()
+	v := &VarDecl{Pragmas: p.pragmas()}
+	if p.tok().Kind != IDENT {
+		p.errorf(p.tok().Pos, "expected variable name, found %s", p.tok())
+		p.skipTo([]Kind{SEMICOLON}, "END_VAR", "END_STRUCT")
+		p.accept(SEMICOLON)
+		return nil
+	}
+	v.Names = append(v.Names, p.ident())
+	for p.accept(COMMA) {
+		v.Names = append(v.Names, p.ident())
+	}
+	if p.acceptKw("AT") {
+		t := p.expect(ADDRESS)
+		v.At = &t
+	}
+	p.expect(COLON)
+	v.Type = p.parseTypeSpec()
+	if p.accept(ASSIGN) {
+		v.Init = p.parseInit()
+	}
+	semi := p.tok()
+	if semi.Kind != SEMICOLON {
+		p.errorf(semi.Pos, "expected ';' after declaration of %s, found %s", v.Names[0].Name, semi)
+		p.skipTo([]Kind{SEMICOLON}, "END_VAR", "END_STRUCT")
+		semi = p.tok()
+	}
+	p.accept(SEMICOLON)
+	v.Comment = p.trailingComment(semi.Pos.Line, semi.End.Offset)
+	if v.Comment == "" {
+		v.Comment = p.leadingComment(v.Names[0].NamePos, prevEnd)
+	}
+	return v
+}
+
+// parseInit parses an initial value: an expression, an array initialiser
+// [..] or a structure initialiser (a := 1, …).
+func (p *parser) parseInit() Expr {
+	t := p.tok()
+	switch {
+	case t.Kind == LBRACK:
+		p.next()
+		ai := &ArrayInit{LBrack: t.Pos}
+		for p.tok().Kind != RBRACK && p.tok().Kind != EOF {
+			ai.Elems = append(ai.Elems, p.parseArrayElem())
+			if !p.accept(COMMA) {
+				break
+			}
+		}
+		p.expect(RBRACK)
+		return ai
+	case t.Kind == LPAREN && p.peek(1).Kind == IDENT && p.peek(2).Kind == ASSIGN:
+		p.next()
+		si := &StructInit{LParen: t.Pos}
+		for p.tok().Kind != RPAREN && p.tok().Kind != EOF {
+			fi := &FieldInit{Name: p.ident()}
+			p.expect(ASSIGN)
+			fi.Value = p.parseInit()
+			si.Fields = append(si.Fields, fi)
+			if !p.accept(COMMA) {
+				break
+			}
+		}
+		p.expect(RPAREN)
+		return si
+	}
+	return p.parseExpr()
+}
+
+func (p *parser) parseArrayElem() *ArrayElem {
+	e := &ArrayElem{}
+	if p.tok().Kind == LBRACK || (p.tok().Kind == LPAREN && p.peek(1).Kind == IDENT && p.peek(2).Kind == ASSIGN) {
+		e.Value = p.parseInit()
+		return e
+	}
+	x := p.parseExpr()
+	if p.tok().Kind == LPAREN {
+		// repetition: n(value)
+		p.next()
+		e.Count = x
+		if p.tok().Kind != RPAREN {
+			e.Value = p.parseInit()
+		}
+		p.expect(RPAREN)
+		return e
+	}
+	e.Value = x
+	return e
+}
+
+// ── Types ─────────────────────────────────────────────────────────────────────
+
+func (p *parser) parseTypeSpec() TypeSpec {
+	t := p.tok()
+	switch {
+	case t.Is("ARRAY"):
+		p.next()
+		at := &ArrayType{KwPos: t.Pos}
+		p.expect(LBRACK)
+		for {
+			lo := p.parseExpr()
+			p.expect(RANGE)
+			at.Dims = append(at.Dims, &Subrange{Lo: lo, Hi: p.parseExpr()})
+			if !p.accept(COMMA) {
+				break
+			}
+		}
+		p.expect(RBRACK)
+		p.expectKw("OF")
+		at.Elem = p.parseTypeSpec()
+		return at
+	case t.Is("POINTER"), t.Is("REFERENCE"):
+		p.next()
+		pt := &PointerType{Ref: t.Is("REFERENCE"), KwPos: t.Pos}
+		p.expectKw("TO")
+		pt.Elem = p.parseTypeSpec()
+		return pt
+	case t.Is("STRUCT"):
+		p.next()
+		s := &StructType{KwPos: t.Pos}
+		for !p.tok().Is("END_STRUCT") && !p.tok().Is("END_TYPE") && !p.tok().Is("END_VAR") && p.tok().Kind != EOF {
+			if v := p.parseVarDecl(); v != nil {
+				s.Fields = append(s.Fields, v)
+			}
+		}
+		s.EndPos = p.expectKw("END_STRUCT").Pos
+		return s
+	case t.Kind == LPAREN:
+		return p.parseEnum()
+	case t.Kind == IDENT && (strings.EqualFold(t.Text, "STRING") || strings.EqualFold(t.Text, "WSTRING")):
+		p.next()
+		s := &StringType{Wide: strings.EqualFold(t.Text, "WSTRING"), KwPos: t.Pos}
+		switch p.tok().Kind {
+		case LPAREN:
+			p.next()
+			s.Len = p.parseExpr()
+			p.expect(RPAREN)
+		case LBRACK:
+			p.next()
+			s.Len = p.parseExpr()
+			p.expect(RBRACK)
+		}
+		return s
+	case t.Kind == IDENT:
+		name := p.ident()
+		for p.tok().Kind == DOT && p.peek(1).Kind == IDENT {
+			p.next()
+			name.Name += "." + p.next().Text
+		}
+		nt := &NamedType{Name: name}
+		if p.tok().Kind == LPAREN && IsElementaryType(name.Name) {
+			p.next()
+			lo := p.parseExpr()
+			p.expect(RANGE)
+			hi := p.parseExpr()
+			p.expect(RPAREN)
+			return &SubrangeType{Base: nt, Range: &Subrange{Lo: lo, Hi: hi}}
+		}
+		return nt
+	}
+	p.errorf(t.Pos, "expected type, found %s", t)
+	return &NamedType{Name: &Ident{Name: "_", NamePos: t.Pos}}
+}
+
+func (p *parser) parseEnum() *EnumType {
+	lp := p.expect(LPAREN)
+	e := &EnumType{LPos: lp.Pos}
+	for p.tok().Kind != RPAREN && p.tok().Kind != EOF {
+		ev := &EnumValue{Name: p.ident()}
+		if p.accept(ASSIGN) {
+			ev.Value = p.parseExpr()
+		}
+		sep := p.tok()
+		e.Values = append(e.Values, ev)
+		if !p.accept(COMMA) {
+			ev.Comment = p.trailingComment(ev.Name.NamePos.Line, ev.Name.NamePos.Offset)
+			break
+		}
+		ev.Comment = p.trailingComment(sep.Pos.Line, sep.End.Offset)
+	}
+	p.expect(RPAREN)
+	if p.tok().Kind == IDENT {
+		e.Base = p.parseTypeSpec()
+	}
+	return e
+}
+
+func (p *parser) parseTypeBlock() *TypeBlock {
+	outer := p.pragmas() // pragmas above TYPE belong to the first type
+	kw := p.next()
+	b := &TypeBlock{KwPos: kw.Pos}
+	for !p.tok().Is("END_TYPE") && p.tok().Kind != EOF {
+		prevEnd := p.prevEnd()
+		pragmas := p.pragmas()
+		if len(b.Types) == 0 && len(outer) > 0 {
+			pragmas = append(outer[:len(outer):len(outer)], pragmas...)
+		}
+		if p.tok().Kind != IDENT {
+			p.errorf(p.tok().Pos, "expected type name, found %s", p.tok())
+			p.skipTo([]Kind{SEMICOLON}, "END_TYPE")
+			p.accept(SEMICOLON)
+			continue
+		}
+		td := &TypeDecl{Name: p.ident(), Pragmas: pragmas}
+		if p.acceptKw("EXTENDS") {
+			td.Extends = p.ident()
+		}
+		p.expect(COLON)
+		td.Type = p.parseTypeSpec()
+		if p.accept(ASSIGN) {
+			td.Init = p.parseInit()
+		}
+		semi := p.tok()
+		if _, isStruct := td.Type.(*StructType); isStruct {
+			p.accept(SEMICOLON)
+		} else {
+			p.expect(SEMICOLON)
+		}
+		td.Comment = p.trailingComment(semi.Pos.Line, semi.Pos.Offset)
+		if td.Comment == "" {
+			td.Comment = p.leadingComment(td.Name.NamePos, prevEnd)
+		}
+		b.Types = append(b.Types, td)
+	}
+	b.EndPos = p.expectKw("END_TYPE").Pos
+	p.accept(SEMICOLON)
+	return b
+}
+
+func (p *parser) parseConfiguration() *Configuration {
+	pragmas := p.pragmas()
+	kw := p.next()
+	c := &Configuration{KwPos: kw.Pos, Pragmas: pragmas}
+	c.Name = p.ident()
+	var implicit *Resource
+	for !p.tok().Is("END_CONFIGURATION") && p.tok().Kind != EOF {
+		t := p.tok()
+		switch {
+		case isVarBlockKw(t):
+			c.VarBlocks = append(c.VarBlocks, p.parseVarBlock())
+		case t.Is("RESOURCE"):
+			c.Resources = append(c.Resources, p.parseResource())
+		case t.Is("TASK"), t.Is("PROGRAM"):
+			if implicit == nil {
+				implicit = &Resource{KwPos: t.Pos}
+				c.Resources = append(c.Resources, implicit)
+			}
+			p.parseResourceItem(implicit)
+		default:
+			p.errorf(t.Pos, "expected VAR_GLOBAL, RESOURCE, TASK or PROGRAM in configuration, found %s", t)
+			p.next()
+			p.skipTo(nil, "VAR_GLOBAL", "RESOURCE", "TASK", "PROGRAM", "END_CONFIGURATION")
+		}
+	}
+	c.EndPos = p.expectKw("END_CONFIGURATION").Pos
+	p.accept(SEMICOLON)
+	return c
+}
+
+func (p *parser) parseResource() *Resource {
+	kw := p.next()
+	r := &Resource{KwPos: kw.Pos, Name: p.ident()}
+	if p.acceptKw("ON") {
+		r.On = p.ident()
+	}
+	for !p.tok().Is("END_RESOURCE") && p.tok().Kind != EOF {
+		if isVarBlockKw(p.tok()) {
+			r.VarBlocks = append(r.VarBlocks, p.parseVarBlock())
+			continue
+		}
+		if !p.parseResourceItem(r) {
+			p.errorf(p.tok().Pos, "expected TASK or PROGRAM in resource, found %s", p.tok())
+			p.next()
+			p.skipTo(nil, "TASK", "PROGRAM", "END_RESOURCE")
+		}
+	}
+	p.expectKw("END_RESOURCE")
+	p.accept(SEMICOLON)
+	return r
+}
+
+// parseResourceItem parses a TASK or PROGRAM configuration line.
+func (p *parser) parseResourceItem(r *Resource) bool {
+	t := p.tok()
+	switch {
+	case t.Is("TASK"):
+		p.next()
+		td := &TaskDecl{KwPos: t.Pos, Name: p.ident()}
+		if p.tok().Kind == LPAREN {
+			td.Params, _ = p.parseArgs()
+		}
+		p.expect(SEMICOLON)
+		r.Tasks = append(r.Tasks, td)
+		return true
+	case t.Is("PROGRAM"):
+		p.next()
+		pc := &ProgramConfig{KwPos: t.Pos, Name: p.ident()}
+		if p.acceptKw("WITH") {
+			pc.Task = p.ident()
+		}
+		p.expect(COLON)
+		pc.Type = p.ident()
+		if p.tok().Kind == LPAREN {
+			p.parseArgs()
+		}
+		p.expect(SEMICOLON)
+		r.Programs = append(r.Programs, pc)
+		return true
+	}
+	return false
+}
+
+// ── Statements ────────────────────────────────────────────────────────────────
+
+// parseStmtList parses statements until one of the terminating keywords.
+func (p *parser) parseStmtList(terminators ...string) []Stmt {
+	var list []Stmt
+	for {
+		t := p.tok()
+		if t.Kind == EOF {
+			return list
+		}
+		if t.Kind == KEYWORD {
+			for _, term := range terminators {
+				if t.Is(term) {
+					return list
+				}
+			}
+		}
+		if s := p.parseStmt(terminators); s != nil {
+			list = append(list, s)
+		}
+	}
+}
+
+var stmtKeywords = []string{"IF", "CASE", "FOR", "WHILE", "REPEAT", "EXIT", "CONTINUE", "RETURN"}
+
+func (p *parser) recoverStmt(terminators []string) {
+	kws := append(append([]string{}, stmtKeywords...), terminators...)
+	kws = append(kws, "END_IF", "END_CASE", "END_FOR", "END_WHILE", "END_REPEAT", "ELSE", "ELSIF", "UNTIL")
+	p.skipTo([]Kind{SEMICOLON}, kws...)
+	p.accept(SEMICOLON)
+}
+
+func (p *parser) endStmt(kw string) Pos {
+	pos := p.expectKw(kw).Pos
+	p.accept(SEMICOLON)
+	return pos
+}
+
+func (p *parser) parseStmt(terminators []string) Stmt {
+	t := p.tok()
+	switch {
+	case t.Kind == SEMICOLON:
+		p.next()
+		return &EmptyStmt{SemiPos: t.Pos}
+	case t.Is("IF"):
+		return p.parseIf()
+	case t.Is("CASE"):
+		return p.parseCase()
+	case t.Is("FOR"):
+		p.next()
+		s := &ForStmt{KwPos: t.Pos, Var: p.ident()}
+		p.expect(ASSIGN)
+		s.From = p.parseExpr()
+		p.expectKw("TO")
+		s.To = p.parseExpr()
+		if p.acceptKw("BY") {
+			s.By = p.parseExpr()
+		}
+		p.expectKw("DO")
+		s.Body = p.parseStmtList("END_FOR")
+		s.EndPos = p.endStmt("END_FOR")
+		return s
+	case t.Is("WHILE"):
+		p.next()
+		s := &WhileStmt{KwPos: t.Pos, Cond: p.parseExpr()}
+		p.expectKw("DO")
+		s.Body = p.parseStmtList("END_WHILE")
+		s.EndPos = p.endStmt("END_WHILE")
+		return s
+	case t.Is("REPEAT"):
+		p.next()
+		s := &RepeatStmt{KwPos: t.Pos}
+		s.Body = p.parseStmtList("UNTIL", "END_REPEAT")
+		p.expectKw("UNTIL")
+		s.Cond = p.parseExpr()
+		s.EndPos = p.endStmt("END_REPEAT")
+		return s
+	case t.Is("EXIT"):
+		p.next()
+		p.expect(SEMICOLON)
+		return &ExitStmt{KwPos: t.Pos}
+	case t.Is("CONTINUE"):
+		p.next()
+		p.expect(SEMICOLON)
+		return &ContinueStmt{KwPos: t.Pos}
+	case t.Is("RETURN"):
+		p.next()
+		p.expect(SEMICOLON)
+		return &ReturnStmt{KwPos: t.Pos}
+	case t.Kind == KEYWORD && !t.Is("NOT") && !t.Is("TRUE") && !t.Is("FALSE"):
+		p.errorf(t.Pos, "unexpected %s", t)
+		p.next()
+		p.recoverStmt(terminators)
+		return nil
+	}
+
+	start := len(p.errs)
+	x := p.parseExpr()
+	var s Stmt
+	switch {
+	case p.tok().Kind == ASSIGN:
+		p.next()
+		s = &AssignStmt{Target: x, Value: p.parseExpr()}
+	case isCall(x):
+		s = &CallStmt{Call: x.(*CallExpr)}
+	default:
+		p.errorf(x.Pos(), "expected assignment or call statement")
+	}
+	if len(p.errs) > start {
+		p.recoverStmt(terminators)
+		return s
+	}
+	if p.tok().Kind != SEMICOLON {
+		p.errorf(p.tok().Pos, "expected ';', found %s", p.tok())
+		p.recoverStmt(terminators)
+		return s
+	}
+	p.next()
+	return s
+}
+
+func isCall(x Expr) bool {
+	_, ok := x.(*CallExpr)
+	return ok
+}
+
+func (p *parser) parseIf() *IfStmt {
+	kw := p.next()
+	s := &IfStmt{KwPos: kw.Pos, Cond: p.parseExpr()}
+	p.expectKw("THEN")
+	s.Then = p.parseStmtList("ELSIF", "ELSE", "END_IF")
+	for p.tok().Is("ELSIF") {
+		ekw := p.next()
+		c := &ElsifClause{KwPos: ekw.Pos, Cond: p.parseExpr()}
+		p.expectKw("THEN")
+		c.Body = p.parseStmtList("ELSIF", "ELSE", "END_IF")
+		s.Elsifs = append(s.Elsifs, c)
+	}
+	if p.acceptKw("ELSE") {
+		s.HasElse = true
+		s.Else = p.parseStmtList("END_IF")
+	}
+	s.EndPos = p.endStmt("END_IF")
+	return s
+}
+
+func (p *parser) parseCase() *CaseStmt {
+	kw := p.next()
+	s := &CaseStmt{KwPos: kw.Pos, Selector: p.parseExpr()}
+	p.expectKw("OF")
+	for !p.tok().Is("ELSE") && !p.tok().Is("END_CASE") && p.tok().Kind != EOF {
+		if !p.atCaseLabel() {
+			p.errorf(p.tok().Pos, "expected case label, found %s", p.tok())
+			p.recoverStmt([]string{"ELSE", "END_CASE"})
+			continue
+		}
+		c := &CaseClause{}
+		for {
+			lo := p.parseExpr()
+			if p.accept(RANGE) {
+				c.Labels = append(c.Labels, &RangeExpr{Lo: lo, Hi: p.parseExpr()})
+			} else {
+				c.Labels = append(c.Labels, lo)
+			}
+			if !p.accept(COMMA) {
+				break
+			}
+		}
+		p.expect(COLON)
+		for !p.tok().Is("ELSE") && !p.tok().Is("END_CASE") && p.tok().Kind != EOF && !p.atCaseLabel() {
+			if st := p.parseStmt([]string{"ELSE", "END_CASE"}); st != nil {
+				c.Body = append(c.Body, st)
+			}
+		}
+		s.Cases = append(s.Cases, c)
+	}
+	if p.acceptKw("ELSE") {
+		s.HasElse = true
+		p.accept(COLON)
+		s.Else = p.parseStmtList("END_CASE")
+	}
+	s.EndPos = p.endStmt("END_CASE")
+	return s
+}
+
+// atCaseLabel looks ahead for "label {, label} :" where labels consist of
+// literals, names, ranges and enum qualifiers only.
+func (p *parser) atCaseLabel() bool {
+	for k := 0; ; k++ {
+		t := p.peek(k)
+		switch t.Kind {
+		case COLON:
+			return k > 0
+		case INT, IDENT, MINUS, PLUS, RANGE, COMMA, HASH, DOT, TIME, STRING:
+			continue
+		case KEYWORD:
+			if t.Is("TRUE") || t.Is("FALSE") {
+				continue
+			}
+		}
+		return false
+	}
+}
+
+// ── Expressions ───────────────────────────────────────────────────────────────
+
+var binaryLevels = [][]string{
+	{"OR", "OR_ELSE"},
+	{"XOR"},
+	{"AND", "&", "AND_THEN"},
+	{"=", "<>"},
+	{"<", ">", "<=", ">="},
+	{"+", "-"},
+	{"*", "/", "MOD"},
+	{"**"},
+}
+
+// binaryOp returns the operator spelling of t if it is a binary operator.
+func binaryOp(t Token) string {
+	switch t.Kind {
+	case KEYWORD:
+		switch u := t.Upper(); u {
+		case "OR", "OR_ELSE", "XOR", "AND", "AND_THEN", "MOD":
+			return u
+		}
+	case AMP, EQ, NEQ, LT, GT, LEQ, GEQ, PLUS, MINUS, STAR, SLASH, POWER:
+		return t.Text
+	}
+	return ""
+}
+
+// ParseExpr parses a single expression, for tools that evaluate expressions
+// given on the command line or in configuration.
+func ParseExpr(src string) (Expr, error) {
+	f, _ := Tokenize(src)
+	p := &parser{}
+	for _, t := range f {
+		if t.Kind != COMMENT && t.Kind != PRAGMA {
+			p.toks = append(p.toks, t)
+			p.prags = append(p.prags, nil)
+		}
+	}
+	x := p.parseExpr()
+	if p.tok().Kind != EOF {
+		p.errorf(p.tok().Pos, "unexpected %s after expression", p.tok())
+	}
+	return x, p.errs.Err()
+}
+
+func (p *parser) parseExpr() Expr { return p.parseBinary(0) }
+
+func (p *parser) parseBinary(level int) Expr {
+	if level == len(binaryLevels) {
+		return p.parseUnary()
+	}
+	x := p.parseBinary(level + 1)
+	for {
+		op := binaryOp(p.tok())
+		found := false
+		for _, o := range binaryLevels[level] {
+			if o == op {
+				found = true
+			}
+		}
+		if !found {
+			return x
+		}
+		t := p.next()
+		if op == "&" {
+			op = "AND"
+		}
+		x = &BinaryExpr{Op: op, X: x, Y: p.parseBinary(level + 1), OpPos: t.Pos}
+	}
+}
+
+func (p *parser) parseUnary() Expr {
+	t := p.tok()
+	switch {
+	case t.Kind == MINUS, t.Kind == PLUS:
+		p.next()
+		return &UnaryExpr{Op: t.Text, X: p.parseUnary(), OpPos: t.Pos}
+	case t.Is("NOT"):
+		p.next()
+		return &UnaryExpr{Op: "NOT", X: p.parseUnary(), OpPos: t.Pos}
+	}
+	return p.parsePostfix()
+}
+
+func (p *parser) parsePostfix() Expr {
+	x := p.parsePrimary()
+	for {
+		switch t := p.tok(); t.Kind {
+		case DOT:
+			p.next()
+			n := p.tok()
+			if n.Kind == IDENT || n.Kind == INT {
+				p.next()
+				x = &MemberExpr{X: x, Name: &Ident{Name: n.Text, NamePos: n.Pos}}
+			} else {
+				p.errorf(n.Pos, "expected member name, found %s", n)
+				return x
+			}
+		case LBRACK:
+			p.next()
+			ix := &IndexExpr{X: x}
+			for {
+				ix.Indices = append(ix.Indices, p.parseExpr())
+				if !p.accept(COMMA) {
+					break
+				}
+			}
+			p.expect(RBRACK)
+			x = ix
+		case CARET:
+			p.next()
+			x = &DerefExpr{X: x}
+		case LPAREN:
+			switch x.(type) {
+			case *Ident, *MemberExpr, *DerefExpr, *IndexExpr:
+			default:
+				return x
+			}
+			args, rp := p.parseArgs()
+			x = &CallExpr{Func: x, Args: args, RParen: rp}
+		default:
+			return x
+		}
+	}
+}
+
+// parseArgs parses ( [arg {, arg}] ) and returns the arguments and the
+// position of the closing parenthesis.
+func (p *parser) parseArgs() ([]*Arg, Pos) {
+	p.expect(LPAREN)
+	var args []*Arg
+	for p.tok().Kind != RPAREN && p.tok().Kind != EOF {
+		a := &Arg{}
+		switch {
+		case p.tok().Is("NOT") && p.peek(1).Kind == IDENT && p.peek(2).Kind == OUTPUT:
+			p.next()
+			a.Not = true
+			fallthrough
+		case p.tok().Kind == IDENT && p.peek(1).Kind == OUTPUT:
+			a.Name = p.ident()
+			a.Output = true
+			p.next()
+			if p.tok().Kind != COMMA && p.tok().Kind != RPAREN {
+				a.Value = p.parseExpr()
+			}
+		case p.tok().Kind == IDENT && p.peek(1).Kind == ASSIGN:
+			a.Name = p.ident()
+			p.next()
+			a.Value = p.parseExpr()
+		default:
+			a.Value = p.parseExpr()
+		}
+		args = append(args, a)
+		if !p.accept(COMMA) {
+			break
+		}
+	}
+	rp := p.expect(RPAREN)
+	return args, rp.Pos
+}
+
+func (p *parser) parsePrimary() Expr {
+	t := p.tok()
+	switch t.Kind {
+	case INT, REAL, STRING, WSTRING, TIME:
+		p.next()
+		return &Literal{Kind: t.Kind, Text: t.Text, LitPos: t.Pos}
+	case ADDRESS:
+		p.next()
+		return &AddressExpr{Text: t.Text, AddrPos: t.Pos}
+	case IDENT:
+		p.next()
+		id := &Ident{Name: t.Text, NamePos: t.Pos}
+		if p.tok().Kind == HASH && p.peek(1).Kind == IDENT {
+			p.next()
+			v := p.next()
+			return &EnumLiteral{Type: id, Value: &Ident{Name: v.Text, NamePos: v.Pos}}
+		}
+		return id
+	case LPAREN:
+		p.next()
+		x := &ParenExpr{LParen: t.Pos, X: p.parseExpr()}
+		p.expect(RPAREN)
+		return x
+	case KEYWORD:
+		if t.Is("TRUE") || t.Is("FALSE") {
+			p.next()
+			return &Literal{Kind: KEYWORD, Text: t.Text, LitPos: t.Pos}
+		}
+	}
+	p.errorf(t.Pos, "expected expression, found %s", t)
+	if t.Kind != EOF && t.Kind != SEMICOLON && t.Kind != KEYWORD {
+		p.next()
+	}
+	return &Ident{Name: "_", NamePos: t.Pos}
+}
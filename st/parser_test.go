@@ -0,0 +1,109 @@
+package st
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string // errors in the form line:col: message
+	}{
+		{
+			"missing expression",
+			"PROGRAM Main\nVAR\n    x : INT;\nEND_VAR\nx := ;\nEND_PROGRAM\n",
+			[]string{"5:6: expected expression, found ';'"},
+		},
+		{
+			"unterminated IF",
+			"PROGRAM Main\nIF TRUE THEN\n    x := 1;\nEND_PROGRAM\n",
+			[]string{`4:1: unexpected keyword "END_PROGRAM"`, "5:1: expected END_IF, found end of file"},
+		},
+		{
+			"declaration without colon",
+			"PROGRAM Main\nVAR\n    x INT;\nEND_VAR\nEND_PROGRAM\n",
+			[]string{`3:7: expected ':', found identifier "INT"`},
+		},
+		{
+			"unknown declaration",
+			"FOO Bar\n",
+			[]string{`1:1: expected PROGRAM, FUNCTION_BLOCK, FUNCTION, TYPE, CONFIGURATION or VAR_GLOBAL, found identifier "FOO"`},
+		},
+		{
+			"expression statement",
+			"PROGRAM Main\nx + 1;\nEND_PROGRAM\n",
+			[]string{"2:1: expected assignment or call statement"},
+		},
+		{
+			"unterminated string",
+			"PROGRAM Main\nx := 'abc;\nEND_PROGRAM\n",
+			[]string{"2:6: string literal not terminated", `3:1: expected ';', found keyword "END_PROGRAM"`},
+		},
+		{
+			"property without END_GET",
+			"FUNCTION_BLOCK FB\nPROPERTY P : INT\nGET\nP := 1;\nEND_PROPERTY\nEND_FUNCTION_BLOCK\n",
+			[]string{`5:1: expected END_GET, found keyword "END_PROPERTY"`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse("test.st", tt.src)
+			var list ErrorList
+			if !errors.As(err, &list) {
+				t.Fatalf("got %v, want an ErrorList", err)
+			}
+			if len(list) != len(tt.want) {
+				t.Fatalf("got %d errors, want %d:\n%v", len(list), len(tt.want), err)
+			}
+			for i, e := range list {
+				if e.Error() != tt.want[i] {
+					t.Errorf("got %q, want %q", e.Error(), tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseProperty(t *testing.T) {
+	src := `FUNCTION_BLOCK FB_Counter
+VAR
+    nCount : INT;
+END_VAR
+PROPERTY Count : INT
+GET
+    Count := nCount;
+END_GET
+SET
+VAR
+    nOld : INT;
+END_VAR
+    nOld := nCount;
+    nCount := Count;
+END_SET
+END_PROPERTY
+METHOD Reset
+nCount := 0;
+END_METHOD
+END_FUNCTION_BLOCK
+`
+	f, err := Parse("test.st", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fb := f.Decls[0].(*POU)
+	if len(fb.Properties) != 1 || len(fb.Methods) != 1 {
+		t.Fatalf("got %d properties and %d methods, want 1 and 1", len(fb.Properties), len(fb.Methods))
+	}
+	p := fb.Properties[0]
+	if p.Name.Name != "Count" || p.Get == nil || p.Set == nil {
+		t.Fatalf("got property %s, GET %v, SET %v", p.Name.Name, p.Get != nil, p.Set != nil)
+	}
+	if p.Get.ReturnType == nil || len(p.Get.Body) != 1 {
+		t.Errorf("GET: return type %v, %d statements", p.Get.ReturnType, len(p.Get.Body))
+	}
+	if len(p.Set.VarBlocks) != 1 || len(p.Set.Body) != 2 {
+		t.Errorf("SET: %d VAR blocks, %d statements", len(p.Set.VarBlocks), len(p.Set.Body))
+	}
+}
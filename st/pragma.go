@@ -0,0 +1,48 @@
+package st
+
+import (
+	"strings"
+)
+
+// ── Pragmas ───────────────────────────────────────────────────────────────────
+
+// parseAttribute splits {attribute 'name'} and {attribute 'name' := 'value'}.
+func parseAttribute(text string) (name, value string, ok bool) {
+	s := strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(text, "{"), "}"))
+	if len(s) < len("attribute") || !strings.EqualFold(s[:len("attribute")], "attribute") {
+		return "", "", false
+	}
+	s = strings.TrimSpace(s[len("attribute"):])
+	name, rest, ok := quoted(s)
+	if !ok {
+		return "", "", false
+	}
+	rest = strings.TrimSpace(rest)
+	if strings.HasPrefix(rest, ":=") {
+		value, _, _ = quoted(strings.TrimSpace(rest[2:]))
+	}
+	return name, value, true
+}
+
+// quoted returns the content of a leading 'quoted' string and the remainder.
+func quoted(s string) (content, rest string, ok bool) {
+	if !strings.HasPrefix(s, "'") {
+		return "", s, false
+	}
+	end := strings.IndexByte(s[1:], '\'')
+	if end < 0 {
+		return "", s, false
+	}
+	return s[1 : end+1], s[end+2:], true
+}
+
+// findAttribute looks up {attribute 'name' …} in a pragma list. Names are
+// compared case-insensitively, as CoDeSys does.
+func findAttribute(pragmas []*Pragma, name string) (string, bool) {
+	for _, p := range pragmas {
+		if n, v, ok := p.Attribute(); ok && strings.EqualFold(n, name) {
+			return v, true
+		}
+	}
+	return "", false
+}
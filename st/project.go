@@ -0,0 +1,270 @@
+package st
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ── Project ───────────────────────────────────────────────────────────────────
+
+// Project is a set of parsed .st files with a project-wide symbol table:
+// POUs, data types and global variables. The standard function blocks (TON,
+// CTU, R_TRIG, …) are always available in addition to the project's own.
+//
+// Names are case-insensitive, as in ST; all maps are keyed by upper case.
+type Project struct {
+	Files        []*File
+	SyntaxErrors map[*File]ErrorList
+
+	// Roots are the source directories the files were loaded from. Paths
+	// below a root decide which files hold unit tests (see IsTestFile).
+	Roots []string
+
+	pous     map[string]*POU
+	types    map[string]*TypeDecl
+	globals  map[string]*Symbol
+	gvls     map[string][]*Symbol // GVL name → its variables
+	dups     []*Symbol            // second and later definitions of a name
+	fileOf   map[Node]*File       // top-level declarations, methods and declaring identifiers
+	owner    map[*POU]*POU        // method → function block
+	resolved map[any]*Type        // *TypeDecl and *POU → resolved type
+	global   *Scope
+}
+
+// LoadProject parses every .st file named by paths; directories are searched
+// recursively, skipping hidden directories. Syntax errors do not stop
+// loading: they are collected in SyntaxErrors and the recovered declarations
+// are still indexed. The directories become the project's Roots. Only I/O
+// errors are returned.
+func LoadProject(paths ...string) (*Project, error) {
+	var files []*File
+	var roots []string
+	errs := map[*File]ErrorList{}
+	for _, name := range paths {
+		info, err := os.Stat(name)
+		if err != nil {
+			return nil, err
+		}
+		var names []string
+		if info.IsDir() {
+			roots = append(roots, name)
+			err = filepath.WalkDir(name, func(path string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if d.IsDir() && path != name && strings.HasPrefix(d.Name(), ".") {
+					return filepath.SkipDir
+				}
+				if !d.IsDir() && strings.EqualFold(filepath.Ext(path), ".st") {
+					names = append(names, path)
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			names = []string{name}
+		}
+		sort.Strings(names)
+		for _, n := range names {
+			src, err := os.ReadFile(n)
+			if err != nil {
+				return nil, err
+			}
+			f, err := Parse(n, string(src))
+			if list, ok := err.(ErrorList); ok {
+				errs[f] = list
+			}
+			files = append(files, f)
+		}
+	}
+	p := NewProject(files)
+	p.SyntaxErrors = errs
+	p.Roots = roots
+	return p, nil
+}
+
+// NewProject indexes already parsed files.
+func NewProject(files []*File) *Project {
+	p := &Project{
+		Files:        files,
+		SyntaxErrors: map[*File]ErrorList{},
+		pous:         map[string]*POU{},
+		types:        map[string]*TypeDecl{},
+		globals:      map[string]*Symbol{},
+		gvls:         map[string][]*Symbol{},
+		fileOf:       map[Node]*File{},
+		owner:        map[*POU]*POU{},
+		resolved:     map[any]*Type{},
+	}
+	for _, f := range files {
+		p.index(f)
+	}
+	p.global = &Scope{Project: p}
+	return p
+}
+
+func (p *Project) index(f *File) {
+	for _, d := range f.Decls {
+		p.fileOf[d] = f
+		switch d := d.(type) {
+		case *POU:
+			p.fileOf[d.Name] = f
+			define(p, p.pous, d.Name, d, &Symbol{Kind: POUSymbol, Name: d.Name.Name, Ident: d.Name, POU: d, File: f})
+			for _, m := range d.Methods {
+				p.fileOf[m] = f
+				p.fileOf[m.Name] = f
+				p.owner[m] = d
+				p.indexVars(f, m.VarBlocks)
+			}
+			p.indexVars(f, d.VarBlocks)
+		case *TypeBlock:
+			for _, td := range d.Types {
+				p.fileOf[td] = f
+				p.fileOf[td.Name] = f
+				define(p, p.types, td.Name, td, &Symbol{Kind: TypeSymbol, Name: td.Name.Name, Ident: td.Name, TypeDecl: td, File: f})
+				p.indexTypeIdents(f, td.Type)
+			}
+		case *Configuration:
+			p.indexGlobals(f, d.Name.Name, d.VarBlocks)
+			for _, r := range d.Resources {
+				p.indexGlobals(f, d.Name.Name, r.VarBlocks)
+			}
+		case *VarBlock:
+			stem := strings.TrimSuffix(filepath.Base(f.Name), filepath.Ext(f.Name))
+			p.indexGlobals(f, stem, []*VarBlock{d})
+		}
+	}
+}
+
+// define adds a POU or type, recording redefinitions.
+func define[T any](p *Project, m map[string]T, id *Ident, v T, sym *Symbol) {
+	key := strings.ToUpper(id.Name)
+	if _, dup := m[key]; dup {
+		p.dups = append(p.dups, sym)
+		return
+	}
+	m[key] = v
+}
+
+func (p *Project) indexVars(f *File, blocks []*VarBlock) {
+	for _, b := range blocks {
+		for _, v := range b.Vars {
+			for _, id := range v.Names {
+				p.fileOf[id] = f
+			}
+			p.indexTypeIdents(f, v.Type)
+		}
+	}
+}
+
+func (p *Project) indexTypeIdents(f *File, ts TypeSpec) {
+	switch t := ts.(type) {
+	case *StructType:
+		for _, v := range t.Fields {
+			for _, id := range v.Names {
+				p.fileOf[id] = f
+			}
+		}
+	case *EnumType:
+		for _, v := range t.Values {
+			p.fileOf[v.Name] = f
+		}
+	}
+}
+
+func (p *Project) indexGlobals(f *File, gvl string, blocks []*VarBlock) {
+	p.indexVars(f, blocks)
+	for _, b := range blocks {
+		for _, v := range b.Vars {
+			for _, id := range v.Names {
+				sym := &Symbol{Kind: GlobalSymbol, Name: id.Name, Ident: id, Decl: v, Block: b, File: f, GVL: gvl}
+				key := strings.ToUpper(id.Name)
+				if _, dup := p.globals[key]; dup {
+					p.dups = append(p.dups, sym)
+				} else {
+					p.globals[key] = sym
+				}
+				p.gvls[strings.ToUpper(gvl)] = append(p.gvls[strings.ToUpper(gvl)], sym)
+			}
+		}
+	}
+}
+
+// POU returns the POU called name, including the standard function blocks.
+func (p *Project) POU(name string) *POU {
+	if d := p.pous[strings.ToUpper(name)]; d != nil {
+		return d
+	}
+	return stdPOUs[strings.ToUpper(name)]
+}
+
+// POUs returns the project's own POUs sorted by name.
+func (p *Project) POUs() []*POU {
+	out := make([]*POU, 0, len(p.pous))
+	for _, d := range p.pous {
+		out = append(out, d)
+	}
+	sort.Slice(out, func(i, j int) bool { return strings.ToUpper(out[i].Name.Name) < strings.ToUpper(out[j].Name.Name) })
+	return out
+}
+
+// TypeDecl returns the data type declaration called name, or nil.
+func (p *Project) TypeDecl(name string) *TypeDecl { return p.types[strings.ToUpper(name)] }
+
+// TypeDecls returns the project's data types sorted by name.
+func (p *Project) TypeDecls() []*TypeDecl {
+	out := make([]*TypeDecl, 0, len(p.types))
+	for _, d := range p.types {
+		out = append(out, d)
+	}
+	sort.Slice(out, func(i, j int) bool { return strings.ToUpper(out[i].Name.Name) < strings.ToUpper(out[j].Name.Name) })
+	return out
+}
+
+// Global returns the global variable called name, or nil.
+func (p *Project) Global(name string) *Symbol { return p.globals[strings.ToUpper(name)] }
+
+// Globals returns all global variables sorted by GVL and declaration order.
+func (p *Project) Globals() []*Symbol {
+	names := make([]string, 0, len(p.gvls))
+	for n := range p.gvls {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	var out []*Symbol
+	for _, n := range names {
+		out = append(out, p.gvls[n]...)
+	}
+	return out
+}
+
+// Duplicates returns the symbols that redefine an existing POU, type or
+// global variable name.
+func (p *Project) Duplicates() []*Symbol { return p.dups }
+
+// FileOf returns the file that declares n: a top-level declaration, a
+// method, or a declaring identifier (variable, field, enum value, POU or
+// type name). It returns nil for other nodes.
+func (p *Project) FileOf(n Node) *File { return p.fileOf[n] }
+
+// Owner returns the function block a method belongs to, or nil.
+func (p *Project) Owner(m *POU) *POU { return p.owner[m] }
+
+// IsStandard reports whether d is one of the built-in standard function blocks.
+func IsStandard(d *POU) bool { return d != nil && stdPOUs[strings.ToUpper(d.Name.Name)] == d }
+
+// GlobalScope returns the scope of declarations outside POUs: global
+// variables, POUs, types and enumeration values.
+func (p *Project) GlobalScope() *Scope { return p.global }
+
+// Scope returns the scope inside d, a POU or method.
+func (p *Project) Scope(d *POU) *Scope {
+	s := &Scope{Project: p, POU: d, Owner: p.owner[d], File: p.fileOf[d]}
+	s.collect()
+	return s
+}
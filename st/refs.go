@@ -0,0 +1,330 @@
+package st
+
+import "strings"
+
+// ── References ────────────────────────────────────────────────────────────────
+
+// Ref is one use of a declared name in a POU body, a declaration's initial
+// value or a type expression.
+type Ref struct {
+	Ident  *Ident  // the identifier at the use site
+	Symbol *Symbol // what it resolves to; nil for unknown names
+	File   *File
+	POU    *POU // enclosing POU or method; nil outside POUs
+	Write  bool // assignment target, FOR variable or output argument
+	Call   bool // called as a function, method or FB instance
+}
+
+// References resolves every identifier use in the project. Declaring
+// identifiers are not included; use Symbol.Ident to find them. Argument
+// names of calls (IN := …) resolve to the parameters of the callee.
+func (p *Project) References() []*Ref {
+	var refs []*Ref
+	for _, f := range p.Files {
+		refs = append(refs, p.FileReferences(f)...)
+	}
+	return refs
+}
+
+// FileReferences resolves the identifier uses of one file.
+func (p *Project) FileReferences(f *File) []*Ref {
+	c := &refCollector{p: p, file: f}
+	for _, d := range f.Decls {
+		switch d := d.(type) {
+		case *POU:
+			c.pou(d)
+			for _, m := range d.Methods {
+				c.pou(m)
+			}
+		case *TypeBlock:
+			c.scope = p.global
+			for _, td := range d.Types {
+				if td.Extends != nil {
+					c.add(td.Extends, p.global.Lookup(td.Extends.Name), false, false)
+				}
+				c.typeSpec(td.Type)
+				if td.Init != nil {
+					c.expr(td.Init)
+				}
+			}
+		case *Configuration:
+			c.scope = p.global
+			c.varBlocks(d.VarBlocks)
+			for _, r := range d.Resources {
+				c.varBlocks(r.VarBlocks)
+				for _, pc := range r.Programs {
+					c.add(pc.Type, p.global.Lookup(pc.Type.Name), false, false)
+					if pc.Task != nil {
+						c.add(pc.Task, nil, false, false)
+					}
+				}
+				for _, t := range r.Tasks {
+					for _, a := range t.Params {
+						if a.Value != nil {
+							c.expr(a.Value)
+						}
+					}
+				}
+			}
+		case *VarBlock:
+			c.scope = p.global
+			c.varBlocks([]*VarBlock{d})
+		}
+	}
+	return c.refs
+}
+
+type refCollector struct {
+	p     *Project
+	file  *File
+	cur   *POU
+	scope *Scope
+	refs  []*Ref
+}
+
+func (c *refCollector) add(id *Ident, sym *Symbol, write, call bool) {
+	c.refs = append(c.refs, &Ref{Ident: id, Symbol: sym, File: c.file, POU: c.cur, Write: write, Call: call})
+}
+
+func (c *refCollector) pou(d *POU) {
+	c.cur, c.scope = d, c.p.Scope(d)
+	if d.Extends != nil {
+		c.add(d.Extends, c.p.global.Lookup(d.Extends.Name), false, false)
+	}
+	if d.ReturnType != nil {
+		c.typeSpec(d.ReturnType)
+	}
+	c.varBlocks(d.VarBlocks)
+	c.stmts(d.Body)
+	c.cur = nil
+}
+
+func (c *refCollector) varBlocks(blocks []*VarBlock) {
+	for _, b := range blocks {
+		for _, v := range b.Vars {
+			c.typeSpec(v.Type)
+			if v.Init != nil {
+				c.expr(v.Init)
+			}
+		}
+	}
+}
+
+func (c *refCollector) typeSpec(ts TypeSpec) {
+	switch t := ts.(type) {
+	case *NamedType:
+		if Elementary(t.Name.Name) == nil {
+			c.add(t.Name, c.p.global.Lookup(t.Name.Name), false, false)
+		}
+	case *StringType:
+		if t.Len != nil {
+			c.expr(t.Len)
+		}
+	case *ArrayType:
+		for _, d := range t.Dims {
+			c.expr(d.Lo)
+			c.expr(d.Hi)
+		}
+		c.typeSpec(t.Elem)
+	case *PointerType:
+		c.typeSpec(t.Elem)
+	case *StructType:
+		for _, v := range t.Fields {
+			c.typeSpec(v.Type)
+			if v.Init != nil {
+				c.expr(v.Init)
+			}
+		}
+	case *EnumType:
+		for _, v := range t.Values {
+			if v.Value != nil {
+				c.expr(v.Value)
+			}
+		}
+		if t.Base != nil {
+			c.typeSpec(t.Base)
+		}
+	case *SubrangeType:
+		c.typeSpec(t.Base)
+		c.expr(t.Range.Lo)
+		c.expr(t.Range.Hi)
+	}
+}
+
+func (c *refCollector) stmts(list []Stmt) {
+	for _, s := range list {
+		c.stmt(s)
+	}
+}
+
+func (c *refCollector) stmt(s Stmt) {
+	switch s := s.(type) {
+	case *AssignStmt:
+		c.target(s.Target)
+		c.expr(s.Value)
+	case *CallStmt:
+		c.expr(s.Call)
+	case *IfStmt:
+		c.expr(s.Cond)
+		c.stmts(s.Then)
+		for _, e := range s.Elsifs {
+			c.expr(e.Cond)
+			c.stmts(e.Body)
+		}
+		c.stmts(s.Else)
+	case *CaseStmt:
+		c.expr(s.Selector)
+		for _, cl := range s.Cases {
+			for _, l := range cl.Labels {
+				c.expr(l)
+			}
+			c.stmts(cl.Body)
+		}
+		c.stmts(s.Else)
+	case *ForStmt:
+		c.target(s.Var)
+		c.expr(s.From)
+		c.expr(s.To)
+		if s.By != nil {
+			c.expr(s.By)
+		}
+		c.stmts(s.Body)
+	case *WhileStmt:
+		c.expr(s.Cond)
+		c.stmts(s.Body)
+	case *RepeatStmt:
+		c.stmts(s.Body)
+		c.expr(s.Cond)
+	}
+}
+
+// target records a written expression: the root variable is a write, any
+// index expressions inside it are reads.
+func (c *refCollector) target(e Expr) {
+	switch e := e.(type) {
+	case *Ident:
+		c.add(e, c.scope.Lookup(e.Name), true, false)
+	case *MemberExpr:
+		c.member(e, true)
+	case *IndexExpr:
+		c.target(e.X)
+		for _, i := range e.Indices {
+			c.expr(i)
+		}
+	case *DerefExpr:
+		c.expr(e.X) // writing through a pointer reads the pointer
+	default:
+		c.expr(e)
+	}
+}
+
+// member records X.Name. The root of X is written when the member is.
+func (c *refCollector) member(e *MemberExpr, write bool) {
+	if write {
+		c.target(e.X)
+	} else {
+		c.expr(e.X)
+	}
+	if !isBitNumber(e.Name.Name) {
+		c.add(e.Name, c.scope.Resolve(e), write, false)
+	}
+}
+
+func (c *refCollector) expr(e Expr) {
+	switch e := e.(type) {
+	case nil:
+	case *Ident:
+		c.add(e, c.scope.Lookup(e.Name), false, false)
+	case *EnumLiteral:
+		c.add(e.Type, c.scope.Lookup(e.Type.Name), false, false)
+		c.add(e.Value, c.scope.Resolve(e), false, false)
+	case *MemberExpr:
+		c.member(e, false)
+	case *BinaryExpr:
+		c.expr(e.X)
+		c.expr(e.Y)
+	case *UnaryExpr:
+		c.expr(e.X)
+	case *ParenExpr:
+		c.expr(e.X)
+	case *IndexExpr:
+		c.expr(e.X)
+		for _, i := range e.Indices {
+			c.expr(i)
+		}
+	case *DerefExpr:
+		c.expr(e.X)
+	case *CallExpr:
+		c.call(e)
+	case *RangeExpr:
+		c.expr(e.Lo)
+		c.expr(e.Hi)
+	case *ArrayInit:
+		for _, el := range e.Elems {
+			c.expr(el.Count)
+			c.expr(el.Value)
+		}
+	case *StructInit:
+		for _, fi := range e.Fields {
+			c.expr(fi.Value)
+		}
+	}
+}
+
+func (c *refCollector) call(e *CallExpr) {
+	switch fn := e.Func.(type) {
+	case *Ident:
+		c.add(fn, c.scope.Lookup(fn.Name), false, true)
+	case *MemberExpr:
+		c.expr(fn.X)
+		c.add(fn.Name, c.scope.Resolve(fn), false, true)
+	default:
+		c.expr(fn)
+	}
+	callee := c.scope.Callee(e)
+	var cs *Scope
+	if callee != nil && !IsStandard(callee) {
+		cs = c.p.Scope(callee)
+	}
+	for _, a := range e.Args {
+		if a.Name != nil {
+			var sym *Symbol
+			if cs != nil {
+				if sym = cs.byName[strings.ToUpper(a.Name.Name)]; sym != nil && sym.Type == nil {
+					sym.Type = cs.symbolType(sym)
+				}
+			} else if callee != nil {
+				if f := c.p.instanceType(callee).Field(a.Name.Name); f != nil {
+					sym = &Symbol{Kind: FieldSymbol, Name: f.Name, Ident: f.Ident, Type: f.Type, Decl: f.Decl}
+				}
+			}
+			c.add(a.Name, sym, false, false)
+		}
+		if a.Output {
+			if a.Value != nil {
+				c.target(a.Value)
+			}
+		} else {
+			c.expr(a.Value)
+		}
+	}
+}
+
+// Callee returns the POU a call invokes: a function, the FB type of an
+// instance, or a method. It returns nil for standard functions and unknown
+// names.
+func (s *Scope) Callee(e *CallExpr) *POU {
+	sym := s.Resolve(e.Func)
+	if sym == nil {
+		return nil
+	}
+	switch sym.Kind {
+	case POUSymbol:
+		return sym.POU
+	case VarSymbol, GlobalSymbol, FieldSymbol:
+		if t := s.valueType(sym); t.Class == InstanceClass {
+			return t.POU
+		}
+	}
+	return nil
+}
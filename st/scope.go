@@ -0,0 +1,683 @@
+package st
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ── Symbols ───────────────────────────────────────────────────────────────────
+
+// SymbolKind classifies what a name refers to.
+type SymbolKind int
+
+const (
+	VarSymbol       SymbolKind = iota // local variable, parameter or function result
+	GlobalSymbol                      // variable of a GVL
+	FieldSymbol                       // struct member or variable of an FB instance
+	POUSymbol                         // PROGRAM, FUNCTION_BLOCK, FUNCTION or METHOD
+	TypeSymbol                        // data type
+	EnumValueSymbol                   // enumeration value
+	GVLSymbol                         // GVL name used as a namespace
+)
+
+func (k SymbolKind) String() string {
+	return [...]string{"variable", "global variable", "field", "POU", "type", "enumeration value", "GVL"}[k]
+}
+
+// Symbol is a declared name.
+type Symbol struct {
+	Kind     SymbolKind
+	Name     string
+	Ident    *Ident    // declaring identifier, nil for standard POUs' result etc.
+	Type     *Type     // variables, fields and enumeration values
+	Decl     *VarDecl  // variables and fields
+	Block    *VarBlock // variables: the declaring VAR block
+	POU      *POU      // POUSymbol: the POU; VarSymbol: the declaring POU
+	TypeDecl *TypeDecl // TypeSymbol
+	Member   *EnumMember
+	File     *File
+	GVL      string // GlobalSymbol and GVLSymbol: name of the GVL
+}
+
+// BlockKind returns the VAR block keyword of a variable (VAR_INPUT, …), or
+// "" for function results and non-variables.
+func (s *Symbol) BlockKind() string {
+	if s.Block == nil {
+		return ""
+	}
+	return s.Block.Kind
+}
+
+// IsConstant reports whether s is declared in a CONSTANT block.
+func (s *Symbol) IsConstant() bool { return s.Block != nil && s.Block.Constant }
+
+// ── Scopes ────────────────────────────────────────────────────────────────────
+
+// Scope resolves names inside a POU: its own variables, for methods the
+// variables of the owning function block and its bases, then globals, POUs,
+// types, GVL names and enumeration values. The global scope has no POU.
+type Scope struct {
+	Project *Project
+	POU     *POU
+	Owner   *POU // function block of a method
+	File    *File
+
+	locals []*Symbol
+	byName map[string]*Symbol
+	depth  int // guards constant evaluation against cycles
+}
+
+func (s *Scope) collect() {
+	s.byName = map[string]*Symbol{}
+	add := func(d *POU, inherited bool) {
+		for _, b := range d.VarBlocks {
+			for _, v := range b.Vars {
+				for _, id := range v.Names {
+					key := strings.ToUpper(id.Name)
+					if _, seen := s.byName[key]; seen && inherited {
+						continue
+					}
+					sym := &Symbol{Kind: VarSymbol, Name: id.Name, Ident: id, Decl: v, Block: b, POU: d, File: s.Project.fileOf[id]}
+					s.locals = append(s.locals, sym)
+					if _, seen := s.byName[key]; !seen {
+						s.byName[key] = sym
+					}
+				}
+			}
+		}
+	}
+	d := s.POU
+	add(d, false)
+	if d.ReturnType != nil {
+		key := strings.ToUpper(d.Name.Name)
+		if _, seen := s.byName[key]; !seen {
+			sym := &Symbol{Kind: VarSymbol, Name: d.Name.Name, Ident: d.Name, POU: d, File: s.File}
+			s.byName[key] = sym
+		}
+	}
+	fb := d
+	if s.Owner != nil {
+		fb = s.Owner
+	}
+	if fb != d {
+		add(fb, true)
+	}
+	seen := map[*POU]bool{fb: true}
+	for base := s.baseOf(fb); base != nil && !seen[base]; base = s.baseOf(base) {
+		seen[base] = true
+		add(base, true)
+	}
+}
+
+func (s *Scope) baseOf(d *POU) *POU {
+	if d.Extends == nil {
+		return nil
+	}
+	return s.Project.POU(d.Extends.Name)
+}
+
+// Locals returns the variables declared in the POU (and for methods in the
+// owning function block and its bases), in declaration order.
+func (s *Scope) Locals() []*Symbol { return s.locals }
+
+// Lookup resolves a plain name.
+func (s *Scope) Lookup(name string) *Symbol {
+	key := strings.ToUpper(name)
+	if sym := s.byName[key]; sym != nil {
+		if sym.Type == nil {
+			sym.Type = s.symbolType(sym)
+		}
+		return sym
+	}
+	p := s.Project
+	fb := s.POU
+	if s.Owner != nil {
+		fb = s.Owner
+	}
+	if fb != nil && fb.Kind == FunctionBlock {
+		if m := p.instanceType(fb).Method(name); m != nil {
+			return &Symbol{Kind: POUSymbol, Name: m.Name.Name, Ident: m.Name, POU: m, File: p.fileOf[m]}
+		}
+	}
+	if key == "THIS" || key == "SUPER" {
+		if fb != nil && fb.Kind == FunctionBlock {
+			t := p.instanceType(fb)
+			if key == "SUPER" {
+				t = t.Base
+			}
+			if t != nil {
+				return &Symbol{Kind: VarSymbol, Name: name, POU: fb, Type: &Type{Class: PointerClass, Name: "POINTER TO " + t.Name, Elem: t}}
+			}
+		}
+	}
+	if sym := p.globals[key]; sym != nil {
+		if sym.Type == nil {
+			sym.Type = p.global.symbolType(sym)
+		}
+		return sym
+	}
+	if d := p.POU(name); d != nil {
+		return &Symbol{Kind: POUSymbol, Name: d.Name.Name, Ident: d.Name, POU: d, File: p.fileOf[d]}
+	}
+	if d := testPOUs[key]; d != nil && s.File != nil && p.IsTestFile(s.File) {
+		return &Symbol{Kind: POUSymbol, Name: d.Name.Name, Ident: d.Name, POU: d}
+	}
+	if td := p.types[key]; td != nil {
+		return &Symbol{Kind: TypeSymbol, Name: td.Name.Name, Ident: td.Name, TypeDecl: td, Type: p.typeDeclType(td), File: p.fileOf[td]}
+	}
+	if vars, ok := p.gvls[key]; ok {
+		return &Symbol{Kind: GVLSymbol, Name: name, GVL: name, File: vars[0].File}
+	}
+	// unqualified enumeration values
+	for _, td := range p.TypeDecls() {
+		if _, ok := td.Type.(*EnumType); !ok {
+			continue
+		}
+		t := p.typeDeclType(td)
+		if m := t.Member(name); m != nil {
+			return &Symbol{Kind: EnumValueSymbol, Name: m.Name, Ident: m.Ident, Type: t, Member: m, File: p.fileOf[td]}
+		}
+	}
+	return nil
+}
+
+// symbolType resolves the declared type of a variable symbol.
+func (s *Scope) symbolType(sym *Symbol) *Type {
+	switch {
+	case sym.Decl != nil:
+		return s.ResolveType(sym.Decl.Type)
+	case sym.Kind == VarSymbol && sym.POU != nil && sym.POU.ReturnType != nil:
+		return s.ResolveType(sym.POU.ReturnType)
+	}
+	return TypeBad
+}
+
+// Resolve returns the symbol an expression names: identifiers, member
+// accesses (fields, methods, qualified enumeration values and GVL-qualified
+// globals) and E#v enumeration literals. It returns nil for other
+// expressions and for unknown names.
+func (s *Scope) Resolve(e Expr) *Symbol {
+	switch e := e.(type) {
+	case *Ident:
+		return s.Lookup(e.Name)
+	case *EnumLiteral:
+		if td := s.Project.TypeDecl(e.Type.Name); td != nil {
+			t := s.Project.typeDeclType(td)
+			if m := t.Member(e.Value.Name); m != nil {
+				return &Symbol{Kind: EnumValueSymbol, Name: m.Name, Ident: m.Ident, Type: t, Member: m, File: s.Project.fileOf[td]}
+			}
+		}
+	case *MemberExpr:
+		if x, ok := e.X.(*Ident); ok {
+			if base := s.Lookup(x.Name); base != nil {
+				switch base.Kind {
+				case TypeSymbol:
+					if m := base.Type.Member(e.Name.Name); m != nil {
+						return &Symbol{Kind: EnumValueSymbol, Name: m.Name, Ident: m.Ident, Type: base.Type, Member: m, File: base.File}
+					}
+					return nil
+				case GVLSymbol:
+					for _, g := range s.Project.gvls[strings.ToUpper(x.Name)] {
+						if strings.EqualFold(g.Name, e.Name.Name) {
+							if g.Type == nil {
+								g.Type = s.Project.global.symbolType(g)
+							}
+							return g
+						}
+					}
+					return nil
+				}
+			}
+		}
+		xt := s.TypeOf(e.X)
+		if xt.Class == PointerClass && xt.Ref {
+			xt = xt.Elem
+		}
+		if f := xt.Field(e.Name.Name); f != nil {
+			return &Symbol{Kind: FieldSymbol, Name: f.Name, Ident: f.Ident, Type: f.Type, Decl: f.Decl, File: s.Project.fileOf[f.Ident]}
+		}
+		if m := xt.Method(e.Name.Name); m != nil {
+			return &Symbol{Kind: POUSymbol, Name: m.Name.Name, Ident: m.Name, POU: m, File: s.Project.fileOf[m]}
+		}
+	}
+	return nil
+}
+
+// ── Type resolution ───────────────────────────────────────────────────────────
+
+// ResolveType resolves a type expression. Unknown names resolve to a type of
+// InvalidClass whose Name is the unknown name.
+func (s *Scope) ResolveType(ts TypeSpec) *Type {
+	p := s.Project
+	switch t := ts.(type) {
+	case nil:
+		return TypeBad
+	case *NamedType:
+		name := t.Name.Name
+		if i := strings.LastIndexByte(name, '.'); i >= 0 {
+			name = name[i+1:] // library namespace
+		}
+		if et := Elementary(name); et != nil {
+			return et
+		}
+		if td := p.types[strings.ToUpper(name)]; td != nil {
+			return p.typeDeclType(td)
+		}
+		if d := p.POU(name); d != nil && (d.Kind == FunctionBlock || d.Kind == Program) {
+			return p.instanceType(d)
+		}
+		return &Type{Class: InvalidClass, Name: t.Name.Name}
+	case *StringType:
+		n := DefaultStringLen
+		if t.Len != nil {
+			if v, ok := s.ConstInt(t.Len); ok {
+				n = int(v)
+			}
+		}
+		return StringOf(n, t.Wide)
+	case *ArrayType:
+		at := &Type{Class: ArrayClass, Elem: s.ResolveType(t.Elem)}
+		var dims []string
+		for _, d := range t.Dims {
+			lo, ok1 := s.ConstInt(d.Lo)
+			hi, ok2 := s.ConstInt(d.Hi)
+			at.Dims = append(at.Dims, Dim{Lo: lo, Hi: hi, Known: ok1 && ok2})
+			if ok1 && ok2 {
+				dims = append(dims, fmt.Sprintf("%d..%d", lo, hi))
+			} else {
+				dims = append(dims, "?..?")
+			}
+		}
+		at.Name = "ARRAY[" + strings.Join(dims, ", ") + "] OF " + at.Elem.Name
+		return at
+	case *PointerType:
+		pt := &Type{Class: PointerClass, Ref: t.Ref, Elem: s.ResolveType(t.Elem), Bits: 64}
+		if t.Ref {
+			pt.Name = "REFERENCE TO " + pt.Elem.Name
+		} else {
+			pt.Name = "POINTER TO " + pt.Elem.Name
+		}
+		return pt
+	case *StructType:
+		st := &Type{Class: StructClass, Name: "STRUCT"}
+		s.fillStruct(st, t)
+		return st
+	case *EnumType:
+		et := &Type{Class: EnumClass, Name: "ENUM"}
+		s.fillEnum(et, t)
+		return et
+	case *SubrangeType:
+		return s.ResolveType(t.Base)
+	}
+	return TypeBad
+}
+
+// typeDeclType returns the resolved type of a TYPE declaration. The result
+// is cached, and entered in the cache before it is filled so recursive types
+// (a struct with a POINTER TO itself) terminate.
+func (p *Project) typeDeclType(td *TypeDecl) *Type {
+	if t := p.resolved[td]; t != nil {
+		return t
+	}
+	s := p.global
+	t := &Type{Name: td.Name.Name, Decl: td}
+	p.resolved[td] = t
+	switch spec := td.Type.(type) {
+	case *StructType:
+		t.Class = StructClass
+		if td.Extends != nil {
+			if base := p.types[strings.ToUpper(td.Extends.Name)]; base != nil {
+				t.Base = p.typeDeclType(base)
+			}
+		}
+		s.fillStruct(t, spec)
+	case *EnumType:
+		t.Class = EnumClass
+		s.fillEnum(t, spec)
+	default:
+		// alias, array, string, subrange or pointer type: a named copy
+		u := s.ResolveType(td.Type)
+		*t = *u
+		t.Name = td.Name.Name
+		if t.Decl == nil {
+			t.Decl = td
+		}
+	}
+	return t
+}
+
+func (s *Scope) fillStruct(t *Type, spec *StructType) {
+	for _, v := range spec.Fields {
+		ft := s.ResolveType(v.Type)
+		for _, id := range v.Names {
+			t.Fields = append(t.Fields, &Field{Name: id.Name, Type: ft, Decl: v, Ident: id})
+		}
+	}
+}
+
+func (s *Scope) fillEnum(t *Type, spec *EnumType) {
+	if spec.Base != nil {
+		t.Base = s.ResolveType(spec.Base)
+		t.Bits = t.Base.Bits
+	} else {
+		t.Bits = 16
+	}
+	next := int64(0)
+	for _, v := range spec.Values {
+		if v.Value != nil {
+			if n, ok := s.ConstInt(v.Value); ok {
+				next = n
+			}
+		}
+		t.Members = append(t.Members, &EnumMember{Name: v.Name.Name, Value: next, Ident: v.Name})
+		next++
+	}
+}
+
+// InstanceType returns the type of an instance of a FUNCTION_BLOCK or PROGRAM.
+func (p *Project) InstanceType(d *POU) *Type { return p.instanceType(d) }
+
+// TypeOfDecl returns the resolved type of a TYPE declaration.
+func (p *Project) TypeOfDecl(td *TypeDecl) *Type { return p.typeDeclType(td) }
+
+func (p *Project) instanceType(d *POU) *Type {
+	if t := p.resolved[d]; t != nil {
+		return t
+	}
+	t := &Type{Class: InstanceClass, Name: d.Name.Name, POU: d, methods: map[string]*POU{}}
+	p.resolved[d] = t
+	if d.Extends != nil {
+		if base := p.POU(d.Extends.Name); base != nil && base != d {
+			t.Base = p.instanceType(base)
+		}
+	}
+	s := p.Scope(d) // array bounds may use the FB's own constants
+	for _, b := range d.VarBlocks {
+		for _, v := range b.Vars {
+			ft := s.ResolveType(v.Type)
+			for _, id := range v.Names {
+				t.Fields = append(t.Fields, &Field{Name: id.Name, Type: ft, Decl: v, Block: b.Kind, Ident: id})
+			}
+		}
+	}
+	for _, m := range d.Methods {
+		t.methods[strings.ToUpper(m.Name.Name)] = m
+	}
+	return t
+}
+
+// ── Expression types ──────────────────────────────────────────────────────────
+
+// TypeOf returns the type of an expression. Names that cannot be resolved
+// give a type of InvalidClass; FB and program calls give VoidClass.
+func (s *Scope) TypeOf(e Expr) *Type {
+	switch e := e.(type) {
+	case *Ident:
+		sym := s.Lookup(e.Name)
+		if sym == nil {
+			return TypeBad
+		}
+		return s.valueType(sym)
+	case *Literal:
+		return literalType(e)
+	case *EnumLiteral, *MemberExpr:
+		if m, ok := e.(*MemberExpr); ok && isBitNumber(m.Name.Name) {
+			if xt := s.TypeOf(m.X); xt.IsInteger() {
+				return TypeBool
+			}
+		}
+		sym := s.Resolve(e)
+		if sym == nil {
+			return TypeBad
+		}
+		return s.valueType(sym)
+	case *BinaryExpr:
+		x, y := s.TypeOf(e.X), s.TypeOf(e.Y)
+		switch e.Op {
+		case "=", "<>", "<", ">", "<=", ">=":
+			return TypeBool
+		case "AND", "OR", "XOR", "AND_THEN", "OR_ELSE":
+			if x.Class == BoolClass && y.Class == BoolClass {
+				return TypeBool
+			}
+			return commonType(x, y)
+		case "**":
+			if x.Class == RealClass && x.Bits == 64 || y.Class == RealClass && y.Bits == 64 {
+				return TypeLReal
+			}
+			return TypeReal
+		case "-":
+			if x.Class == DateClass && y.Class == DateClass {
+				return TypeTime
+			}
+		}
+		return commonType(x, y)
+	case *UnaryExpr:
+		t := s.TypeOf(e.X)
+		if e.Op == "-" && t.Class == IntClass && !t.Signed && !t.Untyped {
+			return commonType(t, TypeSInt)
+		}
+		return t
+	case *ParenExpr:
+		return s.TypeOf(e.X)
+	case *IndexExpr:
+		t := s.TypeOf(e.X)
+		switch t.Class {
+		case ArrayClass:
+			return t.Elem
+		case StringClass:
+			if t.Wide {
+				return TypeWord
+			}
+			return TypeByte
+		case PointerClass:
+			return t.Elem
+		}
+		return TypeBad
+	case *DerefExpr:
+		t := s.TypeOf(e.X)
+		if t.Class == PointerClass {
+			return t.Elem
+		}
+		return TypeBad
+	case *CallExpr:
+		return s.callType(e)
+	case *AddressExpr:
+		return addressType(e.Text)
+	case *RangeExpr:
+		return s.TypeOf(e.Lo)
+	case *ArrayInit, *StructInit:
+		return TypeAny
+	}
+	return TypeBad
+}
+
+// valueType is the type of a symbol used as a value.
+func (s *Scope) valueType(sym *Symbol) *Type {
+	switch sym.Kind {
+	case VarSymbol, GlobalSymbol, FieldSymbol, EnumValueSymbol:
+		if sym.Type == nil {
+			return TypeBad
+		}
+		if sym.Type.Class == PointerClass && sym.Type.Ref {
+			return sym.Type.Elem // references are used like the referenced variable
+		}
+		return sym.Type
+	case POUSymbol:
+		if sym.POU.Kind == Program {
+			return s.Project.instanceType(sym.POU)
+		}
+	}
+	return TypeBad
+}
+
+// callType returns the result type of a call.
+func (s *Scope) callType(c *CallExpr) *Type {
+	if id, ok := c.Func.(*Ident); ok {
+		sym := s.Lookup(id.Name)
+		switch {
+		case sym != nil && sym.Kind == POUSymbol:
+			return s.Project.returnType(sym.POU)
+		case sym != nil && sym.Kind != TypeSymbol:
+			return TypeVoid // FB instance call
+		}
+		if t, ok := stdFunctionType(s, id.Name, c.Args); ok {
+			return t
+		}
+		return TypeBad
+	}
+	if sym := s.Resolve(c.Func); sym != nil && sym.Kind == POUSymbol {
+		return s.Project.returnType(sym.POU)
+	}
+	return TypeVoid
+}
+
+// returnType is the result type of a function or method, VoidClass for
+// other POUs.
+func (p *Project) returnType(d *POU) *Type {
+	if d.ReturnType == nil || d.Kind == FunctionBlock || d.Kind == Program {
+		return TypeVoid
+	}
+	return p.global.ResolveType(d.ReturnType)
+}
+
+func isBitNumber(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !isDigit(s[i]) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// literalType returns the type of a literal. Untyped numbers are ANY_INT or
+// ANY_REAL and adapt to the other operand or the assignment target.
+func literalType(e *Literal) *Type {
+	prefix := e.TypePrefix()
+	switch e.Kind {
+	case KEYWORD:
+		return TypeBool
+	case INT, REAL:
+		if prefix != "" {
+			if t := Elementary(prefix); t != nil {
+				return t
+			}
+		}
+		if e.Kind == REAL {
+			return TypeAnyReal
+		}
+		return TypeAnyInt
+	case STRING, WSTRING:
+		v, _ := e.Str()
+		n := len(v)
+		if n < DefaultStringLen {
+			n = DefaultStringLen
+		}
+		return StringOf(n, e.Kind == WSTRING)
+	case TIME:
+		switch prefix {
+		case "T", "TIME":
+			return TypeTime
+		case "LT", "LTIME":
+			return TypeLTime
+		case "D", "DATE":
+			return TypeDate
+		case "LD", "LDATE":
+			return TypeLDate
+		case "TOD", "TIME_OF_DAY":
+			return TypeTOD
+		case "LTOD":
+			return TypeLTOD
+		case "DT", "DATE_AND_TIME":
+			return TypeDT
+		case "LDT":
+			return TypeLDT
+		}
+	}
+	return TypeBad
+}
+
+// addressType returns the type of a direct address from its size prefix:
+// %IX0.0 is BOOL, %IB BYTE, %IW WORD, %ID DWORD, %IL LWORD.
+func addressType(addr string) *Type {
+	if len(addr) < 3 {
+		return TypeBool
+	}
+	switch addr[2] {
+	case 'B', 'b':
+		return TypeByte
+	case 'W', 'w':
+		return TypeWord
+	case 'D', 'd':
+		return TypeDWord
+	case 'L', 'l':
+		return TypeLWord
+	}
+	return TypeBool
+}
+
+// ── Constants ─────────────────────────────────────────────────────────────────
+
+// ConstInt evaluates an integer constant expression: literals, enumeration
+// values, CONSTANT variables with an initial value and arithmetic on them.
+func (s *Scope) ConstInt(e Expr) (int64, bool) {
+	if s.depth > 32 {
+		return 0, false
+	}
+	s.depth++
+	defer func() { s.depth-- }()
+	switch e := e.(type) {
+	case *Literal:
+		return e.Int()
+	case *ParenExpr:
+		return s.ConstInt(e.X)
+	case *UnaryExpr:
+		v, ok := s.ConstInt(e.X)
+		switch e.Op {
+		case "-":
+			return -v, ok
+		case "+":
+			return v, ok
+		}
+	case *BinaryExpr:
+		x, ok1 := s.ConstInt(e.X)
+		y, ok2 := s.ConstInt(e.Y)
+		if !ok1 || !ok2 {
+			return 0, false
+		}
+		switch e.Op {
+		case "+":
+			return x + y, true
+		case "-":
+			return x - y, true
+		case "*":
+			return x * y, true
+		case "/":
+			if y != 0 {
+				return x / y, true
+			}
+		case "MOD":
+			if y != 0 {
+				return x % y, true
+			}
+		case "AND":
+			return x & y, true
+		case "OR":
+			return x | y, true
+		case "XOR":
+			return x ^ y, true
+		}
+	case *Ident, *MemberExpr, *EnumLiteral:
+		sym := s.Resolve(e)
+		if sym == nil {
+			return 0, false
+		}
+		switch {
+		case sym.Kind == EnumValueSymbol:
+			return sym.Member.Value, true
+		case sym.IsConstant() && sym.Decl.Init != nil:
+			return s.ConstInt(sym.Decl.Init)
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,171 @@
+// Package st parses IEC 61131-3 Structured Text as written by the importers of
+// this repository: one POU, GVL (bare VAR_GLOBAL or CONFIGURATION-wrapped) or
+// TYPE block per .st file, with CoDeSys pragmas and comments.
+//
+// The package provides a lexer that keeps comments and pragmas, an AST with
+// source positions, a recovering parser and a formatter. It is the common
+// front end of the iecst commands.
+package st
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ── Positions ─────────────────────────────────────────────────────────────────
+
+// Pos is a source position. Line and Col are 1-based; Col counts bytes.
+// Offset is the 0-based byte offset into the source.
+type Pos struct {
+	Offset int
+	Line   int
+	Col    int
+}
+
+// IsValid reports whether the position is set.
+func (p Pos) IsValid() bool { return p.Line > 0 }
+
+func (p Pos) String() string {
+	if !p.IsValid() {
+		return "-"
+	}
+	return fmt.Sprintf("%d:%d", p.Line, p.Col)
+}
+
+// ── Tokens ────────────────────────────────────────────────────────────────────
+
+// Kind classifies a token.
+type Kind int
+
+const (
+	EOF Kind = iota
+	ILLEGAL
+	COMMENT // // line, (* block *) or /* block */
+	PRAGMA  // { ... }
+
+	IDENT
+	KEYWORD
+	INT     // 42, 16#FF, 2#1010_0101, INT#5
+	REAL    // 1.5, 1E3, REAL#1.5
+	STRING  // 'text'
+	WSTRING // "text"
+	TIME    // T#1s, TIME#1h2m, LT#…, D#…, TOD#…, DT#…
+	ADDRESS // %IX0.0, %QW4, %MD10, %I*
+
+	ASSIGN    // :=
+	OUTPUT    // =>
+	COLON     // :
+	SEMICOLON // ;
+	COMMA     // ,
+	DOT       // .
+	RANGE     // ..
+	HASH      // #
+	CARET     // ^
+	LPAREN    // (
+	RPAREN    // )
+	LBRACK    // [
+	RBRACK    // ]
+	PLUS      // +
+	MINUS     // -
+	STAR      // *
+	SLASH     // /
+	POWER     // **
+	AMP       // &
+	EQ        // =
+	NEQ       // <>
+	LT        // <
+	GT        // >
+	LEQ       // <=
+	GEQ       // >=
+)
+
+var kindNames = [...]string{
+	EOF: "end of file", ILLEGAL: "illegal character", COMMENT: "comment", PRAGMA: "pragma",
+	IDENT: "identifier", KEYWORD: "keyword", INT: "integer literal", REAL: "real literal",
+	STRING: "string literal", WSTRING: "wide string literal", TIME: "time literal", ADDRESS: "address",
+	ASSIGN: "':='", OUTPUT: "'=>'", COLON: "':'", SEMICOLON: "';'", COMMA: "','", DOT: "'.'",
+	RANGE: "'..'", HASH: "'#'", CARET: "'^'", LPAREN: "'('", RPAREN: "')'", LBRACK: "'['",
+	RBRACK: "']'", PLUS: "'+'", MINUS: "'-'", STAR: "'*'", SLASH: "'/'", POWER: "'**'",
+	AMP: "'&'", EQ: "'='", NEQ: "'<>'", LT: "'<'", GT: "'>'", LEQ: "'<='", GEQ: "'>='",
+}
+
+func (k Kind) String() string {
+	if int(k) < len(kindNames) && kindNames[k] != "" {
+		return kindNames[k]
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+// Token is one lexical element. Text is the exact source text; for keywords
+// Upper holds the canonical upper-case spelling.
+type Token struct {
+	Kind Kind
+	Text string
+	Pos  Pos
+	End  Pos // position just past the token
+}
+
+// Upper returns the token text in upper case, which is how keywords and
+// elementary type names are compared.
+func (t Token) Upper() string { return strings.ToUpper(t.Text) }
+
+// Is reports whether t is the keyword kw (given in upper case).
+func (t Token) Is(kw string) bool { return t.Kind == KEYWORD && strings.EqualFold(t.Text, kw) }
+
+func (t Token) String() string {
+	switch t.Kind {
+	case EOF, ASSIGN, OUTPUT, COLON, SEMICOLON, COMMA, DOT, RANGE, HASH, CARET,
+		LPAREN, RPAREN, LBRACK, RBRACK, PLUS, MINUS, STAR, SLASH, POWER, AMP,
+		EQ, NEQ, LT, GT, LEQ, GEQ:
+		return t.Kind.String()
+	}
+	return fmt.Sprintf("%s %q", t.Kind, t.Text)
+}
+
+// ── Keywords ──────────────────────────────────────────────────────────────────
+
+var keywords = wordSet(`
+		PROGRAM END_PROGRAM FUNCTION END_FUNCTION FUNCTION_BLOCK END_FUNCTION_BLOCK
+		METHOD END_METHOD PROPERTY END_PROPERTY END_GET END_SET TYPE END_TYPE STRUCT END_STRUCT
+		VAR VAR_INPUT VAR_OUTPUT VAR_IN_OUT VAR_GLOBAL VAR_EXTERNAL VAR_TEMP VAR_STAT
+		VAR_INST VAR_CONFIG VAR_ACCESS END_VAR CONSTANT RETAIN PERSISTENT NON_RETAIN AT
+		CONFIGURATION END_CONFIGURATION RESOURCE END_RESOURCE ON TASK WITH
+		IF THEN ELSIF ELSE END_IF CASE OF END_CASE FOR TO BY DO END_FOR
+		WHILE END_WHILE REPEAT UNTIL END_REPEAT EXIT CONTINUE RETURN
+		AND OR XOR NOT MOD AND_THEN OR_ELSE TRUE FALSE
+		ARRAY POINTER REFERENCE EXTENDS IMPLEMENTS ABSTRACT FINAL
+		PUBLIC PRIVATE PROTECTED INTERNAL`)
+
+// IsKeyword reports whether s (in any case) is a reserved word.
+func IsKeyword(s string) bool { return keywords[strings.ToUpper(s)] }
+
+// elementaryTypes lists the IEC 61131-3 elementary data types. The formatter
+// writes them in upper case like keywords; the type checker and interpreter
+// know their sizes and ranges.
+var elementaryTypes = wordSet(`
+		BOOL BYTE WORD DWORD LWORD SINT INT DINT LINT USINT UINT UDINT ULINT
+		REAL LREAL TIME LTIME DATE LDATE TIME_OF_DAY TOD LTOD DATE_AND_TIME DT LDT
+		STRING WSTRING CHAR WCHAR ANY ANY_NUM ANY_INT ANY_REAL ANY_BIT`)
+
+// wordSet returns the whitespace-separated words of s as a set. The keyword
+// tables are built by initialisers rather than init functions so that they
+// are ready when the standard library is parsed during package init.
+func wordSet(s string) map[string]bool {
+	m := map[string]bool{}
+	for _, w := range strings.Fields(s) {
+		m[w] = true
+	}
+	return m
+}
+
+// IsElementaryType reports whether s (in any case) names an elementary type.
+func IsElementaryType(s string) bool { return elementaryTypes[strings.ToUpper(s)] }
+
+// timePrefixes are the typed-literal prefixes whose value is a duration or a
+// date/time rather than a number.
+var timePrefixes = map[string]bool{
+	"T": true, "TIME": true, "LT": true, "LTIME": true,
+	"D": true, "DATE": true, "LD": true, "LDATE": true,
+	"TOD": true, "TIME_OF_DAY": true, "LTOD": true,
+	"DT": true, "DATE_AND_TIME": true, "LDT": true,
+}
@@ -0,0 +1,467 @@
+package st
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// ── Types ─────────────────────────────────────────────────────────────────────
+
+// Class is the broad category of a resolved type.
+type Class int
+
+const (
+	InvalidClass  Class = iota // unresolved or erroneous
+	BoolClass                  // BOOL
+	BitsClass                  // BYTE, WORD, DWORD, LWORD
+	IntClass                   // SINT … ULINT
+	RealClass                  // REAL, LREAL
+	StringClass                // STRING, WSTRING
+	CharClass                  // CHAR, WCHAR
+	TimeClass                  // TIME, LTIME
+	DateClass                  // DATE, TOD, DT and their long forms
+	ArrayClass                 // ARRAY[…] OF …
+	StructClass                // STRUCT … END_STRUCT
+	EnumClass                  // (a, b, c)
+	PointerClass               // POINTER TO … and REFERENCE TO …
+	InstanceClass              // FUNCTION_BLOCK or PROGRAM instance
+	AnyClass                   // generic ANY_… parameters of standard functions
+	VoidClass                  // result of calls without a value
+)
+
+// Type is a resolved data type. Named types share one *Type per project, so
+// two types are identical when their pointers are equal; anonymous array,
+// pointer and string types are compared structurally by Identical.
+type Type struct {
+	Class   Class
+	Name    string // INT, ST_Motor, ARRAY[1..10] OF INT, …
+	Bits    int    // storage size of elementary types
+	Signed  bool   // IntClass only
+	Untyped bool   // untyped numeric literal: adapts to its context
+	Len     int    // STRING/WSTRING length in characters
+	Wide    bool   // WSTRING, WCHAR
+	Ref     bool   // REFERENCE TO rather than POINTER TO
+
+	Elem    *Type         // array element, pointer target
+	Dims    []Dim         // array dimensions
+	Fields  []*Field      // struct members, FB variables
+	Members []*EnumMember // enumeration values
+	Base    *Type         // enum base type, base struct, base FB
+	POU     *POU          // InstanceClass
+	Decl    *TypeDecl     // declaring TYPE entry, nil for built-in types
+	methods map[string]*POU
+}
+
+// Dim is one array dimension. Known is false when a bound is not a constant.
+type Dim struct {
+	Lo, Hi int64
+	Known  bool
+}
+
+// Len returns the number of elements of the dimension.
+func (d Dim) Len() int64 { return d.Hi - d.Lo + 1 }
+
+// Field is a struct member or a variable of a function block.
+type Field struct {
+	Name  string
+	Type  *Type
+	Decl  *VarDecl
+	Block string // VAR_INPUT, VAR_OUTPUT, …; "" for struct members
+	Ident *Ident // declaring identifier
+}
+
+// EnumMember is a value of an enumeration.
+type EnumMember struct {
+	Name  string
+	Value int64
+	Ident *Ident
+}
+
+func (t *Type) String() string {
+	if t == nil {
+		return "<nil>"
+	}
+	return t.Name
+}
+
+// Field returns the member or FB variable called name (any case), searching
+// base types too.
+func (t *Type) Field(name string) *Field {
+	for x := t; x != nil; x = x.Base {
+		if x.Class != StructClass && x.Class != InstanceClass {
+			return nil
+		}
+		for _, f := range x.Fields {
+			if strings.EqualFold(f.Name, name) {
+				return f
+			}
+		}
+	}
+	return nil
+}
+
+// Method returns the method called name of a function block type, searching
+// base function blocks too.
+func (t *Type) Method(name string) *POU {
+	for x := t; x != nil && x.Class == InstanceClass; x = x.Base {
+		if m := x.methods[strings.ToUpper(name)]; m != nil {
+			return m
+		}
+	}
+	return nil
+}
+
+// Member returns the enumeration value called name.
+func (t *Type) Member(name string) *EnumMember {
+	if t == nil || t.Class != EnumClass {
+		return nil
+	}
+	for _, m := range t.Members {
+		if strings.EqualFold(m.Name, name) {
+			return m
+		}
+	}
+	return nil
+}
+
+// IsNumeric reports whether t is an integer or real type.
+func (t *Type) IsNumeric() bool {
+	return t != nil && (t.Class == IntClass || t.Class == RealClass)
+}
+
+// IsInteger reports whether t holds integer values: integer, bit string and
+// enumeration types.
+func (t *Type) IsInteger() bool {
+	return t != nil && (t.Class == IntClass || t.Class == BitsClass || t.Class == EnumClass)
+}
+
+// Range returns the value range of integer and bit string types. For
+// ULINT and LWORD the maximum is capped at math.MaxInt64.
+func (t *Type) Range() (lo, hi int64, ok bool) {
+	if t == nil {
+		return 0, 0, false
+	}
+	switch t.Class {
+	case IntClass, BitsClass:
+	case EnumClass:
+		if t.Base != nil {
+			return t.Base.Range()
+		}
+		return math.MinInt16, math.MaxInt16, true
+	default:
+		return 0, 0, false
+	}
+	if t.Untyped {
+		return math.MinInt64, math.MaxInt64, true
+	}
+	if t.Signed {
+		if t.Bits >= 64 {
+			return math.MinInt64, math.MaxInt64, true
+		}
+		return -(1 << (t.Bits - 1)), 1<<(t.Bits-1) - 1, true
+	}
+	if t.Bits >= 64 {
+		return 0, math.MaxInt64, true
+	}
+	return 0, 1<<t.Bits - 1, true
+}
+
+// Identical reports whether a and b denote the same type.
+func Identical(a, b *Type) bool {
+	if a == b {
+		return true
+	}
+	if a == nil || b == nil || a.Class != b.Class {
+		return false
+	}
+	switch a.Class {
+	case ArrayClass:
+		if len(a.Dims) != len(b.Dims) {
+			return false
+		}
+		for i := range a.Dims {
+			if a.Dims[i].Known && b.Dims[i].Known && a.Dims[i] != b.Dims[i] {
+				return false
+			}
+		}
+		return Identical(a.Elem, b.Elem)
+	case PointerClass:
+		return a.Ref == b.Ref && Identical(a.Elem, b.Elem)
+	case StringClass:
+		return a.Wide == b.Wide
+	case StructClass, EnumClass, InstanceClass:
+		return a.Decl != nil && a.Decl == b.Decl || a.POU != nil && a.POU == b.POU
+	}
+	return a.Name == b.Name
+}
+
+// ── Elementary types ──────────────────────────────────────────────────────────
+
+var (
+	TypeBool  = &Type{Class: BoolClass, Name: "BOOL", Bits: 1}
+	TypeByte  = &Type{Class: BitsClass, Name: "BYTE", Bits: 8}
+	TypeWord  = &Type{Class: BitsClass, Name: "WORD", Bits: 16}
+	TypeDWord = &Type{Class: BitsClass, Name: "DWORD", Bits: 32}
+	TypeLWord = &Type{Class: BitsClass, Name: "LWORD", Bits: 64}
+	TypeSInt  = &Type{Class: IntClass, Name: "SINT", Bits: 8, Signed: true}
+	TypeInt   = &Type{Class: IntClass, Name: "INT", Bits: 16, Signed: true}
+	TypeDInt  = &Type{Class: IntClass, Name: "DINT", Bits: 32, Signed: true}
+	TypeLInt  = &Type{Class: IntClass, Name: "LINT", Bits: 64, Signed: true}
+	TypeUSInt = &Type{Class: IntClass, Name: "USINT", Bits: 8}
+	TypeUInt  = &Type{Class: IntClass, Name: "UINT", Bits: 16}
+	TypeUDInt = &Type{Class: IntClass, Name: "UDINT", Bits: 32}
+	TypeULInt = &Type{Class: IntClass, Name: "ULINT", Bits: 64}
+	TypeReal  = &Type{Class: RealClass, Name: "REAL", Bits: 32}
+	TypeLReal = &Type{Class: RealClass, Name: "LREAL", Bits: 64}
+	TypeTime  = &Type{Class: TimeClass, Name: "TIME", Bits: 32}
+	TypeLTime = &Type{Class: TimeClass, Name: "LTIME", Bits: 64}
+	TypeDate  = &Type{Class: DateClass, Name: "DATE", Bits: 32}
+	TypeTOD   = &Type{Class: DateClass, Name: "TOD", Bits: 32}
+	TypeDT    = &Type{Class: DateClass, Name: "DT", Bits: 32}
+	TypeLDate = &Type{Class: DateClass, Name: "LDATE", Bits: 64}
+	TypeLTOD  = &Type{Class: DateClass, Name: "LTOD", Bits: 64}
+	TypeLDT   = &Type{Class: DateClass, Name: "LDT", Bits: 64}
+	TypeChar  = &Type{Class: CharClass, Name: "CHAR", Bits: 8}
+	TypeWChar = &Type{Class: CharClass, Name: "WCHAR", Bits: 16, Wide: true}
+	TypeAny   = &Type{Class: AnyClass, Name: "ANY"}
+	TypeVoid  = &Type{Class: VoidClass, Name: "VOID"}
+	TypeBad   = &Type{Class: InvalidClass, Name: "invalid type"}
+
+	// untyped literals
+	TypeAnyInt  = &Type{Class: IntClass, Name: "ANY_INT", Bits: 64, Signed: true, Untyped: true}
+	TypeAnyReal = &Type{Class: RealClass, Name: "ANY_REAL", Bits: 64, Untyped: true}
+)
+
+// DefaultStringLen is the length of STRING and WSTRING without an explicit size.
+const DefaultStringLen = 80
+
+var elementary = map[string]*Type{
+	"BOOL": TypeBool, "BYTE": TypeByte, "WORD": TypeWord, "DWORD": TypeDWord, "LWORD": TypeLWord,
+	"SINT": TypeSInt, "INT": TypeInt, "DINT": TypeDInt, "LINT": TypeLInt,
+	"USINT": TypeUSInt, "UINT": TypeUInt, "UDINT": TypeUDInt, "ULINT": TypeULInt,
+	"REAL": TypeReal, "LREAL": TypeLReal, "TIME": TypeTime, "LTIME": TypeLTime,
+	"DATE": TypeDate, "TOD": TypeTOD, "TIME_OF_DAY": TypeTOD, "DT": TypeDT, "DATE_AND_TIME": TypeDT,
+	"LDATE": TypeLDate, "LTOD": TypeLTOD, "LDT": TypeLDT, "CHAR": TypeChar, "WCHAR": TypeWChar,
+	"STRING":  {Class: StringClass, Name: "STRING", Len: DefaultStringLen},
+	"WSTRING": {Class: StringClass, Name: "WSTRING", Len: DefaultStringLen, Wide: true},
+	"ANY":     TypeAny, "ANY_NUM": TypeAny, "ANY_INT": TypeAny, "ANY_REAL": TypeAny, "ANY_BIT": TypeAny,
+}
+
+// Elementary returns the elementary type called name (any case), or nil.
+func Elementary(name string) *Type { return elementary[strings.ToUpper(name)] }
+
+// StringOf returns the STRING or WSTRING type of length n.
+func StringOf(n int, wide bool) *Type {
+	name := "STRING"
+	if wide {
+		name = "WSTRING"
+	}
+	if n != DefaultStringLen {
+		name = fmt.Sprintf("%s(%d)", name, n)
+	}
+	return &Type{Class: StringClass, Name: name, Len: n, Wide: wide}
+}
+
+// ── Assignment compatibility ──────────────────────────────────────────────────
+
+// Conversion classifies an implicit conversion from one type to another.
+type Conversion int
+
+const (
+	ConvIdentical    Conversion = iota // same type
+	ConvWidening                       // lossless implicit conversion
+	ConvNarrowing                      // implicit but may lose information
+	ConvIncompatible                   // not allowed without an explicit conversion
+)
+
+// realMantissa is the number of integer bits REAL and LREAL hold exactly.
+var realMantissa = map[int]int{32: 24, 64: 53}
+
+// Convert classifies the implicit conversion of a value of type src to dst,
+// as in an assignment dst := src.
+func Convert(dst, src *Type) Conversion {
+	switch {
+	case dst == nil || src == nil:
+		return ConvIdentical
+	case dst.Class == InvalidClass || src.Class == InvalidClass,
+		dst.Class == AnyClass || src.Class == AnyClass:
+		return ConvIdentical
+	case Identical(dst, src):
+		if dst.Class == StringClass && src.Len > dst.Len {
+			return ConvNarrowing
+		}
+		return ConvIdentical
+	}
+
+	if src.Untyped {
+		switch {
+		case src.Class == IntClass && (dst.IsInteger() || dst.Class == RealClass):
+			return ConvIdentical
+		case src.Class == RealClass && dst.Class == RealClass:
+			return ConvIdentical
+		case src.Class == RealClass && dst.IsInteger():
+			return ConvNarrowing
+		}
+		return ConvIncompatible
+	}
+
+	switch dst.Class {
+	case IntClass, BitsClass:
+		switch src.Class {
+		case IntClass, BitsClass, EnumClass:
+			return intConversion(dst, src)
+		case RealClass:
+			return ConvNarrowing
+		}
+	case EnumClass:
+		if src.Class == IntClass || src.Class == BitsClass {
+			return ConvNarrowing
+		}
+	case RealClass:
+		switch src.Class {
+		case RealClass:
+			if src.Bits > dst.Bits {
+				return ConvNarrowing
+			}
+			return ConvWidening
+		case IntClass, BitsClass, EnumClass:
+			if src.Bits > realMantissa[dst.Bits] {
+				return ConvNarrowing
+			}
+			return ConvWidening
+		}
+	case TimeClass, DateClass:
+		if src.Class == dst.Class {
+			if src.Bits > dst.Bits {
+				return ConvNarrowing
+			}
+			return ConvWidening
+		}
+	case StringClass:
+		if src.Class == StringClass && src.Wide == dst.Wide {
+			if src.Len > dst.Len {
+				return ConvNarrowing
+			}
+			return ConvWidening
+		}
+	case CharClass:
+		if src.Class == CharClass {
+			if src.Bits > dst.Bits {
+				return ConvNarrowing
+			}
+			return ConvWidening
+		}
+	case PointerClass:
+		if src.Class == PointerClass {
+			if dst.Elem == nil || src.Elem == nil || dst.Elem.Class == AnyClass || src.Elem.Class == AnyClass ||
+				Identical(dst.Elem, src.Elem) || derives(src.Elem, dst.Elem) {
+				return ConvWidening
+			}
+			if dst.Elem.Class == BitsClass && dst.Elem.Bits == 8 {
+				return ConvWidening // POINTER TO BYTE takes any address
+			}
+		}
+		if !dst.Ref && (src.Class == IntClass || src.Class == BitsClass) && src.Bits >= 32 {
+			return ConvNarrowing // address arithmetic
+		}
+	case InstanceClass, StructClass:
+		if derives(src, dst) {
+			return ConvWidening
+		}
+	case ArrayClass:
+		if src.Class == ArrayClass && Convert(dst.Elem, src.Elem) == ConvIdentical && len(dst.Dims) == len(src.Dims) {
+			return ConvNarrowing // same element type, different bounds
+		}
+	}
+	return ConvIncompatible
+}
+
+func intConversion(dst, src *Type) Conversion {
+	if src.Class == EnumClass {
+		if src.Base != nil {
+			src = src.Base
+		} else {
+			src = TypeInt
+		}
+	}
+	srcSigned := src.Class == IntClass && src.Signed
+	dstSigned := dst.Class == IntClass && dst.Signed
+	switch {
+	case srcSigned == dstSigned && src.Bits <= dst.Bits:
+		return ConvWidening
+	case !srcSigned && dstSigned && src.Bits < dst.Bits:
+		return ConvWidening
+	}
+	return ConvNarrowing
+}
+
+// derives reports whether t is, or extends, base.
+func derives(t, base *Type) bool {
+	for x := t; x != nil; x = x.Base {
+		if Identical(x, base) {
+			return true
+		}
+		if x.Class != InstanceClass && x.Class != StructClass {
+			return false
+		}
+	}
+	return false
+}
+
+// commonType returns the type of a binary arithmetic or bitwise expression
+// whose operands have the types a and b.
+func commonType(a, b *Type) *Type {
+	switch {
+	case a == nil || a.Class == InvalidClass || a.Class == AnyClass:
+		return b
+	case b == nil || b.Class == InvalidClass || b.Class == AnyClass:
+		return a
+	case a.Untyped && !b.Untyped:
+		if a.Class == RealClass && b.IsInteger() {
+			return TypeLReal
+		}
+		return b
+	case b.Untyped && !a.Untyped:
+		if b.Class == RealClass && a.IsInteger() {
+			return TypeLReal
+		}
+		return a
+	case a.Class == EnumClass:
+		return commonType(enumBase(a), b)
+	case b.Class == EnumClass:
+		return commonType(a, enumBase(b))
+	}
+	if a.Class == RealClass || b.Class == RealClass {
+		if a.Bits == 64 && a.Class == RealClass || b.Bits == 64 && b.Class == RealClass || a.Untyped {
+			return TypeLReal
+		}
+		return TypeReal
+	}
+	if a.Class != b.Class && (a.Class == TimeClass || a.Class == DateClass) {
+		return a
+	}
+	if a.Class != b.Class && (b.Class == TimeClass || b.Class == DateClass) {
+		return b
+	}
+	switch {
+	case Convert(b, a) <= ConvWidening:
+		return b
+	case Convert(a, b) <= ConvWidening:
+		return a
+	}
+	// mixed signedness of equal size: the next larger signed type
+	for _, t := range []*Type{TypeSInt, TypeInt, TypeDInt, TypeLInt} {
+		if t.Bits > a.Bits && t.Bits > b.Bits {
+			return t
+		}
+	}
+	return TypeLInt
+}
+
+func enumBase(t *Type) *Type {
+	if t.Base != nil {
+		return t.Base
+	}
+	return TypeInt
+}
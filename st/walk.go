@@ -0,0 +1,220 @@
+package st
+
+// ── Walking the AST ───────────────────────────────────────────────────────────
+
+// Inspect traverses the tree rooted at n in depth-first order, calling f for
+// every node. When f returns false the children of that node are skipped.
+// Clauses and arguments without a position of their own (ElsifClause,
+// CaseClause, Arg, ArrayElem, FieldInit) are not passed to f; their children
+// are.
+func Inspect(n Node, f func(Node) bool) {
+	if n == nil || isNilNode(n) || !f(n) {
+		return
+	}
+	switch n := n.(type) {
+	case *POU:
+		if n.ReturnType != nil {
+			Inspect(n.ReturnType, f)
+		}
+		for _, b := range n.VarBlocks {
+			Inspect(b, f)
+		}
+		for _, m := range n.Methods {
+			Inspect(m, f)
+		}
+		for _, pr := range n.Properties {
+			Inspect(pr, f)
+		}
+		inspectStmts(n.Body, f)
+	case *Property:
+		if n.Type != nil {
+			Inspect(n.Type, f)
+		}
+		Inspect(n.Get, f)
+		Inspect(n.Set, f)
+	case *VarBlock:
+		for _, v := range n.Vars {
+			Inspect(v, f)
+		}
+	case *VarDecl:
+		for _, id := range n.Names {
+			Inspect(id, f)
+		}
+		if n.Type != nil {
+			Inspect(n.Type, f)
+		}
+		if n.Init != nil {
+			Inspect(n.Init, f)
+		}
+	case *TypeBlock:
+		for _, t := range n.Types {
+			Inspect(t, f)
+		}
+	case *TypeDecl:
+		Inspect(n.Name, f)
+		if n.Type != nil {
+			Inspect(n.Type, f)
+		}
+		if n.Init != nil {
+			Inspect(n.Init, f)
+		}
+	case *Configuration:
+		for _, b := range n.VarBlocks {
+			Inspect(b, f)
+		}
+		for _, r := range n.Resources {
+			Inspect(r, f)
+		}
+	case *Resource:
+		for _, b := range n.VarBlocks {
+			Inspect(b, f)
+		}
+		for _, t := range n.Tasks {
+			Inspect(t, f)
+		}
+		for _, pc := range n.Programs {
+			Inspect(pc, f)
+		}
+	case *TaskDecl:
+		inspectArgs(n.Params, f)
+
+	case *NamedType:
+		Inspect(n.Name, f)
+	case *StringType:
+		if n.Len != nil {
+			Inspect(n.Len, f)
+		}
+	case *ArrayType:
+		for _, d := range n.Dims {
+			Inspect(d.Lo, f)
+			Inspect(d.Hi, f)
+		}
+		Inspect(n.Elem, f)
+	case *PointerType:
+		Inspect(n.Elem, f)
+	case *StructType:
+		for _, v := range n.Fields {
+			Inspect(v, f)
+		}
+	case *EnumType:
+		for _, v := range n.Values {
+			Inspect(v.Name, f)
+			if v.Value != nil {
+				Inspect(v.Value, f)
+			}
+		}
+		if n.Base != nil {
+			Inspect(n.Base, f)
+		}
+	case *SubrangeType:
+		Inspect(n.Base, f)
+		Inspect(n.Range.Lo, f)
+		Inspect(n.Range.Hi, f)
+
+	case *AssignStmt:
+		Inspect(n.Target, f)
+		Inspect(n.Value, f)
+	case *CallStmt:
+		Inspect(n.Call, f)
+	case *IfStmt:
+		Inspect(n.Cond, f)
+		inspectStmts(n.Then, f)
+		for _, c := range n.Elsifs {
+			Inspect(c.Cond, f)
+			inspectStmts(c.Body, f)
+		}
+		inspectStmts(n.Else, f)
+	case *CaseStmt:
+		Inspect(n.Selector, f)
+		for _, c := range n.Cases {
+			for _, l := range c.Labels {
+				Inspect(l, f)
+			}
+			inspectStmts(c.Body, f)
+		}
+		inspectStmts(n.Else, f)
+	case *ForStmt:
+		Inspect(n.Var, f)
+		Inspect(n.From, f)
+		Inspect(n.To, f)
+		if n.By != nil {
+			Inspect(n.By, f)
+		}
+		inspectStmts(n.Body, f)
+	case *WhileStmt:
+		Inspect(n.Cond, f)
+		inspectStmts(n.Body, f)
+	case *RepeatStmt:
+		inspectStmts(n.Body, f)
+		Inspect(n.Cond, f)
+
+	case *EnumLiteral:
+		Inspect(n.Type, f)
+		Inspect(n.Value, f)
+	case *BinaryExpr:
+		Inspect(n.X, f)
+		Inspect(n.Y, f)
+	case *UnaryExpr:
+		Inspect(n.X, f)
+	case *ParenExpr:
+		Inspect(n.X, f)
+	case *MemberExpr:
+		Inspect(n.X, f)
+		Inspect(n.Name, f)
+	case *IndexExpr:
+		Inspect(n.X, f)
+		for _, i := range n.Indices {
+			Inspect(i, f)
+		}
+	case *DerefExpr:
+		Inspect(n.X, f)
+	case *CallExpr:
+		Inspect(n.Func, f)
+		inspectArgs(n.Args, f)
+	case *RangeExpr:
+		Inspect(n.Lo, f)
+		Inspect(n.Hi, f)
+	case *ArrayInit:
+		for _, e := range n.Elems {
+			if e.Count != nil {
+				Inspect(e.Count, f)
+			}
+			Inspect(e.Value, f)
+		}
+	case *StructInit:
+		for _, fi := range n.Fields {
+			Inspect(fi.Name, f)
+			Inspect(fi.Value, f)
+		}
+	}
+}
+
+func inspectStmts(list []Stmt, f func(Node) bool) {
+	for _, s := range list {
+		Inspect(s, f)
+	}
+}
+
+func inspectArgs(args []*Arg, f func(Node) bool) {
+	for _, a := range args {
+		if a.Name != nil {
+			Inspect(a.Name, f)
+		}
+		if a.Value != nil {
+			Inspect(a.Value, f)
+		}
+	}
+}
+
+// isNilNode catches typed nil pointers stored in a Node interface.
+func isNilNode(n Node) bool {
+	switch n := n.(type) {
+	case *Ident:
+		return n == nil
+	case *POU:
+		return n == nil
+	case *CallExpr:
+		return n == nil
+	}
+	return false
+}